@@ -2,63 +2,107 @@ package main
 
 import (
 	"context"
-	"encoding/hex"
+	"flag"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/annotate"
 	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/bootstrap"
+	"github.com/vurakit/agentveil/internal/breakglass"
+	"github.com/vurakit/agentveil/internal/cache"
+	"github.com/vurakit/agentveil/internal/compliance"
 	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/detector/bundle"
+	"github.com/vurakit/agentveil/internal/detector/remote"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/feedback"
+	"github.com/vurakit/agentveil/internal/guardrail"
 	"github.com/vurakit/agentveil/internal/logging"
+	"github.com/vurakit/agentveil/internal/metrics"
+	"github.com/vurakit/agentveil/internal/mitm"
+	"github.com/vurakit/agentveil/internal/overload"
+	"github.com/vurakit/agentveil/internal/promptguard"
 	"github.com/vurakit/agentveil/internal/proxy"
 	"github.com/vurakit/agentveil/internal/ratelimit"
+	"github.com/vurakit/agentveil/internal/readiness"
+	"github.com/vurakit/agentveil/internal/redisconn"
 	"github.com/vurakit/agentveil/internal/router"
+	"github.com/vurakit/agentveil/internal/session"
+	"github.com/vurakit/agentveil/internal/stats"
+	"github.com/vurakit/agentveil/internal/transcript"
+	"github.com/vurakit/agentveil/internal/upstream"
 	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/version"
 	"github.com/vurakit/agentveil/internal/webhook"
+	"github.com/vurakit/agentveil/sdk/mcp"
 )
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "validate configuration and exit without binding ports")
+	checkRedis := flag.Bool("check-redis", false, "with --dry-run, also ping Redis")
+	flag.Parse()
+
+	if *dryRun {
+		if !bootstrap.Validate(os.Stdout, *checkRedis) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Structured logging
 	logLevel := envOr("LOG_LEVEL", "info")
-	logger := logging.Setup(logLevel, os.Stdout)
-	logger.Info("starting Agent Veil")
-
-	// Configuration
-	targetURL := envOr("TARGET_URL", "https://api.openai.com")
-	listenAddr := envOr("LISTEN_ADDR", ":8080")
-	redisAddr := envOr("REDIS_ADDR", "localhost:6379")
-	redisPassword := envOr("REDIS_PASSWORD", "")
-	encryptionKey := envOr("VEIL_ENCRYPTION_KEY", "") // 64 hex chars = 32 bytes
-	defaultRole := envOr("VEIL_DEFAULT_ROLE", "viewer")
-	tlsCert := envOr("TLS_CERT", "")
-	tlsKey := envOr("TLS_KEY", "")
+	logger := logging.Setup(logLevel, os.Stdout, envOr("VEIL_LOG_REDACT", "true") != "false")
+	logger.Info("starting Agent Veil", "version", version.Get().String())
+
+	// Configuration: the same checks as `agentveil proxy validate`
+	settings, report := bootstrap.Load()
+	if !report.OK() {
+		for _, res := range report.Errors() {
+			logger.Error("invalid configuration", "component", res.Component, "error", res.Err)
+		}
+		os.Exit(1)
+	}
+	for _, res := range report {
+		for _, w := range res.Warnings {
+			logger.Warn("configuration warning", "component", res.Component, "warning", w)
+		}
+	}
+	targetURL := settings.TargetURL
+	listenAddr := settings.ListenAddr
+	defaultRole := settings.DefaultRole
+	tlsCert := settings.TLSCert
+	tlsKey := settings.TLSKey
 
 	// Redis client (shared between vault and auth)
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: redisPassword,
-	})
+	redisCfg := settings.Redis
+	redisClient, err := redisconn.New(redisCfg)
+	if err != nil {
+		logger.Error("failed to configure Redis client", "error", err)
+		os.Exit(1)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	redisOK := false
 	if err := redisClient.Ping(ctx).Err(); err != nil {
 		logger.Warn("Redis not available, running without persistence", "error", err)
 	} else {
-		logger.Info("Redis connected", "addr", redisAddr)
+		redisOK = true
+		logger.Info("Redis connected", "mode", redisCfg.Mode(), "tls", redisCfg.TLS || redisCfg.TLSCA != "")
 	}
 
 	// Vault
 	v := vault.NewWithClient(redisClient)
-	if encryptionKey != "" {
-		keyBytes, err := hex.DecodeString(encryptionKey)
-		if err != nil || len(keyBytes) != 32 {
-			logger.Error("VEIL_ENCRYPTION_KEY must be 64 hex chars (32 bytes)", "len", len(encryptionKey))
-			os.Exit(1)
-		}
-		enc, err := vault.NewEncryptor(keyBytes)
+	v.SetTTL(settings.VaultTTL)
+	if settings.EncryptionKey != nil {
+		enc, err := vault.NewEncryptor(settings.EncryptionKey)
 		if err != nil {
 			logger.Error("failed to create encryptor", "error", err)
 			os.Exit(1)
@@ -66,99 +110,663 @@ func main() {
 		v.SetEncryptor(enc)
 		logger.Info("vault encryption enabled (AES-256-GCM)")
 	}
+	if settings.PlaintextVault {
+		v.SetPlaintextOverride(true)
+		logger.Warn("VAULT ENCRYPTION DISABLED: PII originals are stored unencrypted on a Redis on another host; set VEIL_ENCRYPTION_KEY",
+			"override", "VEIL_ALLOW_PLAINTEXT_VAULT")
+	}
+	// Catch a wrong key or an unwritable Redis before traffic arrives
+	if redisOK {
+		if err := v.SelfTest(ctx); err != nil {
+			logger.Error("vault self-test failed", "error", err)
+			os.Exit(1)
+		}
+	}
 
-	// Detector
-	det := detector.New()
+	// Detector: in-process, or a remote detector service with in-process fallback
+	detCfg := detector.DefaultConfig()
+	detCfg.Tiers = settings.DetectorTiers
+	detCfg.Profiles = settings.DetectorProfiles
+	detCfg.Pseudonyms = settings.Pseudonyms
+	detCfg.Secrets = settings.SecretActions
+	detCfg.Policy = settings.PIIPolicy
+	det := detector.NewWithConfig(detCfg)
+	var reqDetector proxy.Detector = det
+	if settings.DetectorAddr != "" {
+		client, err := remote.NewClient(settings.DetectorAddr, det)
+		if err != nil {
+			logger.Error("invalid DETECTOR_ADDR", "error", err)
+			os.Exit(1)
+		}
+		reqDetector = client
+		logger.Info("remote detector enabled", "addr", settings.DetectorAddr)
+	}
 
-	// Auth manager
-	authMgr := auth.NewManager(redisClient)
+	// Prometheus metrics (opt-in): counters and latency only, never values
+	var registry *metrics.Registry
+	if settings.Metrics {
+		registry = metrics.NewRegistry()
+		det.SetRecorder(registry)
+		logger.Info("metrics enabled", "path", metrics.Path, "auth", settings.MetricsAuth)
+	}
 
-	// Rate limiter
-	rl := ratelimit.New(ratelimit.DefaultConfig())
-	defer rl.Close()
+	// Pattern bundle: a rejected bundle is logged and the built-ins stay
+	// active, so a bad artifact never stops the proxy
+	var patterns *bundle.Loader
+	if settings.PatternBundle != nil {
+		patterns = bundle.NewLoader(*settings.PatternBundle, det)
+		patterns.Reload(context.Background())
+	}
+
+	// Auth manager
+	var authOpts []auth.ManagerOption
+	if len(settings.AuthKeyLocations) > 0 {
+		authOpts = append(authOpts, auth.WithKeyLocations(settings.AuthKeyLocations...))
+	}
+	authMgr := auth.NewManager(redisClient, authOpts...)
 
 	// Webhook dispatcher
 	var dispatcher *webhook.Dispatcher
-	discordURL := envOr("VEIL_DISCORD_WEBHOOK_URL", "")
-	slackURL := envOr("VEIL_SLACK_WEBHOOK_URL", "")
-	if discordURL != "" || slackURL != "" {
-		whCfg := webhook.DefaultConfig()
-		if discordURL != "" {
-			whCfg.Discord = &webhook.DiscordConfig{WebhookURL: discordURL}
-			logger.Info("discord webhook enabled")
+	if settings.Webhook != nil {
+		dispatcher = webhook.NewDispatcher(*settings.Webhook)
+		logger.Info("webhooks enabled")
+	}
+
+	// Rate limiters share one backend; every throttled request, whichever
+	// limiter caught it, is reported the same way
+	var rlBackend ratelimit.Backend
+	if settings.RateLimitRedis {
+		rlBackend = ratelimit.NewRedisBackend(redisClient)
+	}
+	onRateLimit := func(rej ratelimit.Rejection) {
+		logger.Warn("rate limited", "limiter", rej.Limiter, "key", rej.Label, "retry_after", rej.RetryAfter)
+		if registry != nil {
+			registry.RateLimited(rej.Limiter)
 		}
-		if slackURL != "" {
-			whCfg.Slack = &webhook.SlackConfig{WebhookURL: slackURL}
-			logger.Info("slack webhook enabled")
+		if dispatcher != nil {
+			data := map[string]any{"limiter": rej.Limiter, "limit": rej.Limit, "retry_after": rej.RetryAfter}
+			if rej.Label != "" {
+				data["key"] = rej.Label
+			}
+			dispatcher.Emit(webhook.Event{Type: webhook.EventRateLimitHit, Data: data})
+		}
+	}
+	rlCfg := ratelimit.DefaultConfig()
+	rlCfg.RequestsPerMinute = settings.RateLimit
+	rlCfg.Exempt = settings.RateLimitExempt
+	rlCfg.Backend = rlBackend
+	rl := ratelimit.New(rlCfg)
+	rl.OnLimit(onRateLimit)
+	logger.Info("rate limit exemptions", "exempt", rlCfg.Exempt.String())
+	defer rl.Close()
+
+	// Per Veil key, after auth: the key's own limit or the default
+	keyCfg := ratelimit.KeyConfig(settings.KeyRateLimit, settings.KeyRateBurst)
+	keyCfg.Backend = rlBackend
+	keyLimit := ratelimit.New(keyCfg)
+	keyLimit.OnLimit(onRateLimit)
+
+	// Response cache (opt-in)
+	var respCache *cache.Cache
+	if settings.Cache != nil {
+		cacheCfg := *settings.Cache
+		var store cache.Store
+		if redisOK {
+			store = cache.NewRedisStore(redisClient, cacheCfg.MaxEntries)
+		} else {
+			store = cache.NewMemoryStore(cacheCfg.MaxEntries)
+		}
+		respCache = cache.New(store, cacheCfg)
+		logger.Info("response cache enabled", "redis", redisOK, "ttl", cacheCfg.TTL, "max_entries", cacheCfg.MaxEntries)
+	}
+
+	// Aggregate PII stats (opt-in): counters only, never values
+	var statsCollector *stats.Collector
+	if settings.Stats != nil {
+		statsCfg := *settings.Stats
+		var store stats.Store
+		if redisOK {
+			store = stats.NewRedisStore(redisClient)
+		} else {
+			store = stats.NewMemoryStore()
+		}
+		statsCollector = stats.New(store, statsCfg)
+		logger.Info("PII stats enabled", "redis", redisOK, "retention", statsCfg.Retention, "noise_epsilon", statsCfg.NoiseEpsilon)
+	}
+
+	// Detection feedback (opt-in): verdicts by entity ID, and with
+	// suppression, values reported as false positives left alone at scan time
+	var feedbackCollector *feedback.Collector
+	if settings.Feedback != nil {
+		if !redisOK {
+			logger.Error("VEIL_FEEDBACK requires a reachable Redis")
+			os.Exit(1)
+		}
+		fbCfg := *settings.Feedback
+		fbCfg.Redact = func(note string) string {
+			redacted, _ := det.Anonymize(note)
+			return redacted
+		}
+		feedbackCollector, err = feedback.New(redisClient, fbCfg)
+		if err != nil {
+			logger.Error("failed to configure feedback", "error", err)
+			os.Exit(1)
+		}
+		if fbCfg.SuppressAfter > 0 {
+			refreshCtx, stopRefresh := context.WithCancel(context.Background())
+			defer stopRefresh()
+			feedbackCollector.StartRefresh(refreshCtx, time.Minute)
+			det.SetSuppressor(feedbackCollector)
+			if settings.DetectorAddr != "" {
+				logger.Warn("feedback suppression applies to the in-process detector only, not to DETECTOR_ADDR")
+			}
+		}
+		logger.Info("detection feedback enabled", "suppress_after", fbCfg.SuppressAfter)
+	}
+
+	// SSE heartbeat: ": ping" comments while a stream is silent (negative disables)
+	sseHeartbeat := settings.SSEHeartbeat
+
+	// Outbound request signing (Ed25519), verified upstream with pkg/veilsig
+	signingKey := settings.SigningKey
+	if signingKey != nil {
+		logger.Info("upstream request signing enabled")
+	}
+
+	// Access log (opt-in): one JSON line per request, never bodies or PII values
+	var accessLog *accesslog.Logger
+	if settings.AccessLog != nil {
+		accessLog, err = accesslog.New(*settings.AccessLog)
+		if err != nil {
+			logger.Error("failed to open access log", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("access log enabled", "output", settings.AccessLog.Output, "fields", settings.AccessLog.Fields)
+		if stream := settings.AccessLog.RedisStream; stream != "" {
+			accessLog.StreamTo(redisClient, stream, settings.AccessLog.RedisMaxLen)
+			logger.Info("access log copied to Redis stream", "stream", stream, "redis", redisOK)
+		}
+	}
+
+	// Transcript recording (opt-in per session via X-Veil-Record-Transcript):
+	// anonymized requests and tokenized responses only, never vault originals
+	var recorder *transcript.Recorder
+	if settings.Transcripts != nil {
+		trCfg := *settings.Transcripts
+		var store transcript.Store
+		if trCfg.Output == "redis" {
+			if !redisOK {
+				logger.Error("VEIL_TRANSCRIPTS=redis requires a reachable Redis")
+				os.Exit(1)
+			}
+			store = transcript.NewRedisStore(redisClient)
+		} else {
+			store, err = transcript.NewFileStore(trCfg.Output)
+			if err != nil {
+				logger.Error("failed to open transcript store", "error", err)
+				os.Exit(1)
+			}
+		}
+		recorder = transcript.New(store, trCfg.MaxAge)
+		if trCfg.MaxAge > 0 {
+			sweepCtx, stopSweep := context.WithCancel(context.Background())
+			defer stopSweep()
+			recorder.StartSweeper(sweepCtx, time.Hour)
+		}
+		logger.Info("transcript recording enabled", "output", trCfg.Output, "max_age", trCfg.MaxAge)
+	}
+
+	// Break-glass: a time-boxed switch of the prompt guard and guardrails to
+	// log-only
+	var breakGlass *breakglass.Switch
+	if settings.BreakGlass != nil && (settings.PromptGuard != nil || settings.Guardrail != nil) {
+		breakGlass = breakglass.New(*settings.BreakGlass, accessLog, dispatcher)
+		defer breakGlass.Close()
+	}
+
+	// Prompt injection scan of requests
+	var pg *promptguard.Guard
+	if cfg := settings.PromptGuard; cfg != nil {
+		var pgOpts []promptguard.Option
+		if cfg.Sessions {
+			// Accumulate low-threat messages per session to catch gradual jailbreaks
+			pgOpts = append(pgOpts, promptguard.WithSessionTracking(promptguard.DefaultSessionConfig()))
+			if redisOK {
+				pgOpts = append(pgOpts, promptguard.WithSessionStore(promptguard.NewRedisSessionStore(redisClient)))
+			}
+		}
+		if cfg.MaxScanBytes > 0 {
+			pgOpts = append(pgOpts, promptguard.WithMaxScanBytes(cfg.MaxScanBytes))
+		}
+		if breakGlass != nil {
+			pgOpts = append(pgOpts, promptguard.WithBreakGlass(breakGlass))
+		}
+		pgOpts = append(pgOpts, promptguard.WithLang(settings.Lang))
+		if registry != nil {
+			pgOpts = append(pgOpts, promptguard.WithRecorder(registry))
+		}
+		pg = promptguard.New(pgOpts...)
+		logger.Info("prompt guard enabled", "sessions", cfg.Sessions)
+	}
+
+	// Output guardrails (opt-in): harmful content, PII and token limits on
+	// responses, blocked topics and session rate limits on requests
+	var guard *guardrail.Guardrail
+	if policy := settings.Guardrail; policy != nil {
+		guard = guardrail.New(*policy, guardrail.WithDetector(det))
+		guard.SetLang(settings.Lang)
+		guard.SetExemptions(settings.RateLimitExempt)
+		guard.SetTokenizers(settings.Tokenizers)
+		if breakGlass != nil {
+			guard.SetBreakGlass(breakGlass)
+		}
+		if registry != nil {
+			guard.SetRecorder(registry)
+		}
+		if lim := guard.RateLimiter(); lim != nil {
+			lim.OnLimit(onRateLimit)
+		}
+		logger.Info("output guardrails enabled", "max_output_tokens", policy.MaxOutputTokens,
+			"max_requests_per_min", policy.MaxRequestsPerMin, "blocked_topics", len(policy.BlockedTopics))
+	}
+
+	// Deployed posture, served at /capabilities for fleet compliance checks
+	capabilities := compliance.SystemCapabilities{
+		PIIDetection:     true,
+		PIIAnonymization: true,
+		EncryptionAtRest: settings.EncryptionKey != nil,
+		AuditLogging:     accessLog != nil,
+		AccessControl:    true,
+		RightToErasure:   true,
+		PromptGuard:      pg != nil,
+		OutputGuardrails: guard != nil,
+		SkillAuditing:    true,
+		RateLimiting:     true,
+		TLSEncryption:    tlsCert != "",
+
+		PlaintextVaultOverride: settings.PlaintextVault,
+	}
+	if settings.Router != nil && settings.Router.DataLocalization.Enabled {
+		capabilities.DataLocalization = true
+		capabilities.DataLocalizationPolicy = settings.Router.DataLocalization.Summary()
+	}
+
+	// Config shared by every proxy.Server; TargetURL is set per server
+	baseConfig := proxy.Config{
+		DefaultRole:           defaultRole,
+		SSEHeartbeat:          sseHeartbeat,
+		SigningKey:            signingKey,
+		DetectorAddr:          settings.DetectorAddr,
+		UpstreamTimeout:       settings.Upstream.Timeout,
+		ResponseHeaderTimeout: settings.Upstream.ResponseHeaderTimeout,
+		MaxIdleConnsPerHost:   settings.Upstream.MaxIdleConnsPerHost,
+		RetryUpstream:         settings.Upstream.Retry,
+		UpstreamUserAgent:     settings.Upstream.UserAgent,
+		Headers:               settings.Headers,
+		Fields:                settings.Fields,
+		BinaryMinLength:       settings.BinaryMinLength,
+		MaxFileSize:           settings.MaxFileSize,
+		CountTokens:           settings.CountTokens,
+		BlockSecrets:          settings.SecretActions.Blocks(),
+		Lang:                  settings.Lang,
+		FailureMode:           settings.FailureMode,
+		MetricsRequireKey:     settings.MetricsAuth,
+	}
+
+	// Options shared by every proxy.Server pipeline
+	pipelineOpts := []proxy.Option{proxy.WithAuth(authMgr), proxy.WithKeyRateLimit(keyLimit)}
+	if dispatcher != nil {
+		pipelineOpts = append(pipelineOpts, proxy.WithWebhook(dispatcher))
+	}
+	if respCache != nil {
+		pipelineOpts = append(pipelineOpts, proxy.WithCache(respCache))
+	}
+	if statsCollector != nil {
+		pipelineOpts = append(pipelineOpts, proxy.WithStats(statsCollector))
+	}
+	if feedbackCollector != nil {
+		pipelineOpts = append(pipelineOpts, proxy.WithFeedback(feedbackCollector))
+	}
+	if recorder != nil {
+		pipelineOpts = append(pipelineOpts, proxy.WithTranscripts(recorder))
+	}
+	if patterns != nil {
+		pipelineOpts = append(pipelineOpts, proxy.WithPatternBundle(patterns))
+	}
+	if registry != nil {
+		pipelineOpts = append(pipelineOpts, proxy.WithMetrics(registry))
+	}
+	if pg != nil {
+		pipelineOpts = append(pipelineOpts, proxy.WithPromptGuard(pg))
+	}
+	if breakGlass != nil {
+		pipelineOpts = append(pipelineOpts, proxy.WithBreakGlass(breakGlass))
+	}
+
+	// Load shedding: in-flight cap, wait queue and memory marks
+	var shed *overload.Limiter
+	if cfg := settings.Overload; cfg != nil {
+		shed = overload.New(*cfg)
+		defer shed.Close()
+		pipelineOpts = append(pipelineOpts, proxy.WithOverload(shed))
+		logger.Info("overload protection enabled", "max_in_flight", cfg.MaxInFlight, "queue", cfg.QueueSize,
+			"memory_high_water_mb", cfg.MemoryHighWater>>20)
+	}
+
+	// Human token resolution for support staff, audited per attempt
+	var resolver *proxy.Resolver
+	if settings.VaultResolveRate > 0 {
+		resolver = proxy.NewResolver(v, accessLog, settings.VaultResolveRate, rlBackend)
+		resolver.Limiter().OnLimit(onRateLimit)
+		defer resolver.Close()
+		pipelineOpts = append(pipelineOpts, proxy.WithResolver(resolver))
+		logger.Info("vault resolve endpoint enabled", "per_key_per_minute", settings.VaultResolveRate)
+	}
+
+	// Explicit session lifecycle: begin, summary and immediate purge
+	var sessions *session.Manager
+	if redisOK {
+		sessCfg := session.Config{Webhook: dispatcher}
+		if pg != nil {
+			// Ending a session also drops its canaries and threat score
+			sessCfg.Canaries, sessCfg.Purgers = pg, []session.Purger{pg}
 		}
-		dispatcher = webhook.NewDispatcher(whCfg)
-		defer dispatcher.Close()
+		sessions = session.New(redisClient, v, sessCfg)
+		pipelineOpts = append(pipelineOpts, proxy.WithSessions(sessions))
+	}
+
+	// Rehydrate only for the Veil key (or client IP) that created a session
+	binding := proxy.SessionBinding{Disabled: !settings.SessionBinding, Audit: accessLog, Webhook: dispatcher}
+	pipelineOpts = append(pipelineOpts, proxy.WithSessionBinding(binding))
+	if binding.Disabled {
+		logger.Warn("session binding disabled: any caller that knows a session ID can have its tokens rehydrated")
+	}
+
+	// Startup probe (opt-in): /readyz waits for providers, and for Redis when
+	// the closed failure mode makes the vault required
+	var readyChecks []readiness.Check
+	if settings.FailureMode == failsafe.Closed {
+		readyChecks = append(readyChecks, readiness.Check{
+			Name: "vault", Kind: readiness.KindRedis, Required: true,
+			Probe: func(ctx context.Context) error { return redisClient.Ping(ctx).Err() },
+		})
+	}
+	var gate *readiness.Gate
+
+	// Admin listener (opt-in): the admin API, MCP and pprof move off the
+	// main listener, which then answers 404 under /admin/
+	var adminMux *http.ServeMux
+	var adminGuard proxy.Guard
+	if settings.Admin != nil {
+		adminMux = http.NewServeMux()
+		adminGuard = settings.Admin.Guard(authMgr)
+		mcpServer := mcp.NewServer(mcp.Config{ProxyURL: localURL(listenAddr, tlsCert != "")})
+		settings.Admin.HandleExtras(adminMux, adminGuard, mcpServer.Handler())
 	}
 
 	// Build handler: router mode or single-target mode
-	routerConfig := envOr("VEIL_ROUTER_CONFIG", "")
+	routerConfig := settings.RouterConfigPath
 
 	var handler http.Handler
+	var rt *router.Router
 
 	if routerConfig != "" {
 		// Multi-provider router mode
-		cfg, err := router.LoadConfig(routerConfig)
+		var err error
+		rt, err = router.New(settings.Router)
 		if err != nil {
-			logger.Error("failed to load router config", "path", routerConfig, "error", err)
+			logger.Error("failed to create router", "error", err)
 			os.Exit(1)
 		}
 
-		rt, err := router.New(cfg)
-		if err != nil {
-			logger.Error("failed to create router", "error", err)
-			os.Exit(1)
+		if settings.StartupProbe != nil {
+			gate = readiness.New(*settings.StartupProbe, append(rt.ReadinessChecks(), readyChecks...))
 		}
 
 		// Wire PII anonymization into the router
-		rt.SetRequestModifier(proxy.AnonymizeRequest(det, v, dispatcher))
-		rt.SetResponseModifier(proxy.RehydrateResponse(v, defaultRole))
+		rt.SetRequestModifier(proxy.AnonymizeRequest(reqDetector, v, settings.CountTokens, settings.Fields, dispatcher))
+		rt.SetResponseModifier(proxy.RehydrateResponse(v, defaultRole, sseHeartbeat, binding))
+		rt.SetSigningKey(signingKey)
+		rt.SetTokenizers(settings.Tokenizers)
+		if registry != nil {
+			rt.SetRecorder(registry)
+		}
+		// Set whether or not the policy is enabled, so a reload can enable it
+		rt.SetCategoryDetector(proxy.DetectCategories(reqDetector))
+		rt.SetAuditLog(accessLog)
+		if settings.Router.DataLocalization.Enabled {
+			logger.Info("data localization enforced", "policy", settings.Router.DataLocalization.Summary())
+		}
+		if ua := settings.Upstream.UserAgent; ua != "" {
+			rt.WrapTransport(func(next http.RoundTripper) http.RoundTripper { return upstream.WithUserAgent(next, ua) })
+		}
+		if respCache != nil {
+			rt.WrapTransport(respCache.Wrap)
+		}
+		// Outermost, so a refused request isn't answered from the cache either
+		failures := failsafe.New(settings.FailureMode, dispatcher)
+		rt.WrapTransport(failsafe.Transport)
+
+		// Local runtimes (ollama/lmstudio with auto_discover): check
+		// reachability and models now and periodically; never fatal
+		if rt.HasDiscovery() {
+			discoverCtx, stopDiscovery := context.WithCancel(context.Background())
+			defer stopDiscovery()
+			rt.StartDiscovery(discoverCtx, rt.DiscoverInterval())
+		}
 
 		// Build mux with utility endpoints + router as catch-all
 		mux := http.NewServeMux()
-		healthHandler := func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(`{"status":"ok"}`))
-		}
+		healthHandler := proxy.HealthHandler(v, patterns, breakGlass)
 		mux.HandleFunc("/health", healthHandler)
 		mux.HandleFunc("/healthz", healthHandler)
+		mux.Handle("GET /readyz", gate.Handler())
+		mux.Handle("GET /version", proxy.VersionHandler())
+		mux.Handle("GET "+compliance.CapabilitiesPath, compliance.CapabilitiesHandler(capabilities))
+		mux.Handle("GET "+proxy.OpenAPIPath, proxy.OpenAPIHandler())
+		if registry != nil {
+			var metricsHandler http.Handler = registry.Handler()
+			if settings.MetricsAuth {
+				metricsHandler = authMgr.RequireRole(auth.RoleAdmin, auth.RoleOperator, auth.RoleViewer, auth.RoleAuditor)(metricsHandler)
+			}
+			mux.Handle("GET "+metrics.Path, metricsHandler)
+		}
 
 		// Expose /scan and /audit without auth (same as single-target mode)
-		mux.HandleFunc("/scan", proxy.HandleScan(det))
-		mux.HandleFunc("/audit", proxy.HandleAudit())
+		mux.HandleFunc("/scan", proxy.HandleScan(reqDetector))
+		mux.HandleFunc("/audit", proxy.HandleAudit(settings.Lang))
+		mux.HandleFunc("GET /audit/rules", proxy.HandleAuditRules(settings.Lang))
+		mux.HandleFunc("POST /audit/test", proxy.HandleAuditTest())
+		mux.HandleFunc("POST /audit/project", proxy.HandleAuditProject(settings.Lang))
+		mux.Handle("GET /auth/whoami", authMgr.WhoAmIHandler())
+		if feedbackCollector != nil {
+			mux.Handle("POST /feedback/detection", authMgr.Middleware(feedbackCollector.Handler()))
+		}
 
-		// Chain: auth → role → router
+		// Admin endpoints, on the admin listener when there is one
+		if adminMux == nil {
+			adminMux, adminGuard = mux, proxy.RoleGuard(authMgr)
+		}
+		if respCache != nil {
+			adminMux.Handle("/cache/stats", adminGuard()(respCache.StatsHandler()))
+		}
+		admin := adminGuard(auth.RoleAdmin)
+		if dispatcher != nil {
+			adminMux.Handle("/admin/webhooks/test", admin(dispatcher.TestHandler()))
+		}
+		adminMux.Handle("/admin/providers", admin(rt.ProvidersHandler()))
+		if statsCollector != nil {
+			adminMux.Handle("GET /admin/stats/pii", admin(statsCollector.Handler()))
+		}
+		if feedbackCollector != nil {
+			adminMux.Handle("GET /admin/feedback/summary", admin(feedbackCollector.SummaryHandler()))
+		}
+		if recorder != nil {
+			adminMux.Handle("GET /admin/transcripts", admin(recorder.ExportHandler()))
+			adminMux.Handle("GET /admin/transcripts/{session}", admin(recorder.SessionHandler()))
+		}
+		if resolver != nil {
+			adminMux.Handle("POST /admin/vault/resolve", adminGuard(auth.RoleAdmin, auth.RoleAuditor)(resolver.Handler()))
+		}
+		adminMux.Handle("GET /admin/status", admin(proxy.StatusHandler(shed, breakGlass, failures)))
+		if breakGlass != nil {
+			adminMux.Handle("POST /admin/breakglass", admin(breakGlass.Handler()))
+		}
+		adminMux.Handle("GET /admin/readiness", admin(gate.StatusHandler()))
+		if patterns != nil {
+			adminMux.Handle("POST /admin/patterns/reload", admin(patterns.ReloadHandler()))
+		}
+		if sessions != nil {
+			proxy.HandleSessions(mux, sessions, authMgr)
+		}
+		if rt.HasDiscovery() {
+			// Aggregate models across providers instead of proxying to one
+			mux.Handle("GET /v1/models", authMgr.Middleware(rt.ModelsHandler()))
+		}
+
+		// Chain: auth → key rate limit → [sessions →] [transcripts →] [stats →] failsafe → annotations → [promptGuard →] [secrets →] role → router
 		var routerHandler http.Handler = rt
 		routerHandler = proxy.RoleMiddleware(defaultRole)(routerHandler)
+		if baseConfig.BlockSecrets {
+			routerHandler = proxy.BlockSecrets(reqDetector, dispatcher, settings.BinaryMinLength, "router")(routerHandler)
+		}
+		if pg != nil {
+			routerHandler = promptguard.Middleware(pg)(routerHandler)
+		}
+		routerHandler = annotate.Middleware(routerHandler)
+		routerHandler = failures.Middleware(routerHandler)
+		if statsCollector != nil {
+			routerHandler = statsCollector.Middleware(routerHandler)
+		}
+		if recorder != nil {
+			routerHandler = recorder.Middleware(routerHandler)
+		}
+		if sessions != nil {
+			routerHandler = sessions.Middleware(routerHandler)
+		}
+		routerHandler = keyLimit.Middleware(routerHandler)
 		if authMgr != nil {
 			routerHandler = authMgr.Middleware(routerHandler)
 		}
+		if guard != nil {
+			routerHandler = guardrail.InputMiddleware(guard)(guardrail.ResponseMiddleware(guard)(routerHandler))
+		}
 		mux.Handle("/", routerHandler)
 
 		handler = rl.Middleware(mux)
 
 		logger.Info("router mode enabled", "config", routerConfig, "providers", rt.GetProviders())
+
+		// SIGHUP re-reads the router config; requests in flight finish on
+		// the providers they started with
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				reloadRouter(logger, rt, settings, routerConfig)
+			}
+		}()
 	} else {
 		// Single-target proxy mode (original behavior)
-		opts := []proxy.Option{proxy.WithAuth(authMgr)}
-		if dispatcher != nil {
-			opts = append(opts, proxy.WithWebhook(dispatcher))
+		proxyCfg := baseConfig
+		proxyCfg.TargetURL = targetURL
+		proxyCfg.GeminiTargetURL = settings.GeminiTargetURL
+		if settings.StartupProbe != nil {
+			upstreamCheck := readiness.Check{
+				Name: "upstream", Kind: readiness.KindProvider,
+				Probe: readiness.HTTP(&http.Client{Transport: upstream.NewTransport(settings.Upstream)}, targetURL),
+			}
+			gate = readiness.New(*settings.StartupProbe, append([]readiness.Check{upstreamCheck}, readyChecks...))
 		}
 		srv, err := proxy.New(
-			proxy.Config{TargetURL: targetURL, DefaultRole: defaultRole},
+			proxyCfg,
 			det, v,
-			opts...,
+			append(pipelineOpts, proxy.WithCapabilities(capabilities), proxy.WithReadiness(gate))...,
 		)
 		if err != nil {
 			logger.Error("failed to create proxy", "error", err)
 			os.Exit(1)
 		}
 
-		handler = rl.Middleware(srv.Handler())
+		if adminMux != nil {
+			handler = srv.PublicHandler()
+			srv.HandleAdmin(adminMux, adminGuard)
+		} else {
+			handler = srv.Handler()
+		}
+		if guard != nil {
+			handler = guardrail.InputMiddleware(guard)(guardrail.ResponseMiddleware(guard)(handler))
+		}
+		handler = rl.Middleware(handler)
+		logger.Info("upstream transport", "target", targetURL, "settings", proxyCfg.Upstream().String())
+		if proxyCfg.GeminiTargetURL != "" {
+			logger.Info("gemini route enabled", "prefix", proxy.GeminiPrefix, "target", proxyCfg.GeminiTargetURL)
+		}
+	}
+
+	// Access log wraps everything so rate-limited and rejected requests are logged too
+	if accessLog != nil {
+		handler = accessLog.Middleware(handler)
+	}
+	// Outermost: a shed request should cost as little as possible
+	if shed != nil {
+		handler = shed.Middleware(handler)
+	}
+	// Counted even when shed
+	if registry != nil {
+		handler = registry.Middleware(handler)
+	}
+
+	// HTTPS forward proxy (opt-in) for tools that only honor HTTPS_PROXY:
+	// allowlisted LLM hosts are intercepted with the local CA and run through
+	// the same pipeline, everything else is tunneled
+	var forwardServer *http.Server
+	var forwardProxy *mitm.Server
+	if cfg := settings.MITM; cfg != nil {
+		ca, err := mitm.LoadCA(cfg.CACert, cfg.CAKey)
+		if err != nil {
+			logger.Error("failed to load forward proxy CA", "error", err)
+			os.Exit(1)
+		}
+		handlers := make(map[string]http.Handler, len(cfg.Hosts))
+		for _, host := range cfg.Hosts {
+			hostCfg := baseConfig
+			hostCfg.TargetURL = "https://" + host
+			srv, err := proxy.New(
+				hostCfg,
+				det, v,
+				pipelineOpts...,
+			)
+			if err != nil {
+				logger.Error("failed to create forward proxy pipeline", "host", host, "error", err)
+				os.Exit(1)
+			}
+			h := srv.Pipeline()
+			if guard != nil {
+				h = guardrail.InputMiddleware(guard)(guardrail.ResponseMiddleware(guard)(h))
+			}
+			h = rl.Middleware(h)
+			if accessLog != nil {
+				h = accessLog.Middleware(h)
+			}
+			if shed != nil {
+				h = shed.Middleware(h)
+			}
+			handlers[host] = h
+		}
+		forwardProxy = mitm.New(ca, handlers)
+		forwardServer = &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           forwardProxy,
+			ReadHeaderTimeout: 30 * time.Second,
+		}
+		go func() {
+			logger.Info("forward proxy listening", "addr", cfg.Addr, "intercept", cfg.Hosts)
+			if err := forwardServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("forward proxy error", "error", err)
+				os.Exit(1)
+			}
+		}()
 	}
 
 	// HTTP server
@@ -170,6 +778,35 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	var adminServer *http.Server
+	if cfg := settings.Admin; cfg != nil {
+		tlsCfg, err := cfg.TLSConfig()
+		if err != nil {
+			logger.Error("failed to configure admin listener", "error", err)
+			os.Exit(1)
+		}
+		adminServer = &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           adminMux,
+			TLSConfig:         tlsCfg,
+			ReadHeaderTimeout: 30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+		}
+		go func() {
+			logger.Info("admin listening", "addr", cfg.Addr, "tls", tlsCfg != nil, "mtls", cfg.ClientCA != "", "pprof", cfg.Pprof)
+			var err error
+			if tlsCfg != nil {
+				err = adminServer.ListenAndServeTLS("", "")
+			} else {
+				err = adminServer.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				logger.Error("admin server error", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
@@ -194,15 +831,49 @@ func main() {
 		}
 	}()
 
+	// Probe in the background so /healthz answers while /readyz waits
+	if gate != nil {
+		logger.Info("startup probe running", "checks", len(gate.Status().Checks), "timeout", settings.StartupProbe.Timeout)
+		go gate.Run(context.Background())
+	}
+
 	<-done
 	logger.Info("shutting down...")
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 
+	// Let provider streams finish while new requests get 503, then close
+	// the listeners
+	if rt != nil {
+		if err := rt.Shutdown(shutdownCtx); err != nil {
+			logger.Error("router drain incomplete", "error", err)
+		}
+		rt.Close()
+	}
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		logger.Error("shutdown error", "error", err)
 	}
+	// The admin API stays up until proxy traffic has drained
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("admin shutdown error", "error", err)
+		}
+	}
+	if forwardServer != nil {
+		forwardServer.Shutdown(shutdownCtx)
+		forwardProxy.Close()
+	}
+	// Events emitted by the last requests still go out, within the deadline
+	if dispatcher != nil {
+		if err := dispatcher.Shutdown(shutdownCtx); err != nil {
+			logger.Error("webhook drain incomplete", "error", err)
+		}
+	}
+	// Before Redis, so the lines of the last requests reach the stream
+	if accessLog != nil {
+		accessLog.Close()
+	}
 	if err := redisClient.Close(); err != nil {
 		logger.Error("redis close error", "error", err)
 	}
@@ -210,6 +881,39 @@ func main() {
 	logger.Info("stopped")
 }
 
+// reloadRouter loads the router config at path into rt and logs what
+// changed. A config that fails to load leaves rt as it was.
+func reloadRouter(logger *slog.Logger, rt *router.Router, settings *bootstrap.Settings, path string) {
+	cfg, err := settings.LoadRouter(path)
+	if err == nil {
+		var changes []string
+		if changes, err = rt.Reload(cfg); err == nil {
+			for _, change := range changes {
+				logger.Info("router config reloaded", "change", change)
+			}
+			if len(changes) == 0 {
+				logger.Info("router config reloaded, nothing changed", "config", path)
+			}
+			return
+		}
+	}
+	logger.Error("router config reload failed, keeping the current providers", "config", path, "error", err)
+}
+
+// localURL is the URL the admin listener's MCP server reaches the main
+// listener at
+func localURL(addr string, tls bool) string {
+	host, port, _ := net.SplitHostPort(addr)
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
 func envOr(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
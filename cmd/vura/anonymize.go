@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// mappingEntry is one token in the file written by --mapping
+type mappingEntry struct {
+	Token    string       `json:"token"`
+	Category pii.Category `json:"category"`
+	File     string       `json:"file"`
+	Original string       `json:"original,omitempty"`
+}
+
+// anonymizeOptions are the flags of scan --anonymize
+type anonymizeOptions struct {
+	anonymize        bool
+	inPlace          bool
+	backup           bool
+	mappingPath      string
+	includeOriginals bool
+	yes              bool
+}
+
+// anonymizeFlags registers the flags of scan --anonymize on fs
+func anonymizeFlags(fs *flag.FlagSet) *anonymizeOptions {
+	o := &anonymizeOptions{}
+	fs.BoolVar(&o.anonymize, "anonymize", false, "Anonymize the input files instead of reporting matches")
+	fs.BoolVar(&o.inPlace, "in-place", false, "With --anonymize, rewrite files in place instead of printing to stdout")
+	fs.BoolVar(&o.backup, "backup", false, "With --in-place, keep the original as <file>.bak")
+	fs.StringVar(&o.mappingPath, "mapping", "", "With --anonymize, write the token -> category mapping to this JSON file")
+	fs.BoolVar(&o.includeOriginals, "include-originals", false, "Include original values in the mapping file (requires confirmation)")
+	fs.BoolVar(&o.yes, "yes", false, "Confirm --include-originals without prompting")
+	return o
+}
+
+// scanAnonymize rewrites files with PII tokenized, secrets masked and
+// credit cards redacted, exactly as the proxy would send them upstream
+func scanAnonymize(files []string, o *anonymizeOptions) error {
+	if o.backup && !o.inPlace {
+		return fmt.Errorf("--backup requires --in-place")
+	}
+	if o.includeOriginals && o.mappingPath == "" {
+		return fmt.Errorf("--include-originals requires --mapping")
+	}
+	for _, f := range files {
+		if f == "-" && o.inPlace {
+			return fmt.Errorf("cannot use --in-place with stdin")
+		}
+	}
+	if o.includeOriginals && !o.yes && !confirmIncludeOriginals(files) {
+		fmt.Fprintln(os.Stderr, "Aborted: original values will not be written.")
+		exit(1)
+	}
+
+	cfg := detector.DefaultConfig()
+	cfg.Policy = map[pii.Category]detector.Action{
+		pii.CatCreditCard: detector.ActionRedact,
+	}
+	det := detector.NewWithConfig(cfg)
+
+	var entries []mappingEntry
+	seen := make(map[string]bool)
+	failed := false
+
+	for _, name := range files {
+		data, err := readInput(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		if isBinary(data) {
+			fmt.Fprintf(os.Stderr, "Warning: skipping binary file %s\n", name)
+			continue
+		}
+
+		anonymized, applied := det.AnonymizeMatches(string(data))
+
+		for _, m := range applied {
+			if cfg.ActionFor(m.Category) == detector.ActionRedact || seen[m.Token] {
+				continue
+			}
+			seen[m.Token] = true
+			entry := mappingEntry{Token: m.Token, Category: m.Category, File: name}
+			if o.includeOriginals {
+				entry.Original = m.Original
+			}
+			entries = append(entries, entry)
+		}
+
+		if !o.inPlace {
+			fmt.Print(anonymized)
+			continue
+		}
+
+		stat, err := os.Stat(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed = true
+			continue
+		}
+		if o.backup {
+			if err := os.WriteFile(name+".bak", data, stat.Mode().Perm()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing backup for %s: %v\n", name, err)
+				failed = true
+				continue
+			}
+		}
+		if err := os.WriteFile(name, []byte(anonymized), stat.Mode().Perm()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		info("Anonymized %s (%d entities)\n", name, len(applied))
+	}
+
+	if o.mappingPath != "" {
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].File != entries[j].File {
+				return entries[i].File < entries[j].File
+			}
+			return entries[i].Token < entries[j].Token
+		})
+		if entries == nil {
+			entries = []mappingEntry{}
+		}
+		data, _ := json.MarshalIndent(entries, "", "  ")
+		// Mapping may hold originals, keep it private to the user
+		if err := os.WriteFile(o.mappingPath, append(data, '\n'), 0600); err != nil {
+			return fmt.Errorf("writing mapping: %w", err)
+		}
+	}
+
+	if failed {
+		exit(1)
+	}
+	return nil
+}
+
+func readInput(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// isBinary reports whether data looks like a binary file: a NUL byte or
+// invalid UTF-8 within the first 8KB
+func isBinary(data []byte) bool {
+	head := data
+	if len(head) > 8192 {
+		head = head[:8192]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+	if utf8.Valid(head) {
+		return false
+	}
+	// The 8KB cut may split a multi-byte rune; tolerate that at the tail
+	if len(head) < len(data) {
+		for i := 1; i < utf8.UTFMax && i < len(head); i++ {
+			if utf8.Valid(head[:len(head)-i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// confirmIncludeOriginals asks the user on the terminal before writing raw
+// PII to disk. Reading stdin is not possible when it carries the input.
+func confirmIncludeOriginals(files []string) bool {
+	for _, f := range files {
+		if f == "-" {
+			fmt.Fprintln(os.Stderr, "Error: --include-originals with stdin input requires --yes")
+			return false
+		}
+	}
+	fmt.Fprintln(os.Stderr, "WARNING: the mapping file will contain the original PII and secrets in plaintext.")
+	fmt.Fprint(os.Stderr, "Type 'yes' to continue: ")
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(strings.ToLower(line)) == "yes"
+}
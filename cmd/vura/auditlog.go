@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+)
+
+// tailChunk is how much of the log tail reads at a time, from the end
+const tailChunk = 64 << 10
+
+// auditLogTailCmd prints the last entries of the proxy's access log
+func auditLogTailCmd(fs *flag.FlagSet) func([]string) error {
+	limit := fs.Int("limit", 20, "entries to show")
+	return func(args []string) error {
+		if len(args) > 1 || *limit <= 0 {
+			return errUsage
+		}
+		path := os.Getenv("VEIL_ACCESS_LOG")
+		if len(args) == 1 {
+			path = args[0]
+		}
+		if path == "" || path == "stdout" {
+			return errors.New("no access log file: pass its path or set VEIL_ACCESS_LOG")
+		}
+		lines, err := lastLines(path, *limit)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+			return nil
+		}
+		printAuditLog(os.Stdout, lines)
+		return nil
+	}
+}
+
+// lastLines returns the last n non-empty lines of the file at path,
+// reading it backwards so a large log isn't read whole
+func lastLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var tail []byte
+	for off := info.Size(); off > 0 && bytes.Count(tail, []byte("\n")) <= n; {
+		size := min(int64(tailChunk), off)
+		off -= size
+		chunk := make([]byte, size)
+		if _, err := f.ReadAt(chunk, off); err != nil && err != io.EOF {
+			return nil, err
+		}
+		tail = append(chunk, tail...)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(tail), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// auditLogLine is an access log line: a request entry or an audit event
+type auditLogLine struct {
+	accesslog.Entry
+	Event   string `json:"event"`
+	Token   string `json:"token"`
+	Reason  string `json:"reason"`
+	Outcome string `json:"outcome"`
+}
+
+// printAuditLog prints one row per line: time, status or event, request,
+// duration, provider and the decisions recorded for it. Lines that aren't
+// JSON are printed as they are under DETAILS.
+func printAuditLog(out io.Writer, lines []string) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSTATUS\tREQUEST\tDURATION\tPROVIDER\tDETAILS")
+	for _, line := range lines {
+		var e auditLogLine
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			fmt.Fprintf(tw, "\t\t\t\t\t%s\n", line)
+			continue
+		}
+		when := e.Time.Local().Format(time.DateTime)
+		if e.Event != "" {
+			details := fields(
+				"key", e.KeyID, "role", e.Role, "session", e.SessionID,
+				"token", e.Token, "reason", e.Reason,
+			)
+			fmt.Fprintf(tw, "%s\t%s\t%s\t\t\t%s\n", when, e.Outcome, e.Event, details)
+			continue
+		}
+		details := fields(
+			"session", e.SessionID, "key", e.KeyID, "role", e.Role,
+			"entities", entityCounts(e.Entities), "threat", e.ThreatLevel,
+			"guardrail", e.Guardrail, "violations", strings.Join(e.Violations, ","),
+		)
+		fmt.Fprintf(tw, "%s\t%d\t%s %s\t%.0fms\t%s\t%s\n",
+			when, e.Status, e.Method, e.Path, e.DurationMs, e.Provider, details)
+	}
+	tw.Flush()
+}
+
+// fields formats the non-empty values of key, value pairs as key=value,
+// quoting values with spaces
+func fields(kv ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		switch v := kv[i+1]; {
+		case v == "":
+		case strings.ContainsAny(v, " \t"):
+			parts = append(parts, kv[i]+"="+strconv.Quote(v))
+		default:
+			parts = append(parts, kv[i]+"="+v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// entityCounts formats entity counts as EMAIL:2,PHONE:1
+func entityCounts(m map[string]int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s:%d", k, m[k])
+	}
+	return strings.Join(parts, ",")
+}
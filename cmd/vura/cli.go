@@ -0,0 +1,571 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/vurakit/agentveil/internal/version"
+)
+
+// A command is one agentveil subcommand. define registers the command's
+// flags on fs and returns the function that runs it with the positional
+// arguments; parsing, help text and shell completions all come from those
+// same definitions.
+type command struct {
+	name     string // e.g. "audit diff"
+	args     string // synopsis of the positional arguments, e.g. "<old.md> <new.md>"
+	summary  string
+	examples [][2]string // command line, description
+	choices  []string    // the values of a fixed positional argument, for completions
+	// bare makes the command run for its group alone, as "config" runs
+	// "config show"
+	bare bool
+	// passthrough stops parsing flags at the first positional argument, so
+	// wrap leaves the wrapped command's flags alone
+	passthrough bool
+	define      func(fs *flag.FlagSet) func(args []string) error
+}
+
+// errUsage makes run print the command's usage and exit 1
+var errUsage = errors.New("usage")
+
+// exitCode ends a command early with a process exit code; run recovers it
+type exitCode int
+
+// exit stops the running command with code. Commands call it instead of
+// os.Exit so deferred cleanup runs and tests can drive them through run.
+// Goroutines other than the command's own still use os.Exit.
+func exit(code int) {
+	panic(exitCode(code))
+}
+
+// globalOptions holds the flags every command accepts
+type globalOptions struct {
+	config   string
+	proxyURL string
+	json     bool
+	quiet    bool
+
+	// sources records where each flag of the running command got its
+	// value: "flag", "env", "config" or "default"
+	sources map[string]string
+}
+
+// opts are the global options of the running command
+var opts = globalOptions{proxyURL: defaultProxy}
+
+// flagEnv binds flags to the environment variables that set them when they
+// are not given on the command line
+var flagEnv = map[string]string{
+	"proxy-url":     "VEIL_PROXY_URL",
+	"secret-action": "VEIL_SECRET_ACTION",
+	"api-key":       "VEIL_API_KEY",
+	"lang":          "VEIL_LANG",
+}
+
+// globalFlags registers the global flags on fs, except those the command
+// defines itself, and returns their names
+func globalFlags(fs *flag.FlagSet, g *globalOptions) []string {
+	defs := []struct {
+		name string
+		def  func()
+	}{
+		{"config", func() {
+			fs.StringVar(&g.config, "config", "", "CLI config `file` (default ./agentveil.yaml, then ~/.agentveil/config.yaml)")
+		}},
+		{"proxy-url", func() { fs.StringVar(&g.proxyURL, "proxy-url", defaultProxy, "Agent Veil proxy `url`") }},
+		{"json", func() { fs.BoolVar(&g.json, "json", false, "Print JSON instead of text where the command supports it") }},
+		{"quiet", func() { fs.BoolVar(&g.quiet, "quiet", false, "Suppress informational messages") }},
+	}
+	var names []string
+	for _, d := range defs {
+		if fs.Lookup(d.name) == nil {
+			d.def()
+			names = append(names, d.name)
+		}
+	}
+	return names
+}
+
+// flagSet builds the command's flag set: its own flags, then the global
+// flags it does not shadow
+func (c *command) flagSet() (fs *flag.FlagSet, run func([]string) error, g *globalOptions, globals []string) {
+	fs = flag.NewFlagSet("agentveil "+c.name, flag.ContinueOnError)
+	run = c.define(fs)
+	g = &globalOptions{}
+	globals = globalFlags(fs, g)
+	fs.Usage = func() { c.usage(os.Stderr, fs, globals) }
+	return fs, run, g, globals
+}
+
+// run parses args and runs the command, returning its exit code
+func (c *command) run(args []string) int {
+	fs, runFn, g, _ := c.flagSet()
+	positional, err := c.parse(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if c.args == "" && len(positional) > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected argument %q\n", positional[0])
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := loadCLIConfig(g.config)
+	if err == nil {
+		g.sources, err = resolveFlags(fs, c.name, cfg)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	g.proxyURL = strings.TrimSuffix(g.proxyURL, "/")
+	opts = *g
+
+	switch err := runFn(positional); {
+	case errors.Is(err, errUsage):
+		fs.Usage()
+		return 1
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parse parses flags before, between and after positional arguments, or
+// only before the first one for passthrough commands. Everything after
+// "--" is positional.
+func (c *command) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	if c.passthrough {
+		err := fs.Parse(args)
+		return fs.Args(), err
+	}
+	return parseInterspersed(fs, args)
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments and returns the positionals in order
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// resolveFlags fills the flags not given on the command line from their
+// environment variable, then from the command's section of the config
+// file, and reports where every flag's value came from
+func resolveFlags(fs *flag.FlagSet, name string, cfg *cliConfig) (map[string]string, error) {
+	sources := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) { sources[f.Name] = "flag" })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if sources[f.Name] != "" || err != nil {
+			return
+		}
+		if env := flagEnv[f.Name]; env != "" && os.Getenv(env) != "" {
+			if err = fs.Set(f.Name, os.Getenv(env)); err != nil {
+				err = fmt.Errorf("%s: %w", env, err)
+			}
+			sources[f.Name] = "env"
+			return
+		}
+		if v, ok, verr := cfg.lookup(name, f.Name); verr != nil || ok {
+			if err = verr; err == nil {
+				err = fs.Set(f.Name, v)
+			}
+			if err != nil {
+				err = fmt.Errorf("%s: %s: %w", cfg.path, f.Name, err)
+			}
+			sources[f.Name] = "config"
+			return
+		}
+		sources[f.Name] = "default"
+	})
+	if err == nil {
+		cfg.warnUnknown(name, fs)
+	}
+	return sources, err
+}
+
+// precedence ranks the sources of a flag value
+var precedence = map[string]int{"default": 0, "config": 1, "env": 2, "flag": 3}
+
+// outputFormat returns format, or "json" when --json was given with at
+// least the precedence of --format
+func outputFormat(format string) string {
+	if opts.json && precedence[opts.sources["json"]] >= precedence[opts.sources["format"]] {
+		return "json"
+	}
+	return format
+}
+
+// info prints an informational message to stderr unless --quiet is set
+func info(format string, a ...any) {
+	if !opts.quiet {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
+// ─── Config file ──────────────────────────────────────────────────
+
+// cliConfig is the CLI config file. Global flags go at the top level and
+// every command has a section of flag values, keyed by its name:
+//
+//	proxy-url: https://veil.internal.corp:8443
+//	scan:
+//	  sensitivity: high
+//	audit diff:
+//	  fail-on: critical
+type cliConfig struct {
+	path   string
+	values map[string]any
+}
+
+// loadCLIConfig reads the config file at path, or the first of
+// ./agentveil.yaml and ~/.agentveil/config.yaml that exists when path is
+// empty. No file at a default location is an empty config.
+func loadCLIConfig(path string) (*cliConfig, error) {
+	cfg := &cliConfig{path: path}
+	if path == "" {
+		candidates := []string{"agentveil.yaml"}
+		if home, err := os.UserHomeDir(); err == nil {
+			candidates = append(candidates, filepath.Join(home, ".agentveil", "config.yaml"))
+		}
+		for _, c := range candidates {
+			if _, err := os.Stat(c); err == nil {
+				cfg.path = c
+				break
+			}
+		}
+		if cfg.path == "" {
+			return cfg, nil
+		}
+	}
+	data, err := os.ReadFile(cfg.path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg.values); err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.path, err)
+	}
+	return cfg, nil
+}
+
+// lookup returns the config value of flag for the command name: from the
+// command's section, or the top level for global flags
+func (c *cliConfig) lookup(name, flagName string) (string, bool, error) {
+	v, ok := c.section(name)[flagName]
+	if !ok && isGlobalFlag(flagName) {
+		v, ok = c.values[flagName]
+	}
+	if !ok {
+		return "", false, nil
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", false, nil
+	case map[string]any:
+		return "", false, fmt.Errorf("expected a value, got a section")
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ","), true, nil
+	default:
+		return fmt.Sprint(v), true, nil
+	}
+}
+
+func (c *cliConfig) section(name string) map[string]any {
+	s, _ := c.values[name].(map[string]any)
+	return s
+}
+
+// warnUnknown warns about top-level keys that are neither a global flag nor
+// a command, and about keys of the command's section it has no flag for
+func (c *cliConfig) warnUnknown(name string, fs *flag.FlagSet) {
+	var unknown []string
+	for key := range c.values {
+		if !isGlobalFlag(key) && findCommand(key) == nil {
+			unknown = append(unknown, key)
+		}
+	}
+	for key := range c.section(name) {
+		if fs.Lookup(key) == nil {
+			unknown = append(unknown, name+"."+key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		fmt.Fprintf(os.Stderr, "Warning: %s: unknown key %q\n", c.path, key)
+	}
+}
+
+func isGlobalFlag(name string) bool {
+	switch name {
+	case "config", "proxy-url", "json", "quiet":
+		return true
+	}
+	return false
+}
+
+// ─── Dispatch ─────────────────────────────────────────────────────
+
+// run runs the agentveil command line args, without the program name, and
+// returns the process exit code
+func run(args []string) (code int) {
+	defer func() {
+		if r := recover(); r != nil {
+			c, ok := r.(exitCode)
+			if !ok {
+				panic(r)
+			}
+			code = int(c)
+		}
+	}()
+	defer func() { opts = globalOptions{proxyURL: defaultProxy} }()
+
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return 0
+	}
+	switch args[0] {
+	case "--version", "-v":
+		args[0] = "version"
+	case "--help", "-h":
+		args[0] = "help"
+	}
+
+	if c, rest := lookupCommand(args); c != nil {
+		return c.run(rest)
+	}
+	if subs := subcommands(args[0]); len(subs) > 0 {
+		if len(args) > 1 {
+			fmt.Fprintf(os.Stderr, "Unknown command: %s %s\n\n", args[0], args[1])
+			printGroupUsage(os.Stderr, args[0], subs)
+			return 1
+		}
+		printGroupUsage(os.Stdout, args[0], subs)
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
+	printUsage(os.Stderr)
+	return 1
+}
+
+// lookupCommand finds the command args name and returns it with the
+// remaining arguments
+func lookupCommand(args []string) (*command, []string) {
+	if len(args) > 1 {
+		if c := findCommand(args[0] + " " + args[1]); c != nil {
+			return c, args[2:]
+		}
+	}
+	if c := findCommand(args[0]); c != nil {
+		return c, args[1:]
+	}
+	if len(args) == 1 || strings.HasPrefix(args[1], "-") {
+		for _, c := range subcommands(args[0]) {
+			if c.bare {
+				return c, args[1:]
+			}
+		}
+	}
+	return nil, nil
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// subcommands returns the commands of the group name, such as "proxy start"
+// for "proxy"
+func subcommands(name string) []*command {
+	var subs []*command
+	for _, c := range commands {
+		if strings.HasPrefix(c.name, name+" ") {
+			subs = append(subs, c)
+		}
+	}
+	return subs
+}
+
+// ─── Help ─────────────────────────────────────────────────────────
+
+func (c *command) synopsis() string {
+	if c.args == "" {
+		return c.name
+	}
+	return c.name + " " + c.args
+}
+
+// usage prints the command's help: synopsis, examples and flags
+func (c *command) usage(w io.Writer, fs *flag.FlagSet, globals []string) {
+	fmt.Fprintf(w, "Usage: agentveil %s [flags]", c.name)
+	if c.args != "" {
+		fmt.Fprintf(w, " %s", c.args)
+	}
+	fmt.Fprintf(w, "\n\n%s\n", c.summary)
+	if len(c.examples) > 0 {
+		fmt.Fprintln(w, "\nExamples:")
+		printExamples(w, c.examples)
+	}
+	var local []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if !slices.Contains(globals, f.Name) {
+			local = append(local, f.Name)
+		}
+	})
+	if len(local) > 0 {
+		fmt.Fprintln(w, "\nFlags:")
+		printFlags(w, fs, local)
+	}
+	fmt.Fprintln(w, "\nGlobal flags:")
+	printFlags(w, fs, globals)
+}
+
+// printFlags prints the named flags of fs in the style of
+// flag.PrintDefaults, with double dashes and their environment variables
+func printFlags(w io.Writer, fs *flag.FlagSet, names []string) {
+	for _, name := range names {
+		f := fs.Lookup(name)
+		typ, usage := flag.UnquoteUsage(f)
+		line := "  --" + f.Name
+		if typ != "" {
+			line += " " + typ
+		}
+		fmt.Fprintf(w, "%s\n    \t%s", line, strings.ReplaceAll(usage, "\n", "\n    \t"))
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+			fmt.Fprintf(w, " (default %s)", f.DefValue)
+		}
+		if env := flagEnv[f.Name]; env != "" {
+			fmt.Fprintf(w, " ($%s)", env)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func printExamples(w io.Writer, examples [][2]string) {
+	for _, ex := range examples {
+		line := "  agentveil " + ex[0]
+		switch {
+		case ex[1] == "":
+			fmt.Fprintln(w, line)
+		case len(line) < 50:
+			fmt.Fprintf(w, "%-50s%s\n", line, ex[1])
+		default:
+			fmt.Fprintf(w, "%s\n%-50s%s\n", line, "", ex[1])
+		}
+	}
+}
+
+// printGroupUsage lists the subcommands of a group such as "proxy"
+func printGroupUsage(w io.Writer, group string, subs []*command) {
+	fmt.Fprintln(w, "Usage:")
+	for _, c := range subs {
+		fmt.Fprintf(w, "  agentveil %-30s %s\n", c.synopsis(), c.summary)
+	}
+	fmt.Fprintf(w, "\nRun `agentveil help %s <command>` for its flags.\n", group)
+}
+
+// printUsage prints the help of every command
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "agentveil — Security Proxy for AI Agents")
+	fmt.Fprintln(w, "\nUsage:\n  agentveil <command> [flags] [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-30s %s\n", c.synopsis(), c.summary)
+	}
+
+	fs := flag.NewFlagSet("agentveil", flag.ContinueOnError)
+	fmt.Fprintln(w, "\nGlobal flags:")
+	printFlags(w, fs, globalFlags(fs, &globalOptions{}))
+
+	fmt.Fprintln(w, "\nExamples:")
+	for _, c := range commands {
+		printExamples(w, c.examples)
+	}
+
+	fmt.Fprintln(w, `
+Flags take their value from the command line, then the environment, then
+the command's section of the config file, then their default.
+
+Environment:
+  VEIL_PROXY_URL         Proxy URL (--proxy-url, default: http://localhost:8080)
+  VEIL_API_KEY           API key for authentication (wrap falls back to the key from setup --remote)
+  VEIL_HTTPS_PROXY       Forward proxy URL; wrap/setup export it as HTTPS_PROXY
+  VEIL_ENCRYPTION_KEY    32-byte hex key for vault encryption
+  TARGET_URL             Upstream LLM API (default: https://api.openai.com)
+  REDIS_ADDR             Redis address (default: localhost:6379)
+  REDIS_TLS              Connect to Redis over TLS (REDIS_TLS_CA/CERT/KEY for certificates)
+  REDIS_SENTINEL         Comma-separated Sentinel addresses (REDIS_CLUSTER for Cluster)
+
+Run `+"`agentveil help <command>`"+` for a command's flags.`)
+}
+
+// helpCmd prints the help of every command, or of the named one
+func helpCmd(fs *flag.FlagSet) func([]string) error {
+	return func(args []string) error {
+		if len(args) == 0 {
+			printUsage(os.Stdout)
+			return nil
+		}
+		name := strings.Join(args, " ")
+		if c := findCommand(name); c != nil {
+			fs, _, _, globals := c.flagSet()
+			c.usage(os.Stdout, fs, globals)
+			return nil
+		}
+		if subs := subcommands(name); len(subs) > 0 {
+			printGroupUsage(os.Stdout, name, subs)
+			return nil
+		}
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+func versionCmd(fs *flag.FlagSet) func([]string) error {
+	return func([]string) error {
+		build := version.Get()
+		if opts.json {
+			data, _ := json.MarshalIndent(build, "", "  ")
+			fmt.Println(string(data))
+			return nil
+		}
+		fmt.Printf("agentveil version %s\n", build)
+		return nil
+	}
+}
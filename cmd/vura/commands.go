@@ -2,9 +2,11 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,46 +14,39 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/vurakit/agentveil/internal/auditor"
+	"github.com/vurakit/agentveil/internal/bootstrap"
 	"github.com/vurakit/agentveil/internal/compliance"
 	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/i18n"
+	"github.com/vurakit/agentveil/internal/mitm"
+	"github.com/vurakit/agentveil/internal/version"
+	"github.com/vurakit/agentveil/pkg/pii"
+	"github.com/vurakit/agentveil/sdk/mcp"
 )
 
-// handleWrap wraps an AI tool command, setting env vars to route through Agent Veil proxy
-func handleWrap(args []string) {
-	// Find "--" separator
-	dashIdx := -1
-	for i, a := range args {
-		if a == "--" {
-			dashIdx = i
-			break
+// wrapCmd wraps an AI tool command, setting env vars to route through Agent Veil proxy
+func wrapCmd(fs *flag.FlagSet) func([]string) error {
+	withMCP := fs.Bool("with-mcp", false, "Also register the MCP tools with Claude Code or Cursor")
+	return func(cmdArgs []string) error {
+		if len(cmdArgs) == 0 {
+			return errUsage
 		}
+		return wrap(cmdArgs, *withMCP)
 	}
+}
 
-	var cmdArgs []string
-	if dashIdx >= 0 && dashIdx+1 < len(args) {
-		cmdArgs = args[dashIdx+1:]
-	} else if len(args) > 0 && args[0] != "--" {
-		cmdArgs = args
-	} else {
-		fmt.Println("Usage: agentveil wrap -- <command> [args...]")
-		fmt.Println("\nExamples:")
-		fmt.Println("  agentveil wrap -- claude-code")
-		fmt.Println("  agentveil wrap -- cursor")
-		fmt.Println("  agentveil wrap -- aider --model gpt-4")
-		fmt.Println("  agentveil wrap -- python my_agent.py")
-		return
-	}
-
-	if len(cmdArgs) == 0 {
-		fmt.Fprintln(os.Stderr, "No command specified after --")
-		os.Exit(1)
+func wrap(cmdArgs []string, withMCP bool) error {
+	// A remote setup supplies the proxy URL and the API key
+	proxyURL := opts.proxyURL
+	remote, _ := readSetupBlock(detectShellProfile())
+	if remote.Mode == modeRemote && opts.sources["proxy-url"] == "default" {
+		proxyURL = remote.URL
 	}
-
-	proxyURL := envOr("VEIL_PROXY_URL", "http://localhost:8080")
 	openaiBase := proxyURL + "/v1"    // OpenAI SDK expects base URL with /v1
 	anthropicBase := proxyURL         // Anthropic SDK appends /v1/messages itself
 	geminiBase := proxyURL + "/gemini" // Gemini route prefix
@@ -63,123 +58,384 @@ func handleWrap(args []string) {
 	switch {
 	case strings.Contains(toolName, "claude"):
 		env = setEnv(env, "ANTHROPIC_BASE_URL", anthropicBase)
-		fmt.Fprintf(os.Stderr, "🛡️  Agent Veil: wrapping Claude via %s\n", anthropicBase)
+		info("🛡️  Agent Veil: wrapping Claude via %s\n", anthropicBase)
 	case strings.Contains(toolName, "cursor"):
 		env = setEnv(env, "OPENAI_BASE_URL", openaiBase)
 		env = setEnv(env, "ANTHROPIC_BASE_URL", anthropicBase)
-		fmt.Fprintf(os.Stderr, "🛡️  Agent Veil: wrapping Cursor via %s\n", proxyURL)
+		info("🛡️  Agent Veil: wrapping Cursor via %s\n", proxyURL)
 	case strings.Contains(toolName, "aider"):
 		env = setEnv(env, "OPENAI_API_BASE", openaiBase)
-		fmt.Fprintf(os.Stderr, "🛡️  Agent Veil: wrapping Aider via %s\n", openaiBase)
+		info("🛡️  Agent Veil: wrapping Aider via %s\n", openaiBase)
 	case strings.Contains(toolName, "gemini"):
 		env = setEnv(env, "GEMINI_API_BASE", geminiBase)
-		fmt.Fprintf(os.Stderr, "🛡️  Agent Veil: wrapping Gemini via %s\n", geminiBase)
+		info("🛡️  Agent Veil: wrapping Gemini via %s\n", geminiBase)
 	default:
 		// Generic: set all common env vars
 		env = setEnv(env, "OPENAI_BASE_URL", openaiBase)
 		env = setEnv(env, "OPENAI_API_BASE", openaiBase)
 		env = setEnv(env, "ANTHROPIC_BASE_URL", anthropicBase)
 		env = setEnv(env, "GEMINI_API_BASE", geminiBase)
-		fmt.Fprintf(os.Stderr, "🛡️  Agent Veil: wrapping %s via %s\n", cmdArgs[0], proxyURL)
+		info("🛡️  Agent Veil: wrapping %s via %s\n", cmdArgs[0], proxyURL)
 	}
 
-	// Pass through Agent Veil API key if set
-	if apiKey := os.Getenv("VEIL_API_KEY"); apiKey != "" {
+	// Tools without base-URL support go through the HTTPS forward proxy
+	for _, kv := range forwardProxyEnv() {
+		env = setEnv(env, kv[0], kv[1])
+	}
+	if httpsProxy := os.Getenv("VEIL_HTTPS_PROXY"); httpsProxy != "" {
+		info("🛡️  Agent Veil: HTTPS_PROXY=%s\n", httpsProxy)
+	}
+
+	// Register the MCP tools with clients that read an MCP config
+	if withMCP {
+		if client, err := mcp.ParseClient(mcpClientFor(toolName)); err != nil {
+			fmt.Fprintf(os.Stderr, "🛡️  Agent Veil: --with-mcp ignored: no MCP config for %s\n", cmdArgs[0])
+		} else if err := mcpInstall(client, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "🛡️  Agent Veil: MCP registration failed: %v\n", err)
+		}
+	}
+
+	// Pass through the Agent Veil API key, from the env or the keychain
+	apiKey := os.Getenv("VEIL_API_KEY")
+	if apiKey == "" && remote.Mode == modeRemote {
+		apiKey, _ = loadAPIKey()
+	}
+	if apiKey != "" {
 		env = setEnv(env, "VEIL_API_KEY", apiKey)
 	}
 
+	// Give the tool an explicit session, ended when it exits, unless the
+	// caller chose one; SDKs send VEIL_SESSION_ID as X-Session-ID
+	sessionID := ""
+	if os.Getenv("VEIL_SESSION_ID") == "" {
+		if sessionID = beginSession(proxyURL, apiKey); sessionID != "" {
+			env = setEnv(env, "VEIL_SESSION_ID", sessionID)
+			info("🛡️  Agent Veil: session %s\n", sessionID)
+		}
+	}
+
 	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
 	cmd.Env = env
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	if err := cmd.Run(); err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			os.Exit(exitErr.ExitCode())
-		}
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	err := cmd.Run()
+	if sessionID != "" {
+		endSession(proxyURL, apiKey, sessionID)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exit(exitErr.ExitCode())
 	}
+	return err
 }
 
-// handleAudit audits a skill.md file
-func handleAudit(args []string) {
-	if len(args) == 0 {
-		fmt.Println("Usage: agentveil audit <file|->")
-		fmt.Println("\nExamples:")
-		fmt.Println("  agentveil audit skill.md")
-		fmt.Println("  cat skill.md | agentveil audit -")
-		return
+// mcpClientFor maps a wrapped command to the MCP client it is, if any
+func mcpClientFor(toolName string) string {
+	switch {
+	case strings.Contains(toolName, "claude"):
+		return "claude"
+	case strings.Contains(toolName, "cursor"):
+		return "cursor"
 	}
+	return toolName
+}
 
-	var content string
-	if args[0] == "-" {
-		data, err := io.ReadAll(os.Stdin)
+// auditCmd audits a skill.md file, or a skill's files together with
+// --project
+func auditCmd(fs *flag.FlagSet) func([]string) error {
+	project := fs.Bool("project", false, "Audit the files under the directory as one project")
+	format := fs.String("format", "text", "Output format: text, json or html (text or json with --project)")
+	rules := fs.String("rules", "", "Custom rules YAML file")
+	requireRef := fs.Bool("require-reference", true, "With --project, only chain files that reference each other by path or file name")
+	maxDistance := fs.Int("max-file-distance", 0, "With --project, most reference hops between two files of a chain (0 = any)")
+	langName := langFlag(fs)
+	return func(args []string) error {
+		if len(args) != 1 || *maxDistance < 0 {
+			return errUsage
+		}
+		a, err := loadAuditor(*rules, *langName)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
-			os.Exit(1)
+			return err
 		}
-		content = string(data)
-	} else {
-		data, err := os.ReadFile(args[0])
+		if *project {
+			a.SetProjectOptions(auditor.ProjectOptions{RequireReference: *requireRef, MaxFileDistance: *maxDistance})
+			return auditProject(a, args[0], outputFormat(*format))
+		}
+
+		data, err := readInput(args[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("reading %s: %w", args[0], err)
+		}
+		report := a.Analyze(string(data))
+
+		switch outputFormat(*format) {
+		case "json":
+			data, _ := report.ReportJSON()
+			fmt.Println(string(data))
+		case "html":
+			fmt.Println(report.ReportHTML())
+		default:
+			printAuditReport(report)
 		}
-		content = string(data)
-	}
 
-	// Check for --custom-rules flag
-	var a *auditor.Auditor
-	customRulesIdx := -1
-	for i, arg := range args {
-		if arg == "--rules" && i+1 < len(args) {
-			customRulesIdx = i + 1
-			break
+		// Exit with non-zero code if high risk
+		if report.RiskLevel >= auditor.RiskHigh {
+			exit(2)
 		}
+		return nil
 	}
+}
 
-	if customRulesIdx >= 0 {
-		rulesData, err := os.ReadFile(args[customRulesIdx])
+// langFlag registers --lang, the language of reports
+func langFlag(fs *flag.FlagSet) *string {
+	return fs.String("lang", string(i18n.Default), "Report language: vi or en")
+}
+
+// loadAuditor returns the auditor with the custom rules in the YAML file
+// rules, or the built-in rules when rules is empty, reporting in lang
+func loadAuditor(rules, lang string) (*auditor.Auditor, error) {
+	l, err := i18n.Parse(lang)
+	if err != nil {
+		return nil, fmt.Errorf("--lang: %w", err)
+	}
+	a := auditor.New()
+	if rules != "" {
+		data, err := os.ReadFile(rules)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading rules file: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("reading rules file: %w", err)
 		}
-		var createErr error
-		a, createErr = auditor.NewWithCustomRules(string(rulesData))
-		if createErr != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing rules: %v\n", createErr)
-			os.Exit(1)
+		if a, err = auditor.NewWithCustomRules(string(data)); err != nil {
+			return nil, fmt.Errorf("parsing rules: %w", err)
 		}
-	} else {
-		a = auditor.New()
 	}
+	a.SetLang(l)
+	return a, nil
+}
 
-	report := a.Analyze(content)
-
-	// Output format
-	outputFormat := "text"
-	for i, arg := range args {
-		if arg == "--format" && i+1 < len(args) {
-			outputFormat = args[i+1]
-		}
+// auditProject audits every text file under dir together, so behavior
+// chains may span files
+func auditProject(a *auditor.Auditor, dir, format string) error {
+	files, err := readProject(dir)
+	if err != nil {
+		return fmt.Errorf("reading project: %w", err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no text files under %s", dir)
 	}
+	report := a.AnalyzeProject(files)
 
-	switch outputFormat {
+	switch format {
 	case "json":
-		data, _ := report.ReportJSON()
+		data, _ := json.MarshalIndent(report, "", "  ")
 		fmt.Println(string(data))
-	case "html":
-		fmt.Println(report.ReportHTML())
 	default:
-		printAuditReport(report)
+		printProjectReport(report)
 	}
 
-	// Exit with non-zero code if high risk
 	if report.RiskLevel >= auditor.RiskHigh {
-		os.Exit(2)
+		exit(2)
+	}
+	return nil
+}
+
+// readProject reads the text files under dir, keyed by slash-separated
+// path relative to dir. Hidden directories and binary files are skipped.
+func readProject(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return files, err
+}
+
+func printProjectReport(report auditor.ProjectReport) {
+	fmt.Printf("\n=== Agent Veil Project Audit Report ===\n\n")
+	fmt.Printf("Risk Level:  %s (%d/4)\n", report.RiskLevelLabel, report.RiskLevel)
+	fmt.Printf("Score:       %.0f/100\n", report.Score)
+	fmt.Printf("Files:       %d\n", len(report.Files))
+	fmt.Printf("Summary:     %s\n", report.Summary)
+	fmt.Println()
+
+	names := make([]string, 0, len(report.Files))
+	for name := range report.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("Files:")
+	for _, name := range names {
+		r := report.Files[name]
+		fmt.Printf("  %-40s %s (%d/4), score %.0f, %d finding(s)\n", name, r.RiskLevelLabel, r.RiskLevel, r.Score, len(r.Findings))
+		for _, f := range r.Findings {
+			if f.Severity != auditor.SeverityInfo {
+				fmt.Printf("    - [%s] Line %d: %s\n", f.Severity, f.Line, f.Description)
+			}
+		}
+	}
+
+	if len(report.Findings) > 0 {
+		fmt.Println("\nCross-file Chains:")
+		for _, f := range report.Findings {
+			fmt.Printf("  - [%s] %s: %s\n", f.Severity, f.Category, f.Description)
+			if f.Snippet != "" {
+				fmt.Printf("     > %s\n", f.Snippet)
+			}
+		}
+	}
+	fmt.Println()
+}
+
+// auditDiffCmd reports the risk delta between two versions of a skill
+func auditDiffCmd(fs *flag.FlagSet) func([]string) error {
+	format := fs.String("format", "text", "Output format: text or json")
+	failOn := fs.String("fail-on", "high", "Exit non-zero when added findings reach this severity (low, medium, high, critical, none)")
+	oldGit := fs.String("old-git", "", "Read the old version from this git revision (requires --path)")
+	path := fs.String("path", "", "Skill file to compare against --old-git")
+	rules := fs.String("rules", "", "Custom rules YAML file")
+	langName := langFlag(fs)
+	return func(files []string) error {
+		if *failOn != "none" && !auditor.ValidSeverity(*failOn) {
+			return fmt.Errorf("unknown --fail-on severity %q", *failOn)
+		}
+
+		var oldContent, newContent string
+		switch {
+		case *oldGit != "":
+			if *path == "" || len(files) != 0 {
+				return errUsage
+			}
+			out, err := exec.Command("git", "show", *oldGit+":./"+filepath.ToSlash(*path)).Output()
+			if err != nil {
+				return fmt.Errorf("reading %s at %s from git: %w", *path, *oldGit, err)
+			}
+			oldContent = string(out)
+			data, err := os.ReadFile(*path)
+			if err != nil {
+				return fmt.Errorf("reading file: %w", err)
+			}
+			newContent = string(data)
+		case len(files) == 2:
+			for i, name := range files {
+				data, err := os.ReadFile(name)
+				if err != nil {
+					return fmt.Errorf("reading file: %w", err)
+				}
+				if i == 0 {
+					oldContent = string(data)
+				} else {
+					newContent = string(data)
+				}
+			}
+		default:
+			return errUsage
+		}
+
+		a, err := loadAuditor(*rules, *langName)
+		if err != nil {
+			return err
+		}
+		diff := auditor.Diff(a.Analyze(oldContent), a.Analyze(newContent))
+
+		if outputFormat(*format) == "json" {
+			data, _ := diff.JSON()
+			fmt.Println(string(data))
+		} else {
+			printAuditDiff(diff)
+		}
+
+		if *failOn != "none" && diff.IntroducesAtOrAbove(*failOn) {
+			exit(2)
+		}
+		return nil
+	}
+}
+
+// auditRulesCmd lists the audit rules, validating the examples of custom
+// rules as they load
+func auditRulesCmd(fs *flag.FlagSet) func([]string) error {
+	format := fs.String("format", "text", "Output format: text or json")
+	rules := fs.String("rules", "", "Custom rules YAML file (examples are validated)")
+	langName := langFlag(fs)
+	return func([]string) error {
+		a, err := loadAuditor(*rules, *langName)
+		if err != nil {
+			return err
+		}
+
+		list := a.Rules()
+		if outputFormat(*format) == "json" {
+			data, _ := json.MarshalIndent(list, "", "  ")
+			fmt.Println(string(data))
+			return nil
+		}
+
+		fmt.Printf("\n=== Agent Veil Audit Rules (%d) ===\n\n", len(list))
+		for _, r := range list {
+			fmt.Printf("  %-24s %-8s %-8s w=%-3d %s\n", r.ID, r.Source, r.Severity, r.Weight, r.Description)
+			fmt.Printf("      /%s/\n", r.Pattern)
+		}
+		fmt.Println()
+		return nil
+	}
+}
+
+func printAuditDiff(d auditor.DiffReport) {
+	fmt.Printf("\n=== Agent Veil Audit Diff ===\n\n")
+	fmt.Printf("Score:       %.0f -> %.0f (%+.0f)\n", d.OldScore, d.NewScore, d.ScoreDelta)
+	fmt.Printf("Risk Level:  %s (%d) -> %s (%d)\n", d.OldRiskLabel, d.OldRiskLevel, d.NewRiskLabel, d.NewRiskLevel)
+
+	if len(d.Added) == 0 && len(d.Resolved) == 0 && len(d.AddedChains) == 0 && len(d.ResolvedChains) == 0 {
+		fmt.Println("\nNo changes in findings.")
+		fmt.Println()
+		return
+	}
+
+	if len(d.Added) > 0 {
+		fmt.Printf("\nAdded findings (%d):\n", len(d.Added))
+		for _, f := range d.Added {
+			fmt.Printf("  + [%s] Line %d: %s\n", f.Severity, f.Line, f.Description)
+			if f.Snippet != "" {
+				fmt.Printf("      > %s\n", f.Snippet)
+			}
+		}
+	}
+	if len(d.Resolved) > 0 {
+		fmt.Printf("\nResolved findings (%d):\n", len(d.Resolved))
+		for _, f := range d.Resolved {
+			fmt.Printf("  - [%s] %s\n", f.Severity, f.Description)
+		}
+	}
+	if len(d.AddedChains) > 0 {
+		fmt.Printf("\nNew behavior chains: %s\n", strings.Join(d.AddedChains, ", "))
+	}
+	if len(d.ResolvedChains) > 0 {
+		fmt.Printf("\nRemoved behavior chains: %s\n", strings.Join(d.ResolvedChains, ", "))
 	}
+	fmt.Println()
 }
 
 func printAuditReport(report auditor.Report) {
@@ -187,7 +443,11 @@ func printAuditReport(report auditor.Report) {
 	fmt.Printf("Risk Level:  %s (%d/4)\n", report.RiskLevelLabel, report.RiskLevel)
 	fmt.Printf("Score:       %.0f/100\n", report.Score)
 	fmt.Printf("Findings:    %d\n", len(report.Findings))
-	fmt.Printf("Summary:     %s\n\n", report.Summary)
+	fmt.Printf("Summary:     %s\n", report.Summary)
+	if report.RulesProfile != "" {
+		fmt.Printf("Rules:       %s\n", report.RulesProfile)
+	}
+	fmt.Println()
 
 	if len(report.Findings) > 0 {
 		fmt.Println("Findings:")
@@ -208,44 +468,69 @@ func printAuditReport(report auditor.Report) {
 	fmt.Println()
 }
 
-// handleScan scans text for PII
-func handleScan(args []string) {
-	if len(args) == 0 {
-		fmt.Println("Usage: agentveil scan <text|->")
-		fmt.Println("\nExamples:")
-		fmt.Println("  agentveil scan \"CCCD: 012345678901, phone: 0912345678\"")
-		fmt.Println("  echo \"text\" | agentveil scan -")
-		return
-	}
+// scanCmd scans text for PII, or anonymizes files with --anonymize
+func scanCmd(fs *flag.FlagSet) func([]string) error {
+	categories := fs.String("categories", "", "Only detect these comma-separated categories (e.g. CCCD,EMAIL)")
+	sensitivity := fs.String("sensitivity", "medium", "Detection sensitivity: low, medium or high")
+	noSecrets := fs.Bool("no-secrets", false, "Skip secret and credential patterns")
+	secretAction := fs.String("secret-action", "", "Proxy action for secrets: mask, block or strip, per category like SECRET_AWS_*=block")
+	anon := anonymizeFlags(fs)
+	return func(positional []string) error {
+		if len(positional) == 0 {
+			return errUsage
+		}
+		if anon.anonymize {
+			return scanAnonymize(positional, anon)
+		}
+		if anon.inPlace || anon.mappingPath != "" {
+			return fmt.Errorf("--in-place and --mapping require --anonymize")
+		}
 
-	var text string
-	if args[0] == "-" {
-		data, err := io.ReadAll(os.Stdin)
+		cfg, err := scanConfig(*categories, *sensitivity, *noSecrets)
+		if err == nil {
+			cfg.Secrets, err = detector.ParseSecretActions(*secretAction)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
-			os.Exit(1)
+			return err
 		}
-		text = string(data)
-	} else {
-		text = strings.Join(args, " ")
-	}
 
-	det := detector.New()
-	entities := det.Scan(text)
-
-	// Output format
-	outputJSON := false
-	for _, arg := range args {
-		if arg == "--json" {
-			outputJSON = true
+		var text string
+		if len(positional) == 1 && positional[0] == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("reading stdin: %w", err)
+			}
+			text = string(data)
+		} else {
+			text = strings.Join(positional, " ")
 		}
+		scanText(text, cfg)
+		return nil
 	}
+}
 
-	if outputJSON || len(args) > 1 && args[len(args)-1] == "--json" {
+// scanText reports the PII in text, as JSON with --json
+func scanText(text string, cfg detector.Config) {
+	// One pass so the reported tokens match the anonymized text
+	det := detector.NewWithConfig(cfg)
+	anonymized, entities := det.AnonymizeMatches(text)
+	sort.SliceStable(entities, func(i, j int) bool { return entities[i].Start < entities[j].Start })
+	entities = detector.WithPositions(text, entities)
+	blocked := false
+	for _, e := range entities {
+		blocked = blocked || e.Action == detector.ActionBlock
+	}
+
+	if opts.json {
+		if entities == nil {
+			entities = []detector.Match{}
+		}
 		result := map[string]any{
-			"found":    len(entities) > 0,
-			"count":    len(entities),
-			"entities": entities,
+			"found":      len(entities) > 0,
+			"count":      len(entities),
+			"entities":   entities,
+			"anonymized": anonymized,
+			"blocked":    blocked,
 		}
 		data, _ := json.MarshalIndent(result, "", "  ")
 		fmt.Println(string(data))
@@ -259,20 +544,61 @@ func handleScan(args []string) {
 
 	fmt.Printf("Found %d PII entities:\n\n", len(entities))
 	for i, e := range entities {
-		fmt.Printf("  %d. [%s] \"%s\" (pos: %d-%d, confidence: %d)\n",
-			i+1, e.Category, e.Original, e.Start, e.End, e.Confidence)
+		fmt.Printf("  %d. [%s] \"%s\" (line %d, col %d, pos: %d-%d, confidence: %d, id: %s) → %s\n",
+			i+1, e.Category, e.Original, e.Line, e.Column, e.Start, e.End, e.Confidence, e.EntityID, e.Action)
+	}
+	if blocked {
+		fmt.Println("\nThe proxy would reject this request with 422: remove the findings marked block.")
 	}
 
-	// Show anonymized version
-	anonymized, _ := det.Anonymize(text)
 	fmt.Printf("\nAnonymized:\n  %s\n", anonymized)
 }
 
-// handleConfig shows current configuration
-func handleConfig(args []string) {
-	if len(args) == 0 || args[0] == "show" {
+// scanConfig builds the detector config for the scan flags. Categories
+// outside the --categories list are set to ActionAllow so they never match.
+func scanConfig(categories, sensitivity string, noSecrets bool) (detector.Config, error) {
+	cfg := detector.DefaultConfig()
+
+	switch strings.ToLower(sensitivity) {
+	case "low":
+		cfg.Sensitivity = detector.SensitivityLow
+	case "", "medium":
+		cfg.Sensitivity = detector.SensitivityMedium
+	case "high":
+		cfg.Sensitivity = detector.SensitivityHigh
+	default:
+		return cfg, fmt.Errorf("invalid --sensitivity %q (want low, medium or high)", sensitivity)
+	}
+	cfg.EnableSecrets = !noSecrets
+
+	if categories == "" {
+		return cfg, nil
+	}
+	wanted := make(map[pii.Category]bool)
+	for _, c := range strings.Split(categories, ",") {
+		cat := pii.Category(strings.ToUpper(strings.TrimSpace(c)))
+		if cat == "" {
+			continue
+		}
+		if _, ok := pii.TokenPrefix[cat]; !ok {
+			return cfg, fmt.Errorf("unknown category %q", c)
+		}
+		wanted[cat] = true
+	}
+	cfg.Policy = make(map[pii.Category]detector.Action)
+	for cat := range pii.TokenPrefix {
+		if !wanted[cat] {
+			cfg.Policy[cat] = detector.ActionAllow
+		}
+	}
+	return cfg, nil
+}
+
+// configShowCmd shows current configuration
+func configShowCmd(fs *flag.FlagSet) func([]string) error {
+	return func([]string) error {
 		config := map[string]string{
-			"VEIL_PROXY_URL":      envOr("VEIL_PROXY_URL", "http://localhost:8080"),
+			"VEIL_PROXY_URL":      opts.proxyURL + " (" + opts.sources["proxy-url"] + ")",
 			"TARGET_URL":          envOr("TARGET_URL", "https://api.openai.com"),
 			"REDIS_ADDR":          envOr("REDIS_ADDR", "localhost:6379"),
 			"LISTEN_ADDR":         envOr("LISTEN_ADDR", ":8080"),
@@ -281,79 +607,130 @@ func handleConfig(args []string) {
 			"VEIL_API_KEY":        maskIfSet("VEIL_API_KEY"),
 		}
 
+		// Exemptions are shown resolved, so operators can audit the defaults
+		exempt := "invalid, see agentveil proxy validate"
+		if settings, report := bootstrap.Load(); resultErr(report, "rate_limit") == nil {
+			exempt = settings.RateLimitExempt.String()
+		}
+
 		fmt.Println("Agent Veil Configuration:")
 		fmt.Println()
 		for k, v := range config {
 			fmt.Printf("  %-25s %s\n", k+":", v)
 		}
+		fmt.Printf("  %-25s %s\n", "Rate limit exempt:", exempt)
 		fmt.Printf("\n  %-25s %s\n", "Go version:", runtime.Version())
 		fmt.Printf("  %-25s %s/%s\n", "Platform:", runtime.GOOS, runtime.GOARCH)
-		fmt.Printf("  %-25s %s\n", "Agent Veil version:", version)
-	} else {
-		fmt.Println("Usage: agentveil config show")
+		fmt.Printf("  %-25s %s\n", "Agent Veil version:", version.Get())
+		return nil
 	}
 }
 
-// handleCompliance checks regulatory compliance
-func handleCompliance(args []string) {
-	if len(args) == 0 || args[0] != "check" {
-		fmt.Println("Usage: agentveil compliance check [--framework <name>]")
-		fmt.Println("\nFrameworks: vietnam, eu, gdpr, all (default)")
-		return
+// resultErr returns the error of component in report
+func resultErr(report bootstrap.Report, component string) error {
+	for _, res := range report {
+		if res.Component == component {
+			return res.Err
+		}
 	}
+	return nil
+}
+
+// complianceCheckCmd checks regulatory compliance of the local
+// environment, or of running proxies with --targets
+func complianceCheckCmd(fs *flag.FlagSet) func([]string) error {
+	framework := fs.String("framework", "all", "Compliance framework: vietnam, eu, gdpr or all")
+	format := fs.String("format", "text", "Output format: text, json or html")
+	targets := fs.String("targets", "", "Comma-separated proxy URLs to evaluate via their /capabilities endpoint instead of the local environment")
+	threshold := fs.Float64("exit-threshold", -1, "Exit 1 when a score is below this (0-100; -1 disables)")
+	langName := langFlag(fs)
+	return func([]string) error {
+		if *threshold != -1 && (*threshold < 0 || *threshold > 100) {
+			fmt.Fprintf(os.Stderr, "Error: --exit-threshold must be a score between 0 and 100\n")
+			exit(2)
+		}
+		lang, err := i18n.Parse(*langName)
+		if err != nil {
+			return fmt.Errorf("--lang: %w", err)
+		}
+		var fleetTargets []string
+		for _, t := range strings.Split(*targets, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				fleetTargets = append(fleetTargets, t)
+			}
+		}
+		checker := checkerFor(*framework)
+		checker.SetLang(lang)
+		output := outputFormat(*format)
+
+		if len(fleetTargets) > 0 {
+			fleet := checker.CheckFleet(fetchFleet(fleetTargets))
+			switch output {
+			case "json":
+				data, _ := fleet.ReportJSON()
+				fmt.Println(string(data))
+			case "html":
+				fmt.Println(fleet.ReportHTML())
+			default:
+				printFleetReport(fleet)
+			}
+			if *threshold >= 0 {
+				if below := fleet.BelowThreshold(*threshold); len(below) > 0 {
+					fmt.Fprintf(os.Stderr, "compliance: below %.0f: %s\n", *threshold, strings.Join(below, ", "))
+					exit(1)
+				}
+			}
+			return nil
+		}
+
+		report := checker.Check(localCapabilities())
 
-	// Determine framework
-	framework := "all"
-	for i, arg := range args {
-		if arg == "--framework" && i+1 < len(args) {
-			framework = args[i+1]
+		switch output {
+		case "json":
+			data, _ := report.ReportJSON()
+			fmt.Println(string(data))
+		case "html":
+			fmt.Println(report.ReportHTML())
+		default:
+			printComplianceReport(report)
+		}
+		if *threshold >= 0 && report.OverallScore < *threshold {
+			fmt.Fprintf(os.Stderr, "compliance: score %.0f below %.0f\n", report.OverallScore, *threshold)
+			exit(1)
 		}
+		return nil
 	}
+}
 
-	var checker *compliance.Checker
+// checkerFor returns the checker for a --framework name, all by default
+func checkerFor(framework string) *compliance.Checker {
 	switch framework {
 	case "vietnam":
-		checker = compliance.NewCheckerForFrameworks(compliance.FrameworkVietnamAI)
+		return compliance.NewCheckerForFrameworks(compliance.FrameworkVietnamAI)
 	case "eu":
-		checker = compliance.NewCheckerForFrameworks(compliance.FrameworkEUAI)
+		return compliance.NewCheckerForFrameworks(compliance.FrameworkEUAI)
 	case "gdpr":
-		checker = compliance.NewCheckerForFrameworks(compliance.FrameworkGDPR)
-	default:
-		checker = compliance.NewChecker()
+		return compliance.NewCheckerForFrameworks(compliance.FrameworkGDPR)
 	}
+	return compliance.NewChecker()
+}
 
-	// Detect current capabilities from running system
-	caps := compliance.SystemCapabilities{
+// localCapabilities detects capabilities from the local environment
+func localCapabilities() compliance.SystemCapabilities {
+	return compliance.SystemCapabilities{
 		PIIDetection:     true,
 		PIIAnonymization: true,
 		EncryptionAtRest: os.Getenv("VEIL_ENCRYPTION_KEY") != "",
 		AuditLogging:     true,
 		AccessControl:    true,
+		RightToErasure:   true,
 		PromptGuard:      true,
 		OutputGuardrails: true,
 		SkillAuditing:    true,
 		RateLimiting:     true,
 		TLSEncryption:    os.Getenv("TLS_CERT") != "",
-	}
-
-	report := checker.Check(caps)
 
-	// Output format
-	outputFormat := "text"
-	for i, arg := range args {
-		if arg == "--format" && i+1 < len(args) {
-			outputFormat = args[i+1]
-		}
-	}
-
-	switch outputFormat {
-	case "json":
-		data, _ := report.ReportJSON()
-		fmt.Println(string(data))
-	case "html":
-		fmt.Println(report.ReportHTML())
-	default:
-		printComplianceReport(report)
+		PlaintextVaultOverride: os.Getenv("VEIL_ENCRYPTION_KEY") == "" && os.Getenv("VEIL_ALLOW_PLAINTEXT_VAULT") == "true",
 	}
 }
 
@@ -411,40 +788,74 @@ const (
 	defaultProxy = "http://localhost:8080"
 )
 
-// handleSetup orchestrates one-command setup/teardown of Agent Veil.
-func handleSetup(args []string) {
-	if len(args) > 0 {
-		switch args[0] {
-		case "--undo", "undo":
+// setupCmd orchestrates one-command setup/teardown of Agent Veil.
+func setupCmd(fs *flag.FlagSet) func([]string) error {
+	undo := fs.Bool("undo", false, "Uninstall Agent Veil, or remove a remote setup")
+	status := fs.Bool("status", false, "Check setup status")
+	genCA := fs.Bool("gen-ca", false, "Create the local CA for the HTTPS forward proxy")
+	remote := fs.String("remote", "", "Point the shell at the shared Agent Veil proxy at this `url` instead of starting one")
+	apiKey := fs.String("api-key", "", "With --remote, the Veil API key, or - to read it from stdin")
+	return func(args []string) error {
+		switch len(args) {
+		case 0:
+		case 1:
+			// setup undo|status|gen-ca, as before those were flags
+			switch args[0] {
+			case "undo":
+				*undo = true
+			case "status":
+				*status = true
+			case "gen-ca":
+				*genCA = true
+			default:
+				return errUsage
+			}
+		default:
+			return errUsage
+		}
+
+		switch {
+		case *undo:
 			setupUninstall()
-			return
-		case "--status", "status":
+		case *status:
 			setupStatus()
-			return
+		case *genCA:
+			setupGenCA()
+		case *remote != "":
+			setupRemote(*remote, *apiKey)
+		default:
+			setupInstall()
 		}
+		return nil
 	}
-	setupInstall()
 }
 
 func setupInstall() {
-	proxyURL := envOr("VEIL_PROXY_URL", defaultProxy)
+	proxyURL := opts.proxyURL
 
 	// 1. Pre-flight
 	fmt.Print("\n=== Agent Veil Setup ===\n\n")
+	profile := detectShellProfile()
+	if existing, ok := readSetupBlock(profile); ok {
+		if conflict := setupConflict(existing, modeLocal, proxyURL); conflict != "" {
+			fmt.Fprintf(os.Stderr, "[fail] %s: %s\n", profile, conflict)
+			exit(1)
+		}
+	}
 	if err := checkCommand("docker"); err != nil {
 		fmt.Fprintf(os.Stderr, "[fail] docker not found. Install: https://docs.docker.com/get-docker/\n")
-		os.Exit(1)
+		exit(1)
 	}
 	if err := checkDockerCompose(); err != nil {
 		fmt.Fprintf(os.Stderr, "[fail] docker compose not found. Install Docker Desktop or the compose plugin.\n")
-		os.Exit(1)
+		exit(1)
 	}
 	fmt.Println("[ok]  docker and docker compose found")
 
 	// 2. Generate .env
 	if err := setupGenerateEnv(); err != nil {
 		fmt.Fprintf(os.Stderr, "[fail] %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// 3. docker compose up
@@ -454,7 +865,7 @@ func setupInstall() {
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "[fail] docker compose up failed: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	fmt.Println("[ok]  Containers started")
 
@@ -462,12 +873,11 @@ func setupInstall() {
 	if err := waitForProxy(proxyURL, 60*time.Second); err != nil {
 		fmt.Fprintf(os.Stderr, "[fail] %v\n", err)
 		fmt.Fprintln(os.Stderr, "  Check logs: docker compose logs proxy")
-		os.Exit(1)
+		exit(1)
 	}
 
 	// 5. Inject shell env vars
-	profile := detectShellProfile()
-	if err := injectShellEnv(profile, proxyURL); err != nil {
+	if err := injectShellEnv(profile, proxyURL, modeLocal); err != nil {
 		fmt.Fprintf(os.Stderr, "[warn] Could not update shell profile: %v\n", err)
 	}
 
@@ -484,10 +894,15 @@ func setupInstall() {
 }
 
 func setupUninstall() {
+	profile := detectShellProfile()
+	if block, ok := readSetupBlock(profile); ok && block.Mode == modeRemote {
+		fmt.Printf("[info] Removing the remote setup (%s)...\n", block.URL)
+		remoteUninstall(profile)
+		return
+	}
 	fmt.Println("[info] Uninstalling Agent Veil...")
 
 	// Remove env block from shell profile
-	profile := detectShellProfile()
 	if removed, err := removeShellEnv(profile); err != nil {
 		fmt.Fprintf(os.Stderr, "[warn] %v\n", err)
 	} else if removed {
@@ -512,9 +927,18 @@ func setupUninstall() {
 }
 
 func setupStatus() {
-	proxyURL := envOr("VEIL_PROXY_URL", defaultProxy)
+	proxyURL := opts.proxyURL
 	fmt.Print("=== Agent Veil Status ===\n\n")
 
+	profile := detectShellProfile()
+	block, configured := readSetupBlock(profile)
+	if configured && block.Mode == modeRemote {
+		remoteStatus(profile, block)
+		printSessionEnv()
+		fmt.Println()
+		return
+	}
+
 	// Proxy health
 	resp, err := http.Get(proxyURL + "/health")
 	if err == nil && resp.StatusCode == http.StatusOK {
@@ -541,19 +965,12 @@ func setupStatus() {
 	}
 
 	// Shell profile
-	profile := detectShellProfile()
-	if profileHasMarker(profile) {
+	if configured {
 		fmt.Printf("[ok]  Shell profile:   configured (%s)\n", profile)
 	} else {
 		fmt.Printf("[warn] Shell profile:  not configured (%s)\n", profile)
 	}
-
-	// Current env
-	fmt.Println("\n  Current session env:")
-	fmt.Printf("    ANTHROPIC_BASE_URL=%s\n", envOr("ANTHROPIC_BASE_URL", "<not set>"))
-	fmt.Printf("    OPENAI_API_BASE=%s\n", envOr("OPENAI_API_BASE", "<not set>"))
-	fmt.Printf("    OPENAI_BASE_URL=%s\n", envOr("OPENAI_BASE_URL", "<not set>"))
-	fmt.Printf("    GEMINI_API_BASE=%s\n", envOr("GEMINI_API_BASE", "<not set>"))
+	printSessionEnv()
 
 	// .env
 	if _, err := os.Stat(".env"); err == nil {
@@ -564,6 +981,15 @@ func setupStatus() {
 	fmt.Println()
 }
 
+// printSessionEnv shows the base URLs of the current shell
+func printSessionEnv() {
+	fmt.Println("\n  Current session env:")
+	fmt.Printf("    ANTHROPIC_BASE_URL=%s\n", envOr("ANTHROPIC_BASE_URL", "<not set>"))
+	fmt.Printf("    OPENAI_API_BASE=%s\n", envOr("OPENAI_API_BASE", "<not set>"))
+	fmt.Printf("    OPENAI_BASE_URL=%s\n", envOr("OPENAI_BASE_URL", "<not set>"))
+	fmt.Printf("    GEMINI_API_BASE=%s\n", envOr("GEMINI_API_BASE", "<not set>"))
+}
+
 // ─── Setup helpers ────────────────────────────────────────────────
 
 func checkCommand(name string) error {
@@ -664,21 +1090,33 @@ func profileHasMarker(profile string) bool {
 	return strings.Contains(string(data), markerStart)
 }
 
-func injectShellEnv(profile, proxyURL string) error {
+// injectShellEnv appends the block pointing tools at proxyURL to profile.
+// mode (local or remote) is recorded so later setups can tell them apart.
+func injectShellEnv(profile, proxyURL, mode string) error {
 	if profileHasMarker(profile) {
 		fmt.Printf("[info] Shell env vars already in %s, skipping\n", profile)
 		return nil
 	}
 
+	vars := [][2]string{
+		{"VEIL_PROXY_URL", proxyURL},
+		{"ANTHROPIC_BASE_URL", proxyURL},
+		{"OPENAI_API_BASE", proxyURL + "/v1"},
+		{"OPENAI_BASE_URL", proxyURL + "/v1"},
+		{"GEMINI_API_BASE", proxyURL + "/gemini"},
+	}
 	shell := filepath.Base(os.Getenv("SHELL"))
-	var block string
-	if shell == "fish" {
-		block = fmt.Sprintf("\n%s\nset -gx ANTHROPIC_BASE_URL %s\nset -gx OPENAI_API_BASE %s/v1\nset -gx OPENAI_BASE_URL %s/v1\nset -gx GEMINI_API_BASE %s/gemini\n%s\n",
-			markerStart, proxyURL, proxyURL, proxyURL, proxyURL, markerEnd)
-	} else {
-		block = fmt.Sprintf("\n%s\nexport ANTHROPIC_BASE_URL=%s\nexport OPENAI_API_BASE=%s/v1\nexport OPENAI_BASE_URL=%s/v1\nexport GEMINI_API_BASE=%s/gemini\n%s\n",
-			markerStart, proxyURL, proxyURL, proxyURL, proxyURL, markerEnd)
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%s\n# mode: %s\n", markerStart, mode)
+	for _, kv := range append(vars, forwardProxyEnv()...) {
+		if shell == "fish" {
+			fmt.Fprintf(&b, "set -gx %s %s\n", kv[0], kv[1])
+		} else {
+			fmt.Fprintf(&b, "export %s=%s\n", kv[0], kv[1])
+		}
 	}
+	fmt.Fprintf(&b, "%s\n", markerEnd)
+	block := b.String()
 
 	f, err := os.OpenFile(profile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
 	if err != nil {
@@ -693,6 +1131,47 @@ func injectShellEnv(profile, proxyURL string) error {
 	return nil
 }
 
+// forwardProxyEnv lists the variables that send tools through the HTTPS
+// forward proxy (VEIL_HTTPS_PROXY, e.g. http://localhost:8443) and trust its
+// CA. It is empty when the forward proxy is not in use.
+func forwardProxyEnv() [][2]string {
+	httpsProxy := os.Getenv("VEIL_HTTPS_PROXY")
+	if httpsProxy == "" {
+		return nil
+	}
+	env := [][2]string{{"HTTPS_PROXY", httpsProxy}, {"https_proxy", httpsProxy}}
+	caCert, _ := mitm.DefaultCAPaths()
+	caCert = envOr("VEIL_MITM_CA_CERT", caCert)
+	if _, err := os.Stat(caCert); err == nil {
+		// Node ignores the system store; this adds the CA without replacing it
+		env = append(env, [2]string{"NODE_EXTRA_CA_CERTS", caCert})
+	}
+	return env
+}
+
+// setupGenCA creates the local CA used by the HTTPS forward proxy and
+// explains how to trust it
+func setupGenCA() {
+	defCert, defKey := mitm.DefaultCAPaths()
+	certPath := envOr("VEIL_MITM_CA_CERT", defCert)
+	keyPath := envOr("VEIL_MITM_CA_KEY", defKey)
+
+	if err := mitm.GenerateCA(certPath, keyPath); err != nil {
+		fmt.Fprintf(os.Stderr, "[fail] %v\n", err)
+		exit(1)
+	}
+	fmt.Printf("[ok]  CA certificate: %s\n", certPath)
+	fmt.Printf("[ok]  CA key:         %s (keep private)\n", keyPath)
+	fmt.Println("\n  Trust the CA so intercepted LLM traffic verifies:")
+	fmt.Printf("    macOS:  sudo security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain %s\n", certPath)
+	fmt.Printf("    Debian: sudo cp %s /usr/local/share/ca-certificates/agentveil.crt && sudo update-ca-certificates\n", certPath)
+	fmt.Printf("    Fedora: sudo cp %s /etc/pki/ca-trust/source/anchors/ && sudo update-ca-trust\n", certPath)
+	fmt.Printf("    Node:   export NODE_EXTRA_CA_CERTS=%s\n", certPath)
+	fmt.Println("    Python: append it to the bundle from `python -m certifi` (or set REQUESTS_CA_BUNDLE to a bundle that includes it)")
+	fmt.Println("\n  Then start the proxy with VEIL_MITM_ADDR=127.0.0.1:8443 and set")
+	fmt.Println("  VEIL_HTTPS_PROXY=http://localhost:8443 before `agentveil wrap` or `agentveil setup`.")
+}
+
 func removeShellEnv(profile string) (bool, error) {
 	data, err := os.ReadFile(profile)
 	if err != nil {
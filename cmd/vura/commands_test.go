@@ -0,0 +1,540 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/compliance"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// captureStdout runs fn and returns everything it wrote to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+// withStdin feeds input to os.Stdin while fn runs
+func withStdin(t *testing.T, input string, fn func()) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = orig }()
+
+	go func() {
+		w.WriteString(input)
+		w.Close()
+	}()
+	fn()
+}
+
+type scanJSON struct {
+	Found      bool             `json:"found"`
+	Count      int              `json:"count"`
+	Entities   []detector.Match `json:"entities"`
+	Anonymized string           `json:"anonymized"`
+}
+
+func runScanJSON(t *testing.T, args ...string) scanJSON {
+	t.Helper()
+	out := captureStdout(t, func() { run(append([]string{"scan"}, args...)) })
+	var res scanJSON
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out)
+	}
+	return res
+}
+
+func TestHandleScan_JSONFlagNotScanned(t *testing.T) {
+	for _, args := range [][]string{
+		{"mail alice@example.com", "--json"},
+		{"--json", "mail alice@example.com"},
+		{"mail", "--json", "alice@example.com"},
+	} {
+		res := runScanJSON(t, args...)
+		if res.Count != 1 || res.Entities[0].Category != pii.CatEmail {
+			t.Errorf("%v: expected one EMAIL, got %+v", args, res.Entities)
+		}
+		if strings.Contains(res.Anonymized, "--json") {
+			t.Errorf("%v: --json leaked into scanned text: %q", args, res.Anonymized)
+		}
+		if res.Anonymized != "mail [EMAIL_1]" {
+			t.Errorf("%v: anonymized = %q", args, res.Anonymized)
+		}
+	}
+}
+
+func TestHandleScan_EntitiesSortedByStart(t *testing.T) {
+	res := runScanJSON(t, "--json", "0912345678 then alice@example.com then CCCD 012345678901")
+	if res.Count < 3 {
+		t.Fatalf("expected at least 3 entities, got %+v", res.Entities)
+	}
+	for i := 1; i < len(res.Entities); i++ {
+		if res.Entities[i].Start < res.Entities[i-1].Start {
+			t.Errorf("entities not sorted by Start: %+v", res.Entities)
+		}
+	}
+}
+
+func TestHandleScan_Categories(t *testing.T) {
+	res := runScanJSON(t, "--json", "--categories", "cccd", "CCCD 012345678901 mail alice@example.com")
+	if res.Count != 1 || res.Entities[0].Category != pii.CatCCCD {
+		t.Errorf("expected only CCCD, got %+v", res.Entities)
+	}
+	if !strings.Contains(res.Anonymized, "alice@example.com") {
+		t.Errorf("unselected category should be left alone: %q", res.Anonymized)
+	}
+}
+
+func TestHandleScan_NoSecrets(t *testing.T) {
+	text := "key sk-proj-abcdefghijklmnopqrstuvwxyz0123456789ABCD"
+	if res := runScanJSON(t, "--json", text); res.Count == 0 {
+		t.Fatal("expected the key to be detected without --no-secrets")
+	}
+	if res := runScanJSON(t, "--json", "--no-secrets", text); res.Count != 0 {
+		t.Errorf("expected no secrets with --no-secrets, got %+v", res.Entities)
+	}
+}
+
+func TestHandleScan_Stdin(t *testing.T) {
+	var res scanJSON
+	withStdin(t, "mail bob@example.com\n", func() {
+		res = runScanJSON(t, "--json", "-")
+	})
+	if res.Count != 1 || res.Anonymized != "mail [EMAIL_1]\n" {
+		t.Errorf("unexpected stdin result: %+v", res)
+	}
+}
+
+func TestHandleScan_TextOutput(t *testing.T) {
+	out := captureStdout(t, func() { run([]string{"scan", "mail", "alice@example.com"}) })
+	if !strings.Contains(out, "Found 1 PII entities") || !strings.Contains(out, "mail [EMAIL_1]") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	out = captureStdout(t, func() { run([]string{"scan", "nothing here"}) })
+	if strings.TrimSpace(out) != "No PII detected." {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestScanConfig(t *testing.T) {
+	tests := []struct {
+		categories, sensitivity string
+		wantErr                 bool
+	}{
+		{"", "medium", false},
+		{"CCCD,EMAIL", "high", false},
+		{" email , phone ", "low", false},
+		{"", "extreme", true},
+		{"CCCD,NOPE", "", true},
+	}
+	for _, tt := range tests {
+		cfg, err := scanConfig(tt.categories, tt.sensitivity, false)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("scanConfig(%q, %q) error = %v, wantErr %v", tt.categories, tt.sensitivity, err, tt.wantErr)
+			continue
+		}
+		if err == nil && tt.categories == "CCCD,EMAIL" {
+			if cfg.ActionFor(pii.CatPhone) != detector.ActionAllow || cfg.ActionFor(pii.CatEmail) == detector.ActionAllow {
+				t.Errorf("categories not applied: %v", cfg.Policy)
+			}
+			if cfg.Sensitivity != detector.SensitivityHigh {
+				t.Errorf("sensitivity = %v, want high", cfg.Sensitivity)
+			}
+		}
+	}
+}
+
+func TestForwardProxyEnv(t *testing.T) {
+	t.Setenv("VEIL_HTTPS_PROXY", "")
+	if env := forwardProxyEnv(); env != nil {
+		t.Errorf("disabled: got %v", env)
+	}
+
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caCert, []byte("pem"), 0o644)
+	t.Setenv("VEIL_HTTPS_PROXY", "http://localhost:8443")
+	t.Setenv("VEIL_MITM_CA_CERT", caCert)
+
+	got := map[string]string{}
+	for _, kv := range forwardProxyEnv() {
+		got[kv[0]] = kv[1]
+	}
+	if got["HTTPS_PROXY"] != "http://localhost:8443" || got["https_proxy"] != "http://localhost:8443" || got["NODE_EXTRA_CA_CERTS"] != caCert {
+		t.Errorf("env = %v", got)
+	}
+}
+
+func TestSetupBlock_Modes(t *testing.T) {
+	t.Setenv("VEIL_HTTPS_PROXY", "")
+	for _, shell := range []string{"/bin/zsh", "/usr/bin/fish"} {
+		t.Setenv("SHELL", shell)
+		profile := filepath.Join(t.TempDir(), "profile")
+		os.WriteFile(profile, []byte("export PATH=/usr/bin\n"), 0o644)
+
+		captureStdout(t, func() { injectShellEnv(profile, "https://veil.corp:8443", modeRemote) })
+		block, ok := readSetupBlock(profile)
+		if !ok || block != (setupBlock{Mode: modeRemote, URL: "https://veil.corp:8443"}) {
+			t.Errorf("%s: block = %+v, %v", shell, block, ok)
+		}
+		if c := setupConflict(block, modeRemote, "https://veil.corp:8443"); c != "" {
+			t.Errorf("%s: the same remote setup should not conflict: %s", shell, c)
+		}
+		if c := setupConflict(block, modeRemote, "https://other:8443"); !strings.Contains(c, "--undo") {
+			t.Errorf("%s: another remote should be explained, got %q", shell, c)
+		}
+		if c := setupConflict(block, modeLocal, defaultProxy); !strings.Contains(c, "remote proxy (https://veil.corp:8443)") {
+			t.Errorf("%s: a local setup over a remote one should be explained, got %q", shell, c)
+		}
+
+		if removed, err := removeShellEnv(profile); !removed || err != nil {
+			t.Fatalf("%s: remove: %v, %v", shell, removed, err)
+		}
+		if data, _ := os.ReadFile(profile); string(data) != "export PATH=/usr/bin\n" {
+			t.Errorf("%s: profile after undo = %q", shell, data)
+		}
+	}
+
+	// Blocks written before remote setups carry no mode and are local
+	profile := filepath.Join(t.TempDir(), "profile")
+	os.WriteFile(profile, []byte(markerStart+"\nexport ANTHROPIC_BASE_URL=http://localhost:8080\n"+markerEnd+"\n"), 0o644)
+	block, ok := readSetupBlock(profile)
+	if !ok || block != (setupBlock{Mode: modeLocal, URL: defaultProxy}) {
+		t.Errorf("legacy block = %+v, %v", block, ok)
+	}
+	if c := setupConflict(block, modeRemote, "https://veil.corp:8443"); !strings.Contains(c, "local proxy") {
+		t.Errorf("a remote setup over a local one should be explained, got %q", c)
+	}
+	if _, ok := readSetupBlock(filepath.Join(t.TempDir(), "missing")); ok {
+		t.Error("a missing profile has no block")
+	}
+}
+
+func TestAPIKeyStore_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".agentveil", "api-key")
+	orig := keyStores
+	keyStores = func() []keyStore { return []keyStore{keyFile{path: path}} }
+	defer func() { keyStores = orig }()
+
+	if key, _ := loadAPIKey(); key != "" {
+		t.Fatalf("nothing stored yet, got %q", key)
+	}
+	if where, err := storeAPIKey("veil_sk_abc"); err != nil || where != path {
+		t.Fatalf("store: %q, %v", where, err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, %v", fi.Mode(), err)
+	}
+	if key, where := loadAPIKey(); key != "veil_sk_abc" || where != path {
+		t.Errorf("load = %q from %q", key, where)
+	}
+	if removed := deleteAPIKey(); len(removed) != 1 {
+		t.Errorf("delete removed %v", removed)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("key file still there: %v", err)
+	}
+}
+
+func TestWhoAmI(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mgr := auth.NewManager(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	key, apiKey, _ := mgr.GenerateKey(context.Background(), auth.RoleViewer, "dev")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("GET /auth/whoami", mgr.WhoAmIHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if err := checkHealth(srv.Client(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	info, err := whoAmI(srv.Client(), srv.URL, key)
+	if err != nil || info.KeyID != apiKey.ID || info.Role != auth.RoleViewer {
+		t.Errorf("valid key: %+v, %v", info, err)
+	}
+	if _, err := whoAmI(srv.Client(), srv.URL, "veil_sk_revoked"); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("invalid key: %v", err)
+	}
+
+	// A proxy without auth cannot vouch for the key
+	bare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer bare.Close()
+	if _, err := whoAmI(bare.Client(), bare.URL, key); err == nil || !strings.Contains(err.Error(), "/auth/whoami") {
+		t.Errorf("no auth: %v", err)
+	}
+	if err := checkHealth(bare.Client(), bare.URL+"/down"); err == nil {
+		t.Error("an unhealthy proxy should fail")
+	}
+}
+
+func TestParseRemoteURL(t *testing.T) {
+	if got, err := parseRemoteURL("https://veil.corp:8443/"); err != nil || got != "https://veil.corp:8443" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	for _, raw := range []string{"", "veil.corp:8443", "ftp://veil.corp", "https://"} {
+		if _, err := parseRemoteURL(raw); err == nil {
+			t.Errorf("%q: expected an error", raw)
+		}
+	}
+}
+
+func TestComplianceFleet(t *testing.T) {
+	caps := compliance.SystemCapabilities{PIIDetection: true, PIIAnonymization: true, TLSEncryption: true}
+	srv := httptest.NewServer(compliance.CapabilitiesHandler(caps))
+	defer srv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	instances := fetchFleet([]string{srv.URL, strings.TrimPrefix(down.URL, "http://")})
+	if instances[0].Caps == nil || *instances[0].Caps != caps {
+		t.Fatalf("expected capabilities from %s, got %+v (%v)", srv.URL, instances[0].Caps, instances[0].Err)
+	}
+	if instances[1].Caps != nil || instances[1].Err == nil {
+		t.Fatalf("expected unreachable target to carry an error, got %+v", instances[1])
+	}
+
+	fleet := compliance.NewChecker().CheckFleet(instances)
+	out := captureStdout(t, func() { printFleetReport(fleet) })
+	if !strings.Contains(out, "unknown (") || !strings.Contains(out, "Worst score:") {
+		t.Errorf("fleet report should list the unknown instance and worst score:\n%s", out)
+	}
+}
+
+func TestComplianceEvidence(t *testing.T) {
+	t.Setenv("VEIL_WEBHOOK_SECRET", "supersecretvalue")
+	caps := compliance.SystemCapabilities{PIIDetection: true, AuditLogging: true}
+	mux := http.NewServeMux()
+	mux.Handle(compliance.CapabilitiesPath, compliance.CapabilitiesHandler(caps))
+	mux.HandleFunc("/admin/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Veil-Key") != "admin-key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"in_flight":0}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	m := collectEvidence(srv.URL, "admin-key", "all")
+	var buf bytes.Buffer
+	hash, err := writeEvidence(&buf, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name], _ = io.ReadAll(tr)
+	}
+
+	sum := sha256.Sum256(files["manifest.json"])
+	if hex.EncodeToString(sum[:]) != hash {
+		t.Error("printed hash should be the SHA-256 of manifest.json")
+	}
+	var manifest evidenceManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range manifest.Files {
+		sum := sha256.Sum256(files[f.Name])
+		if hex.EncodeToString(sum[:]) != f.SHA256 {
+			t.Errorf("%s: manifest hash does not match contents", f.Name)
+		}
+	}
+	for _, name := range []string{"capabilities.json", "compliance-report.json", "admin-status.json", "config.json", "detector-patterns.json", "anonymization-roundtrip.json"} {
+		if files[name] == nil {
+			t.Errorf("expected %s in the bundle", name)
+		}
+	}
+
+	missing := make(map[string]string)
+	for _, miss := range manifest.Missing {
+		missing[miss.Name] = miss.Reason
+	}
+	if !strings.Contains(missing["admin-providers.json"], "404") {
+		t.Errorf("disabled endpoint should be listed as missing, got %v", missing)
+	}
+	if _, ok := missing["audit-log-head.json"]; !ok {
+		t.Error("audit log head should be listed as missing")
+	}
+	if bytes.Contains(files["config.json"], []byte("supersecretvalue")) {
+		t.Error("config.json must mask secrets")
+	}
+	if !bytes.Contains(files["anonymization-roundtrip.json"], []byte(`"round_trip": true`)) {
+		t.Errorf("round trip should succeed: %s", files["anonymization-roundtrip.json"])
+	}
+
+	// An unreachable proxy still yields a bundle from the local config
+	srv.Close()
+	m = collectEvidence(srv.URL, "", "all")
+	if len(m.Files) == 0 || len(m.Missing) < 4 {
+		t.Errorf("expected local files and missing proxy items, got %d files, %v", len(m.Files), m.Missing)
+	}
+}
+
+func TestHandleScan_Positions(t *testing.T) {
+	res := runScanJSON(t, "--json", "Tên: Đặng\nmail alice@example.com")
+	if res.Count != 1 {
+		t.Fatalf("expected one entity, got %+v", res.Entities)
+	}
+	e := res.Entities[0]
+	if e.Line != 2 || e.Column != 6 {
+		t.Errorf("expected line 2 col 6, got %d:%d", e.Line, e.Column)
+	}
+	if e.EntityID == "" || strings.Contains(e.EntityID, "alice") {
+		t.Errorf("unexpected EntityID %q", e.EntityID)
+	}
+}
+
+func TestSessionsListFollowsCursors(t *testing.T) {
+	var purged string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Veil-Key") != "veil_sk_admin" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			purged = strings.TrimPrefix(r.URL.Path, "/admin/sessions/")
+			if purged == "old" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Write([]byte(`{"id":"` + purged + `","erased":2}`))
+			return
+		}
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			w.Write([]byte(`{"sessions":[{"id":"a","entries":2,"ttl_seconds":1800}],"next_cursor":"7"}`))
+		case "7":
+			w.Write([]byte(`{"sessions":[{"id":"b","entries":1,"ttl_seconds":-1}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	if err := listSessions(&out, srv.URL, "veil_sk_admin", "", 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "30m0s") || !strings.Contains(out.String(), "--cursor 7") || strings.Contains(out.String(), "b ") {
+		t.Errorf("first page only, with the next cursor:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := listSessions(&out, srv.URL, "veil_sk_admin", "", 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "none") || strings.Contains(out.String(), "--cursor") {
+		t.Errorf("--all should list both pages:\n%s", out.String())
+	}
+
+	if n, err := purgeSession(srv.URL, "veil_sk_admin", "sess 1"); err != nil || n != 2 || purged != "sess 1" {
+		t.Errorf("purge: %d, %v, server saw %q", n, err, purged)
+	}
+	if n, err := purgeSession(srv.URL, "veil_sk_admin", "old"); err != nil || n != -1 {
+		t.Errorf("purge without a count: %d, %v", n, err)
+	}
+	if _, err := purgeSession(srv.URL, "veil_sk_viewer", "x"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected the 403 to surface, got %v", err)
+	}
+}
+
+func TestRunCorpus(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "cases.yaml"), []byte(`cases:
+  - name: cccd
+    input: "CCCD 012345678901"
+    expect: {categories: [CCCD]}
+  - name: missed-email
+    input: "no email here"
+    expect: {categories: [EMAIL]}
+`), 0o644)
+
+	var out bytes.Buffer
+	failed, err := runCorpus(&out, dir, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+	for _, want := range []string{"PASS  cccd", "FAIL  missed-email", "category EMAIL not detected", "1 passed, 1 failed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	var log strings.Builder
+	for i := range 5000 {
+		fmt.Fprintf(&log, `{"request_id":"r%d"}`+"\n", i) // several read chunks
+	}
+	os.WriteFile(path, []byte(log.String()), 0o644)
+
+	lines, err := lastLines(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`{"request_id":"r4997"}`, `{"request_id":"r4998"}`, `{"request_id":"r4999"}`}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lastLines = %q", lines)
+	}
+	if lines, _ := lastLines(path, 10000); len(lines) != 5000 {
+		t.Errorf("a limit above the line count should return every line, got %d", len(lines))
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// completionCmd prints a completion script for the shell named by its
+// argument, generated from the command definitions
+func completionCmd(fs *flag.FlagSet) func([]string) error {
+	return func(args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		switch args[0] {
+		case "bash":
+			writeBashCompletion(os.Stdout)
+		case "zsh":
+			writeZshCompletion(os.Stdout)
+		case "fish":
+			writeFishCompletion(os.Stdout)
+		default:
+			return fmt.Errorf("unsupported shell %q (want bash, zsh or fish)", args[0])
+		}
+		return nil
+	}
+}
+
+// completionEntry is what completes after one command: its subcommands or
+// fixed arguments, and its flags
+type completionEntry struct {
+	path    []string // e.g. ["audit", "diff"]
+	summary string
+	subs    []string
+	flags   []*flag.Flag
+}
+
+// completionEntries returns an entry for every command and command group,
+// with the top-level words first
+func completionEntries() (top []completionEntry, entries []completionEntry) {
+	byName := make(map[string]*completionEntry)
+	var order []string
+	entry := func(name string) *completionEntry {
+		if e, ok := byName[name]; ok {
+			return e
+		}
+		e := &completionEntry{path: strings.Fields(name)}
+		byName[name] = e
+		order = append(order, name)
+		return e
+	}
+
+	for _, c := range commands {
+		e := entry(c.name)
+		e.summary = c.summary
+		e.subs = append(e.subs, c.choices...)
+		fs, _, _, _ := c.flagSet()
+		fs.VisitAll(func(f *flag.Flag) { e.flags = append(e.flags, f) })
+
+		if group, sub, ok := strings.Cut(c.name, " "); ok {
+			g := entry(group)
+			g.subs = append(g.subs, sub)
+		}
+	}
+
+	for _, name := range order {
+		e := byName[name]
+		if len(e.path) > 1 {
+			entries = append(entries, *e)
+			continue
+		}
+		if e.summary == "" {
+			e.summary = "Subcommands: " + strings.Join(e.subs, ", ")
+		}
+		top = append(top, *e)
+		if len(e.subs) > 0 || len(e.flags) > 0 {
+			entries = append(entries, *e)
+		}
+	}
+	// Two-word commands must match before their group
+	sort.SliceStable(entries, func(i, j int) bool { return len(entries[i].path) > len(entries[j].path) })
+	return top, entries
+}
+
+func flagWords(flags []*flag.Flag) string {
+	words := make([]string, len(flags))
+	for i, f := range flags {
+		words[i] = "--" + f.Name
+	}
+	return strings.Join(words, " ")
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// shellQuote single-quotes s for bash, zsh and fish
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func writeBashCompletion(w io.Writer) {
+	top, entries := completionEntries()
+	names := make([]string, len(top))
+	for i, e := range top {
+		names[i] = e.path[0]
+	}
+
+	fmt.Fprintln(w, "# bash completion for agentveil; load with: source <(agentveil completion bash)")
+	fmt.Fprintln(w, "_agentveil() {")
+	fmt.Fprintln(w, `	local cur=${COMP_WORDS[COMP_CWORD]} subs="" flags="" pos=0`)
+	fmt.Fprintln(w, "	if [[ $COMP_CWORD -eq 1 ]]; then")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shellQuote(strings.Join(names, " ")))
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, `	case "${COMP_WORDS[1]} ${COMP_WORDS[2]}" in`)
+	for _, e := range entries {
+		pattern := shellQuote(strings.Join(e.path, " "))
+		if len(e.path) == 1 {
+			pattern = shellQuote(e.path[0]+" ") + "*"
+		}
+		fmt.Fprintf(w, "\t%s) subs=%s flags=%s pos=%d ;;\n", pattern, shellQuote(strings.Join(e.subs, " ")), shellQuote(flagWords(e.flags)), len(e.path)+1)
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, `	if [[ $cur == -* ]]; then`)
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -W "$flags" -- "$cur"))`)
+	fmt.Fprintln(w, `	elif [[ -n $subs && $COMP_CWORD -eq $pos ]]; then`)
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -W "$subs" -- "$cur"))`)
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o default -F _agentveil agentveil")
+}
+
+func writeZshCompletion(w io.Writer) {
+	top, entries := completionEntries()
+
+	fmt.Fprintln(w, "#compdef agentveil")
+	fmt.Fprintln(w, "# zsh completion for agentveil; load with: source <(agentveil completion zsh)")
+	fmt.Fprintln(w, "_agentveil() {")
+	fmt.Fprintln(w, "\tlocal -a cmds subs flags")
+	fmt.Fprintln(w, "\tlocal pos=0")
+	fmt.Fprintln(w, "\tif (( CURRENT == 2 )); then")
+	fmt.Fprintln(w, "\t\tcmds=(")
+	for _, e := range top {
+		fmt.Fprintf(w, "\t\t\t%s\n", shellQuote(e.path[0]+":"+e.summary))
+	}
+	fmt.Fprintln(w, "\t\t)")
+	fmt.Fprintln(w, "\t\t_describe 'command' cmds")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, `	case "${words[2]} ${words[3]}" in`)
+	for _, e := range entries {
+		pattern := shellQuote(strings.Join(e.path, " "))
+		if len(e.path) == 1 {
+			pattern = shellQuote(e.path[0]+" ") + "*"
+		}
+		fmt.Fprintf(w, "\t%s) subs=(%s) flags=(%s) pos=%d ;;\n", pattern, strings.Join(e.subs, " "), flagWords(e.flags), len(e.path)+2)
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "\tif [[ $PREFIX == -* ]]; then")
+	fmt.Fprintln(w, "\t\tcompadd -- $flags")
+	fmt.Fprintln(w, "\telif (( CURRENT == pos && $#subs )); then")
+	fmt.Fprintln(w, "\t\tcompadd -- $subs")
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprintln(w, "\t\t_files")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "compdef _agentveil agentveil")
+}
+
+func writeFishCompletion(w io.Writer) {
+	top, entries := completionEntries()
+
+	fmt.Fprintln(w, "# fish completion for agentveil; load with: agentveil completion fish | source")
+	for _, e := range top {
+		fmt.Fprintf(w, "complete -c agentveil -f -n __fish_use_subcommand -a %s -d %s\n", e.path[0], shellQuote(e.summary))
+	}
+	for _, e := range entries {
+		cond := "__fish_seen_subcommand_from " + e.path[0]
+		if len(e.path) > 1 {
+			cond += "; and __fish_seen_subcommand_from " + e.path[1]
+		} else if subs := subcommands(e.path[0]); len(subs) > 0 {
+			// Group flags and subcommands apply until a subcommand is given
+			var names []string
+			for _, c := range subs {
+				names = append(names, strings.Fields(c.name)[1])
+			}
+			cond += "; and not __fish_seen_subcommand_from " + strings.Join(names, " ")
+		}
+		if len(e.subs) > 0 {
+			fmt.Fprintf(w, "complete -c agentveil -f -n %s -a %s\n", shellQuote(cond), shellQuote(strings.Join(e.subs, " ")))
+		}
+		for _, f := range e.flags {
+			_, usage := flag.UnquoteUsage(f)
+			value := " -r"
+			if isBoolFlag(f) {
+				value = ""
+			}
+			fmt.Fprintf(w, "complete -c agentveil -n %s -l %s%s -d %s\n", shellQuote(cond), f.Name, value, shellQuote(usage))
+		}
+	}
+}
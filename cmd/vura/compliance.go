@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/compliance"
+)
+
+// fetchFleet queries every target's capabilities endpoint concurrently.
+// Failures are kept as instances without capabilities so the report shows
+// them as unknown.
+func fetchFleet(targets []string) []compliance.Instance {
+	client := &http.Client{Timeout: 10 * time.Second}
+	instances := make([]compliance.Instance, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		instances[i].Target = target
+		base := target
+		if !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+		wg.Add(1)
+		go func(inst *compliance.Instance, base string) {
+			defer wg.Done()
+			caps, err := compliance.FetchCapabilities(context.Background(), client, base)
+			if err != nil {
+				inst.Err = err
+				return
+			}
+			inst.Caps = &caps
+		}(&instances[i], base)
+	}
+	wg.Wait()
+	return instances
+}
+
+func printFleetReport(fleet compliance.FleetReport) {
+	for _, inst := range fleet.Instances {
+		if inst.Report == nil {
+			continue
+		}
+		fmt.Printf("\n--- %s ---", inst.Target)
+		printComplianceReport(*inst.Report)
+	}
+
+	fmt.Printf("\n=== Agent Veil Fleet Compliance ===\n\n")
+	for _, inst := range fleet.Instances {
+		if inst.Report == nil {
+			fmt.Printf("  %-40s unknown (%s)\n", inst.Target, inst.Error)
+			continue
+		}
+		fmt.Printf("  %-40s %.0f/100\n", inst.Target, inst.Report.OverallScore)
+	}
+	if fleet.WorstTarget != "" {
+		fmt.Printf("\nWorst score: %.0f/100 (%s)\n", fleet.WorstScore, fleet.WorstTarget)
+	}
+
+	var failing []compliance.MatrixRow
+	for _, row := range fleet.Matrix {
+		if len(row.Failing) > 0 {
+			failing = append(failing, row)
+		}
+	}
+	if len(failing) > 0 {
+		fmt.Println("\nFailing requirements:")
+		for _, row := range failing {
+			fmt.Printf("  ✗ [%s] %s — %s\n", row.Requirement.ID, row.Requirement.Title, strings.Join(row.Failing, ", "))
+		}
+	}
+
+	if len(fleet.Recommendations) > 0 {
+		fmt.Println("\nRecommendations:")
+		for _, rec := range fleet.Recommendations {
+			fmt.Printf("  → %s\n", rec)
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vurakit/agentveil/internal/bootstrap"
+	"github.com/vurakit/agentveil/internal/config"
+)
+
+// configValidateCmd checks a veil.yaml: its keys, then the settings it
+// gives the proxy, as startup would see them with the environment applied
+func configValidateCmd(fs *flag.FlagSet) func([]string) error {
+	return func(args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		if !validateConfig(os.Stdout, args[0]) {
+			exit(1)
+		}
+		return nil
+	}
+}
+
+// validateConfig prints the problems of the veil.yaml at path, each with
+// its line, and reports whether the proxy would start with it
+func validateConfig(out io.Writer, path string) bool {
+	f, err := config.Load(path)
+	var fileErr *config.Error
+	if errors.As(err, &fileErr) {
+		for _, issue := range fileErr.Issues {
+			printIssue(out, path, "error", issue, fileErr.Context(issue.Line))
+		}
+		return false
+	}
+	if err != nil {
+		fmt.Fprintf(out, "error: %v\n", err)
+		return false
+	}
+	for _, w := range f.Warnings {
+		printIssue(out, path, "warning", w, f.Context(w.Line))
+	}
+
+	_, report := bootstrap.LoadFile(f)
+	for _, res := range report.Errors() {
+		if key, line, ok := f.Blame(res.Err.Error()); ok {
+			// The line is printed already; drop the suffix LoadFile adds
+			msg := errors.Unwrap(res.Err).Error()
+			printIssue(out, path, "error", config.Issue{Line: line, Key: key, Message: msg}, f.Context(line))
+			continue
+		}
+		fmt.Fprintf(out, "error: %s: %s\n", res.Component, res.Err)
+	}
+	if !report.OK() {
+		return false
+	}
+	fmt.Fprintf(out, "%s: ok, keys: %d, warnings: %d\n", path, len(f.Env()), len(f.Warnings))
+	return true
+}
+
+// printIssue prints issue as path:line, followed by the line itself
+func printIssue(out io.Writer, path, level string, issue config.Issue, context string) {
+	if issue.Key != "" {
+		fmt.Fprintf(out, "%s:%d: %s: %s: %s\n", path, issue.Line, level, issue.Key, issue.Message)
+	} else {
+		fmt.Fprintf(out, "%s:%d: %s: %s\n", path, issue.Line, level, issue.Message)
+	}
+	if context != "" {
+		fmt.Fprintf(out, "  %4d | %s\n", issue.Line, context)
+	}
+}
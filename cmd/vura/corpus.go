@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vurakit/agentveil/internal/corpus"
+)
+
+// corpusRunCmd runs a regression corpus through the detection engines and
+// exits non-zero when any case no longer passes
+func corpusRunCmd(fs *flag.FlagSet) func([]string) error {
+	format := fs.String("format", "text", "Output format: text or json")
+	return func(dirs []string) error {
+		if len(dirs) != 1 {
+			return errUsage
+		}
+		failed, err := runCorpus(os.Stdout, dirs[0], outputFormat(*format))
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			exit(1)
+		}
+		return nil
+	}
+}
+
+// runCorpus reports every case of the corpus in dir and returns how many
+// failed
+func runCorpus(out io.Writer, dir, format string) (int, error) {
+	cases, err := corpus.Load(dir)
+	if err != nil {
+		return 0, err
+	}
+	summary := corpus.NewRunner().Run(cases)
+
+	if format == "json" {
+		data, _ := json.MarshalIndent(summary, "", "  ")
+		fmt.Fprintln(out, string(data))
+		return summary.Failed, nil
+	}
+	for _, res := range summary.Results {
+		if res.Passed {
+			fmt.Fprintf(out, "PASS  %s\n", res.Name)
+			continue
+		}
+		fmt.Fprintf(out, "FAIL  %s (%s)\n", res.Name, res.Source)
+		for _, f := range res.Failures {
+			fmt.Fprintf(out, "      %s\n", f)
+		}
+	}
+	fmt.Fprintf(out, "\n%d passed, %d failed, %d cases\n", summary.Passed, summary.Failed, len(summary.Results))
+	return summary.Failed, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/bootstrap"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/detector/bundle"
+	"github.com/vurakit/agentveil/internal/detector/remote"
+	"github.com/vurakit/agentveil/internal/logging"
+	"github.com/vurakit/agentveil/internal/redisconn"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/version"
+)
+
+// detectorServeCmd runs the detector (and vault) as a standalone service so
+// detection can scale separately from proxying
+func detectorServeCmd(fs *flag.FlagSet) func([]string) error {
+	addr := fs.String("grpc", ":9091", "listen address for the Detector service (api/detector.proto)")
+	noVault := fs.Bool("no-vault", false, "serve detection only; Anonymize with store=true is rejected")
+	return func([]string) error {
+		serveDetector(*addr, *noVault)
+		return nil
+	}
+}
+
+func serveDetector(addr string, noVault bool) {
+	logger := logging.Setup(envOr("LOG_LEVEL", "info"), os.Stdout, envOr("VEIL_LOG_REDACT", "true") != "false")
+	logger.Info("starting Agent Veil detector service", "version", version.Get().String())
+
+	// Only the Redis, encryption, pseudonym and pattern bundle settings matter here
+	settings, report := bootstrap.Load()
+	for _, res := range report.Errors() {
+		switch res.Component {
+		case "redis", "encryption", "pseudonyms", "pattern_bundle":
+			logger.Error("invalid configuration", "component", res.Component, "error", res.Err)
+			exit(1)
+		}
+	}
+
+	var v *vault.Vault
+	if !noVault {
+		redisClient, err := redisconn.New(settings.Redis)
+		if err != nil {
+			logger.Error("failed to configure Redis client", "error", err)
+			exit(1)
+		}
+		defer redisClient.Close()
+		v = vault.NewWithClient(redisClient)
+		v.SetTTL(settings.VaultTTL)
+		if settings.EncryptionKey != nil {
+			enc, err := vault.NewEncryptor(settings.EncryptionKey)
+			if err != nil {
+				logger.Error("encryptor error", "error", err)
+				exit(1)
+			}
+			v.SetEncryptor(enc)
+		}
+	}
+
+	// Replicas sharing VEIL_PSEUDONYM_KEY agree on every pseudonym
+	detCfg := detector.DefaultConfig()
+	detCfg.Pseudonyms = settings.Pseudonyms
+	detCfg.Secrets = settings.SecretActions
+	detCfg.Policy = settings.PIIPolicy
+	det := detector.NewWithConfig(detCfg)
+	if settings.PatternBundle != nil {
+		// Rejected bundles are logged; the built-ins stay active
+		bundle.NewLoader(*settings.PatternBundle, det).Reload(context.Background())
+	}
+
+	srv := remote.NewServer(det, v)
+	httpServer := &http.Server{
+		Addr:         addr,
+		Handler:      srv.Handler(),
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		logger.Info("detector service listening", "addr", addr, "vault", v != nil)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("server error", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-done
+	logger.Info("shutting down...")
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+	httpServer.Shutdown(shutdownCtx)
+	logger.Info("stopped")
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/bootstrap"
+	"github.com/vurakit/agentveil/internal/compliance"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/version"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// evidenceSample is the synthetic text of the anonymization round trip
+const evidenceSample = "Khách hàng Nguyễn Văn An, CCCD 079203001234, SĐT 0912345678, email an.nguyen@example.com"
+
+// evidenceFile is one collected artifact
+type evidenceFile struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+	data   []byte
+}
+
+// evidenceMissing is an artifact that could not be collected
+type evidenceMissing struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// evidenceManifest lists the files of an evidence bundle with their hashes
+type evidenceManifest struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Version     string            `json:"agentveil_version"`
+	Proxy       string            `json:"proxy"`
+	Framework   string            `json:"framework"`
+	Files       []evidenceFile    `json:"files"`
+	Missing     []evidenceMissing `json:"missing,omitempty"`
+}
+
+func (m *evidenceManifest) add(name, source string, data []byte) {
+	sum := sha256.Sum256(data)
+	m.Files = append(m.Files, evidenceFile{
+		Name: name, Source: source, SHA256: hex.EncodeToString(sum[:]), Size: len(data), data: data,
+	})
+}
+
+func (m *evidenceManifest) addJSON(name, source string, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		m.miss(name, err.Error())
+		return
+	}
+	m.add(name, source, append(data, '\n'))
+}
+
+func (m *evidenceManifest) miss(name, reason string) {
+	m.Missing = append(m.Missing, evidenceMissing{Name: name, Reason: reason})
+}
+
+// complianceEvidenceCmd writes an evidence bundle for auditors
+func complianceEvidenceCmd(fs *flag.FlagSet) func([]string) error {
+	out := fs.String("out", "evidence.tar.gz", "tarball to write")
+	proxyURL := fs.String("proxy", "", "running proxy to collect from (default --proxy-url)")
+	framework := fs.String("framework", "all", "compliance framework: vietnam, eu, gdpr, all")
+	return func([]string) error {
+		if *proxyURL == "" {
+			*proxyURL = opts.proxyURL
+		}
+		m := collectEvidence(*proxyURL, os.Getenv("VEIL_API_KEY"), *framework)
+
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		hash, err := writeEvidence(f, m)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", *out, err)
+		}
+
+		fmt.Printf("Wrote %s: %d files, %d missing\n", *out, len(m.Files), len(m.Missing))
+		for _, miss := range m.Missing {
+			fmt.Printf("  - %-24s %s\n", miss.Name, miss.Reason)
+		}
+		fmt.Printf("\nManifest SHA-256: %s\n", hash)
+		return nil
+	}
+}
+
+// collectEvidence gathers artifacts from the proxy at proxyURL and the
+// local configuration. Anything that can't be collected is listed as
+// missing instead of failing the bundle.
+func collectEvidence(proxyURL, apiKey, framework string) *evidenceManifest {
+	proxyURL = strings.TrimRight(proxyURL, "/")
+	m := &evidenceManifest{
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+		Version:     version.Get().Version,
+		Proxy:       proxyURL,
+		Framework:   framework,
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	// Compliance report, on the proxy's reported posture when reachable
+	caps, capsSource := localCapabilities(), "local environment"
+	if data, reason := fetchEvidence(client, proxyURL+compliance.CapabilitiesPath, ""); reason != "" {
+		m.miss("capabilities.json", reason)
+	} else if err := json.Unmarshal(data, &caps); err != nil {
+		m.miss("capabilities.json", "invalid response: "+err.Error())
+		caps = localCapabilities()
+	} else {
+		m.add("capabilities.json", "proxy "+compliance.CapabilitiesPath, data)
+		capsSource = "proxy " + compliance.CapabilitiesPath
+	}
+	m.addJSON("compliance-report.json", "compliance check on "+capsSource, checkerFor(framework).Check(caps))
+
+	// Runtime state behind admin endpoints
+	for _, ep := range []struct{ name, path string }{
+		{"admin-status.json", "/admin/status"},
+		{"admin-providers.json", "/admin/providers"},
+	} {
+		if apiKey == "" {
+			m.miss(ep.name, "VEIL_API_KEY not set; an admin Veil key is required")
+			continue
+		}
+		if data, reason := fetchEvidence(client, proxyURL+ep.path, apiKey); reason != "" {
+			m.miss(ep.name, reason)
+		} else {
+			m.add(ep.name, "proxy "+ep.path, data)
+		}
+	}
+
+	settings, report := bootstrap.Load()
+	m.addJSON("config.json", "local environment", effectiveConfig(report))
+	m.addJSON("webhooks.json", "local environment", webhookDestinations(settings))
+	m.addJSON("detector-patterns.json", "agentveil "+version.Get().Version, detectorPatterns())
+	m.addJSON("anonymization-roundtrip.json", "local detector on synthetic data", anonymizationRoundTrip())
+	m.miss("audit-log-head.json", "no hash-chained audit log in this version; access log lines are not chained")
+	return m
+}
+
+// fetchEvidence GETs url, returning the body or why it couldn't be fetched
+func fetchEvidence(client *http.Client, url, apiKey string) ([]byte, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if apiKey != "" {
+		req.Header.Set("X-Veil-Key", apiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Sprintf("proxy unreachable: %v", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, "endpoint disabled (404 Not Found)"
+	case resp.StatusCode != http.StatusOK:
+		return nil, "request failed: " + resp.Status
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err.Error()
+	}
+	return data, ""
+}
+
+// effectiveConfig lists the component checks and the environment they
+// were built from, with secrets masked
+func effectiveConfig(report bootstrap.Report) map[string]any {
+	components := make([]map[string]string, len(report))
+	for i, res := range report {
+		c := map[string]string{"component": res.Component, "status": "ok", "detail": res.Detail}
+		if res.Err != nil {
+			c["status"], c["detail"] = "error", res.Err.Error()
+		}
+		components[i] = c
+	}
+
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if !isConfigEnv(k) {
+			continue
+		}
+		env[k] = maskConfigValue(k, v)
+	}
+	return map[string]any{"components": components, "environment": env}
+}
+
+func isConfigEnv(name string) bool {
+	for _, prefix := range []string{"VEIL_", "REDIS_", "TLS_"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	switch name {
+	case "TARGET_URL", "LISTEN_ADDR", "LOG_LEVEL", "DETECTOR_ADDR":
+		return true
+	}
+	return false
+}
+
+// maskConfigValue masks keys, secrets and webhook URLs, and the password
+// of any other URL
+func maskConfigValue(name, value string) string {
+	upper := strings.ToUpper(name)
+	for _, s := range []string{"KEY", "SECRET", "TOKEN", "PASSWORD", "WEBHOOK_URL"} {
+		if strings.Contains(upper, s) {
+			return maskIfSet(name)
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return value
+}
+
+// webhookDestinations lists where events are sent, by host only since
+// chat webhook URLs embed their credentials
+func webhookDestinations(s *bootstrap.Settings) []map[string]any {
+	dests := []map[string]any{}
+	if s == nil || s.Webhook == nil {
+		return dests
+	}
+	if c := s.Webhook.Slack; c != nil {
+		dests = append(dests, map[string]any{"name": "slack", "host": urlHost(c.WebhookURL), "alerting": c.Alerting})
+	}
+	if c := s.Webhook.Discord; c != nil {
+		dests = append(dests, map[string]any{"name": "discord", "host": urlHost(c.WebhookURL), "alerting": c.Alerting})
+	}
+	for _, d := range s.Webhook.Destinations {
+		dests = append(dests, map[string]any{
+			"name": d.Name, "host": urlHost(d.URL), "events": d.Events,
+			"signed": d.Secret != "", "enabled": d.Enabled, "alerting": d.Alerting,
+		})
+	}
+	return dests
+}
+
+func urlHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// detectorPatterns lists the built-in patterns with a hash of each regex,
+// so a later bundle shows which patterns changed
+func detectorPatterns() []map[string]string {
+	var out []map[string]string
+	for _, group := range []struct {
+		name     string
+		patterns []pii.Pattern
+	}{
+		{"vietnam", pii.VietnamPatterns()},
+		{"international", pii.InternationalPatterns()},
+		{"secrets", pii.SecretPatterns()},
+	} {
+		for _, p := range group.patterns {
+			sum := sha256.Sum256([]byte(p.Regex.String()))
+			out = append(out, map[string]string{
+				"group":    group.name,
+				"category": string(p.Category),
+				"label":    p.Label,
+				"regex":    p.Regex.String(),
+				"sha256":   hex.EncodeToString(sum[:]),
+			})
+		}
+	}
+	return out
+}
+
+// anonymizationRoundTrip anonymizes and rehydrates synthetic data
+func anonymizationRoundTrip() map[string]any {
+	anonymized, mapping := detector.New().Anonymize(evidenceSample)
+	pairs := make([]string, 0, 2*len(mapping))
+	tokens := make([]string, 0, len(mapping))
+	for token, original := range mapping {
+		pairs = append(pairs, token, original)
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	rehydrated := strings.NewReplacer(pairs...).Replace(anonymized)
+	return map[string]any{
+		"input":      evidenceSample,
+		"anonymized": anonymized,
+		"tokens":     tokens,
+		"rehydrated": rehydrated,
+		"round_trip": rehydrated == evidenceSample,
+	}
+}
+
+// writeEvidence writes the files and manifest.json as a gzipped tarball
+// and returns the SHA-256 of the manifest
+func writeEvidence(w io.Writer, m *evidenceManifest) (string, error) {
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	manifest = append(manifest, '\n')
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	files := append(m.Files, evidenceFile{Name: "manifest.json", data: manifest})
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.Name, Mode: 0o644, Size: int64(len(f.data)), ModTime: m.GeneratedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(manifest)
+	return hex.EncodeToString(sum[:]), nil
+}
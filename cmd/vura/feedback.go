@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/feedback"
+)
+
+// feedbackFPCmd reports a detection from scan output to a running proxy
+// as a false positive
+func feedbackFPCmd(fs *flag.FlagSet) func([]string) error {
+	return feedbackCmd(fs, feedback.FalsePositive)
+}
+
+// feedbackTPCmd confirms a detection from scan output as real PII
+func feedbackTPCmd(fs *flag.FlagSet) func([]string) error {
+	return feedbackCmd(fs, feedback.TruePositive)
+}
+
+func feedbackCmd(fs *flag.FlagSet, verdict string) func([]string) error {
+	category := fs.String("category", "", "Category of the detection, e.g. EMAIL (required)")
+	source := fs.String("source", "", "Source of the pattern from scan --json: builtin, bundle or custom")
+	rule := fs.String("rule", "", "Rule of the pattern from scan --json")
+	note := fs.String("note", "", "Why; never paste the value itself")
+	return func(args []string) error {
+		if len(args) != 1 || *category == "" {
+			return errUsage
+		}
+		report := feedback.DetectionReport{
+			EntityID: strings.ToLower(args[0]),
+			Category: strings.ToUpper(*category),
+			Verdict:  verdict,
+			Note:     *note,
+			Source:   *source,
+			Rule:     *rule,
+		}
+		if err := report.Validate(); err != nil {
+			return err
+		}
+		receipt, err := sendFeedback(opts.proxyURL, os.Getenv("VEIL_API_KEY"), report)
+		if err != nil {
+			return err
+		}
+		switch {
+		case receipt.Suppressed:
+			info("Reported %s as a false positive; the proxy no longer flags it\n", report.EntityID)
+		case receipt.Reports > 0:
+			info("Reported %s as a false positive (%d independent reports)\n", report.EntityID, receipt.Reports)
+		default:
+			info("Reported %s as a %s\n", report.EntityID, strings.ReplaceAll(verdict, "_", " "))
+		}
+		return nil
+	}
+}
+
+// sendFeedback posts report to POST /feedback/detection
+func sendFeedback(proxyURL, apiKey string, report feedback.DetectionReport) (feedback.Receipt, error) {
+	var receipt feedback.Receipt
+	if apiKey == "" {
+		return receipt, fmt.Errorf("VEIL_API_KEY must be a Veil key")
+	}
+	body, _ := json.Marshal(report)
+	req, err := http.NewRequest(http.MethodPost, proxyURL+"/feedback/detection", bytes.NewReader(body))
+	if err != nil {
+		return receipt, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Veil-Key", apiKey)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return receipt, fmt.Errorf("proxy unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return receipt, fmt.Errorf("the proxy does not accept feedback: set VEIL_FEEDBACK=true")
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return receipt, fmt.Errorf("POST /feedback/detection failed: %s: %s", resp.Status, msg)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&receipt); err != nil {
+		return receipt, fmt.Errorf("invalid response: %w", err)
+	}
+	return receipt, nil
+}
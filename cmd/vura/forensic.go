@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/vurakit/agentveil/internal/forensic"
+)
+
+// forensicReplayCmd reconstructs the body the upstream received from the
+// original request body and its transformation record
+func forensicReplayCmd(fs *flag.FlagSet) func([]string) error {
+	recordPath := fs.String("record", "", "Transformation record: a forensic access log line or its transform object")
+	inputPath := fs.String("input", "", "Original request body as the client sent it")
+	return func(args []string) error {
+		if *recordPath == "" || *inputPath == "" || len(args) != 0 {
+			return errUsage
+		}
+		rec, err := readRecord(*recordPath)
+		if err != nil {
+			return err
+		}
+		input, err := os.ReadFile(*inputPath)
+		if err != nil {
+			return fmt.Errorf("reading input: %w", err)
+		}
+
+		out, err := forensic.Replay(input, rec)
+		if errors.Is(err, forensic.ErrInputMismatch) {
+			fmt.Fprintf(os.Stderr, "Input sha256 %s does not match the recorded %s\n", forensic.Hash(input), rec.BodySHA256Before)
+			exit(1)
+		}
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(out)
+		info("\nVerified: input sha256 %s, replayed sha256 %s, %d edits\n", rec.BodySHA256Before, rec.BodySHA256After, len(rec.Edits))
+		return nil
+	}
+}
+
+// readRecord reads a record file: a whole access log entry, whose record
+// is under "transform", or the record alone
+func readRecord(path string) (*forensic.Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading record: %w", err)
+	}
+	var entry struct {
+		Transform *forensic.Record `json:"transform"`
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("parsing record: %w", err)
+	}
+	if entry.Transform != nil {
+		return entry.Transform, nil
+	}
+	var rec forensic.Record
+	json.Unmarshal(data, &rec)
+	if rec.BodySHA256Before == "" {
+		return nil, fmt.Errorf("%s holds no request body record", path)
+	}
+	return &rec, nil
+}
@@ -3,87 +3,308 @@
 // Commands:
 //
 //	agentveil proxy start       Start the Agent Veil proxy server
+//	agentveil proxy validate    Validate proxy configuration
+//	agentveil demo              Run the proxy offline against a fake LLM
+//	agentveil detector serve    Run the standalone detector service
 //	agentveil wrap -- <cmd>     Wrap any AI tool to route through Agent Veil
+//	agentveil mcp serve         Serve the MCP tools (--stdio for MCP clients)
 //	agentveil audit <file>      Audit a skill.md file for security issues
+//	agentveil skill sign <file> Sign an audited skill; skill verify checks it
+//	agentveil corpus run <dir>  Check a regression corpus still gets caught
 //	agentveil scan <text>       Scan text for PII
+//	agentveil openapi           Print the OpenAPI document of the proxy API
 //	agentveil config show       Show current configuration
+//	agentveil config validate   Check a veil.yaml proxy config file
 //	agentveil compliance check  Check compliance status
+//	agentveil audit-log tail    Pretty-print the last access log entries
+//	agentveil completion bash   Print a shell completion script
+//
+// Run `agentveil help` for every command and `agentveil help <command>` for
+// its flags; both are generated from the flag definitions in commands.
 package main
 
 import (
-	"fmt"
 	"os"
 )
 
-const version = "0.1.0"
-
-func main() {
-	if len(os.Args) < 2 {
-		printUsage()
-		os.Exit(0)
-	}
-
-	cmd := os.Args[1]
-	args := os.Args[2:]
+// commands are the agentveil subcommands in help order
+var commands []*command
 
-	switch cmd {
-	case "proxy":
-		handleProxy(args)
-	case "wrap":
-		handleWrap(args)
-	case "audit":
-		handleAudit(args)
-	case "scan":
-		handleScan(args)
-	case "config":
-		handleConfig(args)
-	case "compliance":
-		handleCompliance(args)
-	case "setup":
-		handleSetup(args)
-	case "version", "--version", "-v":
-		fmt.Printf("agentveil version %s\n", version)
-	case "help", "--help", "-h":
-		printUsage()
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", cmd)
-		printUsage()
-		os.Exit(1)
+func init() {
+	commands = []*command{
+		{
+			name:    "proxy start",
+			summary: "Start the Agent Veil proxy server (--dry-run to only validate)",
+			examples: [][2]string{
+				{"proxy start", "Start proxy on :8080"},
+			},
+			define: proxyStartCmd,
+		},
+		{
+			name:    "proxy validate",
+			summary: "Validate configuration and exit (--check-redis to ping Redis)",
+			examples: [][2]string{
+				{"proxy validate", "Check configuration before deploying"},
+			},
+			define: proxyValidateCmd,
+		},
+		{
+			name:    "demo",
+			summary: "Run the proxy offline against a fake LLM with scripted traffic",
+			examples: [][2]string{
+				{"demo", "Show what the proxy catches, then list the reports"},
+				{"demo --out ./demo --keep", "Keep the demo proxy running to try it by hand"},
+			},
+			define: demoCmd,
+		},
+		{
+			name:    "detector serve",
+			summary: "Run detection as a standalone service",
+			define:  detectorServeCmd,
+		},
+		{
+			name:        "wrap",
+			args:        "-- <command> [args...]",
+			summary:     "Wrap any AI tool to route through Agent Veil proxy",
+			passthrough: true,
+			examples: [][2]string{
+				{"wrap -- claude-code", "Wrap Claude Code through Agent Veil"},
+				{"wrap -- cursor", "Wrap Cursor through Agent Veil"},
+				{"wrap --with-mcp -- claude-code", "Also expose scan/audit tools over MCP"},
+				{"wrap -- aider --model gpt-4", ""},
+			},
+			define: wrapCmd,
+		},
+		{
+			name:    "mcp serve",
+			summary: "Serve the MCP tools (--stdio as launched by MCP clients)",
+			define:  mcpServeCmd,
+		},
+		{
+			name:    "mcp install",
+			args:    "[claude|cursor]",
+			choices: []string{"claude", "cursor"},
+			summary: "Register the MCP server with claude (default) or cursor",
+			examples: [][2]string{
+				{"mcp install cursor", "Register the MCP tools in ~/.cursor/mcp.json"},
+			},
+			define: mcpRegisterCmd(true),
+		},
+		{
+			name:    "mcp uninstall",
+			args:    "[claude|cursor]",
+			choices: []string{"claude", "cursor"},
+			summary: "Remove the MCP server registration",
+			define:  mcpRegisterCmd(false),
+		},
+		{
+			name:    "audit",
+			args:    "<file|dir|->",
+			summary: "Audit a skill.md file for security compliance (--project for a directory)",
+			examples: [][2]string{
+				{"audit skill.md", "Audit a skill file"},
+				{"audit - < skill.md", "Audit from stdin"},
+				{"audit ./my-skill --project", "Audit a skill's files together, chains across files included"},
+			},
+			define: auditCmd,
+		},
+		{
+			name:    "audit diff",
+			args:    "<old.md> <new.md>",
+			summary: "Show the risk delta between two skill versions",
+			examples: [][2]string{
+				{"audit diff old.md new.md", "Show the risk delta between two skill versions"},
+				{"audit diff --old-git HEAD~1 --path skill.md", "Compare against a git revision"},
+			},
+			define: auditDiffCmd,
+		},
+		{
+			name:    "audit rules",
+			summary: "List the audit rules and validate custom rule examples",
+			examples: [][2]string{
+				{"audit rules --rules custom.yaml", "List audit rules and validate custom rule examples"},
+			},
+			define: auditRulesCmd,
+		},
+		{
+			name:    "skill keygen",
+			summary: "Generate an Ed25519 key pair for signing audited skills",
+			examples: [][2]string{
+				{"skill keygen --out team", "Write team.key and team.pub"},
+			},
+			define: skillKeygenCmd,
+		},
+		{
+			name:    "skill sign",
+			args:    "<file>",
+			summary: "Audit a skill and sign it if its risk level is at most --max-risk; exits 2 when too risky",
+			examples: [][2]string{
+				{"skill sign skill.md --key team.key", "Write skill.md.sig"},
+				{"skill sign skill.md --key team.key --embed --max-age 720h", "Embed a signature valid for 30 days"},
+			},
+			define: skillSignCmd,
+		},
+		{
+			name:    "skill verify",
+			args:    "<file>",
+			summary: "Verify a skill's signature and risk level; exits 3 when tampered or unsigned, 2 when it fails the policy",
+			examples: [][2]string{
+				{"skill verify skill.md --key team.pub", "Check skill.md before an agent loads it"},
+			},
+			define: skillVerifyCmd,
+		},
+		{
+			name:    "corpus run",
+			args:    "<dir>",
+			summary: "Run a YAML regression corpus through detector, auditor and prompt guard; exits 1 when a case no longer passes",
+			examples: [][2]string{
+				{"corpus run testdata/corpus", "Check known-bad samples are still caught"},
+			},
+			define: corpusRunCmd,
+		},
+		{
+			name:    "scan",
+			args:    "<text|file...|->",
+			summary: "Scan text for PII, or anonymize files with --anonymize",
+			examples: [][2]string{
+				{`scan "CCCD: 012345678901"`, "Scan text for PII"},
+				{"scan --json -", "Scan from stdin"},
+				{`scan --json --categories EMAIL "..."`, "Only EMAIL, JSON with anonymized text"},
+				{"scan --secret-action block - < prompt.txt", "Check what the proxy would reject"},
+				{"scan --anonymize config.env", "Print config.env with PII anonymized"},
+				{"scan --anonymize --in-place --backup config.env", "Anonymize in place, keeping config.env.bak"},
+			},
+			define: scanCmd,
+		},
+		{
+			name:    "openapi",
+			summary: "Print the OpenAPI 3.1 document of the proxy's own endpoints",
+			define:  openAPICmd,
+		},
+		{
+			name:    "config show",
+			summary: "Show current configuration",
+			bare:    true,
+			define:  configShowCmd,
+		},
+		{
+			name:    "config validate",
+			args:    "<file>",
+			summary: "Check a veil.yaml proxy config file, reporting problems by line",
+			examples: [][2]string{
+				{"config validate /etc/veil/veil.yaml", "Check the file before pointing VEIL_CONFIG at it"},
+			},
+			define: configValidateCmd,
+		},
+		{
+			name:    "compliance check",
+			summary: "Check compliance against regulatory frameworks (--targets for a fleet)",
+			examples: [][2]string{
+				{"compliance check --framework vietnam", "Check Vietnam AI Law compliance"},
+				{"compliance check --targets https://veil-prod:8080,https://veil-staging:8080 --exit-threshold 80",
+					"Check deployed instances, fail below 80"},
+			},
+			define: complianceCheckCmd,
+		},
+		{
+			name:    "compliance evidence",
+			summary: "Bundle evidence artifacts for auditors into a tarball with a SHA-256 manifest",
+			examples: [][2]string{
+				{"compliance evidence --out evidence.tar.gz", "Bundle config, patterns and reports for an audit"},
+			},
+			define: complianceEvidenceCmd,
+		},
+		{
+			name:    "transcripts export",
+			summary: "Export recorded transcripts as JSONL (admin key)",
+			examples: [][2]string{
+				{"transcripts export --since 24h", "Export the last day of recorded transcripts"},
+			},
+			define: transcriptsExportCmd,
+		},
+		{
+			name:    "audit-log tail",
+			args:    "[file]",
+			summary: "Pretty-print the last entries of the access log (VEIL_ACCESS_LOG by default)",
+			examples: [][2]string{
+				{"audit-log tail --limit 50 /var/log/veil/access.log", "Show the last 50 requests and audit events"},
+			},
+			define: auditLogTailCmd,
+		},
+		{
+			name:    "forensic replay",
+			summary: "Replay a request's recorded transformation on its original body, verifying both hashes",
+			examples: [][2]string{
+				{"forensic replay --record rec.json --input original.json", "Show what the upstream received"},
+			},
+			define: forensicReplayCmd,
+		},
+		{
+			name:    "feedback fp",
+			args:    "<entity-id>",
+			summary: "Report a detection from scan as a false positive to the proxy",
+			examples: [][2]string{
+				{"feedback fp 3f9a1c0e7b2d4a61 --category EMAIL --note \"shared support inbox\"", "Report a flagged address that isn't personal"},
+			},
+			define: feedbackFPCmd,
+		},
+		{
+			name:    "feedback tp",
+			args:    "<entity-id>",
+			summary: "Confirm a detection from scan as real PII, lifting any suppression",
+			define:  feedbackTPCmd,
+		},
+		{
+			name:    "sessions list",
+			summary: "List vault sessions with entry counts and TTLs (admin key)",
+			examples: [][2]string{
+				{"sessions list --all", "List every vault session"},
+			},
+			define: sessionsListCmd,
+		},
+		{
+			name:    "sessions purge",
+			args:    "<session-id>",
+			summary: "Delete a vault session's mappings (admin key)",
+			define:  sessionsPurgeCmd,
+		},
+		{
+			name:    "setup",
+			args:    "[undo|status|gen-ca]",
+			choices: []string{"undo", "status", "gen-ca"},
+			summary: "One-command setup (build, start, configure shell), or point the shell at a shared proxy with --remote",
+			examples: [][2]string{
+				{"setup", "Start the proxy with docker compose and configure the shell"},
+				{"setup --remote https://veil.internal.corp:8443 --api-key -", "Use a shared proxy, key read from stdin"},
+				{"setup --status", "Check setup status"},
+				{"setup --undo", "Uninstall Agent Veil (or remove a remote setup)"},
+			},
+			define: setupCmd,
+		},
+		{
+			name:    "completion",
+			args:    "<bash|zsh|fish>",
+			choices: []string{"bash", "zsh", "fish"},
+			summary: "Print a shell completion script",
+			examples: [][2]string{
+				{"completion bash > /etc/bash_completion.d/agentveil", "Install bash completions"},
+			},
+			define: completionCmd,
+		},
+		{
+			name:    "version",
+			summary: "Show version, commit and build date (--json for all build info)",
+			define:  versionCmd,
+		},
+		{
+			name:    "help",
+			args:    "[command]",
+			summary: "Show this help, or a command's flags",
+			define:  helpCmd,
+		},
 	}
 }
 
-func printUsage() {
-	fmt.Println(`agentveil — Security Proxy for AI Agents
-
-Usage:
-  agentveil <command> [arguments]
-
-Commands:
-  proxy start            Start the Agent Veil proxy server
-  wrap -- <cmd>          Wrap any AI tool to route through Agent Veil proxy
-  audit <file|->         Audit a skill.md file for security compliance
-  scan <text>            Scan text for PII (Personally Identifiable Information)
-  config show            Show current configuration
-  compliance check       Check compliance against regulatory frameworks
-  setup                  One-command setup (build, start, configure shell)
-  setup --undo           Uninstall Agent Veil
-  setup --status         Check setup status
-  version                Show version
-  help                   Show this help
-
-Examples:
-  agentveil proxy start                           Start proxy on :8080
-  agentveil wrap -- claude-code                   Wrap Claude Code through Agent Veil
-  agentveil wrap -- cursor                        Wrap Cursor through Agent Veil
-  agentveil audit skill.md                        Audit a skill file
-  agentveil scan "CCCD: 012345678901"             Scan text for PII
-  echo "text" | agentveil scan -                  Scan from stdin
-  agentveil compliance check --framework vietnam  Check Vietnam AI Law compliance
-
-Environment:
-  VEIL_PROXY_URL         Proxy URL (default: http://localhost:8080)
-  VEIL_API_KEY           API key for authentication
-  VEIL_ENCRYPTION_KEY    32-byte hex key for vault encryption
-  TARGET_URL             Upstream LLM API (default: https://api.openai.com)
-  REDIS_ADDR             Redis address (default: localhost:6379)`)
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/vurakit/agentveil/internal/auditor"
+	"github.com/vurakit/agentveil/pkg/veilsig"
+	"github.com/vurakit/agentveil/sdk/mcp"
+)
+
+// mcpServeCmd serves the MCP tools, over stdio as launched by MCP clients
+// or over HTTP
+func mcpServeCmd(fs *flag.FlagSet) func([]string) error {
+	stdio := fs.Bool("stdio", false, "speak MCP on stdin/stdout (how MCP clients launch the server)")
+	addr := fs.String("addr", ":9090", "HTTP listen address when not using --stdio")
+	signingKey := fs.String("signing-key", "", "Ed25519 private key `file` to sign the results of veil_audit_skill")
+	maxRisk := fs.String("max-risk", "limited", "highest risk level signed with --signing-key")
+	return func([]string) error {
+		cfg := mcp.Config{ProxyURL: opts.proxyURL}
+		if *signingKey != "" {
+			data, err := os.ReadFile(*signingKey)
+			if err != nil {
+				return fmt.Errorf("reading signing key: %w", err)
+			}
+			if cfg.SigningKey, err = veilsig.ParsePrivateKey(data); err != nil {
+				return err
+			}
+			if cfg.MaxRisk, err = auditor.ParseRiskLevel(*maxRisk); err != nil {
+				return fmt.Errorf("--max-risk: %w", err)
+			}
+		}
+		server := mcp.NewServer(cfg)
+		if *stdio {
+			// stdout carries the protocol; anything else goes to stderr
+			return server.ServeStdio(os.Stdin, os.Stdout)
+		}
+		info("🛡️  Agent Veil MCP server on %s\n", *addr)
+		return http.ListenAndServe(*addr, server.Handler())
+	}
+}
+
+// mcpRegisterCmd manages the registration of the MCP server in MCP
+// clients: mcp install, or mcp uninstall when install is false. Its
+// --config names the client's config file and shadows the global one.
+func mcpRegisterCmd(install bool) func(fs *flag.FlagSet) func([]string) error {
+	return func(fs *flag.FlagSet) func([]string) error {
+		configPath := fs.String("config", "", "client config `file` (default: the client's user config)")
+		return func(args []string) error {
+			name := string(mcp.ClientClaude)
+			switch len(args) {
+			case 0:
+			case 1:
+				name = args[0]
+			default:
+				return errUsage
+			}
+			client, err := mcp.ParseClient(name)
+			if err != nil {
+				return err
+			}
+			if install {
+				return mcpInstall(client, *configPath)
+			}
+			return mcpUninstall(client, *configPath)
+		}
+	}
+}
+
+// mcpConfigPath returns path, or client's user config when path is empty
+func mcpConfigPath(client mcp.Client, path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return client.ConfigPath(home), nil
+}
+
+// mcpRegistration points a client at this binary's stdio server. The binary
+// is referenced by absolute path because GUI clients often lack the shell's
+// PATH.
+func mcpRegistration() mcp.Registration {
+	command := "agentveil"
+	if exe, err := os.Executable(); err == nil {
+		command = exe
+	}
+	return mcp.Registration{
+		Command: command,
+		Args:    []string{"mcp", "serve", "--stdio"},
+		Env:     map[string]string{"VEIL_PROXY_URL": opts.proxyURL},
+	}
+}
+
+func mcpInstall(client mcp.Client, path string) error {
+	path, err := mcpConfigPath(client, path)
+	if err != nil {
+		return err
+	}
+	changed, err := mcp.Install(client, path, mcpRegistration())
+	if err != nil {
+		return err
+	}
+	if changed {
+		info("🛡️  Agent Veil: registered MCP server %q in %s\n", mcp.ServerName, path)
+	} else {
+		info("🛡️  Agent Veil: MCP server already registered in %s\n", path)
+	}
+	return nil
+}
+
+func mcpUninstall(client mcp.Client, path string) error {
+	path, err := mcpConfigPath(client, path)
+	if err != nil {
+		return err
+	}
+	removed, err := mcp.Uninstall(path)
+	if err != nil {
+		return err
+	}
+	if removed {
+		info("🛡️  Agent Veil: removed MCP server %q from %s (backup: %s.bak)\n", mcp.ServerName, path, path)
+	} else {
+		info("🛡️  Agent Veil: no MCP server registered in %s\n", path)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/vurakit/agentveil/internal/proxy"
+)
+
+// openAPICmd prints the OpenAPI document of the proxy's first-party
+// endpoints, as served at /openapi.json
+func openAPICmd(fs *flag.FlagSet) func([]string) error {
+	return func([]string) error {
+		data, err := json.MarshalIndent(proxy.OpenAPI(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+}
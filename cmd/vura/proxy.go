@@ -2,89 +2,267 @@ package main
 
 import (
 	"context"
-	"encoding/hex"
-	"fmt"
+	"flag"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/bootstrap"
+	"github.com/vurakit/agentveil/internal/breakglass"
 	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/guardrail"
 	"github.com/vurakit/agentveil/internal/logging"
+	"github.com/vurakit/agentveil/internal/metrics"
+	"github.com/vurakit/agentveil/internal/overload"
 	"github.com/vurakit/agentveil/internal/promptguard"
 	"github.com/vurakit/agentveil/internal/proxy"
 	"github.com/vurakit/agentveil/internal/ratelimit"
+	"github.com/vurakit/agentveil/internal/redisconn"
+	"github.com/vurakit/agentveil/internal/session"
 	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/version"
 )
 
-func handleProxy(args []string) {
-	if len(args) == 0 || args[0] != "start" {
-		fmt.Println("Usage: agentveil proxy start")
-		return
+// proxyStartCmd defines proxy start
+func proxyStartCmd(fs *flag.FlagSet) func([]string) error {
+	dryRun := fs.Bool("dry-run", false, "validate configuration and exit without binding ports")
+	checkRedis := fs.Bool("check-redis", false, "also ping Redis while validating")
+	return func([]string) error {
+		if *dryRun {
+			return validateProxy(*checkRedis)
+		}
+		startProxy()
+		return nil
+	}
+}
+
+// proxyValidateCmd defines proxy validate
+func proxyValidateCmd(fs *flag.FlagSet) func([]string) error {
+	checkRedis := fs.Bool("check-redis", false, "also ping Redis while validating")
+	return func([]string) error { return validateProxy(*checkRedis) }
+}
+
+func validateProxy(checkRedis bool) error {
+	if !bootstrap.Validate(os.Stdout, checkRedis) {
+		exit(1)
 	}
+	return nil
+}
 
-	logger := logging.Setup(envOr("LOG_LEVEL", "info"), os.Stdout)
-	logger.Info("starting Agent Veil proxy", "version", version)
+func startProxy() {
+	logger := logging.Setup(envOr("LOG_LEVEL", "info"), os.Stdout, envOr("VEIL_LOG_REDACT", "true") != "false")
+	logger.Info("starting Agent Veil proxy", "version", version.Get().String())
 
-	targetURL := envOr("TARGET_URL", "https://api.openai.com")
-	listenAddr := envOr("LISTEN_ADDR", ":8080")
-	redisAddr := envOr("REDIS_ADDR", "localhost:6379")
-	redisPassword := envOr("REDIS_PASSWORD", "")
-	encryptionKey := envOr("VEIL_ENCRYPTION_KEY", "")
+	settings, report := bootstrap.Load()
+	if !report.OK() {
+		for _, res := range report.Errors() {
+			logger.Error("invalid configuration", "component", res.Component, "error", res.Err)
+		}
+		exit(1)
+	}
+	for _, res := range report {
+		for _, w := range res.Warnings {
+			logger.Warn("configuration warning", "component", res.Component, "warning", w)
+		}
+	}
+	targetURL := settings.TargetURL
+	listenAddr := settings.ListenAddr
 
 	// Redis
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: redisPassword,
-	})
+	redisCfg := settings.Redis
+	redisClient, err := redisconn.New(redisCfg)
+	if err != nil {
+		logger.Error("failed to configure Redis client", "error", err)
+		exit(1)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	redisOK := false
 	if err := redisClient.Ping(ctx).Err(); err != nil {
 		logger.Warn("Redis not available", "error", err)
 	} else {
-		logger.Info("Redis connected", "addr", redisAddr)
+		redisOK = true
+		logger.Info("Redis connected", "mode", redisCfg.Mode(), "tls", redisCfg.TLS || redisCfg.TLSCA != "")
 	}
 
 	// Vault
 	v := vault.NewWithClient(redisClient)
-	if encryptionKey != "" {
-		keyBytes, err := hex.DecodeString(encryptionKey)
-		if err != nil || len(keyBytes) != 32 {
-			logger.Error("VEIL_ENCRYPTION_KEY must be 64 hex chars")
-			os.Exit(1)
-		}
-		enc, err := vault.NewEncryptor(keyBytes)
+	v.SetTTL(settings.VaultTTL)
+	if settings.EncryptionKey != nil {
+		enc, err := vault.NewEncryptor(settings.EncryptionKey)
 		if err != nil {
 			logger.Error("encryptor error", "error", err)
-			os.Exit(1)
+			exit(1)
 		}
 		v.SetEncryptor(enc)
 		logger.Info("vault encryption enabled")
 	}
+	if settings.PlaintextVault {
+		v.SetPlaintextOverride(true)
+		logger.Warn("VAULT ENCRYPTION DISABLED: PII originals are stored unencrypted on a Redis on another host; set VEIL_ENCRYPTION_KEY",
+			"override", "VEIL_ALLOW_PLAINTEXT_VAULT")
+	}
+	// Catch a wrong key or an unwritable Redis before traffic arrives
+	if redisOK {
+		if err := v.SelfTest(ctx); err != nil {
+			logger.Error("vault self-test failed", "error", err)
+			exit(1)
+		}
+	}
 
 	// Components
-	det := detector.New()
-	authMgr := auth.NewManager(redisClient)
-	rl := ratelimit.New(ratelimit.DefaultConfig())
+	detCfg := detector.DefaultConfig()
+	detCfg.Tiers = settings.DetectorTiers
+	detCfg.Profiles = settings.DetectorProfiles
+	detCfg.Pseudonyms = settings.Pseudonyms
+	detCfg.Secrets = settings.SecretActions
+	detCfg.Policy = settings.PIIPolicy
+	det := detector.NewWithConfig(detCfg)
+	var registry *metrics.Registry
+	if settings.Metrics {
+		registry = metrics.NewRegistry()
+		det.SetRecorder(registry)
+	}
+	var authOpts []auth.ManagerOption
+	if len(settings.AuthKeyLocations) > 0 {
+		authOpts = append(authOpts, auth.WithKeyLocations(settings.AuthKeyLocations...))
+	}
+	authMgr := auth.NewManager(redisClient, authOpts...)
+	rlCfg := ratelimit.DefaultConfig()
+	rlCfg.RequestsPerMinute = settings.RateLimit
+	rlCfg.Exempt = settings.RateLimitExempt
+	if settings.RateLimitRedis && redisOK {
+		rlCfg.Backend = ratelimit.NewRedisBackend(redisClient)
+	}
+	rl := ratelimit.New(rlCfg)
 	defer rl.Close()
-	pg := promptguard.New()
+	if registry != nil {
+		rl.OnLimit(func(rej ratelimit.Rejection) { registry.RateLimited(rej.Limiter) })
+	}
+	logger.Info("rate limit exemptions", "exempt", rlCfg.Exempt.String())
+	keyCfg := ratelimit.KeyConfig(settings.KeyRateLimit, settings.KeyRateBurst)
+	keyCfg.Backend = rlCfg.Backend
+	keyLimit := ratelimit.New(keyCfg)
+	if registry != nil {
+		keyLimit.OnLimit(func(rej ratelimit.Rejection) { registry.RateLimited(rej.Limiter) })
+	}
+	var breakGlass *breakglass.Switch
+	if settings.BreakGlass != nil {
+		breakGlass = breakglass.New(*settings.BreakGlass, nil, nil)
+		defer breakGlass.Close()
+	}
+	var pg *promptguard.Guard
+	if cfg := settings.PromptGuard; cfg != nil {
+		var pgOpts []promptguard.Option
+		if cfg.Sessions {
+			// Accumulate low-threat messages per session to catch gradual jailbreaks
+			pgOpts = append(pgOpts, promptguard.WithSessionTracking(promptguard.DefaultSessionConfig()))
+			if redisOK {
+				pgOpts = append(pgOpts, promptguard.WithSessionStore(promptguard.NewRedisSessionStore(redisClient)))
+			}
+		}
+		if cfg.MaxScanBytes > 0 {
+			pgOpts = append(pgOpts, promptguard.WithMaxScanBytes(cfg.MaxScanBytes))
+		}
+		if breakGlass != nil {
+			pgOpts = append(pgOpts, promptguard.WithBreakGlass(breakGlass))
+		}
+		pgOpts = append(pgOpts, promptguard.WithLang(settings.Lang))
+		if registry != nil {
+			pgOpts = append(pgOpts, promptguard.WithRecorder(registry))
+		}
+		pg = promptguard.New(pgOpts...)
+	}
+	var guard *guardrail.Guardrail
+	if settings.Guardrail != nil {
+		guard = guardrail.New(*settings.Guardrail, guardrail.WithDetector(det))
+		guard.SetLang(settings.Lang)
+		guard.SetExemptions(settings.RateLimitExempt)
+		guard.SetTokenizers(settings.Tokenizers)
+		if breakGlass != nil {
+			guard.SetBreakGlass(breakGlass)
+		}
+		if registry != nil {
+			guard.SetRecorder(registry)
+			if lim := guard.RateLimiter(); lim != nil {
+				lim.OnLimit(func(rej ratelimit.Rejection) { registry.RateLimited(rej.Limiter) })
+			}
+		}
+		logger.Info("output guardrails enabled", "max_output_tokens", settings.Guardrail.MaxOutputTokens)
+	}
+
+	cfg := proxy.Config{
+		TargetURL:         targetURL,
+		GeminiTargetURL:   settings.GeminiTargetURL,
+		DefaultRole:       settings.DefaultRole,
+		SSEHeartbeat:      settings.SSEHeartbeat,
+		SigningKey:        settings.SigningKey,
+		DetectorAddr:      settings.DetectorAddr,
+		Headers:           settings.Headers,
+		Fields:            settings.Fields,
+		BinaryMinLength:   settings.BinaryMinLength,
+		BlockSecrets:      settings.SecretActions.Blocks(),
+		MaxFileSize:       settings.MaxFileSize,
+		CountTokens:       settings.CountTokens,
+		UpstreamUserAgent: settings.Upstream.UserAgent,
+		Lang:              settings.Lang,
+		FailureMode:       settings.FailureMode,
+		MetricsRequireKey: settings.MetricsAuth,
+	}
+	if cfg.SigningKey != nil {
+		logger.Info("upstream request signing enabled")
+	}
 
-	srv, err := proxy.New(
-		proxy.Config{TargetURL: targetURL},
-		det, v,
+	opts := []proxy.Option{
 		proxy.WithAuth(authMgr),
-		proxy.WithPromptGuard(pg),
-	)
+		proxy.WithKeyRateLimit(keyLimit),
+		proxy.WithSessionBinding(proxy.SessionBinding{Disabled: !settings.SessionBinding}),
+	}
+	if pg != nil {
+		opts = append(opts, proxy.WithPromptGuard(pg))
+	}
+	if breakGlass != nil {
+		opts = append(opts, proxy.WithBreakGlass(breakGlass))
+	}
+	if registry != nil {
+		opts = append(opts, proxy.WithMetrics(registry))
+	}
+	if redisOK {
+		// Ending a session also drops its canaries and threat score
+		sessCfg := session.Config{}
+		if pg != nil {
+			sessCfg.Canaries, sessCfg.Purgers = pg, []session.Purger{pg}
+		}
+		opts = append(opts, proxy.WithSessions(session.New(redisClient, v, sessCfg)))
+	}
+	var shed *overload.Limiter
+	if settings.Overload != nil {
+		shed = overload.New(*settings.Overload)
+		defer shed.Close()
+		opts = append(opts, proxy.WithOverload(shed))
+	}
+
+	srv, err := proxy.New(cfg, det, v, opts...)
 	if err != nil {
 		logger.Error("proxy create error", "error", err)
-		os.Exit(1)
+		exit(1)
 	}
 
-	handler := rl.Middleware(srv.Handler())
+	var handler http.Handler = srv.Handler()
+	if guard != nil {
+		handler = guardrail.InputMiddleware(guard)(guardrail.ResponseMiddleware(guard)(handler))
+	}
+	handler = rl.Middleware(handler)
+	if shed != nil {
+		handler = shed.Middleware(handler)
+	}
+	if registry != nil {
+		handler = registry.Middleware(handler)
+	}
 
 	httpServer := &http.Server{
 		Addr:         listenAddr,
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// sessionPage mirrors proxy.SessionList
+type sessionPage struct {
+	Sessions []struct {
+		ID         string `json:"id"`
+		Entries    int64  `json:"entries"`
+		TTLSeconds int64  `json:"ttl_seconds"`
+	} `json:"sessions"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// sessionsListCmd lists the vault sessions of a running proxy
+func sessionsListCmd(fs *flag.FlagSet) func([]string) error {
+	limit := fs.Int("limit", 100, "sessions per page")
+	cursor := fs.String("cursor", "", "continue from the cursor printed after a page")
+	all := fs.Bool("all", false, "follow cursors until every session is listed")
+	return func([]string) error {
+		return listSessions(os.Stdout, opts.proxyURL, os.Getenv("VEIL_API_KEY"), *cursor, *limit, *all)
+	}
+}
+
+// sessionsPurgeCmd deletes a vault session of a running proxy
+func sessionsPurgeCmd(fs *flag.FlagSet) func([]string) error {
+	return func(args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		erased, err := purgeSession(opts.proxyURL, os.Getenv("VEIL_API_KEY"), args[0])
+		if err != nil {
+			return err
+		}
+		if erased < 0 {
+			info("Purged session %s\n", args[0])
+		} else {
+			info("Purged session %s: %d tokens erased\n", args[0], erased)
+		}
+		return nil
+	}
+}
+
+func listSessions(out io.Writer, proxyURL, apiKey, cursor string, limit int, all bool) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SESSION\tENTRIES\tTTL")
+	for {
+		q := url.Values{"limit": {strconv.Itoa(limit)}}
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		resp, err := adminRequest(http.MethodGet, proxyURL+"/admin/sessions?"+q.Encode(), apiKey)
+		if err != nil {
+			return err
+		}
+		var page sessionPage
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("invalid response: %w", err)
+		}
+		for _, s := range page.Sessions {
+			ttl := "none"
+			if s.TTLSeconds >= 0 {
+				ttl = (time.Duration(s.TTLSeconds) * time.Second).String()
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", s.ID, s.Entries, ttl)
+		}
+		cursor = page.NextCursor
+		if cursor == "" || !all {
+			break
+		}
+	}
+	tw.Flush()
+	if cursor != "" {
+		fmt.Fprintf(out, "\nMore sessions: --cursor %s\n", cursor)
+	}
+	return nil
+}
+
+// purgeSession erases a vault session and returns the number of tokens
+// erased, -1 from proxies that answer 204 without a count
+func purgeSession(proxyURL, apiKey, id string) (int64, error) {
+	resp, err := adminRequest(http.MethodDelete, proxyURL+"/admin/sessions/"+url.PathEscape(id), apiKey)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return -1, nil
+	}
+	var erasure struct {
+		Erased int64 `json:"erased"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&erasure); err != nil {
+		return 0, fmt.Errorf("invalid response: %w", err)
+	}
+	return erasure.Erased, nil
+}
+
+// adminRequest calls an admin endpoint of the proxy and fails on any
+// status but 2xx
+func adminRequest(method, u, apiKey string) (*http.Response, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("VEIL_API_KEY must be an admin Veil key")
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Veil-Key", apiKey)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("proxy unreachable: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s failed: %s: %s", method, req.URL.Path, resp.Status, body)
+	}
+	return resp, nil
+}
+
+// beginSession opens an explicit session on the proxy for a wrapped tool
+// and returns its ID, or "" when the proxy is unreachable or too old to
+// support explicit sessions; the tool then runs with implicit sessions
+func beginSession(proxyURL, apiKey string) string {
+	req, err := http.NewRequest(http.MethodPost, proxyURL+"/v1/sessions", nil)
+	if err != nil {
+		return ""
+	}
+	if apiKey != "" {
+		req.Header.Set("X-Veil-Key", apiKey)
+	}
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	var s struct {
+		ID string `json:"id"`
+	}
+	if resp.StatusCode != http.StatusCreated || json.NewDecoder(resp.Body).Decode(&s) != nil {
+		return ""
+	}
+	return s.ID
+}
+
+// endSession ends a session begun by beginSession, purging its mappings
+// now rather than when its TTL runs out. Failures are ignored.
+func endSession(proxyURL, apiKey, id string) {
+	req, err := http.NewRequest(http.MethodDelete, proxyURL+"/v1/sessions/"+url.PathEscape(id), nil)
+	if err != nil {
+		return
+	}
+	if apiKey != "" {
+		req.Header.Set("X-Veil-Key", apiKey)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	if resp, err := client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
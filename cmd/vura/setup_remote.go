@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/auth"
+)
+
+// Setup modes recorded in the shell profile block. Blocks written before
+// remote setups existed carry no mode and are local.
+const (
+	modeLocal  = "local"
+	modeRemote = "remote"
+)
+
+// setupBlock is what the Agent Veil block in a shell profile points at
+type setupBlock struct {
+	Mode string
+	URL  string
+}
+
+// readSetupBlock parses the Agent Veil block of profile, if there is one
+func readSetupBlock(profile string) (setupBlock, bool) {
+	data, err := os.ReadFile(profile)
+	if err != nil || !strings.Contains(string(data), markerStart) {
+		return setupBlock{}, false
+	}
+	block := setupBlock{Mode: modeLocal}
+	inBlock := false
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == markerStart:
+			inBlock = true
+		case line == markerEnd:
+			inBlock = false
+		case !inBlock:
+		case strings.HasPrefix(line, "# mode:"):
+			block.Mode = strings.TrimSpace(strings.TrimPrefix(line, "# mode:"))
+		case strings.Contains(line, "ANTHROPIC_BASE_URL"):
+			// export ANTHROPIC_BASE_URL=<url> or set -gx ANTHROPIC_BASE_URL <url>
+			fields := strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '=' })
+			block.URL = fields[len(fields)-1]
+		}
+	}
+	return block, true
+}
+
+// setupConflict explains why a setup in mode at proxyURL would clash with
+// the block already in profile, or returns "" when it would not
+func setupConflict(existing setupBlock, mode, proxyURL string) string {
+	switch {
+	case existing.Mode != mode:
+		return fmt.Sprintf("the shell profile is already set up for a %s proxy (%s); a %s setup would leave tools pointing at one while the other is checked.\n"+
+			"  Run `agentveil setup --undo` first, then set up again.", existing.Mode, existing.URL, mode)
+	case mode == modeRemote && existing.URL != proxyURL:
+		return fmt.Sprintf("the shell profile already points at the remote proxy %s.\n"+
+			"  Run `agentveil setup --undo` first to switch to %s.", existing.URL, proxyURL)
+	}
+	return ""
+}
+
+// setupRemote points the shell at a shared proxy: nothing runs locally, so
+// docker is skipped. The API key is verified and kept in the OS keychain.
+func setupRemote(remote, apiKey string) {
+	proxyURL, err := parseRemoteURL(remote)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[fail] %v\n", err)
+		exit(1)
+	}
+	key := apiKey
+	if key == "-" {
+		data, _ := io.ReadAll(os.Stdin)
+		key = strings.TrimSpace(string(data))
+	}
+	if key == "" {
+		fmt.Fprintln(os.Stderr, "[fail] --api-key (or VEIL_API_KEY) is required for a remote proxy")
+		exit(1)
+	}
+
+	fmt.Print("\n=== Agent Veil Remote Setup ===\n\n")
+	profile := detectShellProfile()
+	existing, configured := readSetupBlock(profile)
+	if configured {
+		if conflict := setupConflict(existing, modeRemote, proxyURL); conflict != "" {
+			fmt.Fprintf(os.Stderr, "[fail] %s: %s\n", profile, conflict)
+			exit(1)
+		}
+	}
+	if u, _ := url.Parse(proxyURL); u.Scheme == "http" && !isLoopback(u.Hostname()) {
+		fmt.Println("[warn] The proxy is not using HTTPS; the API key and prompts cross the network unencrypted")
+	}
+
+	// 1. Verify the proxy and the key
+	client := &http.Client{Timeout: 10 * time.Second}
+	if err := checkHealth(client, proxyURL); err != nil {
+		fmt.Fprintf(os.Stderr, "[fail] %v\n", err)
+		exit(1)
+	}
+	fmt.Printf("[ok]  Proxy is healthy (%s)\n", proxyURL)
+	info, err := whoAmI(client, proxyURL, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[fail] %v\n", err)
+		exit(1)
+	}
+	fmt.Printf("[ok]  API key authenticates (id %s, role %s)\n", info.KeyID, info.Role)
+
+	// 2. Store the key
+	where, err := storeAPIKey(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[fail] Could not store the API key: %v\n", err)
+		exit(1)
+	}
+	fmt.Printf("[ok]  API key stored in %s\n", where)
+
+	// 3. Inject shell env vars
+	if configured {
+		fmt.Printf("[info] Shell env vars already in %s, skipping\n", profile)
+	} else if err := injectShellEnv(profile, proxyURL, modeRemote); err != nil {
+		fmt.Fprintf(os.Stderr, "[warn] Could not update shell profile: %v\n", err)
+	}
+
+	fmt.Printf("\n=== Agent Veil is ready! ===\n\n")
+	fmt.Printf("  AI tools will now route through %s.\n", proxyURL)
+	fmt.Printf("\n  To apply in your current terminal:\n    source %s\n\n", profile)
+	fmt.Println("  `agentveil wrap` passes the stored API key to wrapped tools.")
+	fmt.Println("    agentveil setup --status")
+	fmt.Println("\n  Undo:")
+	fmt.Println("    agentveil setup --undo")
+	fmt.Println()
+}
+
+// parseRemoteURL validates the --remote URL and strips a trailing slash
+func parseRemoteURL(raw string) (string, error) {
+	if raw == "" {
+		return "", fmt.Errorf("--remote needs the proxy URL, e.g. https://veil.internal.corp:8443")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid remote URL %q: want http(s)://host[:port]", raw)
+	}
+	return strings.TrimRight(raw, "/"), nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkHealth checks the proxy's health endpoint
+func checkHealth(client *http.Client, proxyURL string) error {
+	resp, err := client.Get(proxyURL + "/health")
+	if err != nil {
+		return fmt.Errorf("proxy unreachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy unhealthy: /health answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// whoAmI checks that apiKey authenticates with the proxy, a cheap request
+// that touches no provider
+func whoAmI(client *http.Client, proxyURL, apiKey string) (auth.KeyInfo, error) {
+	var info auth.KeyInfo
+	req, err := http.NewRequest(http.MethodGet, proxyURL+"/auth/whoami", nil)
+	if err != nil {
+		return info, err
+	}
+	req.Header.Set("X-Veil-Key", apiKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		return info, fmt.Errorf("checking the API key: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+			return info, fmt.Errorf("checking the API key: %w", err)
+		}
+		return info, nil
+	case http.StatusUnauthorized:
+		return info, fmt.Errorf("API key rejected by the proxy (invalid or revoked)")
+	case http.StatusNotFound:
+		return info, fmt.Errorf("the proxy does not serve /auth/whoami; it predates remote setups or runs without API key authentication")
+	default:
+		return info, fmt.Errorf("checking the API key: /auth/whoami answered %d", resp.StatusCode)
+	}
+}
+
+// remoteStatus is setup --status for a remote setup
+func remoteStatus(profile string, block setupBlock) {
+	fmt.Printf("[ok]  Mode:            remote (%s)\n", block.URL)
+	client := &http.Client{Timeout: 10 * time.Second}
+	if err := checkHealth(client, block.URL); err != nil {
+		fmt.Printf("[fail] Proxy:          %v\n", err)
+	} else {
+		fmt.Printf("[ok]  Proxy:           healthy (%s)\n", block.URL)
+		if key, where := loadAPIKey(); key == "" {
+			fmt.Println("[fail] API key:        not stored; run `agentveil setup --undo`, then set up again")
+		} else if info, err := whoAmI(client, block.URL, key); err != nil {
+			fmt.Printf("[fail] API key:        %v\n", err)
+		} else {
+			fmt.Printf("[ok]  API key:         authenticates (id %s, role %s, in %s)\n", info.KeyID, info.Role, where)
+		}
+	}
+	fmt.Printf("[ok]  Shell profile:   configured (%s)\n", profile)
+	if cur := os.Getenv("ANTHROPIC_BASE_URL"); cur != "" && cur != block.URL {
+		fmt.Printf("[warn] This session points at %s; run: source %s\n", cur, profile)
+	}
+}
+
+// remoteUninstall is setup --undo for a remote setup: nothing runs locally,
+// so only the profile block and the stored key are removed
+func remoteUninstall(profile string) {
+	if _, err := removeShellEnv(profile); err != nil {
+		fmt.Fprintf(os.Stderr, "[warn] %v\n", err)
+	} else {
+		fmt.Printf("[ok]  Removed env vars from %s\n", profile)
+	}
+	for _, where := range deleteAPIKey() {
+		fmt.Printf("[ok]  Removed the API key from %s\n", where)
+	}
+	fmt.Printf("\nAgent Veil remote setup removed.\n  Restart your shell or run: source %s\n", profile)
+}
+
+// ─── API key storage ──────────────────────────────────────────────
+
+// Keychain entry of the stored API key
+const (
+	keyringService = "agentveil"
+	keyringAccount = "default"
+)
+
+// keyStore keeps the API key of a remote setup
+type keyStore interface {
+	Name() string
+	Set(key string) error
+	// Get returns "" and an error when no key is stored
+	Get() (string, error)
+	Delete() error
+}
+
+// keyStores lists where the API key may be kept, most secure first. The
+// 0600 key file is the fallback when no keychain is available.
+var keyStores = func() []keyStore {
+	var stores []keyStore
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("security"); err == nil {
+			stores = append(stores, macKeychain{})
+		}
+	case "linux", "freebsd", "openbsd":
+		if _, err := exec.LookPath("secret-tool"); err == nil {
+			stores = append(stores, secretService{})
+		}
+	}
+	return append(stores, keyFile{path: defaultKeyFile()})
+}
+
+// defaultKeyFile is ~/.agentveil/api-key, next to the forward proxy's CA
+func defaultKeyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".agentveil", "api-key")
+}
+
+// storeAPIKey saves key in the first store that accepts it and names it
+func storeAPIKey(key string) (string, error) {
+	var errs []error
+	for _, s := range keyStores() {
+		if err := s.Set(key); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+			continue
+		}
+		return s.Name(), nil
+	}
+	return "", errors.Join(errs...)
+}
+
+// loadAPIKey returns the stored API key and where it was found, or "" if
+// none is stored
+func loadAPIKey() (key, where string) {
+	for _, s := range keyStores() {
+		if key, err := s.Get(); err == nil && key != "" {
+			return key, s.Name()
+		}
+	}
+	return "", ""
+}
+
+// deleteAPIKey removes the API key from every store, naming those that
+// held one
+func deleteAPIKey() []string {
+	var removed []string
+	for _, s := range keyStores() {
+		if key, err := s.Get(); err != nil || key == "" {
+			continue
+		}
+		if err := s.Delete(); err != nil {
+			fmt.Fprintf(os.Stderr, "[warn] %s: %v\n", s.Name(), err)
+			continue
+		}
+		removed = append(removed, s.Name())
+	}
+	return removed
+}
+
+// macKeychain keeps the key in the macOS login keychain
+type macKeychain struct{}
+
+func (macKeychain) Name() string { return "the macOS Keychain" }
+
+func (macKeychain) Set(key string) error {
+	// security -i reads the command from stdin, keeping the key out of argv
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %q\n", keyringService, keyringAccount, key))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (macKeychain) Get() (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", keyringAccount, "-w").Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func (macKeychain) Delete() error {
+	return exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", keyringAccount).Run()
+}
+
+// secretService keeps the key in the Secret Service (GNOME Keyring,
+// KWallet) through secret-tool
+type secretService struct{}
+
+func (secretService) Name() string { return "the Secret Service keyring" }
+
+func (secretService) Set(key string) error {
+	cmd := exec.Command("secret-tool", "store", "--label=Agent Veil API key", "service", keyringService, "account", keyringAccount)
+	cmd.Stdin = strings.NewReader(key)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (secretService) Get() (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keyringService, "account", keyringAccount).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func (secretService) Delete() error {
+	return exec.Command("secret-tool", "clear", "service", keyringService, "account", keyringAccount).Run()
+}
+
+// keyFile keeps the key in a file readable by the owner only
+type keyFile struct{ path string }
+
+func (f keyFile) Name() string { return f.path }
+
+func (f keyFile) Set(key string) error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(f.path, []byte(key+"\n"), 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(f.path, 0600)
+}
+
+func (f keyFile) Get() (string, error) {
+	data, err := os.ReadFile(f.path)
+	return strings.TrimSpace(string(data)), err
+}
+
+func (f keyFile) Delete() error {
+	return os.Remove(f.path)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/auditor"
+	"github.com/vurakit/agentveil/pkg/veilsig"
+)
+
+// skillKeygenCmd writes an Ed25519 key pair for skill signing
+func skillKeygenCmd(fs *flag.FlagSet) func([]string) error {
+	out := fs.String("out", "skill-signing", "path prefix of the key files: <out>.key and <out>.pub")
+	return func(args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return err
+		}
+		privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return err
+		}
+		pubDER, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return err
+		}
+		// O_EXCL: never overwrite a key that may already sign skills
+		for _, f := range []struct {
+			path string
+			pem  *pem.Block
+			mode os.FileMode
+		}{
+			{*out + ".key", &pem.Block{Type: "PRIVATE KEY", Bytes: privDER}, 0o600},
+			{*out + ".pub", &pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}, 0o644},
+		} {
+			file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, f.mode)
+			if err != nil {
+				return err
+			}
+			if err := pem.Encode(file, f.pem); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Wrote %s.key (keep secret) and %s.pub, key ID %s\n", *out, *out, auditor.KeyID(pub))
+		return nil
+	}
+}
+
+// skillSignCmd audits a skill and signs it when the risk level is at most
+// --max-risk
+func skillSignCmd(fs *flag.FlagSet) func([]string) error {
+	keyPath := fs.String("key", "", "Ed25519 private key (PEM, PKCS #8)")
+	maxRisk := fs.String("max-risk", "limited", "Highest risk level to sign: minimal, limited, high or unacceptable")
+	maxAge := fs.Duration("max-age", 0, "Signature lifetime, e.g. 720h (0 = no expiry)")
+	embed := fs.Bool("embed", false, "Embed the signature in the file instead of writing <file>.sig")
+	rules := fs.String("rules", "", "Custom rules YAML file")
+	return func(args []string) error {
+		if len(args) != 1 || *keyPath == "" || *maxAge < 0 {
+			return errUsage
+		}
+		level, err := auditor.ParseRiskLevel(*maxRisk)
+		if err != nil {
+			return fmt.Errorf("--max-risk: %w", err)
+		}
+		keyData, err := os.ReadFile(*keyPath)
+		if err != nil {
+			return fmt.Errorf("reading key: %w", err)
+		}
+		key, err := veilsig.ParsePrivateKey(keyData)
+		if err != nil {
+			return err
+		}
+		a, err := loadAuditor(*rules, "en")
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", args[0], err)
+		}
+		content, _, _, _ := auditor.ExtractSignature(string(data))
+		report := a.Analyze(content)
+		sig, err := auditor.SignReport(key, content, report, auditor.SignOptions{MaxRisk: level, MaxAge: *maxAge})
+		if errors.Is(err, auditor.ErrTooRisky) {
+			fmt.Fprintf(os.Stderr, "not signed: %v\n", err)
+			exit(2)
+		}
+		if err != nil {
+			return err
+		}
+
+		dest := args[0] + ".sig"
+		var out []byte
+		if *embed {
+			embedded, err := auditor.EmbedSignature(content, *sig)
+			if err != nil {
+				return err
+			}
+			dest, out = args[0], []byte(embedded)
+		} else {
+			out, _ = json.MarshalIndent(sig, "", "  ")
+			out = append(out, '\n')
+		}
+		if err := os.WriteFile(dest, out, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Signed %s: risk %d/4, score %.0f, key %s → %s\n", args[0], sig.RiskLevel, sig.Score, sig.KeyID, dest)
+		return nil
+	}
+}
+
+// skillVerifyResult is the JSON output of skill verify
+type skillVerifyResult struct {
+	File      string             `json:"file"`
+	OK        bool               `json:"ok"`
+	Failure   string             `json:"failure,omitempty"` // "integrity" or "policy"
+	Error     string             `json:"error,omitempty"`
+	Signature *auditor.Signature `json:"signature,omitempty"`
+}
+
+// skillVerifyCmd checks a skill's signature, integrity and risk level.
+// It exits 3 when the skill can't be trusted and 2 when it is authentic
+// but fails the policy.
+func skillVerifyCmd(fs *flag.FlagSet) func([]string) error {
+	keyPath := fs.String("key", "", "Ed25519 public key (PEM)")
+	sigPath := fs.String("sig", "", "Signature file (default: embedded, then <file>.sig)")
+	maxRisk := fs.String("max-risk", "limited", "Highest risk level accepted: minimal, limited, high or unacceptable")
+	format := fs.String("format", "text", "Output format: text or json")
+	return func(args []string) error {
+		if len(args) != 1 || *keyPath == "" {
+			return errUsage
+		}
+		level, err := auditor.ParseRiskLevel(*maxRisk)
+		if err != nil {
+			return fmt.Errorf("--max-risk: %w", err)
+		}
+		keyData, err := os.ReadFile(*keyPath)
+		if err != nil {
+			return fmt.Errorf("reading key: %w", err)
+		}
+		pub, err := veilsig.ParsePublicKey(keyData)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", args[0], err)
+		}
+
+		result := skillVerifyResult{File: args[0]}
+		sig, err := loadSkillSignature(string(data), args[0], *sigPath)
+		if err == nil {
+			result.Signature = &sig
+			err = auditor.VerifySigned(pub, string(data), sig, auditor.VerifyOptions{MaxRisk: level, Now: time.Now()})
+		}
+		code := 0
+		switch {
+		case err == nil:
+			result.OK = true
+		case errors.Is(err, auditor.ErrExpired) || errors.Is(err, auditor.ErrTooRisky):
+			result.Failure, result.Error, code = "policy", err.Error(), 2
+		default:
+			result.Failure, result.Error, code = "integrity", err.Error(), 3
+		}
+
+		if outputFormat(*format) == "json" {
+			out, _ := json.MarshalIndent(result, "", "  ")
+			fmt.Println(string(out))
+		} else if result.OK {
+			fmt.Printf("✓ %s: signed by key %s at %s, risk %d/4 (max %d/4)\n",
+				args[0], sig.KeyID, sig.SignedAt.Format(time.RFC3339), sig.RiskLevel, level)
+		} else if result.Failure == "integrity" {
+			fmt.Printf("✗ %s: TAMPERED OR UNSIGNED: %s\n", args[0], result.Error)
+		} else {
+			fmt.Printf("✗ %s: POLICY: %s\n", args[0], result.Error)
+		}
+		if code != 0 {
+			exit(code)
+		}
+		return nil
+	}
+}
+
+// loadSkillSignature returns the signature in sigPath, embedded in
+// content, or in <file>.sig, in that order
+func loadSkillSignature(content, file, sigPath string) (auditor.Signature, error) {
+	var sig auditor.Signature
+	if sigPath == "" {
+		_, embedded, found, err := auditor.ExtractSignature(content)
+		if found || err != nil {
+			return embedded, err
+		}
+		sigPath = file + ".sig"
+	}
+	data, err := os.ReadFile(sigPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return sig, fmt.Errorf("%w: no signature embedded or in %s", auditor.ErrBadSignature, sigPath)
+	}
+	if err != nil {
+		return sig, err
+	}
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return sig, fmt.Errorf("%w: %s: %v", auditor.ErrBadSignature, sigPath, err)
+	}
+	return sig, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// transcriptsExportCmd exports recorded transcripts from a running proxy
+func transcriptsExportCmd(fs *flag.FlagSet) func([]string) error {
+	since := fs.String("since", "", "only records completed since a duration ago, a date or an RFC 3339 time")
+	output := fs.String("output", "", "write JSONL to this file instead of stdout")
+	return func([]string) error {
+		return exportTranscripts(opts.proxyURL, os.Getenv("VEIL_API_KEY"), *since, *output)
+	}
+}
+
+func exportTranscripts(proxyURL, apiKey, since, output string) error {
+	if apiKey == "" {
+		return fmt.Errorf("VEIL_API_KEY must be an admin Veil key")
+	}
+	u := proxyURL + "/admin/transcripts"
+	if since != "" {
+		u += "?since=" + url.QueryEscape(since)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Veil-Key", apiKey)
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("proxy unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("export failed: %s: %s", resp.Status, body)
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
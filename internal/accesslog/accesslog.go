@@ -0,0 +1,400 @@
+// Package accesslog writes one JSON line per request for SIEM ingestion,
+// the audit log of both proxy modes.
+//
+// Entries carry request metadata and decision summaries only. Request and
+// response bodies, query strings and detected PII values are never logged;
+// anonymized entities are reported as counts per category and guardrail
+// violations by rule. The forensic field set adds the transformation record
+// of package forensic: offsets, tokens and body hashes. Lines can also be
+// copied to a Redis stream.
+package accesslog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vurakit/agentveil/internal/forensic"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// Field sets
+const (
+	FieldsCommon   = "common"   // time, request ID, method, path, status, duration, bytes
+	FieldsExtended = "extended" // common plus provider, key, session and security decisions
+	FieldsForensic = "forensic" // extended plus the request's transformation record
+)
+
+// Config controls where and what is logged
+type Config struct {
+	Output     string // "stdout" or a file path
+	Fields     string // FieldsCommon, FieldsExtended or FieldsForensic
+	MaxSizeMB  int    // rotate the file beyond this size (0 = never)
+	MaxBackups int    // rotated files to keep as <path>.1 … <path>.N
+
+	// RedisStream also adds every line to this Redis stream, trimmed to
+	// about RedisMaxLen entries; see Logger.StreamTo
+	RedisStream string
+	RedisMaxLen int64
+}
+
+// DefaultConfig logs common fields to stdout
+func DefaultConfig() Config {
+	return Config{
+		Output:      "stdout",
+		Fields:      FieldsCommon,
+		MaxSizeMB:   100,
+		MaxBackups:  5,
+		RedisMaxLen: 100000,
+	}
+}
+
+// Entry is one access log line
+type Entry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+
+	// Extended fields
+	Provider    string         `json:"provider,omitempty"`
+	KeyID       string         `json:"key_id,omitempty"`
+	Role        string         `json:"role,omitempty"`
+	SessionID   string         `json:"session_id,omitempty"`
+	Entities    map[string]int `json:"entities,omitempty"`
+	ThreatLevel string         `json:"threat_level,omitempty"`
+	Guardrail   string         `json:"guardrail,omitempty"`
+	// Violations are the guardrail rules the request or its response
+	// violated, once per violation
+	Violations []string `json:"violations,omitempty"`
+	// Localization is the data localization decision, for requests that
+	// carried an enforced category
+	Localization *Localization `json:"localization,omitempty"`
+
+	// Forensic fields
+	Transform *forensic.Record `json:"transform,omitempty"`
+}
+
+// Localization records how the router applied data_localization
+type Localization struct {
+	Categories []string `json:"categories"`         // enforced categories found
+	Provider   string   `json:"provider,omitempty"` // chosen, "" when refused
+	Excluded   []string `json:"excluded,omitempty"` // providers outside the allowed regions
+}
+
+// AuditEvent records a privileged action such as a human resolving a vault
+// token. It is written whatever the field set and carries the token, never
+// the value it resolves to.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	RequestID string    `json:"request_id,omitempty"`
+	KeyID     string    `json:"key_id"`
+	Role      string    `json:"role"`
+	SessionID string    `json:"session_id,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Outcome   string    `json:"outcome"`
+}
+
+// Logger writes access log entries
+type Logger struct {
+	mu       sync.Mutex
+	out      io.Writer
+	closer   io.Closer
+	stream   *streamSink
+	extended bool
+	forensic bool
+}
+
+// Validate checks the field set and limits, and that a file destination's
+// directory exists. It does not create or open the file.
+func (c Config) Validate() error {
+	switch c.Fields {
+	case "", FieldsCommon, FieldsExtended, FieldsForensic:
+	default:
+		return fmt.Errorf("unknown access log fields %q (want common, extended or forensic)", c.Fields)
+	}
+	if c.MaxSizeMB < 0 || c.MaxBackups < 0 {
+		return fmt.Errorf("access log max size and backups must be non-negative")
+	}
+	if c.RedisStream != "" && c.RedisMaxLen <= 0 {
+		return fmt.Errorf("access log Redis stream length must be positive")
+	}
+	if c.Output != "" && c.Output != "stdout" {
+		dir := filepath.Dir(c.Output)
+		if info, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("access log directory: %w", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("access log directory %s is not a directory", dir)
+		}
+	}
+	return nil
+}
+
+// New opens the configured destination
+func New(cfg Config) (*Logger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Output == "" || cfg.Output == "stdout" {
+		return NewWithWriter(os.Stdout, cfg.Fields), nil
+	}
+	f, err := openRotating(cfg.Output, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	l := NewWithWriter(f, cfg.Fields)
+	l.closer = f
+	return l, nil
+}
+
+// NewWithWriter logs to w
+func NewWithWriter(w io.Writer, fields string) *Logger {
+	return &Logger{
+		out:      w,
+		extended: fields == FieldsExtended || fields == FieldsForensic,
+		forensic: fields == FieldsForensic,
+	}
+}
+
+// Close flushes the Redis stream, if any, and closes the log file
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	stream := l.stream
+	l.stream = nil
+	l.mu.Unlock()
+	if stream != nil {
+		stream.close()
+	}
+	if l.closer != nil {
+		return l.closer.Close()
+	}
+	return nil
+}
+
+// Audit writes e as its own line, stamping the time if unset
+func (l *Logger) Audit(e AuditEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	l.write(e)
+}
+
+func (l *Logger) write(e any) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.out.Write(data); err != nil {
+		slog.Warn("access log write failed", "error", err)
+	}
+	if l.stream != nil {
+		l.stream.add(data[:len(data)-1])
+	}
+}
+
+// record collects what inner handlers learned about a request
+type record struct {
+	mu         sync.Mutex
+	provider   string
+	entities   map[string]int
+	threat     string
+	guardrail  string
+	violations []string
+	local      *Localization
+}
+
+type recordKey struct{}
+
+func from(ctx context.Context) *record {
+	rec, _ := ctx.Value(recordKey{}).(*record)
+	return rec
+}
+
+// SetProvider records the upstream provider that served the request
+func SetProvider(ctx context.Context, name string) {
+	if rec := from(ctx); rec != nil {
+		rec.mu.Lock()
+		rec.provider = name
+		rec.mu.Unlock()
+	}
+}
+
+// AddEntities records the categories of anonymized entities (never values)
+func AddEntities(ctx context.Context, categories []pii.Category) {
+	rec := from(ctx)
+	if rec == nil || len(categories) == 0 {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.entities == nil {
+		rec.entities = make(map[string]int)
+	}
+	for _, c := range categories {
+		rec.entities[string(c)]++
+	}
+}
+
+// SetThreatLevel records the prompt guard verdict
+func SetThreatLevel(ctx context.Context, level string) {
+	if rec := from(ctx); rec != nil {
+		rec.mu.Lock()
+		rec.threat = level
+		rec.mu.Unlock()
+	}
+}
+
+// SetGuardrail records the guardrail decision (e.g. allowed, blocked)
+func SetGuardrail(ctx context.Context, decision string) {
+	if rec := from(ctx); rec != nil {
+		rec.mu.Lock()
+		rec.guardrail = decision
+		rec.mu.Unlock()
+	}
+}
+
+// AddViolations records the guardrail rules violated (never the content)
+func AddViolations(ctx context.Context, rules []string) {
+	rec := from(ctx)
+	if rec == nil || len(rules) == 0 {
+		return
+	}
+	rec.mu.Lock()
+	rec.violations = append(rec.violations, rules...)
+	rec.mu.Unlock()
+}
+
+// SetLocalization records the data localization decision
+func SetLocalization(ctx context.Context, l Localization) {
+	if rec := from(ctx); rec != nil {
+		rec.mu.Lock()
+		rec.local = &l
+		rec.mu.Unlock()
+	}
+}
+
+// Middleware logs every request once it completes. It should wrap the whole
+// handler chain so rejected requests are logged too. An incoming X-Request-ID
+// is reused; otherwise one is generated and returned in the response.
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		rec := &record{}
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+		cw := &countingWriter{ResponseWriter: w}
+		ctx := context.WithValue(r.Context(), recordKey{}, rec)
+		var transform *forensic.Record
+		if l.forensic {
+			transform = &forensic.Record{}
+			ctx = forensic.WithRecord(ctx, transform)
+		}
+		next.ServeHTTP(cw, r.WithContext(ctx))
+
+		status := cw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		bytesIn := body.n
+		if r.ContentLength > bytesIn {
+			bytesIn = r.ContentLength
+		}
+		e := &Entry{
+			Time:       start.UTC(),
+			RequestID:  requestID,
+			Method:     r.Method,
+			Path:       r.URL.Path, // no query: it may carry keys
+			Status:     status,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			BytesIn:    bytesIn,
+			BytesOut:   cw.n,
+		}
+		if l.extended {
+			rec.mu.Lock()
+			e.Provider = rec.provider
+			e.Entities = rec.entities
+			e.ThreatLevel = rec.threat
+			e.Guardrail = rec.guardrail
+			e.Violations = rec.violations
+			e.Localization = rec.local
+			rec.mu.Unlock()
+			e.KeyID = r.Header.Get("X-Veil-Key-ID")
+			e.Role = r.Header.Get("X-User-Role")
+			e.SessionID = r.Header.Get("X-Session-ID")
+		}
+		if transform != nil && !transform.Empty() {
+			e.Transform = transform
+		}
+		l.write(e)
+	})
+}
+
+// countingReader counts request body bytes read by the handlers
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter captures status and response size
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (c *countingWriter) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	n, err := c.ResponseWriter.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// Flush keeps SSE streaming working through the wrapper
+func (c *countingWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,206 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+func serve(t *testing.T, l *Logger, h http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	l.Middleware(h).ServeHTTP(w, req)
+	return w
+}
+
+func decode(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %d: %s", len(lines), buf.String())
+	}
+	var m map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	return m
+}
+
+func annotatedHandler(w http.ResponseWriter, r *http.Request) {
+	io.ReadAll(r.Body)
+	r.Header.Set("X-Veil-Key-ID", "key-123")
+	r.Header.Set("X-User-Role", "viewer")
+	SetProvider(r.Context(), "openai")
+	AddEntities(r.Context(), []pii.Category{pii.CatEmail, pii.CatEmail, pii.CatPhone})
+	SetThreatLevel(r.Context(), "low")
+	SetGuardrail(r.Context(), "warned")
+	AddViolations(r.Context(), []string{"pii_leak"})
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("hello"))
+}
+
+func TestMiddleware_ExtendedFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter(&buf, FieldsExtended)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions?key=secret", strings.NewReader("0123456789"))
+	req.Header.Set("X-Session-ID", "sess-1")
+	req.Header.Set("X-Request-ID", "req-abc")
+	w := serve(t, l, annotatedHandler, req)
+
+	if w.Header().Get("X-Request-ID") != "req-abc" {
+		t.Errorf("request ID not echoed: %q", w.Header().Get("X-Request-ID"))
+	}
+	m := decode(t, &buf)
+	want := map[string]any{
+		"request_id":   "req-abc",
+		"method":       "POST",
+		"path":         "/v1/chat/completions",
+		"status":       float64(201),
+		"bytes_in":     float64(10),
+		"bytes_out":    float64(5),
+		"provider":     "openai",
+		"key_id":       "key-123",
+		"role":         "viewer",
+		"session_id":   "sess-1",
+		"threat_level": "low",
+		"guardrail":    "warned",
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("%s = %v, want %v", k, m[k], v)
+		}
+	}
+	entities, _ := m["entities"].(map[string]any)
+	if entities["EMAIL"] != float64(2) || entities["PHONE"] != float64(1) {
+		t.Errorf("entities = %v", m["entities"])
+	}
+	if v, _ := m["violations"].([]any); len(v) != 1 || v[0] != "pii_leak" {
+		t.Errorf("violations = %v", m["violations"])
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("query string leaked: %s", buf.String())
+	}
+}
+
+func TestMiddleware_CommonFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter(&buf, FieldsCommon)
+
+	w := serve(t, l, annotatedHandler, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("{}")))
+
+	m := decode(t, &buf)
+	for _, k := range []string{"provider", "key_id", "role", "session_id", "entities", "threat_level", "guardrail", "violations"} {
+		if _, ok := m[k]; ok {
+			t.Errorf("common field set should not include %s", k)
+		}
+	}
+	if id, _ := m["request_id"].(string); id == "" || id != w.Header().Get("X-Request-ID") {
+		t.Errorf("generated request ID %q not returned in response (%q)", id, w.Header().Get("X-Request-ID"))
+	}
+	if _, ok := m["duration_ms"]; !ok {
+		t.Error("missing duration_ms")
+	}
+}
+
+func TestNew_InvalidFields(t *testing.T) {
+	if _, err := New(Config{Output: "stdout", Fields: "verbose"}); err == nil {
+		t.Error("expected error for unknown field set")
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"default", DefaultConfig(), false},
+		{"file in existing dir", Config{Output: filepath.Join(dir, "access.log"), Fields: FieldsExtended}, false},
+		{"missing dir", Config{Output: filepath.Join(dir, "nope", "access.log")}, true},
+		{"negative backups", Config{Output: "stdout", MaxBackups: -1}, true},
+		{"stream without length", Config{Output: "stdout", RedisStream: "veil:access"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "access.log")); !os.IsNotExist(err) {
+		t.Error("Validate must not create the log file")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := openRotating(path, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"line-1 0123456\n", "line-2 0123456\n", "line-3 0123456\n", "line-4 0123456\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(p string) string {
+		data, _ := os.ReadFile(p)
+		return string(data)
+	}
+	if got := read(path); got != "line-4 0123456\n" {
+		t.Errorf("current = %q", got)
+	}
+	if got := read(path + ".1"); got != "line-3 0123456\n" {
+		t.Errorf("backup 1 = %q", got)
+	}
+	if got := read(path + ".2"); got != "line-2 0123456\n" {
+		t.Errorf("backup 2 = %q", got)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected at most 2 backups")
+	}
+}
+
+func TestStreamTo(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	var buf bytes.Buffer
+	l := NewWithWriter(&buf, FieldsExtended)
+	l.StreamTo(client, "veil:access", 100)
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("mail alice@example.com"))
+	serve(t, l, annotatedHandler, req)
+	l.Audit(AuditEvent{Event: "vault_resolve", Outcome: "allowed"})
+	l.Close()
+
+	msgs, err := client.XRange(context.Background(), "veil:access", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("stream has %d entries, want 2", len(msgs))
+	}
+	line, _ := msgs[0].Values["entry"].(string)
+	if line+"\n" != strings.SplitAfter(buf.String(), "\n")[0] {
+		t.Errorf("stream entry %q differs from the file line", line)
+	}
+	if strings.Contains(line, "alice") {
+		t.Errorf("stream entry leaked the body: %s", line)
+	}
+}
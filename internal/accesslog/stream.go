@@ -0,0 +1,90 @@
+package accesslog
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// streamBuffer is how many lines wait for Redis before new ones are dropped
+const streamBuffer = 1024
+
+// streamTimeout bounds one XADD, and the flush on Close
+const streamTimeout = 2 * time.Second
+
+// streamSink adds log lines to a Redis stream from its own goroutine, so a
+// slow or unreachable Redis never holds up a request. Lines that don't fit
+// the buffer are dropped and counted.
+type streamSink struct {
+	client  redis.UniversalClient
+	stream  string
+	maxLen  int64
+	lines   chan []byte
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// StreamTo also adds every line to the Redis stream named by the config's
+// RedisStream, as an entry with a single "entry" field holding the JSON
+// line. The file or stdout stays the primary destination: lines are sent
+// in the background and dropped while Redis can't keep up.
+func (l *Logger) StreamTo(client redis.UniversalClient, stream string, maxLen int64) {
+	s := &streamSink{
+		client: client,
+		stream: stream,
+		maxLen: maxLen,
+		lines:  make(chan []byte, streamBuffer),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	l.mu.Lock()
+	l.stream = s
+	l.mu.Unlock()
+}
+
+// add queues line; the caller holds the Logger's lock
+func (s *streamSink) add(line []byte) {
+	select {
+	case s.lines <- line:
+	default:
+		if s.dropped.Add(1) == 1 {
+			slog.Warn("access log: Redis stream falling behind, dropping lines", "stream", s.stream)
+		}
+	}
+}
+
+func (s *streamSink) run() {
+	defer close(s.done)
+	failing := false
+	for line := range s.lines {
+		ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+		err := s.client.XAdd(ctx, &redis.XAddArgs{
+			Stream: s.stream,
+			MaxLen: s.maxLen,
+			Approx: true,
+			Values: map[string]any{"entry": line},
+		}).Err()
+		cancel()
+		// Logged when Redis starts and stops failing, not per line
+		switch {
+		case err != nil && !failing:
+			slog.Warn("access log: Redis stream write failed", "stream", s.stream, "error", err)
+			failing = true
+		case err == nil && failing:
+			slog.Info("access log: Redis stream writes resumed", "stream", s.stream, "dropped", s.dropped.Load())
+			failing = false
+		}
+	}
+}
+
+// close sends the queued lines, waiting at most streamTimeout
+func (s *streamSink) close() {
+	close(s.lines)
+	select {
+	case <-s.done:
+	case <-time.After(streamTimeout):
+	}
+}
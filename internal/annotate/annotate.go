@@ -0,0 +1,227 @@
+// Package annotate tells opted-in clients why a request was modified or
+// flagged without being blocked, so agent frameworks can adapt instead of
+// failing.
+//
+// Annotations carry sources, categories, severities and counts only.
+// Snippets of flagged content and PII values are never included.
+package annotate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// Header opts a request into annotations with the value "true"
+const Header = "X-Veil-Annotations"
+
+// Field is the top-level key added to JSON responses
+const Field = "veil"
+
+// SSEEvent is the name of the final event appended to streams
+const SSEEvent = "veil_annotations"
+
+// Sources of findings
+const (
+	SourcePII         = "pii"
+	SourcePromptGuard = "promptguard"
+	SourceGuardrail   = "guardrail"
+)
+
+// Finding counts one kind of warning or modification
+type Finding struct {
+	Source   string `json:"source"`
+	Category string `json:"category"`
+	Severity string `json:"severity,omitempty"`
+	Action   string `json:"action"` // anonymized, warned, redacted, allowed
+	Count    int    `json:"count"`
+}
+
+// Annotations is the value of the "veil" field and of the SSE event data
+type Annotations struct {
+	Findings []Finding `json:"findings"`
+}
+
+// record collects findings while the request is handled
+type record struct {
+	mu       sync.Mutex
+	findings map[Finding]int // keyed with Count zero
+}
+
+type recordKey struct{}
+
+func from(ctx context.Context) *record {
+	rec, _ := ctx.Value(recordKey{}).(*record)
+	return rec
+}
+
+// Add records n occurrences of a finding. It is a no-op unless the client
+// opted in.
+func Add(ctx context.Context, source, category, severity, action string, n int) {
+	rec := from(ctx)
+	if rec == nil || n <= 0 {
+		return
+	}
+	key := Finding{Source: source, Category: category, Severity: severity, Action: action}
+	rec.mu.Lock()
+	rec.findings[key] += n
+	rec.mu.Unlock()
+}
+
+// AddEntities records anonymized PII entities by category
+func AddEntities(ctx context.Context, categories []pii.Category) {
+	if from(ctx) == nil {
+		return
+	}
+	for _, c := range categories {
+		Add(ctx, SourcePII, string(c), "", "anonymized", 1)
+	}
+}
+
+// annotations returns the findings in a stable order, or nil
+func (rec *record) annotations() *Annotations {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.findings) == 0 {
+		return nil
+	}
+	a := &Annotations{Findings: make([]Finding, 0, len(rec.findings))}
+	for f, n := range rec.findings {
+		f.Count = n
+		a.Findings = append(a.Findings, f)
+	}
+	sort.Slice(a.Findings, func(i, j int) bool {
+		x, y := a.Findings[i], a.Findings[j]
+		if x.Source != y.Source {
+			return x.Source < y.Source
+		}
+		if x.Category != y.Category {
+			return x.Category < y.Category
+		}
+		return x.Action < y.Action
+	})
+	return a
+}
+
+// Middleware adds annotations to the responses of requests sent with
+// X-Veil-Annotations: true. JSON objects get a top-level "veil" field and
+// event streams a final veil_annotations event; other responses, and
+// responses without findings, are passed through unchanged. It must wrap
+// every component that records findings.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get(Header), "true") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &record{findings: make(map[Finding]int)}
+		aw := &writer{ResponseWriter: w}
+		next.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), recordKey{}, rec)))
+		aw.finish(rec.annotations())
+	})
+}
+
+// writer buffers successful uncompressed JSON responses so the field can
+// be added, and passes everything else through
+type writer struct {
+	http.ResponseWriter
+	wroteHeader bool
+	buffering   bool
+	stream      bool
+	status      int
+	buf         bytes.Buffer
+}
+
+func (aw *writer) WriteHeader(code int) {
+	if aw.wroteHeader {
+		return
+	}
+	aw.wroteHeader = true
+	aw.status = code
+	h := aw.Header()
+	mt, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	switch {
+	case h.Get("Content-Encoding") != "":
+	case mt == "text/event-stream":
+		aw.stream = true
+	case code >= 200 && code < 300 && (mt == "application/json" || strings.HasSuffix(mt, "+json")):
+		aw.buffering = true
+		return
+	}
+	aw.ResponseWriter.WriteHeader(code)
+}
+
+func (aw *writer) Write(b []byte) (int, error) {
+	if !aw.wroteHeader {
+		aw.WriteHeader(http.StatusOK)
+	}
+	if aw.buffering {
+		return aw.buf.Write(b)
+	}
+	return aw.ResponseWriter.Write(b)
+}
+
+// Flush keeps SSE streaming working through the wrapper
+func (aw *writer) Flush() {
+	if aw.buffering {
+		return
+	}
+	if f, ok := aw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (aw *writer) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
+
+func (aw *writer) finish(a *Annotations) {
+	switch {
+	case aw.buffering:
+		body := aw.buf.Bytes()
+		if a != nil {
+			body = inject(body, a)
+		}
+		aw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		aw.ResponseWriter.WriteHeader(aw.status)
+		aw.ResponseWriter.Write(body)
+	case aw.stream && a != nil:
+		data, _ := json.Marshal(a)
+		aw.ResponseWriter.Write([]byte("event: " + SSEEvent + "\ndata: " + string(data) + "\n\n"))
+		aw.Flush()
+	}
+}
+
+// inject adds the "veil" field to a JSON object, leaving the rest of the
+// body as it was. Anything but an object is returned unchanged.
+func inject(body []byte, a *Annotations) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) < 2 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' || !json.Valid(trimmed) {
+		return body
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return body
+	}
+	inner := bytes.TrimSpace(trimmed[1 : len(trimmed)-1])
+
+	var out bytes.Buffer
+	out.Grow(len(trimmed) + len(data) + len(Field) + 4)
+	out.Write(trimmed[:len(trimmed)-1])
+	if len(inner) > 0 {
+		out.WriteByte(',')
+	}
+	out.WriteString(`"` + Field + `":`)
+	out.Write(data)
+	out.WriteByte('}')
+	return out.Bytes()
+}
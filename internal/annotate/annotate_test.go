@@ -0,0 +1,120 @@
+package annotate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+func serve(h http.HandlerFunc, optIn bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if optIn {
+		req.Header.Set(Header, "true")
+	}
+	w := httptest.NewRecorder()
+	Middleware(h).ServeHTTP(w, req)
+	return w
+}
+
+func flagged(w http.ResponseWriter, r *http.Request) {
+	AddEntities(r.Context(), []pii.Category{pii.CatEmail, pii.CatEmail, pii.CatPhone})
+	Add(r.Context(), SourceGuardrail, "toxicity", "medium", "warn", 1)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"id":"chatcmpl-1","choices":[]}`))
+}
+
+func TestMiddleware_JSON(t *testing.T) {
+	w := serve(flagged, true)
+
+	var resp struct {
+		ID   string      `json:"id"`
+		Veil Annotations `json:"veil"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v: %s", err, w.Body.String())
+	}
+	if resp.ID != "chatcmpl-1" {
+		t.Errorf("original fields lost: %s", w.Body.String())
+	}
+	want := []Finding{
+		{Source: SourceGuardrail, Category: "toxicity", Severity: "medium", Action: "warn", Count: 1},
+		{Source: SourcePII, Category: string(pii.CatEmail), Action: "anonymized", Count: 2},
+		{Source: SourcePII, Category: string(pii.CatPhone), Action: "anonymized", Count: 1},
+	}
+	if len(resp.Veil.Findings) != len(want) {
+		t.Fatalf("findings = %+v, want %+v", resp.Veil.Findings, want)
+	}
+	for i := range want {
+		if resp.Veil.Findings[i] != want[i] {
+			t.Errorf("finding %d = %+v, want %+v", i, resp.Veil.Findings[i], want[i])
+		}
+	}
+	if got := w.Header().Get("Content-Length"); got != "" && got != strconv.Itoa(w.Body.Len()) {
+		t.Errorf("Content-Length %s, body %d", got, w.Body.Len())
+	}
+}
+
+func TestMiddleware_NotOptedIn(t *testing.T) {
+	w := serve(flagged, false)
+	if w.Body.String() != `{"id":"chatcmpl-1","choices":[]}` {
+		t.Errorf("response changed without opt-in: %s", w.Body.String())
+	}
+}
+
+func TestMiddleware_NoFindings(t *testing.T) {
+	w := serve(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}, true)
+	if w.Body.String() != `{"ok":true}` {
+		t.Errorf("clean response changed: %s", w.Body.String())
+	}
+}
+
+func TestMiddleware_ErrorsPassThrough(t *testing.T) {
+	w := serve(func(w http.ResponseWriter, r *http.Request) {
+		Add(r.Context(), SourcePII, "email", "", "anonymized", 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"bad"}`))
+	}, true)
+	if w.Code != http.StatusBadRequest || w.Body.String() != `{"error":"bad"}` {
+		t.Errorf("error response changed: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMiddleware_SSE(t *testing.T) {
+	w := serve(func(w http.ResponseWriter, r *http.Request) {
+		Add(r.Context(), SourcePromptGuard, "role_hijack", "low", "allowed", 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[]}\n\ndata: [DONE]\n\n"))
+		w.(http.Flusher).Flush()
+	}, true)
+
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "data: {\"choices\":[]}\n\ndata: [DONE]\n\n") {
+		t.Errorf("stream changed: %q", body)
+	}
+	if !strings.HasSuffix(body, "event: "+SSEEvent+"\ndata: {\"findings\":[{\"source\":\"promptguard\",\"category\":\"role_hijack\",\"severity\":\"low\",\"action\":\"allowed\",\"count\":1}]}\n\n") {
+		t.Errorf("missing final annotations event: %q", body)
+	}
+}
+
+func TestInject(t *testing.T) {
+	a := &Annotations{Findings: []Finding{{Source: SourcePII, Category: "email", Action: "anonymized", Count: 1}}}
+	for _, tt := range []struct{ in, want string }{
+		{`{}`, `{"veil":{"findings":[{"source":"pii","category":"email","action":"anonymized","count":1}]}}`},
+		{"{\"a\":1}\n", `{"a":1,"veil":{"findings":[{"source":"pii","category":"email","action":"anonymized","count":1}]}}`},
+		{`[1,2]`, `[1,2]`},
+		{`{"a":`, `{"a":`},
+	} {
+		if got := string(inject([]byte(tt.in), a)); got != tt.want {
+			t.Errorf("inject(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
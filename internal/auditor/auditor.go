@@ -1,10 +1,16 @@
 package auditor
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/i18n"
 )
 
 // Risk levels per Vietnam AI Law 2026 (4 levels)
@@ -15,12 +21,25 @@ const (
 	RiskUnacceptable = 4 // Rủi ro không chấp nhận được
 )
 
-// RiskLevelName maps numeric level to Vietnamese label
-var RiskLevelName = map[int]string{
-	RiskMinimal:      "Tối thiểu",
-	RiskLimited:      "Hạn chế",
-	RiskHigh:         "Cao",
-	RiskUnacceptable: "Không chấp nhận được",
+// riskMessage maps numeric level to the message ID of its label
+var riskMessage = map[int]string{
+	RiskMinimal:      "audit.risk.minimal",
+	RiskLimited:      "audit.risk.limited",
+	RiskHigh:         "audit.risk.high",
+	RiskUnacceptable: "audit.risk.unacceptable",
+}
+
+// riskClass maps numeric level to the severity style of the HTML report
+var riskClass = map[int]string{
+	RiskMinimal:      "low",
+	RiskLimited:      "medium",
+	RiskHigh:         "high",
+	RiskUnacceptable: "critical",
+}
+
+// RiskLabel returns the label of a risk level in lang
+func RiskLabel(level int, lang i18n.Lang) string {
+	return i18n.T(lang, riskMessage[level])
 }
 
 // Finding represents a single security issue found in a skill.md
@@ -29,7 +48,16 @@ type Finding struct {
 	Severity    string `json:"severity"`
 	Category    string `json:"category"`
 	Description string `json:"description"`
-	Snippet     string `json:"snippet"`
+	// MessageID identifies Description independently of the language;
+	// empty for custom rules, whose description is used as written
+	MessageID string `json:"message_id,omitempty"`
+	Snippet   string `json:"snippet"`
+	// Occurrences counts the identical findings collapsed into this one,
+	// and Lines lists where they are; Line and Snippet are of the first
+	Occurrences int   `json:"occurrences"`
+	Lines       []int `json:"lines,omitempty"`
+
+	weight int // of one occurrence, before Scoring
 }
 
 // Report is the complete audit result
@@ -40,7 +68,15 @@ type Report struct {
 	RiskLevelLabel string         `json:"risk_level_label"`
 	Score          float64        `json:"compliance_score"`
 	Summary        string         `json:"summary"`
-	Sections       []string       `json:"sections,omitempty"`
+	// UniqueIssues counts the findings that aren't info, TotalOccurrences
+	// the occurrences of those findings
+	UniqueIssues     int       `json:"unique_issues"`
+	TotalOccurrences int       `json:"total_occurrences"`
+	Lang             i18n.Lang `json:"lang"` // of every text of the report
+	Sections         []string  `json:"sections,omitempty"`
+	// RulesProfile lists how the rules differ from the built-in set:
+	// overridden built-in rules and the number of custom rules
+	RulesProfile string `json:"rules_profile,omitempty"`
 }
 
 // ReportJSON returns the report as formatted JSON bytes
@@ -48,35 +84,48 @@ func (r Report) ReportJSON() ([]byte, error) {
 	return json.MarshalIndent(r, "", "  ")
 }
 
-// ReportHTML returns a simple HTML report
+// ReportHTML returns a simple HTML report in the report's language
 func (r Report) ReportHTML() string {
+	t := func(id string) string { return i18n.T(r.Lang, "audit.html."+id) }
 	var sb strings.Builder
-	sb.WriteString("<!DOCTYPE html><html><head><meta charset='utf-8'><title>Agent Veil Audit Report</title>")
+	sb.WriteString(fmt.Sprintf("<!DOCTYPE html><html lang='%s'><head><meta charset='utf-8'><title>%s</title>", r.Lang.Code(), t("title")))
 	sb.WriteString("<style>body{font-family:sans-serif;max-width:800px;margin:0 auto;padding:20px}")
 	sb.WriteString(".critical{color:#dc2626}.high{color:#ea580c}.medium{color:#ca8a04}.low{color:#16a34a}")
 	sb.WriteString("table{border-collapse:collapse;width:100%}td,th{border:1px solid #ddd;padding:8px;text-align:left}")
 	sb.WriteString("</style></head><body>")
 
-	sb.WriteString(fmt.Sprintf("<h1>Agent Veil Audit Report</h1>"))
-	sb.WriteString(fmt.Sprintf("<p><strong>Risk Level:</strong> <span class='%s'>%s</span></p>",
-		strings.ToLower(r.RiskLevelLabel), r.RiskLevelLabel))
-	sb.WriteString(fmt.Sprintf("<p><strong>Compliance Score:</strong> %.1f/100</p>", r.Score))
+	sb.WriteString(fmt.Sprintf("<h1>%s</h1>", t("title")))
+	sb.WriteString(fmt.Sprintf("<p><strong>%s:</strong> <span class='%s'>%s</span></p>",
+		t("risk_level"), riskClass[r.RiskLevel], r.RiskLevelLabel))
+	sb.WriteString(fmt.Sprintf("<p><strong>%s:</strong> %.1f/100</p>", t("score"), r.Score))
 	sb.WriteString(fmt.Sprintf("<p>%s</p>", r.Summary))
+	if r.RulesProfile != "" {
+		sb.WriteString(fmt.Sprintf("<p><strong>%s:</strong> %s</p>", t("rules_profile"), r.RulesProfile))
+	}
 
 	if len(r.Findings) > 0 {
-		sb.WriteString("<h2>Findings</h2><table><tr><th>Line</th><th>Severity</th><th>Category</th><th>Description</th></tr>")
+		sb.WriteString(fmt.Sprintf("<h2>%s</h2><table><tr><th>%s</th><th>%s</th><th>%s</th><th>%s</th></tr>",
+			t("findings"), t("line"), t("severity"), t("category"), t("description")))
 		for _, f := range r.Findings {
-			sb.WriteString(fmt.Sprintf("<tr><td>%d</td><td class='%s'>%s</td><td>%s</td><td>%s</td></tr>",
-				f.Line, f.Severity, f.Severity, f.Category, f.Description))
+			lines := strconv.Itoa(f.Line)
+			if len(f.Lines) > 1 {
+				nums := make([]string, len(f.Lines))
+				for i, n := range f.Lines {
+					nums[i] = strconv.Itoa(n)
+				}
+				lines = strings.Join(nums, ", ")
+			}
+			sb.WriteString(fmt.Sprintf("<tr><td>%s</td><td class='%s'>%s</td><td>%s</td><td>%s</td></tr>",
+				lines, f.Severity, f.Severity, f.Category, f.Description))
 		}
 		sb.WriteString("</table>")
 	}
 
 	if len(r.BehaviorChains) > 0 {
-		sb.WriteString("<h2>Behavior Chains</h2><ul>")
+		sb.WriteString(fmt.Sprintf("<h2>%s</h2><ul>", t("behavior_chains")))
 		for _, bc := range r.BehaviorChains {
-			sb.WriteString(fmt.Sprintf("<li class='%s'><strong>%s</strong>: %s (weight: %d)</li>",
-				bc.Chain.Severity, bc.Chain.Name, bc.Chain.Description, bc.Chain.Weight))
+			sb.WriteString(fmt.Sprintf("<li class='%s'><strong>%s</strong>: %s (%s: %d)</li>",
+				bc.Chain.Severity, bc.Chain.Name, bc.Chain.Description, t("weight"), bc.Chain.Weight))
 		}
 		sb.WriteString("</ul>")
 	}
@@ -87,18 +136,33 @@ func (r Report) ReportHTML() string {
 
 // dangerousPattern defines a regex and its associated risk
 type dangerousPattern struct {
+	ID          string // custom rule id; built-in rules are identified by Category
 	Pattern     *regexp.Regexp
 	Severity    string
 	Category    string
-	Description string
+	Description string // custom rules
+	MessageID   string // built-in rules
 	Weight      int
 }
 
+// describe returns the description of dp in lang
+func (dp dangerousPattern) describe(lang i18n.Lang) string {
+	if dp.MessageID == "" {
+		return dp.Description
+	}
+	return i18n.T(lang, dp.MessageID)
+}
+
 // Auditor analyzes skill.md files for security compliance
 type Auditor struct {
 	patterns       []dangerousPattern
 	enableEvasion  bool
 	enableBehavior bool
+	profile        string // Report.RulesProfile
+	limits         Limits
+	scoring        Scoring
+	project        ProjectOptions
+	lang           i18n.Lang
 }
 
 // New creates an Auditor with built-in security rules and V2 features
@@ -107,6 +171,9 @@ func New() *Auditor {
 		patterns:       defaultPatterns(),
 		enableEvasion:  true,
 		enableBehavior: true,
+		limits:         DefaultLimits(),
+		scoring:        DefaultScoring(),
+		project:        DefaultProjectOptions(),
 	}
 }
 
@@ -117,125 +184,174 @@ func NewWithCustomRules(customYAML string) (*Auditor, error) {
 		return nil, err
 	}
 
-	patterns := defaultPatterns()
-	patterns = append(patterns, cfg.ToPatterns()...)
+	patterns, profile := cfg.applyBuiltin(defaultPatterns())
+	custom := cfg.ToPatterns()
+	patterns = append(patterns, custom...)
+	switch len(custom) {
+	case 0:
+	case 1:
+		profile = append(profile, "1 custom rule")
+	default:
+		profile = append(profile, fmt.Sprintf("%d custom rules", len(custom)))
+	}
+
+	scoring := DefaultScoring()
+	if cfg.Scoring != nil {
+		scoring = cfg.Scoring.apply(scoring)
+	}
 
 	return &Auditor{
 		patterns:       patterns,
 		enableEvasion:  true,
 		enableBehavior: true,
+		profile:        strings.Join(profile, ", "),
+		limits:         DefaultLimits(),
+		scoring:        scoring,
+		project:        DefaultProjectOptions(),
 	}, nil
 }
 
+// SetLimits replaces the input limits, DefaultLimits by default
+func (a *Auditor) SetLimits(l Limits) {
+	a.limits = l
+}
+
+// SetScoring replaces how repeated findings are weighed, DefaultScoring
+// by default
+func (a *Auditor) SetScoring(s Scoring) {
+	a.scoring = s
+}
+
+// SetLang sets the language of reports, i18n.Default by default
+func (a *Auditor) SetLang(l i18n.Lang) {
+	a.lang = l
+}
+
 func defaultPatterns() []dangerousPattern {
 	return []dangerousPattern{
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:read|access|extract|get|fetch|steal|copy)\s+(?:user|customer|client)?\s*(?:password|credentials|secret|token|api.?key|private.?key)`),
-			Severity:    "critical",
-			Category:    "credential_access",
-			Description: "Chỉ dẫn truy cập thông tin xác thực / mật khẩu",
-			Weight:      40,
+			Pattern:   regexp.MustCompile(`(?i)(?:read|access|extract|get|fetch|steal|copy)\s+(?:user|customer|client)?\s*(?:password|credentials|secret|token|api.?key|private.?key)`),
+			Severity:  "critical",
+			Category:  "credential_access",
+			MessageID: "audit.rule.credential_access",
+			Weight:    40,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:send|post|upload|transmit|exfiltrate|forward)\s+(?:data|information|pii|personal)\s+(?:to|towards)\s+(?:external|third.?party|outside|http)`),
-			Severity:    "critical",
-			Category:    "data_exfiltration",
-			Description: "Chỉ dẫn gửi dữ liệu ra ngoài hệ thống",
-			Weight:      40,
+			Pattern:   regexp.MustCompile(`(?i)(?:send|post|upload|transmit|exfiltrate|forward)\s+(?:data|information|pii|personal)\s+(?:to|towards)\s+(?:external|third.?party|outside|http)`),
+			Severity:  "critical",
+			Category:  "data_exfiltration",
+			MessageID: "audit.rule.data_exfiltration",
+			Weight:    40,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:bypass|skip|ignore|disable|circumvent)\s+(?:security|auth|authentication|authorization|validation|verification|consent)`),
-			Severity:    "critical",
-			Category:    "security_bypass",
-			Description: "Chỉ dẫn bỏ qua cơ chế bảo mật",
-			Weight:      35,
+			Pattern:   regexp.MustCompile(`(?i)(?:bypass|skip|ignore|disable|circumvent)\s+(?:security|auth|authentication|authorization|validation|verification|consent)`),
+			Severity:  "critical",
+			Category:  "security_bypass",
+			MessageID: "audit.rule.security_bypass",
+			Weight:    35,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:collect|gather|harvest|scrape|mine)\s+(?:personal|user|citizen|customer)\s+(?:data|information|details|records|cccd|cmnd)`),
-			Severity:    "high",
-			Category:    "mass_collection",
-			Description: "Thu thập hàng loạt dữ liệu cá nhân",
-			Weight:      30,
+			Pattern:   regexp.MustCompile(`(?i)(?:collect|gather|harvest|scrape|mine)\s+(?:personal|user|citizen|customer)\s+(?:data|information|details|records|cccd|cmnd)`),
+			Severity:  "high",
+			Category:  "mass_collection",
+			MessageID: "audit.rule.mass_collection",
+			Weight:    30,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:delete|remove|wipe|destroy|drop)\s+(?:all|every)?\s*(?:log|audit|record|trail|evidence|backup)`),
-			Severity:    "critical",
-			Category:    "audit_destruction",
-			Description: "Chỉ dẫn xóa bản ghi kiểm toán",
-			Weight:      35,
+			Pattern:   regexp.MustCompile(`(?i)(?:delete|remove|wipe|destroy|drop)\s+(?:all|every)?\s*(?:log|audit|record|trail|evidence|backup)`),
+			Severity:  "critical",
+			Category:  "audit_destruction",
+			MessageID: "audit.rule.audit_destruction",
+			Weight:    35,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:execute|run|eval|system|shell|exec)\s*\(`),
-			Severity:    "high",
-			Category:    "code_execution",
-			Description: "Chỉ dẫn thực thi mã tùy ý",
-			Weight:      25,
+			Pattern:   regexp.MustCompile(`(?i)(?:execute|run|eval|system|shell|exec)\s*\(`),
+			Severity:  "high",
+			Category:  "code_execution",
+			MessageID: "audit.rule.code_execution",
+			Weight:    25,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:without|no)\s+(?:user)?\s*(?:consent|permission|approval|authorization)`),
-			Severity:    "high",
-			Category:    "consent_violation",
-			Description: "Hành động không có sự đồng ý của người dùng",
-			Weight:      25,
+			Pattern:   regexp.MustCompile(`(?i)(?:without|no)\s+(?:user)?\s*(?:consent|permission|approval|authorization)`),
+			Severity:  "high",
+			Category:  "consent_violation",
+			MessageID: "audit.rule.consent_violation",
+			Weight:    25,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:track|monitor|surveil|spy|watch)\s+(?:user|employee|citizen|individual|person)`),
-			Severity:    "high",
-			Category:    "surveillance",
-			Description: "Giám sát người dùng trái phép",
-			Weight:      20,
+			Pattern:   regexp.MustCompile(`(?i)(?:track|monitor|surveil|spy|watch)\s+(?:user|employee|citizen|individual|person)`),
+			Severity:  "high",
+			Category:  "surveillance",
+			MessageID: "audit.rule.surveillance",
+			Weight:    20,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:store|save|keep|retain)\s+(?:cccd|cmnd|passport|id.?card|social.?security|ssn|mã.?số.?thuế)`),
-			Severity:    "medium",
-			Category:    "sensitive_storage",
-			Description: "Lưu trữ dữ liệu nhạy cảm cao",
-			Weight:      15,
+			Pattern:   regexp.MustCompile(`(?i)(?:store|save|keep|retain)\s+(?:cccd|cmnd|passport|id.?card|social.?security|ssn|mã.?số.?thuế)`),
+			Severity:  "medium",
+			Category:  "sensitive_storage",
+			MessageID: "audit.rule.sensitive_storage",
+			Weight:    15,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:share|distribute|sell|trade)\s+(?:personal|user|client|customer)\s+(?:data|info|information)`),
-			Severity:    "high",
-			Category:    "data_sharing",
-			Description: "Chia sẻ dữ liệu cá nhân cho bên thứ ba",
-			Weight:      25,
+			Pattern:   regexp.MustCompile(`(?i)(?:share|distribute|sell|trade)\s+(?:personal|user|client|customer)\s+(?:data|info|information)`),
+			Severity:  "high",
+			Category:  "data_sharing",
+			MessageID: "audit.rule.data_sharing",
+			Weight:    25,
 		},
 		// V3: Indirect prompt injection patterns
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:read|fetch|load|open|visit|follow|navigate|go\s+to|click|browse|retrieve|download)\s+(?:this\s+)?(?:url|link|http|https|website|webpage|page|site)[\s:]*(?:https?://\S+)?`),
-			Severity:    "critical",
-			Category:    "url_fetch_injection",
-			Description: "Chỉ dẫn đọc/fetch URL/link ngoài trong skill — vector injection gián tiếp",
-			Weight:      35,
+			Pattern:   regexp.MustCompile(`(?i)(?:read|fetch|load|open|visit|follow|navigate|go\s+to|click|browse|retrieve|download)\s+(?:this\s+)?(?:url|link|http|https|website|webpage|page|site)[\s:]*(?:https?://\S+)?`),
+			Severity:  "critical",
+			Category:  "url_fetch_injection",
+			MessageID: "audit.rule.url_fetch_injection",
+			Weight:    35,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:delete|remove|clear|wipe|overwrite|replace|modify|edit|change|strip|drop)\s+(?:all\s+)?(?:skill|instruction|rule|guideline|system\s+prompt|\.md|markdown)`),
-			Severity:    "critical",
-			Category:    "skill_tampering",
-			Description: "Chỉ dẫn xóa/sửa/bỏ skill hoặc file chỉ dẫn",
-			Weight:      40,
+			Pattern:   regexp.MustCompile(`(?i)(?:delete|remove|clear|wipe|overwrite|replace|modify|edit|change|strip|drop)\s+(?:all\s+)?(?:skill|instruction|rule|guideline|system\s+prompt|\.md|markdown)`),
+			Severity:  "critical",
+			Category:  "skill_tampering",
+			MessageID: "audit.rule.skill_tampering",
+			Weight:    40,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:follow|execute|obey|comply|apply|use|adopt)\s+(?:the\s+)?(?:instructions?|commands?|directives?|guidance|content|steps?)\s+(?:from|in|at|on)\s+(?:the\s+)?(?:url|link|page|site|external|remote|http)`),
-			Severity:    "critical",
-			Category:    "indirect_injection",
-			Description: "Chỉ dẫn follow/execute instructions từ nguồn bên ngoài",
-			Weight:      40,
+			Pattern:   regexp.MustCompile(`(?i)(?:follow|execute|obey|comply|apply|use|adopt)\s+(?:the\s+)?(?:instructions?|commands?|directives?|guidance|content|steps?)\s+(?:from|in|at|on)\s+(?:the\s+)?(?:url|link|page|site|external|remote|http)`),
+			Severity:  "critical",
+			Category:  "indirect_injection",
+			MessageID: "audit.rule.indirect_injection",
+			Weight:    40,
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:post|send|submit|forward|transmit|upload)\s+(?:all\s+)?(?:customer|client|user|khách\s*hàng|người\s*dùng)\s+(?:data|info|information|dữ\s*liệu|thông\s*tin)\s+(?:to|tới|đến)\s+(?:https?://\S+|external|outside|webhook|endpoint)`),
-			Severity:    "critical",
-			Category:    "data_post_external",
-			Description: "Chỉ dẫn POST/gửi data khách hàng ra endpoint cụ thể",
-			Weight:      40,
+			Pattern:   regexp.MustCompile(`(?i)(?:post|send|submit|forward|transmit|upload)\s+(?:all\s+)?(?:customer|client|user|khách\s*hàng|người\s*dùng)\s+(?:data|info|information|dữ\s*liệu|thông\s*tin)\s+(?:to|tới|đến)\s+(?:https?://\S+|external|outside|webhook|endpoint)`),
+			Severity:  "critical",
+			Category:  "data_post_external",
+			MessageID: "audit.rule.data_post_external",
+			Weight:    40,
 		},
 	}
 }
 
-// Analyze parses skill.md content and produces a compliance report
+// Analyze parses skill.md content and produces a compliance report. Lines
+// and passes are bounded by the auditor's Limits, but content of any size
+// is accepted; use AnalyzeContext to enforce MaxContentSize.
 func (a *Auditor) Analyze(content string) Report {
+	report, _ := a.analyze(context.Background(), content)
+	return report
+}
+
+// AnalyzeContext is Analyze for untrusted input: content over
+// Limits.MaxContentSize is rejected with ErrContentTooLarge, and the
+// analysis stops with ctx's error when ctx ends
+func (a *Auditor) AnalyzeContext(ctx context.Context, content string) (Report, error) {
+	if max := a.limits.MaxContentSize; max > 0 && len(content) > max {
+		return Report{}, contentTooLarge(len(content), max)
+	}
+	return a.analyze(ctx, content)
+}
+
+func (a *Auditor) analyze(ctx context.Context, content string) (Report, error) {
 	lines := strings.Split(content, "\n")
 	var findings []Finding
-	totalWeight := 0
 
 	// Parse markdown sections
 	sections := MergeMarkdownSections(content)
@@ -244,79 +360,167 @@ func (a *Auditor) Analyze(content string) Report {
 		sectionNames = append(sectionNames, name)
 	}
 
+	scans := make(map[string]lineScan)
+	deobfuscateCut, firstCut := 0, 0
 	for lineNum, line := range lines {
+		if lineNum%behaviorChunk == 0 && ctx.Err() != nil {
+			return Report{}, ctx.Err()
+		}
 		trimmed := strings.TrimSpace(line)
 		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
 			continue
 		}
 
-		// Scan original line
-		for _, dp := range a.patterns {
-			if dp.Pattern.MatchString(line) {
-				findings = append(findings, Finding{
-					Line:        lineNum + 1,
-					Severity:    dp.Severity,
-					Category:    dp.Category,
-					Description: dp.Description,
-					Snippet:     truncate(trimmed, 120),
-				})
-				totalWeight += dp.Weight
-			}
+		// Every pass after this one sees the capped line
+		if capped, cut := capLine(line, a.limits.MaxLineLength); cut {
+			findings = append(findings, Finding{
+				Line:        lineNum + 1,
+				Severity:    SeverityInfo,
+				Category:    CategoryTruncatedLine,
+				Description: i18n.T(a.lang, "audit.truncated_line", len(line), len(capped)),
+				MessageID:   "audit.truncated_line",
+				Snippet:     truncate(trimmed, 120),
+			})
+			line, lines[lineNum] = capped, capped
 		}
 
-		// V2: Anti-evasion — also scan deobfuscated versions
-		if a.enableEvasion {
-			revealed := DeobfuscateLine(line)
-			for _, rev := range revealed {
-				for _, dp := range a.patterns {
-					if dp.Pattern.MatchString(rev) {
-						findings = append(findings, Finding{
-							Line:        lineNum + 1,
-							Severity:    dp.Severity,
-							Category:    "evasion:" + dp.Category,
-							Description: "[Obfuscated] " + dp.Description,
-							Snippet:     truncate(trimmed, 120),
-						})
-						totalWeight += dp.Weight
-					}
-				}
+		// Repeated lines are scanned once
+		scan, seen := scans[line]
+		if !seen {
+			scan = a.scanLine(line)
+			scans[line] = scan
+		}
+		if !scan.complete {
+			if deobfuscateCut == 0 {
+				firstCut = lineNum + 1
 			}
+			deobfuscateCut++
 		}
+		for _, i := range scan.hits {
+			dp := a.patterns[i]
+			findings = append(findings, Finding{
+				Line:        lineNum + 1,
+				Severity:    dp.Severity,
+				Category:    dp.Category,
+				Description: dp.describe(a.lang),
+				MessageID:   dp.MessageID,
+				Snippet:     truncate(trimmed, 120),
+				weight:      dp.Weight,
+			})
+		}
+		for _, i := range scan.evasionHits {
+			dp := a.patterns[i]
+			findings = append(findings, Finding{
+				Line:        lineNum + 1,
+				Severity:    dp.Severity,
+				Category:    "evasion:" + dp.Category,
+				Description: i18n.T(a.lang, "audit.obfuscated", dp.describe(a.lang)),
+				MessageID:   dp.MessageID,
+				Snippet:     truncate(trimmed, 120),
+				weight:      dp.Weight,
+			})
+		}
+	}
+
+	if deobfuscateCut > 0 {
+		findings = append(findings, Finding{
+			Line:        firstCut,
+			Severity:    SeverityInfo,
+			Category:    CategoryAnalysisIncomplete,
+			Description: i18n.T(a.lang, "audit.incomplete.deobfuscate", a.limits.DeobfuscateBudget, deobfuscateCut),
+			MessageID:   "audit.incomplete.deobfuscate",
+		})
 	}
 
 	// V2: Behavior chain analysis
 	var chainFindings []ChainFinding
 	if a.enableBehavior {
-		chainFindings = AnalyzeBehaviorChains(content)
+		bctx, cancel := budgetCtx(ctx, a.limits.BehaviorBudget)
+		var complete bool
+		chainFindings, complete = analyzeBehaviorChains(bctx, lines, a.lang)
+		cancel()
+		if ctx.Err() != nil {
+			return Report{}, ctx.Err()
+		}
+		if !complete {
+			findings = append(findings, Finding{
+				Severity:    SeverityInfo,
+				Category:    CategoryAnalysisIncomplete,
+				Description: i18n.T(a.lang, "audit.incomplete.behavior", a.limits.BehaviorBudget),
+				MessageID:   "audit.incomplete.behavior",
+			})
+		}
 		for _, cf := range chainFindings {
-			totalWeight += cf.Chain.Weight
 			findings = append(findings, Finding{
 				Line:        cf.Actions[0].Line,
 				Severity:    cf.Chain.Severity,
 				Category:    "behavior:" + cf.Chain.Name,
 				Description: cf.Chain.Description,
+				MessageID:   cf.Chain.MessageID,
 				Snippet:     fmt.Sprintf("Chain: %v", cf.Actions),
+				weight:      cf.Chain.Weight,
 			})
 		}
 	}
 
-	// Calculate compliance score
-	score := 100.0 - float64(totalWeight)
+	// Calculate compliance score over unique findings, repeats diminished
+	findings = aggregate(findings)
+	score := math.Round((100.0-a.scoring.weigh(findings))*10) / 10
 	if score < 0 {
 		score = 0
 	}
 
 	riskLevel := calculateRiskLevel(score, findings)
+	unique, occurrences := countIssues(findings)
 
 	return Report{
-		Findings:       findings,
-		BehaviorChains: chainFindings,
-		RiskLevel:      riskLevel,
-		RiskLevelLabel: RiskLevelName[riskLevel],
-		Score:          score,
-		Summary:        buildSummary(findings, riskLevel),
-		Sections:       sectionNames,
+		Findings:         findings,
+		BehaviorChains:   chainFindings,
+		RiskLevel:        riskLevel,
+		RiskLevelLabel:   RiskLabel(riskLevel, a.lang),
+		Score:            score,
+		Summary:          buildSummary(findings, riskLevel, a.lang),
+		UniqueIssues:     unique,
+		TotalOccurrences: occurrences,
+		Lang:             a.lang.Code(),
+		Sections:         sectionNames,
+		RulesProfile:     a.profile,
+	}, nil
+}
+
+// lineScan is the pattern matches of one line, by index in a.patterns
+type lineScan struct {
+	hits        []int
+	evasionHits []int // one entry per deobfuscated form that matched
+	complete    bool  // false when deobfuscation ran out of time
+}
+
+func (a *Auditor) scanLine(line string) lineScan {
+	scan := lineScan{complete: true}
+	for i, dp := range a.patterns {
+		if dp.Pattern.MatchString(line) {
+			scan.hits = append(scan.hits, i)
+		}
+	}
+
+	// V2: Anti-evasion — also scan deobfuscated versions
+	if !a.enableEvasion {
+		return scan
+	}
+	var deadline time.Time
+	if b := a.limits.DeobfuscateBudget; b > 0 {
+		deadline = time.Now().Add(b)
 	}
+	var revealed []string
+	revealed, scan.complete = deobfuscate(line, deadline)
+	for _, rev := range revealed {
+		for i, dp := range a.patterns {
+			if dp.Pattern.MatchString(rev) {
+				scan.evasionHits = append(scan.evasionHits, i)
+			}
+		}
+	}
+	return scan
 }
 
 func calculateRiskLevel(score float64, findings []Finding) int {
@@ -340,13 +544,23 @@ func calculateRiskLevel(score float64, findings []Finding) int {
 	return RiskMinimal
 }
 
-func buildSummary(findings []Finding, riskLevel int) string {
-	if len(findings) == 0 {
-		return "Skill.md tuân thủ tốt. Không phát hiện chỉ dẫn nguy hiểm."
+// countIssues returns the number of findings that aren't info and their
+// occurrences
+func countIssues(findings []Finding) (unique, occurrences int) {
+	for _, f := range findings {
+		if f.Severity != SeverityInfo {
+			unique++
+			occurrences += max(f.Occurrences, 1)
+		}
 	}
+	return unique, occurrences
+}
 
-	var sb strings.Builder
-	sb.WriteString("Phát hiện ")
+func buildSummary(findings []Finding, riskLevel int, lang i18n.Lang) string {
+	issues, occurrences := countIssues(findings)
+	if issues == 0 {
+		return i18n.T(lang, "audit.summary.clean")
+	}
 
 	critical, high, medium := 0, 0, 0
 	for _, f := range findings {
@@ -362,21 +576,19 @@ func buildSummary(findings []Finding, riskLevel int) string {
 
 	var parts []string
 	if critical > 0 {
-		parts = append(parts, fmt.Sprintf("%d vấn đề nghiêm trọng", critical))
+		parts = append(parts, i18n.T(lang, "audit.summary.critical", critical))
 	}
 	if high > 0 {
-		parts = append(parts, fmt.Sprintf("%d vấn đề cao", high))
+		parts = append(parts, i18n.T(lang, "audit.summary.high", high))
 	}
 	if medium > 0 {
-		parts = append(parts, fmt.Sprintf("%d vấn đề trung bình", medium))
+		parts = append(parts, i18n.T(lang, "audit.summary.medium", medium))
+	}
+	if occurrences > issues {
+		parts = append(parts, i18n.T(lang, "audit.summary.occurrences", occurrences))
 	}
 
-	sb.WriteString(strings.Join(parts, ", "))
-	sb.WriteString(". Mức rủi ro: ")
-	sb.WriteString(RiskLevelName[riskLevel])
-	sb.WriteString(".")
-
-	return sb.String()
+	return i18n.T(lang, "audit.summary.issues", strings.Join(parts, ", "), RiskLabel(riskLevel, lang))
 }
 
 func truncate(s string, maxLen int) string {
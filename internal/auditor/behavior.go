@@ -1,8 +1,11 @@
 package auditor
 
 import (
+	"context"
 	"regexp"
 	"strings"
+
+	"github.com/vurakit/agentveil/internal/i18n"
 )
 
 // BehaviorChain detects dangerous sequences of actions in skill.md.
@@ -45,67 +48,74 @@ type DangerousChain struct {
 	Name        string
 	Sequence    []ActionType
 	Severity    string
-	Description string
+	Description string // the text of MessageID in the report's language
+	MessageID   string
 	Weight      int
 }
 
+// in returns the chain described in lang
+func (c DangerousChain) in(lang i18n.Lang) DangerousChain {
+	c.Description = i18n.T(lang, c.MessageID)
+	return c
+}
+
 var dangerousChains = []DangerousChain{
 	{
-		Name:        "data_exfiltration",
-		Sequence:    []ActionType{ActionReadFile, ActionHTTPSend},
-		Severity:    "critical",
-		Description: "Đọc file rồi gửi HTTP = nghi ngờ rò rỉ dữ liệu",
-		Weight:      35,
+		Name:      "data_exfiltration",
+		Sequence:  []ActionType{ActionReadFile, ActionHTTPSend},
+		Severity:  "critical",
+		MessageID: "audit.chain.data_exfiltration",
+		Weight:    35,
 	},
 	{
-		Name:        "db_exfiltration",
-		Sequence:    []ActionType{ActionReadDB, ActionHTTPSend},
-		Severity:    "critical",
-		Description: "Truy vấn DB rồi gửi HTTP = nghi ngờ rò rỉ CSDL",
-		Weight:      40,
+		Name:      "db_exfiltration",
+		Sequence:  []ActionType{ActionReadDB, ActionHTTPSend},
+		Severity:  "critical",
+		MessageID: "audit.chain.db_exfiltration",
+		Weight:    40,
 	},
 	{
-		Name:        "credential_theft",
-		Sequence:    []ActionType{ActionAccessCreds, ActionHTTPSend},
-		Severity:    "critical",
-		Description: "Truy cập credentials rồi gửi ra ngoài",
-		Weight:      45,
+		Name:      "credential_theft",
+		Sequence:  []ActionType{ActionAccessCreds, ActionHTTPSend},
+		Severity:  "critical",
+		MessageID: "audit.chain.credential_theft",
+		Weight:    45,
 	},
 	{
-		Name:        "cover_tracks",
-		Sequence:    []ActionType{ActionExecCode, ActionDeleteFile},
-		Severity:    "critical",
-		Description: "Thực thi mã rồi xóa file = xóa dấu vết",
-		Weight:      35,
+		Name:      "cover_tracks",
+		Sequence:  []ActionType{ActionExecCode, ActionDeleteFile},
+		Severity:  "critical",
+		MessageID: "audit.chain.cover_tracks",
+		Weight:    35,
 	},
 	{
-		Name:        "reverse_shell",
-		Sequence:    []ActionType{ActionExecCode, ActionHTTPSend},
-		Severity:    "critical",
-		Description: "Thực thi mã + kết nối mạng = nghi ngờ reverse shell",
-		Weight:      40,
+		Name:      "reverse_shell",
+		Sequence:  []ActionType{ActionExecCode, ActionHTTPSend},
+		Severity:  "critical",
+		MessageID: "audit.chain.reverse_shell",
+		Weight:    40,
 	},
 	// V3: Indirect prompt injection chains
 	{
-		Name:        "indirect_injection",
-		Sequence:    []ActionType{ActionFetchURL, ActionModifySkill},
-		Severity:    "critical",
-		Description: "Đọc URL rồi sửa skill = injection gián tiếp",
-		Weight:      45,
+		Name:      "indirect_injection",
+		Sequence:  []ActionType{ActionFetchURL, ActionModifySkill},
+		Severity:  "critical",
+		MessageID: "audit.chain.indirect_injection",
+		Weight:    45,
 	},
 	{
-		Name:        "url_data_exfil",
-		Sequence:    []ActionType{ActionFetchURL, ActionHTTPSend},
-		Severity:    "critical",
-		Description: "Đọc URL rồi gửi dữ liệu ra ngoài",
-		Weight:      40,
+		Name:      "url_data_exfil",
+		Sequence:  []ActionType{ActionFetchURL, ActionHTTPSend},
+		Severity:  "critical",
+		MessageID: "audit.chain.url_data_exfil",
+		Weight:    40,
 	},
 	{
-		Name:        "skill_sabotage",
-		Sequence:    []ActionType{ActionModifySkill, ActionHTTPSend},
-		Severity:    "critical",
-		Description: "Xóa skill rồi gửi dữ liệu = phá hoại + rò rỉ",
-		Weight:      45,
+		Name:      "skill_sabotage",
+		Sequence:  []ActionType{ActionModifySkill, ActionHTTPSend},
+		Severity:  "critical",
+		MessageID: "audit.chain.skill_sabotage",
+		Weight:    45,
 	},
 }
 
@@ -121,29 +131,24 @@ type ChainFinding struct {
 	Actions []DetectedAction
 }
 
-// AnalyzeBehaviorChains scans content for dangerous action sequences
+// AnalyzeBehaviorChains scans content for dangerous action sequences,
+// described in i18n.Default
 func AnalyzeBehaviorChains(content string) []ChainFinding {
-	lines := strings.Split(content, "\n")
+	findings, _ := analyzeBehaviorChains(context.Background(), strings.Split(content, "\n"), i18n.Default)
+	return findings
+}
 
-	// Step 1: Find all actions in the document
-	var detected []DetectedAction
-	for lineNum, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
-			continue
-		}
-		for _, ap := range actionPatterns {
-			if ap.Pattern.MatchString(line) {
-				detected = append(detected, DetectedAction{
-					Action: ap.Action,
-					Line:   lineNum + 1,
-				})
-			}
-		}
-	}
+// behaviorChunk is how many lines are scanned between context checks
+const behaviorChunk = 256
 
+// analyzeBehaviorChains scans lines until ctx ends. Chains are matched on
+// the actions found so far; complete is false when ctx ended first.
+func analyzeBehaviorChains(ctx context.Context, lines []string, lang i18n.Lang) (findings []ChainFinding, complete bool) {
+	// Step 1: Find the first occurrence of each action in the document;
+	// chains only refer to that one
+	detected, complete := detectActions(ctx, lines)
 	if len(detected) < 2 {
-		return nil
+		return nil, complete
 	}
 
 	// Step 2: Check if any dangerous chain is present
@@ -152,7 +157,6 @@ func AnalyzeBehaviorChains(content string) []ChainFinding {
 		actionSet[d.Action] = append(actionSet[d.Action], d.Line)
 	}
 
-	var findings []ChainFinding
 	for _, chain := range dangerousChains {
 		matched := true
 		var actions []DetectedAction
@@ -166,11 +170,53 @@ func AnalyzeBehaviorChains(content string) []ChainFinding {
 		}
 		if matched {
 			findings = append(findings, ChainFinding{
-				Chain:   chain,
+				Chain:   chain.in(lang),
 				Actions: actions,
 			})
 		}
 	}
 
-	return findings
+	return findings, complete
+}
+
+// detectActions returns the first occurrence of each action in lines, in
+// order, scanning until ctx ends; complete is false when ctx ended first
+func detectActions(ctx context.Context, lines []string) (detected []DetectedAction, complete bool) {
+	complete = true
+	found := make(map[ActionType]bool)
+	// The actions left to find only shrink, so a line that matched none of
+	// them won't match later either
+	barren := make(map[string]bool)
+	for lineNum, line := range lines {
+		if len(found) == len(actionPatterns) {
+			break
+		}
+		if lineNum%behaviorChunk == 0 && ctx.Err() != nil {
+			complete = false
+			break
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || barren[line] {
+			continue
+		}
+		matched := false
+		for _, ap := range actionPatterns {
+			if found[ap.Action] {
+				continue
+			}
+			if ap.Pattern.MatchString(line) {
+				found[ap.Action] = true
+				matched = true
+				detected = append(detected, DetectedAction{
+					Action: ap.Action,
+					Line:   lineNum + 1,
+				})
+			}
+		}
+		if !matched {
+			barren[line] = true
+		}
+	}
+
+	return detected, complete
 }
@@ -0,0 +1,152 @@
+package auditor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// severityRank orders severities for threshold comparisons
+var severityRank = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// SeverityAtLeast reports whether severity is at or above threshold
+func SeverityAtLeast(severity, threshold string) bool {
+	t, ok := severityRank[strings.ToLower(threshold)]
+	if !ok {
+		return false
+	}
+	return severityRank[strings.ToLower(severity)] >= t
+}
+
+// ValidSeverity reports whether s is a known severity name
+func ValidSeverity(s string) bool {
+	_, ok := severityRank[strings.ToLower(s)]
+	return ok
+}
+
+// Fingerprint identifies a finding independently of its line number:
+// category plus a hash of the whitespace-normalized snippet. Behavior chain
+// findings are identified by chain name only, since their snippet embeds lines.
+func (f Finding) Fingerprint() string {
+	if strings.HasPrefix(f.Category, "behavior:") {
+		return f.Category
+	}
+	snippet := strings.Join(strings.Fields(f.Snippet), " ")
+	sum := sha256.Sum256([]byte(snippet))
+	return f.Category + ":" + hex.EncodeToString(sum[:8])
+}
+
+// DiffReport is the risk delta between two versions of a skill
+type DiffReport struct {
+	Added          []Finding `json:"added"`
+	Resolved       []Finding `json:"resolved"`
+	AddedChains    []string  `json:"added_chains"`
+	ResolvedChains []string  `json:"resolved_chains"`
+	OldScore       float64   `json:"old_score"`
+	NewScore       float64   `json:"new_score"`
+	ScoreDelta     float64   `json:"score_delta"`
+	OldRiskLevel   int       `json:"old_risk_level"`
+	NewRiskLevel   int       `json:"new_risk_level"`
+	OldRiskLabel   string    `json:"old_risk_level_label"`
+	NewRiskLabel   string    `json:"new_risk_level_label"`
+	chainSeverity  map[string]string
+}
+
+// Diff matches findings between two reports by fingerprint. Repeated
+// findings are matched by their occurrences, so a second copy of an
+// existing issue still shows up as added, with the extra occurrences.
+func Diff(oldReport, newReport Report) DiffReport {
+	d := DiffReport{
+		Added:          []Finding{},
+		Resolved:       []Finding{},
+		AddedChains:    []string{},
+		ResolvedChains: []string{},
+		OldScore:       oldReport.Score,
+		NewScore:       newReport.Score,
+		ScoreDelta:     newReport.Score - oldReport.Score,
+		OldRiskLevel:   oldReport.RiskLevel,
+		NewRiskLevel:   newReport.RiskLevel,
+		OldRiskLabel:   oldReport.RiskLevelLabel,
+		NewRiskLabel:   newReport.RiskLevelLabel,
+		chainSeverity:  make(map[string]string),
+	}
+
+	d.Added = unmatched(newReport.Findings, oldReport.Findings)
+	d.Resolved = unmatched(oldReport.Findings, newReport.Findings)
+
+	oldChains := make(map[string]bool)
+	for _, cf := range oldReport.BehaviorChains {
+		oldChains[cf.Chain.Name] = true
+	}
+	newChains := make(map[string]bool)
+	for _, cf := range newReport.BehaviorChains {
+		newChains[cf.Chain.Name] = true
+		d.chainSeverity[cf.Chain.Name] = cf.Chain.Severity
+		if !oldChains[cf.Chain.Name] {
+			d.AddedChains = append(d.AddedChains, cf.Chain.Name)
+		}
+	}
+	for _, cf := range oldReport.BehaviorChains {
+		if !newChains[cf.Chain.Name] {
+			d.ResolvedChains = append(d.ResolvedChains, cf.Chain.Name)
+		}
+	}
+	sort.Strings(d.AddedChains)
+	sort.Strings(d.ResolvedChains)
+
+	return d
+}
+
+// unmatched returns findings in a that have no counterpart in b, with the
+// occurrences b has fewer of. Behavior findings are reported through the
+// chain lists instead.
+func unmatched(a, b []Finding) []Finding {
+	remaining := make(map[string]int)
+	for _, f := range b {
+		remaining[f.Fingerprint()] += max(f.Occurrences, 1)
+	}
+	out := []Finding{}
+	for _, f := range a {
+		if strings.HasPrefix(f.Category, "behavior:") {
+			continue
+		}
+		fp := f.Fingerprint()
+		n := max(f.Occurrences, 1)
+		matched := min(remaining[fp], n)
+		remaining[fp] -= matched
+		if matched == n {
+			continue
+		}
+		f.Occurrences = n - matched
+		out = append(out, f)
+	}
+	return out
+}
+
+// IntroducesAtOrAbove reports whether the new version adds a finding or
+// behavior chain at or above the given severity
+func (d DiffReport) IntroducesAtOrAbove(threshold string) bool {
+	for _, f := range d.Added {
+		if SeverityAtLeast(f.Severity, threshold) {
+			return true
+		}
+	}
+	for _, name := range d.AddedChains {
+		if SeverityAtLeast(d.chainSeverity[name], threshold) {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON returns the diff as formatted JSON bytes
+func (d DiffReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
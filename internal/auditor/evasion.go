@@ -4,7 +4,10 @@ import (
 	"encoding/base64"
 	"regexp"
 	"strings"
+	"time"
 	"unicode"
+
+	"github.com/vurakit/agentveil/internal/i18n"
 )
 
 // Anti-evasion: detect obfuscation techniques used to bypass auditor
@@ -22,10 +25,20 @@ var (
 
 // DeobfuscateLine attempts to reveal hidden instructions in a line
 func DeobfuscateLine(line string) []string {
-	var revealed []string
+	revealed, _ := deobfuscate(line, time.Time{})
+	return revealed
+}
+
+// deobfuscate is DeobfuscateLine with a deadline, checked between steps and
+// between base64 segments. complete is false when it ran out of time.
+func deobfuscate(line string, deadline time.Time) (revealed []string, complete bool) {
+	expired := func() bool { return !deadline.IsZero() && time.Now().After(deadline) }
 
 	// 1. Decode base64 segments
 	for _, match := range base64Pattern.FindAllString(line, -1) {
+		if expired() {
+			return revealed, false
+		}
 		decoded, err := base64.StdEncoding.DecodeString(match)
 		if err == nil && isPrintable(string(decoded)) {
 			revealed = append(revealed, string(decoded))
@@ -38,18 +51,24 @@ func DeobfuscateLine(line string) []string {
 	}
 
 	// 2. Normalize Unicode tricks (homoglyphs, zero-width chars)
+	if expired() {
+		return revealed, false
+	}
 	normalized := normalizeUnicode(line)
 	if normalized != line {
 		revealed = append(revealed, normalized)
 	}
 
 	// 3. Detect split keywords: "by" + "pass" → "bypass"
+	if expired() {
+		return revealed, false
+	}
 	joined := removeSplitters(line)
 	if joined != line {
 		revealed = append(revealed, joined)
 	}
 
-	return revealed
+	return revealed, true
 }
 
 // normalizeUnicode replaces homoglyphs and removes zero-width characters
@@ -86,13 +105,12 @@ var homoglyphs = map[rune]rune{
 	'ｂ': 'b',
 }
 
+var splitterReplacer = strings.NewReplacer(". ", "", " . ", "", ".", "")
+
 // removeSplitters joins words that were split with dots, dashes, spaces to evade detection
 func removeSplitters(s string) string {
 	// "b.y.p.a.s.s" → "bypass", "e x e c" → "exec"
-	replacer := strings.NewReplacer(
-		". ", "", " . ", "", ".", "",
-	)
-	candidate := replacer.Replace(s)
+	candidate := splitterReplacer.Replace(s)
 
 	// Also try removing excessive spaces between single chars: "b y p a s s"
 	words := strings.Fields(s)
@@ -125,9 +143,10 @@ func isPrintable(s string) bool {
 
 // SuspiciousURL represents a URL found with a suspicious trait
 type SuspiciousURL struct {
-	URL    string
-	Line   int
-	Reason string
+	URL       string
+	Line      int
+	Reason    string
+	MessageID string // of Reason
 }
 
 // ExtractSuspiciousURLs scans content for obfuscated or suspicious URLs
@@ -139,27 +158,30 @@ func ExtractSuspiciousURLs(content string) []SuspiciousURL {
 		// Check URL shorteners
 		for _, match := range urlShortenerPattern.FindAllString(line, -1) {
 			results = append(results, SuspiciousURL{
-				URL:    match,
-				Line:   lineNum + 1,
-				Reason: "URL shortener — có thể ẩn đích thực",
+				URL:       match,
+				Line:      lineNum + 1,
+				Reason:    i18n.T(i18n.Default, "audit.url.shortener"),
+				MessageID: "audit.url.shortener",
 			})
 		}
 
 		// Check IP-based URLs (not domain)
 		for _, match := range ipURLPattern.FindAllString(line, -1) {
 			results = append(results, SuspiciousURL{
-				URL:    match,
-				Line:   lineNum + 1,
-				Reason: "URL dùng IP thay vì domain — có thể tránh blocklist",
+				URL:       match,
+				Line:      lineNum + 1,
+				Reason:    i18n.T(i18n.Default, "audit.url.ip"),
+				MessageID: "audit.url.ip",
 			})
 		}
 
 		// Check hex-encoded URLs
 		for _, match := range hexEncodedURL.FindAllString(line, -1) {
 			results = append(results, SuspiciousURL{
-				URL:    match,
-				Line:   lineNum + 1,
-				Reason: "URL chứa hex encoding — có thể obfuscate đường dẫn",
+				URL:       match,
+				Line:      lineNum + 1,
+				Reason:    i18n.T(i18n.Default, "audit.url.hex"),
+				MessageID: "audit.url.hex",
 			})
 		}
 	}
@@ -0,0 +1,73 @@
+package auditor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits bound the work Analyze does on pathological input: huge files,
+// megabyte-long minified lines and large base64 blobs. Zero disables a limit.
+type Limits struct {
+	// MaxContentSize is the largest content AnalyzeContext accepts, in bytes
+	MaxContentSize int
+	// MaxLineLength is where lines are cut before scanning, in bytes. Cut
+	// lines get a truncated_line finding.
+	MaxLineLength int
+	// DeobfuscateBudget is the time the anti-evasion pass may spend on one
+	// line before moving on
+	DeobfuscateBudget time.Duration
+	// BehaviorBudget is the time the behavior chain pass may take in total
+	BehaviorBudget time.Duration
+}
+
+// DefaultLimits keep a worst-case Analyze of MaxContentSize bytes within
+// a few seconds
+func DefaultLimits() Limits {
+	return Limits{
+		MaxContentSize:    2 << 20,
+		MaxLineLength:     16 << 10,
+		DeobfuscateBudget: 50 * time.Millisecond,
+		BehaviorBudget:    2 * time.Second,
+	}
+}
+
+// ErrContentTooLarge is returned by AnalyzeContext for content over
+// Limits.MaxContentSize
+var ErrContentTooLarge = errors.New("content too large")
+
+// Informational finding categories; severity "info" never affects the score
+const (
+	CategoryTruncatedLine      = "truncated_line"
+	CategoryAnalysisIncomplete = "analysis_incomplete"
+)
+
+// SeverityInfo marks findings about the analysis itself
+const SeverityInfo = "info"
+
+// contentTooLarge describes the rejection with both sizes
+func contentTooLarge(size, limit int) error {
+	return fmt.Errorf("%w: %d bytes, limit is %d", ErrContentTooLarge, size, limit)
+}
+
+// capLine cuts line to at most max bytes on a rune boundary
+func capLine(line string, max int) (string, bool) {
+	if max <= 0 || len(line) <= max {
+		return line, false
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut], true
+}
+
+// budgetCtx returns a context that ends after d, or ctx itself when d is zero
+func budgetCtx(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,284 @@
+package auditor
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/i18n"
+)
+
+// ProjectOptions are the false-positive controls of the cross-file chain
+// pass. A directory of unrelated skills would otherwise chain any file that
+// reads data with any other file that sends it.
+type ProjectOptions struct {
+	// RequireReference only chains files linked by explicit references: one
+	// names the other's path or file name, e.g. in a markdown link
+	RequireReference bool
+	// MaxFileDistance is the most reference hops between two files of a
+	// chain; 1 means one file must name the other. 0 means any number.
+	// It implies RequireReference.
+	MaxFileDistance int
+}
+
+// DefaultProjectOptions chain files connected by references at any distance
+func DefaultProjectOptions() ProjectOptions {
+	return ProjectOptions{RequireReference: true}
+}
+
+// FileAction is an action found in one file of a project
+type FileAction struct {
+	File string
+	DetectedAction
+}
+
+// CrossFileChain is a dangerous chain whose actions span several files
+type CrossFileChain struct {
+	Chain   DangerousChain
+	Actions []FileAction
+	Files   []string
+}
+
+// ProjectReport is the audit result of a multi-file project
+type ProjectReport struct {
+	Files           map[string]Report `json:"files"`
+	CrossFileChains []CrossFileChain  `json:"cross_file_chains,omitempty"`
+	// Findings are the cross-file chains as findings; per-file findings
+	// are in Files
+	Findings       []Finding `json:"findings"`
+	RiskLevel      int       `json:"risk_level"`
+	RiskLevelLabel string    `json:"risk_level_label"`
+	Score          float64   `json:"compliance_score"`
+	Summary        string    `json:"summary"`
+	Lang           i18n.Lang `json:"lang"`
+}
+
+// SetProjectOptions replaces the cross-file chain controls,
+// DefaultProjectOptions by default
+func (a *Auditor) SetProjectOptions(o ProjectOptions) {
+	a.project = o
+}
+
+// AnalyzeProject audits files, keyed by path, one by one and then together:
+// chains may span files of the project, within the auditor's
+// ProjectOptions. The project's score is its worst file's less the weight
+// of the cross-file chains.
+func (a *Auditor) AnalyzeProject(files map[string]string) ProjectReport {
+	report, _ := a.analyzeProject(context.Background(), files)
+	return report
+}
+
+// AnalyzeProjectContext is AnalyzeProject for untrusted input: projects
+// over Limits.MaxContentSize in total are rejected with ErrContentTooLarge
+func (a *Auditor) AnalyzeProjectContext(ctx context.Context, files map[string]string) (ProjectReport, error) {
+	if max := a.limits.MaxContentSize; max > 0 {
+		size := 0
+		for _, content := range files {
+			size += len(content)
+		}
+		if size > max {
+			return ProjectReport{}, contentTooLarge(size, max)
+		}
+	}
+	return a.analyzeProject(ctx, files)
+}
+
+// AnalyzeProject audits files with a default Auditor
+func AnalyzeProject(files map[string]string) ProjectReport {
+	return New().AnalyzeProject(files)
+}
+
+func (a *Auditor) analyzeProject(ctx context.Context, files map[string]string) (ProjectReport, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := ProjectReport{Files: make(map[string]Report, len(files)), Findings: []Finding{}}
+	score := 100.0
+	var findings []Finding
+	for _, name := range names {
+		r, err := a.analyze(ctx, files[name])
+		if err != nil {
+			return ProjectReport{}, err
+		}
+		report.Files[name] = r
+		score = min(score, r.Score)
+		findings = append(findings, r.Findings...)
+		report.RiskLevel = max(report.RiskLevel, r.RiskLevel)
+	}
+
+	if a.enableBehavior && len(names) > 1 {
+		bctx, cancel := budgetCtx(ctx, a.limits.BehaviorBudget)
+		chains, complete := a.crossFileChains(bctx, names, files)
+		cancel()
+		if ctx.Err() != nil {
+			return ProjectReport{}, ctx.Err()
+		}
+		if !complete {
+			report.Findings = append(report.Findings, Finding{
+				Severity:    SeverityInfo,
+				Category:    CategoryAnalysisIncomplete,
+				Description: i18n.T(a.lang, "audit.incomplete.cross_file", a.limits.BehaviorBudget),
+				MessageID:   "audit.incomplete.cross_file",
+			})
+		}
+		for _, cf := range chains {
+			score -= float64(cf.Chain.Weight)
+			steps := make([]string, len(cf.Actions))
+			for i, fa := range cf.Actions {
+				steps[i] = fmt.Sprintf("%s:%d %s", fa.File, fa.Line, fa.Action)
+			}
+			report.Findings = append(report.Findings, Finding{
+				Line:        cf.Actions[0].Line,
+				Severity:    cf.Chain.Severity,
+				Category:    "behavior:" + cf.Chain.Name,
+				Description: fmt.Sprintf("%s (%s)", cf.Chain.Description, strings.Join(cf.Files, " → ")),
+				MessageID:   cf.Chain.MessageID,
+				Snippet:     "Chain: " + strings.Join(steps, " → "),
+			})
+		}
+		report.CrossFileChains = chains
+	}
+
+	if score < 0 {
+		score = 0
+	}
+	findings = append(findings, report.Findings...)
+	report.RiskLevel = max(report.RiskLevel, calculateRiskLevel(score, report.Findings))
+	if len(names) == 0 {
+		report.RiskLevel = RiskMinimal
+	}
+	report.Score = score
+	report.RiskLevelLabel = RiskLabel(report.RiskLevel, a.lang)
+	report.Summary = i18n.T(a.lang, "audit.summary.project", len(names), len(report.CrossFileChains), buildSummary(findings, report.RiskLevel, a.lang))
+	report.Lang = a.lang.Code()
+	return report, nil
+}
+
+// crossFileChains matches the dangerous chains on the actions of all files
+// together, keeping those that span more than one file. Chains within one
+// file are in that file's report already.
+func (a *Auditor) crossFileChains(ctx context.Context, names []string, files map[string]string) (chains []CrossFileChain, complete bool) {
+	complete = true
+	byAction := make(map[ActionType][]FileAction)
+	for _, name := range names {
+		lines := strings.Split(files[name], "\n")
+		for i, line := range lines {
+			lines[i], _ = capLine(line, a.limits.MaxLineLength)
+		}
+		detected, ok := detectActions(ctx, lines)
+		if !ok {
+			complete = false
+		}
+		for _, d := range detected {
+			byAction[d.Action] = append(byAction[d.Action], FileAction{File: name, DetectedAction: d})
+		}
+		if !complete {
+			break
+		}
+	}
+
+	dist := fileDistances(names, files)
+	for _, chain := range dangerousChains {
+		var walk func(step int, actions []FileAction)
+		walk = func(step int, actions []FileAction) {
+			if step == len(chain.Sequence) {
+				if cf, ok := a.crossFileChain(chain, actions, dist); ok {
+					chains = append(chains, cf)
+				}
+				return
+			}
+			for _, fa := range byAction[chain.Sequence[step]] {
+				walk(step+1, append(actions[:step:step], fa))
+			}
+		}
+		walk(0, nil)
+	}
+	return chains, complete
+}
+
+// crossFileChain reports whether actions, one per step of chain, span
+// several files that are close enough to chain
+func (a *Auditor) crossFileChain(chain DangerousChain, actions []FileAction, dist map[[2]string]int) (CrossFileChain, bool) {
+	var files []string
+	for _, fa := range actions {
+		if !slices.Contains(files, fa.File) {
+			files = append(files, fa.File)
+		}
+	}
+	if len(files) < 2 {
+		return CrossFileChain{}, false
+	}
+	if a.project.RequireReference || a.project.MaxFileDistance > 0 {
+		for i := range files {
+			for _, other := range files[i+1:] {
+				d, linked := dist[[2]string{files[i], other}]
+				if !linked || (a.project.MaxFileDistance > 0 && d > a.project.MaxFileDistance) {
+					return CrossFileChain{}, false
+				}
+			}
+		}
+	}
+	return CrossFileChain{Chain: chain.in(a.lang), Actions: actions, Files: files}, true
+}
+
+// fileDistances returns the reference hops between every pair of linked
+// files, in both orders. A file references another when it names the
+// other's path or file name; links count in both directions.
+func fileDistances(names []string, files map[string]string) map[[2]string]int {
+	links := make(map[string][]string)
+	for _, from := range names {
+		for _, to := range names {
+			if from != to && (mentions(files[from], to) || mentions(files[from], path.Base(to))) {
+				links[from] = append(links[from], to)
+				links[to] = append(links[to], from)
+			}
+		}
+	}
+
+	dist := make(map[[2]string]int)
+	for _, start := range names {
+		seen := map[string]int{start: 0}
+		queue := []string{start}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, next := range links[cur] {
+				if _, ok := seen[next]; !ok {
+					seen[next] = seen[cur] + 1
+					dist[[2]string{start, next}] = seen[next]
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+	return dist
+}
+
+// mentions reports whether content names name as a whole word, so
+// "tools.md" is not found in "mytools.md"
+func mentions(content, name string) bool {
+	if name == "" || name == "." || name == "/" {
+		return false
+	}
+	for i := 0; ; {
+		j := strings.Index(content[i:], name)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(name)
+		if (start == 0 || !isNameByte(content[start-1])) && (end == len(content) || !isNameByte(content[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isNameByte(b byte) bool {
+	return b == '_' || b == '-' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
@@ -1,8 +1,10 @@
 package auditor
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -17,12 +19,30 @@ type CustomRule struct {
 	Description string `yaml:"description"`
 	Weight      int    `yaml:"weight"`
 	Enabled     bool   `yaml:"enabled"`
+
+	// Lines the rule must and must not flag, checked when the rules load
+	ExamplesMatch   []string `yaml:"examples_match"`
+	ExamplesNoMatch []string `yaml:"examples_nomatch"`
+}
+
+// RuleOverride tunes a built-in rule. Unset fields keep the built-in value.
+type RuleOverride struct {
+	Enabled        *bool  `yaml:"enabled"`
+	Severity       string `yaml:"severity"`
+	Weight         *int   `yaml:"weight"`
+	ReplacePattern string `yaml:"replace_pattern"`
 }
 
 // RulesConfig is the YAML config structure for custom audit rules
 type RulesConfig struct {
 	Rules     []CustomRule      `yaml:"rules"`
 	Overrides map[string]string `yaml:"severity_overrides"` // rule_id -> new severity
+
+	// Builtin tunes built-in rules, keyed by category or by index in Rules
+	Builtin map[string]RuleOverride `yaml:"overrides"`
+
+	// Scoring tunes how repeated findings weigh, see Scoring
+	Scoring *ScoringConfig `yaml:"scoring"`
 }
 
 // ParseRulesConfig parses a YAML string into RulesConfig
@@ -40,9 +60,13 @@ func ParseRulesConfig(data string) (*RulesConfig, error) {
 		if r.Pattern == "" {
 			return nil, fmt.Errorf("rule %s: missing pattern", r.ID)
 		}
-		if _, err := regexp.Compile(r.Pattern); err != nil {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
 			return nil, fmt.Errorf("rule %s: invalid regex: %w", r.ID, err)
 		}
+		if err := checkExamples(re, r); err != nil {
+			return nil, err
+		}
 		if r.Severity == "" {
 			cfg.Rules[i].Severity = "medium"
 		}
@@ -54,9 +78,94 @@ func ParseRulesConfig(data string) (*RulesConfig, error) {
 		}
 	}
 
+	if cfg.Scoring != nil {
+		if err := cfg.Scoring.apply(DefaultScoring()).validate(); err != nil {
+			return nil, fmt.Errorf("scoring: %w", err)
+		}
+	}
+
+	seen := make(map[int]string, len(cfg.Builtin))
+	builtin := defaultPatterns()
+	for key, o := range cfg.Builtin {
+		idx, ok := builtinIndex(key, builtin)
+		if !ok {
+			return nil, fmt.Errorf("override %s: unknown built-in rule", key)
+		}
+		if prev, dup := seen[idx]; dup {
+			return nil, fmt.Errorf("override %s: rule already overridden by %s", key, prev)
+		}
+		seen[idx] = key
+		if o.Severity != "" && !ValidSeverity(o.Severity) {
+			return nil, fmt.Errorf("override %s: unknown severity %q", key, o.Severity)
+		}
+		if o.Weight != nil && *o.Weight < 0 {
+			return nil, fmt.Errorf("override %s: weight must not be negative", key)
+		}
+		if o.ReplacePattern != "" {
+			if _, err := regexp.Compile(o.ReplacePattern); err != nil {
+				return nil, fmt.Errorf("override %s: invalid regex: %w", key, err)
+			}
+		}
+	}
+
 	return &cfg, nil
 }
 
+// builtinIndex resolves an override key, a category or an index, to a
+// built-in rule
+func builtinIndex(key string, builtin []dangerousPattern) (int, bool) {
+	if idx, err := strconv.Atoi(key); err == nil {
+		return idx, idx >= 0 && idx < len(builtin)
+	}
+	for i, dp := range builtin {
+		if dp.Category == key {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// applyBuiltin applies the built-in overrides to patterns, dropping
+// disabled rules, and describes each change in rule order
+func (rc *RulesConfig) applyBuiltin(patterns []dangerousPattern) ([]dangerousPattern, []string) {
+	byIndex := make(map[int]RuleOverride, len(rc.Builtin))
+	for key, o := range rc.Builtin {
+		if idx, ok := builtinIndex(key, patterns); ok {
+			byIndex[idx] = o
+		}
+	}
+
+	var out []dangerousPattern
+	var changes []string
+	for i, dp := range patterns {
+		o, ok := byIndex[i]
+		if !ok {
+			out = append(out, dp)
+			continue
+		}
+		if o.Enabled != nil && !*o.Enabled {
+			changes = append(changes, dp.Category+" disabled")
+			continue
+		}
+		if o.Severity != "" && o.Severity != dp.Severity {
+			dp.Severity = strings.ToLower(o.Severity)
+			changes = append(changes, dp.Category+" severity "+dp.Severity)
+		}
+		if o.Weight != nil && *o.Weight != dp.Weight {
+			dp.Weight = *o.Weight
+			changes = append(changes, fmt.Sprintf("%s weight %d", dp.Category, dp.Weight))
+		}
+		if o.ReplacePattern != "" {
+			if re, err := regexp.Compile(o.ReplacePattern); err == nil {
+				dp.Pattern = re
+				changes = append(changes, dp.Category+" pattern replaced")
+			}
+		}
+		out = append(out, dp)
+	}
+	return out, changes
+}
+
 // ToPatterns converts custom rules to dangerousPattern slice
 func (rc *RulesConfig) ToPatterns() []dangerousPattern {
 	var patterns []dangerousPattern
@@ -77,6 +186,7 @@ func (rc *RulesConfig) ToPatterns() []dangerousPattern {
 		}
 
 		patterns = append(patterns, dangerousPattern{
+			ID:          r.ID,
 			Pattern:     compiled,
 			Severity:    severity,
 			Category:    r.Category,
@@ -87,6 +197,109 @@ func (rc *RulesConfig) ToPatterns() []dangerousPattern {
 	return patterns
 }
 
+// checkExamples verifies a rule flags each of its match examples and none
+// of its no-match examples, the way Analyze would
+func checkExamples(re *regexp.Regexp, r CustomRule) error {
+	for _, ex := range r.ExamplesMatch {
+		if matched, _ := matchLine(re, ex, true); !matched {
+			return fmt.Errorf("rule %s: does not match its example %q", r.ID, ex)
+		}
+	}
+	for _, ex := range r.ExamplesNoMatch {
+		if matched, _ := matchLine(re, ex, true); matched {
+			return fmt.Errorf("rule %s: matches its counter-example %q", r.ID, ex)
+		}
+	}
+	return nil
+}
+
+// matchLine reports whether re matches line, and whether it only did
+// after deobfuscation when evasion is set
+func matchLine(re *regexp.Regexp, line string, evasion bool) (matched, deobfuscated bool) {
+	if re.MatchString(line) {
+		return true, false
+	}
+	if evasion {
+		for _, rev := range DeobfuscateLine(line) {
+			if re.MatchString(rev) {
+				return true, true
+			}
+		}
+	}
+	return false, false
+}
+
+// Rule describes one pattern rule of an Auditor
+type Rule struct {
+	ID          string `json:"id"`
+	Source      string `json:"source"` // builtin or custom
+	Category    string `json:"category"`
+	Severity    string `json:"severity"`
+	Weight      int    `json:"weight"`
+	Description string `json:"description"`
+	MessageID   string `json:"message_id,omitempty"` // of built-in descriptions
+	Pattern     string `json:"pattern"`
+}
+
+// SampleResult is the outcome of testing one sample against a rule
+type SampleResult struct {
+	Sample  string `json:"sample"`
+	Matched bool   `json:"matched"`
+	// Deobfuscated is set when the sample only matched once decoded
+	// (base64, homoglyphs, character splitting), as in Analyze
+	Deobfuscated bool `json:"deobfuscated,omitempty"`
+}
+
+// ErrUnknownRule is returned by TestRule for an id not in Rules
+var ErrUnknownRule = errors.New("unknown rule")
+
+// Rules lists the built-in and custom pattern rules in evaluation order.
+// Built-in rules use their category as id.
+func (a *Auditor) Rules() []Rule {
+	rules := make([]Rule, len(a.patterns))
+	for i, dp := range a.patterns {
+		rules[i] = Rule{
+			ID:          dp.ID,
+			Source:      "custom",
+			Category:    dp.Category,
+			Severity:    dp.Severity,
+			Weight:      dp.Weight,
+			Description: dp.describe(a.lang),
+			MessageID:   dp.MessageID,
+			Pattern:     dp.Pattern.String(),
+		}
+		if dp.ID == "" {
+			rules[i].ID, rules[i].Source = dp.Category, "builtin"
+		}
+	}
+	return rules
+}
+
+// TestRule reports which samples the rule with the given id flags
+func (a *Auditor) TestRule(id string, samples []string) ([]SampleResult, error) {
+	for _, r := range a.Rules() {
+		if r.ID == id {
+			return a.TestPattern(r.Pattern, samples)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownRule, id)
+}
+
+// TestPattern reports which samples an inline regex flags, with the same
+// deobfuscation Analyze applies
+func (a *Auditor) TestPattern(pattern string, samples []string) ([]SampleResult, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	results := make([]SampleResult, len(samples))
+	for i, sample := range samples {
+		matched, deobfuscated := matchLine(re, sample, a.enableEvasion)
+		results[i] = SampleResult{Sample: sample, Matched: matched, Deobfuscated: deobfuscated}
+	}
+	return results, nil
+}
+
 // MergeMarkdownSections parses markdown and returns a map of section -> content
 func MergeMarkdownSections(content string) map[string]string {
 	sections := make(map[string]string)
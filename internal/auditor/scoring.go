@@ -0,0 +1,119 @@
+package auditor
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Scoring sets how repeated findings weigh on the compliance score. A skill
+// that repeats one instruction ten times has one issue, not ten, so repeats
+// of a finding count less and less, and a category can only take so much
+// off the score.
+type Scoring struct {
+	// RepeatDecay multiplies the weight of each further occurrence of a
+	// finding: the first counts in full, the second RepeatDecay times its
+	// weight, the third RepeatDecay² and so on. 1 counts every occurrence in
+	// full, 0 only the first.
+	RepeatDecay float64
+	// CategoryCap is the most one category takes off the score, though
+	// never less than its heaviest finding; 0 means no cap
+	CategoryCap int
+}
+
+// DefaultScoring halves each repeat and caps a category at 60 points, so a
+// critical finding repeated any number of times leaves a score of 40 while
+// two different ones still take it below 30
+func DefaultScoring() Scoring {
+	return Scoring{RepeatDecay: 0.5, CategoryCap: 60}
+}
+
+// ScoringConfig is the scoring section of a rules file. Unset fields keep
+// the DefaultScoring value.
+type ScoringConfig struct {
+	RepeatDecay *float64 `yaml:"repeat_decay"`
+	CategoryCap *int     `yaml:"category_cap"`
+}
+
+// apply returns s with the fields c sets
+func (c ScoringConfig) apply(s Scoring) Scoring {
+	if c.RepeatDecay != nil {
+		s.RepeatDecay = *c.RepeatDecay
+	}
+	if c.CategoryCap != nil {
+		s.CategoryCap = *c.CategoryCap
+	}
+	return s
+}
+
+// validate rejects a decay outside [0, 1] and a negative cap
+func (s Scoring) validate() error {
+	if s.RepeatDecay < 0 || s.RepeatDecay > 1 {
+		return fmt.Errorf("repeat_decay must be between 0 and 1, got %v", s.RepeatDecay)
+	}
+	if s.CategoryCap < 0 {
+		return fmt.Errorf("category_cap must not be negative, got %d", s.CategoryCap)
+	}
+	return nil
+}
+
+// weigh returns the points aggregated findings take off the score
+func (s Scoring) weigh(findings []Finding) float64 {
+	type category struct {
+		total    float64
+		heaviest int
+	}
+	var order []string
+	categories := make(map[string]*category)
+	for _, f := range findings {
+		if f.weight == 0 {
+			continue
+		}
+		c := categories[f.Category]
+		if c == nil {
+			c = &category{}
+			categories[f.Category] = c
+			order = append(order, f.Category)
+		}
+		c.heaviest = max(c.heaviest, f.weight)
+		for k := 0; k < max(f.Occurrences, 1); k++ {
+			c.total += float64(f.weight) * math.Pow(s.RepeatDecay, float64(k))
+		}
+	}
+	total := 0.0
+	for _, name := range order {
+		c := categories[name]
+		if s.CategoryCap > 0 {
+			c.total = min(c.total, float64(max(s.CategoryCap, c.heaviest)))
+		}
+		total += c.total
+	}
+	return total
+}
+
+// aggregate collapses findings with the same category and description into
+// the first of them, counting the occurrences and collecting their lines
+func aggregate(findings []Finding) []Finding {
+	var out []Finding
+	index := make(map[string]int)
+	for _, f := range findings {
+		key := f.Category + "\x00" + f.Description
+		i, seen := index[key]
+		if !seen {
+			index[key] = len(out)
+			f.Occurrences = 0
+			f.Lines = nil
+			out = append(out, f)
+			i = len(out) - 1
+		}
+		agg := &out[i]
+		agg.Occurrences++
+		if f.Line > 0 && !slices.Contains(agg.Lines, f.Line) {
+			agg.Lines = append(agg.Lines, f.Line)
+		}
+	}
+	for i := range out {
+		slices.Sort(out[i].Lines)
+	}
+	return out
+}
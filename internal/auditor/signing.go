@@ -0,0 +1,234 @@
+package auditor
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureVersion is the version of the Signature format
+const SignatureVersion = 1
+
+// Verification errors. ErrBadSignature and ErrTampered mean the skill or
+// its signature can't be trusted; ErrExpired and ErrTooRisky mean it was
+// signed as audited, but doesn't meet the verifier's policy.
+var (
+	ErrBadSignature = errors.New("signature invalid or not made by this key")
+	ErrTampered     = errors.New("content changed since it was signed")
+	ErrExpired      = errors.New("signature expired")
+	ErrTooRisky     = errors.New("risk level above the allowed maximum")
+)
+
+// Integrity reports whether err means the skill or its signature was
+// tampered with, as opposed to failing the verifier's policy
+func Integrity(err error) bool {
+	return errors.Is(err, ErrBadSignature) || errors.Is(err, ErrTampered)
+}
+
+// Signature attests that a skill passed audit at or below MaxRisk. It is
+// written next to the skill as <file>.sig, or embedded in it with
+// EmbedSignature.
+type Signature struct {
+	Version int `json:"version"`
+	// ContentSHA256 is the hash of the canonicalized skill content
+	ContentSHA256 string `json:"content_sha256"`
+	// ReportSHA256 is the hash of the audit report's JSON, so a published
+	// report can be matched to the signature
+	ReportSHA256 string  `json:"report_sha256"`
+	RiskLevel    int     `json:"risk_level"`
+	Score        float64 `json:"compliance_score"`
+	// MaxRisk is the threshold the skill was signed at
+	MaxRisk   int        `json:"max_risk"`
+	SignedAt  time.Time  `json:"signed_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil = no expiry
+	KeyID     string     `json:"key_id"`               // of the public key
+	Signature string     `json:"signature"`            // base64 Ed25519 over the fields above
+}
+
+// SignOptions are the policy a skill is signed under
+type SignOptions struct {
+	MaxRisk int           // highest risk level signed, RiskLimited when 0
+	MaxAge  time.Duration // the signature expires after this, 0 = never
+	Now     time.Time     // signing time, time.Now() when zero
+}
+
+// VerifyOptions are the policy a signed skill must meet
+type VerifyOptions struct {
+	MaxRisk int       // highest risk level accepted, RiskLimited when 0
+	Now     time.Time // time.Now() when zero
+}
+
+// riskNames are the names ParseRiskLevel accepts
+var riskNames = map[string]int{
+	"minimal":      RiskMinimal,
+	"limited":      RiskLimited,
+	"high":         RiskHigh,
+	"unacceptable": RiskUnacceptable,
+}
+
+// ParseRiskLevel parses a risk level by name (minimal, limited, high,
+// unacceptable) or number (1-4)
+func ParseRiskLevel(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if level, ok := riskNames[s]; ok {
+		return level, nil
+	}
+	if level, err := strconv.Atoi(s); err == nil && level >= RiskMinimal && level <= RiskUnacceptable {
+		return level, nil
+	}
+	return 0, fmt.Errorf("unknown risk level %q (want minimal, limited, high or unacceptable)", s)
+}
+
+// KeyID identifies an Ed25519 public key: the first 8 bytes of its SHA-256
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Canonicalize normalizes skill content before hashing, so editors that
+// change line endings, a byte order mark or trailing whitespace don't
+// break a signature. An embedded signature is not part of the content.
+func Canonicalize(content string) []byte {
+	content, _, _ = cutSignature(content)
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return []byte(strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n")
+}
+
+// SignReport signs content with the report of its audit. A report above
+// opts.MaxRisk is not signed and returns ErrTooRisky.
+func SignReport(key ed25519.PrivateKey, content string, report Report, opts SignOptions) (*Signature, error) {
+	maxRisk := opts.MaxRisk
+	if maxRisk == 0 {
+		maxRisk = RiskLimited
+	}
+	if report.RiskLevel > maxRisk {
+		return nil, fmt.Errorf("%w: %s (%d/4), signing allows %d/4", ErrTooRisky, report.RiskLevelLabel, report.RiskLevel, maxRisk)
+	}
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("encode report: %w", err)
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	contentSum := sha256.Sum256(Canonicalize(content))
+	reportSum := sha256.Sum256(reportJSON)
+	sig := &Signature{
+		Version:       SignatureVersion,
+		ContentSHA256: hex.EncodeToString(contentSum[:]),
+		ReportSHA256:  hex.EncodeToString(reportSum[:]),
+		RiskLevel:     report.RiskLevel,
+		Score:         report.Score,
+		MaxRisk:       maxRisk,
+		SignedAt:      now.UTC().Truncate(time.Second),
+		KeyID:         KeyID(key.Public().(ed25519.PublicKey)),
+	}
+	if opts.MaxAge > 0 {
+		expires := sig.SignedAt.Add(opts.MaxAge)
+		sig.ExpiresAt = &expires
+	}
+	payload, err := sig.payload()
+	if err != nil {
+		return nil, err
+	}
+	sig.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	return sig, nil
+}
+
+// VerifySigned checks sig was made by pub over content, that content is
+// unchanged, that the signature hasn't expired and that the audited risk
+// level meets opts.MaxRisk, in that order
+func VerifySigned(pub ed25519.PublicKey, content string, sig Signature, opts VerifyOptions) error {
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil || sig.Version != SignatureVersion {
+		return ErrBadSignature
+	}
+	payload, err := sig.payload()
+	if err != nil || !ed25519.Verify(pub, payload, raw) {
+		return ErrBadSignature
+	}
+	sum := sha256.Sum256(Canonicalize(content))
+	if hex.EncodeToString(sum[:]) != sig.ContentSHA256 {
+		return ErrTampered
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if sig.ExpiresAt != nil && now.After(*sig.ExpiresAt) {
+		return fmt.Errorf("%w at %s", ErrExpired, sig.ExpiresAt.Format(time.RFC3339))
+	}
+	maxRisk := opts.MaxRisk
+	if maxRisk == 0 {
+		maxRisk = RiskLimited
+	}
+	if sig.RiskLevel > maxRisk {
+		return fmt.Errorf("%w: audited at %d/4, %d/4 allowed", ErrTooRisky, sig.RiskLevel, maxRisk)
+	}
+	return nil
+}
+
+// payload is what the signature covers: the signature's JSON without the
+// signature itself
+func (s Signature) payload() ([]byte, error) {
+	s.Signature = ""
+	return json.Marshal(s)
+}
+
+// signatureMarker starts the comment EmbedSignature appends to a skill
+const signatureMarker = "<!-- agentveil-signature: "
+
+// EmbedSignature returns content with sig appended as an HTML comment,
+// which Markdown renderers hide. A signature already embedded is replaced.
+func EmbedSignature(content string, sig Signature) (string, error) {
+	data, err := json.Marshal(sig)
+	if err != nil {
+		return "", err
+	}
+	content, _, _ = cutSignature(content)
+	return strings.TrimRight(content, "\n") + "\n\n" + signatureMarker + base64.StdEncoding.EncodeToString(data) + " -->\n", nil
+}
+
+// ExtractSignature returns content without its embedded signature, and
+// the signature; found is false when content has none
+func ExtractSignature(content string) (rest string, sig Signature, found bool, err error) {
+	rest, encoded, found := cutSignature(content)
+	if !found {
+		return content, sig, false, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err == nil {
+		err = json.Unmarshal(data, &sig)
+	}
+	if err != nil {
+		return rest, sig, true, fmt.Errorf("%w: malformed embedded signature", ErrBadSignature)
+	}
+	return rest, sig, true, nil
+}
+
+// cutSignature splits an embedded signature off the end of content
+func cutSignature(content string) (rest, encoded string, found bool) {
+	i := strings.LastIndex(content, signatureMarker)
+	if i < 0 {
+		return content, "", false
+	}
+	tail := strings.TrimSpace(content[i+len(signatureMarker):])
+	encoded, ok := strings.CutSuffix(tail, "-->")
+	if !ok || strings.Contains(encoded, "\n") {
+		return content, "", false
+	}
+	return strings.TrimRight(content[:i], "\n") + "\n", strings.TrimSpace(encoded), true
+}
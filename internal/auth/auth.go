@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -18,6 +19,8 @@ const (
 	RoleAdmin    Role = "admin"
 	RoleViewer   Role = "viewer"
 	RoleOperator Role = "operator"
+	// RoleAuditor may inspect vault resolutions but only sees masked values
+	RoleAuditor Role = "auditor"
 )
 
 // APIKey represents a registered API key with its metadata
@@ -28,17 +31,37 @@ type APIKey struct {
 	Label     string    `json:"label"`
 	CreatedAt time.Time `json:"created_at"`
 	Active    bool      `json:"active"`
+	// DetectorProfile names the detector profile applied to the key's
+	// requests, empty for the proxy's defaults
+	DetectorProfile string `json:"detector_profile,omitempty"`
+	// RateLimit and RateBurst are the key's own requests per minute and
+	// burst, zero for the proxy's per-key defaults
+	RateLimit int `json:"rate_limit,omitempty"`
+	RateBurst int `json:"rate_burst,omitempty"`
 }
 
 // Manager handles API key operations
 type Manager struct {
-	client *redis.Client
-	prefix string
+	client    redis.UniversalClient
+	prefix    string
+	locations []KeyLocation
+}
+
+// ManagerOption configures a Manager
+type ManagerOption func(*Manager)
+
+// WithKeyLocations restricts where Middleware looks for the Veil key, in order
+func WithKeyLocations(locs ...KeyLocation) ManagerOption {
+	return func(m *Manager) { m.locations = locs }
 }
 
 // NewManager creates an auth Manager
-func NewManager(client *redis.Client) *Manager {
-	return &Manager{client: client, prefix: "auth:apikey:"}
+func NewManager(client redis.UniversalClient, opts ...ManagerOption) *Manager {
+	m := &Manager{client: client, prefix: "auth:apikey:", locations: DefaultKeyLocations}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // GenerateKey creates a new API key and stores its hash in Redis.
@@ -96,14 +119,19 @@ func (m *Manager) Validate(ctx context.Context, plaintext string) (*APIKey, erro
 	}
 
 	createdAt, _ := time.Parse(time.RFC3339, data["created_at"])
+	rateLimit, _ := strconv.Atoi(data["rate_limit"])
+	rateBurst, _ := strconv.Atoi(data["rate_burst"])
 
 	return &APIKey{
-		ID:        data["id"],
-		KeyHash:   hash,
-		Role:      Role(data["role"]),
-		Label:     data["label"],
-		CreatedAt: createdAt,
-		Active:    true,
+		ID:              data["id"],
+		KeyHash:         hash,
+		Role:            Role(data["role"]),
+		Label:           data["label"],
+		CreatedAt:       createdAt,
+		Active:          true,
+		DetectorProfile: data["detector_profile"],
+		RateLimit:       rateLimit,
+		RateBurst:       rateBurst,
 	}, nil
 }
 
@@ -116,16 +144,55 @@ func (m *Manager) Revoke(ctx context.Context, plaintext string) error {
 
 // RevokeByID deactivates an API key by its ID (searches all keys)
 func (m *Manager) RevokeByID(ctx context.Context, id string) error {
+	key, err := m.findByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return m.client.HSet(ctx, key, "active", "false").Err()
+}
+
+// SetDetectorProfile assigns a detector profile to the key with the given
+// ID; an empty profile restores the defaults
+func (m *Manager) SetDetectorProfile(ctx context.Context, id, profile string) error {
+	key, err := m.findByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if profile == "" {
+		return m.client.HDel(ctx, key, "detector_profile").Err()
+	}
+	return m.client.HSet(ctx, key, "detector_profile", profile).Err()
+}
+
+// SetRateLimit gives the key with the given ID its own rate limit: perMinute
+// requests a minute, in bursts of up to burst (0 for perMinute). A
+// perMinute of 0 restores the defaults.
+func (m *Manager) SetRateLimit(ctx context.Context, id string, perMinute, burst int) error {
+	if perMinute < 0 || burst < 0 {
+		return fmt.Errorf("rate limit must not be negative")
+	}
+	key, err := m.findByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if perMinute == 0 {
+		return m.client.HDel(ctx, key, "rate_limit", "rate_burst").Err()
+	}
+	return m.client.HSet(ctx, key, "rate_limit", perMinute, "rate_burst", burst).Err()
+}
+
+// findByID returns the Redis key of the API key with the given ID
+func (m *Manager) findByID(ctx context.Context, id string) (string, error) {
 	var cursor uint64
 	for {
 		keys, nextCursor, err := m.client.Scan(ctx, cursor, m.prefix+"*", 100).Result()
 		if err != nil {
-			return err
+			return "", err
 		}
 		for _, key := range keys {
 			storedID, _ := m.client.HGet(ctx, key, "id").Result()
 			if storedID == id {
-				return m.client.HSet(ctx, key, "active", "false").Err()
+				return key, nil
 			}
 		}
 		cursor = nextCursor
@@ -133,7 +200,7 @@ func (m *Manager) RevokeByID(ctx context.Context, id string) error {
 			break
 		}
 	}
-	return fmt.Errorf("key ID %s not found", id)
+	return "", fmt.Errorf("key ID %s not found", id)
 }
 
 func hashKey(plaintext string) string {
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -90,6 +91,87 @@ func TestRevokeByID(t *testing.T) {
 	}
 }
 
+func TestSetDetectorProfile(t *testing.T) {
+	mgr := setupTestAuth(t)
+	ctx := context.Background()
+
+	plaintext, key, _ := mgr.GenerateKey(ctx, RoleOperator, "support bot")
+	if err := mgr.SetDetectorProfile(ctx, key.ID, "strict"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mgr.Validate(ctx, plaintext); got.DetectorProfile != "strict" {
+		t.Errorf("profile = %q, want strict", got.DetectorProfile)
+	}
+	if err := mgr.SetDetectorProfile(ctx, "missing", "strict"); err == nil {
+		t.Error("expected error for unknown key ID")
+	}
+
+	// The middleware vouches for the key's profile and drops forged ones
+	var profiles []string
+	handler := mgr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		profiles = append(profiles, r.Header.Get("X-Veil-Detector-Profile"))
+	}))
+	other, _, _ := mgr.GenerateKey(ctx, RoleOperator, "code assistant")
+	for _, k := range []string{plaintext, other} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/test", nil)
+		req.Header.Set("X-Veil-Key", k)
+		req.Header.Set("X-Veil-Detector-Profile", "lax")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(profiles) != 2 || profiles[0] != "strict" || profiles[1] != "" {
+		t.Errorf("profiles = %q, want [strict \"\"]", profiles)
+	}
+
+	if err := mgr.SetDetectorProfile(ctx, key.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mgr.Validate(ctx, plaintext); got.DetectorProfile != "" {
+		t.Errorf("profile = %q after reset", got.DetectorProfile)
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	mgr := setupTestAuth(t)
+	ctx := context.Background()
+
+	plaintext, key, _ := mgr.GenerateKey(ctx, RoleOperator, "batch jobs")
+	if err := mgr.SetRateLimit(ctx, key.ID, 600, 50); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mgr.Validate(ctx, plaintext); got.RateLimit != 600 || got.RateBurst != 50 {
+		t.Errorf("rate limit = %d/%d, want 600/50", got.RateLimit, got.RateBurst)
+	}
+	if err := mgr.SetRateLimit(ctx, key.ID, -1, 0); err == nil {
+		t.Error("expected error for a negative limit")
+	}
+
+	// The middleware hands the key on in the request context, and nothing
+	// about its label or limit in headers
+	var got []*APIKey
+	handler := mgr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, KeyFromContext(r.Context()))
+		for name, values := range r.Header {
+			if strings.Contains(strings.Join(values, ","), "batch jobs") {
+				t.Errorf("the key's label is in header %s", name)
+			}
+		}
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/v1/test", nil)
+	req.Header.Set("X-Veil-Key", plaintext)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/test", nil))
+	if len(got) != 1 || got[0] == nil || got[0].ID != key.ID || got[0].Label != "batch jobs" || got[0].RateLimit != 600 || got[0].RateBurst != 50 {
+		t.Errorf("keys in context = %+v", got)
+	}
+
+	if err := mgr.SetRateLimit(ctx, key.ID, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mgr.Validate(ctx, plaintext); got.RateLimit != 0 || got.RateBurst != 0 {
+		t.Errorf("rate limit = %d/%d after reset", got.RateLimit, got.RateBurst)
+	}
+}
+
 func TestMiddleware_ValidKey(t *testing.T) {
 	mgr := setupTestAuth(t)
 	ctx := context.Background()
@@ -176,3 +258,197 @@ func TestMiddleware_RoleOverride(t *testing.T) {
 		t.Errorf("expected forced viewer role, got %s", capturedRole)
 	}
 }
+
+func TestMiddleware_KeyLocations(t *testing.T) {
+	mgr := setupTestAuth(t)
+	plaintext, _, _ := mgr.GenerateKey(context.Background(), RoleOperator, "locations")
+
+	tests := []struct {
+		name  string
+		setup func(r *http.Request)
+	}{
+		{"X-Veil-Key header", func(r *http.Request) { r.Header.Set("X-Veil-Key", plaintext) }},
+		{"Authorization bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+plaintext) }},
+		{"x-api-key header", func(r *http.Request) { r.Header.Set("x-api-key", plaintext) }},
+		{"key query param", func(r *http.Request) {
+			r.URL.RawQuery = "alt=sse&key=" + plaintext
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var forwarded *http.Request
+			handler := mgr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = r
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/test", nil)
+			tt.setup(req)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if role := forwarded.Header.Get("X-User-Role"); role != "operator" {
+				t.Errorf("expected role operator, got %q", role)
+			}
+			assertNoVeilKey(t, forwarded, plaintext)
+			if tt.name == "key query param" && forwarded.URL.Query().Get("alt") != "sse" {
+				t.Errorf("other query params must survive key removal, got %q", forwarded.URL.RawQuery)
+			}
+		})
+	}
+}
+
+func TestMiddleware_KeyRemovedKeepsUpstreamCredential(t *testing.T) {
+	mgr := setupTestAuth(t)
+	plaintext, _, _ := mgr.GenerateKey(context.Background(), RoleAdmin, "dual")
+
+	var forwarded *http.Request
+	handler := mgr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+	}))
+
+	// Veil key in X-Veil-Key and again in x-api-key; user's own provider key in Authorization
+	req := httptest.NewRequest(http.MethodPost, "/v1/test", nil)
+	req.Header.Set("X-Veil-Key", plaintext)
+	req.Header.Set("x-api-key", plaintext)
+	req.Header.Set("Authorization", "Bearer sk-upstream-key")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if forwarded == nil {
+		t.Fatal("request was not forwarded")
+	}
+	assertNoVeilKey(t, forwarded, plaintext)
+	if got := forwarded.Header.Get("Authorization"); got != "Bearer sk-upstream-key" {
+		t.Errorf("upstream credential must pass through, got %q", got)
+	}
+}
+
+func TestMiddleware_RestrictedLocations(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mgr := NewManager(client, WithKeyLocations(LocationVeilHeader))
+	plaintext, _, _ := mgr.GenerateKey(context.Background(), RoleViewer, "restricted")
+
+	handler := mgr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/test?key="+plaintext, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for key in disabled location, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/test", nil)
+	req.Header.Set("X-Veil-Key", plaintext)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for key in enabled location, got %d", rec.Code)
+	}
+}
+
+func TestParseKeyLocations(t *testing.T) {
+	locs, err := ParseKeyLocations("Header, bearer,query")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []KeyLocation{LocationVeilHeader, LocationBearer, LocationQuery}
+	if len(locs) != len(want) {
+		t.Fatalf("got %v, want %v", locs, want)
+	}
+	for i := range want {
+		if locs[i] != want[i] {
+			t.Errorf("location %d: got %s, want %s", i, locs[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"", "cookie", "header,body"} {
+		if _, err := ParseKeyLocations(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func assertNoVeilKey(t *testing.T, r *http.Request, key string) {
+	t.Helper()
+	for name, values := range r.Header {
+		for _, v := range values {
+			if strings.Contains(v, key) {
+				t.Errorf("veil key leaked upstream in header %s", name)
+			}
+		}
+	}
+	if strings.Contains(r.URL.RawQuery, key) {
+		t.Errorf("veil key leaked upstream in query %q", r.URL.RawQuery)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	mgr := setupTestAuth(t)
+	ctx := context.Background()
+	adminKey, _, _ := mgr.GenerateKey(ctx, RoleAdmin, "admin")
+	viewerKey, _, _ := mgr.GenerateKey(ctx, RoleViewer, "viewer")
+
+	handler := mgr.RequireRole(RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		setup  func(r *http.Request)
+		expect int
+	}{
+		{"admin key", func(r *http.Request) { r.Header.Set("X-Veil-Key", adminKey) }, http.StatusOK},
+		{"viewer key", func(r *http.Request) { r.Header.Set("X-Veil-Key", viewerKey) }, http.StatusForbidden},
+		{"upstream key with spoofed headers", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer sk-upstream")
+			r.Header.Set("X-User-Role", "admin")
+			r.Header.Set("X-Veil-Key-ID", "forged")
+		}, http.StatusForbidden},
+		{"no key", func(r *http.Request) {}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/x", nil)
+			tt.setup(req)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expect {
+				t.Errorf("expected %d, got %d", tt.expect, rec.Code)
+			}
+		})
+	}
+}
+
+func TestWhoAmIHandler(t *testing.T) {
+	mgr := setupTestAuth(t)
+	plaintext, key, _ := mgr.GenerateKey(context.Background(), RoleViewer, "dev")
+	handler := mgr.WhoAmIHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/whoami", nil)
+	req.Header.Set("X-Veil-Key", plaintext)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var info KeyInfo
+	json.Unmarshal(rec.Body.Bytes(), &info)
+	if rec.Code != http.StatusOK || info.KeyID != key.ID || info.Role != RoleViewer {
+		t.Errorf("valid key: %d %s", rec.Code, rec.Body)
+	}
+
+	for name, header := range map[string]string{"upstream key": "Bearer sk-upstream", "revoked key": "Bearer veil_sk_nope"} {
+		req := httptest.NewRequest(http.MethodGet, "/auth/whoami", nil)
+		req.Header.Set("Authorization", header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, rec.Code)
+		}
+	}
+}
@@ -1,34 +1,134 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
 )
 
+// KeyLocation is a place in the request the Veil API key may be read from
+type KeyLocation string
+
+const (
+	LocationVeilHeader KeyLocation = "header"    // X-Veil-Key: <key>
+	LocationBearer     KeyLocation = "bearer"    // Authorization: Bearer <key> (OpenAI SDKs)
+	LocationAPIKey     KeyLocation = "x-api-key" // x-api-key: <key> (Anthropic SDKs, Claude Code)
+	LocationQuery      KeyLocation = "query"     // ?key=<key> (Gemini SDK)
+)
+
+// DefaultKeyLocations is the lookup order used unless restricted
+var DefaultKeyLocations = []KeyLocation{LocationVeilHeader, LocationBearer, LocationAPIKey, LocationQuery}
+
+// veilKeyPrefix marks keys issued by GenerateKey; anything else is an
+// upstream credential and passes through untouched
+const veilKeyPrefix = "veil_sk_"
+
+// ParseKeyLocations parses a comma-separated list such as "header,bearer"
+func ParseKeyLocations(s string) ([]KeyLocation, error) {
+	var locs []KeyLocation
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		loc := KeyLocation(part)
+		switch loc {
+		case LocationVeilHeader, LocationBearer, LocationAPIKey, LocationQuery:
+			locs = append(locs, loc)
+		default:
+			return nil, fmt.Errorf("unknown key location %q (want header, bearer, x-api-key or query)", part)
+		}
+	}
+	if len(locs) == 0 {
+		return nil, fmt.Errorf("no key locations given")
+	}
+	return locs, nil
+}
+
+// credential reads the raw credential at loc, if any
+func credential(r *http.Request, loc KeyLocation) string {
+	switch loc {
+	case LocationVeilHeader:
+		return r.Header.Get("X-Veil-Key")
+	case LocationBearer:
+		parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "bearer") {
+			return strings.TrimSpace(parts[1])
+		}
+	case LocationAPIKey:
+		return r.Header.Get("x-api-key")
+	case LocationQuery:
+		return r.URL.Query().Get("key")
+	}
+	return ""
+}
+
+// removeCredential strips the credential at loc so it never reaches upstream
+func removeCredential(r *http.Request, loc KeyLocation) {
+	switch loc {
+	case LocationVeilHeader:
+		r.Header.Del("X-Veil-Key")
+	case LocationBearer:
+		r.Header.Del("Authorization")
+	case LocationAPIKey:
+		r.Header.Del("x-api-key")
+	case LocationQuery:
+		q := r.URL.Query()
+		q.Del("key")
+		r.URL.RawQuery = q.Encode()
+	}
+}
+
 // Middleware returns an HTTP middleware that validates API keys.
-// If the key is valid, it sets X-User-Role from the key's bound role
-// (overriding any client-provided value) and passes to the next handler.
+// The Veil key is looked up in the configured locations in order (by default
+// X-Veil-Key, Authorization: Bearer, x-api-key, ?key=). If the key is valid,
+// it sets X-User-Role from the key's bound role (overriding any
+// client-provided value), removes the key from the request so it never
+// leaks upstream, and passes to the next handler.
 func (m *Manager) Middleware(next http.Handler) http.Handler {
+	enabled := make(map[KeyLocation]bool, len(m.locations))
+	for _, loc := range m.locations {
+		enabled[loc] = true
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Support both "Authorization: Bearer <key>" (OpenAI) and "x-api-key: <key>" (Anthropic)
-		var token string
-		if authHeader := r.Header.Get("Authorization"); authHeader != "" {
-			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
-				http.Error(w, `{"error":"unauthorized","message":"invalid Authorization format"}`, http.StatusUnauthorized)
+		// Only this middleware may vouch for a key and its detector profile
+		r.Header.Del("X-Veil-Key-ID")
+		r.Header.Del("X-Veil-Detector-Profile")
+
+		if authHeader := r.Header.Get("Authorization"); authHeader != "" && credential(r, LocationBearer) == "" {
+			http.Error(w, `{"error":"unauthorized","message":"invalid Authorization format"}`, http.StatusUnauthorized)
+			return
+		}
+
+		// A Veil key in a disabled location is rejected rather than
+		// forwarded, since nothing downstream would strip it
+		hasCredential := false
+		for _, loc := range DefaultKeyLocations {
+			token := credential(r, loc)
+			if token == "" {
+				continue
+			}
+			hasCredential = true
+			if strings.HasPrefix(token, veilKeyPrefix) && !enabled[loc] {
+				http.Error(w, fmt.Sprintf(`{"error":"unauthorized","message":"API key not accepted in %s"}`, loc), http.StatusUnauthorized)
 				return
 			}
-			token = parts[1]
-		} else if apiKey := r.Header.Get("x-api-key"); apiKey != "" {
-			token = apiKey
-		} else {
-			http.Error(w, `{"error":"unauthorized","message":"missing Authorization or x-api-key header"}`, http.StatusUnauthorized)
+		}
+		if !hasCredential {
+			http.Error(w, `{"error":"unauthorized","message":"missing API key"}`, http.StatusUnauthorized)
 			return
 		}
 
-		// If it's a Agent Veil API key, validate and bind role
-		if strings.HasPrefix(token, "veil_sk_") {
+		for _, loc := range m.locations {
+			token := credential(r, loc)
+			if !strings.HasPrefix(token, veilKeyPrefix) {
+				continue
+			}
+
 			apiKey, err := m.Validate(r.Context(), token)
 			if err != nil {
 				log.Printf("[auth] rejected key: %v", err)
@@ -36,14 +136,86 @@ func (m *Manager) Middleware(next http.Handler) http.Handler {
 				return
 			}
 
+			// Strip every copy of a Veil key, not just the one validated
+			for _, l := range DefaultKeyLocations {
+				if strings.HasPrefix(credential(r, l), veilKeyPrefix) {
+					removeCredential(r, l)
+				}
+			}
+
 			// Override role from key binding — client cannot escalate
 			r.Header.Set("X-User-Role", string(apiKey.Role))
 			r.Header.Set("X-Veil-Key-ID", apiKey.ID)
+			if apiKey.DetectorProfile != "" {
+				r.Header.Set("X-Veil-Detector-Profile", apiKey.DetectorProfile)
+			}
+			// The label and rate limit stay in the proxy: a header would
+			// be forwarded upstream
+			r = r.WithContext(WithKey(r.Context(), apiKey))
 
-			log.Printf("[auth] authenticated key=%s role=%s", apiKey.ID, apiKey.Role)
+			log.Printf("[auth] authenticated key=%s role=%s via=%s", apiKey.ID, apiKey.Role, loc)
+			break
 		}
 
+		// X-Veil-Key is ours alone; never forward it
+		r.Header.Del("X-Veil-Key")
+
 		// Non-veil keys (e.g. sk-xxx for OpenAI) pass through
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireRole authenticates like Middleware and then only admits requests
+// made with a Veil key bound to one of roles. Upstream provider keys and
+// client-supplied X-User-Role headers are rejected.
+func (m *Manager) RequireRole(roles ...Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Veil-Key-ID") != "" {
+				role := Role(r.Header.Get("X-User-Role"))
+				for _, allowed := range roles {
+					if role == allowed {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			http.Error(w, `{"error":"forbidden","message":"API key role not permitted"}`, http.StatusForbidden)
+		}))
+	}
+}
+
+// KeyInfo describes the Veil key a request was made with
+type KeyInfo struct {
+	KeyID string `json:"key_id"`
+	Role  Role   `json:"role"`
+}
+
+// WhoAmIHandler answers with the KeyInfo of the request's Veil key, and 401
+// without one. It is a cheap way for clients to check a key authenticates.
+func (m *Manager) WhoAmIHandler() http.Handler {
+	return m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Veil-Key-ID")
+		if id == "" {
+			http.Error(w, `{"error":"unauthorized","message":"not an Agent Veil API key"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(KeyInfo{KeyID: id, Role: Role(r.Header.Get("X-User-Role"))})
+	}))
+}
+
+type keyContext struct{}
+
+// WithKey returns ctx carrying key, as Middleware hands a validated key to
+// the handlers after it
+func WithKey(ctx context.Context, key *APIKey) context.Context {
+	return context.WithValue(ctx, keyContext{}, key)
+}
+
+// KeyFromContext returns the Veil key Middleware validated for the
+// request, nil without one
+func KeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(keyContext{}).(*APIKey)
+	return key
+}
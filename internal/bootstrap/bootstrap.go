@@ -0,0 +1,1454 @@
+// Package bootstrap loads and validates the proxy configuration from the
+// environment, and from the veil.yaml named by VEIL_CONFIG for variables
+// the environment leaves unset. Proxy startup and `agentveil proxy validate` run the same
+// checks, so a configuration that validates is one that starts.
+//
+// Loading never binds ports, opens log files or contacts Redis; CheckRedis
+// is the only check that touches the network.
+package bootstrap
+
+import (
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/breakglass"
+	"github.com/vurakit/agentveil/internal/cache"
+	"github.com/vurakit/agentveil/internal/config"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/detector/bundle"
+	"github.com/vurakit/agentveil/internal/detector/remote"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/feedback"
+	"github.com/vurakit/agentveil/internal/guardrail"
+	"github.com/vurakit/agentveil/internal/i18n"
+	"github.com/vurakit/agentveil/internal/mitm"
+	"github.com/vurakit/agentveil/internal/overload"
+	"github.com/vurakit/agentveil/internal/proxy"
+	"github.com/vurakit/agentveil/internal/ratelimit"
+	"github.com/vurakit/agentveil/internal/readiness"
+	"github.com/vurakit/agentveil/internal/redisconn"
+	"github.com/vurakit/agentveil/internal/router"
+	"github.com/vurakit/agentveil/internal/stats"
+	"github.com/vurakit/agentveil/internal/tokenizer"
+	"github.com/vurakit/agentveil/internal/transcript"
+	"github.com/vurakit/agentveil/internal/upstream"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/version"
+	"github.com/vurakit/agentveil/internal/webhook"
+	"github.com/vurakit/agentveil/pkg/pii"
+	"github.com/vurakit/agentveil/pkg/veilsig"
+)
+
+// Settings is the validated proxy configuration. Optional components are
+// nil when disabled.
+type Settings struct {
+	Config *config.File // VEIL_CONFIG, nil when unset
+
+	TargetURL       string
+	GeminiTargetURL string // upstream of the /gemini route in single-target mode, empty when disabled
+	ListenAddr      string
+	DefaultRole     string
+	TLSCert         string
+	TLSKey          string
+	Admin           *proxy.AdminListener // nil serves the admin API on ListenAddr
+
+	Redis            redisconn.Config
+	EncryptionKey    []byte // 32 bytes, nil when vault encryption is off
+	PlaintextVault   bool   // VEIL_ALLOW_PLAINTEXT_VAULT waived encryption for a remote Redis
+	AuthKeyLocations []auth.KeyLocation
+	VaultTTL         time.Duration // lifetime of a session's PII mappings after its last use
+	VaultResolveRate int           // resolutions per key per minute, 0 = endpoint disabled
+	SessionBinding   bool          // rehydrate only for the key or client IP that created a session
+	RateLimit        int           // global requests per IP per minute
+	RateLimitRedis   bool          // share rate limit counters across instances through Redis
+	KeyRateLimit     int           // default requests per minute of each Veil key, 0 = unlimited
+	KeyRateBurst     int           // default burst of each Veil key, 0 = KeyRateLimit
+	RateLimitExempt  ratelimit.Exemptions
+	Webhook          *webhook.Config
+	Cache            *cache.Config
+	Stats            *stats.Config
+	Feedback         *feedback.Config // nil unless VEIL_FEEDBACK opts in
+	SSEHeartbeat     time.Duration    // 0 = default, negative = disabled
+	Upstream         upstream.Config
+	Headers          proxy.HeaderPolicy
+	Fields           proxy.FieldPolicy // identifier fields redacted from request bodies
+	CountTokens      proxy.CountTokensMode
+	Lang             i18n.Lang          // default language of reports and violations
+	FailureMode      failsafe.Mode      // what a request does when a protection component fails
+	BinaryMinLength  int                // 0 = default, negative = data URIs only
+	MaxFileSize      int64              // /v1/files upload limit, 0 = default
+	Overload         *overload.Config   // nil when load shedding is off
+	BreakGlass       *breakglass.Config // nil when POST /admin/breakglass is disabled
+	StartupProbe     *readiness.Config  // nil unless VEIL_STARTUP_PROBE=strict gates /readyz
+	SigningKey       ed25519.PrivateKey
+	AccessLog        *accesslog.Config
+	Metrics          bool                 // serve Prometheus metrics at /metrics
+	MetricsAuth      bool                 // require a Veil API key for /metrics
+	PromptGuard      *PromptGuardSettings // nil when VEIL_PROMPTGUARD=false
+	Guardrail        *guardrail.Policy    // output guardrails, nil unless VEIL_GUARDRAIL opts in
+	DetectorAddr     string               // remote detector service, empty = in-process
+	DetectorTiers    detector.TierConfig
+	DetectorProfiles map[string]detector.Profile      // chosen per key and per router route
+	Pseudonyms       *detector.Pseudonyms             // nil unless VEIL_PSEUDONYMS opts in
+	SecretActions    detector.SecretActions           // mask, block or strip per secret category
+	PIIPolicy        map[pii.Category]detector.Action // tokenize, redact, mask or allow per category
+	PatternBundle    *bundle.Config
+	Transcripts      *transcript.Config
+	MITM             *mitm.Config // HTTPS forward proxy, nil when disabled
+
+	RouterConfigPath string
+	Router           *router.RouterConfig
+	Tokenizers       *tokenizer.Registry // token counting for router limits, per model family
+}
+
+// PromptGuardSettings configures the prompt injection scan of requests
+type PromptGuardSettings struct {
+	Sessions     bool  // accumulate low-threat scores per session
+	MaxScanBytes int64 // bodies above it skip the scan, 0 = the guard's default
+}
+
+// Result is the outcome of one component check
+type Result struct {
+	Component string
+	Detail    string // short summary when the component is ok
+	Err       error
+	Warnings  []string
+}
+
+// Report lists check results in the order they ran
+type Report []Result
+
+// OK reports whether every check passed
+func (r Report) OK() bool {
+	for _, res := range r {
+		if res.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Errors returns only the failed checks
+func (r Report) Errors() []Result {
+	var failed []Result
+	for _, res := range r {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// Print writes a COMPONENT / STATUS / DETAIL table
+func (r Report) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tSTATUS\tDETAIL")
+	for _, res := range r {
+		status, detail := "ok", res.Detail
+		if res.Err != nil {
+			status, detail = "error", res.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", res.Component, status, detail)
+		for _, w := range res.Warnings {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", res.Component, "warning", w)
+		}
+	}
+	tw.Flush()
+}
+
+// check validates one component, filling its part of Settings
+type check struct {
+	component string
+	run       func(s *Settings) (string, error)
+}
+
+var checks = []check{
+	{"server", checkServer},
+	{"tls", checkTLS},
+	{"admin_listener", checkAdminListener},
+	{"redis", checkRedisConfig},
+	{"encryption", checkEncryption},
+	{"auth", checkAuth},
+	{"vault_ttl", checkVaultTTL},
+	{"vault_resolve", checkVaultResolve},
+	{"session_binding", checkSessionBinding},
+	{"rate_limit", checkRateLimit},
+	{"webhooks", checkWebhooks},
+	{"cache", checkCache},
+	{"stats", checkStats},
+	{"feedback", checkFeedback},
+	{"sse", checkSSE},
+	{"upstream", checkUpstream},
+	{"headers", checkHeaders},
+	{"request_fields", checkRequestFields},
+	{"binary", checkBinary},
+	{"files", checkFiles},
+	{"count_tokens", checkCountTokens},
+	{"lang", checkLang},
+	{"failure_mode", checkFailureMode},
+	{"overload", checkOverload},
+	{"break_glass", checkBreakGlass},
+	{"startup_probe", checkStartupProbe},
+	{"signing", checkSigning},
+	{"access_log", checkAccessLog},
+	{"metrics", checkMetrics},
+	{"detector", checkDetector},
+	{"deep_scan", checkDeepScan},
+	{"detector_profiles", checkDetectorProfiles},
+	{"pseudonyms", checkPseudonyms},
+	{"secret_action", checkSecretAction},
+	{"pii_policy", checkPIIPolicy},
+	{"pattern_bundle", checkPatternBundle},
+	{"promptguard", checkPromptGuard},
+	{"guardrail", checkGuardrail},
+	{"transcripts", checkTranscripts},
+	{"forward_proxy", checkForwardProxy},
+	{"router", checkRouter},
+	{"tokenizer", checkTokenizer},
+}
+
+// Load reads every setting from the environment, or from the file named by
+// VEIL_CONFIG, and validates it. All checks run even after a failure so the
+// report lists every problem at once.
+func Load() (*Settings, Report) {
+	s := &Settings{}
+	res := Result{Component: "config", Detail: "environment only"}
+	if path := os.Getenv("VEIL_CONFIG"); path != "" {
+		s.Config, res.Err = config.Load(path)
+		if s.Config != nil {
+			res.Detail = fmt.Sprintf("%s, %d keys", path, len(s.Config.Env()))
+			for _, w := range s.Config.Warnings {
+				res.Warnings = append(res.Warnings, path+": "+w.String())
+			}
+		}
+	}
+	return s, append(Report{res}, run(s)...)
+}
+
+// LoadFile is Load with the settings of file in place of VEIL_CONFIG's
+func LoadFile(file *config.File) (*Settings, Report) {
+	s := &Settings{Config: file}
+	return s, run(s)
+}
+
+func run(s *Settings) Report {
+	report := make(Report, 0, len(checks))
+	for _, c := range checks {
+		detail, err := c.run(s)
+		report = append(report, Result{Component: c.component, Detail: detail, Err: s.annotate(err)})
+	}
+	return report
+}
+
+// annotate adds to err the line of the file that set a variable it names,
+// when the environment didn't
+func (s *Settings) annotate(err error) error {
+	if err == nil || s.Config == nil {
+		return err
+	}
+	if key, line, ok := s.Config.Blame(err.Error()); ok {
+		return fmt.Errorf("%w (%s:%d: %s)", err, s.Config.Path, line, key)
+	}
+	return err
+}
+
+// Validate runs Load (and CheckRedis when checkRedis is set), prints the
+// report to w and reports whether every check passed
+func Validate(w io.Writer, checkRedis bool) bool {
+	s, report := Load()
+	if checkRedis && resultFor(report, "redis").Err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		report = append(report, CheckRedis(ctx, s.Redis))
+	}
+	report.Print(w)
+	return report.OK()
+}
+
+func resultFor(r Report, component string) Result {
+	for _, res := range r {
+		if res.Component == component {
+			return res
+		}
+	}
+	return Result{}
+}
+
+// CheckRedis pings Redis with the loaded configuration
+func CheckRedis(ctx context.Context, cfg redisconn.Config) Result {
+	res := Result{Component: "redis_ping"}
+	client, err := redisconn.New(cfg)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer client.Close()
+	if err := client.Ping(ctx).Err(); err != nil {
+		res.Err = fmt.Errorf("ping %s: %w", cfg.Mode(), err)
+		return res
+	}
+	res.Detail = "connected (" + cfg.Mode() + ")"
+	return res
+}
+
+func checkServer(s *Settings) (string, error) {
+	s.TargetURL = s.env("TARGET_URL", "https://api.openai.com")
+	s.ListenAddr = s.env("LISTEN_ADDR", ":8080")
+	s.DefaultRole = s.env("VEIL_DEFAULT_ROLE", "viewer")
+
+	if u, err := url.Parse(s.TargetURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("TARGET_URL %q is not an absolute URL", s.TargetURL)
+	}
+	s.GeminiTargetURL = s.env("GEMINI_TARGET_URL", proxy.DefaultGeminiTargetURL)
+	gemini := "gemini " + s.GeminiTargetURL
+	if s.GeminiTargetURL == "none" {
+		s.GeminiTargetURL, gemini = "", "no gemini route"
+	} else if u, err := url.Parse(s.GeminiTargetURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("GEMINI_TARGET_URL %q is not an absolute URL", s.GeminiTargetURL)
+	}
+	if _, _, err := net.SplitHostPort(s.ListenAddr); err != nil {
+		return "", fmt.Errorf("LISTEN_ADDR %q: %w", s.ListenAddr, err)
+	}
+	switch auth.Role(s.DefaultRole) {
+	case auth.RoleAdmin, auth.RoleViewer, auth.RoleOperator:
+	default:
+		return "", fmt.Errorf("VEIL_DEFAULT_ROLE must be admin, viewer or operator, got %q", s.DefaultRole)
+	}
+	return fmt.Sprintf("listen %s, target %s, %s", s.ListenAddr, s.TargetURL, gemini), nil
+}
+
+func checkTLS(s *Settings) (string, error) {
+	s.TLSCert = s.env("TLS_CERT", "")
+	s.TLSKey = s.env("TLS_KEY", "")
+	if s.TLSCert == "" && s.TLSKey == "" {
+		return "disabled", nil
+	}
+	if s.TLSCert == "" || s.TLSKey == "" {
+		return "", fmt.Errorf("TLS_CERT and TLS_KEY must be set together")
+	}
+	if _, err := tls.LoadX509KeyPair(s.TLSCert, s.TLSKey); err != nil {
+		return "", fmt.Errorf("load TLS_CERT/TLS_KEY: %w", err)
+	}
+	return "cert " + s.TLSCert, nil
+}
+
+func checkAdminListener(s *Settings) (string, error) {
+	cfg := proxy.AdminListener{
+		Addr:     s.env("ADMIN_LISTEN_ADDR", ""),
+		TLSCert:  s.env("ADMIN_TLS_CERT", ""),
+		TLSKey:   s.env("ADMIN_TLS_KEY", ""),
+		ClientCA: s.env("ADMIN_TLS_CLIENT_CA", ""),
+	}
+	switch raw := s.env("VEIL_ADMIN_PPROF", "false"); raw {
+	case "true", "false":
+		cfg.Pprof = raw == "true"
+	default:
+		return "", fmt.Errorf("VEIL_ADMIN_PPROF must be true or false, got %q", raw)
+	}
+	if cfg.Addr == "" {
+		if cfg.TLSCert != "" || cfg.TLSKey != "" || cfg.ClientCA != "" || cfg.Pprof {
+			return "", fmt.Errorf("ADMIN_TLS_* and VEIL_ADMIN_PPROF need ADMIN_LISTEN_ADDR")
+		}
+		return "disabled (admin API on the main listener)", nil
+	}
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return "", fmt.Errorf("ADMIN_LISTEN_ADDR %q: %w", cfg.Addr, err)
+	}
+	if cfg.Addr == s.ListenAddr {
+		return "", fmt.Errorf("ADMIN_LISTEN_ADDR must differ from LISTEN_ADDR, both are %q", cfg.Addr)
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return "", fmt.Errorf("ADMIN_TLS_CERT and ADMIN_TLS_KEY must be set together")
+	}
+	if cfg.ClientCA != "" && cfg.TLSCert == "" {
+		return "", fmt.Errorf("ADMIN_TLS_CLIENT_CA needs ADMIN_TLS_CERT and ADMIN_TLS_KEY")
+	}
+	if _, err := cfg.TLSConfig(); err != nil {
+		return "", err
+	}
+	s.Admin = &cfg
+	detail := "listen " + cfg.Addr
+	switch {
+	case cfg.ClientCA != "":
+		detail += ", mTLS"
+	case cfg.TLSCert != "":
+		detail += ", TLS, admin keys"
+	default:
+		detail += ", admin keys"
+	}
+	if cfg.Pprof {
+		detail += ", pprof"
+	}
+	return detail, nil
+}
+
+func checkRedisConfig(s *Settings) (string, error) {
+	cfg, err := redisconn.FromEnv()
+	if err != nil {
+		return "", err
+	}
+	// Options validates the settings and loads TLS material without connecting
+	if _, err := cfg.Options(); err != nil {
+		return "", err
+	}
+	s.Redis = cfg
+	return cfg.Mode() + " (not contacted)", nil
+}
+
+func checkEncryption(s *Settings) (string, error) {
+	raw := s.env("VEIL_ENCRYPTION_KEY", "")
+	if raw == "" {
+		// PII originals would cross the network and sit on a shared Redis
+		// in the clear
+		switch {
+		case s.Redis.Local():
+			return "disabled", nil
+		case s.env("VEIL_ALLOW_PLAINTEXT_VAULT", "false") == "true":
+			s.PlaintextVault = true
+			return "disabled on a remote Redis (VEIL_ALLOW_PLAINTEXT_VAULT)", nil
+		}
+		return "", fmt.Errorf("VEIL_ENCRYPTION_KEY is required when Redis is not on this host; " +
+			"generate one with `openssl rand -hex 32`, or set VEIL_ALLOW_PLAINTEXT_VAULT=true to store PII unencrypted")
+	}
+	key, err := hex.DecodeString(raw)
+	if err != nil || len(key) != 32 {
+		return "", fmt.Errorf("VEIL_ENCRYPTION_KEY must be 64 hex chars (32 bytes), got %d chars", len(raw))
+	}
+	s.EncryptionKey = key
+	return "AES-256-GCM", nil
+}
+
+func checkAuth(s *Settings) (string, error) {
+	raw := s.env("VEIL_AUTH_KEY_LOCATIONS", "")
+	if raw == "" {
+		return "default key locations", nil
+	}
+	locs, err := auth.ParseKeyLocations(raw)
+	if err != nil {
+		return "", fmt.Errorf("VEIL_AUTH_KEY_LOCATIONS: %w", err)
+	}
+	s.AuthKeyLocations = locs
+	return "key locations " + raw, nil
+}
+
+func checkVaultTTL(s *Settings) (string, error) {
+	s.VaultTTL = vault.DefaultTTL
+	if raw := s.env("VEIL_VAULT_TTL", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Minute {
+			return "", fmt.Errorf("VEIL_VAULT_TTL must be a duration of at least 1m, got %q", raw)
+		}
+		s.VaultTTL = d
+	}
+	return s.VaultTTL.String(), nil
+}
+
+func checkVaultResolve(s *Settings) (string, error) {
+	if s.env("VEIL_VAULT_RESOLVE", "true") == "false" {
+		return "disabled", nil
+	}
+	s.VaultResolveRate = proxy.DefaultResolveRate
+	if raw := s.env("VEIL_VAULT_RESOLVE_RATE", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("VEIL_VAULT_RESOLVE_RATE must be a positive integer, got %q", raw)
+		}
+		s.VaultResolveRate = n
+	}
+	return fmt.Sprintf("%d/min per key", s.VaultResolveRate), nil
+}
+
+func checkSessionBinding(s *Settings) (string, error) {
+	switch raw := s.env("VEIL_SESSION_BINDING", "true"); raw {
+	case "true":
+		s.SessionBinding = true
+		return "by API key, else client IP", nil
+	case "false":
+		return "disabled, any caller may rehydrate a session", nil
+	default:
+		return "", fmt.Errorf("VEIL_SESSION_BINDING must be true or false, got %q", raw)
+	}
+}
+
+func checkRateLimit(s *Settings) (string, error) {
+	s.RateLimit = ratelimit.DefaultConfig().RequestsPerMinute
+	if raw := s.env("VEIL_RATE_LIMIT", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("VEIL_RATE_LIMIT must be a positive integer, got %q", raw)
+		}
+		s.RateLimit = n
+	}
+	switch backend := s.env("VEIL_RATE_LIMIT_BACKEND", "memory"); backend {
+	case "memory":
+	case "redis":
+		s.RateLimitRedis = true
+	default:
+		return "", fmt.Errorf("VEIL_RATE_LIMIT_BACKEND must be memory or redis, got %q", backend)
+	}
+	for _, n := range []struct {
+		env string
+		dst *int
+	}{
+		{"VEIL_KEY_RATE_LIMIT", &s.KeyRateLimit},
+		{"VEIL_KEY_RATE_BURST", &s.KeyRateBurst},
+	} {
+		if raw := s.env(n.env, ""); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil || v < 0 {
+				return "", fmt.Errorf("%s must be a non-negative integer, got %q", n.env, raw)
+			}
+			*n.dst = v
+		}
+	}
+	backend := "memory"
+	if s.RateLimitRedis {
+		backend = "redis"
+	}
+	exempt, err := rateLimitExemptions(s)
+	if err != nil {
+		return "", err
+	}
+	s.RateLimitExempt = exempt
+	perKey := "keys unlimited unless set per key"
+	if s.KeyRateLimit > 0 {
+		perKey = fmt.Sprintf("%d/min per key, burst %d", s.KeyRateLimit, cmp.Or(s.KeyRateBurst, s.KeyRateLimit))
+	}
+	return fmt.Sprintf("%d/min per IP, %s, %s backend, exempt: %s", s.RateLimit, perKey, backend, exempt), nil
+}
+
+// rateLimitExemptions reads the VEIL_RATE_LIMIT_EXEMPT_* lists; "none"
+// clears a list that has a default
+func rateLimitExemptions(s *Settings) (ratelimit.Exemptions, error) {
+	e := ratelimit.DefaultExemptions()
+	list := func(env string, def []string) []string {
+		raw := s.env(env, "")
+		if raw == "" {
+			return def
+		}
+		var out []string
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" && v != "none" {
+				out = append(out, v)
+			}
+		}
+		return out
+	}
+	e.Paths = list("VEIL_RATE_LIMIT_EXEMPT_PATHS", e.Paths)
+	for _, p := range e.Paths {
+		if !strings.HasPrefix(p, "/") {
+			return e, fmt.Errorf("VEIL_RATE_LIMIT_EXEMPT_PATHS: path %q must start with /", p)
+		}
+	}
+	e.Methods = list("VEIL_RATE_LIMIT_EXEMPT_METHODS", e.Methods)
+	for i, m := range e.Methods {
+		e.Methods[i] = strings.ToUpper(m)
+	}
+	for _, c := range list("VEIL_RATE_LIMIT_EXEMPT_CIDRS", nil) {
+		prefix, err := netip.ParsePrefix(c)
+		if err != nil {
+			return e, fmt.Errorf("VEIL_RATE_LIMIT_EXEMPT_CIDRS: invalid CIDR %q", c)
+		}
+		e.CIDRs = append(e.CIDRs, prefix.Masked())
+	}
+	e.UserAgents = list("VEIL_RATE_LIMIT_EXEMPT_USER_AGENTS", nil)
+	return e, nil
+}
+
+func checkWebhooks(s *Settings) (string, error) {
+	cfg := webhook.DefaultConfig()
+	var names []string
+	if u := s.env("VEIL_DISCORD_WEBHOOK_URL", ""); u != "" {
+		cfg.Discord = &webhook.DiscordConfig{WebhookURL: u}
+		names = append(names, "discord")
+	}
+	if u := s.env("VEIL_SLACK_WEBHOOK_URL", ""); u != "" {
+		cfg.Slack = &webhook.SlackConfig{WebhookURL: u}
+		names = append(names, "slack")
+	}
+	if u := s.env("VEIL_WEBHOOK_URL", ""); u != "" {
+		dest := webhook.Destination{
+			Name:    "custom",
+			URL:     u,
+			Secret:  s.env("VEIL_WEBHOOK_SECRET", ""),
+			Enabled: true,
+		}
+		for _, e := range strings.Split(s.env("VEIL_WEBHOOK_EVENTS", ""), ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				dest.Events = append(dest.Events, webhook.EventType(e))
+			}
+		}
+		cfg.Destinations = append(cfg.Destinations, dest)
+		names = append(names, "custom")
+	}
+	if key := s.env("VEIL_PAGERDUTY_ROUTING_KEY", ""); key != "" {
+		dest := webhook.Destination{
+			Name:       "pagerduty",
+			Type:       webhook.DestinationPagerDuty,
+			URL:        s.env("VEIL_PAGERDUTY_URL", ""),
+			RoutingKey: key,
+			Enabled:    true,
+		}
+		for _, e := range strings.Split(s.env("VEIL_PAGERDUTY_EVENTS", ""), ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				dest.Events = append(dest.Events, webhook.EventType(e))
+			}
+		}
+		cfg.Destinations = append(cfg.Destinations, dest)
+		names = append(names, "pagerduty")
+	}
+	if u := s.env("VEIL_CLOUDEVENTS_URL", ""); u != "" {
+		cfg.Destinations = append(cfg.Destinations, webhook.Destination{
+			Name:    "cloudevents",
+			Type:    webhook.DestinationCloudEvents,
+			URL:     u,
+			Source:  s.env("VEIL_CLOUDEVENTS_SOURCE", ""),
+			Enabled: true,
+		})
+		names = append(names, "cloudevents")
+	}
+	if len(names) == 0 {
+		return "disabled", nil
+	}
+	if raw := s.env("VEIL_WEBHOOK_CONCURRENCY", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("VEIL_WEBHOOK_CONCURRENCY must be a positive integer, got %q", raw)
+		}
+		cfg.Concurrency = n
+	}
+	policy, err := chatAlertPolicy(s)
+	if err != nil {
+		return "", err
+	}
+	if policy != nil {
+		if cfg.Slack != nil {
+			cfg.Slack.Alerting = policy
+		}
+		if cfg.Discord != nil {
+			cfg.Discord.Alerting = policy
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return "", err
+	}
+	s.Webhook = &cfg
+	return strings.Join(names, ", "), nil
+}
+
+// chatAlertPolicy builds the alert thresholds for Slack and Discord. The
+// custom webhook, usually a SIEM, keeps receiving every event.
+func chatAlertPolicy(s *Settings) (*webhook.AlertPolicy, error) {
+	var policy webhook.AlertPolicy
+	set := false
+	if raw := s.env("VEIL_WEBHOOK_CHAT_MIN_PII", ""); raw != "" {
+		rule := webhook.AlertRule{SecretsOnly: raw == "secrets"}
+		if !rule.SecretsOnly {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("VEIL_WEBHOOK_CHAT_MIN_PII must be a positive integer or \"secrets\", got %q", raw)
+			}
+			rule.MinCount = n
+		}
+		policy.Rules = map[webhook.EventType]webhook.AlertRule{webhook.EventPIIDetected: rule}
+		set = true
+	}
+	for _, d := range []struct {
+		env string
+		dst *int
+	}{
+		{"VEIL_WEBHOOK_CHAT_COOLDOWN", &policy.CooldownSec},
+		{"VEIL_WEBHOOK_CHAT_DIGEST", &policy.DigestSec},
+	} {
+		raw := s.env(d.env, "")
+		if raw == "" {
+			continue
+		}
+		v, err := time.ParseDuration(raw)
+		if err != nil || v < time.Second {
+			return nil, fmt.Errorf("%s must be a duration of at least 1s, got %q", d.env, raw)
+		}
+		*d.dst = int(v.Round(time.Second) / time.Second)
+		set = true
+	}
+	if !set {
+		return nil, nil
+	}
+	return &policy, nil
+}
+
+func checkCache(s *Settings) (string, error) {
+	if s.env("VEIL_CACHE", "false") != "true" {
+		return "disabled", nil
+	}
+	cfg := cache.DefaultConfig()
+	if raw := s.env("VEIL_CACHE_TTL", ""); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil || ttl <= 0 {
+			return "", fmt.Errorf("VEIL_CACHE_TTL must be a positive duration, got %q", raw)
+		}
+		cfg.TTL = ttl
+	}
+	if raw := s.env("VEIL_CACHE_MAX_ENTRIES", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("VEIL_CACHE_MAX_ENTRIES must be a non-negative integer, got %q", raw)
+		}
+		cfg.MaxEntries = n
+	}
+	cfg.CacheNonDeterministic = s.env("VEIL_CACHE_NONDETERMINISTIC", "false") == "true"
+	s.Cache = &cfg
+	return fmt.Sprintf("ttl %s, max %d entries", cfg.TTL, cfg.MaxEntries), nil
+}
+
+func checkStats(s *Settings) (string, error) {
+	if s.env("VEIL_STATS", "false") != "true" {
+		return "disabled", nil
+	}
+	cfg := stats.DefaultConfig()
+	if raw := s.env("VEIL_STATS_RETENTION", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return "", fmt.Errorf("VEIL_STATS_RETENTION must be a positive duration, got %q", raw)
+		}
+		cfg.Retention = d
+	}
+	if raw := s.env("VEIL_STATS_NOISE_EPSILON", ""); raw != "" {
+		eps, err := strconv.ParseFloat(raw, 64)
+		if err != nil || eps < 0 {
+			return "", fmt.Errorf("VEIL_STATS_NOISE_EPSILON must be a non-negative number, got %q", raw)
+		}
+		cfg.NoiseEpsilon = eps
+	}
+	if raw := s.env("VEIL_STATS_NOISE_THRESHOLD", ""); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("VEIL_STATS_NOISE_THRESHOLD must be a non-negative integer, got %q", raw)
+		}
+		cfg.NoiseThreshold = n
+	}
+	s.Stats = &cfg
+	return fmt.Sprintf("retention %s", cfg.Retention), nil
+}
+
+func checkFeedback(s *Settings) (string, error) {
+	if s.env("VEIL_FEEDBACK", "false") != "true" {
+		return "disabled", nil
+	}
+	cfg := feedback.Config{}
+	raw := s.env("VEIL_FEEDBACK_SUPPRESS_AFTER", "0")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("VEIL_FEEDBACK_SUPPRESS_AFTER must be a non-negative integer, got %q", raw)
+	}
+	cfg.SuppressAfter = n
+	if n == 0 {
+		s.Feedback = &cfg
+		return "reports only, no suppression", nil
+	}
+	rawKey := s.env("VEIL_FEEDBACK_KEY", "")
+	key, err := hex.DecodeString(rawKey)
+	if err != nil || len(key) != 32 {
+		return "", fmt.Errorf("VEIL_FEEDBACK_SUPPRESS_AFTER requires VEIL_FEEDBACK_KEY, 64 hex chars (32 bytes), got %d chars", len(rawKey))
+	}
+	if strings.EqualFold(rawKey, s.env("VEIL_ENCRYPTION_KEY", "")) {
+		return "", fmt.Errorf("VEIL_FEEDBACK_KEY must differ from VEIL_ENCRYPTION_KEY")
+	}
+	cfg.Key = key
+	s.Feedback = &cfg
+	return fmt.Sprintf("suppress after %d reports", n), nil
+}
+
+func checkSSE(s *Settings) (string, error) {
+	raw := s.env("VEIL_SSE_HEARTBEAT", "")
+	if raw == "" {
+		return "default heartbeat", nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return "", fmt.Errorf("VEIL_SSE_HEARTBEAT must be a non-negative duration, got %q", raw)
+	}
+	if d == 0 {
+		s.SSEHeartbeat = -1
+		return "heartbeat disabled", nil
+	}
+	s.SSEHeartbeat = d
+	return "heartbeat " + d.String(), nil
+}
+
+func checkUpstream(s *Settings) (string, error) {
+	cfg := upstream.DefaultConfig()
+	for _, d := range []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"VEIL_UPSTREAM_TIMEOUT", &cfg.Timeout},
+		{"VEIL_UPSTREAM_HEADER_TIMEOUT", &cfg.ResponseHeaderTimeout},
+	} {
+		if raw := s.env(d.env, ""); raw != "" {
+			v, err := time.ParseDuration(raw)
+			if err != nil || v < 0 {
+				return "", fmt.Errorf("%s must be a non-negative duration, got %q", d.env, raw)
+			}
+			*d.dst = v
+		}
+	}
+	if raw := s.env("VEIL_UPSTREAM_MAX_IDLE_CONNS", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("VEIL_UPSTREAM_MAX_IDLE_CONNS must be a positive integer, got %q", raw)
+		}
+		cfg.MaxIdleConnsPerHost = n
+	}
+	cfg.Retry = s.env("VEIL_UPSTREAM_RETRY", "false") == "true"
+	if s.env("VEIL_UPSTREAM_USER_AGENT", "true") != "false" {
+		cfg.UserAgent = version.UserAgent()
+	}
+	s.Upstream = cfg
+	return cfg.String(), nil
+}
+
+func checkHeaders(s *Settings) (string, error) {
+	if s.env("VEIL_HEADER_SCAN", "true") == "false" {
+		return "scan disabled", nil
+	}
+	policy := proxy.HeaderPolicy{Enabled: true}
+	for _, l := range []struct {
+		env string
+		dst *[]string
+	}{
+		{"VEIL_HEADER_ALLOW", &policy.Allow},
+		{"VEIL_HEADER_DENY", &policy.Deny},
+	} {
+		for _, p := range strings.Split(s.env(l.env, ""), ",") {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			if !proxy.ValidHeaderPattern(p) {
+				return "", fmt.Errorf("%s: invalid header name %q", l.env, p)
+			}
+			*l.dst = append(*l.dst, p)
+		}
+	}
+	s.Headers = policy
+	return fmt.Sprintf("scan on (%d allowed, %d denied)", len(policy.Allow), len(policy.Deny)), nil
+}
+
+func checkRequestFields(s *Settings) (string, error) {
+	raw := s.env("VEIL_REQUEST_FIELDS", strings.Join(proxy.DefaultFieldPaths, ","))
+	if raw == "none" {
+		return "disabled", nil
+	}
+	def, err := proxy.ParseFieldAction(s.env("VEIL_REQUEST_FIELD_ACTION", string(proxy.DefaultFieldAction)))
+	if err != nil {
+		return "", fmt.Errorf("VEIL_REQUEST_FIELD_ACTION: %w", err)
+	}
+	rules, err := proxy.ParseFieldRules(raw, def)
+	if err != nil {
+		return "", fmt.Errorf("VEIL_REQUEST_FIELDS: %w", err)
+	}
+	hashed, keyed := false, false
+	for _, r := range rules {
+		hashed = hashed || r.Action == proxy.FieldHash
+		keyed = keyed || r.Action != proxy.FieldRemove
+	}
+
+	policy := proxy.FieldPolicy{Rules: rules}
+	rawKey := s.env("VEIL_REQUEST_FIELD_KEY", "")
+	switch {
+	case rawKey != "":
+		key, err := hex.DecodeString(rawKey)
+		if err != nil || len(key) != 32 {
+			return "", fmt.Errorf("VEIL_REQUEST_FIELD_KEY must be 64 hex chars (32 bytes), got %d chars", len(rawKey))
+		}
+		if strings.EqualFold(rawKey, s.env("VEIL_ENCRYPTION_KEY", "")) {
+			return "", fmt.Errorf("VEIL_REQUEST_FIELD_KEY must differ from VEIL_ENCRYPTION_KEY")
+		}
+		policy.Key = key
+	case hashed:
+		// Hashes nobody else can compute are no use for correlation
+		return "", fmt.Errorf("hashed request fields require VEIL_REQUEST_FIELD_KEY, 64 hex chars (32 bytes)")
+	case keyed:
+		// Constants only have to be stable for this process
+		policy.Key = make([]byte, 32)
+		if _, err := rand.Read(policy.Key); err != nil {
+			return "", fmt.Errorf("generating request field key: %w", err)
+		}
+	}
+	s.Fields = policy
+
+	paths := make([]string, len(rules))
+	for i, r := range rules {
+		paths[i] = r.Path + "=" + string(r.Action)
+	}
+	return strings.Join(paths, ", "), nil
+}
+
+func checkBinary(s *Settings) (string, error) {
+	raw := s.env("VEIL_BINARY_MIN_LENGTH", "")
+	if raw == "" {
+		return fmt.Sprintf("base64 media skipped from %d chars", proxy.DefaultBinaryMinLength), nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("VEIL_BINARY_MIN_LENGTH must be a non-negative integer, got %q", raw)
+	}
+	if n == 0 {
+		s.BinaryMinLength = -1
+		return "data URIs only", nil
+	}
+	s.BinaryMinLength = n
+	return fmt.Sprintf("base64 media skipped from %d chars", n), nil
+}
+
+func checkFiles(s *Settings) (string, error) {
+	raw := s.env("VEIL_MAX_FILE_SIZE_MB", "")
+	if raw == "" {
+		return fmt.Sprintf("uploads up to %d MB", proxy.DefaultMaxFileSize>>20), nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n <= 0 {
+		return "", fmt.Errorf("VEIL_MAX_FILE_SIZE_MB must be a positive integer, got %q", raw)
+	}
+	s.MaxFileSize = n << 20
+	return fmt.Sprintf("uploads up to %d MB", n), nil
+}
+
+func checkCountTokens(s *Settings) (string, error) {
+	mode, err := proxy.ParseCountTokensMode(s.env("VEIL_COUNT_TOKENS", ""))
+	if err != nil {
+		return "", fmt.Errorf("VEIL_COUNT_TOKENS: %w", err)
+	}
+	s.CountTokens = mode
+	if mode == proxy.CountTokensPassthrough {
+		return "passthrough (counting requests reach the provider unanonymized)", nil
+	}
+	return "anonymized like the counted request", nil
+}
+
+func checkLang(s *Settings) (string, error) {
+	lang, err := i18n.Parse(s.env("VEIL_LANG", ""))
+	if err != nil {
+		return "", fmt.Errorf("VEIL_LANG: %w", err)
+	}
+	s.Lang = lang
+	return fmt.Sprintf("reports in %s unless Accept-Language asks otherwise", lang), nil
+}
+
+func checkFailureMode(s *Settings) (string, error) {
+	mode, err := failsafe.ParseMode(s.env("VEIL_FAILURE_MODE", ""))
+	if err != nil {
+		return "", fmt.Errorf("VEIL_FAILURE_MODE: %w", err)
+	}
+	s.FailureMode = mode
+	if mode == failsafe.Closed {
+		return "closed (a failing detector, vault, prompt guard or guardrail answers 503)", nil
+	}
+	return "open (requests go on when a protection component fails, flagged with X-Veil-Degraded)", nil
+}
+
+func checkStartupProbe(s *Settings) (string, error) {
+	switch mode := s.env("VEIL_STARTUP_PROBE", "off"); mode {
+	case "off":
+		return "off (/readyz is ready once listening)", nil
+	case "strict":
+		// below
+	default:
+		return "", fmt.Errorf("VEIL_STARTUP_PROBE must be off or strict, got %q", mode)
+	}
+	cfg := readiness.Config{Timeout: readiness.DefaultTimeout}
+	if raw := s.env("VEIL_STARTUP_PROBE_TIMEOUT", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return "", fmt.Errorf("VEIL_STARTUP_PROBE_TIMEOUT must be a positive duration, got %q", raw)
+		}
+		cfg.Timeout = d
+	}
+	s.StartupProbe = &cfg
+	return fmt.Sprintf("strict (/readyz waits up to %s for providers)", cfg.Timeout), nil
+}
+
+func checkBreakGlass(s *Settings) (string, error) {
+	if s.env("VEIL_BREAK_GLASS", "true") == "false" {
+		return "disabled", nil
+	}
+	cfg := breakglass.DefaultConfig()
+	if raw := s.env("VEIL_BREAK_GLASS_MAX_DURATION", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Minute {
+			return "", fmt.Errorf("VEIL_BREAK_GLASS_MAX_DURATION must be a duration of at least 1m, got %q", raw)
+		}
+		cfg.MaxDuration = d
+	}
+	s.BreakGlass = &cfg
+	return fmt.Sprintf("up to %s", cfg.MaxDuration), nil
+}
+
+func checkOverload(s *Settings) (string, error) {
+	if s.env("VEIL_OVERLOAD", "true") == "false" {
+		return "disabled", nil
+	}
+	cfg := overload.DefaultConfig()
+	if raw := s.env("VEIL_MAX_INFLIGHT", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("VEIL_MAX_INFLIGHT must be a positive integer, got %q", raw)
+		}
+		cfg.MaxInFlight = n
+	}
+	if raw := s.env("VEIL_OVERLOAD_QUEUE", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("VEIL_OVERLOAD_QUEUE must be a non-negative integer, got %q", raw)
+		}
+		cfg.QueueSize = n
+	}
+	if raw := s.env("VEIL_OVERLOAD_QUEUE_TIMEOUT", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return "", fmt.Errorf("VEIL_OVERLOAD_QUEUE_TIMEOUT must be a positive duration, got %q", raw)
+		}
+		cfg.QueueTimeout = d
+	}
+	if raw := s.env("VEIL_OVERLOAD_MEMORY_MB", ""); raw != "" {
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || n == 0 {
+			return "", fmt.Errorf("VEIL_OVERLOAD_MEMORY_MB must be a positive integer, got %q", raw)
+		}
+		// Cheap requests are shed from the mark, everything 25% above it
+		cfg.MemoryHighWater = n << 20
+		cfg.MemoryCritical = cfg.MemoryHighWater + cfg.MemoryHighWater/4
+	}
+	s.Overload = &cfg
+
+	detail := fmt.Sprintf("%d in flight, queue %d (%s)", cfg.MaxInFlight, cfg.QueueSize, cfg.QueueTimeout)
+	if cfg.MemoryHighWater > 0 {
+		detail += fmt.Sprintf(", shed from %d MB heap", cfg.MemoryHighWater>>20)
+	}
+	return detail, nil
+}
+
+func checkSigning(s *Settings) (string, error) {
+	path := s.env("VEIL_SIGNING_KEY_FILE", "")
+	if path == "" {
+		return "disabled", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read VEIL_SIGNING_KEY_FILE: %w", err)
+	}
+	key, err := veilsig.ParsePrivateKey(data)
+	if err != nil {
+		return "", fmt.Errorf("VEIL_SIGNING_KEY_FILE %s: %w", path, err)
+	}
+	s.SigningKey = key
+	return "Ed25519 key " + path, nil
+}
+
+func checkAccessLog(s *Settings) (string, error) {
+	out := s.env("VEIL_ACCESS_LOG", "")
+	if out == "" {
+		return "disabled", nil
+	}
+	cfg := accesslog.DefaultConfig()
+	cfg.Output = out
+	cfg.Fields = s.env("VEIL_ACCESS_LOG_FIELDS", cfg.Fields)
+	if raw := s.env("VEIL_ACCESS_LOG_MAX_SIZE_MB", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("VEIL_ACCESS_LOG_MAX_SIZE_MB must be a non-negative integer, got %q", raw)
+		}
+		cfg.MaxSizeMB = n
+	}
+	if raw := s.env("VEIL_ACCESS_LOG_MAX_BACKUPS", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("VEIL_ACCESS_LOG_MAX_BACKUPS must be a non-negative integer, got %q", raw)
+		}
+		cfg.MaxBackups = n
+	}
+	cfg.RedisStream = s.env("VEIL_ACCESS_LOG_REDIS_STREAM", "")
+	if raw := s.env("VEIL_ACCESS_LOG_REDIS_MAXLEN", ""); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("VEIL_ACCESS_LOG_REDIS_MAXLEN must be a positive integer, got %q", raw)
+		}
+		cfg.RedisMaxLen = n
+	}
+	if err := cfg.Validate(); err != nil {
+		return "", err
+	}
+	s.AccessLog = &cfg
+	if cfg.RedisStream != "" {
+		return fmt.Sprintf("%s (%s fields), Redis stream %s", cfg.Output, cfg.Fields, cfg.RedisStream), nil
+	}
+	return fmt.Sprintf("%s (%s fields)", cfg.Output, cfg.Fields), nil
+}
+
+func checkMetrics(s *Settings) (string, error) {
+	switch raw := s.env("VEIL_METRICS", "false"); raw {
+	case "true":
+		s.Metrics = true
+	case "false":
+		return "disabled", nil
+	default:
+		return "", fmt.Errorf("VEIL_METRICS must be true or false, got %q", raw)
+	}
+	switch raw := s.env("VEIL_METRICS_AUTH", "false"); raw {
+	case "true":
+		s.MetricsAuth = true
+		return "/metrics, API key required", nil
+	case "false":
+		return "/metrics, unauthenticated", nil
+	default:
+		return "", fmt.Errorf("VEIL_METRICS_AUTH must be true or false, got %q", raw)
+	}
+}
+
+func checkDetector(s *Settings) (string, error) {
+	addr := s.env("DETECTOR_ADDR", "")
+	if addr == "" {
+		return "in-process", nil
+	}
+	if err := remote.ParseAddr(addr); err != nil {
+		return "", fmt.Errorf("DETECTOR_ADDR: %w", err)
+	}
+	s.DetectorAddr = addr
+	return "remote " + addr + " (in-process fallback)", nil
+}
+
+func checkDeepScan(s *Settings) (string, error) {
+	tiers := detector.DefaultConfig().Tiers
+	if raw := s.env("VEIL_DEEP_SCAN_PERCENT", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > 100 {
+			return "", fmt.Errorf("VEIL_DEEP_SCAN_PERCENT must be an integer from 0 to 100, got %q", raw)
+		}
+		tiers.DeepSamplePercent = n
+	}
+	for _, l := range []struct {
+		env string
+		dst *[]string
+	}{
+		{"VEIL_DEEP_SCAN_SESSIONS", &tiers.SensitiveSessions},
+		{"VEIL_DEEP_SCAN_KEYS", &tiers.SensitiveKeys},
+		{"VEIL_DEEP_SCAN_ROLES", &tiers.SensitiveRoles},
+	} {
+		for _, v := range strings.Split(s.env(l.env, ""), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*l.dst = append(*l.dst, v)
+			}
+		}
+	}
+	s.DetectorTiers = tiers
+	if !tiers.Sampled() {
+		return "every request", nil
+	}
+	return fmt.Sprintf("%d%% of requests, %d sessions, %d keys and %d roles always",
+		tiers.DeepSamplePercent, len(tiers.SensitiveSessions), len(tiers.SensitiveKeys), len(tiers.SensitiveRoles)), nil
+}
+
+func checkDetectorProfiles(s *Settings) (string, error) {
+	path := s.env("VEIL_DETECTOR_PROFILES", "")
+	if path == "" {
+		return "none", nil
+	}
+	profiles, err := detector.LoadProfiles(path)
+	if err != nil {
+		return "", fmt.Errorf("VEIL_DETECTOR_PROFILES %s: %w", path, err)
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s.DetectorProfiles = profiles
+	return fmt.Sprintf("%d from %s (%s)", len(profiles), path, strings.Join(names, ", ")), nil
+}
+
+func checkPseudonyms(s *Settings) (string, error) {
+	raw := s.env("VEIL_PSEUDONYMS", "")
+	if raw == "" {
+		return "disabled (per-session counter tokens)", nil
+	}
+	cats, err := detector.ParsePseudonymCategories(raw)
+	if err != nil {
+		return "", fmt.Errorf("VEIL_PSEUDONYMS: %w", err)
+	}
+	rawKey := s.env("VEIL_PSEUDONYM_KEY", "")
+	key, err := hex.DecodeString(rawKey)
+	if err != nil || len(key) != 32 {
+		return "", fmt.Errorf("VEIL_PSEUDONYMS requires VEIL_PSEUDONYM_KEY, 64 hex chars (32 bytes), got %d chars", len(rawKey))
+	}
+	// A separate key lets pseudonym links be revoked without re-encrypting the vault
+	if strings.EqualFold(rawKey, s.env("VEIL_ENCRYPTION_KEY", "")) {
+		return "", fmt.Errorf("VEIL_PSEUDONYM_KEY must differ from VEIL_ENCRYPTION_KEY")
+	}
+	s.Pseudonyms = &detector.Pseudonyms{Key: key, Categories: cats}
+	names := make([]string, 0, len(cats))
+	for cat := range cats {
+		names = append(names, string(cat))
+	}
+	sort.Strings(names)
+	return "deterministic for " + strings.Join(names, ", "), nil
+}
+
+func checkSecretAction(s *Settings) (string, error) {
+	actions, err := detector.ParseSecretActions(s.env("VEIL_SECRET_ACTION", ""))
+	if err != nil {
+		return "", fmt.Errorf("VEIL_SECRET_ACTION: %w", err)
+	}
+	s.SecretActions = actions
+	return actions.String(), nil
+}
+
+func checkPIIPolicy(s *Settings) (string, error) {
+	policy, err := detector.ParsePolicy(s.env("VEIL_PII_POLICY", ""))
+	if err != nil {
+		return "", fmt.Errorf("VEIL_PII_POLICY: %w", err)
+	}
+	for cat := range policy {
+		if pii.IsSecretCategory(cat) {
+			return "", fmt.Errorf("VEIL_PII_POLICY: %s is a secret; set its action with VEIL_SECRET_ACTION", cat)
+		}
+	}
+	if len(policy) == 0 {
+		return "tokenize (secrets per secret_action)", nil
+	}
+	s.PIIPolicy = policy
+	return detector.PolicyString(policy), nil
+}
+
+func checkPatternBundle(s *Settings) (string, error) {
+	source := s.env("VEIL_PATTERN_BUNDLE", "")
+	if source == "" {
+		return "disabled (built-in patterns)", nil
+	}
+	if err := bundle.ValidateSource(source); err != nil {
+		return "", fmt.Errorf("VEIL_PATTERN_BUNDLE: %w", err)
+	}
+	path := s.env("VEIL_PATTERN_BUNDLE_KEY_FILE", "")
+	if path == "" {
+		return "", fmt.Errorf("VEIL_PATTERN_BUNDLE requires VEIL_PATTERN_BUNDLE_KEY_FILE to verify its signature")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read VEIL_PATTERN_BUNDLE_KEY_FILE: %w", err)
+	}
+	pub, err := veilsig.ParsePublicKey(data)
+	if err != nil {
+		return "", fmt.Errorf("VEIL_PATTERN_BUNDLE_KEY_FILE %s: %w", path, err)
+	}
+	s.PatternBundle = &bundle.Config{Source: source, PublicKey: pub}
+	return source + " (signed, Ed25519 key " + path + ")", nil
+}
+
+func checkPromptGuard(s *Settings) (string, error) {
+	enabled, err := s.bool("VEIL_PROMPTGUARD", true)
+	if err != nil || !enabled {
+		return "disabled", err
+	}
+	cfg := &PromptGuardSettings{}
+	if cfg.Sessions, err = s.bool("VEIL_PROMPTGUARD_SESSIONS", true); err != nil {
+		return "", err
+	}
+	if raw := s.env("VEIL_PROMPTGUARD_MAX_SCAN_BYTES", ""); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("VEIL_PROMPTGUARD_MAX_SCAN_BYTES must be a positive integer, got %q", raw)
+		}
+		cfg.MaxScanBytes = n
+	}
+	s.PromptGuard = cfg
+	if cfg.Sessions {
+		return "enabled, session scores", nil
+	}
+	return "enabled", nil
+}
+
+func checkGuardrail(s *Settings) (string, error) {
+	enabled, err := s.bool("VEIL_GUARDRAIL", false)
+	if err != nil || !enabled {
+		return "disabled", err
+	}
+	policy := guardrail.DefaultPolicy()
+	for _, n := range []struct {
+		env string
+		dst *int
+	}{
+		{"VEIL_GUARDRAIL_MAX_OUTPUT_TOKENS", &policy.MaxOutputTokens},
+		{"VEIL_GUARDRAIL_MAX_REQUESTS_PER_MIN", &policy.MaxRequestsPerMin},
+	} {
+		if raw := s.env(n.env, ""); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil || v < 0 {
+				return "", fmt.Errorf("%s must be a non-negative integer, got %q", n.env, raw)
+			}
+			*n.dst = v
+		}
+	}
+	if policy.BlockHarmfulContent, err = s.bool("VEIL_GUARDRAIL_BLOCK_HARMFUL", policy.BlockHarmfulContent); err != nil {
+		return "", err
+	}
+	if policy.BlockPIIInOutput, err = s.bool("VEIL_GUARDRAIL_BLOCK_PII", policy.BlockPIIInOutput); err != nil {
+		return "", err
+	}
+	switch policy.PIIOutputAction = s.env("VEIL_GUARDRAIL_PII_ACTION", guardrail.PIIActionBlock); policy.PIIOutputAction {
+	case guardrail.PIIActionBlock, guardrail.PIIActionRedact:
+	default:
+		return "", fmt.Errorf("VEIL_GUARDRAIL_PII_ACTION must be block or redact, got %q", policy.PIIOutputAction)
+	}
+	for _, l := range []struct {
+		env string
+		dst *[]string
+	}{
+		{"VEIL_GUARDRAIL_ALLOWED_TOPICS", &policy.AllowedTopics},
+		{"VEIL_GUARDRAIL_BLOCKED_TOPICS", &policy.BlockedTopics},
+	} {
+		for _, v := range strings.Split(s.env(l.env, ""), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*l.dst = append(*l.dst, v)
+			}
+		}
+	}
+	if _, err := guardrail.Compile(policy); err != nil {
+		return "", fmt.Errorf("VEIL_GUARDRAIL: %w", err)
+	}
+	s.Guardrail = &policy
+	return fmt.Sprintf("max %d output tokens, %d requests/min per session, %d blocked topics",
+		policy.MaxOutputTokens, policy.MaxRequestsPerMin, len(policy.BlockedTopics)), nil
+}
+
+func checkTranscripts(s *Settings) (string, error) {
+	out := s.env("VEIL_TRANSCRIPTS", "")
+	if out == "" {
+		return "disabled", nil
+	}
+	cfg := transcript.DefaultConfig()
+	cfg.Output = out
+	if raw := s.env("VEIL_TRANSCRIPTS_MAX_AGE", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return "", fmt.Errorf("VEIL_TRANSCRIPTS_MAX_AGE must be a non-negative duration, got %q", raw)
+		}
+		cfg.MaxAge = d
+	}
+	s.Transcripts = &cfg
+	return fmt.Sprintf("%s (max age %s)", cfg.Output, cfg.MaxAge), nil
+}
+
+func checkForwardProxy(s *Settings) (string, error) {
+	addr := s.env("VEIL_MITM_ADDR", "")
+	if addr == "" {
+		return "disabled", nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", fmt.Errorf("VEIL_MITM_ADDR must be host:port, got %q", addr)
+	}
+	cfg := mitm.DefaultConfig()
+	cfg.Addr = addr
+	if raw := s.env("VEIL_MITM_HOSTS", ""); raw != "" {
+		cfg.Hosts = nil
+		for _, h := range strings.Split(raw, ",") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+				cfg.Hosts = append(cfg.Hosts, h)
+			}
+		}
+		if len(cfg.Hosts) == 0 {
+			return "", fmt.Errorf("VEIL_MITM_HOSTS lists no hosts")
+		}
+	}
+	cfg.CACert = s.env("VEIL_MITM_CA_CERT", cfg.CACert)
+	cfg.CAKey = s.env("VEIL_MITM_CA_KEY", cfg.CAKey)
+	if _, err := mitm.LoadCA(cfg.CACert, cfg.CAKey); err != nil {
+		return "", fmt.Errorf("%w (generate one with: agentveil setup --gen-ca)", err)
+	}
+	s.MITM = &cfg
+	return fmt.Sprintf("%s intercepting %s", cfg.Addr, strings.Join(cfg.Hosts, ", ")), nil
+}
+
+func checkRouter(s *Settings) (string, error) {
+	path := s.env("VEIL_ROUTER_CONFIG", "")
+	if path == "" {
+		return "single-target mode", nil
+	}
+	cfg, err := s.LoadRouter(path)
+	if err != nil {
+		return "", err
+	}
+	s.RouterConfigPath = path
+	s.Router = cfg
+	return fmt.Sprintf("%d providers, %d routes", len(cfg.Providers), len(cfg.Routes)), nil
+}
+
+// LoadRouter reads the router config at path and checks its routes against
+// the detector profiles, as startup does. Reloads of the config use it too.
+func (s *Settings) LoadRouter(path string) (*router.RouterConfig, error) {
+	cfg, err := router.LoadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("VEIL_ROUTER_CONFIG %s: %w", path, err)
+	}
+	for _, rc := range cfg.Routes {
+		if _, ok := s.DetectorProfiles[rc.DetectorProfile]; rc.DetectorProfile != "" && !ok {
+			return nil, fmt.Errorf("VEIL_ROUTER_CONFIG %s: route %s: detector profile %q is not defined in VEIL_DETECTOR_PROFILES", path, rc.PathPrefix, rc.DetectorProfile)
+		}
+	}
+	return cfg, nil
+}
+
+func checkTokenizer(s *Settings) (string, error) {
+	ratios, err := tokenizer.ParseRatios(s.env("VEIL_TOKEN_RATIOS", ""))
+	if err != nil {
+		return "", fmt.Errorf("VEIL_TOKEN_RATIOS: %w", err)
+	}
+	var bpe *tokenizer.BPE
+	if path := s.env("VEIL_TOKENIZER_CL100K", ""); path != "" {
+		if bpe, err = tokenizer.LoadCL100KFile(path); err != nil {
+			return "", fmt.Errorf("VEIL_TOKENIZER_CL100K %s: %w", path, err)
+		}
+	}
+	s.Tokenizers = tokenizer.NewDefaultRegistry(bpe, ratios)
+	return s.Tokenizers.String(), nil
+}
+
+// bool reads key as true or false
+func (s *Settings) bool(key string, fallback bool) (bool, error) {
+	switch raw := s.env(key, strconv.FormatBool(fallback)); raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s must be true or false, got %q", key, raw)
+	}
+}
+
+// env returns the environment variable key, or the value VEIL_CONFIG's file
+// gives it when unset, or fallback
+func (s *Settings) env(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	if v, ok := s.Config.Lookup(key); ok {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,634 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/mitm"
+	"github.com/vurakit/agentveil/internal/proxy"
+	"github.com/vurakit/agentveil/internal/upstream"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// clearEnv blanks every variable Load reads so the host environment
+// cannot leak into a test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, k := range []string{
+		"TARGET_URL", "GEMINI_TARGET_URL", "LISTEN_ADDR", "VEIL_DEFAULT_ROLE", "TLS_CERT", "TLS_KEY",
+		"ADMIN_LISTEN_ADDR", "ADMIN_TLS_CERT", "ADMIN_TLS_KEY", "ADMIN_TLS_CLIENT_CA", "VEIL_ADMIN_PPROF",
+		"REDIS_ADDR", "REDIS_DB", "REDIS_TLS", "REDIS_TLS_CA", "REDIS_TLS_CERT", "REDIS_TLS_KEY",
+		"REDIS_SENTINEL", "REDIS_CLUSTER",
+		"VEIL_ENCRYPTION_KEY", "VEIL_ALLOW_PLAINTEXT_VAULT", "VEIL_AUTH_KEY_LOCATIONS",
+		"VEIL_DISCORD_WEBHOOK_URL", "VEIL_SLACK_WEBHOOK_URL", "VEIL_WEBHOOK_URL", "VEIL_WEBHOOK_SECRET", "VEIL_WEBHOOK_EVENTS",
+		"VEIL_WEBHOOK_CHAT_MIN_PII", "VEIL_WEBHOOK_CHAT_COOLDOWN", "VEIL_WEBHOOK_CHAT_DIGEST", "VEIL_WEBHOOK_CONCURRENCY",
+		"VEIL_CACHE", "VEIL_CACHE_TTL", "VEIL_CACHE_MAX_ENTRIES",
+		"VEIL_STATS", "VEIL_STATS_RETENTION", "VEIL_STATS_NOISE_EPSILON", "VEIL_STATS_NOISE_THRESHOLD",
+		"VEIL_FEEDBACK", "VEIL_FEEDBACK_SUPPRESS_AFTER", "VEIL_FEEDBACK_KEY",
+		"VEIL_SSE_HEARTBEAT", "VEIL_SIGNING_KEY_FILE",
+		"VEIL_ACCESS_LOG", "VEIL_ACCESS_LOG_FIELDS", "VEIL_ACCESS_LOG_MAX_SIZE_MB", "VEIL_ACCESS_LOG_MAX_BACKUPS",
+		"VEIL_ACCESS_LOG_REDIS_STREAM", "VEIL_ACCESS_LOG_REDIS_MAXLEN",
+		"VEIL_ROUTER_CONFIG", "DETECTOR_ADDR", "VEIL_PATTERN_BUNDLE", "VEIL_PATTERN_BUNDLE_KEY_FILE", "VEIL_TRANSCRIPTS", "VEIL_TRANSCRIPTS_MAX_AGE",
+		"VEIL_MITM_ADDR", "VEIL_MITM_HOSTS", "VEIL_MITM_CA_CERT", "VEIL_MITM_CA_KEY",
+		"VEIL_UPSTREAM_TIMEOUT", "VEIL_UPSTREAM_HEADER_TIMEOUT", "VEIL_UPSTREAM_MAX_IDLE_CONNS", "VEIL_UPSTREAM_RETRY", "VEIL_UPSTREAM_USER_AGENT",
+		"VEIL_VAULT_TTL", "VEIL_VAULT_RESOLVE", "VEIL_VAULT_RESOLVE_RATE", "VEIL_RATE_LIMIT", "VEIL_RATE_LIMIT_BACKEND",
+		"VEIL_KEY_RATE_LIMIT", "VEIL_KEY_RATE_BURST",
+		"VEIL_RATE_LIMIT_EXEMPT_PATHS", "VEIL_RATE_LIMIT_EXEMPT_METHODS", "VEIL_RATE_LIMIT_EXEMPT_CIDRS", "VEIL_RATE_LIMIT_EXEMPT_USER_AGENTS",
+		"VEIL_HEADER_SCAN", "VEIL_HEADER_ALLOW", "VEIL_HEADER_DENY", "VEIL_BINARY_MIN_LENGTH",
+		"VEIL_OVERLOAD", "VEIL_MAX_INFLIGHT", "VEIL_OVERLOAD_QUEUE", "VEIL_OVERLOAD_QUEUE_TIMEOUT", "VEIL_OVERLOAD_MEMORY_MB",
+		"VEIL_BREAK_GLASS", "VEIL_BREAK_GLASS_MAX_DURATION", "VEIL_SESSION_BINDING",
+		"VEIL_DETECTOR_PROFILES", "VEIL_PSEUDONYMS", "VEIL_PSEUDONYM_KEY",
+		"VEIL_TOKENIZER_CL100K", "VEIL_TOKEN_RATIOS", "VEIL_SECRET_ACTION", "VEIL_PII_POLICY", "VEIL_COUNT_TOKENS", "VEIL_LANG",
+		"VEIL_FAILURE_MODE", "VEIL_REQUEST_FIELDS", "VEIL_REQUEST_FIELD_ACTION", "VEIL_REQUEST_FIELD_KEY",
+		"VEIL_STARTUP_PROBE", "VEIL_STARTUP_PROBE_TIMEOUT", "VEIL_METRICS", "VEIL_METRICS_AUTH",
+		"VEIL_CONFIG", "VEIL_PROMPTGUARD", "VEIL_PROMPTGUARD_SESSIONS", "VEIL_PROMPTGUARD_MAX_SCAN_BYTES",
+		"VEIL_GUARDRAIL", "VEIL_GUARDRAIL_MAX_OUTPUT_TOKENS", "VEIL_GUARDRAIL_MAX_REQUESTS_PER_MIN",
+		"VEIL_GUARDRAIL_BLOCK_HARMFUL", "VEIL_GUARDRAIL_BLOCK_PII", "VEIL_GUARDRAIL_PII_ACTION", "VEIL_GUARDRAIL_ALLOWED_TOPICS", "VEIL_GUARDRAIL_BLOCKED_TOPICS",
+	} {
+		t.Setenv(k, "")
+	}
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	clearEnv(t)
+	s, report := Load()
+	if !report.OK() {
+		t.Fatalf("defaults should validate: %+v", report.Errors())
+	}
+	if s.TargetURL != "https://api.openai.com" || s.ListenAddr != ":8080" || s.DefaultRole != "viewer" {
+		t.Errorf("unexpected defaults: %+v", s)
+	}
+	if s.GeminiTargetURL != proxy.DefaultGeminiTargetURL {
+		t.Errorf("gemini route target = %q", s.GeminiTargetURL)
+	}
+	if s.Cache != nil || s.Stats != nil || s.AccessLog != nil || s.Webhook != nil || s.Router != nil || s.Pseudonyms != nil || s.Metrics || s.Guardrail != nil || s.Config != nil {
+		t.Error("optional components should be nil when disabled")
+	}
+	if s.SecretActions.Blocks() || s.SecretActions.For(pii.CatAWSAccessKey) != detector.ActionMask {
+		t.Errorf("secrets should be masked by default: %s", s.SecretActions)
+	}
+	if got := s.Tokenizers.String(); got != "openai=estimate:4, claude=estimate:3.5, gemini=estimate:4, default=estimate:4" {
+		t.Errorf("tokenizers = %s", got)
+	}
+	if s.VaultTTL != vault.DefaultTTL {
+		t.Errorf("vault TTL = %s, want %s by default", s.VaultTTL, vault.DefaultTTL)
+	}
+	if s.VaultResolveRate != proxy.DefaultResolveRate {
+		t.Errorf("vault resolve should be on by default, rate = %d", s.VaultResolveRate)
+	}
+	if !s.Headers.Enabled {
+		t.Error("header scanning should be on by default")
+	}
+	if !s.SessionBinding {
+		t.Error("session binding should be on by default")
+	}
+	if f := s.Fields; len(f.Rules) != 2 || f.Rules[1] != (proxy.FieldRule{Path: "metadata.*", Action: proxy.FieldRemove}) || f.Key != nil {
+		t.Errorf("request fields = %+v, want user and metadata removed by default", f)
+	}
+	if s.FailureMode != failsafe.Open {
+		t.Errorf("failure mode = %q, want open by default", s.FailureMode)
+	}
+	if s.Admin != nil {
+		t.Errorf("admin listener should be off by default: %+v", s.Admin)
+	}
+	if s.StartupProbe != nil {
+		t.Errorf("startup probe should be off by default: %+v", s.StartupProbe)
+	}
+	if got := s.RateLimitExempt.String(); got != "GET /health,/healthz,/readyz,/metrics" {
+		t.Errorf("rate limit exemptions = %s", got)
+	}
+	if s.Overload == nil || s.Overload.MaxInFlight <= 0 {
+		t.Errorf("overload protection should be on by default: %+v", s.Overload)
+	}
+	if !strings.HasPrefix(s.Upstream.UserAgent, "AgentVeil/") {
+		t.Errorf("upstream user agent = %q", s.Upstream.UserAgent)
+	}
+	if pg := s.PromptGuard; pg == nil || !pg.Sessions || pg.MaxScanBytes != 0 {
+		t.Errorf("prompt guard should be on with session scores by default: %+v", pg)
+	}
+	if len(report) != len(checks)+1 {
+		t.Errorf("expected %d results, got %d", len(checks)+1, len(report))
+	}
+}
+
+func TestLoad_ComponentErrors(t *testing.T) {
+	dir := t.TempDir()
+	badRouter := filepath.Join(dir, "router.yaml")
+	os.WriteFile(badRouter, []byte("providers:\n  - name: openai\n    base_url: https://api.openai.com\n    enabled: true\nroutes:\n  - path_prefix: /v1\n    provider: opneai\n"), 0o600)
+	badKey := filepath.Join(dir, "signing.pem")
+	os.WriteFile(badKey, []byte("not a key"), 0o600)
+	badProfiles := filepath.Join(dir, "profiles.yaml")
+	os.WriteFile(badProfiles, []byte("profiles:\n  strict:\n    sensitivity: paranoid\n"), 0o600)
+	profiledRouter := filepath.Join(dir, "profiled-router.yaml")
+	os.WriteFile(profiledRouter, []byte("providers:\n  - name: openai\n    base_url: https://api.openai.com\n    enabled: true\nroutes:\n  - path_prefix: /v1\n    provider: openai\n    detector_profile: strict\n"), 0o600)
+
+	tests := []struct {
+		component string
+		env       map[string]string
+		want      string
+	}{
+		{"server", map[string]string{"TARGET_URL": "api.openai.com"}, "TARGET_URL"},
+		{"server", map[string]string{"VEIL_DEFAULT_ROLE": "root"}, "VEIL_DEFAULT_ROLE"},
+		{"server", map[string]string{"GEMINI_TARGET_URL": "generativelanguage.googleapis.com"}, "GEMINI_TARGET_URL"},
+		{"tls", map[string]string{"TLS_CERT": "/tmp/cert.pem"}, "set together"},
+		{"tls", map[string]string{"TLS_CERT": filepath.Join(dir, "c.pem"), "TLS_KEY": filepath.Join(dir, "k.pem")}, "load TLS_CERT"},
+		{"admin_listener", map[string]string{"VEIL_ADMIN_PPROF": "true"}, "need ADMIN_LISTEN_ADDR"},
+		{"admin_listener", map[string]string{"ADMIN_LISTEN_ADDR": "9090"}, "ADMIN_LISTEN_ADDR"},
+		{"admin_listener", map[string]string{"ADMIN_LISTEN_ADDR": ":8080"}, "must differ"},
+		{"admin_listener", map[string]string{"ADMIN_LISTEN_ADDR": ":9090", "ADMIN_TLS_CLIENT_CA": "/tmp/ca.pem"}, "needs ADMIN_TLS_CERT"},
+		{"admin_listener", map[string]string{"ADMIN_LISTEN_ADDR": ":9090", "VEIL_ADMIN_PPROF": "yes"}, "VEIL_ADMIN_PPROF"},
+		{"redis", map[string]string{"REDIS_DB": "-1"}, "REDIS_DB"},
+		{"encryption", map[string]string{"VEIL_ENCRYPTION_KEY": "abcd"}, "64 hex chars"},
+		{"encryption", map[string]string{"REDIS_ADDR": "redis.internal:6379"}, "VEIL_ALLOW_PLAINTEXT_VAULT"},
+		{"encryption", map[string]string{"REDIS_CLUSTER": "127.0.0.1:7000,10.0.0.2:7000"}, "VEIL_ENCRYPTION_KEY is required"},
+		{"auth", map[string]string{"VEIL_AUTH_KEY_LOCATIONS": "header,cookie"}, "VEIL_AUTH_KEY_LOCATIONS"},
+		{"vault_ttl", map[string]string{"VEIL_VAULT_TTL": "30s"}, "VEIL_VAULT_TTL"},
+		{"vault_resolve", map[string]string{"VEIL_VAULT_RESOLVE_RATE": "many"}, "VEIL_VAULT_RESOLVE_RATE"},
+		{"rate_limit", map[string]string{"VEIL_RATE_LIMIT": "0"}, "VEIL_RATE_LIMIT"},
+		{"rate_limit", map[string]string{"VEIL_RATE_LIMIT_BACKEND": "memcached"}, "VEIL_RATE_LIMIT_BACKEND"},
+		{"rate_limit", map[string]string{"VEIL_KEY_RATE_LIMIT": "-5"}, "VEIL_KEY_RATE_LIMIT"},
+		{"rate_limit", map[string]string{"VEIL_KEY_RATE_BURST": "lots"}, "VEIL_KEY_RATE_BURST"},
+		{"rate_limit", map[string]string{"VEIL_RATE_LIMIT_EXEMPT_CIDRS": "10.0.0.0/33"}, "VEIL_RATE_LIMIT_EXEMPT_CIDRS"},
+		{"rate_limit", map[string]string{"VEIL_RATE_LIMIT_EXEMPT_PATHS": "health"}, "VEIL_RATE_LIMIT_EXEMPT_PATHS"},
+		{"webhooks", map[string]string{"VEIL_SLACK_WEBHOOK_URL": "hooks.slack.com/x"}, "slack"},
+		{"webhooks", map[string]string{"VEIL_WEBHOOK_URL": "https://siem.example.com", "VEIL_WEBHOOK_EVENTS": "pii.detected,pii.leaked"}, "unknown event type"},
+		{"webhooks", map[string]string{"VEIL_SLACK_WEBHOOK_URL": "https://hooks.slack.com/x", "VEIL_WEBHOOK_CHAT_MIN_PII": "some"}, "VEIL_WEBHOOK_CHAT_MIN_PII"},
+		{"webhooks", map[string]string{"VEIL_PAGERDUTY_ROUTING_KEY": "R0UT1NG", "VEIL_PAGERDUTY_EVENTS": "pii.high_risk,pii.leak"}, "unknown event type"},
+		{"webhooks", map[string]string{"VEIL_CLOUDEVENTS_URL": "kafka-bridge:8080/events"}, "cloudevents"},
+		{"webhooks", map[string]string{"VEIL_SLACK_WEBHOOK_URL": "https://hooks.slack.com/x", "VEIL_WEBHOOK_CHAT_DIGEST": "500ms"}, "VEIL_WEBHOOK_CHAT_DIGEST"},
+		{"webhooks", map[string]string{"VEIL_WEBHOOK_URL": "https://siem.example.com", "VEIL_WEBHOOK_CONCURRENCY": "0"}, "VEIL_WEBHOOK_CONCURRENCY"},
+		{"cache", map[string]string{"VEIL_CACHE": "true", "VEIL_CACHE_TTL": "soon"}, "VEIL_CACHE_TTL"},
+		{"stats", map[string]string{"VEIL_STATS": "true", "VEIL_STATS_NOISE_EPSILON": "-1"}, "VEIL_STATS_NOISE_EPSILON"},
+		{"feedback", map[string]string{"VEIL_FEEDBACK": "true", "VEIL_FEEDBACK_SUPPRESS_AFTER": "3"}, "VEIL_FEEDBACK_KEY"},
+		{"feedback", map[string]string{"VEIL_FEEDBACK": "true", "VEIL_FEEDBACK_SUPPRESS_AFTER": "3", "VEIL_FEEDBACK_KEY": strings.Repeat("ab", 32), "VEIL_ENCRYPTION_KEY": strings.Repeat("ab", 32)}, "must differ"},
+		{"sse", map[string]string{"VEIL_SSE_HEARTBEAT": "15"}, "VEIL_SSE_HEARTBEAT"},
+		{"upstream", map[string]string{"VEIL_UPSTREAM_HEADER_TIMEOUT": "30"}, "VEIL_UPSTREAM_HEADER_TIMEOUT"},
+		{"upstream", map[string]string{"VEIL_UPSTREAM_MAX_IDLE_CONNS": "0"}, "VEIL_UPSTREAM_MAX_IDLE_CONNS"},
+		{"headers", map[string]string{"VEIL_HEADER_DENY": "X-Tenant, X User"}, "VEIL_HEADER_DENY"},
+		{"request_fields", map[string]string{"VEIL_REQUEST_FIELDS": "user=encrypt"}, "VEIL_REQUEST_FIELDS"},
+		{"request_fields", map[string]string{"VEIL_REQUEST_FIELDS": "metadata..email"}, "invalid field path"},
+		{"request_fields", map[string]string{"VEIL_REQUEST_FIELD_ACTION": "hash"}, "VEIL_REQUEST_FIELD_KEY"},
+		{"request_fields", map[string]string{"VEIL_REQUEST_FIELD_ACTION": "hash", "VEIL_REQUEST_FIELD_KEY": strings.Repeat("ab", 32), "VEIL_ENCRYPTION_KEY": strings.Repeat("ab", 32)}, "must differ"},
+		{"binary", map[string]string{"VEIL_BINARY_MIN_LENGTH": "1k"}, "VEIL_BINARY_MIN_LENGTH"},
+		{"files", map[string]string{"VEIL_MAX_FILE_SIZE_MB": "512M"}, "VEIL_MAX_FILE_SIZE_MB"},
+		{"count_tokens", map[string]string{"VEIL_COUNT_TOKENS": "skip"}, "VEIL_COUNT_TOKENS"},
+		{"lang", map[string]string{"VEIL_LANG": "fr"}, "VEIL_LANG"},
+		{"failure_mode", map[string]string{"VEIL_FAILURE_MODE": "strict"}, "VEIL_FAILURE_MODE"},
+		{"overload", map[string]string{"VEIL_MAX_INFLIGHT": "0"}, "VEIL_MAX_INFLIGHT"},
+		{"overload", map[string]string{"VEIL_OVERLOAD_QUEUE_TIMEOUT": "2"}, "VEIL_OVERLOAD_QUEUE_TIMEOUT"},
+		{"overload", map[string]string{"VEIL_OVERLOAD_MEMORY_MB": "lots"}, "VEIL_OVERLOAD_MEMORY_MB"},
+		{"break_glass", map[string]string{"VEIL_BREAK_GLASS_MAX_DURATION": "30s"}, "VEIL_BREAK_GLASS_MAX_DURATION"},
+		{"startup_probe", map[string]string{"VEIL_STARTUP_PROBE": "on"}, "VEIL_STARTUP_PROBE"},
+		{"startup_probe", map[string]string{"VEIL_STARTUP_PROBE": "strict", "VEIL_STARTUP_PROBE_TIMEOUT": "0s"}, "VEIL_STARTUP_PROBE_TIMEOUT"},
+		{"session_binding", map[string]string{"VEIL_SESSION_BINDING": "off"}, "VEIL_SESSION_BINDING"},
+		{"signing", map[string]string{"VEIL_SIGNING_KEY_FILE": badKey}, "VEIL_SIGNING_KEY_FILE"},
+		{"access_log", map[string]string{"VEIL_ACCESS_LOG": "stdout", "VEIL_ACCESS_LOG_FIELDS": "all"}, "unknown access log fields"},
+		{"access_log", map[string]string{"VEIL_ACCESS_LOG": filepath.Join(dir, "missing", "access.log")}, "directory"},
+		{"access_log", map[string]string{"VEIL_ACCESS_LOG": "stdout", "VEIL_ACCESS_LOG_REDIS_STREAM": "veil:access", "VEIL_ACCESS_LOG_REDIS_MAXLEN": "0"}, "VEIL_ACCESS_LOG_REDIS_MAXLEN must be a positive integer"},
+		{"detector", map[string]string{"DETECTOR_ADDR": "ftp://detector:9091"}, "DETECTOR_ADDR"},
+		{"deep_scan", map[string]string{"VEIL_DEEP_SCAN_PERCENT": "10%"}, "VEIL_DEEP_SCAN_PERCENT"},
+		{"detector_profiles", map[string]string{"VEIL_DETECTOR_PROFILES": badProfiles}, "invalid sensitivity"},
+		{"pseudonyms", map[string]string{"VEIL_PSEUDONYMS": "PHONE"}, "VEIL_PSEUDONYM_KEY"},
+		{"pseudonyms", map[string]string{"VEIL_PSEUDONYMS": "SHOE", "VEIL_PSEUDONYM_KEY": strings.Repeat("ab", 32)}, "unknown category"},
+		{"pseudonyms", map[string]string{"VEIL_PSEUDONYMS": "PHONE", "VEIL_PSEUDONYM_KEY": strings.Repeat("ab", 32), "VEIL_ENCRYPTION_KEY": strings.Repeat("AB", 32)}, "must differ"},
+		{"secret_action", map[string]string{"VEIL_SECRET_ACTION": "drop"}, "invalid action"},
+		{"secret_action", map[string]string{"VEIL_SECRET_ACTION": "EMAIL=block"}, "not a secret category"},
+		{"pii_policy", map[string]string{"VEIL_PII_POLICY": "EMAIL=drop"}, "VEIL_PII_POLICY"},
+		{"pii_policy", map[string]string{"VEIL_PII_POLICY": "EMIAL=allow"}, "EMIAL"},
+		{"metrics", map[string]string{"VEIL_METRICS": "yes"}, "VEIL_METRICS"},
+		{"metrics", map[string]string{"VEIL_METRICS": "true", "VEIL_METRICS_AUTH": "1"}, "VEIL_METRICS_AUTH"},
+		{"pii_policy", map[string]string{"VEIL_PII_POLICY": "SECRET_JWT=allow"}, "VEIL_SECRET_ACTION"},
+		{"promptguard", map[string]string{"VEIL_PROMPTGUARD": "on"}, "VEIL_PROMPTGUARD"},
+		{"promptguard", map[string]string{"VEIL_PROMPTGUARD_MAX_SCAN_BYTES": "10MB"}, "VEIL_PROMPTGUARD_MAX_SCAN_BYTES"},
+		{"guardrail", map[string]string{"VEIL_GUARDRAIL": "true", "VEIL_GUARDRAIL_MAX_OUTPUT_TOKENS": "-1"}, "VEIL_GUARDRAIL_MAX_OUTPUT_TOKENS"},
+		{"guardrail", map[string]string{"VEIL_GUARDRAIL": "true", "VEIL_GUARDRAIL_BLOCK_PII": "yes"}, "VEIL_GUARDRAIL_BLOCK_PII"},
+		{"guardrail", map[string]string{"VEIL_GUARDRAIL": "true", "VEIL_GUARDRAIL_PII_ACTION": "mask"}, "VEIL_GUARDRAIL_PII_ACTION"},
+		{"pattern_bundle", map[string]string{"VEIL_PATTERN_BUNDLE": "http://patterns.example.com/bundle.yaml"}, "https URL"},
+		{"pattern_bundle", map[string]string{"VEIL_PATTERN_BUNDLE": "bundle.yaml"}, "VEIL_PATTERN_BUNDLE_KEY_FILE"},
+		{"pattern_bundle", map[string]string{"VEIL_PATTERN_BUNDLE": "bundle.yaml", "VEIL_PATTERN_BUNDLE_KEY_FILE": badKey}, "VEIL_PATTERN_BUNDLE_KEY_FILE"},
+		{"transcripts", map[string]string{"VEIL_TRANSCRIPTS": "redis", "VEIL_TRANSCRIPTS_MAX_AGE": "forever"}, "VEIL_TRANSCRIPTS_MAX_AGE"},
+		{"forward_proxy", map[string]string{"VEIL_MITM_ADDR": "8443"}, "host:port"},
+		{"forward_proxy", map[string]string{"VEIL_MITM_ADDR": ":8443", "VEIL_MITM_CA_CERT": filepath.Join(dir, "missing.pem")}, "--gen-ca"},
+		{"router", map[string]string{"VEIL_ROUTER_CONFIG": badRouter}, "unknown provider opneai"},
+		{"router", map[string]string{"VEIL_ROUTER_CONFIG": filepath.Join(dir, "nope.yaml")}, "VEIL_ROUTER_CONFIG"},
+		{"router", map[string]string{"VEIL_ROUTER_CONFIG": profiledRouter}, `detector profile "strict" is not defined`},
+		{"tokenizer", map[string]string{"VEIL_TOKEN_RATIOS": "mistral=3"}, "unknown model family"},
+		{"tokenizer", map[string]string{"VEIL_TOKENIZER_CL100K": badKey}, "VEIL_TOKENIZER_CL100K"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.component+"/"+tt.want, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, report := Load()
+			if report.OK() {
+				t.Fatal("expected validation to fail")
+			}
+			res := resultFor(report, tt.component)
+			if res.Err == nil || !strings.Contains(res.Err.Error(), tt.want) {
+				t.Errorf("%s error = %v, want mention of %q", tt.component, res.Err, tt.want)
+			}
+			if n := len(report.Errors()); n != 1 {
+				t.Errorf("expected only %s to fail, got %d errors: %+v", tt.component, n, report.Errors())
+			}
+		})
+	}
+}
+
+func TestLoad_ReportsEveryError(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("VEIL_ENCRYPTION_KEY", "zz")
+	t.Setenv("VEIL_SSE_HEARTBEAT", "never")
+	_, report := Load()
+	if n := len(report.Errors()); n != 2 {
+		t.Errorf("expected 2 errors, got %d: %+v", n, report.Errors())
+	}
+}
+
+func TestLoad_EnabledComponents(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	routerPath := filepath.Join(dir, "router.yaml")
+	os.WriteFile(routerPath, []byte("providers:\n  - name: openai\n    base_url: https://api.openai.com\n    enabled: true\nroutes:\n  - path_prefix: /v1/support\n    provider: openai\n    detector_profile: strict\n"), 0o600)
+	t.Setenv("VEIL_ROUTER_CONFIG", routerPath)
+	profilesPath := filepath.Join(dir, "profiles.yaml")
+	os.WriteFile(profilesPath, []byte("profiles:\n  strict:\n    sensitivity: high\n  code:\n    patterns: [secrets]\n"), 0o600)
+	t.Setenv("VEIL_DETECTOR_PROFILES", profilesPath)
+	t.Setenv("VEIL_PSEUDONYMS", "PHONE:2,EMAIL")
+	t.Setenv("VEIL_PSEUDONYM_KEY", strings.Repeat("cd", 32))
+	t.Setenv("VEIL_CACHE", "true")
+	t.Setenv("VEIL_CACHE_TTL", "1m")
+	t.Setenv("VEIL_FEEDBACK", "true")
+	t.Setenv("VEIL_FEEDBACK_SUPPRESS_AFTER", "3")
+	t.Setenv("VEIL_FEEDBACK_KEY", strings.Repeat("ef", 32))
+	t.Setenv("VEIL_WEBHOOK_URL", "https://siem.example.com/hook")
+	t.Setenv("VEIL_WEBHOOK_EVENTS", "pii.high_risk, prompt_injection.detected")
+	t.Setenv("VEIL_SLACK_WEBHOOK_URL", "https://hooks.slack.com/services/x")
+	t.Setenv("VEIL_WEBHOOK_CHAT_MIN_PII", "secrets")
+	t.Setenv("VEIL_WEBHOOK_CHAT_COOLDOWN", "10m")
+	t.Setenv("VEIL_WEBHOOK_CHAT_DIGEST", "15m")
+	t.Setenv("VEIL_WEBHOOK_CONCURRENCY", "8")
+	t.Setenv("VEIL_SSE_HEARTBEAT", "0")
+	t.Setenv("VEIL_UPSTREAM_TIMEOUT", "5m")
+	t.Setenv("VEIL_UPSTREAM_MAX_IDLE_CONNS", "64")
+	t.Setenv("VEIL_UPSTREAM_RETRY", "true")
+	t.Setenv("VEIL_UPSTREAM_USER_AGENT", "false")
+	t.Setenv("VEIL_VAULT_TTL", "24h")
+	t.Setenv("VEIL_VAULT_RESOLVE_RATE", "3")
+	t.Setenv("VEIL_RATE_LIMIT", "120")
+	t.Setenv("VEIL_RATE_LIMIT_BACKEND", "redis")
+	t.Setenv("VEIL_KEY_RATE_LIMIT", "300")
+	t.Setenv("VEIL_KEY_RATE_BURST", "40")
+	t.Setenv("VEIL_RATE_LIMIT_EXEMPT_METHODS", "none")
+	t.Setenv("VEIL_RATE_LIMIT_EXEMPT_CIDRS", "10.0.0.0/8, fd00::/8")
+	t.Setenv("VEIL_RATE_LIMIT_EXEMPT_USER_AGENTS", "kube-probe/")
+	t.Setenv("VEIL_HEADER_ALLOW", "X-Trace-*")
+	t.Setenv("VEIL_HEADER_DENY", "X-Internal-Tenant, X-Debug")
+	t.Setenv("VEIL_BINARY_MIN_LENGTH", "0")
+	t.Setenv("VEIL_REQUEST_FIELDS", "user=hash, metadata.*, messages.name=constant")
+	t.Setenv("VEIL_REQUEST_FIELD_KEY", strings.Repeat("cd", 32))
+	t.Setenv("ADMIN_LISTEN_ADDR", "127.0.0.1:9090")
+	t.Setenv("VEIL_ADMIN_PPROF", "true")
+	t.Setenv("VEIL_STARTUP_PROBE", "strict")
+	t.Setenv("VEIL_STARTUP_PROBE_TIMEOUT", "2m")
+	t.Setenv("VEIL_MAX_INFLIGHT", "200")
+	t.Setenv("VEIL_OVERLOAD_QUEUE", "0")
+	t.Setenv("VEIL_OVERLOAD_MEMORY_MB", "1024")
+	t.Setenv("VEIL_ACCESS_LOG", filepath.Join(dir, "access.log"))
+	t.Setenv("VEIL_ACCESS_LOG_REDIS_STREAM", "veil:access")
+	t.Setenv("VEIL_TRANSCRIPTS", filepath.Join(dir, "transcripts"))
+	caCert, caKey := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	if err := mitm.GenerateCA(caCert, caKey); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VEIL_MITM_ADDR", "127.0.0.1:8443")
+	t.Setenv("VEIL_MITM_HOSTS", "api.openai.com, API.Anthropic.com")
+	t.Setenv("VEIL_MITM_CA_CERT", caCert)
+	t.Setenv("VEIL_MITM_CA_KEY", caKey)
+	pub, _, _ := ed25519.GenerateKey(nil)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	pubPath := filepath.Join(dir, "bundle.pub")
+	os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600)
+	t.Setenv("VEIL_PATTERN_BUNDLE", "https://patterns.example.com/bundle.yaml")
+	t.Setenv("VEIL_PATTERN_BUNDLE_KEY_FILE", pubPath)
+	var ranks strings.Builder
+	for c := 0; c < 256; c++ {
+		fmt.Fprintf(&ranks, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(c)}), c)
+	}
+	ranksPath := filepath.Join(dir, "cl100k_base.tiktoken")
+	os.WriteFile(ranksPath, []byte(ranks.String()), 0o600)
+	t.Setenv("VEIL_TOKENIZER_CL100K", ranksPath)
+	t.Setenv("VEIL_TOKEN_RATIOS", "claude=3")
+	t.Setenv("VEIL_SECRET_ACTION", "strip, SECRET_AWS_*=block")
+	t.Setenv("VEIL_PII_POLICY", "email=allow, CREDIT_CARD=redact")
+	t.Setenv("VEIL_METRICS", "true")
+	t.Setenv("VEIL_METRICS_AUTH", "true")
+
+	s, report := Load()
+	if !report.OK() {
+		t.Fatalf("unexpected errors: %+v", report.Errors())
+	}
+	if s.Router == nil || len(s.Router.Providers) != 1 {
+		t.Errorf("router not loaded: %+v", s.Router)
+	}
+	if p, ok := s.DetectorProfiles["strict"]; !ok || p.Sensitivity != detector.SensitivityHigh || len(s.DetectorProfiles) != 2 {
+		t.Errorf("detector profiles = %+v", s.DetectorProfiles)
+	}
+	if got := s.Tokenizers.String(); got != "openai=cl100k_base, claude=estimate:3, gemini=estimate:4, default=estimate:4" {
+		t.Errorf("tokenizers = %s", got)
+	}
+	if s.SecretActions.For(pii.CatAWSSecretKey) != detector.ActionBlock || s.SecretActions.For(pii.CatJWT) != detector.ActionStrip {
+		t.Errorf("secret actions = %s", s.SecretActions)
+	}
+	if s.PIIPolicy[pii.CatEmail] != detector.ActionAllow || s.PIIPolicy[pii.CatCreditCard] != detector.ActionRedact {
+		t.Errorf("pii policy = %v", s.PIIPolicy)
+	}
+	if !s.Metrics || !s.MetricsAuth {
+		t.Errorf("metrics = %v, auth %v", s.Metrics, s.MetricsAuth)
+	}
+	if p := s.Pseudonyms; p == nil || len(p.Key) != 32 || len(p.Categories) != 2 || p.Categories[pii.CatPhone].KeepLast != 2 {
+		t.Errorf("pseudonyms = %+v", p)
+	}
+	if f := s.Feedback; f == nil || f.SuppressAfter != 3 || len(f.Key) != 32 {
+		t.Errorf("feedback = %+v", f)
+	}
+	if s.Cache == nil || s.Cache.TTL != time.Minute {
+		t.Errorf("cache = %+v", s.Cache)
+	}
+	if s.Webhook == nil || len(s.Webhook.Destinations) != 1 || len(s.Webhook.Destinations[0].Events) != 2 || s.Webhook.Concurrency != 8 {
+		t.Errorf("webhook = %+v", s.Webhook)
+	}
+	if s.Webhook != nil {
+		if p := s.Webhook.Slack.Alerting; p == nil || !p.Rules[webhook.EventPIIDetected].SecretsOnly || p.CooldownSec != 600 || p.DigestSec != 900 {
+			t.Errorf("slack alerting = %+v", p)
+		}
+		if s.Webhook.Destinations[0].Alerting != nil {
+			t.Error("the custom webhook must receive every event")
+		}
+	}
+	if s.SSEHeartbeat >= 0 {
+		t.Errorf("VEIL_SSE_HEARTBEAT=0 should disable the heartbeat, got %v", s.SSEHeartbeat)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "access.log")); !os.IsNotExist(err) {
+		t.Error("Load must not create the access log")
+	}
+	if s.AccessLog == nil || s.AccessLog.RedisStream != "veil:access" || s.AccessLog.RedisMaxLen != 100000 {
+		t.Errorf("access log = %+v", s.AccessLog)
+	}
+	if s.Transcripts == nil || s.Transcripts.MaxAge != 30*24*time.Hour {
+		t.Errorf("transcripts = %+v", s.Transcripts)
+	}
+	if b := s.PatternBundle; b == nil || b.Source != "https://patterns.example.com/bundle.yaml" || !pub.Equal(b.PublicKey) {
+		t.Errorf("pattern bundle = %+v", b)
+	}
+	if s.MITM == nil || len(s.MITM.Hosts) != 2 || s.MITM.Hosts[1] != "api.anthropic.com" {
+		t.Errorf("forward proxy = %+v", s.MITM)
+	}
+	if u := s.Upstream; u.Timeout != 5*time.Minute || u.MaxIdleConnsPerHost != 64 || !u.Retry ||
+		u.ResponseHeaderTimeout != upstream.DefaultResponseHeaderTimeout || u.UserAgent != "" {
+		t.Errorf("upstream = %+v", u)
+	}
+	if s.VaultTTL != 24*time.Hour {
+		t.Errorf("vault TTL = %s", s.VaultTTL)
+	}
+	if s.VaultResolveRate != 3 {
+		t.Errorf("vault resolve rate = %d", s.VaultResolveRate)
+	}
+	if s.RateLimit != 120 || !s.RateLimitRedis {
+		t.Errorf("rate limit = %d, redis = %v", s.RateLimit, s.RateLimitRedis)
+	}
+	if s.KeyRateLimit != 300 || s.KeyRateBurst != 40 {
+		t.Errorf("key rate limit = %d, burst = %d", s.KeyRateLimit, s.KeyRateBurst)
+	}
+	if got := s.RateLimitExempt.String(); got != "any method /health,/healthz,/readyz,/metrics; from 10.0.0.0/8,fd00::/8; user agents kube-probe/" {
+		t.Errorf("rate limit exemptions = %s", got)
+	}
+	if h := s.Headers; !h.Enabled || len(h.Allow) != 1 || len(h.Deny) != 2 || h.Deny[1] != "X-Debug" {
+		t.Errorf("headers = %+v", h)
+	}
+	if f := s.Fields; len(f.Rules) != 3 || f.Rules[0].Action != proxy.FieldHash || f.Rules[1].Action != proxy.FieldRemove ||
+		f.Rules[2] != (proxy.FieldRule{Path: "messages.name", Action: proxy.FieldConstant}) || len(f.Key) != 32 {
+		t.Errorf("request fields = %+v", f)
+	}
+	if a := s.Admin; a == nil || a.Addr != "127.0.0.1:9090" || !a.Pprof {
+		t.Errorf("admin listener = %+v", a)
+	}
+	if p := s.StartupProbe; p == nil || p.Timeout != 2*time.Minute {
+		t.Errorf("startup probe = %+v", p)
+	}
+	if s.BinaryMinLength >= 0 {
+		t.Errorf("VEIL_BINARY_MIN_LENGTH=0 should leave only data URIs, got %d", s.BinaryMinLength)
+	}
+	if o := s.Overload; o == nil || o.MaxInFlight != 200 || o.QueueSize != 0 ||
+		o.MemoryHighWater != 1<<30 || o.MemoryCritical != 1280<<20 {
+		t.Errorf("overload = %+v", o)
+	}
+}
+
+func TestLoad_Guardrail(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("VEIL_GUARDRAIL", "true")
+	t.Setenv("VEIL_GUARDRAIL_MAX_REQUESTS_PER_MIN", "0")
+	t.Setenv("VEIL_GUARDRAIL_BLOCKED_TOPICS", "weapons, gambling")
+	t.Setenv("VEIL_PROMPTGUARD", "false")
+	s, report := Load()
+	if !report.OK() {
+		t.Fatalf("unexpected errors: %+v", report.Errors())
+	}
+	p := s.Guardrail
+	if p == nil || p.MaxOutputTokens != 4096 || p.MaxRequestsPerMin != 0 || !p.BlockPIIInOutput || p.PIIOutputAction != "block" {
+		t.Fatalf("guardrail policy = %+v, want the defaults with session limits off", p)
+	}
+	if len(p.BlockedTopics) != 2 || p.BlockedTopics[1] != "gambling" {
+		t.Errorf("blocked topics = %q", p.BlockedTopics)
+	}
+	if s.PromptGuard != nil {
+		t.Error("VEIL_PROMPTGUARD=false should disable the prompt guard")
+	}
+}
+
+func TestLoad_ConfigFile(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "veil.yaml")
+	os.WriteFile(path, []byte(`proxy:
+  target_url: https://api.anthropic.com
+  listen_addr: ":9000"
+ratelimit:
+  requests_per_minute: 600
+  exempt_paths: [/health, /status]
+guardrail:
+  enabled: true
+  blocked_topics:
+    - weapons
+promptguard:
+  sessoins: false
+`), 0o600)
+	t.Setenv("VEIL_CONFIG", path)
+	t.Setenv("LISTEN_ADDR", ":9100") // the environment wins
+
+	s, report := Load()
+	if !report.OK() {
+		t.Fatalf("unexpected errors: %+v", report.Errors())
+	}
+	if s.TargetURL != "https://api.anthropic.com" || s.ListenAddr != ":9100" || s.RateLimit != 600 {
+		t.Errorf("target %s, listen %s, rate limit %d", s.TargetURL, s.ListenAddr, s.RateLimit)
+	}
+	if got := s.RateLimitExempt.String(); got != "GET /health,/status" {
+		t.Errorf("exemptions = %s", got)
+	}
+	if s.Guardrail == nil || len(s.Guardrail.BlockedTopics) != 1 {
+		t.Errorf("guardrail = %+v", s.Guardrail)
+	}
+	res := resultFor(report, "config")
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "line 12: promptguard.sessoins: unknown key") {
+		t.Errorf("warnings = %q", res.Warnings)
+	}
+
+	// An invalid value names the line that set it
+	os.WriteFile(path, []byte("ratelimit:\n  backend: memcached\n"), 0o600)
+	_, report = Load()
+	if err := resultFor(report, "rate_limit").Err; err == nil || !strings.Contains(err.Error(), path+":2: ratelimit.backend") {
+		t.Errorf("rate_limit error = %v, want the file's line", err)
+	}
+
+	os.WriteFile(path, []byte("proxy:\n  encryption_key: abcd\n"), 0o600)
+	if _, report = Load(); resultFor(report, "config").Err == nil {
+		t.Error("a secret in the file should fail the config check")
+	}
+}
+
+func TestLoad_GeminiRouteDisabled(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("GEMINI_TARGET_URL", "none")
+	s, report := Load()
+	if !report.OK() {
+		t.Fatalf("unexpected errors: %+v", report.Errors())
+	}
+	if s.GeminiTargetURL != "" {
+		t.Errorf("GEMINI_TARGET_URL=none should disable the route, target = %q", s.GeminiTargetURL)
+	}
+}
+
+func TestLoad_VaultResolveDisabled(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("VEIL_VAULT_RESOLVE", "false")
+	t.Setenv("VEIL_VAULT_RESOLVE_RATE", "many") // ignored when disabled
+	s, report := Load()
+	if !report.OK() {
+		t.Fatalf("unexpected errors: %+v", report.Errors())
+	}
+	if s.VaultResolveRate != 0 {
+		t.Errorf("VEIL_VAULT_RESOLVE=false should disable the endpoint, rate = %d", s.VaultResolveRate)
+	}
+}
+
+func TestLoad_PlaintextVaultOverride(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("REDIS_ADDR", "redis.internal:6379")
+	t.Setenv("VEIL_ALLOW_PLAINTEXT_VAULT", "true")
+	s, report := Load()
+	if !report.OK() {
+		t.Fatalf("unexpected errors: %+v", report.Errors())
+	}
+	if !s.PlaintextVault || s.EncryptionKey != nil {
+		t.Errorf("override should be recorded: %+v", s)
+	}
+
+	// A local Redis needs no override, and a key makes it moot
+	for _, env := range []map[string]string{
+		{"REDIS_ADDR": "/run/redis/redis.sock"},
+		{"REDIS_ADDR": "redis.internal:6379", "VEIL_ENCRYPTION_KEY": strings.Repeat("ab", 32)},
+	} {
+		for k, v := range env {
+			t.Setenv(k, v)
+		}
+		if s, report := Load(); !report.OK() || s.PlaintextVault {
+			t.Errorf("%v: plaintext override = %v, errors %+v", env, s.PlaintextVault, report.Errors())
+		}
+	}
+}
+
+func TestReport_Print(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("VEIL_ENCRYPTION_KEY", "abcd")
+	_, report := Load()
+
+	var buf bytes.Buffer
+	report.Print(&buf)
+	out := buf.String()
+	if !strings.HasPrefix(out, "COMPONENT") {
+		t.Errorf("missing header:\n%s", out)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "encryption") && !strings.Contains(line, "error") {
+			t.Errorf("encryption row should be an error: %q", line)
+		}
+		if strings.HasPrefix(line, "server") && !strings.Contains(line, "ok") {
+			t.Errorf("server row should be ok: %q", line)
+		}
+	}
+}
+
+func TestCheckRedis(t *testing.T) {
+	clearEnv(t)
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_ADDR", mr.Addr())
+	s, report := Load()
+	if !report.OK() {
+		t.Fatal(report.Errors())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if res := CheckRedis(ctx, s.Redis); res.Err != nil {
+		t.Errorf("ping failed: %v", res.Err)
+	}
+
+	mr.Close()
+	if res := CheckRedis(ctx, s.Redis); res.Err == nil {
+		t.Error("expected ping to fail once Redis is down")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	clearEnv(t)
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_ADDR", mr.Addr())
+
+	var buf bytes.Buffer
+	if !Validate(&buf, true) {
+		t.Fatalf("expected success:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "redis_ping") {
+		t.Errorf("--check-redis row missing:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if Validate(&buf, false) != true || strings.Contains(buf.String(), "redis_ping") {
+		t.Errorf("Redis must not be probed without checkRedis:\n%s", buf.String())
+	}
+
+	t.Setenv("VEIL_CACHE", "true")
+	t.Setenv("VEIL_CACHE_MAX_ENTRIES", "many")
+	buf.Reset()
+	if Validate(&buf, false) {
+		t.Errorf("expected failure:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,260 @@
+// Package breakglass is the emergency switch for a misbehaving guard. While
+// active, the prompt guard and guardrail middlewares let requests through
+// that they would have blocked; each one is still logged, counted and sent
+// to webhooks tagged break_glass. Activation is time-boxed and expires on
+// its own, and both activation and expiry are audit-logged.
+package breakglass
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// Defaults
+const (
+	DefaultMaxDuration = 4 * time.Hour
+)
+
+// ConfirmHeader must be sent with ConfirmValue to activate, so a replayed
+// or mistyped admin call cannot switch blocking off on its own
+const (
+	ConfirmHeader = "X-Veil-Confirm"
+	ConfirmValue  = "break-glass"
+)
+
+// Sources of bypassed blocks
+const (
+	SourcePromptGuard = "promptguard"
+	SourceGuardrail   = "guardrail"
+)
+
+// Config limits activations
+type Config struct {
+	MaxDuration time.Duration // longest activation accepted
+}
+
+// DefaultConfig returns the default limits
+func DefaultConfig() Config {
+	return Config{MaxDuration: DefaultMaxDuration}
+}
+
+// Status is a snapshot of the switch. Bypassed and Activations count since
+// startup, across activations.
+type Status struct {
+	Active      bool              `json:"active"`
+	Reason      string            `json:"reason,omitempty"`
+	KeyID       string            `json:"key_id,omitempty"`
+	ActivatedAt time.Time         `json:"activated_at,omitzero"`
+	ExpiresAt   time.Time         `json:"expires_at,omitzero"`
+	Activations uint64            `json:"activations"`
+	Bypassed    map[string]uint64 `json:"bypassed,omitempty"` // would-be blocks let through, by source
+}
+
+// Public is the part of the status fit for unauthenticated health probes
+func (s Status) Public() Status {
+	return Status{Active: s.Active, ExpiresAt: s.ExpiresAt}
+}
+
+// Switch is the global log-only switch. A nil *Switch is never active.
+type Switch struct {
+	cfg     Config
+	audit   *accesslog.Logger
+	webhook *webhook.Dispatcher
+	now     func() time.Time
+
+	mu          sync.Mutex
+	state       Status // Active is derived from ExpiresAt
+	activations uint64
+	bypassed    map[string]uint64
+	timer       *time.Timer
+}
+
+// New creates an inactive Switch. Activation and expiry are written to
+// audit (stdout when nil) and sent to wh when set.
+func New(cfg Config, audit *accesslog.Logger, wh *webhook.Dispatcher) *Switch {
+	if cfg.MaxDuration <= 0 {
+		cfg.MaxDuration = DefaultMaxDuration
+	}
+	if audit == nil {
+		audit = accesslog.NewWithWriter(os.Stdout, accesslog.FieldsCommon)
+	}
+	return &Switch{
+		cfg:      cfg,
+		audit:    audit,
+		webhook:  wh,
+		now:      time.Now,
+		bypassed: make(map[string]uint64),
+	}
+}
+
+// Active reports whether blocks are currently bypassed
+func (s *Switch) Active() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeLocked()
+}
+
+func (s *Switch) activeLocked() bool {
+	return !s.state.ExpiresAt.IsZero() && s.now().Before(s.state.ExpiresAt)
+}
+
+// Status returns a snapshot of the switch
+func (s *Switch) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.state
+	st.Active = s.activeLocked()
+	if !st.Active {
+		st = Status{}
+	}
+	st.Activations = s.activations
+	if len(s.bypassed) > 0 {
+		st.Bypassed = make(map[string]uint64, len(s.bypassed))
+		for k, v := range s.bypassed {
+			st.Bypassed[k] = v
+		}
+	}
+	return st
+}
+
+// Activate bypasses blocking for d. Activating again while active replaces
+// the reason and the expiry.
+func (s *Switch) Activate(d time.Duration, reason, keyID, role string) (Status, error) {
+	if d <= 0 || d > s.cfg.MaxDuration {
+		return Status{}, fmt.Errorf("duration must be between 1 minute and %s", s.cfg.MaxDuration)
+	}
+	if reason == "" {
+		return Status{}, fmt.Errorf("reason is required")
+	}
+
+	s.mu.Lock()
+	now := s.now()
+	s.state = Status{Reason: reason, KeyID: keyID, ActivatedAt: now, ExpiresAt: now.Add(d)}
+	s.activations++
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	expires := s.state.ExpiresAt
+	s.timer = time.AfterFunc(d, func() { s.expire(expires) })
+	s.mu.Unlock()
+
+	slog.Warn("break-glass: blocking disabled, guards are log-only",
+		"reason", reason, "key_id", keyID, "expires_at", expires)
+	s.audit.Audit(accesslog.AuditEvent{
+		Event:   "break_glass",
+		KeyID:   keyID,
+		Role:    role,
+		Reason:  reason,
+		Outcome: "activated",
+	})
+	s.emit(webhook.EventBreakGlassActivated, map[string]any{
+		"reason":     reason,
+		"key_id":     keyID,
+		"expires_at": expires,
+	})
+	return s.Status(), nil
+}
+
+// expire records the end of the activation that was to expire at expires,
+// unless it was replaced since
+func (s *Switch) expire(expires time.Time) {
+	s.mu.Lock()
+	if !s.state.ExpiresAt.Equal(expires) {
+		s.mu.Unlock()
+		return
+	}
+	prev := s.state
+	s.state = Status{}
+	s.timer = nil
+	s.mu.Unlock()
+
+	slog.Warn("break-glass: expired, blocking restored", "reason", prev.Reason)
+	s.audit.Audit(accesslog.AuditEvent{
+		Event:   "break_glass",
+		KeyID:   prev.KeyID,
+		Reason:  prev.Reason,
+		Outcome: "expired",
+	})
+	s.emit(webhook.EventBreakGlassExpired, map[string]any{
+		"reason":       prev.Reason,
+		"key_id":       prev.KeyID,
+		"activated_at": prev.ActivatedAt,
+	})
+}
+
+// Bypass records a block the source let through because the switch is
+// active. t is the webhook event the block would have carried; its data
+// gains "break_glass": true.
+func (s *Switch) Bypass(source string, t webhook.EventType, sessionID string, data map[string]any) {
+	s.mu.Lock()
+	s.bypassed[source]++
+	s.mu.Unlock()
+
+	slog.Warn("break-glass: would have blocked, allowed",
+		"source", source, "session_id", sessionID)
+	if data == nil {
+		data = make(map[string]any)
+	}
+	data["break_glass"] = true
+	data["source"] = source
+	if s.webhook != nil {
+		s.webhook.Emit(webhook.Event{Type: t, SessionID: sessionID, Data: data})
+	}
+}
+
+func (s *Switch) emit(t webhook.EventType, data map[string]any) {
+	if s.webhook != nil {
+		s.webhook.Emit(webhook.Event{Type: t, Data: data})
+	}
+}
+
+// Close stops the expiry timer
+func (s *Switch) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
+
+// Request is the body of POST /admin/breakglass
+type Request struct {
+	DurationMinutes int    `json:"duration_minutes"`
+	Reason          string `json:"reason"`
+}
+
+// Handler serves POST /admin/breakglass. It expects the caller to be
+// authenticated as an admin and the confirmation header to be set.
+func (s *Switch) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ConfirmHeader) != ConfirmValue {
+			http.Error(w, fmt.Sprintf(`{"error":"confirmation_required","message":"set %s: %s to disable blocking"}`, ConfirmHeader, ConfirmValue), http.StatusPreconditionRequired)
+			return
+		}
+		var req Request
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, `{"error":"bad_request","message":"invalid JSON body"}`, http.StatusBadRequest)
+			return
+		}
+		st, err := s.Activate(time.Duration(req.DurationMinutes)*time.Minute, req.Reason,
+			r.Header.Get("X-Veil-Key-ID"), r.Header.Get("X-User-Role"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"bad_request","message":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(st)
+	})
+}
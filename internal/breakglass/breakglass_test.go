@@ -0,0 +1,149 @@
+package breakglass
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// syncBuffer is a bytes.Buffer safe for the expiry timer's writes
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestActivateAndExpire(t *testing.T) {
+	var events []webhook.Event
+	var mu sync.Mutex
+	hooks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+	defer hooks.Close()
+	cfg := webhook.DefaultConfig()
+	cfg.RetryCount = 0
+	cfg.Destinations = []webhook.Destination{{Name: "test", URL: hooks.URL, Enabled: true}}
+	wh := webhook.NewDispatcher(cfg)
+
+	var audit syncBuffer
+	sw := New(DefaultConfig(), accesslog.NewWithWriter(&audit, accesslog.FieldsCommon), wh)
+	defer sw.Close()
+	if sw.Active() {
+		t.Fatal("new switch is active")
+	}
+
+	st, err := sw.Activate(50*time.Millisecond, "rule tweak blocks traffic", "key-1", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Active || st.Reason != "rule tweak blocks traffic" || st.KeyID != "key-1" || st.Activations != 1 {
+		t.Errorf("status = %+v", st)
+	}
+	sw.Bypass(SourcePromptGuard, webhook.EventPromptInjection, "s1", map[string]any{"score": 9})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sw.Active() || !strings.Contains(audit.String(), `"outcome":"expired"`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("break-glass did not expire; audit log:\n%s", audit.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(audit.String(), `"outcome":"activated"`) {
+		t.Errorf("activation not audit-logged:\n%s", audit.String())
+	}
+	if st := sw.Status(); st.Active || st.Reason != "" || st.Bypassed[SourcePromptGuard] != 1 {
+		t.Errorf("status after expiry = %+v", st)
+	}
+
+	wh.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	types := make(map[webhook.EventType]webhook.Event)
+	for _, e := range events {
+		types[e.Type] = e
+	}
+	for _, want := range []webhook.EventType{webhook.EventBreakGlassActivated, webhook.EventPromptInjection, webhook.EventBreakGlassExpired} {
+		if _, ok := types[want]; !ok {
+			t.Errorf("no %s event in %+v", want, events)
+		}
+	}
+	if data, _ := types[webhook.EventPromptInjection].Data.(map[string]any); data["break_glass"] != true {
+		t.Errorf("bypassed block not tagged break_glass: %+v", data)
+	}
+}
+
+func TestActivate_Invalid(t *testing.T) {
+	sw := New(Config{MaxDuration: time.Hour}, accesslog.NewWithWriter(&bytes.Buffer{}, accesslog.FieldsCommon), nil)
+	defer sw.Close()
+	if _, err := sw.Activate(2*time.Hour, "incident", "", ""); err == nil {
+		t.Error("activation beyond the maximum accepted")
+	}
+	if _, err := sw.Activate(time.Minute, "", "", ""); err == nil {
+		t.Error("activation without a reason accepted")
+	}
+	if sw.Active() {
+		t.Error("switch active after rejected activations")
+	}
+	var nilSwitch *Switch
+	if nilSwitch.Active() {
+		t.Error("nil switch is active")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	sw := New(DefaultConfig(), accesslog.NewWithWriter(&bytes.Buffer{}, accesslog.FieldsCommon), nil)
+	defer sw.Close()
+	h := sw.Handler()
+	post := func(body string, confirm bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/breakglass", strings.NewReader(body))
+		if confirm {
+			req.Header.Set(ConfirmHeader, ConfirmValue)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(`{"duration_minutes":30,"reason":"incident"}`, false); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("unconfirmed: status = %d", w.Code)
+	}
+	if sw.Active() {
+		t.Fatal("activated without confirmation")
+	}
+	if w := post(`{"duration_minutes":0,"reason":"incident"}`, true); w.Code != http.StatusBadRequest {
+		t.Errorf("zero duration: status = %d", w.Code)
+	}
+
+	w := post(`{"duration_minutes":30,"reason":"incident"}`, true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var st Status
+	json.Unmarshal(w.Body.Bytes(), &st)
+	if !st.Active || st.ExpiresAt.Sub(st.ActivatedAt) != 30*time.Minute {
+		t.Errorf("status = %+v", st)
+	}
+}
@@ -0,0 +1,296 @@
+// Package cache implements an opt-in response cache for LLM calls.
+//
+// The cache sits at the transport layer, after PII anonymization and before
+// rehydration, so entries are keyed and stored in anonymized form only and a
+// hit is still rehydrated for the requesting session and role.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// HeaderName is set on every proxied response with hit, miss or bypass
+const HeaderName = "X-Veil-Cache"
+
+// Cache status values reported in HeaderName
+const (
+	StatusHit    = "hit"
+	StatusMiss   = "miss"
+	StatusBypass = "bypass"
+)
+
+// maxCachedBody caps the size of a single cached response
+const maxCachedBody = 10 << 20
+
+// Config controls caching behavior
+type Config struct {
+	TTL        time.Duration
+	MaxEntries int
+	// CacheNonDeterministic also caches requests whose temperature is above
+	// zero or unset (provider default). Off by default because such
+	// requests are expected to produce different answers.
+	CacheNonDeterministic bool
+}
+
+// DefaultConfig returns a 5 minute, 1000 entry cache
+func DefaultConfig() Config {
+	return Config{
+		TTL:        5 * time.Minute,
+		MaxEntries: 1000,
+	}
+}
+
+// Entry is a stored upstream response
+type Entry struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// Store persists entries
+type Store interface {
+	Get(ctx context.Context, key string) (*Entry, bool)
+	Set(ctx context.Context, key string, e *Entry, ttl time.Duration) error
+}
+
+// Stats reports cache effectiveness. Token counts come from the usage block
+// of cached responses: hit tokens were served without an upstream call,
+// miss tokens were billed by the provider.
+type Stats struct {
+	Hits                 int64   `json:"hits"`
+	Misses               int64   `json:"misses"`
+	Bypasses             int64   `json:"bypasses"`
+	HitRate              float64 `json:"hit_rate"`
+	HitPromptTokens      int64   `json:"hit_prompt_tokens"`
+	HitCompletionTokens  int64   `json:"hit_completion_tokens"`
+	MissPromptTokens     int64   `json:"miss_prompt_tokens"`
+	MissCompletionTokens int64   `json:"miss_completion_tokens"`
+}
+
+// Cache is a response cache that wraps an upstream http.RoundTripper
+type Cache struct {
+	store  Store
+	config Config
+
+	hits, misses, bypasses     atomic.Int64
+	hitPrompt, hitCompletion   atomic.Int64
+	missPrompt, missCompletion atomic.Int64
+}
+
+// New creates a Cache backed by store
+func New(store Store, cfg Config) *Cache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultConfig().TTL
+	}
+	return &Cache{store: store, config: cfg}
+}
+
+// Stats returns a snapshot of the counters
+func (c *Cache) Stats() Stats {
+	s := Stats{
+		Hits:                 c.hits.Load(),
+		Misses:               c.misses.Load(),
+		Bypasses:             c.bypasses.Load(),
+		HitPromptTokens:      c.hitPrompt.Load(),
+		HitCompletionTokens:  c.hitCompletion.Load(),
+		MissPromptTokens:     c.missPrompt.Load(),
+		MissCompletionTokens: c.missCompletion.Load(),
+	}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRate = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+// StatsHandler serves the cache stats as JSON
+func (c *Cache) StatsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Stats())
+	}
+}
+
+// Wrap returns a RoundTripper that serves cached responses and stores
+// cacheable ones from next. A nil next uses http.DefaultTransport.
+func (c *Cache) Wrap(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{cache: c, next: next}
+}
+
+type transport struct {
+	cache *Cache
+	next  http.RoundTripper
+}
+
+// requestFields are the body fields that affect cacheability
+type requestFields struct {
+	Model       string   `json:"model"`
+	Stream      bool     `json:"stream"`
+	Temperature *float64 `json:"temperature"`
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := t.cache
+
+	if req.Method != http.MethodPost || req.Body == nil {
+		return t.forward(req, StatusBypass)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var fields requestFields
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return t.forward(req, StatusBypass)
+	}
+
+	// Streaming is never served from or written to the cache
+	if fields.Stream || strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		c.misses.Add(1)
+		return t.forward(req, StatusMiss)
+	}
+
+	deterministic := fields.Temperature != nil && *fields.Temperature == 0
+	if !deterministic && !c.config.CacheNonDeterministic {
+		return t.forward(req, StatusBypass)
+	}
+
+	key := cacheKey(req, fields.Model, body)
+
+	if e, ok := c.store.Get(req.Context(), key); ok {
+		c.hits.Add(1)
+		prompt, completion := parseUsage(e.Body)
+		c.hitPrompt.Add(prompt)
+		c.hitCompletion.Add(completion)
+		slog.Debug("cache hit", "model", fields.Model, "host", req.URL.Host)
+		return e.response(req), nil
+	}
+
+	c.misses.Add(1)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Header.Set(HeaderName, StatusMiss)
+
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return resp, nil
+	}
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if len(respBody) > maxCachedBody {
+		return resp, nil
+	}
+
+	prompt, completion := parseUsage(respBody)
+	c.missPrompt.Add(prompt)
+	c.missCompletion.Add(completion)
+
+	entry := &Entry{
+		StatusCode: resp.StatusCode,
+		Header:     storableHeader(resp.Header),
+		Body:       respBody,
+	}
+	if err := c.store.Set(req.Context(), key, entry, c.config.TTL); err != nil {
+		slog.Warn("cache store failed", "error", err)
+	}
+
+	return resp, nil
+}
+
+func (t *transport) forward(req *http.Request, status string) (*http.Response, error) {
+	if status == StatusBypass {
+		t.cache.bypasses.Add(1)
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Header.Set(HeaderName, status)
+	return resp, nil
+}
+
+// response rebuilds an http.Response from a cache entry
+func (e *Entry) response(req *http.Request) *http.Response {
+	header := e.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(HeaderName, StatusHit)
+	return &http.Response{
+		Status:        http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// cacheKey hashes provider host, path, model and the anonymized body
+func cacheKey(req *http.Request, model string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.URL.Host))
+	h.Write([]byte{0})
+	h.Write([]byte(req.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// storableHeader drops per-connection headers before caching
+func storableHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for _, k := range []string{"Content-Length", "Connection", "Date", "Set-Cookie", "Transfer-Encoding", HeaderName} {
+		out.Del(k)
+	}
+	return out
+}
+
+// parseUsage reads token usage from OpenAI, Anthropic or Gemini responses
+func parseUsage(body []byte) (prompt, completion int64) {
+	var data struct {
+		Usage struct {
+			PromptTokens     int64 `json:"prompt_tokens"`
+			CompletionTokens int64 `json:"completion_tokens"`
+			InputTokens      int64 `json:"input_tokens"`
+			OutputTokens     int64 `json:"output_tokens"`
+		} `json:"usage"`
+		UsageMetadata struct {
+			PromptTokenCount     int64 `json:"promptTokenCount"`
+			CandidatesTokenCount int64 `json:"candidatesTokenCount"`
+		} `json:"usageMetadata"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return 0, 0
+	}
+	prompt = data.Usage.PromptTokens + data.Usage.InputTokens + data.UsageMetadata.PromptTokenCount
+	completion = data.Usage.CompletionTokens + data.Usage.OutputTokens + data.UsageMetadata.CandidatesTokenCount
+	return prompt, completion
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const usageBody = `{"choices":[{"message":{"content":"hi"}}],"usage":{"prompt_tokens":10,"completion_tokens":5}}`
+
+func setupUpstream(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, "fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(usageBody))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, &calls
+}
+
+func doRequest(t *testing.T, client *http.Client, url, body string) *http.Response {
+	t.Helper()
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestTransport_HitMissBypass(t *testing.T) {
+	upstream, calls := setupUpstream(t)
+	c := New(NewMemoryStore(10), DefaultConfig())
+	client := &http.Client{Transport: c.Wrap(nil)}
+
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		wantCache string
+		wantCalls int64
+	}{
+		{"first deterministic call", "/v1/chat", `{"model":"gpt-4o","temperature":0,"messages":[]}`, StatusMiss, 1},
+		{"identical call hits", "/v1/chat", `{"model":"gpt-4o","temperature":0,"messages":[]}`, StatusHit, 1},
+		{"different model misses", "/v1/chat", `{"model":"gpt-4o-mini","temperature":0,"messages":[]}`, StatusMiss, 2},
+		{"temperature above zero bypasses", "/v1/chat", `{"model":"gpt-4o","temperature":0.7,"messages":[]}`, StatusBypass, 3},
+		{"unset temperature bypasses", "/v1/chat", `{"model":"gpt-4o","messages":[]}`, StatusBypass, 4},
+		{"streaming always misses", "/v1/chat", `{"model":"gpt-4o","temperature":0,"stream":true}`, StatusMiss, 5},
+		{"streaming repeated still misses", "/v1/chat", `{"model":"gpt-4o","temperature":0,"stream":true}`, StatusMiss, 6},
+		{"error response not stored", "/v1/fail", `{"model":"gpt-4o","temperature":0}`, StatusMiss, 7},
+		{"error response repeated misses", "/v1/fail", `{"model":"gpt-4o","temperature":0}`, StatusMiss, 8},
+		{"non-JSON body bypasses", "/v1/chat", `not json`, StatusBypass, 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, client, upstream.URL+tt.path, tt.body)
+			if got := resp.Header.Get(HeaderName); got != tt.wantCache {
+				t.Errorf("%s = %q, want %q", HeaderName, got, tt.wantCache)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Bypasses != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.HitPromptTokens != 10 || stats.HitCompletionTokens != 5 {
+		t.Errorf("expected cached hit tokens 10/5, got %d/%d", stats.HitPromptTokens, stats.HitCompletionTokens)
+	}
+	if stats.MissPromptTokens != 20 {
+		t.Errorf("expected 20 billed prompt tokens from two stored misses, got %d", stats.MissPromptTokens)
+	}
+}
+
+func TestTransport_NonDeterministicOptIn(t *testing.T) {
+	upstream, calls := setupUpstream(t)
+	cfg := DefaultConfig()
+	cfg.CacheNonDeterministic = true
+	c := New(NewMemoryStore(10), cfg)
+	client := &http.Client{Transport: c.Wrap(nil)}
+
+	body := `{"model":"gpt-4o","temperature":0.9}`
+	doRequest(t, client, upstream.URL+"/v1/chat", body)
+	resp := doRequest(t, client, upstream.URL+"/v1/chat", body)
+
+	if resp.Header.Get(HeaderName) != StatusHit || calls.Load() != 1 {
+		t.Errorf("expected hit with one upstream call, got %q and %d calls", resp.Header.Get(HeaderName), calls.Load())
+	}
+}
+
+func TestMemoryStore_LRUAndTTL(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStore(2)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	m.Set(ctx, "a", &Entry{Body: []byte("a")}, time.Minute)
+	m.Set(ctx, "b", &Entry{Body: []byte("b")}, time.Minute)
+	m.Get(ctx, "a") // a is now most recently used
+	m.Set(ctx, "c", &Entry{Body: []byte("c")}, time.Minute)
+
+	if _, ok := m.Get(ctx, "b"); ok {
+		t.Error("expected least recently used entry b to be evicted")
+	}
+	if _, ok := m.Get(ctx, "a"); !ok {
+		t.Error("expected a to survive eviction")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := m.Get(ctx, "c"); ok {
+		t.Error("expected c to expire")
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	s := NewRedisStore(client, 2)
+
+	for _, k := range []string{"a", "b", "c"} {
+		if err := s.Set(ctx, k, &Entry{StatusCode: 200, Body: []byte(k)}, time.Minute); err != nil {
+			t.Fatalf("set %s: %v", k, err)
+		}
+		time.Sleep(time.Millisecond) // distinct index scores
+	}
+
+	if _, ok := s.Get(ctx, "a"); ok {
+		t.Error("expected oldest entry to be trimmed beyond max entries")
+	}
+	e, ok := s.Get(ctx, "c")
+	if !ok || string(e.Body) != "c" || e.StatusCode != 200 {
+		t.Fatalf("expected entry c, got %+v", e)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if _, ok := s.Get(ctx, "c"); ok {
+		t.Error("expected entry to expire with TTL")
+	}
+}
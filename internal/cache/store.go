@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MemoryStore is an in-process LRU store with per-entry expiry
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+	now        func() time.Time
+}
+
+type memoryItem struct {
+	key     string
+	entry   *Entry
+	expires time.Time
+}
+
+// NewMemoryStore creates an LRU store holding at most maxEntries (0 = unbounded)
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Get returns a live entry and marks it recently used
+func (m *MemoryStore) Get(_ context.Context, key string) (*Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := el.Value.(*memoryItem)
+	if m.now().After(item.expires) {
+		m.ll.Remove(el)
+		delete(m.items, key)
+		return nil, false
+	}
+	m.ll.MoveToFront(el)
+	return item.entry, true
+}
+
+// Set stores an entry, evicting the least recently used beyond maxEntries
+func (m *MemoryStore) Set(_ context.Context, key string, e *Entry, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expires := m.now().Add(ttl)
+	if el, ok := m.items[key]; ok {
+		el.Value = &memoryItem{key: key, entry: e, expires: expires}
+		m.ll.MoveToFront(el)
+		return nil
+	}
+
+	m.items[key] = m.ll.PushFront(&memoryItem{key: key, entry: e, expires: expires})
+	for m.maxEntries > 0 && m.ll.Len() > m.maxEntries {
+		oldest := m.ll.Back()
+		m.ll.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryItem).key)
+	}
+	return nil
+}
+
+// Len returns the number of stored entries, including expired ones not yet evicted
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ll.Len()
+}
+
+// RedisStore keeps entries in Redis so replicas share one cache.
+// Entries expire by TTL; an index sorted set trims the oldest beyond maxEntries.
+type RedisStore struct {
+	client     redis.UniversalClient
+	maxEntries int
+}
+
+const (
+	redisKeyPrefix = "cache:resp:"
+	redisIndexKey  = "cache:resp:index"
+)
+
+// NewRedisStore creates a Redis-backed store holding at most maxEntries (0 = unbounded)
+func NewRedisStore(client redis.UniversalClient, maxEntries int) *RedisStore {
+	return &RedisStore{client: client, maxEntries: maxEntries}
+}
+
+// Get loads an entry from Redis
+func (s *RedisStore) Get(ctx context.Context, key string) (*Entry, bool) {
+	data, err := s.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, false
+	}
+	return &e, true
+}
+
+// Set writes an entry with TTL and trims the oldest entries beyond maxEntries
+func (s *RedisStore) Set(ctx context.Context, key string, e *Entry, ttl time.Duration) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode cache entry: %w", err)
+	}
+
+	pipe := s.client.Pipeline()
+	pipe.Set(ctx, redisKeyPrefix+key, data, ttl)
+	pipe.ZAdd(ctx, redisIndexKey, redis.Z{Score: float64(time.Now().UnixNano()), Member: key})
+	card := pipe.ZCard(ctx, redisIndexKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if s.maxEntries <= 0 || card.Val() <= int64(s.maxEntries) {
+		return nil
+	}
+
+	excess := card.Val() - int64(s.maxEntries)
+	oldest, err := s.client.ZRange(ctx, redisIndexKey, 0, excess-1).Result()
+	if err != nil || len(oldest) == 0 {
+		return err
+	}
+	// Delete keys individually so the pipeline also works across cluster slots
+	pipe = s.client.Pipeline()
+	members := make([]any, len(oldest))
+	for i, k := range oldest {
+		pipe.Del(ctx, redisKeyPrefix+k)
+		members[i] = k
+	}
+	pipe.ZRem(ctx, redisIndexKey, members...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
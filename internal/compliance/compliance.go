@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/vurakit/agentveil/internal/i18n"
 )
 
 // Framework identifies a regulatory framework
@@ -16,7 +18,9 @@ const (
 	FrameworkGDPR      Framework = "gdpr"
 )
 
-// Requirement represents a single regulatory requirement
+// Requirement represents a single regulatory requirement. Article, Title
+// and Description are in the language of the report; ID keys them in the
+// i18n catalog.
 type Requirement struct {
 	ID          string    `json:"id"`
 	Framework   Framework `json:"framework"`
@@ -53,6 +57,7 @@ type ComplianceReport struct {
 	OverallScore   float64        `json:"overall_score"` // 0-100
 	Summary        string         `json:"summary"`
 	Recommendations []string      `json:"recommendations,omitempty"`
+	Lang           i18n.Lang      `json:"lang"` // of every text of the report
 }
 
 // SystemCapabilities describes what the system currently supports
@@ -74,11 +79,23 @@ type SystemCapabilities struct {
 	DataPortability    bool `json:"data_portability"`     // GDPR Art.20
 	HumanOversight     bool `json:"human_oversight"`      // EU AI Act
 	TransparencyReport bool `json:"transparency_report"`  // EU AI Act
+	// PlaintextVaultOverride: vault encryption explicitly waived for a
+	// remote Redis (VEIL_ALLOW_PLAINTEXT_VAULT)
+	PlaintextVaultOverride bool `json:"plaintext_vault_override,omitempty"`
+	// DataLocalizationPolicy describes the router's data_localization
+	// policy when DataLocalization is enforced
+	DataLocalizationPolicy string `json:"data_localization_policy,omitempty"`
 }
 
 // Checker validates system compliance against regulatory frameworks
 type Checker struct {
 	requirements []Requirement
+	lang         i18n.Lang
+}
+
+// SetLang sets the language of reports, i18n.Default by default
+func (c *Checker) SetLang(l i18n.Lang) {
+	c.lang = l
 }
 
 // NewChecker creates a compliance checker with all known requirements
@@ -116,7 +133,7 @@ func (c *Checker) Check(caps SystemCapabilities) ComplianceReport {
 	fwSeen := make(map[Framework]bool)
 
 	for _, req := range c.requirements {
-		result := evaluateRequirement(req, caps)
+		result := evaluateRequirement(req.in(c.lang), caps, c.lang)
 		results = append(results, result)
 		if !fwSeen[req.Framework] {
 			fwSeen[req.Framework] = true
@@ -132,21 +149,22 @@ func (c *Checker) Check(caps SystemCapabilities) ComplianceReport {
 		Frameworks:      frameworks,
 		Results:         results,
 		OverallScore:    score,
-		Summary:         buildComplianceSummary(results, score),
+		Summary:         buildComplianceSummary(results, score, c.lang),
 		Recommendations: recommendations,
+		Lang:            c.lang.Code(),
 	}
 }
 
-func evaluateRequirement(req Requirement, caps SystemCapabilities) CheckResult {
+func evaluateRequirement(req Requirement, caps SystemCapabilities, lang i18n.Lang) CheckResult {
 	result := CheckResult{
 		Requirement: req,
+		Details:     i18n.T(lang, "compliance."+req.ID+".details"),
 	}
 
 	switch req.ID {
 	// Vietnam AI Law
 	case "VN-AI-01":
 		result.Status = boolStatus(caps.PIIDetection && caps.PIIAnonymization)
-		result.Details = "Phát hiện & ẩn danh hóa dữ liệu cá nhân"
 		if caps.PIIDetection {
 			result.Evidence = append(result.Evidence, "PII detection enabled")
 		}
@@ -155,34 +173,34 @@ func evaluateRequirement(req Requirement, caps SystemCapabilities) CheckResult {
 		}
 	case "VN-AI-02":
 		result.Status = boolStatus(caps.ConsentManagement)
-		result.Details = "Cơ chế đồng ý người dùng"
 	case "VN-AI-03":
 		result.Status = boolStatus(caps.AuditLogging)
-		result.Details = "Nhật ký kiểm toán có cấu trúc"
 		if caps.AuditLogging {
 			result.Evidence = append(result.Evidence, "Structured audit logging enabled")
 		}
 	case "VN-AI-04":
 		result.Status = boolStatus(caps.DataLocalization)
-		result.Details = "Dữ liệu lưu trữ trong lãnh thổ Việt Nam"
+		if caps.DataLocalization && caps.DataLocalizationPolicy != "" {
+			result.Evidence = append(result.Evidence, "Data localization enforced: "+caps.DataLocalizationPolicy)
+		}
 	case "VN-AI-05":
 		result.Status = boolStatus(caps.SkillAuditing)
-		result.Details = "Kiểm toán skill.md cho AI agents"
 		if caps.SkillAuditing {
 			result.Evidence = append(result.Evidence, "Skill auditing V2 enabled")
 		}
 	case "VN-AI-06":
 		result.Status = boolStatus(caps.EncryptionAtRest && caps.TLSEncryption)
-		result.Details = "Mã hóa dữ liệu tại chỗ và truyền tải"
 		if caps.EncryptionAtRest {
 			result.Evidence = append(result.Evidence, "AES-256-GCM encryption at rest")
 		}
+		if caps.PlaintextVaultOverride {
+			result.Evidence = append(result.Evidence, plaintextVaultEvidence)
+		}
 		if caps.TLSEncryption {
 			result.Evidence = append(result.Evidence, "TLS encryption in transit")
 		}
 	case "VN-AI-07":
 		result.Status = boolStatus(caps.AccessControl)
-		result.Details = "Kiểm soát truy cập theo vai trò"
 		if caps.AccessControl {
 			result.Evidence = append(result.Evidence, "Role-based access control enabled")
 		}
@@ -190,19 +208,14 @@ func evaluateRequirement(req Requirement, caps SystemCapabilities) CheckResult {
 	// EU AI Act
 	case "EU-AI-01":
 		result.Status = boolStatus(caps.SkillAuditing)
-		result.Details = "Risk assessment for AI systems"
 	case "EU-AI-02":
 		result.Status = boolStatus(caps.HumanOversight)
-		result.Details = "Human oversight capabilities"
 	case "EU-AI-03":
 		result.Status = boolStatus(caps.TransparencyReport)
-		result.Details = "Transparency and documentation"
 	case "EU-AI-04":
 		result.Status = boolStatus(caps.AuditLogging)
-		result.Details = "Record-keeping of AI operations"
 	case "EU-AI-05":
 		result.Status = boolStatus(caps.PromptGuard && caps.OutputGuardrails)
-		result.Details = "Accuracy, robustness and cybersecurity"
 		if caps.PromptGuard {
 			result.Evidence = append(result.Evidence, "Prompt injection protection")
 		}
@@ -213,31 +226,32 @@ func evaluateRequirement(req Requirement, caps SystemCapabilities) CheckResult {
 	// GDPR
 	case "GDPR-01":
 		result.Status = boolStatus(caps.PIIDetection && caps.PIIAnonymization)
-		result.Details = "Data minimization (Art. 5(1)(c))"
 	case "GDPR-02":
 		result.Status = boolStatus(caps.ConsentManagement)
-		result.Details = "Lawful basis for processing (Art. 6)"
 	case "GDPR-03":
 		result.Status = boolStatus(caps.RightToErasure)
-		result.Details = "Right to erasure (Art. 17)"
 	case "GDPR-04":
 		result.Status = boolStatus(caps.DataPortability)
-		result.Details = "Data portability (Art. 20)"
 	case "GDPR-05":
 		result.Status = boolStatus(caps.EncryptionAtRest && caps.TLSEncryption)
-		result.Details = "Security of processing (Art. 32)"
+		if caps.PlaintextVaultOverride {
+			result.Evidence = append(result.Evidence, plaintextVaultEvidence)
+		}
 	case "GDPR-06":
 		result.Status = boolStatus(caps.AuditLogging)
-		result.Details = "Records of processing activities (Art. 30)"
 
 	default:
 		result.Status = StatusNotApplicable
-		result.Details = "Unknown requirement"
+		result.Details = i18n.T(lang, "compliance.unknown_requirement")
 	}
 
 	return result
 }
 
+// plaintextVaultEvidence explains a missing encryption at rest that was
+// waived on purpose rather than forgotten
+const plaintextVaultEvidence = "Vault encryption at rest explicitly overridden (VEIL_ALLOW_PLAINTEXT_VAULT)"
+
 func boolStatus(met bool) ComplianceStatus {
 	if met {
 		return StatusCompliant
@@ -283,7 +297,7 @@ func requirementWeight(severity string) float64 {
 	}
 }
 
-func buildComplianceSummary(results []CheckResult, score float64) string {
+func buildComplianceSummary(results []CheckResult, score float64, lang i18n.Lang) string {
 	compliant, nonCompliant, partial := 0, 0, 0
 	for _, r := range results {
 		switch r.Status {
@@ -296,10 +310,7 @@ func buildComplianceSummary(results []CheckResult, score float64) string {
 		}
 	}
 
-	return fmt.Sprintf(
-		"Đánh giá tuân thủ: %.0f/100. Đạt: %d, Không đạt: %d, Một phần: %d trên tổng %d yêu cầu.",
-		score, compliant, nonCompliant, partial, len(results),
-	)
+	return i18n.T(lang, "compliance.summary", score, compliant, nonCompliant, partial, len(results))
 }
 
 func generateRecommendations(results []CheckResult) []string {
@@ -320,18 +331,19 @@ func (r ComplianceReport) ReportJSON() ([]byte, error) {
 
 // ReportHTML returns a formatted HTML compliance report
 func (r ComplianceReport) ReportHTML() string {
+	t := func(id string) string { return i18n.T(r.Lang, "compliance.html."+id) }
 	var sb strings.Builder
-	sb.WriteString("<!DOCTYPE html><html><head><meta charset='utf-8'><title>Agent Veil Compliance Report</title>")
+	sb.WriteString(fmt.Sprintf("<!DOCTYPE html><html lang='%s'><head><meta charset='utf-8'><title>%s</title>", r.Lang.Code(), t("title")))
 	sb.WriteString("<style>body{font-family:sans-serif;max-width:900px;margin:0 auto;padding:20px}")
 	sb.WriteString(".compliant{color:#16a34a}.non_compliant{color:#dc2626}.partial{color:#ca8a04}")
 	sb.WriteString("table{border-collapse:collapse;width:100%}td,th{border:1px solid #ddd;padding:8px;text-align:left}")
 	sb.WriteString(".score{font-size:2em;font-weight:bold}")
 	sb.WriteString("</style></head><body>")
 
-	sb.WriteString("<h1>Agent Veil Compliance Report</h1>")
+	sb.WriteString(fmt.Sprintf("<h1>%s</h1>", t("title")))
 	sb.WriteString(fmt.Sprintf("<p class='score'>%.0f/100</p>", r.OverallScore))
 	sb.WriteString(fmt.Sprintf("<p>%s</p>", r.Summary))
-	sb.WriteString(fmt.Sprintf("<p><em>Generated: %s</em></p>", r.GeneratedAt.Format("2006-01-02 15:04:05")))
+	sb.WriteString(fmt.Sprintf("<p><em>%s: %s</em></p>", t("generated"), r.GeneratedAt.Format("2006-01-02 15:04:05")))
 
 	// Group by framework
 	grouped := make(map[Framework][]CheckResult)
@@ -342,11 +354,12 @@ func (r ComplianceReport) ReportHTML() string {
 
 	for _, fw := range r.Frameworks {
 		results := grouped[fw]
-		sb.WriteString(fmt.Sprintf("<h2>%s</h2>", frameworkName(fw)))
-		sb.WriteString("<table><tr><th>ID</th><th>Article</th><th>Requirement</th><th>Status</th><th>Details</th></tr>")
+		sb.WriteString(fmt.Sprintf("<h2>%s</h2>", frameworkName(fw, r.Lang)))
+		sb.WriteString(fmt.Sprintf("<table><tr><th>%s</th><th>%s</th><th>%s</th><th>%s</th><th>%s</th></tr>",
+			t("id"), t("article"), t("requirement"), t("status"), t("details")))
 		for _, cr := range results {
 			statusClass := string(cr.Status)
-			statusLabel := statusDisplayName(cr.Status)
+			statusLabel := statusDisplayName(cr.Status, r.Lang)
 			sb.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td><td class='%s'>%s</td><td>%s</td></tr>",
 				cr.Requirement.ID, cr.Requirement.Article, cr.Requirement.Title,
 				statusClass, statusLabel, cr.Details))
@@ -355,7 +368,7 @@ func (r ComplianceReport) ReportHTML() string {
 	}
 
 	if len(r.Recommendations) > 0 {
-		sb.WriteString("<h2>Khuyến nghị</h2><ul>")
+		sb.WriteString(fmt.Sprintf("<h2>%s</h2><ul>", t("recommendations")))
 		for _, rec := range r.Recommendations {
 			sb.WriteString(fmt.Sprintf("<li>%s</li>", rec))
 		}
@@ -366,100 +379,80 @@ func (r ComplianceReport) ReportHTML() string {
 	return sb.String()
 }
 
-func frameworkName(fw Framework) string {
-	switch fw {
-	case FrameworkVietnamAI:
-		return "Luật AI Việt Nam 2026"
-	case FrameworkEUAI:
-		return "EU AI Act"
-	case FrameworkGDPR:
-		return "GDPR"
-	default:
+func frameworkName(fw Framework, lang i18n.Lang) string {
+	id := "compliance.framework." + string(fw)
+	if !i18n.Has(i18n.Default, id) {
 		return string(fw)
 	}
+	return i18n.T(lang, id)
 }
 
-func statusDisplayName(s ComplianceStatus) string {
-	switch s {
-	case StatusCompliant:
-		return "Đạt"
-	case StatusNonCompliant:
-		return "Không đạt"
-	case StatusPartial:
-		return "Một phần"
-	case StatusNotApplicable:
-		return "N/A"
-	default:
+func statusDisplayName(s ComplianceStatus, lang i18n.Lang) string {
+	id := "compliance.status." + string(s)
+	if !i18n.Has(i18n.Default, id) {
 		return string(s)
 	}
+	return i18n.T(lang, id)
+}
+
+// in returns req with its texts in lang
+func (req Requirement) in(lang i18n.Lang) Requirement {
+	prefix := "compliance." + req.ID + "."
+	if !i18n.Has(i18n.Default, prefix+"title") {
+		return req
+	}
+	req.Article = i18n.T(lang, prefix+"article")
+	req.Title = i18n.T(lang, prefix+"title")
+	req.Description = i18n.T(lang, prefix+"description")
+	return req
 }
 
 // === Regulatory Requirements Definitions ===
+// Article, Title and Description come from the i18n catalog, see in
 
 func vietnamAIRequirements() []Requirement {
 	return []Requirement{
 		{
-			ID:          "VN-AI-01",
-			Framework:   FrameworkVietnamAI,
-			Article:     "Điều 12",
-			Title:       "Bảo vệ dữ liệu cá nhân",
-			Description: "Hệ thống AI phải phát hiện và ẩn danh hóa dữ liệu cá nhân trước khi xử lý",
-			Category:    "data_protection",
-			Severity:    "mandatory",
+			ID:        "VN-AI-01",
+			Framework: FrameworkVietnamAI,
+			Category:  "data_protection",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "VN-AI-02",
-			Framework:   FrameworkVietnamAI,
-			Article:     "Điều 15",
-			Title:       "Đồng ý của chủ thể dữ liệu",
-			Description: "Thu thập và xử lý dữ liệu cá nhân phải có sự đồng ý của chủ thể",
-			Category:    "consent",
-			Severity:    "mandatory",
+			ID:        "VN-AI-02",
+			Framework: FrameworkVietnamAI,
+			Category:  "consent",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "VN-AI-03",
-			Framework:   FrameworkVietnamAI,
-			Article:     "Điều 20",
-			Title:       "Nhật ký hoạt động AI",
-			Description: "Ghi nhận đầy đủ nhật ký hoạt động của hệ thống AI để kiểm toán",
-			Category:    "audit",
-			Severity:    "mandatory",
+			ID:        "VN-AI-03",
+			Framework: FrameworkVietnamAI,
+			Category:  "audit",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "VN-AI-04",
-			Framework:   FrameworkVietnamAI,
-			Article:     "Điều 26",
-			Title:       "Lưu trữ dữ liệu trong nước",
-			Description: "Dữ liệu cá nhân công dân Việt Nam phải được lưu trữ trong lãnh thổ Việt Nam",
-			Category:    "data_localization",
-			Severity:    "mandatory",
+			ID:        "VN-AI-04",
+			Framework: FrameworkVietnamAI,
+			Category:  "data_localization",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "VN-AI-05",
-			Framework:   FrameworkVietnamAI,
-			Article:     "Điều 30",
-			Title:       "Đánh giá rủi ro AI",
-			Description: "Hệ thống AI phải được đánh giá và phân loại mức độ rủi ro",
-			Category:    "risk_assessment",
-			Severity:    "mandatory",
+			ID:        "VN-AI-05",
+			Framework: FrameworkVietnamAI,
+			Category:  "risk_assessment",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "VN-AI-06",
-			Framework:   FrameworkVietnamAI,
-			Article:     "Điều 35",
-			Title:       "An ninh dữ liệu",
-			Description: "Mã hóa dữ liệu tại chỗ và trong quá trình truyền tải",
-			Category:    "security",
-			Severity:    "mandatory",
+			ID:        "VN-AI-06",
+			Framework: FrameworkVietnamAI,
+			Category:  "security",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "VN-AI-07",
-			Framework:   FrameworkVietnamAI,
-			Article:     "Điều 38",
-			Title:       "Kiểm soát truy cập",
-			Description: "Phân quyền truy cập dựa trên vai trò và nguyên tắc tối thiểu quyền",
-			Category:    "access_control",
-			Severity:    "mandatory",
+			ID:        "VN-AI-07",
+			Framework: FrameworkVietnamAI,
+			Category:  "access_control",
+			Severity:  "mandatory",
 		},
 	}
 }
@@ -467,49 +460,34 @@ func vietnamAIRequirements() []Requirement {
 func euAIRequirements() []Requirement {
 	return []Requirement{
 		{
-			ID:          "EU-AI-01",
-			Framework:   FrameworkEUAI,
-			Article:     "Art. 9",
-			Title:       "Risk Management System",
-			Description: "Establish and maintain a risk management system for high-risk AI",
-			Category:    "risk_management",
-			Severity:    "mandatory",
+			ID:        "EU-AI-01",
+			Framework: FrameworkEUAI,
+			Category:  "risk_management",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "EU-AI-02",
-			Framework:   FrameworkEUAI,
-			Article:     "Art. 14",
-			Title:       "Human Oversight",
-			Description: "Ensure appropriate human oversight measures for AI systems",
-			Category:    "oversight",
-			Severity:    "mandatory",
+			ID:        "EU-AI-02",
+			Framework: FrameworkEUAI,
+			Category:  "oversight",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "EU-AI-03",
-			Framework:   FrameworkEUAI,
-			Article:     "Art. 13",
-			Title:       "Transparency",
-			Description: "AI systems must be designed to enable transparency and explainability",
-			Category:    "transparency",
-			Severity:    "mandatory",
+			ID:        "EU-AI-03",
+			Framework: FrameworkEUAI,
+			Category:  "transparency",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "EU-AI-04",
-			Framework:   FrameworkEUAI,
-			Article:     "Art. 12",
-			Title:       "Record-keeping",
-			Description: "Maintain logs of AI system operations for traceability",
-			Category:    "audit",
-			Severity:    "mandatory",
+			ID:        "EU-AI-04",
+			Framework: FrameworkEUAI,
+			Category:  "audit",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "EU-AI-05",
-			Framework:   FrameworkEUAI,
-			Article:     "Art. 15",
-			Title:       "Accuracy and Robustness",
-			Description: "Ensure AI systems achieve appropriate levels of accuracy, robustness and cybersecurity",
-			Category:    "security",
-			Severity:    "mandatory",
+			ID:        "EU-AI-05",
+			Framework: FrameworkEUAI,
+			Category:  "security",
+			Severity:  "mandatory",
 		},
 	}
 }
@@ -517,58 +495,40 @@ func euAIRequirements() []Requirement {
 func gdprRequirements() []Requirement {
 	return []Requirement{
 		{
-			ID:          "GDPR-01",
-			Framework:   FrameworkGDPR,
-			Article:     "Art. 5(1)(c)",
-			Title:       "Data Minimization",
-			Description: "Process only data that is necessary for the purpose",
-			Category:    "data_protection",
-			Severity:    "mandatory",
+			ID:        "GDPR-01",
+			Framework: FrameworkGDPR,
+			Category:  "data_protection",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "GDPR-02",
-			Framework:   FrameworkGDPR,
-			Article:     "Art. 6",
-			Title:       "Lawful Basis for Processing",
-			Description: "Ensure lawful basis for data processing, including consent",
-			Category:    "consent",
-			Severity:    "mandatory",
+			ID:        "GDPR-02",
+			Framework: FrameworkGDPR,
+			Category:  "consent",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "GDPR-03",
-			Framework:   FrameworkGDPR,
-			Article:     "Art. 17",
-			Title:       "Right to Erasure",
-			Description: "Data subjects have the right to have their data erased",
-			Category:    "data_rights",
-			Severity:    "mandatory",
+			ID:        "GDPR-03",
+			Framework: FrameworkGDPR,
+			Category:  "data_rights",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "GDPR-04",
-			Framework:   FrameworkGDPR,
-			Article:     "Art. 20",
-			Title:       "Data Portability",
-			Description: "Data subjects have the right to receive their data in portable format",
-			Category:    "data_rights",
-			Severity:    "recommended",
+			ID:        "GDPR-04",
+			Framework: FrameworkGDPR,
+			Category:  "data_rights",
+			Severity:  "recommended",
 		},
 		{
-			ID:          "GDPR-05",
-			Framework:   FrameworkGDPR,
-			Article:     "Art. 32",
-			Title:       "Security of Processing",
-			Description: "Implement appropriate technical and organizational security measures",
-			Category:    "security",
-			Severity:    "mandatory",
+			ID:        "GDPR-05",
+			Framework: FrameworkGDPR,
+			Category:  "security",
+			Severity:  "mandatory",
 		},
 		{
-			ID:          "GDPR-06",
-			Framework:   FrameworkGDPR,
-			Article:     "Art. 30",
-			Title:       "Records of Processing",
-			Description: "Maintain records of processing activities",
-			Category:    "audit",
-			Severity:    "mandatory",
+			ID:        "GDPR-06",
+			Framework: FrameworkGDPR,
+			Category:  "audit",
+			Severity:  "mandatory",
 		},
 	}
 }
@@ -1,8 +1,14 @@
 package compliance
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/vurakit/agentveil/internal/i18n"
 )
 
 func TestCheck_FullCompliance(t *testing.T) {
@@ -191,6 +197,39 @@ func TestCheck_Evidence(t *testing.T) {
 	}
 }
 
+func TestCheck_PlaintextVaultOverride(t *testing.T) {
+	report := NewChecker().Check(SystemCapabilities{TLSEncryption: true, PlaintextVaultOverride: true})
+
+	var flagged []string
+	for _, r := range report.Results {
+		for _, e := range r.Evidence {
+			if e == plaintextVaultEvidence {
+				if r.Status != StatusNonCompliant {
+					t.Errorf("%s: status %s with encryption overridden", r.Requirement.ID, r.Status)
+				}
+				flagged = append(flagged, r.Requirement.ID)
+			}
+		}
+	}
+	if len(flagged) != 2 {
+		t.Errorf("override evidence on %v, want VN-AI-06 and GDPR-05", flagged)
+	}
+}
+
+func TestCheck_DataLocalization(t *testing.T) {
+	caps := SystemCapabilities{DataLocalization: true, DataLocalizationPolicy: "requests with CCCD are only routed to providers in region vn"}
+	for _, r := range NewCheckerForFrameworks(FrameworkVietnamAI).Check(caps).Results {
+		if r.Requirement.ID != "VN-AI-04" {
+			continue
+		}
+		if r.Status != StatusCompliant || len(r.Evidence) != 1 || !strings.Contains(r.Evidence[0], "region vn") {
+			t.Errorf("VN-AI-04 = %s %v", r.Status, r.Evidence)
+		}
+		return
+	}
+	t.Error("VN-AI-04 not checked")
+}
+
 func TestCheck_Recommendations(t *testing.T) {
 	checker := NewChecker()
 	caps := SystemCapabilities{
@@ -235,23 +274,29 @@ func TestReportJSON(t *testing.T) {
 }
 
 func TestReportHTML(t *testing.T) {
-	checker := NewChecker()
-	caps := SystemCapabilities{PIIDetection: true, AuditLogging: true}
-	report := checker.Check(caps)
-
-	html := report.ReportHTML()
-
-	if !strings.Contains(html, "<html>") {
-		t.Error("expected HTML output")
-	}
-	if !strings.Contains(html, "Agent Veil Compliance Report") {
-		t.Error("expected report title")
-	}
-	if !strings.Contains(html, "Luật AI Việt Nam 2026") {
-		t.Error("expected Vietnam framework name")
+	tests := []struct {
+		lang i18n.Lang
+		want []string
+	}{
+		{i18n.Vietnamese, []string{"<html lang='vi'>", "Báo cáo tuân thủ Agent Veil", "Luật AI Việt Nam 2026", "<th>Trạng thái</th>",
+			"Bảo vệ dữ liệu cá nhân", "Không đạt", "Khuyến nghị", "Đánh giá tuân thủ"}},
+		{i18n.English, []string{"<html lang='en'>", "Agent Veil Compliance Report", "Vietnam AI Law 2026", "<th>Status</th>",
+			"Personal Data Protection", "Non-compliant", "Recommendations", "Compliance assessment"}},
 	}
-	if !strings.Contains(html, "GDPR") {
-		t.Error("expected GDPR framework name")
+	for _, tt := range tests {
+		checker := NewChecker()
+		checker.SetLang(tt.lang)
+		report := checker.Check(SystemCapabilities{PIIDetection: true, AuditLogging: true})
+		if report.Lang != tt.lang {
+			t.Errorf("%s: report lang = %q", tt.lang, report.Lang)
+		}
+
+		html := report.ReportHTML()
+		for _, want := range append(tt.want, "GDPR") {
+			if !strings.Contains(html, want) {
+				t.Errorf("%s: HTML missing %q", tt.lang, want)
+			}
+		}
 	}
 }
 
@@ -266,7 +311,7 @@ func TestFrameworkName(t *testing.T) {
 		{Framework("unknown"), "unknown"},
 	}
 	for _, tt := range tests {
-		got := frameworkName(tt.fw)
+		got := frameworkName(tt.fw, i18n.Vietnamese)
 		if got != tt.expected {
 			t.Errorf("frameworkName(%s) = %s, want %s", tt.fw, got, tt.expected)
 		}
@@ -285,11 +330,14 @@ func TestStatusDisplayName(t *testing.T) {
 		{ComplianceStatus("other"), "other"},
 	}
 	for _, tt := range tests {
-		got := statusDisplayName(tt.status)
+		got := statusDisplayName(tt.status, i18n.Vietnamese)
 		if got != tt.expected {
 			t.Errorf("statusDisplayName(%s) = %s, want %s", tt.status, got, tt.expected)
 		}
 	}
+	if got := statusDisplayName(StatusNonCompliant, i18n.English); got != "Non-compliant" {
+		t.Errorf("English non-compliant = %s", got)
+	}
 }
 
 func TestBoolStatus(t *testing.T) {
@@ -328,3 +376,103 @@ func TestRequirementWeight(t *testing.T) {
 		t.Error("unknown should have weight 1.0")
 	}
 }
+
+func TestCheckFleet(t *testing.T) {
+	full := SystemCapabilities{
+		PIIDetection: true, PIIAnonymization: true, EncryptionAtRest: true,
+		AuditLogging: true, AccessControl: true, SkillAuditing: true, TLSEncryption: true,
+	}
+	noTLS := full
+	noTLS.TLSEncryption = false
+
+	fleet := NewCheckerForFrameworks(FrameworkVietnamAI).CheckFleet([]Instance{
+		{Target: "prod", Caps: &full},
+		{Target: "staging", Caps: &noTLS},
+		{Target: "dev", Err: errors.New("connection refused")},
+	})
+
+	if len(fleet.Instances) != 3 {
+		t.Fatalf("expected 3 instances, got %d", len(fleet.Instances))
+	}
+	if fleet.WorstTarget != "staging" || fleet.WorstScore >= fleet.Instances[0].Report.OverallScore {
+		t.Errorf("expected staging worst, got %s %.1f", fleet.WorstTarget, fleet.WorstScore)
+	}
+	if dev := fleet.Instances[2]; dev.Status != StatusUnknown || dev.Report != nil || dev.Error != "connection refused" {
+		t.Errorf("unreachable instance should be unknown, got %+v", dev)
+	}
+	if len(fleet.Unknown) != 1 || fleet.Unknown[0] != "dev" {
+		t.Errorf("expected dev unknown, got %v", fleet.Unknown)
+	}
+
+	for _, row := range fleet.Matrix {
+		if row.Statuses["dev"] != StatusUnknown {
+			t.Errorf("%s: dev should be unknown, got %s", row.Requirement.ID, row.Statuses["dev"])
+		}
+		if row.Requirement.ID == "VN-AI-06" {
+			if len(row.Failing) != 1 || row.Failing[0] != "staging" {
+				t.Errorf("VN-AI-06 should fail on staging only, got %v", row.Failing)
+			}
+		}
+	}
+
+	// Union: staging's TLS recommendation plus what both miss, once each
+	seen := make(map[string]int)
+	for _, rec := range fleet.Recommendations {
+		seen[rec]++
+		if seen[rec] > 1 {
+			t.Errorf("duplicate recommendation %q", rec)
+		}
+	}
+	hasTLS := false
+	for rec := range seen {
+		if strings.HasPrefix(rec, "[VN-AI-06]") {
+			hasTLS = true
+		}
+	}
+	if !hasTLS {
+		t.Errorf("expected VN-AI-06 recommendation from staging, got %v", fleet.Recommendations)
+	}
+
+	below := fleet.BelowThreshold(fleet.Instances[0].Report.OverallScore)
+	if len(below) != 2 || below[0] != "staging" || below[1] != "dev" {
+		t.Errorf("expected staging and dev below threshold, got %v", below)
+	}
+}
+
+func TestFleetReportHTML(t *testing.T) {
+	caps := SystemCapabilities{PIIDetection: true}
+	fleet := NewCheckerForFrameworks(FrameworkGDPR).CheckFleet([]Instance{
+		{Target: "https://veil-prod:8080", Caps: &caps},
+		{Target: "https://<bad>", Err: errors.New("timeout")},
+	})
+	html := fleet.ReportHTML()
+
+	for _, want := range []string{"<th>https://veil-prod:8080</th>", "GDPR-03", "class='unknown'", "&lt;bad&gt;"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML missing %q", want)
+		}
+	}
+	if strings.Contains(html, "<bad>") {
+		t.Error("target should be escaped")
+	}
+}
+
+func TestFetchCapabilities(t *testing.T) {
+	want := SystemCapabilities{PIIDetection: true, RateLimiting: true}
+	srv := httptest.NewServer(CapabilitiesHandler(want))
+	defer srv.Close()
+
+	got, err := FetchCapabilities(context.Background(), srv.Client(), srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	if _, err := FetchCapabilities(context.Background(), missing.Client(), missing.URL); err == nil {
+		t.Error("expected error for 404")
+	}
+}
@@ -0,0 +1,219 @@
+package compliance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/i18n"
+)
+
+// StatusUnknown marks requirements of an instance that could not be queried
+const StatusUnknown ComplianceStatus = "unknown"
+
+// CapabilitiesPath is where a running proxy reports its SystemCapabilities
+const CapabilitiesPath = "/capabilities"
+
+// CapabilitiesHandler serves caps as JSON so fleet checks can evaluate the
+// deployed configuration instead of the local environment
+func CapabilitiesHandler(caps SystemCapabilities) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(caps)
+	})
+}
+
+// FetchCapabilities queries the capabilities endpoint of the proxy at baseURL
+func FetchCapabilities(ctx context.Context, client *http.Client, baseURL string) (SystemCapabilities, error) {
+	var caps SystemCapabilities
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(baseURL, "/")+CapabilitiesPath, nil)
+	if err != nil {
+		return caps, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return caps, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return caps, fmt.Errorf("capabilities: %s", resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&caps); err != nil {
+		return caps, fmt.Errorf("capabilities: %w", err)
+	}
+	return caps, nil
+}
+
+// Instance is one deployed proxy to evaluate. Caps is nil when the
+// instance could not be queried; Err says why.
+type Instance struct {
+	Target string
+	Caps   *SystemCapabilities
+	Err    error
+}
+
+// InstanceReport is the assessment of one instance. Report is nil and
+// Status is "unknown" for unreachable instances.
+type InstanceReport struct {
+	Target string            `json:"target"`
+	Status ComplianceStatus  `json:"status,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Report *ComplianceReport `json:"report,omitempty"`
+}
+
+// MatrixRow is the status of one requirement on every instance
+type MatrixRow struct {
+	Requirement Requirement                 `json:"requirement"`
+	Statuses    map[string]ComplianceStatus `json:"statuses"` // target → status
+	Failing     []string                    `json:"failing,omitempty"`
+}
+
+// FleetReport summarizes compliance across deployed instances
+type FleetReport struct {
+	GeneratedAt     time.Time        `json:"generated_at"`
+	Instances       []InstanceReport `json:"instances"`
+	WorstScore      float64          `json:"worst_score"`
+	WorstTarget     string           `json:"worst_target,omitempty"`
+	Unknown         []string         `json:"unknown,omitempty"`
+	Matrix          []MatrixRow      `json:"matrix"`
+	Recommendations []string         `json:"recommendations,omitempty"`
+	Lang            i18n.Lang        `json:"lang"`
+}
+
+// CheckFleet evaluates every instance and builds the fleet summary: the
+// worst score, the union of recommendations and a per-requirement matrix.
+// Unreachable instances are reported as unknown, never dropped.
+func (c *Checker) CheckFleet(instances []Instance) FleetReport {
+	fleet := FleetReport{
+		GeneratedAt: time.Now(),
+		WorstScore:  math.NaN(),
+		Lang:        c.lang.Code(),
+	}
+	seenRec := make(map[string]bool)
+
+	rows := make([]MatrixRow, len(c.requirements))
+	for i, req := range c.requirements {
+		rows[i] = MatrixRow{Requirement: req.in(c.lang), Statuses: make(map[string]ComplianceStatus)}
+	}
+
+	for _, inst := range instances {
+		if inst.Caps == nil {
+			ir := InstanceReport{Target: inst.Target, Status: StatusUnknown}
+			if inst.Err != nil {
+				ir.Error = inst.Err.Error()
+			}
+			fleet.Instances = append(fleet.Instances, ir)
+			fleet.Unknown = append(fleet.Unknown, inst.Target)
+			for i := range rows {
+				rows[i].Statuses[inst.Target] = StatusUnknown
+			}
+			continue
+		}
+
+		report := c.Check(*inst.Caps)
+		fleet.Instances = append(fleet.Instances, InstanceReport{Target: inst.Target, Report: &report})
+		if math.IsNaN(fleet.WorstScore) || report.OverallScore < fleet.WorstScore {
+			fleet.WorstScore = report.OverallScore
+			fleet.WorstTarget = inst.Target
+		}
+		for _, rec := range report.Recommendations {
+			if !seenRec[rec] {
+				seenRec[rec] = true
+				fleet.Recommendations = append(fleet.Recommendations, rec)
+			}
+		}
+		for i, r := range report.Results {
+			rows[i].Statuses[inst.Target] = r.Status
+			if r.Status == StatusNonCompliant || r.Status == StatusPartial {
+				rows[i].Failing = append(rows[i].Failing, inst.Target)
+			}
+		}
+	}
+
+	if math.IsNaN(fleet.WorstScore) {
+		fleet.WorstScore = 0
+	}
+	fleet.Matrix = rows
+	return fleet
+}
+
+// BelowThreshold returns the targets scoring under threshold. Unknown
+// instances are included: an unverified instance cannot pass a gate.
+func (f FleetReport) BelowThreshold(threshold float64) []string {
+	var out []string
+	for _, inst := range f.Instances {
+		if inst.Report == nil || inst.Report.OverallScore < threshold {
+			out = append(out, inst.Target)
+		}
+	}
+	return out
+}
+
+// ReportJSON returns the fleet report as formatted JSON
+func (f FleetReport) ReportJSON() ([]byte, error) {
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// ReportHTML renders the fleet summary and the requirement × instance matrix
+func (f FleetReport) ReportHTML() string {
+	t := func(id string) string { return i18n.T(f.Lang, "compliance.html."+id) }
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<!DOCTYPE html><html lang='%s'><head><meta charset='utf-8'><title>%s</title>", f.Lang.Code(), t("fleet_title")))
+	sb.WriteString("<style>body{font-family:sans-serif;max-width:1200px;margin:0 auto;padding:20px}")
+	sb.WriteString(".compliant{color:#16a34a}.non_compliant{color:#dc2626}.partial{color:#ca8a04}.unknown{color:#6b7280}")
+	sb.WriteString("table{border-collapse:collapse;width:100%}td,th{border:1px solid #ddd;padding:8px;text-align:left}")
+	sb.WriteString(".score{font-size:2em;font-weight:bold}")
+	sb.WriteString("</style></head><body>")
+
+	sb.WriteString(fmt.Sprintf("<h1>%s</h1>", t("fleet_title")))
+	if f.WorstTarget != "" {
+		sb.WriteString(fmt.Sprintf("<p class='score'>%.0f/100</p><p>%s: %s</p>",
+			f.WorstScore, t("worst_instance"), html.EscapeString(f.WorstTarget)))
+	}
+	sb.WriteString(fmt.Sprintf("<p><em>%s: %s</em></p>", t("generated"), f.GeneratedAt.Format("2006-01-02 15:04:05")))
+
+	sb.WriteString(fmt.Sprintf("<h2>%s</h2><table><tr><th>%s</th><th>%s</th><th>%s</th></tr>",
+		t("instances"), t("instance"), t("score"), t("details")))
+	for _, inst := range f.Instances {
+		if inst.Report == nil {
+			sb.WriteString(fmt.Sprintf("<tr><td>%s</td><td class='unknown'>%s</td><td>%s</td></tr>",
+				html.EscapeString(inst.Target), statusDisplayName(StatusUnknown, f.Lang), html.EscapeString(inst.Error)))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%.0f/100</td><td>%s</td></tr>",
+			html.EscapeString(inst.Target), inst.Report.OverallScore, inst.Report.Summary))
+	}
+	sb.WriteString("</table>")
+
+	sb.WriteString(fmt.Sprintf("<h2>%s</h2><table><tr><th>%s</th><th>%s</th>", t("requirements"), t("id"), t("requirement")))
+	for _, inst := range f.Instances {
+		sb.WriteString(fmt.Sprintf("<th>%s</th>", html.EscapeString(inst.Target)))
+	}
+	sb.WriteString("</tr>")
+	for _, row := range f.Matrix {
+		sb.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%s</td>", row.Requirement.ID, row.Requirement.Title))
+		for _, inst := range f.Instances {
+			st := row.Statuses[inst.Target]
+			sb.WriteString(fmt.Sprintf("<td class='%s'>%s</td>", st, statusDisplayName(st, f.Lang)))
+		}
+		sb.WriteString("</tr>")
+	}
+	sb.WriteString("</table>")
+
+	if len(f.Recommendations) > 0 {
+		sb.WriteString(fmt.Sprintf("<h2>%s</h2><ul>", t("recommendations")))
+		for _, rec := range f.Recommendations {
+			sb.WriteString(fmt.Sprintf("<li>%s</li>", rec))
+		}
+		sb.WriteString("</ul>")
+	}
+
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
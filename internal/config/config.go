@@ -0,0 +1,387 @@
+// Package config loads veil.yaml, the proxy configuration file named by
+// VEIL_CONFIG. Its sections hold the settings otherwise read from the
+// environment, one key per environment variable:
+//
+//	proxy:
+//	  target_url: https://api.openai.com
+//	ratelimit:
+//	  requests_per_minute: 600
+//	  exempt_paths: [/health, /readyz]
+//
+// An environment variable that is set overrides the file's key for it, so
+// a deployment keeps a shared file and changes single fields per instance.
+// Unknown sections and keys are warnings, so a typo never passes silently;
+// values of the wrong shape are errors. Both name the line.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sections maps every section of veil.yaml to its keys, and every key to
+// the environment variable it sets
+var Sections = map[string]map[string]string{
+	"proxy": {
+		"target_url":               "TARGET_URL",
+		"gemini_target_url":        "GEMINI_TARGET_URL",
+		"listen_addr":              "LISTEN_ADDR",
+		"default_role":             "VEIL_DEFAULT_ROLE",
+		"tls_cert":                 "TLS_CERT",
+		"tls_key":                  "TLS_KEY",
+		"admin_listen_addr":        "ADMIN_LISTEN_ADDR",
+		"admin_tls_cert":           "ADMIN_TLS_CERT",
+		"admin_tls_key":            "ADMIN_TLS_KEY",
+		"admin_tls_client_ca":      "ADMIN_TLS_CLIENT_CA",
+		"admin_pprof":              "VEIL_ADMIN_PPROF",
+		"allow_plaintext_vault":    "VEIL_ALLOW_PLAINTEXT_VAULT",
+		"auth_key_locations":       "VEIL_AUTH_KEY_LOCATIONS",
+		"vault_ttl":                "VEIL_VAULT_TTL",
+		"vault_resolve":            "VEIL_VAULT_RESOLVE",
+		"vault_resolve_rate":       "VEIL_VAULT_RESOLVE_RATE",
+		"session_binding":          "VEIL_SESSION_BINDING",
+		"cache":                    "VEIL_CACHE",
+		"cache_ttl":                "VEIL_CACHE_TTL",
+		"cache_max_entries":        "VEIL_CACHE_MAX_ENTRIES",
+		"cache_nondeterministic":   "VEIL_CACHE_NONDETERMINISTIC",
+		"stats":                    "VEIL_STATS",
+		"stats_retention":          "VEIL_STATS_RETENTION",
+		"stats_noise_epsilon":      "VEIL_STATS_NOISE_EPSILON",
+		"stats_noise_threshold":    "VEIL_STATS_NOISE_THRESHOLD",
+		"feedback":                 "VEIL_FEEDBACK",
+		"feedback_suppress_after":  "VEIL_FEEDBACK_SUPPRESS_AFTER",
+		"sse_heartbeat":            "VEIL_SSE_HEARTBEAT",
+		"upstream_timeout":         "VEIL_UPSTREAM_TIMEOUT",
+		"upstream_header_timeout":  "VEIL_UPSTREAM_HEADER_TIMEOUT",
+		"upstream_max_idle_conns":  "VEIL_UPSTREAM_MAX_IDLE_CONNS",
+		"upstream_retry":           "VEIL_UPSTREAM_RETRY",
+		"upstream_user_agent":      "VEIL_UPSTREAM_USER_AGENT",
+		"header_scan":              "VEIL_HEADER_SCAN",
+		"header_allow":             "VEIL_HEADER_ALLOW",
+		"header_deny":              "VEIL_HEADER_DENY",
+		"request_fields":           "VEIL_REQUEST_FIELDS",
+		"request_field_action":     "VEIL_REQUEST_FIELD_ACTION",
+		"binary_min_length":        "VEIL_BINARY_MIN_LENGTH",
+		"max_file_size_mb":         "VEIL_MAX_FILE_SIZE_MB",
+		"count_tokens":             "VEIL_COUNT_TOKENS",
+		"lang":                     "VEIL_LANG",
+		"failure_mode":             "VEIL_FAILURE_MODE",
+		"overload":                 "VEIL_OVERLOAD",
+		"max_inflight":             "VEIL_MAX_INFLIGHT",
+		"overload_queue":           "VEIL_OVERLOAD_QUEUE",
+		"overload_queue_timeout":   "VEIL_OVERLOAD_QUEUE_TIMEOUT",
+		"overload_memory_mb":       "VEIL_OVERLOAD_MEMORY_MB",
+		"break_glass":              "VEIL_BREAK_GLASS",
+		"break_glass_max_duration": "VEIL_BREAK_GLASS_MAX_DURATION",
+		"startup_probe":            "VEIL_STARTUP_PROBE",
+		"startup_probe_timeout":    "VEIL_STARTUP_PROBE_TIMEOUT",
+		"signing_key_file":         "VEIL_SIGNING_KEY_FILE",
+		"access_log":               "VEIL_ACCESS_LOG",
+		"access_log_fields":        "VEIL_ACCESS_LOG_FIELDS",
+		"access_log_max_size_mb":   "VEIL_ACCESS_LOG_MAX_SIZE_MB",
+		"access_log_max_backups":   "VEIL_ACCESS_LOG_MAX_BACKUPS",
+		"access_log_redis_stream":  "VEIL_ACCESS_LOG_REDIS_STREAM",
+		"access_log_redis_maxlen":  "VEIL_ACCESS_LOG_REDIS_MAXLEN",
+		"metrics":                  "VEIL_METRICS",
+		"metrics_auth":             "VEIL_METRICS_AUTH",
+		"transcripts":              "VEIL_TRANSCRIPTS",
+		"transcripts_max_age":      "VEIL_TRANSCRIPTS_MAX_AGE",
+		"mitm_addr":                "VEIL_MITM_ADDR",
+		"mitm_hosts":               "VEIL_MITM_HOSTS",
+		"mitm_ca_cert":             "VEIL_MITM_CA_CERT",
+		"mitm_ca_key":              "VEIL_MITM_CA_KEY",
+	},
+	"detector": {
+		"addr":                    "DETECTOR_ADDR",
+		"deep_scan_percent":       "VEIL_DEEP_SCAN_PERCENT",
+		"deep_scan_sessions":      "VEIL_DEEP_SCAN_SESSIONS",
+		"deep_scan_keys":          "VEIL_DEEP_SCAN_KEYS",
+		"deep_scan_roles":         "VEIL_DEEP_SCAN_ROLES",
+		"profiles":                "VEIL_DETECTOR_PROFILES",
+		"pseudonyms":              "VEIL_PSEUDONYMS",
+		"secret_action":           "VEIL_SECRET_ACTION",
+		"pii_policy":              "VEIL_PII_POLICY",
+		"pattern_bundle":          "VEIL_PATTERN_BUNDLE",
+		"pattern_bundle_key_file": "VEIL_PATTERN_BUNDLE_KEY_FILE",
+	},
+	"promptguard": {
+		"enabled":        "VEIL_PROMPTGUARD",
+		"sessions":       "VEIL_PROMPTGUARD_SESSIONS",
+		"max_scan_bytes": "VEIL_PROMPTGUARD_MAX_SCAN_BYTES",
+	},
+	"guardrail": {
+		"enabled":               "VEIL_GUARDRAIL",
+		"max_output_tokens":     "VEIL_GUARDRAIL_MAX_OUTPUT_TOKENS",
+		"max_requests_per_min":  "VEIL_GUARDRAIL_MAX_REQUESTS_PER_MIN",
+		"block_harmful_content": "VEIL_GUARDRAIL_BLOCK_HARMFUL",
+		"block_pii_in_output":   "VEIL_GUARDRAIL_BLOCK_PII",
+		"pii_output_action":     "VEIL_GUARDRAIL_PII_ACTION",
+		"allowed_topics":        "VEIL_GUARDRAIL_ALLOWED_TOPICS",
+		"blocked_topics":        "VEIL_GUARDRAIL_BLOCKED_TOPICS",
+	},
+	"ratelimit": {
+		"requests_per_minute":     "VEIL_RATE_LIMIT",
+		"backend":                 "VEIL_RATE_LIMIT_BACKEND",
+		"key_requests_per_minute": "VEIL_KEY_RATE_LIMIT",
+		"key_burst":               "VEIL_KEY_RATE_BURST",
+		"exempt_paths":            "VEIL_RATE_LIMIT_EXEMPT_PATHS",
+		"exempt_methods":          "VEIL_RATE_LIMIT_EXEMPT_METHODS",
+		"exempt_cidrs":            "VEIL_RATE_LIMIT_EXEMPT_CIDRS",
+		"exempt_user_agents":      "VEIL_RATE_LIMIT_EXEMPT_USER_AGENTS",
+	},
+	"webhook": {
+		"url":                "VEIL_WEBHOOK_URL",
+		"events":             "VEIL_WEBHOOK_EVENTS",
+		"concurrency":        "VEIL_WEBHOOK_CONCURRENCY",
+		"slack_url":          "VEIL_SLACK_WEBHOOK_URL",
+		"discord_url":        "VEIL_DISCORD_WEBHOOK_URL",
+		"chat_min_pii":       "VEIL_WEBHOOK_CHAT_MIN_PII",
+		"chat_cooldown":      "VEIL_WEBHOOK_CHAT_COOLDOWN",
+		"chat_digest":        "VEIL_WEBHOOK_CHAT_DIGEST",
+		"pagerduty_url":      "VEIL_PAGERDUTY_URL",
+		"pagerduty_events":   "VEIL_PAGERDUTY_EVENTS",
+		"cloudevents_url":    "VEIL_CLOUDEVENTS_URL",
+		"cloudevents_source": "VEIL_CLOUDEVENTS_SOURCE",
+	},
+	"router": {
+		"config":           "VEIL_ROUTER_CONFIG",
+		"token_ratios":     "VEIL_TOKEN_RATIOS",
+		"tokenizer_cl100k": "VEIL_TOKENIZER_CL100K",
+	},
+}
+
+// secrets are keys the file refuses: keys and signing secrets are read from
+// the environment only, where secret stores mount them, so a checked-in
+// veil.yaml never holds one
+var secrets = map[string]string{
+	"proxy.encryption_key":          "VEIL_ENCRYPTION_KEY",
+	"proxy.request_field_key":       "VEIL_REQUEST_FIELD_KEY",
+	"proxy.feedback_key":            "VEIL_FEEDBACK_KEY",
+	"detector.pseudonym_key":        "VEIL_PSEUDONYM_KEY",
+	"webhook.secret":                "VEIL_WEBHOOK_SECRET",
+	"webhook.pagerduty_routing_key": "VEIL_PAGERDUTY_ROUTING_KEY",
+}
+
+// Issue is a problem with one line of the file
+type Issue struct {
+	Line    int
+	Key     string // section.key, or the section alone
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Key == "" {
+		return fmt.Sprintf("line %d: %s", i.Line, i.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", i.Line, i.Key, i.Message)
+}
+
+// Error lists the errors that make a file unusable
+type Error struct {
+	Path   string
+	Issues []Issue
+
+	lines []string
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.String()
+	}
+	return e.Path + ": " + strings.Join(msgs, "; ")
+}
+
+// File is a loaded veil.yaml
+type File struct {
+	Path     string
+	Warnings []Issue
+
+	values map[string]value // by environment variable
+	lines  []string
+}
+
+type value struct {
+	key  string // section.key
+	raw  string
+	line int
+}
+
+// Load reads and parses the file at path
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	return Parse(path, data)
+}
+
+// Parse parses data as the veil.yaml at path. A returned *Error lists every
+// invalid key, not only the first.
+func Parse(path string, data []byte) (*File, error) {
+	f := &File{Path: path, values: make(map[string]value), lines: strings.Split(string(data), "\n")}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return f, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, &Error{Path: path, Issues: []Issue{{Line: root.Line, Message: "expected a mapping of sections"}}, lines: f.lines}
+	}
+
+	var errs []Issue
+	seen := make(map[string]int)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		name, body := root.Content[i], root.Content[i+1]
+		if prev, dup := seen[name.Value]; dup {
+			errs = append(errs, Issue{Line: name.Line, Key: name.Value, Message: fmt.Sprintf("section already defined on line %d", prev)})
+			continue
+		}
+		seen[name.Value] = name.Line
+		keys, ok := Sections[name.Value]
+		if !ok {
+			f.Warnings = append(f.Warnings, Issue{Line: name.Line, Key: name.Value, Message: "unknown section, ignored"})
+			continue
+		}
+		if body.Tag == "!!null" {
+			continue
+		}
+		if body.Kind != yaml.MappingNode {
+			errs = append(errs, Issue{Line: body.Line, Key: name.Value, Message: "expected a mapping of keys"})
+			continue
+		}
+		for j := 0; j+1 < len(body.Content); j += 2 {
+			k, v := body.Content[j], body.Content[j+1]
+			key := name.Value + "." + k.Value
+			if env, ok := secrets[key]; ok {
+				errs = append(errs, Issue{Line: k.Line, Key: key, Message: "secrets are read from the environment only, set " + env})
+				continue
+			}
+			env, ok := keys[k.Value]
+			if !ok {
+				f.Warnings = append(f.Warnings, Issue{Line: k.Line, Key: key, Message: "unknown key, ignored"})
+				continue
+			}
+			if prev, dup := f.values[env]; dup {
+				errs = append(errs, Issue{Line: k.Line, Key: key, Message: fmt.Sprintf("already set on line %d", prev.line)})
+				continue
+			}
+			raw, err := scalar(v)
+			if err != nil {
+				errs = append(errs, Issue{Line: v.Line, Key: key, Message: err.Error()})
+				continue
+			}
+			f.values[env] = value{key: key, raw: raw, line: k.Line}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &Error{Path: path, Issues: errs, lines: f.lines}
+	}
+	return f, nil
+}
+
+// scalar returns the string a key's value stands for: a scalar as written,
+// a list of scalars joined with commas as the environment variables take it
+func scalar(n *yaml.Node) (string, error) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return "", nil
+		}
+		return n.Value, nil
+	case yaml.SequenceNode:
+		items := make([]string, len(n.Content))
+		for i, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", errors.New("expected a list of values")
+			}
+			items[i] = item.Value
+		}
+		return strings.Join(items, ","), nil
+	case yaml.AliasNode:
+		return scalar(n.Alias)
+	}
+	return "", errors.New("expected a value or a list, got a mapping")
+}
+
+// Lookup returns the file's value for the environment variable env
+func (f *File) Lookup(env string) (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	v, ok := f.values[env]
+	return v.raw, ok && v.raw != ""
+}
+
+// Blame finds the variable an error message msg is about, among those the
+// file sets and the environment doesn't override, and returns its key
+// (ratelimit.requests_per_minute) and line
+func (f *File) Blame(msg string) (key string, line int, ok bool) {
+	for _, env := range f.Env() {
+		if v := f.values[env]; os.Getenv(env) == "" && mentions(msg, env) {
+			return v.key, v.line, true
+		}
+	}
+	return "", 0, false
+}
+
+// mentions reports whether msg names env as a whole word, so that
+// VEIL_RATE_LIMIT isn't found in VEIL_RATE_LIMIT_BACKEND
+func mentions(msg, env string) bool {
+	for i := 0; ; {
+		j := strings.Index(msg[i:], env)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(env)
+		if (start == 0 || !isEnvChar(msg[start-1])) && (end == len(msg) || !isEnvChar(msg[end])) {
+			return true
+		}
+		i = end
+	}
+}
+
+func isEnvChar(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// Env lists the environment variables the file sets, sorted
+func (f *File) Env() []string {
+	if f == nil {
+		return nil
+	}
+	names := make([]string, 0, len(f.values))
+	for env := range f.values {
+		names = append(names, env)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Context returns line of the file, for printing an issue with its source
+func (f *File) Context(line int) string {
+	if f == nil {
+		return ""
+	}
+	return lineOf(f.lines, line)
+}
+
+// Context returns line of the file, for printing an issue with its source
+func (e *Error) Context(line int) string {
+	return lineOf(e.lines, line)
+}
+
+func lineOf(lines []string, line int) string {
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line-1], "\r")
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	f, err := Parse("veil.yaml", []byte(`# shared by every instance
+proxy:
+  target_url: https://api.anthropic.com
+  vault_ttl: 2h
+  metrics: true
+ratelimit:
+  requests_per_minute: 600
+  exempt_paths: [/health, /readyz]
+webhook:
+router:
+  config: /etc/veil/router.yaml
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for env, want := range map[string]string{
+		"TARGET_URL":                   "https://api.anthropic.com",
+		"VEIL_VAULT_TTL":               "2h",
+		"VEIL_METRICS":                 "true",
+		"VEIL_RATE_LIMIT":              "600",
+		"VEIL_RATE_LIMIT_EXEMPT_PATHS": "/health,/readyz",
+		"VEIL_ROUTER_CONFIG":           "/etc/veil/router.yaml",
+	} {
+		if got, ok := f.Lookup(env); !ok || got != want {
+			t.Errorf("%s = %q, %v; want %q", env, got, ok, want)
+		}
+	}
+	if _, ok := f.Lookup("LISTEN_ADDR"); ok {
+		t.Error("a key the file doesn't set should not be found")
+	}
+	if len(f.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", f.Warnings)
+	}
+	if got := f.Context(3); got != "  target_url: https://api.anthropic.com" {
+		t.Errorf("line 3 = %q", got)
+	}
+}
+
+func TestParse_Warnings(t *testing.T) {
+	f, err := Parse("veil.yaml", []byte(`proxy:
+  target_ulr: https://api.anthropic.com
+promptgaurd:
+  enabled: false
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"line 2: proxy.target_ulr: unknown key, ignored",
+		"line 3: promptgaurd: unknown section, ignored",
+	}
+	if len(f.Warnings) != len(want) {
+		t.Fatalf("warnings = %v", f.Warnings)
+	}
+	for i, w := range f.Warnings {
+		if w.String() != want[i] {
+			t.Errorf("warning %d = %q, want %q", i, w, want[i])
+		}
+	}
+	if len(f.Env()) != 0 {
+		t.Errorf("unknown keys should set nothing: %v", f.Env())
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       []string
+	}{
+		{"not a mapping", "- proxy\n", []string{"line 1: expected a mapping of sections"}},
+		{"section value", "proxy: true\n", []string{"line 1: proxy: expected a mapping of keys"}},
+		{"nested value", "ratelimit:\n  backend:\n    kind: redis\n", []string{"line 3: ratelimit.backend: expected a value or a list, got a mapping"}},
+		{"secret", "webhook:\n  secret: s3cr3t\n", []string{"line 2: webhook.secret: secrets are read from the environment only, set VEIL_WEBHOOK_SECRET"}},
+		{"duplicate key", "proxy:\n  lang: en\n  lang: vi\n", []string{"line 3: proxy.lang: already set on line 2"}},
+		{"every error", "proxy: 1\nrouter: []\n", []string{"line 1: proxy", "line 2: router"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("veil.yaml", []byte(tt.data))
+			var fileErr *Error
+			if !errors.As(err, &fileErr) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+			if len(fileErr.Issues) != len(tt.want) {
+				t.Fatalf("issues = %v, want %d", fileErr.Issues, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := fileErr.Issues[i].String(); !strings.HasPrefix(got, want) {
+					t.Errorf("issue %d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+
+	if _, err := Parse("veil.yaml", []byte("proxy:\n  lang: [en\n")); err == nil || !strings.Contains(err.Error(), "veil.yaml: yaml:") {
+		t.Errorf("syntax error = %v", err)
+	}
+}
+
+func TestBlame(t *testing.T) {
+	f, err := Parse("veil.yaml", []byte("ratelimit:\n  requests_per_minute: lots\n  backend: memory\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VEIL_RATE_LIMIT", "")
+	t.Setenv("VEIL_RATE_LIMIT_BACKEND", "")
+
+	key, line, ok := f.Blame(`VEIL_RATE_LIMIT must be a positive integer, got "lots"`)
+	if !ok || key != "ratelimit.requests_per_minute" || line != 2 {
+		t.Errorf("Blame = %s, %d, %v", key, line, ok)
+	}
+	if key, _, _ := f.Blame("VEIL_RATE_LIMIT_BACKEND must be memory or redis"); key != "ratelimit.backend" {
+		t.Errorf("a longer variable name matched %s", key)
+	}
+
+	t.Setenv("VEIL_RATE_LIMIT", "lots")
+	if _, _, ok := f.Blame(`VEIL_RATE_LIMIT must be a positive integer, got "lots"`); ok {
+		t.Error("a variable the environment overrides is not the file's fault")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "veil.yaml")
+	if _, err := Load(path); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	os.WriteFile(path, []byte("guardrail:\n  enabled: true\n  blocked_topics:\n    - weapons\n    - gambling\n"), 0o600)
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.Lookup("VEIL_GUARDRAIL_BLOCKED_TOPICS"); got != "weapons,gambling" || f.Path != path {
+		t.Errorf("blocked topics = %q, path %s", got, f.Path)
+	}
+}
@@ -0,0 +1,63 @@
+package corpus
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStarterCorpus keeps the corpus shipped in testdata/corpus passing, so
+// `go test ./...` catches detection regressions
+func TestStarterCorpus(t *testing.T) {
+	cases, err := Load(filepath.Join("..", "..", "testdata", "corpus"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := NewRunner().Run(cases)
+	for _, res := range summary.Results {
+		if !res.Passed {
+			t.Errorf("%s (%s): %s", res.Name, res.Source, strings.Join(res.Failures, "; "))
+		}
+	}
+	if summary.Passed+summary.Failed != len(cases) {
+		t.Errorf("summary counts %d+%d cases, want %d", summary.Passed, summary.Failed, len(cases))
+	}
+}
+
+func TestCheck_ReportsRegressions(t *testing.T) {
+	block := true
+	res := NewRunner().Check(Case{
+		Name:  "clean",
+		Input: "Hôm nay trời đẹp",
+		Expect: Expect{
+			Categories: []string{"EMAIL"},
+			MinRisk:    "high",
+			Block:      &block,
+		},
+	})
+	if res.Passed || len(res.Failures) != 3 {
+		t.Errorf("expected 3 failures, got %+v", res)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"no expectation", "cases:\n  - name: a\n    input: x\n", "expect has no"},
+		{"input and file", "cases:\n  - name: a\n    input: x\n    file: y.md\n    expect: {block: true}\n", "exactly one"},
+		{"bad risk", "cases:\n  - name: a\n    input: x\n    expect: {min_risk: severe}\n", "min_risk"},
+		{"missing file", "cases:\n  - name: a\n    file: missing.md\n    expect: {block: true}\n", "missing.md"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "cases.yaml"), []byte(tt.yaml), 0o644)
+		if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := Load(t.TempDir()); err == nil {
+		t.Error("empty corpus loaded")
+	}
+}
@@ -0,0 +1,212 @@
+// Package bundle loads signed pattern bundles: versioned sets of detection
+// patterns that add to or override the built-ins without a proxy release.
+//
+// A bundle file is an envelope holding the bundle document and an Ed25519
+// signature over its exact bytes:
+//
+//	payload: |
+//	  version: 7
+//	  patterns:
+//	    - category: SECRET_ACME_KEY
+//	      label: Acme API Key
+//	      prefix: ACME_KEY
+//	      regex: '\bacme_[A-Za-z0-9]{32}\b'
+//	      confidence: 95
+//	signature: <base64 Ed25519 signature of payload>
+//
+// Envelope and payload may be YAML or JSON. A pattern with `replaces` set
+// to the label of a built-in pattern is used instead of it.
+package bundle
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/pkg/pii"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxSize bounds a bundle file
+const MaxSize = 1 << 20
+
+// Pattern is one pattern of a bundle
+type Pattern struct {
+	Category   string `yaml:"category" json:"category"`
+	Label      string `yaml:"label" json:"label"`
+	Regex      string `yaml:"regex" json:"regex"`
+	Prefix     string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	Confidence int    `yaml:"confidence,omitempty" json:"confidence,omitempty"`
+	Replaces   string `yaml:"replaces,omitempty" json:"replaces,omitempty"`
+}
+
+// Bundle is a verified, compiled pattern bundle
+type Bundle struct {
+	Version  int       `yaml:"version" json:"version"`
+	Patterns []Pattern `yaml:"patterns" json:"patterns"`
+
+	rules []detector.Rule
+}
+
+// Rules returns the compiled patterns for detector.SetBundle
+func (b *Bundle) Rules() []detector.Rule {
+	return b.rules
+}
+
+// envelope is the signed file format
+type envelope struct {
+	Payload   string `yaml:"payload"`
+	Signature string `yaml:"signature"`
+}
+
+// identRe matches categories and token prefixes
+var identRe = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// Parse verifies the envelope signature against pub and compiles the
+// bundle. Nothing in an unverified payload is parsed.
+func Parse(data []byte, pub ed25519.PublicKey) (*Bundle, error) {
+	var env envelope
+	if err := yaml.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("bundle: invalid envelope: %w", err)
+	}
+	if env.Payload == "" || env.Signature == "" {
+		return nil, errors.New("bundle: envelope needs payload and signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(env.Signature))
+	if err != nil {
+		return nil, fmt.Errorf("bundle: signature is not base64: %w", err)
+	}
+	if !ed25519.Verify(pub, []byte(env.Payload), sig) {
+		return nil, errors.New("bundle: signature verification failed")
+	}
+
+	var b Bundle
+	if err := yaml.Unmarshal([]byte(env.Payload), &b); err != nil {
+		return nil, fmt.Errorf("bundle: invalid payload: %w", err)
+	}
+	if b.Version <= 0 {
+		return nil, errors.New("bundle: version must be a positive integer")
+	}
+	builtin := builtinLabels()
+	labels := make(map[string]bool)
+	for i, p := range b.Patterns {
+		if !identRe.MatchString(p.Category) {
+			return nil, fmt.Errorf("bundle: pattern %d: category %q must be upper case, e.g. SECRET_ACME_KEY", i, p.Category)
+		}
+		if p.Label == "" {
+			return nil, fmt.Errorf("bundle: pattern %d: label is required", i)
+		}
+		if labels[p.Label] || (builtin[p.Label] && p.Replaces != p.Label) {
+			return nil, fmt.Errorf("bundle: pattern %d: duplicate label %q", i, p.Label)
+		}
+		labels[p.Label] = true
+		if p.Prefix != "" && !identRe.MatchString(p.Prefix) {
+			return nil, fmt.Errorf("bundle: pattern %q: prefix %q must be upper case", p.Label, p.Prefix)
+		}
+		if p.Confidence < 0 || p.Confidence > 100 {
+			return nil, fmt.Errorf("bundle: pattern %q: confidence must be 0-100", p.Label)
+		}
+		if p.Replaces != "" && !builtin[p.Replaces] {
+			return nil, fmt.Errorf("bundle: pattern %q replaces unknown built-in %q", p.Label, p.Replaces)
+		}
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("bundle: pattern %q: %w", p.Label, err)
+		}
+		if p.Regex == "" || re.MatchString("") {
+			return nil, fmt.Errorf("bundle: pattern %q matches the empty string", p.Label)
+		}
+		b.rules = append(b.rules, detector.Rule{
+			Pattern:    pii.Pattern{Regex: re, Category: pii.Category(p.Category), Label: p.Label},
+			Prefix:     p.Prefix,
+			Confidence: p.Confidence,
+			Replaces:   p.Replaces,
+		})
+	}
+	return &b, nil
+}
+
+// Sign wraps a bundle document in a signed envelope
+func Sign(key ed25519.PrivateKey, payload []byte) ([]byte, error) {
+	return yaml.Marshal(envelope{
+		Payload:   string(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	})
+}
+
+func builtinLabels() map[string]bool {
+	labels := make(map[string]bool)
+	for _, group := range [][]pii.Pattern{pii.VietnamPatterns(), pii.InternationalPatterns(), pii.SecretPatterns()} {
+		for _, p := range group {
+			labels[p.Label] = true
+		}
+	}
+	return labels
+}
+
+// ValidateSource checks that source is a file path or an https URL
+func ValidateSource(source string) error {
+	if !strings.Contains(source, "://") {
+		return nil
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("bundle source must be a file path or an https URL, got %q", source)
+	}
+	return nil
+}
+
+// Fetch reads a bundle file from a path or an https URL
+func Fetch(ctx context.Context, source string) ([]byte, error) {
+	if err := ValidateSource(source); err != nil {
+		return nil, err
+	}
+	if !strings.Contains(source, "://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readLimited(f)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", source, resp.Status)
+	}
+	return readLimited(resp.Body)
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("bundle larger than %d bytes", MaxSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,173 @@
+package bundle
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vurakit/agentveil/internal/detector"
+)
+
+const acmeBundle = `version: 3
+patterns:
+  - category: SECRET_ACME_KEY
+    label: Acme API Key
+    prefix: ACME_KEY
+    regex: '\bacme_[A-Za-z0-9]{16}\b'
+    confidence: 95
+`
+
+func signed(t *testing.T, key ed25519.PrivateKey, payload string) []byte {
+	t.Helper()
+	data, err := Sign(key, []byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParse(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	b, err := Parse(signed(t, priv, acmeBundle), pub)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if b.Version != 3 || len(b.Rules()) != 1 || b.Rules()[0].Prefix != "ACME_KEY" {
+		t.Errorf("bundle = %+v", b)
+	}
+}
+
+func TestParse_Rejects(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	_, other, _ := ed25519.GenerateKey(nil)
+
+	tampered := strings.Replace(string(signed(t, priv, acmeBundle)), "{16}", "{8}", 1)
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"tampered", []byte(tampered), "signature verification failed"},
+		{"wrong key", signed(t, other, acmeBundle), "signature verification failed"},
+		{"unsigned", []byte("payload: |\n  version: 1\n"), "payload and signature"},
+		{"not yaml", []byte("{{{"), "invalid envelope"},
+		{"no version", signed(t, priv, "patterns: []\n"), "version"},
+		{"bad regex", signed(t, priv, "version: 1\npatterns:\n  - {category: SECRET_X, label: X, regex: '(unclosed'}\n"), "missing closing )"},
+		{"empty match", signed(t, priv, "version: 1\npatterns:\n  - {category: SECRET_X, label: X, regex: 'a*'}\n"), "empty string"},
+		{"lower case category", signed(t, priv, "version: 1\npatterns:\n  - {category: secret_x, label: X, regex: 'x+'}\n"), "upper case"},
+		{"builtin label", signed(t, priv, "version: 1\npatterns:\n  - {category: SECRET_X, label: GitHub Token, regex: 'x+'}\n"), "duplicate label"},
+		{"unknown replace", signed(t, priv, "version: 1\npatterns:\n  - {category: SECRET_X, label: X, regex: 'x+', replaces: Nope}\n"), "unknown built-in"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.data, pub)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want mention of %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	for source, ok := range map[string]bool{
+		"/etc/agentveil/patterns.yaml":             true,
+		"patterns.yaml":                            true,
+		"https://patterns.example.com/bundle.yaml": true,
+		"http://patterns.example.com/bundle.yaml":  false,
+		"file:///etc/agentveil/patterns.yaml":      false,
+	} {
+		if err := ValidateSource(source); (err == nil) != ok {
+			t.Errorf("ValidateSource(%q) = %v", source, err)
+		}
+	}
+}
+
+func TestLoader_Reload(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	path := filepath.Join(t.TempDir(), "bundle.yaml")
+	os.WriteFile(path, signed(t, priv, acmeBundle), 0o600)
+
+	det := detector.New()
+	builtin := det.Patterns().Builtin
+	l := NewLoader(Config{Source: path, PublicKey: pub}, det)
+	if _, err := l.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if p := det.Patterns(); p.Bundle != 1 || p.BundleVersion != 3 || p.Builtin != builtin {
+		t.Errorf("patterns = %+v", p)
+	}
+
+	matches := det.Scan("key acme_0123456789abcdef here")
+	// A new SECRET_ category is masked like the built-in secrets
+	if len(matches) != 1 || matches[0].Source != detector.SourceBundle || matches[0].Rule != "Acme API Key" ||
+		!strings.HasPrefix(matches[0].Token, "acme_012*") {
+		t.Fatalf("matches = %+v", matches)
+	}
+
+	// A tampered or older bundle is rejected and version 3 stays loaded
+	os.WriteFile(path, []byte(strings.Replace(string(signed(t, priv, acmeBundle)), "version: 3", "version: 4", 1)), 0o600)
+	if _, err := l.Reload(context.Background()); err == nil {
+		t.Error("tampered bundle should be rejected")
+	}
+	os.WriteFile(path, signed(t, priv, strings.Replace(acmeBundle, "version: 3", "version: 2", 1)), 0o600)
+	if _, err := l.Reload(context.Background()); err == nil || !strings.Contains(err.Error(), "older") {
+		t.Errorf("older bundle should be rejected, got %v", err)
+	}
+	if st := l.Status(); st.Version != 3 || st.LastError == "" {
+		t.Errorf("status = %+v", st)
+	}
+	if p := det.Patterns(); p.Bundle != 1 || p.BundleVersion != 3 {
+		t.Errorf("rejected bundle changed the patterns: %+v", p)
+	}
+}
+
+func TestLoader_ReplaceBuiltin(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	path := filepath.Join(t.TempDir(), "bundle.yaml")
+	// The built-in GitHub pattern, narrowed to one token shape
+	os.WriteFile(path, signed(t, priv, `version: 1
+patterns:
+  - category: SECRET_GITHUB_TOKEN
+    label: GitHub Token
+    regex: '\bghp_v2_[A-Za-z0-9]{20}\b'
+    replaces: GitHub Token
+`), 0o600)
+
+	det := detector.New()
+	builtin := det.Patterns().Builtin
+	if _, err := NewLoader(Config{Source: path, PublicKey: pub}, det).Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p := det.Patterns(); p.Builtin != builtin-1 || p.Bundle != 1 {
+		t.Errorf("patterns = %+v", p)
+	}
+	matches := det.Scan("token ghp_v2_abcdefghij0123456789")
+	if len(matches) != 1 || matches[0].Source != detector.SourceBundle {
+		t.Errorf("matches = %+v", matches)
+	}
+}
+
+func TestLoader_ReloadHandler(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	path := filepath.Join(t.TempDir(), "bundle.yaml")
+	os.WriteFile(path, []byte("garbage"), 0o600)
+	l := NewLoader(Config{Source: path, PublicKey: pub}, detector.New())
+
+	rec := httptest.NewRecorder()
+	l.ReloadHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/patterns/reload", nil))
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "last_error") {
+		t.Errorf("malformed bundle: %d %s", rec.Code, rec.Body.String())
+	}
+
+	os.WriteFile(path, signed(t, priv, acmeBundle), 0o600)
+	rec = httptest.NewRecorder()
+	l.ReloadHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/patterns/reload", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"version":3`) {
+		t.Errorf("valid bundle: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,118 @@
+package bundle
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/detector"
+)
+
+// Config selects the bundle and the key it must be signed with
+type Config struct {
+	Source    string // file path or https URL
+	PublicKey ed25519.PublicKey
+}
+
+// Status describes the loaded bundle and the last load attempt
+type Status struct {
+	Source    string    `json:"source"`
+	Version   int       `json:"version,omitempty"`
+	Patterns  int       `json:"patterns"`
+	LoadedAt  time.Time `json:"loaded_at,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Loader loads the bundle into a detector and reloads it on demand
+type Loader struct {
+	cfg Config
+	det *detector.Detector
+
+	reload sync.Mutex // serializes reloads; mu only guards the fields
+
+	mu      sync.Mutex
+	current *Bundle
+	status  Status
+}
+
+// NewLoader creates a Loader for det. Nothing is loaded until Reload.
+func NewLoader(cfg Config, det *detector.Detector) *Loader {
+	return &Loader{cfg: cfg, det: det, status: Status{Source: cfg.Source}}
+}
+
+// Reload fetches and verifies the bundle and applies it to the detector.
+// On any error, including a version older than the loaded one, the
+// detector keeps its current patterns.
+func (l *Loader) Reload(ctx context.Context) (*Bundle, error) {
+	l.reload.Lock()
+	defer l.reload.Unlock()
+
+	b, err := l.load(ctx)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		l.status.LastError = err.Error()
+		slog.Error("pattern bundle rejected, keeping current patterns",
+			"source", l.cfg.Source, "error", err, "version", l.status.Version)
+		return nil, err
+	}
+	l.det.SetBundle(b.Version, b.Rules())
+	l.current = b
+	l.status = Status{Source: l.cfg.Source, Version: b.Version, Patterns: len(b.Patterns), LoadedAt: time.Now().UTC()}
+	slog.Info("pattern bundle loaded", "source", l.cfg.Source, "version", b.Version, "patterns", len(b.Patterns))
+	return b, nil
+}
+
+func (l *Loader) load(ctx context.Context) (*Bundle, error) {
+	data, err := Fetch(ctx, l.cfg.Source)
+	if err != nil {
+		return nil, err
+	}
+	b, err := Parse(data, l.cfg.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	current := l.current
+	l.mu.Unlock()
+	if current != nil && b.Version < current.Version {
+		return nil, fmt.Errorf("bundle: version %d is older than loaded version %d", b.Version, current.Version)
+	}
+	return b, nil
+}
+
+// Status returns the loaded bundle and the last error, if any
+func (l *Loader) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.status
+}
+
+// Patterns counts the detector's active patterns by source
+func (l *Loader) Patterns() detector.PatternInfo {
+	return l.det.Patterns()
+}
+
+// ReloadHandler serves POST /admin/patterns/reload. A rejected bundle
+// answers 422 with the reason; the previous patterns stay active.
+func (l *Loader) ReloadHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, err := l.Reload(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+		json.NewEncoder(w).Encode(ReloadResponse{Bundle: l.Status(), Patterns: l.Patterns()})
+	}
+}
+
+// ReloadResponse is the JSON body of POST /admin/patterns/reload
+type ReloadResponse struct {
+	Bundle   Status               `json:"bundle"`
+	Patterns detector.PatternInfo `json:"patterns"`
+}
@@ -2,9 +2,12 @@ package detector
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
-	"sync/atomic"
 
+	"github.com/vurakit/agentveil/internal/metrics"
 	"github.com/vurakit/agentveil/pkg/pii"
 )
 
@@ -25,8 +28,60 @@ type Match struct {
 	Start      int
 	End        int
 	Confidence int // 0-100 confidence score
+
+	// Line and Column are the 1-based position of Start, counted in runes.
+	// They are zero until filled by WithPositions.
+	Line   int `json:",omitempty"`
+	Column int `json:",omitempty"`
+
+	// EntityID identifies the value across scans without exposing it
+	EntityID string
+
+	// Source and Rule identify the pattern that produced the match
+	Source Source `json:",omitempty"`
+	Rule   string `json:",omitempty"`
+
+	// Action is what anonymization does with the match
+	Action Action `json:",omitempty"`
+}
+
+// Source is the provenance of a detection pattern
+type Source string
+
+const (
+	SourceBuiltin Source = "builtin" // compiled into this release
+	SourceBundle  Source = "bundle"  // loaded from a signed pattern bundle
+	SourceCustom  Source = "custom"  // added by the embedding application
+)
+
+// Rule is a pattern added at runtime
+type Rule struct {
+	pii.Pattern
+	Prefix     string // token prefix of a new category, defaults to the category
+	Confidence int    // 0 = the category's default
+	Replaces   string // label of a built-in pattern this rule overrides
+}
+
+// PatternInfo counts the loaded patterns by source
+type PatternInfo struct {
+	Builtin       int `json:"builtin"`
+	Bundle        int `json:"bundle"`
+	Custom        int `json:"custom"`
+	BundleVersion int `json:"bundle_version,omitempty"`
 }
 
+// Action controls how a detected category is transformed by Anonymize
+type Action string
+
+const (
+	ActionTokenize Action = "tokenize" // [PREFIX_N] token, original kept in the mapping
+	ActionRedact   Action = "redact"   // [REDACTED_CATEGORY], nothing stored
+	ActionMask     Action = "mask"     // partial mask inline
+	ActionAllow    Action = "allow"    // left untouched
+	ActionStrip    Action = "strip"    // [SECRET REMOVED], nothing stored
+	ActionBlock    Action = "block"    // the proxy rejects the request; stripped elsewhere
+)
+
 // Config configures the detector behavior
 type Config struct {
 	Sensitivity    Sensitivity
@@ -35,6 +90,23 @@ type Config struct {
 	EnableSecrets  bool
 	AllowList      map[string]bool // values to never flag
 	BlockList      map[string]bool // values to always flag
+	Policy         map[pii.Category]Action // per-category override of the default action
+	Tiers          TierConfig              // which requests get every pattern, see TierConfig
+	Profiles       map[string]Profile      // named settings chosen per request, see Profile
+	Pseudonyms     *Pseudonyms             // deterministic tokens for chosen categories, off when nil
+	Secrets        SecretActions           // action per secret category, masked by default
+}
+
+// ActionFor returns the anonymization action for a category. Secrets follow
+// Secrets, partial masking by default; everything else is tokenized.
+func (c Config) ActionFor(cat pii.Category) Action {
+	if a, ok := c.Policy[cat]; ok {
+		return a
+	}
+	if pii.IsSecretCategory(cat) {
+		return c.Secrets.For(cat)
+	}
+	return ActionTokenize
 }
 
 // DefaultConfig returns balanced detection settings
@@ -44,15 +116,40 @@ func DefaultConfig() Config {
 		EnableVietnam: true,
 		EnableIntl:    true,
 		EnableSecrets: true,
+		Tiers:         TierConfig{DeepSamplePercent: DefaultDeepSamplePercent},
 	}
 }
 
-// Detector scans text for PII and produces pseudonymized tokens
+// Detector scans text for PII and produces pseudonymized tokens.
+// Token numbering is scoped to one call (or one session, see AnonymizeWith),
+// so the first phone number of a request is always [PHONE_1].
 type Detector struct {
-	patterns    []pii.Pattern
-	mu          sync.Mutex
-	counters    map[pii.Category]*atomic.Int64
-	config      Config
+	config  Config
+	builtin []rule
+
+	mu            sync.RWMutex
+	patterns      []rule // custom, then bundle, then builtin
+	prefixes      map[pii.Category]string
+	bundle        []Rule
+	bundleVersion int
+	custom        []Rule
+	suppressor    Suppressor
+	recorder      metrics.Recorder
+}
+
+// Suppressor decides which detected values are left alone, e.g. values
+// reported as false positives (see the feedback package)
+type Suppressor interface {
+	// Suppressed reports whether the value with entityID (see EntityID)
+	// should not be flagged
+	Suppressed(entityID string) bool
+}
+
+// rule is a pattern with its provenance
+type rule struct {
+	Rule
+	source Source
+	set    PatternSet // built-in rules only
 }
 
 // New creates a Detector loaded with all PII patterns
@@ -62,27 +159,132 @@ func New() *Detector {
 
 // NewWithConfig creates a Detector with custom configuration
 func NewWithConfig(cfg Config) *Detector {
-	counters := make(map[pii.Category]*atomic.Int64)
-	for cat := range pii.TokenPrefix {
-		counters[cat] = &atomic.Int64{}
+	var patterns []rule
+	for _, set := range []struct {
+		name     PatternSet
+		enabled  bool
+		patterns func() []pii.Pattern
+	}{
+		{SetVietnam, cfg.EnableVietnam, pii.VietnamPatterns},
+		{SetIntl, cfg.EnableIntl, pii.InternationalPatterns},
+		{SetSecrets, cfg.EnableSecrets, pii.SecretPatterns},
+	} {
+		if !set.enabled {
+			continue
+		}
+		for _, p := range set.patterns() {
+			patterns = append(patterns, rule{Rule: Rule{Pattern: p}, source: SourceBuiltin, set: set.name})
+		}
 	}
 
-	var patterns []pii.Pattern
-	if cfg.EnableVietnam {
-		patterns = append(patterns, pii.VietnamPatterns()...)
+	d := &Detector{
+		config:  cfg,
+		builtin: patterns,
 	}
-	if cfg.EnableIntl {
-		patterns = append(patterns, pii.InternationalPatterns()...)
+	d.rebuild()
+	return d
+}
+
+// SetBundle replaces the patterns loaded from a pattern bundle. Scans in
+// progress finish with the previous set.
+func (d *Detector) SetBundle(version int, rules []Rule) {
+	d.mu.Lock()
+	d.bundle, d.bundleVersion = rules, version
+	d.mu.Unlock()
+	d.rebuild()
+}
+
+// SetCustomRules replaces the patterns added by the application. They take
+// precedence over bundle and built-in patterns.
+func (d *Detector) SetCustomRules(rules []Rule) {
+	d.mu.Lock()
+	d.custom = rules
+	d.mu.Unlock()
+	d.rebuild()
+}
+
+// Patterns reports how many patterns of each source are active
+func (d *Detector) Patterns() PatternInfo {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	info := PatternInfo{BundleVersion: d.bundleVersion}
+	for _, r := range d.patterns {
+		switch r.source {
+		case SourceBuiltin:
+			info.Builtin++
+		case SourceBundle:
+			info.Bundle++
+		case SourceCustom:
+			info.Custom++
+		}
+	}
+	return info
+}
+
+// rebuild orders the active patterns: custom, bundle, then the built-ins
+// not replaced by either
+func (d *Detector) rebuild() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	replaced := make(map[string]bool)
+	prefixes := make(map[pii.Category]string)
+	var patterns []rule
+	for _, layer := range []struct {
+		source Source
+		rules  []Rule
+	}{{SourceCustom, d.custom}, {SourceBundle, d.bundle}} {
+		for _, r := range layer.rules {
+			if r.Replaces != "" {
+				replaced[r.Replaces] = true
+			}
+			if _, known := pii.TokenPrefix[r.Category]; !known && prefixes[r.Category] == "" {
+				prefixes[r.Category] = r.Prefix
+			}
+			patterns = append(patterns, rule{Rule: r, source: layer.source})
+		}
 	}
-	if cfg.EnableSecrets {
-		patterns = append(patterns, pii.SecretPatterns()...)
+	for _, r := range d.builtin {
+		if !replaced[r.Label] {
+			patterns = append(patterns, r)
+		}
 	}
+	d.patterns, d.prefixes = patterns, prefixes
+}
+
+// SetSuppressor sets the Suppressor consulted for every match. Block-listed
+// values are flagged regardless.
+func (d *Detector) SetSuppressor(s Suppressor) {
+	d.mu.Lock()
+	d.suppressor = s
+	d.mu.Unlock()
+}
+
+func (d *Detector) rules() []rule {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.patterns
+}
+
+// SetRecorder reports the categories of anonymized values to rec
+func (d *Detector) SetRecorder(rec metrics.Recorder) {
+	d.mu.Lock()
+	d.recorder = rec
+	d.mu.Unlock()
+}
 
-	return &Detector{
-		patterns: patterns,
-		counters: counters,
-		config:   cfg,
+func (d *Detector) getRecorder() metrics.Recorder {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.recorder == nil {
+		return metrics.Nop{}
 	}
+	return d.recorder
+}
+
+func (d *Detector) getSuppressor() Suppressor {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.suppressor
 }
 
 // confidenceFor assigns a confidence score based on category and context
@@ -91,11 +293,16 @@ func confidenceFor(cat pii.Category, original string) int {
 	case pii.CatEmail:
 		return 95
 	case pii.CatCCCD:
-		// CCCD with valid province prefix (0-96) gets higher confidence
-		if len(original) == 12 && original[0] == '0' {
-			return 90
+		// A known province code and plausible birth year make it a real
+		// CCCD; an unknown province is most likely some other number
+		switch ok, reason := pii.ValidateCCCD(original); {
+		case ok:
+			return 95
+		case reason == pii.CCCDUnknownRegion || reason == pii.CCCDBadFormat:
+			return 45
+		default:
+			return 60
 		}
-		return 70
 	case pii.CatPhone:
 		return 90
 	case pii.CatCreditCard:
@@ -114,7 +321,10 @@ func confidenceFor(cat pii.Category, original string) int {
 	case pii.CatLicPlate:
 		return 80
 	case pii.CatTIN:
-		return 70
+		if pii.ValidateTIN(original) {
+			return 90
+		}
+		return 45 // checksum failure: only kept at high sensitivity
 	case pii.CatBankAcct:
 		return 80 // context-hinted
 	case pii.CatBHXH:
@@ -185,23 +395,98 @@ func minConfidence(s Sensitivity) int {
 	}
 }
 
-// Scan detects all PII in text and returns matches with pseudonym tokens
+// categoryPriority breaks ties between overlapping matches of equal length.
+// Provider-specific formats outrank structural ones, which outrank the
+// keyword/length heuristics they are usually nested in.
+var categoryPriority = map[pii.Category]int{
+	pii.CatPEMPrivateKey:   100,
+	pii.CatAPIKeyOpenAI:    95,
+	pii.CatAPIKeyAnthropic: 95,
+	pii.CatAPIKeyGoogle:    95,
+	pii.CatAWSAccessKey:    95,
+	pii.CatAWSSecretKey:    95,
+	pii.CatGitHubToken:     95,
+	pii.CatGitLabToken:     95,
+	pii.CatSlackToken:      95,
+	pii.CatStripeKey:       95,
+	pii.CatSendGridKey:     95,
+	pii.CatTwilioKey:       95,
+	pii.CatNPMToken:        95,
+	pii.CatPyPIToken:       95,
+	pii.CatDockerToken:     95,
+	pii.CatHuggingFace:     95,
+	pii.CatReplicateToken:  95,
+	pii.CatJWT:             90,
+	pii.CatConnectionStr:   90,
+	pii.CatHexSecret:       50,
+	pii.CatGenericSecret:   40,
+
+	pii.CatEmail:      85,
+	pii.CatCreditCard: 85,
+	pii.CatIBAN:       80,
+	pii.CatBankAcct:   80, // context-hinted, beats bare digit patterns
+	pii.CatBHXH:       80,
+	pii.CatSSN:        80,
+	pii.CatCCCD:       75,
+	pii.CatPassport:   75,
+	pii.CatPhone:      70,
+	pii.CatAddress:    65,
+	pii.CatTIN:        60,
+	pii.CatDOB:        60,
+	pii.CatIPAddr:     60,
+	pii.CatLicPlate:   60,
+	pii.CatCMND:       30,
+}
+
+// candidate is a match before overlap resolution and token assignment
+type candidate struct {
+	Match
+	pattern int // index in d.patterns, lower = declared earlier
+}
+
+// Scan detects all PII in text and returns matches with pseudonym tokens.
+// Overlapping matches are resolved to the most specific one (longer span,
+// then categoryPriority, then pattern order) and the result is sorted by Start.
+// Patterns with a capture group report the group (the value) rather than
+// the surrounding label, e.g. the digits of "STK: 0123456789".
 func (d *Detector) Scan(text string) []Match {
-	var matches []Match
-	seen := make(map[string]string) // original -> token (dedup within same scan)
-	threshold := minConfidence(d.config.Sensitivity)
+	return d.scan(text, newTokenizer(nil), TierDeep, nil)
+}
 
-	for _, p := range d.patterns {
-		locs := p.Regex.FindAllStringIndex(text, -1)
+// scan runs the patterns of tier, filtered by prof when it is not nil
+func (d *Detector) scan(text string, tk *tokenizer, tier Tier, prof *Profile) []Match {
+	sensitivity := d.config.Sensitivity
+	if prof != nil {
+		sensitivity = prof.Sensitivity
+	}
+	threshold := minConfidence(sensitivity)
+
+	suppressor := d.getSuppressor()
+	var candidates []candidate
+	for pi, p := range d.rules() {
+		if tier == TierFast && !d.config.Tiers.IsFast(p.Category) {
+			continue
+		}
+		if prof != nil && !prof.scans(p) {
+			continue
+		}
+		locs := p.Regex.FindAllStringSubmatchIndex(text, -1)
 		for _, loc := range locs {
-			original := text[loc[0]:loc[1]]
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			original := text[start:end]
 
 			// Allow list check
 			if d.config.AllowList != nil && d.config.AllowList[original] {
 				continue
 			}
 
-			confidence := confidenceFor(p.Category, original)
+			confidence := p.Confidence
+			if confidence == 0 {
+				confidence = confidenceFor(p.Category, original)
+			}
 
 			// Block list always matches regardless of confidence
 			isBlocked := d.config.BlockList != nil && d.config.BlockList[original]
@@ -215,45 +500,227 @@ func (d *Detector) Scan(text string) []Match {
 				continue
 			}
 
-			// Skip if already matched by higher-priority pattern
-			token, exists := seen[original]
-			if !exists {
-				if pii.IsSecretCategory(p.Category) {
-					// Secrets: partial mask (show ~40%, hide rest with *)
-					token = pii.PartialMask(original)
-				} else {
-					counter := d.counters[p.Category]
-					if counter == nil {
-						counter = &atomic.Int64{}
-						d.mu.Lock()
-						d.counters[p.Category] = counter
-						d.mu.Unlock()
-					}
-					idx := counter.Add(1)
-					prefix := pii.TokenPrefix[p.Category]
-					token = fmt.Sprintf("[%s_%d]", prefix, idx)
-				}
-				seen[original] = token
+			action := d.actionFor(prof, p.Category)
+			if action == ActionAllow {
+				continue
+			}
+
+			if suppressor != nil && !isBlocked && suppressor.Suppressed(EntityID(p.Category, original)) {
+				continue
 			}
 
-			matches = append(matches, Match{
-				Original:   original,
-				Token:      token,
-				Category:   p.Category,
-				Start:      loc[0],
-				End:        loc[1],
-				Confidence: confidence,
+			candidates = append(candidates, candidate{
+				Match: Match{
+					Original:   original,
+					Category:   p.Category,
+					Start:      start,
+					End:        end,
+					Confidence: confidence,
+					Source:     p.source,
+					Rule:       p.Label,
+					Action:     action,
+				},
+				pattern: pi,
 			})
 		}
 	}
 
+	matches := resolveOverlaps(candidates)
+
+	for i := range matches {
+		m := &matches[i]
+		m.Token = d.tokenFor(prof, m.Category, m.Original, tk)
+		m.EntityID = EntityID(m.Category, m.Original)
+	}
+
 	return matches
 }
 
+// tokenFor builds the replacement for original according to the category's action
+func (d *Detector) tokenFor(prof *Profile, cat pii.Category, original string, tk *tokenizer) string {
+	switch d.actionFor(prof, cat) {
+	case ActionMask:
+		// Partial mask (show ~40%, hide rest with *)
+		return pii.PartialMask(original)
+	case ActionRedact:
+		return RedactedToken(cat)
+	case ActionStrip, ActionBlock:
+		return StrippedToken
+	}
+	if p := d.config.Pseudonyms; p != nil {
+		if token := p.pseudonym(d.prefixFor(cat), cat, original, tk); token != "" {
+			return token
+		}
+	}
+	return tk.token(d.prefixFor(cat), original)
+}
+
+// prefixFor returns the token prefix of a category, including categories
+// introduced by bundle and custom rules
+func (d *Detector) prefixFor(cat pii.Category) string {
+	if prefix, ok := pii.TokenPrefix[cat]; ok {
+		return prefix
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if prefix := d.prefixes[cat]; prefix != "" {
+		return prefix
+	}
+	return string(cat)
+}
+
+// tokenizer numbers tokens per prefix for one call or session. The same
+// original always gets the same token.
+type tokenizer struct {
+	byOriginal map[string]string
+	taken      map[string]string // token -> original, for pseudonym collisions
+	last       map[string]int    // highest index used per prefix
+}
+
+// newTokenizer seeds the numbering from an existing token -> original
+// mapping, so known values keep their token and new ones continue after it
+func newTokenizer(existing map[string]string) *tokenizer {
+	tk := &tokenizer{byOriginal: make(map[string]string), taken: make(map[string]string), last: make(map[string]int)}
+	for token, original := range existing {
+		tk.taken[token] = original
+		prefix, idx, ok := parseToken(token)
+		if !ok {
+			continue // masked secrets and other non-numbered replacements
+		}
+		if cur, seen := tk.byOriginal[original]; !seen || token < cur {
+			tk.byOriginal[original] = token
+		}
+		if idx > tk.last[prefix] {
+			tk.last[prefix] = idx
+		}
+	}
+	return tk
+}
+
+func (tk *tokenizer) token(prefix, original string) string {
+	if token, ok := tk.byOriginal[original]; ok {
+		return token
+	}
+	tk.last[prefix]++
+	token := fmt.Sprintf("[%s_%d]", prefix, tk.last[prefix])
+	tk.claim(token, original)
+	return token
+}
+
+// claim records token as the token of original
+func (tk *tokenizer) claim(token, original string) {
+	tk.byOriginal[original] = token
+	tk.taken[token] = original
+}
+
+// parseToken splits "[PREFIX_N]" into its prefix and index
+func parseToken(token string) (string, int, bool) {
+	inner, ok := strings.CutPrefix(token, "[")
+	if !ok {
+		return "", 0, false
+	}
+	if inner, ok = strings.CutSuffix(inner, "]"); !ok {
+		return "", 0, false
+	}
+	i := strings.LastIndexByte(inner, '_')
+	if i <= 0 {
+		return "", 0, false
+	}
+	idx, err := strconv.Atoi(inner[i+1:])
+	if err != nil || idx <= 0 {
+		return "", 0, false
+	}
+	return inner[:i], idx, true
+}
+
+// RedactedToken is the replacement written for categories with ActionRedact
+func RedactedToken(cat pii.Category) string {
+	return fmt.Sprintf("[REDACTED_%s]", cat)
+}
+
+// Stored reports whether the original of m belongs in the vault: false
+// for redacted and stripped values, which are never restored
+func Stored(m Match) bool {
+	return m.Token != RedactedToken(m.Category) && m.Token != StrippedToken
+}
+
+// resolveOverlaps keeps the most specific candidate of every overlapping
+// group and returns the survivors sorted by Start
+func resolveOverlaps(candidates []candidate) []Match {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if la, lb := a.End-a.Start, b.End-b.Start; la != lb {
+			return la > lb
+		}
+		if pa, pb := categoryPriority[a.Category], categoryPriority[b.Category]; pa != pb {
+			return pa > pb
+		}
+		if a.pattern != b.pattern {
+			return a.pattern < b.pattern
+		}
+		return a.Start < b.Start
+	})
+
+	// kept stays sorted by Start, so only the neighbours of the insertion
+	// point can overlap a new candidate
+	var kept []Match
+	for _, c := range candidates {
+		i := sort.Search(len(kept), func(i int) bool { return kept[i].Start >= c.Start })
+		if i > 0 && kept[i-1].End > c.Start {
+			continue
+		}
+		if i < len(kept) && kept[i].Start < c.End {
+			continue
+		}
+		kept = append(kept, Match{})
+		copy(kept[i+1:], kept[i:])
+		kept[i] = c.Match
+	}
+	return kept
+}
+
 // Anonymize replaces all PII in text with pseudonym tokens and returns
-// the anonymized text along with the mapping (token -> original)
+// the anonymized text along with the mapping (token -> original).
+// Redacted values are replaced but never added to the mapping.
 func (d *Detector) Anonymize(text string) (string, map[string]string) {
-	matches := d.Scan(text)
+	result, applied := d.AnonymizeMatches(text)
+	return result, d.Mapping(applied)
+}
+
+// Mapping builds the token -> original mapping for applied matches,
+// leaving out redacted and stripped values. It returns nil when there is
+// nothing to store.
+func (d *Detector) Mapping(applied []Match) map[string]string {
+	if len(applied) == 0 {
+		return nil
+	}
+
+	mapping := make(map[string]string)
+	for _, m := range applied {
+		if !Stored(m) {
+			continue
+		}
+		mapping[m.Token] = m.Original
+	}
+	return mapping
+}
+
+// AnonymizeMatches is like Anonymize but returns the matches that were
+// actually substituted, ordered by position descending
+func (d *Detector) AnonymizeMatches(text string) (string, []Match) {
+	return d.AnonymizeWith(text, nil)
+}
+
+// AnonymizeWith is like AnonymizeMatches but continues a session: existing is
+// the session's token -> original mapping (as stored in the vault). Values
+// already in it reuse their token and new values are numbered after it, so a
+// token never takes on a second meaning within the session.
+func (d *Detector) AnonymizeWith(text string, existing map[string]string) (string, []Match) {
+	return d.anonymize(text, newTokenizer(existing), TierDeep, nil)
+}
+
+func (d *Detector) anonymize(text string, tk *tokenizer, tier Tier, prof *Profile) (string, []Match) {
+	matches := d.scan(text, tk, tier, prof)
 	if len(matches) == 0 {
 		return text, nil
 	}
@@ -261,28 +728,31 @@ func (d *Detector) Anonymize(text string) (string, map[string]string) {
 	// Sort matches by position descending to replace from end to start
 	sortByPosDesc(matches)
 
-	// Deduplicate overlapping matches (keep the first = higher priority)
-	matches = removeOverlaps(matches)
-
-	mapping := make(map[string]string)
+	var applied []Match
 	result := text
 	for _, m := range matches {
 		if m.Start >= 0 && m.End <= len(result) {
 			result = result[:m.Start] + m.Token + result[m.End:]
-			mapping[m.Token] = m.Original
+			applied = append(applied, m)
 		}
 	}
 
-	return result, mapping
-}
-
-// ResetCounters resets the per-category token counters
-func (d *Detector) ResetCounters() {
-	for _, c := range d.counters {
-		c.Store(0)
+	counts := make(map[pii.Category]int)
+	for _, m := range applied {
+		counts[m.Category]++
+	}
+	rec := d.getRecorder()
+	for cat, n := range counts {
+		rec.PIIDetected(string(cat), n)
 	}
+	return result, applied
 }
 
+// ResetCounters is a no-op kept for compatibility.
+//
+// Deprecated: token numbering restarts on every call.
+func (d *Detector) ResetCounters() {}
+
 func sortByPosDesc(matches []Match) {
 	for i := 1; i < len(matches); i++ {
 		for j := i; j > 0 && matches[j].Start > matches[j-1].Start; j-- {
@@ -290,25 +760,3 @@ func sortByPosDesc(matches []Match) {
 		}
 	}
 }
-
-// removeOverlaps removes matches that overlap with earlier (higher-priority) ones.
-// Assumes matches are sorted by Start descending.
-func removeOverlaps(matches []Match) []Match {
-	if len(matches) <= 1 {
-		return matches
-	}
-
-	var result []Match
-	result = append(result, matches[0])
-
-	for i := 1; i < len(matches); i++ {
-		prev := result[len(result)-1]
-		curr := matches[i]
-		// Since sorted desc by Start, check if curr overlaps with prev
-		if curr.End <= prev.Start {
-			result = append(result, curr)
-		}
-	}
-
-	return result
-}
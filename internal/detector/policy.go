@@ -0,0 +1,53 @@
+package detector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// ParsePolicy parses a Config.Policy from a comma-separated list of
+// CATEGORY=action items, where action is tokenize, redact, mask or allow:
+// "EMAIL=allow, CREDIT_CARD=redact". Unknown categories are an error, so a
+// misspelled one isn't ignored. Categories left out keep their default, so
+// secrets stay under SecretActions.
+func ParsePolicy(raw string) (map[pii.Category]Action, error) {
+	policy := make(map[pii.Category]Action)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: want CATEGORY=action", item)
+		}
+		cat := pii.Category(strings.ToUpper(strings.TrimSpace(key)))
+		if cat == "" {
+			return nil, fmt.Errorf("%q: missing category", item)
+		}
+		if _, ok := pii.TokenPrefix[cat]; !ok {
+			return nil, fmt.Errorf("%q: unknown category %q", item, strings.TrimSpace(key))
+		}
+		switch action := Action(strings.ToLower(strings.TrimSpace(value))); action {
+		case ActionTokenize, ActionRedact, ActionMask, ActionAllow:
+			policy[cat] = action
+		default:
+			return nil, fmt.Errorf("%s: invalid action %q (want tokenize, redact, mask or allow)", cat, value)
+		}
+	}
+	return policy, nil
+}
+
+// PolicyString describes a policy in the form ParsePolicy reads, sorted by
+// category
+func PolicyString(policy map[pii.Category]Action) string {
+	parts := make([]string, 0, len(policy))
+	for cat, a := range policy {
+		parts = append(parts, string(cat)+"="+string(a))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
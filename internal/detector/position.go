@@ -0,0 +1,72 @@
+package detector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// EntityID returns a short stable ID for a detected value: the first 16 hex
+// characters of SHA-256 over the category and the normalized value, so the
+// same e-mail found in two scans gets the same ID. It is not keyed, and
+// low-entropy values such as phone numbers can be guessed from it; treat it
+// as a correlation handle, not as anonymization.
+func EntityID(cat pii.Category, original string) string {
+	sum := sha256.Sum256([]byte(string(cat) + "\x00" + normalizeValue(original)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// normalizeValue folds case and drops the spacing and grouping characters
+// that vary between renderings of the same value ("0912 345 678",
+// "0912-345-678"). Dots are kept: they are significant in e-mails and IPs.
+func normalizeValue(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r), r == '-', r == '(', r == ')':
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, v)
+}
+
+// WithPositions fills Line and Column of each match from its Start offset
+// in text and returns matches. Lines and columns are 1-based and counted in
+// runes, so "Đồng" is four columns wide. Matches may be in any order.
+func WithPositions(text string, matches []Match) []Match {
+	if len(matches) == 0 {
+		return matches
+	}
+
+	// Walk the text once, visiting offsets in ascending order
+	order := make([]int, len(matches))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return matches[order[a]].Start < matches[order[b]].Start })
+
+	line, col, pos := 1, 1, 0
+	for _, i := range order {
+		start := matches[i].Start
+		if start > len(text) {
+			start = len(text)
+		}
+		for pos < start {
+			r, size := utf8.DecodeRuneInString(text[pos:])
+			pos += size
+			if r == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+		}
+		matches[i].Line = line
+		matches[i].Column = col
+	}
+	return matches
+}
@@ -0,0 +1,159 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+	"gopkg.in/yaml.v3"
+)
+
+// PatternSet names a group of built-in patterns
+type PatternSet string
+
+const (
+	SetVietnam PatternSet = "vietnam"
+	SetIntl    PatternSet = "intl"
+	SetSecrets PatternSet = "secrets"
+)
+
+// Profile tunes detection for one kind of consumer, e.g. a support agent
+// that needs every category at high sensitivity or a code assistant that
+// only needs secrets. Profiles filter the detector's compiled patterns at
+// match time, so choosing one per request costs no regex compilation.
+type Profile struct {
+	Sensitivity Sensitivity
+	// Sets limits the built-in patterns to these sets, nil runs every set
+	// the detector loaded. Bundle and custom rules belong to no set.
+	Sets []PatternSet
+	// Categories, when not empty, are the only categories reported
+	Categories []pii.Category
+	// Policy overrides Config.Policy per category
+	Policy map[pii.Category]Action
+}
+
+// scans reports whether the profile runs r
+func (p *Profile) scans(r rule) bool {
+	if p.Sets != nil && r.source == SourceBuiltin && !slices.Contains(p.Sets, r.set) {
+		return false
+	}
+	return len(p.Categories) == 0 || slices.Contains(p.Categories, r.Category)
+}
+
+// actionFor is Config.ActionFor with the profile's policy on top
+func (d *Detector) actionFor(p *Profile, cat pii.Category) Action {
+	if p != nil {
+		if a, ok := p.Policy[cat]; ok {
+			return a
+		}
+	}
+	return d.config.ActionFor(cat)
+}
+
+// Profile returns the named profile of Config.Profiles
+func (d *Detector) Profile(name string) (Profile, bool) {
+	p, ok := d.config.Profiles[name]
+	return p, ok
+}
+
+// AnonymizeProfile is AnonymizeTier evaluated with the named profile. An
+// empty or unknown name uses the detector's own configuration.
+func (d *Detector) AnonymizeProfile(text string, existing map[string]string, tier Tier, name string) (string, []Match) {
+	var prof *Profile
+	if p, ok := d.Profile(name); ok {
+		prof = &p
+	}
+	return d.anonymize(text, newTokenizer(existing), tier, prof)
+}
+
+type profileKey struct{}
+
+// WithProfile selects the detector profile for work done with ctx
+func WithProfile(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, profileKey{}, name)
+}
+
+// ProfileFromContext returns the profile set by WithProfile, or ""
+func ProfileFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(profileKey{}).(string)
+	return name
+}
+
+// profileFile is the YAML layout of a profiles file:
+//
+//	profiles:
+//	  strict:
+//	    sensitivity: high
+//	  code:
+//	    patterns: [secrets]
+//	    policy: {SECRET_GENERIC: redact}
+type profileFile struct {
+	Profiles map[string]struct {
+		Sensitivity string            `yaml:"sensitivity"`
+		Patterns    []string          `yaml:"patterns"`
+		Categories  []string          `yaml:"categories"`
+		Policy      map[string]string `yaml:"policy"`
+	} `yaml:"profiles"`
+}
+
+// LoadProfiles reads named profiles from a YAML file, see ParseProfiles
+func LoadProfiles(path string) (map[string]Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read profiles: %w", err)
+	}
+	return ParseProfiles(data)
+}
+
+// ParseProfiles parses named profiles. Sensitivity is low, medium (the
+// default) or high; patterns lists vietnam, intl and secrets; policy maps
+// categories to tokenize, redact, mask or allow.
+func ParseProfiles(data []byte) (map[string]Profile, error) {
+	var f profileFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse profiles: %w", err)
+	}
+	profiles := make(map[string]Profile, len(f.Profiles))
+	for name, raw := range f.Profiles {
+		p := Profile{Sensitivity: SensitivityMedium}
+		switch strings.ToLower(raw.Sensitivity) {
+		case "low":
+			p.Sensitivity = SensitivityLow
+		case "", "medium":
+		case "high":
+			p.Sensitivity = SensitivityHigh
+		default:
+			return nil, fmt.Errorf("profile %s: invalid sensitivity %q (want low, medium or high)", name, raw.Sensitivity)
+		}
+		if raw.Patterns != nil {
+			p.Sets = []PatternSet{}
+		}
+		for _, s := range raw.Patterns {
+			switch set := PatternSet(strings.ToLower(s)); set {
+			case SetVietnam, SetIntl, SetSecrets:
+				p.Sets = append(p.Sets, set)
+			default:
+				return nil, fmt.Errorf("profile %s: unknown pattern set %q (want vietnam, intl or secrets)", name, s)
+			}
+		}
+		for _, c := range raw.Categories {
+			p.Categories = append(p.Categories, pii.Category(strings.ToUpper(c)))
+		}
+		for c, a := range raw.Policy {
+			switch action := Action(strings.ToLower(a)); action {
+			case ActionTokenize, ActionRedact, ActionMask, ActionAllow:
+				if p.Policy == nil {
+					p.Policy = make(map[pii.Category]Action)
+				}
+				p.Policy[pii.Category(strings.ToUpper(c))] = action
+			default:
+				return nil, fmt.Errorf("profile %s: invalid action %q for %s", name, a, c)
+			}
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
@@ -0,0 +1,114 @@
+package detector
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// DefaultPseudonymLength is the number of digest characters in a pseudonym
+const DefaultPseudonymLength = 8
+
+// Pseudonyms replaces the counter tokens of chosen categories with keyed,
+// deterministic ones: the same value always gets the same token, in every
+// session and on every replica sharing Key, e.g. [PHONE_h8f3k2qa] instead
+// of [PHONE_1] in one session and [PHONE_7] in another. Downstream systems
+// can join on the token without seeing the value.
+//
+// This links a person's requests across sessions for anyone who sees the
+// tokens, the provider included, and a low-entropy value such as a phone
+// number can be confirmed by whoever holds Key. Rotating Key breaks the
+// links. Rehydration still goes through the vault, so tokens are only
+// lookup keys there.
+type Pseudonyms struct {
+	// Key is the HMAC key. It must differ from the vault encryption key.
+	Key []byte
+	// Categories lists the categories that get pseudonyms
+	Categories map[pii.Category]PseudonymRule
+	// Length is the number of digest characters, DefaultPseudonymLength
+	// when 0. A token is lengthened when its prefix is taken by another
+	// value of the session.
+	Length int
+}
+
+// PseudonymRule configures the pseudonyms of one category
+type PseudonymRule struct {
+	// KeepLast leaves the last KeepLast characters of the value visible,
+	// e.g. [PHONE_h8f3k2qa:78]. Values no longer than KeepLast keep none.
+	KeepLast int
+}
+
+var pseudonymEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// ParsePseudonymCategories parses a comma-separated list of categories,
+// each optionally followed by :N to keep its last N characters visible,
+// e.g. "PHONE:2,EMAIL"
+func ParsePseudonymCategories(raw string) (map[pii.Category]PseudonymRule, error) {
+	cats := make(map[pii.Category]PseudonymRule)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, keep, hasKeep := strings.Cut(item, ":")
+		cat := pii.Category(strings.ToUpper(strings.TrimSpace(name)))
+		if _, ok := pii.TokenPrefix[cat]; !ok {
+			return nil, fmt.Errorf("unknown category %q", name)
+		}
+		var rule PseudonymRule
+		if hasKeep {
+			n, err := strconv.Atoi(strings.TrimSpace(keep))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%s: characters to keep must be a non-negative integer, got %q", cat, keep)
+			}
+			rule.KeepLast = n
+		}
+		cats[cat] = rule
+	}
+	if len(cats) == 0 {
+		return nil, fmt.Errorf("no categories")
+	}
+	return cats, nil
+}
+
+// pseudonym returns the token of original under p, or "" when cat does not
+// get pseudonyms
+func (p *Pseudonyms) pseudonym(prefix string, cat pii.Category, original string, tk *tokenizer) string {
+	rule, ok := p.Categories[cat]
+	if !ok || len(p.Key) == 0 {
+		return ""
+	}
+	if token, ok := tk.byOriginal[original]; ok {
+		return token
+	}
+
+	// Renderings of the same value share a pseudonym
+	norm := normalizeValue(original)
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write([]byte(string(cat) + "\x00" + norm))
+	digest := pseudonymEncoding.EncodeToString(mac.Sum(nil))
+
+	suffix := ""
+	if r := []rune(norm); rule.KeepLast > 0 && rule.KeepLast < len(r) {
+		suffix = ":" + string(r[len(r)-rule.KeepLast:])
+	}
+	n := p.Length
+	if n <= 0 {
+		n = DefaultPseudonymLength
+	}
+	for ; n <= len(digest); n++ {
+		token := "[" + prefix + "_" + digest[:n] + suffix + "]"
+		// A colliding prefix is lengthened, so a token always rehydrates
+		// to the value it was made for
+		if owner, taken := tk.taken[token]; !taken || normalizeValue(owner) == norm {
+			tk.claim(token, original)
+			return token
+		}
+	}
+	return ""
+}
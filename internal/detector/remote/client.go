@@ -0,0 +1,211 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/detector"
+)
+
+// Client defaults
+const (
+	DefaultTimeout    = 2 * time.Second
+	DefaultRetryAfter = 5 * time.Second
+)
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// WithTimeout bounds each remote call
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) { c.http.Timeout = d }
+}
+
+// WithRetryAfter sets how long the client stays on the in-process detector
+// after the remote fails before trying it again
+func WithRetryAfter(d time.Duration) ClientOption {
+	return func(c *Client) { c.retryAfter = d }
+}
+
+// Client calls a remote detector service. It has the same methods as
+// *detector.Detector that the proxy uses, and falls back to the in-process
+// fallback detector whenever the remote cannot be reached.
+type Client struct {
+	baseURL    string
+	http       *http.Client
+	fallback   *detector.Detector
+	retryAfter time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	downUntil time.Time
+	degraded  bool
+}
+
+// NewClient creates a client for addr ("host:port" or an http(s) URL).
+// fallback is required: detection must never be skipped.
+func NewClient(addr string, fallback *detector.Detector, opts ...ClientOption) (*Client, error) {
+	if fallback == nil {
+		return nil, fmt.Errorf("remote detector: fallback detector is required")
+	}
+	base, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		baseURL:    base,
+		http:       &http.Client{Timeout: DefaultTimeout},
+		fallback:   fallback,
+		retryAfter: DefaultRetryAfter,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// ParseAddr validates a DETECTOR_ADDR value
+func ParseAddr(addr string) error {
+	_, err := parseAddr(addr)
+	return err
+}
+
+func parseAddr(addr string) (string, error) {
+	if addr == "" {
+		return "", fmt.Errorf("remote detector: empty address")
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("remote detector: invalid address %q", addr)
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+// Scan reports PII in text
+func (c *Client) Scan(text string) []detector.Match {
+	var resp ScanResponse
+	if err := c.call(context.Background(), ScanProcedure, "", ScanRequest{Text: text}, &resp); err != nil {
+		return c.fallback.Scan(text)
+	}
+	return fromWire(resp.Matches)
+}
+
+// AnonymizeMatches anonymizes text without session affinity
+func (c *Client) AnonymizeMatches(text string) (string, []detector.Match) {
+	return c.AnonymizeSession(context.Background(), "", text, nil)
+}
+
+// AnonymizeWith anonymizes text continuing the numbering of existing
+// (token -> original), without session affinity
+func (c *Client) AnonymizeWith(text string, existing map[string]string) (string, []detector.Match) {
+	return c.AnonymizeSession(context.Background(), "", text, existing)
+}
+
+// AnonymizeSession anonymizes text, sending sessionID so the service's load
+// balancer can keep a session on one replica. existing is the session's
+// current mapping. Mappings are returned, not stored remotely; the proxy
+// stores them in its own vault.
+func (c *Client) AnonymizeSession(ctx context.Context, sessionID, text string, existing map[string]string) (string, []detector.Match) {
+	var resp AnonymizeResponse
+	req := AnonymizeRequest{Text: text, SessionID: sessionID, Existing: existing}
+	if err := c.call(ctx, AnonymizeProcedure, sessionID, req, &resp); err != nil {
+		return c.fallback.AnonymizeWith(text, existing)
+	}
+	return resp.Text, fromWire(resp.Matches)
+}
+
+// Mapping builds the token -> original mapping for applied matches,
+// leaving out redacted and stripped values
+func (c *Client) Mapping(applied []detector.Match) map[string]string {
+	if len(applied) == 0 {
+		return nil
+	}
+	mapping := make(map[string]string)
+	for _, m := range applied {
+		if !detector.Stored(m) {
+			continue
+		}
+		mapping[m.Token] = m.Original
+	}
+	return mapping
+}
+
+// Degraded reports whether calls are currently served in-process
+func (c *Client) Degraded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.degraded
+}
+
+// call posts req to the procedure. Any error means the caller must use the
+// fallback; unreachable or failing remotes are skipped for retryAfter.
+func (c *Client) call(ctx context.Context, procedure, sessionID string, req, resp any) error {
+	c.mu.Lock()
+	skip := c.now().Before(c.downUntil)
+	c.mu.Unlock()
+	if skip {
+		return fmt.Errorf("remote detector unavailable")
+	}
+
+	err := c.do(ctx, procedure, sessionID, req, resp)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.downUntil = c.now().Add(c.retryAfter)
+		if !c.degraded {
+			c.degraded = true
+			slog.Warn("remote detector unavailable, falling back to in-process detection",
+				"addr", c.baseURL, "error", err, "retry_after", c.retryAfter)
+		}
+		return err
+	}
+	if c.degraded {
+		c.degraded = false
+		slog.Info("remote detector recovered", "addr", c.baseURL)
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, procedure, sessionID string, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+procedure, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if sessionID != "" {
+		httpReq.Header.Set(SessionHeader, sessionID)
+	}
+
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		var e rpcError
+		json.Unmarshal(data, &e)
+		return fmt.Errorf("%s: status %d %s %s", procedure, httpResp.StatusCode, e.Code, e.Message)
+	}
+	return json.Unmarshal(data, resp)
+}
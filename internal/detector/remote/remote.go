@@ -0,0 +1,108 @@
+// Package remote runs the PII detector as a standalone service and provides
+// a client the proxy can use in place of an in-process detector.
+//
+// The service contract is api/detector.proto. Unary calls use the Connect
+// protocol's JSON encoding (POST /agentveil.detector.v1.Detector/<Method>
+// with a JSON body), so non-Go services can call detection directly.
+package remote
+
+import (
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// Procedure paths
+const (
+	ServiceName        = "agentveil.detector.v1.Detector"
+	ScanProcedure      = "/" + ServiceName + "/Scan"
+	AnonymizeProcedure = "/" + ServiceName + "/Anonymize"
+)
+
+// SessionHeader carries the session for affinity routing
+const SessionHeader = "X-Session-ID"
+
+// Match is the wire form of detector.Match
+type Match struct {
+	Original   string `json:"original"`
+	Token      string `json:"token"`
+	Category   string `json:"category"`
+	Start      int    `json:"start"`
+	End        int    `json:"end"`
+	Confidence int    `json:"confidence"`
+	Source     string `json:"source,omitempty"`
+	Rule       string `json:"rule,omitempty"`
+	Action     string `json:"action,omitempty"`
+}
+
+// ScanRequest is the Scan input
+type ScanRequest struct {
+	Text string `json:"text"`
+}
+
+// ScanResponse is the Scan output
+type ScanResponse struct {
+	Matches []Match `json:"matches"`
+}
+
+// AnonymizeRequest is the Anonymize input
+type AnonymizeRequest struct {
+	Text      string `json:"text"`
+	SessionID string `json:"sessionId,omitempty"`
+	Store     bool   `json:"store,omitempty"`
+	// Existing is the session's token -> original mapping, so known values
+	// keep their token and new ones are numbered after it
+	Existing map[string]string `json:"existing,omitempty"`
+}
+
+// AnonymizeResponse is the Anonymize output
+type AnonymizeResponse struct {
+	Text    string  `json:"text"`
+	Matches []Match `json:"matches"`
+	Stored  bool    `json:"stored,omitempty"`
+}
+
+// rpcError is the Connect error body
+type rpcError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func toWire(matches []detector.Match) []Match {
+	out := make([]Match, len(matches))
+	for i, m := range matches {
+		out[i] = Match{
+			Original:   m.Original,
+			Token:      m.Token,
+			Category:   string(m.Category),
+			Start:      m.Start,
+			End:        m.End,
+			Confidence: m.Confidence,
+			Source:     string(m.Source),
+			Rule:       m.Rule,
+			Action:     string(m.Action),
+		}
+	}
+	return out
+}
+
+func fromWire(matches []Match) []detector.Match {
+	if len(matches) == 0 {
+		return nil
+	}
+	out := make([]detector.Match, len(matches))
+	for i, m := range matches {
+		out[i] = detector.Match{
+			Original:   m.Original,
+			Token:      m.Token,
+			Category:   pii.Category(m.Category),
+			Start:      m.Start,
+			End:        m.End,
+			Confidence: m.Confidence,
+			Source:     detector.Source(m.Source),
+			Rule:       m.Rule,
+			Action:     detector.Action(m.Action),
+			EntityID:   detector.EntityID(pii.Category(m.Category), m.Original),
+		}
+	}
+	return out
+}
@@ -0,0 +1,207 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+func newService(t *testing.T, det *detector.Detector) (*httptest.Server, *vault.Vault) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	v := vault.NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ts := httptest.NewServer(NewServer(det, v).Handler())
+	t.Cleanup(ts.Close)
+	return ts, v
+}
+
+func TestClient_RemoteRoundTrip(t *testing.T) {
+	ts, _ := newService(t, detector.New())
+
+	var sessions []string
+	inner := NewServer(detector.New(), nil).Handler()
+	spy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessions = append(sessions, r.Header.Get(SessionHeader))
+		inner.ServeHTTP(w, r)
+	}))
+	defer spy.Close()
+
+	for _, addr := range []string{ts.URL, strings.TrimPrefix(spy.URL, "http://")} {
+		c, err := NewClient(addr, detector.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := "mail alice@example.com or call 0912345678"
+		if m := c.Scan(text); len(m) != 2 || m[0].Category != pii.CatEmail {
+			t.Errorf("%s: Scan = %+v", addr, m)
+		}
+		anonymized, applied := c.AnonymizeSession(context.Background(), "sess-1", text, nil)
+		if strings.Contains(anonymized, "alice@example.com") || len(applied) != 2 {
+			t.Errorf("%s: anonymized = %q, applied = %+v", addr, anonymized, applied)
+		}
+		mapping := c.Mapping(applied)
+		if len(mapping) != 2 {
+			t.Errorf("%s: mapping = %v", addr, mapping)
+		}
+		if c.Degraded() {
+			t.Errorf("%s: client should not be degraded", addr)
+		}
+	}
+	if len(sessions) != 2 || sessions[1] != "sess-1" {
+		t.Errorf("session affinity header not sent: %v", sessions)
+	}
+}
+
+func TestClient_FallbackAndRecovery(t *testing.T) {
+	inner := NewServer(detector.New(), nil).Handler()
+	up := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			http.Error(w, `{"code":"unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		inner.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	c, _ := NewClient(ts.URL, detector.New(), WithRetryAfter(time.Minute))
+	c.now = func() time.Time { return now }
+
+	// Remote failing: detection still happens in-process
+	anonymized, applied := c.AnonymizeMatches("mail alice@example.com")
+	if anonymized != "mail [EMAIL_1]" || len(applied) != 1 {
+		t.Errorf("fallback anonymized = %q", anonymized)
+	}
+	if !c.Degraded() {
+		t.Error("client should be degraded after a failure")
+	}
+
+	// Within the retry window the remote is not contacted even if it is back
+	up = true
+	c.Scan("x")
+	if !c.Degraded() {
+		t.Error("remote should be skipped during the retry window")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if m := c.Scan("mail bob@example.com"); len(m) != 1 {
+		t.Errorf("Scan after recovery = %+v", m)
+	}
+	if c.Degraded() {
+		t.Error("client should recover once the remote answers")
+	}
+}
+
+func TestClient_Unreachable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	addr := ts.URL
+	ts.Close()
+
+	c, _ := NewClient(addr, detector.New(), WithTimeout(100*time.Millisecond))
+	if m := c.Scan("mail alice@example.com"); len(m) != 1 {
+		t.Errorf("expected in-process fallback, got %+v", m)
+	}
+}
+
+func TestClient_MappingSkipsRedacted(t *testing.T) {
+	cfg := detector.DefaultConfig()
+	cfg.Policy = map[pii.Category]detector.Action{pii.CatEmail: detector.ActionRedact}
+	ts, _ := newService(t, detector.NewWithConfig(cfg))
+
+	c, _ := NewClient(ts.URL, detector.New())
+	anonymized, applied := c.AnonymizeMatches("mail alice@example.com, call 0912345678")
+	if !strings.Contains(anonymized, "[REDACTED_EMAIL]") {
+		t.Fatalf("server policy not applied: %q", anonymized)
+	}
+	mapping := c.Mapping(applied)
+	if len(mapping) != 1 {
+		t.Errorf("redacted value should not be in the mapping: %v", mapping)
+	}
+	for _, orig := range mapping {
+		if orig == "alice@example.com" {
+			t.Error("redacted email leaked into mapping")
+		}
+	}
+}
+
+func TestServer_Store(t *testing.T) {
+	ts, v := newService(t, detector.New())
+
+	body := `{"text":"mail alice@example.com","sessionId":"sess-9","store":true}`
+	resp, err := http.Post(ts.URL+AnonymizeProcedure, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	got, err := v.Lookup(context.Background(), "sess-9", "[EMAIL_1]")
+	if err != nil || got != "alice@example.com" {
+		t.Errorf("vault lookup = %q, %v", got, err)
+	}
+
+	// A later call continues the session's numbering from the vault
+	body = `{"text":"mail bob@example.com, cc alice@example.com","sessionId":"sess-9","store":true}`
+	resp, err = http.Post(ts.URL+AnonymizeProcedure, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out AnonymizeResponse
+	json.NewDecoder(resp.Body).Decode(&out)
+	resp.Body.Close()
+	if out.Text != "mail [EMAIL_2], cc [EMAIL_1]" {
+		t.Errorf("second call = %q", out.Text)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	ts := httptest.NewServer(NewServer(detector.New(), nil).Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name, path, contentType, body string
+		want                          int
+	}{
+		{"wrong content type", ScanProcedure, "application/proto", `{}`, http.StatusUnsupportedMediaType},
+		{"invalid JSON", ScanProcedure, "application/json", `{`, http.StatusBadRequest},
+		{"store without vault", AnonymizeProcedure, "application/json", `{"text":"x","sessionId":"s","store":true}`, http.StatusBadRequest},
+		{"unknown procedure", "/" + ServiceName + "/Rehydrate", "application/json", `{}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(ts.URL+tt.path, tt.contentType, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestParseAddr(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"detector:9091":          true,
+		"http://detector:9091":   true,
+		"https://detector.local": true,
+		"":                       false,
+		"ftp://detector:9091":    false,
+	} {
+		if err := ParseAddr(addr); (err == nil) != ok {
+			t.Errorf("ParseAddr(%q) = %v, want ok=%v", addr, err, ok)
+		}
+	}
+}
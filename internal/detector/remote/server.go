@@ -0,0 +1,125 @@
+package remote
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/vault"
+)
+
+// maxRequestSize matches the proxy's request body limit plus JSON overhead
+const maxRequestSize = 12 << 20
+
+// Server exposes a detector (and optionally a vault) over the Detector service
+type Server struct {
+	detector *detector.Detector
+	vault    *vault.Vault
+}
+
+// NewServer creates the service. v may be nil, in which case Anonymize
+// requests with store set fail with failed_precondition.
+func NewServer(det *detector.Detector, v *vault.Vault) *Server {
+	return &Server{detector: det, vault: v}
+}
+
+// Handler serves the Detector procedures plus /healthz
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+ScanProcedure, s.handleScan)
+	mux.HandleFunc("POST "+AnonymizeProcedure, s.handleAnonymize)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+	return mux
+}
+
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	var req ScanRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	writeJSON(w, ScanResponse{Matches: toWire(s.detector.Scan(req.Text))})
+}
+
+func (s *Server) handleAnonymize(w http.ResponseWriter, r *http.Request) {
+	var req AnonymizeRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.SessionID == "" {
+		req.SessionID = r.Header.Get(SessionHeader)
+	}
+
+	if req.Store {
+		if s.vault == nil {
+			writeError(w, http.StatusBadRequest, "failed_precondition", "this detector has no vault")
+			return
+		}
+		if req.SessionID == "" {
+			writeError(w, http.StatusBadRequest, "invalid_argument", "sessionId is required to store mappings")
+			return
+		}
+		// Continue the session's numbering from the vault
+		if len(req.Existing) == 0 {
+			existing, err := s.vault.LookupAll(r.Context(), req.SessionID)
+			if err != nil {
+				slog.Error("detector service: vault lookup failed", "session", req.SessionID, "error", err)
+				writeError(w, http.StatusServiceUnavailable, "unavailable", "vault lookup failed")
+				return
+			}
+			req.Existing = existing
+		}
+	}
+
+	text, applied := s.detector.AnonymizeWith(req.Text, req.Existing)
+	resp := AnonymizeResponse{Text: text, Matches: toWire(applied)}
+
+	if req.Store {
+		if mapping := s.detector.Mapping(applied); len(mapping) > 0 {
+			if err := s.vault.Store(r.Context(), req.SessionID, mapping); err != nil {
+				slog.Error("detector service: vault store failed", "session", req.SessionID, "error", err)
+				writeError(w, http.StatusServiceUnavailable, "unavailable", "vault store failed")
+				return
+			}
+		}
+		resp.Stored = true
+	}
+	writeJSON(w, resp)
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		writeError(w, http.StatusUnsupportedMediaType, "unimplemented", "only application/json is supported")
+		return false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_argument", "cannot read body")
+		return false
+	}
+	if len(body) > maxRequestSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "resource_exhausted", "request too large")
+		return false
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_argument", "invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rpcError{Code: code, Message: message})
+}
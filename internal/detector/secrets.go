@@ -0,0 +1,109 @@
+package detector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// StrippedToken replaces secrets with ActionStrip, and with ActionBlock
+// where a request cannot be rejected, such as a line of a file upload
+const StrippedToken = "[SECRET REMOVED]"
+
+// SecretActions chooses the action for detected secrets. Keys are secret
+// categories, groups of them ending in "*" such as "SECRET_AWS_*", or "*"
+// for every secret; the longest matching key wins. Secrets matching no key
+// are masked. Config.Policy still takes precedence.
+type SecretActions map[string]Action
+
+// For returns the action for the secret category cat
+func (sa SecretActions) For(cat pii.Category) Action {
+	best, action := -1, ActionMask
+	for key, a := range sa {
+		prefix, group := strings.CutSuffix(key, "*")
+		if group && strings.HasPrefix(string(cat), prefix) || key == string(cat) {
+			if n := len(key); n > best {
+				best, action = n, a
+			}
+		}
+	}
+	return action
+}
+
+// Blocks reports whether any secret is blocked
+func (sa SecretActions) Blocks() bool {
+	for _, a := range sa {
+		if a == ActionBlock {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the actions, e.g. "*=mask, SECRET_AWS_*=block"
+func (sa SecretActions) String() string {
+	if len(sa) == 0 {
+		return "*=mask"
+	}
+	keys := make([]string, 0, len(sa))
+	for key := range sa {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + string(sa[key])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// BlocksSecrets reports whether the detector's policy blocks any secret,
+// so requests must be checked before they are anonymized
+func (d *Detector) BlocksSecrets() bool {
+	if d.config.Secrets.Blocks() {
+		return true
+	}
+	for cat, a := range d.config.Policy {
+		if a == ActionBlock && pii.IsSecretCategory(cat) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSecretActions parses a comma-separated list of key=action items,
+// where action is mask, block or strip. A bare action applies to every
+// secret: "block" is "*=block", and "strip,SECRET_AWS_*=block" strips
+// secrets but blocks AWS keys.
+func ParseSecretActions(raw string) (SecretActions, error) {
+	sa := make(SecretActions)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			key, value = "*", item
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		switch action := Action(strings.ToLower(strings.TrimSpace(value))); action {
+		case ActionMask, ActionBlock, ActionStrip:
+			if prefix, group := strings.CutSuffix(key, "*"); !group && !pii.IsSecretCategory(pii.Category(key)) ||
+				group && prefix != "" && !strings.HasPrefix(prefix, "SECRET_") {
+				return nil, fmt.Errorf("%q is not a secret category or SECRET_ group", key)
+			}
+			sa[key] = action
+		default:
+			return nil, fmt.Errorf("%s: invalid action %q (want mask, block or strip)", key, value)
+		}
+	}
+	return sa, nil
+}
@@ -0,0 +1,83 @@
+package detector
+
+import (
+	"math/rand"
+	"slices"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// Tier selects the patterns a scan runs
+type Tier int
+
+const (
+	TierDeep Tier = iota // every pattern
+	TierFast             // only patterns of TierConfig.FastCategories
+)
+
+// TierConfig splits detection into a fast, high-precision tier run on every
+// request and a deep tier run on a sample of requests. The zero value scans
+// nothing deep; DefaultConfig scans every request deep.
+type TierConfig struct {
+	// DeepSamplePercent is the share of requests, 0-100, that get the deep
+	// tier
+	DeepSamplePercent int
+	// FastCategories are scanned on every request. Nil means secrets, CCCD
+	// and credit cards.
+	FastCategories []pii.Category
+	// Sessions, Veil key IDs and roles whose requests always get the deep
+	// tier
+	SensitiveSessions []string
+	SensitiveKeys     []string
+	SensitiveRoles    []string
+}
+
+// DefaultDeepSamplePercent scans every request with every pattern
+const DefaultDeepSamplePercent = 100
+
+// Sampled reports whether the deep tier is always on
+func (c TierConfig) Sampled() bool {
+	return c.DeepSamplePercent < 100
+}
+
+// Sensitive reports whether a request always gets the deep tier
+func (c TierConfig) Sensitive(sessionID, keyID, role string) bool {
+	return slices.Contains(c.SensitiveSessions, sessionID) ||
+		keyID != "" && slices.Contains(c.SensitiveKeys, keyID) ||
+		role != "" && slices.Contains(c.SensitiveRoles, role)
+}
+
+// Sample draws whether a request gets the deep tier
+func (c TierConfig) Sample() bool {
+	return c.DeepSamplePercent >= 100 || c.DeepSamplePercent > 0 && rand.Intn(100) < c.DeepSamplePercent
+}
+
+// IsFast reports whether cat is scanned by the fast tier
+func (c TierConfig) IsFast(cat pii.Category) bool {
+	if c.FastCategories == nil {
+		return pii.IsSecretCategory(cat) || cat == pii.CatCCCD || cat == pii.CatCreditCard
+	}
+	return slices.Contains(c.FastCategories, cat)
+}
+
+// DeepOnly returns the categories among matches that the fast tier does
+// not scan, each once in order of appearance
+func (c TierConfig) DeepOnly(matches []Match) []pii.Category {
+	var cats []pii.Category
+	for _, m := range matches {
+		if !c.IsFast(m.Category) && !slices.Contains(cats, m.Category) {
+			cats = append(cats, m.Category)
+		}
+	}
+	return cats
+}
+
+// Tiers returns the detector's tier configuration
+func (d *Detector) Tiers() TierConfig {
+	return d.config.Tiers
+}
+
+// AnonymizeTier is AnonymizeWith restricted to the patterns of tier
+func (d *Detector) AnonymizeTier(text string, existing map[string]string, tier Tier) (string, []Match) {
+	return d.anonymize(text, newTokenizer(existing), tier, nil)
+}
@@ -0,0 +1,93 @@
+package detector
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// NeutralizedToken replaces token-shaped strings found in the text a client
+// sent, see NeutralizeTokens
+const NeutralizedToken = "[TOKEN REMOVED]"
+
+// tokenPattern matches the tokens Anonymize writes, capturing the prefix:
+// numbered ones such as [CCCD_1] and pseudonyms such as [EMAIL_k7x2m3qa] or
+// [PHONE_k7x2m3qa:5678]. RedactedToken and StrippedToken never rehydrate
+// and do not match.
+var tokenPattern = regexp.MustCompile(`\[([A-Z][A-Z0-9_]*)_(?:[1-9][0-9]*|[a-z2-7]+(?::[^\]\s]{1,32})?)\]`)
+
+// builtinPrefixes is the set of pii.TokenPrefix values
+var builtinPrefixes = sync.OnceValue(func() map[string]bool {
+	set := make(map[string]bool, len(pii.TokenPrefix))
+	for _, prefix := range pii.TokenPrefix {
+		set[prefix] = true
+	}
+	return set
+})
+
+// NeutralizeTokens replaces every string of text that has the form of a
+// token with NeutralizedToken and returns the distinct tokens replaced. Only
+// built-in prefixes and the prefixes of the session's tokens in existing
+// count, so bracketed text such as [TODO_later] is left alone.
+//
+// Called before anonymizing, it keeps tokens a client wrote itself from
+// reaching the model, so an echo of one can't be rehydrated into whatever
+// value the token maps to in the session.
+func NeutralizeTokens(text string, existing map[string]string) (string, []string) {
+	if !strings.Contains(text, "[") {
+		return text, nil
+	}
+	known := knownPrefix(existing)
+
+	var found []string
+	out := tokenPattern.ReplaceAllStringFunc(text, func(token string) string {
+		if !known(tokenPattern.FindStringSubmatch(token)[1]) {
+			return token
+		}
+		if !slices.Contains(found, token) {
+			found = append(found, token)
+		}
+		return NeutralizedToken
+	})
+	return out, found
+}
+
+// TokenSpans returns the byte offsets, start and end, of the strings
+// NeutralizeTokens replaces in text, in order
+func TokenSpans(text string, existing map[string]string) [][2]int {
+	if !strings.Contains(text, "[") {
+		return nil
+	}
+	known := knownPrefix(existing)
+
+	var spans [][2]int
+	for _, m := range tokenPattern.FindAllStringSubmatchIndex(text, -1) {
+		if known(text[m[2]:m[3]]) {
+			spans = append(spans, [2]int{m[0], m[1]})
+		}
+	}
+	return spans
+}
+
+// knownPrefix reports whether a token prefix is built in or used by one of
+// the session's tokens in existing, which are only parsed when needed
+func knownPrefix(existing map[string]string) func(string) bool {
+	var sessionPrefixes map[string]bool
+	return func(prefix string) bool {
+		if builtinPrefixes()[prefix] {
+			return true
+		}
+		if sessionPrefixes == nil {
+			sessionPrefixes = make(map[string]bool)
+			for token := range existing {
+				if m := tokenPattern.FindStringSubmatch(token); m != nil {
+					sessionPrefixes[m[1]] = true
+				}
+			}
+		}
+		return sessionPrefixes[prefix]
+	}
+}
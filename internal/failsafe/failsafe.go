@@ -0,0 +1,300 @@
+// Package failsafe decides what happens to a request when a protection
+// component fails while handling it: the detector, the vault, the prompt
+// guard, its canary store or the guardrail.
+//
+// In open mode the request goes on with whatever protection is left and the
+// response carries X-Veil-Degraded naming the failed components. In closed
+// mode it is answered with 503 and never forwarded; a failure after the
+// upstream answered, such as the vault lookup for rehydration, replaces the
+// response with the 503. In either mode every failure is logged, counted
+// and sent as a protection.failure webhook event.
+//
+// The policy reaches components through the request context, like
+// annotations: components call Report, Protect and Allowed with the
+// request's context, and requests outside Middleware fail open with a log
+// line only.
+package failsafe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// Mode is what a request does when a protection component fails
+type Mode string
+
+const (
+	// Open forwards with best effort and flags the response
+	Open Mode = "open"
+	// Closed answers 503 and never forwards
+	Closed Mode = "closed"
+)
+
+// DefaultMode keeps serving when a component fails, as before modes existed
+const DefaultMode = Open
+
+// ParseMode parses a VEIL_FAILURE_MODE value; empty is DefaultMode
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return DefaultMode, nil
+	case Open, Closed:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid failure mode %q (want open or closed)", s)
+}
+
+// Protection components, as named in the header, events and counters
+const (
+	Detector    = "detector"
+	Vault       = "vault"
+	PromptGuard = "promptguard"
+	Canary      = "canary"
+	Guardrail   = "guardrail"
+)
+
+// Header lists the failed components on responses served despite them
+const Header = "X-Veil-Degraded"
+
+// ErrUnavailable is returned to a ReverseProxy in place of forwarding, or of
+// a response, that the policy refuses. Error handlers answer it with Deny.
+var ErrUnavailable = errors.New("protection unavailable")
+
+// Deny answers a request refused by the policy
+func Deny(w http.ResponseWriter) {
+	http.Error(w, `{"error":"protection_unavailable","message":"a protection component failed and the failure mode is closed"}`, http.StatusServiceUnavailable)
+}
+
+// Stats counts failures by component
+type Stats struct {
+	Mode     Mode              `json:"mode"`
+	Failures map[string]uint64 `json:"failures"`
+	Denied   uint64            `json:"denied"`
+}
+
+// Policy applies a Mode to the requests served through its Middleware
+type Policy struct {
+	mode    Mode
+	webhook *webhook.Dispatcher
+
+	mu       sync.Mutex
+	failures map[string]uint64
+	denied   uint64
+}
+
+// New creates a Policy; an empty mode is DefaultMode. Failures are sent to
+// wh when it is not nil.
+func New(mode Mode, wh *webhook.Dispatcher) *Policy {
+	if mode == "" {
+		mode = DefaultMode
+	}
+	return &Policy{mode: mode, webhook: wh, failures: make(map[string]uint64)}
+}
+
+// Mode returns the policy's mode
+func (p *Policy) Mode() Mode {
+	return p.mode
+}
+
+// Stats returns the failures counted so far
+func (p *Policy) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := Stats{Mode: p.mode, Failures: make(map[string]uint64, len(p.failures)), Denied: p.denied}
+	for c, n := range p.failures {
+		st.Failures[c] = n
+	}
+	return st
+}
+
+// record holds the components that failed while serving one request
+type record struct {
+	policy *Policy
+	mu     sync.Mutex
+	failed []string
+	denied bool
+}
+
+type recordKey struct{}
+
+func from(ctx context.Context) *record {
+	rec, _ := ctx.Value(recordKey{}).(*record)
+	return rec
+}
+
+// Middleware tracks the failures of each request so components can apply
+// the policy, and sets Header on responses to requests that had any. It must
+// wrap every component that reports failures.
+func (p *Policy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &record{policy: p}
+		next.ServeHTTP(&writer{ResponseWriter: w, rec: rec}, r.WithContext(context.WithValue(r.Context(), recordKey{}, rec)))
+	})
+}
+
+// Report records that component failed with err while serving the request
+// of ctx: it is logged, counted and sent to webhooks, and under Closed the
+// request is no longer Allowed
+func Report(ctx context.Context, component, sessionID string, err error) {
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// The client went away: the component didn't fail
+		slog.Debug("failsafe: "+component+" call canceled", "session", sessionID)
+		return
+	}
+	rec := from(ctx)
+	if rec == nil {
+		slog.Error("failsafe: "+component+" failed", "session", sessionID, "error", err)
+		return
+	}
+	p := rec.policy
+	slog.Error("failsafe: "+component+" failed", "mode", p.mode, "session", sessionID, "error", err)
+
+	p.mu.Lock()
+	p.failures[component]++
+	p.mu.Unlock()
+
+	rec.mu.Lock()
+	known := false
+	for _, c := range rec.failed {
+		known = known || c == component
+	}
+	if !known {
+		rec.failed = append(rec.failed, component)
+	}
+	rec.mu.Unlock()
+
+	if p.webhook != nil {
+		p.webhook.Emit(webhook.Event{
+			Type:      webhook.EventProtectionFailure,
+			SessionID: sessionID,
+			Data:      map[string]any{"component": component, "mode": string(p.mode), "error": err.Error()},
+		})
+	}
+}
+
+// Protect runs fn, reporting a panic in it as a failure of component. It
+// reports whether fn returned normally.
+func Protect(ctx context.Context, component, sessionID string, fn func()) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			Report(ctx, component, sessionID, fmt.Errorf("panic: %v", v))
+			ok = false
+		}
+	}()
+	fn()
+	return true
+}
+
+// Allowed reports whether the request of ctx may still be forwarded or
+// answered: false once a component failed under Closed
+func Allowed(ctx context.Context) bool {
+	rec := from(ctx)
+	if rec == nil || rec.policy.mode != Closed {
+		return true
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.failed) == 0 {
+		return true
+	}
+	if !rec.denied {
+		rec.denied = true
+		rec.policy.mu.Lock()
+		rec.policy.denied++
+		rec.policy.mu.Unlock()
+	}
+	return false
+}
+
+// Err returns ErrUnavailable when the request of ctx is no longer Allowed
+func Err(ctx context.Context) error {
+	if !Allowed(ctx) {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// Failed returns the components that failed while serving the request of
+// ctx, sorted
+func Failed(ctx context.Context) []string {
+	rec := from(ctx)
+	if rec == nil {
+		return nil
+	}
+	return rec.components()
+}
+
+func (rec *record) components() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	failed := append([]string(nil), rec.failed...)
+	sort.Strings(failed)
+	return failed
+}
+
+// Transport refuses to forward requests the policy no longer allows,
+// returning ErrUnavailable instead of calling next
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return roundTripper{next}
+}
+
+type roundTripper struct{ next http.RoundTripper }
+
+func (t roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !Allowed(req.Context()) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, ErrUnavailable
+	}
+	return t.next.RoundTrip(req)
+}
+
+// writer sets Header when the response starts after a failure
+type writer struct {
+	http.ResponseWriter
+	rec         *record
+	wroteHeader bool
+}
+
+func (fw *writer) WriteHeader(code int) {
+	if !fw.wroteHeader {
+		fw.wroteHeader = true
+		if failed := fw.rec.components(); len(failed) > 0 {
+			fw.Header().Set(Header, strings.Join(failed, ", "))
+		}
+	}
+	fw.ResponseWriter.WriteHeader(code)
+}
+
+func (fw *writer) Write(b []byte) (int, error) {
+	if !fw.wroteHeader {
+		fw.WriteHeader(http.StatusOK)
+	}
+	return fw.ResponseWriter.Write(b)
+}
+
+func (fw *writer) Flush() {
+	if !fw.wroteHeader {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := fw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (fw *writer) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
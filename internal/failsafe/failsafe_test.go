@@ -0,0 +1,140 @@
+package failsafe
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// hookServer collects the webhook events sent to it
+func hookServer(t *testing.T) (*webhook.Dispatcher, func() []webhook.Event) {
+	t.Helper()
+	var mu sync.Mutex
+	var events []webhook.Event
+	hooks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+	t.Cleanup(hooks.Close)
+	cfg := webhook.DefaultConfig()
+	cfg.RetryCount = 0
+	cfg.Destinations = []webhook.Destination{{Name: "ops", URL: hooks.URL, Enabled: true, Events: []webhook.EventType{webhook.EventProtectionFailure}}}
+	wh := webhook.NewDispatcher(cfg)
+	return wh, func() []webhook.Event {
+		wh.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		return events
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]Mode{"": Open, "open": Open, " Closed ": Closed} {
+		if got, err := ParseMode(in); err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseMode("strict"); err == nil {
+		t.Error("ParseMode(strict) accepted")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	for _, mode := range []Mode{Open, Closed} {
+		t.Run(string(mode), func(t *testing.T) {
+			wh, events := hookServer(t)
+			p := New(mode, wh)
+			var forwarded bool
+			upstream := roundTripFunc(func(*http.Request) (*http.Response, error) {
+				forwarded = true
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})
+			h := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Report(r.Context(), Vault, "s1", errors.New("connection refused"))
+				Protect(r.Context(), Detector, "s1", func() { panic("index out of range") })
+				Report(r.Context(), Vault, "s1", errors.New("connection refused"))
+				req := httptest.NewRequest(http.MethodPost, "http://upstream/v1/chat", strings.NewReader("{}")).WithContext(r.Context())
+				if _, err := Transport(upstream).RoundTrip(req); err != nil {
+					if !errors.Is(err, ErrUnavailable) {
+						t.Errorf("transport error = %v", err)
+					}
+					Deny(w)
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat", nil))
+			if got := rec.Header().Get(Header); got != "detector, vault" {
+				t.Errorf("%s = %q", Header, got)
+			}
+			if mode == Closed {
+				if forwarded || rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "protection_unavailable") {
+					t.Errorf("closed: forwarded = %v, status %d: %s", forwarded, rec.Code, rec.Body)
+				}
+			} else if !forwarded || rec.Code != http.StatusOK {
+				t.Errorf("open: forwarded = %v, status %d", forwarded, rec.Code)
+			}
+
+			st := p.Stats()
+			if st.Mode != mode || st.Failures[Vault] != 2 || st.Failures[Detector] != 1 {
+				t.Errorf("stats = %+v", st)
+			}
+			if wantDenied := map[Mode]uint64{Open: 0, Closed: 1}[mode]; st.Denied != wantDenied {
+				t.Errorf("denied = %d, want %d", st.Denied, wantDenied)
+			}
+			got := events()
+			if len(got) != 3 {
+				t.Fatalf("expected an event per failure, got %+v", got)
+			}
+			data, _ := got[1].Data.(map[string]any)
+			if got[1].Type != webhook.EventProtectionFailure || got[1].SessionID != "s1" ||
+				data["component"] != Detector || data["mode"] != string(mode) || !strings.Contains(data["error"].(string), "index out of range") {
+				t.Errorf("event = %+v", got[1])
+			}
+		})
+	}
+}
+
+func TestNoPolicy(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	Report(r.Context(), Vault, "s1", errors.New("down"))
+	if !Allowed(r.Context()) || Err(r.Context()) != nil || Failed(r.Context()) != nil {
+		t.Error("a request outside Middleware must fail open")
+	}
+	if Protect(r.Context(), Guardrail, "s1", func() { panic("boom") }) {
+		t.Error("Protect reported a panic as success")
+	}
+}
+
+func TestMiddleware_NoFailure(t *testing.T) {
+	p := New(Closed, nil)
+	rec := httptest.NewRecorder()
+	p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Allowed(r.Context()) {
+			t.Error("request without failures refused")
+		}
+		io.WriteString(w, "ok")
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get(Header) != "" || rec.Body.String() != "ok" {
+		t.Errorf("response = %v %s", rec.Header(), rec.Body)
+	}
+	if st := p.Stats(); len(st.Failures) != 0 || st.Denied != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,345 @@
+// Package feedback collects verdicts on detections, so the patterns that
+// flag too much can be found and tuned.
+//
+// A report names a detection by its entity ID (see detector.EntityID),
+// never by its value. Counts are kept per category and pattern. With
+// suppression on, a value that enough independent reporters call a false
+// positive is left alone at scan time; the suppression list holds keyed
+// pseudonyms of entity IDs, not the IDs themselves.
+package feedback
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/internal/detector"
+)
+
+// Verdicts
+const (
+	FalsePositive = "false_positive"
+	TruePositive  = "true_positive"
+)
+
+// Limits on report fields
+const (
+	MaxNoteLength = 500
+	maxRuleLength = 128
+	// notesKept is the number of recent notes kept per pattern
+	notesKept = 20
+)
+
+const (
+	countsKey     = "feedback:counts"
+	notesPrefix   = "feedback:notes:"
+	reportersKey  = "feedback:reporters:"
+	suppressedKey = "feedback:suppressed"
+)
+
+var (
+	entityIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+	categoryPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,63}$`)
+)
+
+// Config controls suppression
+type Config struct {
+	// SuppressAfter is the number of independent false-positive reports
+	// after which a value is suppressed. Zero disables suppression.
+	SuppressAfter int
+	// Key is the HMAC key of the pseudonyms in the suppression list. It is
+	// required when SuppressAfter is set.
+	Key []byte
+	// Redact is applied to notes before they are stored, as notes are free
+	// text and may quote the value. Nil stores them as sent.
+	Redact func(string) string
+}
+
+// DetectionReport is one verdict on a detection
+type DetectionReport struct {
+	EntityID string `json:"entity_id"`
+	Category string `json:"category"`
+	Verdict  string `json:"verdict"` // false_positive or true_positive
+	Note     string `json:"note,omitempty"`
+	// Source and Rule name the pattern that matched, as reported by /scan;
+	// without them the report counts for the category only
+	Source string `json:"source,omitempty"`
+	Rule   string `json:"rule,omitempty"`
+}
+
+// Validate checks the report's fields
+func (r DetectionReport) Validate() error {
+	switch {
+	case !entityIDPattern.MatchString(r.EntityID):
+		return errors.New("entity_id must be the 16 hex characters reported with the detection")
+	case !categoryPattern.MatchString(r.Category):
+		return errors.New("category must be a detection category such as EMAIL")
+	case r.Verdict != FalsePositive && r.Verdict != TruePositive:
+		return fmt.Errorf("verdict must be %s or %s", FalsePositive, TruePositive)
+	case len(r.Note) > MaxNoteLength:
+		return fmt.Errorf("note is longer than %d bytes", MaxNoteLength)
+	}
+	switch detector.Source(r.Source) {
+	case "", detector.SourceBuiltin, detector.SourceBundle, detector.SourceCustom:
+	default:
+		return fmt.Errorf("source must be %s, %s or %s", detector.SourceBuiltin, detector.SourceBundle, detector.SourceCustom)
+	}
+	if len(r.Rule) > maxRuleLength || strings.Contains(r.Rule, "|") {
+		return fmt.Errorf("rule must be a pattern label of at most %d characters", maxRuleLength)
+	}
+	return nil
+}
+
+// pattern identifies the counters of a report
+func (r DetectionReport) pattern() string {
+	return r.Category + "|" + r.Source + "|" + r.Rule
+}
+
+// Receipt is the result of recording a report
+type Receipt struct {
+	// Reports is the number of independent false-positive reports on the
+	// value, counted only when suppression is on
+	Reports    int  `json:"reports,omitempty"`
+	Suppressed bool `json:"suppressed"`
+}
+
+// Collector records reports in Redis and answers whether a value is
+// suppressed, from a copy of the suppression list kept in memory
+type Collector struct {
+	client redis.UniversalClient
+	config Config
+
+	mu         sync.RWMutex
+	suppressed map[string]bool
+}
+
+// New creates a Collector
+func New(client redis.UniversalClient, cfg Config) (*Collector, error) {
+	if cfg.SuppressAfter < 0 {
+		return nil, errors.New("feedback: SuppressAfter must not be negative")
+	}
+	if cfg.SuppressAfter > 0 && len(cfg.Key) < 32 {
+		return nil, errors.New("feedback: suppression needs a key of at least 32 bytes")
+	}
+	return &Collector{client: client, config: cfg, suppressed: make(map[string]bool)}, nil
+}
+
+// pseudonym is the keyed digest of an entity ID kept in the suppression list
+func (c *Collector) pseudonym(entityID string) string {
+	mac := hmac.New(sha256.New, c.config.Key)
+	mac.Write([]byte(entityID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Record stores a report made by reporter, an identifier of whoever sent
+// it such as a key ID or client address. Only its hash is stored.
+//
+// A false positive adds reporter to the value's reporters and suppresses
+// the value once there are SuppressAfter of them. A true positive lifts a
+// suppression and forgets the reporters: a value someone confirms as real
+// is flagged again.
+func (c *Collector) Record(ctx context.Context, r DetectionReport, reporter string) (Receipt, error) {
+	if err := r.Validate(); err != nil {
+		return Receipt{}, err
+	}
+	note := r.Note
+	if note != "" && c.config.Redact != nil {
+		note = c.config.Redact(note)
+	}
+
+	pipe := c.client.TxPipeline()
+	pipe.HIncrBy(ctx, countsKey, r.pattern()+"|"+r.Verdict, 1)
+	if note != "" {
+		key := notesPrefix + r.pattern()
+		pipe.LPush(ctx, key, note)
+		pipe.LTrim(ctx, key, 0, notesKept-1)
+	}
+	if c.config.SuppressAfter == 0 {
+		_, err := pipe.Exec(ctx)
+		return Receipt{}, err
+	}
+
+	pseudonym := c.pseudonym(r.EntityID)
+	reporters := reportersKey + pseudonym
+	if r.Verdict == TruePositive {
+		pipe.Del(ctx, reporters)
+		pipe.SRem(ctx, suppressedKey, pseudonym)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return Receipt{}, err
+		}
+		c.mu.Lock()
+		delete(c.suppressed, pseudonym)
+		c.mu.Unlock()
+		return Receipt{}, nil
+	}
+
+	sum := sha256.Sum256([]byte(reporter))
+	pipe.SAdd(ctx, reporters, hex.EncodeToString(sum[:]))
+	count := pipe.SCard(ctx, reporters)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Receipt{}, err
+	}
+	receipt := Receipt{Reports: int(count.Val())}
+	if receipt.Reports >= c.config.SuppressAfter {
+		if err := c.client.SAdd(ctx, suppressedKey, pseudonym).Err(); err != nil {
+			return receipt, err
+		}
+		c.mu.Lock()
+		c.suppressed[pseudonym] = true
+		c.mu.Unlock()
+		receipt.Suppressed = true
+	}
+	return receipt, nil
+}
+
+// Suppressed reports whether the value with entityID is suppressed. It
+// implements detector.Suppressor.
+func (c *Collector) Suppressed(entityID string) bool {
+	c.mu.RLock()
+	empty := len(c.suppressed) == 0
+	c.mu.RUnlock()
+	if empty {
+		return false
+	}
+	pseudonym := c.pseudonym(entityID)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.suppressed[pseudonym]
+}
+
+// Refresh reloads the suppression list, picking up reports made on other
+// replicas
+func (c *Collector) Refresh(ctx context.Context) error {
+	if c.config.SuppressAfter == 0 {
+		return nil
+	}
+	members, err := c.client.SMembers(ctx, suppressedKey).Result()
+	if err != nil {
+		return err
+	}
+	suppressed := make(map[string]bool, len(members))
+	for _, m := range members {
+		suppressed[m] = true
+	}
+	c.mu.Lock()
+	c.suppressed = suppressed
+	c.mu.Unlock()
+	return nil
+}
+
+// StartRefresh refreshes the suppression list now and every interval
+// until ctx is done
+func (c *Collector) StartRefresh(ctx context.Context, interval time.Duration) {
+	if err := c.Refresh(ctx); err != nil {
+		slog.Warn("feedback: loading suppression list failed", "error", err)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.Refresh(ctx); err != nil {
+					slog.Warn("feedback: refreshing suppression list failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// PatternSummary is the feedback on one pattern. Reports that named no
+// pattern are grouped under their category with an empty Source and Rule.
+type PatternSummary struct {
+	Category       string `json:"category"`
+	Source         string `json:"source,omitempty"`
+	Rule           string `json:"rule,omitempty"`
+	FalsePositives int64  `json:"false_positives"`
+	TruePositives  int64  `json:"true_positives"`
+	// FalsePositiveRate is FalsePositives over all reports
+	FalsePositiveRate float64  `json:"false_positive_rate"`
+	Notes             []string `json:"notes,omitempty"` // most recent first
+}
+
+// Summary is the JSON body of GET /admin/feedback/summary
+type Summary struct {
+	// Patterns are sorted by false-positive rate, then by report count
+	Patterns      []PatternSummary `json:"patterns"`
+	SuppressAfter int              `json:"suppress_after,omitempty"`
+	Suppressed    int64            `json:"suppressed"` // values on the suppression list
+}
+
+// Summary aggregates the recorded reports
+func (c *Collector) Summary(ctx context.Context) (Summary, error) {
+	counts, err := c.client.HGetAll(ctx, countsKey).Result()
+	if err != nil {
+		return Summary{}, err
+	}
+	byPattern := make(map[string]*PatternSummary)
+	for field, v := range counts {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		parts := strings.SplitN(field, "|", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		key := strings.Join(parts[:3], "|")
+		p, ok := byPattern[key]
+		if !ok {
+			p = &PatternSummary{Category: parts[0], Source: parts[1], Rule: parts[2]}
+			byPattern[key] = p
+		}
+		switch parts[3] {
+		case FalsePositive:
+			p.FalsePositives += n
+		case TruePositive:
+			p.TruePositives += n
+		}
+	}
+
+	summary := Summary{Patterns: make([]PatternSummary, 0, len(byPattern)), SuppressAfter: c.config.SuppressAfter}
+	pipe := c.client.Pipeline()
+	notes := make(map[string]*redis.StringSliceCmd, len(byPattern))
+	for key := range byPattern {
+		notes[key] = pipe.LRange(ctx, notesPrefix+key, 0, -1)
+	}
+	suppressed := pipe.SCard(ctx, suppressedKey)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return Summary{}, err
+	}
+	summary.Suppressed = suppressed.Val()
+
+	for key, p := range byPattern {
+		if total := p.FalsePositives + p.TruePositives; total > 0 {
+			p.FalsePositiveRate = float64(p.FalsePositives) / float64(total)
+		}
+		p.Notes = notes[key].Val()
+		summary.Patterns = append(summary.Patterns, *p)
+	}
+	sort.Slice(summary.Patterns, func(i, j int) bool {
+		a, b := summary.Patterns[i], summary.Patterns[j]
+		if a.FalsePositiveRate != b.FalsePositiveRate {
+			return a.FalsePositiveRate > b.FalsePositiveRate
+		}
+		if at, bt := a.FalsePositives+a.TruePositives, b.FalsePositives+b.TruePositives; at != bt {
+			return at > bt
+		}
+		return a.Category+"|"+a.Source+"|"+a.Rule < b.Category+"|"+b.Source+"|"+b.Rule
+	})
+	return summary, nil
+}
@@ -0,0 +1,198 @@
+package feedback
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestCollector(t *testing.T, cfg Config) (*Collector, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	c, err := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, mr
+}
+
+func TestDetectionReport_Validate(t *testing.T) {
+	ok := DetectionReport{EntityID: "0123456789abcdef", Category: "EMAIL", Verdict: FalsePositive}
+	if err := ok.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		change func(*DetectionReport)
+	}{
+		{"value instead of ID", func(r *DetectionReport) { r.EntityID = "alice@example.com" }},
+		{"lower-case category", func(r *DetectionReport) { r.Category = "email" }},
+		{"unknown verdict", func(r *DetectionReport) { r.Verdict = "maybe" }},
+		{"long note", func(r *DetectionReport) { r.Note = strings.Repeat("x", MaxNoteLength+1) }},
+		{"unknown source", func(r *DetectionReport) { r.Source = "vendor" }},
+		{"separator in rule", func(r *DetectionReport) { r.Rule = "a|b" }},
+	}
+	for _, tt := range tests {
+		r := ok
+		tt.change(&r)
+		if err := r.Validate(); err == nil {
+			t.Errorf("%s: want an error", tt.name)
+		}
+	}
+}
+
+func TestRecord_SuppressesAfterIndependentReports(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestCollector(t, Config{SuppressAfter: 2, Key: testKey})
+	id := detector.EntityID(pii.CatEmail, "noreply@example.com")
+	fp := DetectionReport{EntityID: id, Category: "EMAIL", Verdict: FalsePositive}
+
+	for i, reporter := range []string{"key:a", "key:a"} {
+		receipt, err := c.Record(ctx, fp, reporter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipt.Reports != 1 || receipt.Suppressed || c.Suppressed(id) {
+			t.Fatalf("report %d from the same reporter: %+v", i, receipt)
+		}
+	}
+	receipt, err := c.Record(ctx, fp, "key:b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Reports != 2 || !receipt.Suppressed || !c.Suppressed(id) {
+		t.Fatalf("second reporter should suppress: %+v", receipt)
+	}
+
+	// Only keyed digests are stored, never the entity ID or the reporters
+	for _, key := range mr.Keys() {
+		if strings.Contains(key, id) || strings.Contains(key, "key:a") {
+			t.Errorf("redis key %q exposes a report field", key)
+		}
+	}
+	if members, _ := mr.Members(suppressedKey); len(members) != 1 || members[0] == id {
+		t.Errorf("suppression list = %v", members)
+	}
+
+	// Another replica picks the suppression up on refresh
+	other, err := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), Config{SuppressAfter: 2, Key: testKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Refresh(ctx); err != nil || !other.Suppressed(id) {
+		t.Errorf("refreshed replica: suppressed %v, err %v", other.Suppressed(id), err)
+	}
+
+	// Confirming the value as real lifts the suppression
+	tp := fp
+	tp.Verdict = TruePositive
+	if _, err := c.Record(ctx, tp, "key:c"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Suppressed(id) {
+		t.Error("a true positive should lift the suppression")
+	}
+	if receipt, _ := c.Record(ctx, fp, "key:a"); receipt.Reports != 1 || receipt.Suppressed {
+		t.Errorf("reporters should start over: %+v", receipt)
+	}
+}
+
+func TestRecord_SuppressionOff(t *testing.T) {
+	c, mr := newTestCollector(t, Config{})
+	id := detector.EntityID(pii.CatEmail, "noreply@example.com")
+	for _, reporter := range []string{"a", "b", "c"} {
+		if _, err := c.Record(context.Background(), DetectionReport{EntityID: id, Category: "EMAIL", Verdict: FalsePositive}, reporter); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Suppressed(id) || mr.Exists(suppressedKey) {
+		t.Error("nothing should be suppressed without SuppressAfter")
+	}
+	if _, err := New(nil, Config{SuppressAfter: 3}); err == nil {
+		t.Error("suppression without a key should be rejected")
+	}
+}
+
+func TestSummary_RatesPerPattern(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCollector(t, Config{Redact: func(s string) string {
+		return strings.ReplaceAll(s, "0901234567", "[PHONE_1]")
+	}})
+	id := "0123456789abcdef"
+	reports := []DetectionReport{
+		{EntityID: id, Category: "PHONE", Source: "builtin", Rule: "Số điện thoại", Verdict: FalsePositive, Note: "order number 0901234567"},
+		{EntityID: id, Category: "PHONE", Source: "builtin", Rule: "Số điện thoại", Verdict: FalsePositive},
+		{EntityID: id, Category: "PHONE", Source: "builtin", Rule: "Số điện thoại", Verdict: TruePositive},
+		{EntityID: id, Category: "EMAIL", Source: "builtin", Rule: "Email", Verdict: TruePositive},
+		{EntityID: id, Category: "EMAIL", Verdict: FalsePositive},
+	}
+	for _, r := range reports {
+		if _, err := c.Record(ctx, r, "key:a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := c.Summary(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Patterns) != 3 {
+		t.Fatalf("patterns = %+v", summary.Patterns)
+	}
+	first, second, last := summary.Patterns[0], summary.Patterns[1], summary.Patterns[2]
+	if first.Category != "EMAIL" || first.Rule != "" || first.FalsePositiveRate != 1 {
+		t.Errorf("first = %+v, want the category-only EMAIL reports", first)
+	}
+	if second.Rule != "Số điện thoại" || second.FalsePositives != 2 || second.TruePositives != 1 {
+		t.Errorf("second = %+v", second)
+	}
+	if len(second.Notes) != 1 || second.Notes[0] != "order number [PHONE_1]" {
+		t.Errorf("notes should be redacted: %v", second.Notes)
+	}
+	if last.Rule != "Email" || last.FalsePositiveRate != 0 {
+		t.Errorf("last = %+v", last)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c, _ := newTestCollector(t, Config{SuppressAfter: 1, Key: testKey})
+	h := c.Handler()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/feedback/detection", strings.NewReader(body))
+		req.Header.Set("X-Veil-Key-ID", "k1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(`{"entity_id":"alice@example.com","category":"EMAIL","verdict":"false_positive"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("value as entity_id: status %d", w.Code)
+	}
+	if w := post(`{`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid JSON: status %d", w.Code)
+	}
+	w := post(`{"entity_id":"0123456789abcdef","category":"EMAIL","verdict":"false_positive"}`)
+	var receipt Receipt
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &receipt) != nil || !receipt.Suppressed {
+		t.Errorf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	sw := httptest.NewRecorder()
+	c.SummaryHandler().ServeHTTP(sw, httptest.NewRequest(http.MethodGet, "/admin/feedback/summary", nil))
+	var summary Summary
+	if err := json.Unmarshal(sw.Body.Bytes(), &summary); err != nil || summary.Suppressed != 1 || len(summary.Patterns) != 1 {
+		t.Errorf("summary = %s", sw.Body.String())
+	}
+}
@@ -0,0 +1,67 @@
+package feedback
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// maxBody bounds a report; the note is the only free-text field
+const maxBody = 4 << 10
+
+// Handler serves POST /feedback/detection. Reports are attributed to the
+// caller's Veil key when it has one, else to its address, so that
+// suppression counts independent reporters.
+func (c *Collector) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		if err != nil || len(body) > maxBody {
+			http.Error(w, `{"error":"bad_request","message":"cannot read body"}`, http.StatusBadRequest)
+			return
+		}
+		var report DetectionReport
+		if err := json.Unmarshal(body, &report); err != nil {
+			http.Error(w, `{"error":"bad_request","message":"invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		if err := report.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"bad_request","message":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		receipt, err := c.Record(r.Context(), report, reporterOf(r))
+		if err != nil {
+			http.Error(w, `{"error":"feedback_unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(receipt)
+	}
+}
+
+// SummaryHandler serves GET /admin/feedback/summary
+func (c *Collector) SummaryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		summary, err := c.Summary(r.Context())
+		if err != nil {
+			http.Error(w, `{"error":"feedback_unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+	}
+}
+
+// reporterOf identifies the sender of a report
+func reporterOf(r *http.Request) string {
+	if id := r.Header.Get("X-Veil-Key-ID"); id != "" {
+		return "key:" + id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
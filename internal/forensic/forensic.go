@@ -0,0 +1,261 @@
+// Package forensic records exactly how the proxy transformed a request, so
+// that after an incident an investigator holding the original body (from
+// the client's own logs) can reconstruct what the upstream received.
+//
+// A Record carries offsets, categories, actions, tokens and SHA-256
+// hashes, never the values that were replaced. Masked spans keep no token
+// either: the partial mask is part of the value and is recomputed on
+// replay.
+package forensic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// Edit actions besides the detector's (tokenize, redact, mask, strip)
+const (
+	ActionNeutralize = "neutralize" // a client-supplied token, see detector.NeutralizeTokens
+	ActionMask       = "mask"
+)
+
+// Header actions
+const (
+	HeaderRemoved    = "removed"    // denied by the header policy
+	HeaderStripped   = "stripped"   // carried a secret
+	HeaderAnonymized = "anonymized" // PII replaced with tokens
+)
+
+// Edit replaces the bytes [Start, End) of the original body with Token
+type Edit struct {
+	Start    int          `json:"start"`
+	End      int          `json:"end"`
+	Category pii.Category `json:"category,omitempty"`
+	Action   string       `json:"action"`
+	Token    string       `json:"token,omitempty"` // empty for masks
+	// Field is the JSON path of a redacted request field; its Action is
+	// the field policy's (remove, hash, constant)
+	Field string `json:"field,omitempty"`
+}
+
+// HeaderChange is a request header the proxy changed before forwarding
+type HeaderChange struct {
+	Name       string         `json:"name"`
+	Action     string         `json:"action"`
+	Categories []pii.Category `json:"categories,omitempty"`
+}
+
+// Substitution counts how often a token was rehydrated in the response
+type Substitution struct {
+	Token string `json:"token"`
+	Count int    `json:"count"`
+}
+
+// Record is the transformation applied to one request
+type Record struct {
+	mu sync.Mutex
+
+	BodySHA256Before string `json:"body_sha256_before,omitempty"`
+	BodySHA256After  string `json:"body_sha256_after,omitempty"`
+	// Edits are in original body offsets, sorted and non-overlapping
+	Edits []Edit `json:"edits,omitempty"`
+	// Partial is set when the edits could not be mapped back onto the
+	// original body; the hashes are still recorded
+	Partial        bool           `json:"partial,omitempty"`
+	Headers        []HeaderChange `json:"headers,omitempty"`
+	ResponseTokens []Substitution `json:"response_tokens,omitempty"`
+}
+
+type recordKey struct{}
+
+// WithRecord returns ctx carrying rec. A nil rec turns recording off for
+// the calls made with the returned context.
+func WithRecord(ctx context.Context, rec *Record) context.Context {
+	return context.WithValue(ctx, recordKey{}, rec)
+}
+
+// From returns the record in ctx, or nil
+func From(ctx context.Context) *Record {
+	rec, _ := ctx.Value(recordKey{}).(*Record)
+	return rec
+}
+
+// Hash returns the hex SHA-256 of body
+func Hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// SetBody records the request body transformation: edits turn before into
+// after. When they don't, the record is marked partial and keeps only the
+// hashes.
+func (r *Record) SetBody(before, after string, edits []Edit) {
+	if r == nil {
+		return
+	}
+	partial := false
+	if got, err := Apply(before, edits); err != nil || got != after {
+		edits, partial = nil, true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.BodySHA256Before = Hash([]byte(before))
+	r.BodySHA256After = Hash([]byte(after))
+	r.Edits = edits
+	r.Partial = partial
+}
+
+// Rewrite records a further change to the body recorded by SetBody: edits,
+// in the offsets of the recorded result, turn it into after. Recorded edits
+// inside a rewritten span are folded into it; one straddling its boundary
+// makes the record partial.
+func (r *Record) Rewrite(after string, edits []Edit) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.BodySHA256Before == "" {
+		return
+	}
+	r.BodySHA256After = Hash([]byte(after))
+	if r.Partial {
+		return
+	}
+	merged := make([]Edit, 0, len(r.Edits)+len(edits))
+	for _, e := range edits {
+		start, ok1 := r.original(e.Start)
+		end, ok2 := r.original(e.End)
+		if !ok1 || !ok2 {
+			r.Edits, r.Partial = nil, true
+			return
+		}
+		e.Start, e.End = start, end
+		merged = append(merged, e)
+	}
+	for _, old := range r.Edits {
+		inside := false
+		for _, e := range merged[:len(edits)] {
+			if old.Start >= e.Start && old.End <= e.End && old.End > e.Start {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			merged = append(merged, old)
+		}
+	}
+	slices.SortFunc(merged, func(a, b Edit) int { return a.Start - b.Start })
+	r.Edits = merged
+}
+
+// original maps an offset in the recorded result back to the original
+// body. It fails for an offset within a replacement.
+func (r *Record) original(pos int) (int, bool) {
+	shift := 0
+	for _, e := range r.Edits {
+		n := len(e.Token)
+		if e.Action == ActionMask {
+			n = e.End - e.Start // masks keep the length
+		}
+		start := e.Start + shift
+		if pos <= start {
+			break
+		}
+		if pos < start+n {
+			return 0, false
+		}
+		shift += n - (e.End - e.Start)
+	}
+	return pos - shift, true
+}
+
+// Empty reports whether nothing was recorded, as for a request without a
+// body that kept its headers
+func (r *Record) Empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.BodySHA256Before == "" && len(r.Headers) == 0 && len(r.ResponseTokens) == 0
+}
+
+// AddHeader records a header change
+func (r *Record) AddHeader(name, action string, categories []pii.Category) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Headers = append(r.Headers, HeaderChange{Name: name, Action: action, Categories: categories})
+}
+
+// AddSubstitution counts n rehydrations of token in the response
+func (r *Record) AddSubstitution(token string, n int) {
+	if r == nil || n == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, found := slices.BinarySearchFunc(r.ResponseTokens, token, func(s Substitution, t string) int {
+		return strings.Compare(s.Token, t)
+	})
+	if found {
+		r.ResponseTokens[i].Count += n
+		return
+	}
+	r.ResponseTokens = slices.Insert(r.ResponseTokens, i, Substitution{Token: token, Count: n})
+}
+
+// Apply replays edits on text. Masks are recomputed from the span they
+// replace.
+func Apply(text string, edits []Edit) (string, error) {
+	var b strings.Builder
+	last := 0
+	for i, e := range edits {
+		if e.Start < last || e.End < e.Start || e.End > len(text) {
+			return "", fmt.Errorf("edit %d [%d,%d) is out of order or out of range", i, e.Start, e.End)
+		}
+		token := e.Token
+		if e.Action == ActionMask {
+			token = pii.PartialMask(text[e.Start:e.End])
+		}
+		b.WriteString(text[last:e.Start])
+		b.WriteString(token)
+		last = e.End
+	}
+	b.WriteString(text[last:])
+	return b.String(), nil
+}
+
+// ErrInputMismatch means the input is not the body the record was made from
+var ErrInputMismatch = errors.New("input does not match the recorded body hash")
+
+// Replay reconstructs the body the upstream received from the original
+// body the client sent. It fails when input's hash differs from the
+// recorded one, and when the result's differs.
+func Replay(input []byte, rec *Record) ([]byte, error) {
+	if rec.BodySHA256Before == "" {
+		return nil, errors.New("record has no body hash")
+	}
+	if Hash(input) != rec.BodySHA256Before {
+		return nil, ErrInputMismatch
+	}
+	if rec.Partial {
+		return nil, errors.New("record is partial: its edits could not be mapped onto the original body")
+	}
+	out, err := Apply(string(input), rec.Edits)
+	if err != nil {
+		return nil, err
+	}
+	if Hash([]byte(out)) != rec.BodySHA256After {
+		return nil, errors.New("replayed body does not match the recorded result hash")
+	}
+	return []byte(out), nil
+}
@@ -0,0 +1,109 @@
+package forensic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+const (
+	original = `{"messages":[{"role":"user","content":"mail a@example.com, key sk-abcdefghijklmnopqrstuvwx, see [EMAIL_1]"}]}`
+	secret   = "sk-abcdefghijklmnopqrstuvwx"
+)
+
+// edits tokenizes the email, masks the key and neutralizes the token
+func edits() []Edit {
+	span := func(s string) (int, int) {
+		i := strings.Index(original, s)
+		return i, i + len(s)
+	}
+	var out []Edit
+	s, e := span("a@example.com")
+	out = append(out, Edit{Start: s, End: e, Category: pii.CatEmail, Action: "tokenize", Token: "[EMAIL_2]"})
+	s, e = span(secret)
+	out = append(out, Edit{Start: s, End: e, Category: "OPENAI_KEY", Action: ActionMask})
+	s, e = span("[EMAIL_1]")
+	out = append(out, Edit{Start: s, End: e, Action: ActionNeutralize, Token: "[TOKEN REMOVED]"})
+	return out
+}
+
+func TestReplay(t *testing.T) {
+	after := strings.NewReplacer(
+		"a@example.com", "[EMAIL_2]",
+		secret, pii.PartialMask(secret),
+		"[EMAIL_1]", "[TOKEN REMOVED]",
+	).Replace(original)
+
+	rec := &Record{}
+	rec.SetBody(original, after, edits())
+	if rec.Partial || len(rec.Edits) != 3 {
+		t.Fatalf("record = %+v", rec)
+	}
+
+	data, _ := json.Marshal(rec)
+	for _, value := range []string{"a@example.com", secret, pii.PartialMask(secret)} {
+		if strings.Contains(string(data), value) {
+			t.Errorf("record holds %q: %s", value, data)
+		}
+	}
+
+	var decoded Record
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Replay([]byte(original), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != after {
+		t.Errorf("got  %s\nwant %s", got, after)
+	}
+
+	if _, err := Replay([]byte(original+" "), &decoded); !errors.Is(err, ErrInputMismatch) {
+		t.Errorf("altered input: err = %v", err)
+	}
+}
+
+func TestSetBody_Partial(t *testing.T) {
+	rec := &Record{}
+	rec.SetBody(original, "something else", edits())
+	if !rec.Partial || rec.Edits != nil || rec.BodySHA256After != Hash([]byte("something else")) {
+		t.Errorf("record = %+v", rec)
+	}
+	if _, err := Replay([]byte(original), rec); err == nil || errors.Is(err, ErrInputMismatch) {
+		t.Errorf("partial record replayed: %v", err)
+	}
+}
+
+func TestApply_RejectsOverlaps(t *testing.T) {
+	_, err := Apply("abcdef", []Edit{{Start: 2, End: 4, Token: "x"}, {Start: 3, End: 5, Token: "y"}})
+	if err == nil {
+		t.Error("overlapping edits applied")
+	}
+	if _, err := Apply("abc", []Edit{{Start: 1, End: 9}}); err == nil {
+		t.Error("out of range edit applied")
+	}
+}
+
+func TestRecord_Context(t *testing.T) {
+	var nilRec *Record
+	nilRec.AddHeader("X-Customer", HeaderRemoved, nil) // no-op, no panic
+
+	rec := &Record{}
+	ctx := WithRecord(context.Background(), rec)
+	From(ctx).AddSubstitution("[PHONE_1]", 1)
+	From(ctx).AddSubstitution("[EMAIL_1]", 2)
+	From(ctx).AddSubstitution("[PHONE_1]", 2)
+	want := []Substitution{{"[EMAIL_1]", 2}, {"[PHONE_1]", 3}}
+	if len(rec.ResponseTokens) != 2 || rec.ResponseTokens[0] != want[0] || rec.ResponseTokens[1] != want[1] {
+		t.Errorf("response tokens = %+v", rec.ResponseTokens)
+	}
+
+	if From(WithRecord(ctx, nil)) != nil {
+		t.Error("WithRecord(nil) should turn recording off")
+	}
+}
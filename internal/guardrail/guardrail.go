@@ -1,11 +1,21 @@
 package guardrail
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"regexp"
 	"strings"
-	"sync"
 	"time"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/breakglass"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/i18n"
+	"github.com/vurakit/agentveil/internal/metrics"
+	"github.com/vurakit/agentveil/internal/ratelimit"
+	"github.com/vurakit/agentveil/internal/tokenizer"
 )
 
 // Policy defines runtime safety constraints for AI agent requests
@@ -18,6 +28,19 @@ type Policy struct {
 	BlockedTopics       []string       `json:"blocked_topics"`         // topics to block
 	MaxSessionDuration  time.Duration  `json:"max_session_duration"`   // 0 = unlimited
 	CustomRules         []ContentRule  `json:"custom_rules,omitempty"` // user-defined rules
+
+	OutputSchema       json.RawMessage `json:"output_schema,omitempty"`        // JSON Schema the output must satisfy
+	OutputSchemaAction string          `json:"output_schema_action,omitempty"` // "block" (default) or "warn"
+
+	// PIIOutputAction is what BlockPIIInOutput does with PII found in
+	// output: "block" (default) rejects the response, "redact" masks the
+	// values in it. Secrets are blocked either way.
+	PIIOutputAction string `json:"pii_output_action,omitempty"`
+
+	// DisableStreamScan forwards streamed responses unchecked, for
+	// deployments where the latency of incremental checks matters more
+	// than coverage. Non-streamed responses are checked either way.
+	DisableStreamScan bool `json:"disable_stream_scan,omitempty"`
 }
 
 // DefaultPolicy returns a sensible default policy
@@ -44,7 +67,8 @@ type Violation struct {
 	Rule        string `json:"rule"`
 	Severity    string `json:"severity"`
 	Description string `json:"description"`
-	Action      string `json:"action"` // "blocked", "warned", "redacted"
+	MessageID   string `json:"message_id,omitempty"` // of Description, unset for custom rules
+	Action      string `json:"action"`               // "blocked", "warned", "redacted"
 	Snippet     string `json:"snippet,omitempty"`
 }
 
@@ -52,6 +76,8 @@ type Violation struct {
 type CheckResult struct {
 	Allowed    bool        `json:"allowed"`
 	Violations []Violation `json:"violations,omitempty"`
+
+	redact []string // PII values the response middleware masks
 }
 
 // Guardrail enforces runtime safety policies
@@ -59,14 +85,20 @@ type Guardrail struct {
 	policy          Policy
 	harmfulPatterns []harmfulPattern
 	customCompiled  []compiledRule
-	sessionTracker  *SessionTracker
+	schema          *jsonSchema
+	rateLimiter     *ratelimit.Limiter // per-session, nil when MaxRequestsPerMin is 0
+	exempt          ratelimit.Exemptions
+	breakGlass      *breakglass.Switch
+	tokens          *tokenizer.Registry
+	lang            i18n.Lang
+	recorder        metrics.Recorder
+	detector        *detector.Detector // PII in output, unchecked when nil
 }
 
 type harmfulPattern struct {
-	Pattern     *regexp.Regexp
-	Category    string
-	Description string
-	Severity    string
+	Pattern  *regexp.Regexp
+	Category string
+	Severity string
 }
 
 type compiledRule struct {
@@ -74,18 +106,53 @@ type compiledRule struct {
 	Pattern *regexp.Regexp
 }
 
-// New creates a Guardrail with the given policy
-func New(policy Policy) *Guardrail {
+// New creates a Guardrail with the given policy.
+// Invalid custom rules or output schema are skipped; use Compile to surface them.
+func New(policy Policy, opts ...Option) *Guardrail {
+	g, err := build(policy, opts)
+	if err != nil {
+		slog.Warn("guardrail: invalid policy component skipped", "error", err)
+	}
+	return g
+}
+
+// Compile creates a Guardrail and returns an error if any custom rule
+// or the output schema fails to compile
+func Compile(policy Policy, opts ...Option) (*Guardrail, error) {
+	g, err := build(policy, opts)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func build(policy Policy, opts []Option) (*Guardrail, error) {
 	g := &Guardrail{
 		policy:          policy,
 		harmfulPatterns: defaultHarmfulPatterns(),
-		sessionTracker:  NewSessionTracker(),
+		exempt:          ratelimit.DefaultExemptions(),
+		tokens:          tokenizer.Default(),
+		recorder:        metrics.Nop{},
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if policy.MaxRequestsPerMin > 0 {
+		g.rateLimiter = ratelimit.New(ratelimit.Config{
+			Name:              "session",
+			RequestsPerMinute: policy.MaxRequestsPerMin,
+			Key:               ratelimit.BySession,
+		})
 	}
+	firstErr := validPIIAction(policy.PIIOutputAction)
 
 	// Compile custom rules
 	for _, rule := range policy.CustomRules {
 		compiled, err := regexp.Compile(rule.Pattern)
 		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("custom rule %s: invalid pattern: %w", rule.ID, err)
+			}
 			continue
 		}
 		g.customCompiled = append(g.customCompiled, compiledRule{
@@ -94,21 +161,55 @@ func New(policy Policy) *Guardrail {
 		})
 	}
 
-	return g
+	// Compile output schema once
+	if len(policy.OutputSchema) > 0 {
+		switch policy.OutputSchemaAction {
+		case "", SchemaActionBlock, SchemaActionWarn:
+		default:
+			if firstErr == nil {
+				firstErr = fmt.Errorf("output_schema_action: unknown action %q", policy.OutputSchemaAction)
+			}
+		}
+		schema, err := compileSchema(policy.OutputSchema)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			g.schema = schema
+		}
+	}
+
+	return g, firstErr
 }
 
-// CheckOutput validates LLM output against the policy
+// CheckOutput validates LLM output against the policy, counting tokens
+// with the tokenizer of models of no known family
 func (g *Guardrail) CheckOutput(output string) CheckResult {
+	return g.CheckOutputFor("", output)
+}
+
+// CheckOutputFor validates the output of model against the policy
+func (g *Guardrail) CheckOutputFor(model, output string) CheckResult {
+	return g.checkOutput(model, output, "", true, g.lang)
+}
+
+// checkOutput runs the policy's checks, describing violations in lang;
+// streams skip the token limit, which cuts them instead. PII also found in
+// echo, the request, is not reported.
+func (g *Guardrail) checkOutput(model, output, echo string, countTokens bool, lang i18n.Lang) CheckResult {
 	var violations []Violation
+	var redact []string
 
-	// 1. Token limit check (approximate: 1 token ≈ 4 chars)
-	if g.policy.MaxOutputTokens > 0 {
-		approxTokens := len(output) / 4
-		if approxTokens > g.policy.MaxOutputTokens {
+	// 1. Token limit check
+	if g.policy.MaxOutputTokens > 0 && countTokens {
+		tk := g.tokens.For(model)
+		if tokens := tk.Count(output); tokens > g.policy.MaxOutputTokens {
 			violations = append(violations, Violation{
 				Rule:        "max_output_tokens",
 				Severity:    "high",
-				Description: fmt.Sprintf("Output exceeds token limit: ~%d tokens (max: %d)", approxTokens, g.policy.MaxOutputTokens),
+				Description: i18n.T(lang, "guardrail.max_output_tokens", tokens, g.policy.MaxOutputTokens, tk.Name()),
+				MessageID:   "guardrail.max_output_tokens",
 				Action:      "blocked",
 			})
 		}
@@ -122,7 +223,8 @@ func (g *Guardrail) CheckOutput(output string) CheckResult {
 				violations = append(violations, Violation{
 					Rule:        "harmful_content:" + hp.Category,
 					Severity:    hp.Severity,
-					Description: hp.Description,
+					Description: i18n.T(lang, "guardrail."+hp.Category),
+					MessageID:   "guardrail." + hp.Category,
 					Action:      "blocked",
 					Snippet:     snippet,
 				})
@@ -137,7 +239,8 @@ func (g *Guardrail) CheckOutput(output string) CheckResult {
 			violations = append(violations, Violation{
 				Rule:        "blocked_topic",
 				Severity:    "medium",
-				Description: fmt.Sprintf("Output contains blocked topic: %s", topic),
+				Description: i18n.T(lang, "guardrail.blocked_topic", topic),
+				MessageID:   "guardrail.blocked_topic",
 				Action:      "blocked",
 			})
 		}
@@ -157,6 +260,18 @@ func (g *Guardrail) CheckOutput(output string) CheckResult {
 		}
 	}
 
+	// 5. Output schema
+	if g.schema != nil {
+		violations = append(violations, g.checkStructuredOutput(output, lang).Violations...)
+	}
+
+	// 6. PII and secrets
+	if g.policy.BlockPIIInOutput && g.detector != nil {
+		found, values := g.checkPII(output, echo, lang)
+		violations = append(violations, found...)
+		redact = values
+	}
+
 	// Determine if blocked
 	blocked := false
 	for _, v := range violations {
@@ -169,7 +284,49 @@ func (g *Guardrail) CheckOutput(output string) CheckResult {
 	return CheckResult{
 		Allowed:    !blocked,
 		Violations: violations,
+		redact:     redact,
+	}
+}
+
+// RateLimiter returns the per-session limiter provisioned from
+// MaxRequestsPerMin, or nil when session rate limiting is off
+func (g *Guardrail) RateLimiter() *ratelimit.Limiter {
+	return g.rateLimiter
+}
+
+// SetBreakGlass makes the middleware let blocked responses through while s
+// is active, reporting them to s instead. Session rate limits still apply.
+func (g *Guardrail) SetBreakGlass(s *breakglass.Switch) {
+	g.breakGlass = s
+}
+
+// SetLang sets the language of violation descriptions, i18n.Default by
+// default. The middlewares use the language of Accept-Language when the
+// request names a supported one.
+func (g *Guardrail) SetLang(l i18n.Lang) {
+	g.lang = l
+}
+
+// SetRecorder reports the violations the middlewares act on to rec
+func (g *Guardrail) SetRecorder(rec metrics.Recorder) {
+	g.recorder = rec
+}
+
+// record reports violations with the middleware's outcome: blocked,
+// warned or break_glass, to the metrics and by rule to the access log
+func (g *Guardrail) record(ctx context.Context, violations []Violation, outcome string) {
+	rules := make([]string, 0, len(violations))
+	for _, v := range violations {
+		g.recorder.GuardrailViolation(v.Rule, outcome)
+		rules = append(rules, v.Rule)
 	}
+	accesslog.AddViolations(ctx, rules)
+}
+
+// SetExemptions replaces the requests the middlewares neither rate-limit
+// nor check for blocked topics, ratelimit.DefaultExemptions by default
+func (g *Guardrail) SetExemptions(e ratelimit.Exemptions) {
+	g.exempt = e
 }
 
 // CheckRateLimit checks if a session has exceeded its rate limit
@@ -178,14 +335,14 @@ func (g *Guardrail) CheckRateLimit(sessionID string) CheckResult {
 		return CheckResult{Allowed: true}
 	}
 
-	allowed := g.sessionTracker.RecordRequest(sessionID, g.policy.MaxRequestsPerMin)
-	if !allowed {
+	if !g.rateLimiter.Allow(sessionID) {
 		return CheckResult{
 			Allowed: false,
 			Violations: []Violation{{
 				Rule:        "session_rate_limit",
 				Severity:    "high",
-				Description: fmt.Sprintf("Session %s exceeded %d requests/min", sessionID, g.policy.MaxRequestsPerMin),
+				Description: i18n.T(g.lang, "guardrail.session_rate_limit", sessionID, g.policy.MaxRequestsPerMin),
+				MessageID:   "guardrail.session_rate_limit",
 				Action:      "blocked",
 			}},
 		}
@@ -193,16 +350,32 @@ func (g *Guardrail) CheckRateLimit(sessionID string) CheckResult {
 	return CheckResult{Allowed: true}
 }
 
-// TruncateOutput truncates output to the token limit if set
+// TruncationMarker is appended to output cut at MaxOutputTokens
+const TruncationMarker = "\n\n[Output truncated by Agent Veil guardrail]"
+
+// TruncateOutput truncates output to the token limit if set, counting
+// tokens with the tokenizer of models of no known family
 func (g *Guardrail) TruncateOutput(output string) string {
+	return g.TruncateOutputFor("", output)
+}
+
+// TruncateOutputFor truncates the output of model to the token limit if
+// set. The cut is on a token boundary and never splits a rune.
+func (g *Guardrail) TruncateOutputFor(model, output string) string {
 	if g.policy.MaxOutputTokens <= 0 {
 		return output
 	}
-	maxChars := g.policy.MaxOutputTokens * 4
-	if len(output) <= maxChars {
+	kept, cut := g.tokens.For(model).Truncate(output, g.policy.MaxOutputTokens)
+	if !cut {
 		return output
 	}
-	return output[:maxChars] + "\n\n[Output truncated by Agent Veil guardrail]"
+	return kept + TruncationMarker
+}
+
+// SetTokenizers replaces the tokenizers max_output_tokens is counted with,
+// tokenizer.Default() by default
+func (g *Guardrail) SetTokenizers(r *tokenizer.Registry) {
+	g.tokens = r
 }
 
 func extractMatch(text string, pattern *regexp.Regexp, maxLen int) string {
@@ -232,101 +405,29 @@ func extractMatch(text string, pattern *regexp.Regexp, maxLen int) string {
 func defaultHarmfulPatterns() []harmfulPattern {
 	return []harmfulPattern{
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:how\s+to\s+(?:make|build|create|synthesize)\s+(?:a\s+)?(?:bomb|explosive|weapon|poison|drug|meth))`),
-			Category:    "dangerous_instructions",
-			Description: "Hướng dẫn tạo vật phẩm nguy hiểm",
-			Severity:    "critical",
+			Pattern:  regexp.MustCompile(`(?i)(?:how\s+to\s+(?:make|build|create|synthesize)\s+(?:a\s+)?(?:bomb|explosive|weapon|poison|drug|meth))`),
+			Category: "dangerous_instructions",
+			Severity: "critical",
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:(?:kill|harm|attack|assault|murder)\s+(?:yourself|himself|herself|themselves|someone|people|a\s+person))`),
-			Category:    "violence",
-			Description: "Nội dung bạo lực / gây hại",
-			Severity:    "critical",
+			Pattern:  regexp.MustCompile(`(?i)(?:(?:kill|harm|attack|assault|murder)\s+(?:yourself|himself|herself|themselves|someone|people|a\s+person))`),
+			Category: "violence",
+			Severity: "critical",
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:(?:hack|exploit|attack|breach|compromise)\s+(?:the|a|this)?\s*(?:server|system|network|database|website|account))`),
-			Category:    "cyber_attack",
-			Description: "Hướng dẫn tấn công mạng",
-			Severity:    "high",
+			Pattern:  regexp.MustCompile(`(?i)(?:(?:hack|exploit|attack|breach|compromise)\s+(?:the|a|this)?\s*(?:server|system|network|database|website|account))`),
+			Category: "cyber_attack",
+			Severity: "high",
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:(?:steal|phish|harvest)\s+(?:password|credential|credit\s*card|identity|personal\s+data))`),
-			Category:    "theft_instructions",
-			Description: "Hướng dẫn đánh cắp thông tin",
-			Severity:    "critical",
+			Pattern:  regexp.MustCompile(`(?i)(?:(?:steal|phish|harvest)\s+(?:password|credential|credit\s*card|identity|personal\s+data))`),
+			Category: "theft_instructions",
+			Severity: "critical",
 		},
 		{
-			Pattern:     regexp.MustCompile(`(?i)(?:self[- ]?harm|su[i!]c[i!]de\s+(?:method|way|how))`),
-			Category:    "self_harm",
-			Description: "Nội dung tự gây hại",
-			Severity:    "critical",
+			Pattern:  regexp.MustCompile(`(?i)(?:self[- ]?harm|su[i!]c[i!]de\s+(?:method|way|how))`),
+			Category: "self_harm",
+			Severity: "critical",
 		},
 	}
 }
-
-// === Session Rate Tracking ===
-
-// SessionTracker tracks per-session request rates
-type SessionTracker struct {
-	mu       sync.Mutex
-	sessions map[string]*sessionWindow
-}
-
-type sessionWindow struct {
-	timestamps []time.Time
-}
-
-// NewSessionTracker creates a new tracker
-func NewSessionTracker() *SessionTracker {
-	return &SessionTracker{
-		sessions: make(map[string]*sessionWindow),
-	}
-}
-
-// RecordRequest records a request and returns true if within limit
-func (st *SessionTracker) RecordRequest(sessionID string, maxPerMin int) bool {
-	st.mu.Lock()
-	defer st.mu.Unlock()
-
-	now := time.Now()
-	window, ok := st.sessions[sessionID]
-	if !ok {
-		window = &sessionWindow{}
-		st.sessions[sessionID] = window
-	}
-
-	// Remove timestamps older than 1 minute
-	cutoff := now.Add(-time.Minute)
-	valid := window.timestamps[:0]
-	for _, ts := range window.timestamps {
-		if ts.After(cutoff) {
-			valid = append(valid, ts)
-		}
-	}
-	window.timestamps = valid
-
-	if len(window.timestamps) >= maxPerMin {
-		return false
-	}
-
-	window.timestamps = append(window.timestamps, now)
-	return true
-}
-
-// Cleanup removes expired sessions
-func (st *SessionTracker) Cleanup() {
-	st.mu.Lock()
-	defer st.mu.Unlock()
-
-	cutoff := time.Now().Add(-5 * time.Minute)
-	for id, w := range st.sessions {
-		if len(w.timestamps) == 0 {
-			delete(st.sessions, id)
-			continue
-		}
-		// If the newest timestamp is old, remove the session
-		if w.timestamps[len(w.timestamps)-1].Before(cutoff) {
-			delete(st.sessions, id)
-		}
-	}
-}
@@ -7,6 +7,15 @@ import (
 	"log/slog"
 	"net/http"
 	"strings"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/annotate"
+	"github.com/vurakit/agentveil/internal/breakglass"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/i18n"
+	"github.com/vurakit/agentveil/internal/jsonfields"
+	"github.com/vurakit/agentveil/internal/session"
+	"github.com/vurakit/agentveil/internal/webhook"
 )
 
 // ResponseMiddleware wraps an http.Handler and checks LLM output against guardrails
@@ -19,25 +28,25 @@ func ResponseMiddleware(g *Guardrail) func(http.Handler) http.Handler {
 				sessionID = r.RemoteAddr
 			}
 
-			rateResult := g.CheckRateLimit(sessionID)
-			if !rateResult.Allowed {
-				slog.Warn("guardrail: session rate limited",
-					"session_id", sessionID,
-				)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusTooManyRequests)
-				json.NewEncoder(w).Encode(map[string]any{
-					"error": map[string]any{
-						"message": "Session rate limit exceeded",
-						"type":    "rate_limit",
-					},
-				})
-				return
+			if g.rateLimiter != nil && !g.exempt.Exempt(r) {
+				if d := g.rateLimiter.Check(r.Context(), sessionID); !d.Allowed {
+					accesslog.SetGuardrail(r.Context(), "rate_limited")
+					slog.Warn("guardrail: session rate limited",
+						"session_id", sessionID,
+					)
+					g.rateLimiter.Reject(w, d)
+					return
+				}
 			}
 
-			// For SSE streaming, we can't buffer - pass through
-			if isSSE(r) {
-				next.ServeHTTP(w, r)
+			// Output tokens are counted with the tokenizer of the model asked
+			// for; a stream can be asked for by the body alone
+			fields := requestFields(r)
+
+			// SSE streams and Gemini's JSON array streams are checked
+			// incrementally as they are forwarded
+			if isSSE(r) || isGeminiStream(r) || fields.Stream {
+				serveStream(g, w, r, next, sessionID, fields)
 				return
 			}
 
@@ -48,39 +57,140 @@ func ResponseMiddleware(g *Guardrail) func(http.Handler) http.Handler {
 				statusCode:     http.StatusOK,
 			}
 			next.ServeHTTP(rec, r)
+			serveBuffered(g, w, r, rec, sessionID, fields)
+		})
+	}
+}
 
-			// Check output content
-			body := rec.body.String()
-			outputText := extractOutputText(body)
+// serveBuffered checks the whole response captured in rec and writes it to
+// w, blocked or with PII set to be redacted masked in its text fields
+func serveBuffered(g *Guardrail, w http.ResponseWriter, r *http.Request, rec *responseRecorder, sessionID string, fields streamFields) {
+	// Check output content; PII set to be redacted is masked in respBody
+	respBody := rec.body.Bytes()
+	outputText := extractOutputText(string(respBody))
 
-			if outputText != "" {
-				result := g.CheckOutput(outputText)
-				if !result.Allowed {
-					slog.Warn("guardrail: output blocked",
-						"violations", len(result.Violations),
-						"session_id", sessionID,
-					)
-					w.Header().Set("Content-Type", "application/json")
-					w.WriteHeader(http.StatusForbidden)
-					json.NewEncoder(w).Encode(map[string]any{
-						"error": map[string]any{
-							"message": "Response blocked by guardrail",
-							"type":    "guardrail_violation",
-							"details": result.Violations,
-						},
-					})
-					return
-				}
+	var result CheckResult
+	if outputText != "" {
+		checked := failsafe.Protect(r.Context(), failsafe.Guardrail, sessionID, func() {
+			result = g.checkOutput(fields.Model, outputText, fields.request, true, i18n.FromRequest(r, g.lang))
+		})
+		session.AddThreats(r.Context(), len(result.Violations))
+		if checked && result.Allowed && len(result.redact) > 0 {
+			if out, ok := redactOutput(respBody, result.redact); ok {
+				respBody = out
+				rec.Header().Del("Content-Length")
+			} else {
+				result.blockRedactions()
 			}
-
-			// Write original response
-			for k, v := range rec.Header() {
-				w.Header()[k] = v
+		}
+		switch {
+		case !checked && !failsafe.Allowed(r.Context()):
+			accesslog.SetGuardrail(r.Context(), "failed")
+			failsafe.Deny(w)
+			return
+		case !checked:
+			accesslog.SetGuardrail(r.Context(), "unchecked")
+		case !result.Allowed && g.breakGlass.Active():
+			accesslog.SetGuardrail(r.Context(), "break_glass")
+			bypass(g, r, sessionID, result.Violations)
+		case !result.Allowed:
+			accesslog.SetGuardrail(r.Context(), "blocked")
+			g.record(r.Context(), result.Violations, "blocked")
+			slog.Warn("guardrail: output blocked",
+				"violations", len(result.Violations),
+				"session_id", sessionID,
+			)
+			// The upstream's length was copied with its headers
+			w.Header().Del("Content-Length")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": map[string]any{
+					"message": "Response blocked by guardrail",
+					"type":    "guardrail_violation",
+					"details": result.Violations,
+				},
+			})
+			return
+		case len(result.Violations) == 0:
+			accesslog.SetGuardrail(r.Context(), "allowed")
+		default:
+			outcome := "warned"
+			if len(result.redact) > 0 {
+				outcome = "redacted"
 			}
-			w.WriteHeader(rec.statusCode)
-			w.Write(rec.body.Bytes())
-		})
+			accesslog.SetGuardrail(r.Context(), outcome)
+			g.record(r.Context(), result.Violations, outcome)
+			annotateViolations(r, result.Violations)
+			slog.Warn("guardrail: output allowed with warnings",
+				"violations", len(result.Violations),
+				"rule", result.Violations[0].Rule,
+				"redacted", len(result.redact),
+				"session_id", sessionID,
+			)
+		}
+	}
+
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.statusCode)
+	w.Write(respBody)
+}
+
+// bypass reports a block let through by break-glass
+func bypass(g *Guardrail, r *http.Request, sessionID string, violations []Violation) {
+	rules := make([]string, 0, len(violations))
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
 	}
+	g.breakGlass.Bypass(breakglass.SourceGuardrail, webhook.EventGuardrailViolation, sessionID, map[string]any{
+		"violations": len(violations),
+		"rules":      rules,
+	})
+	g.record(r.Context(), violations, "break_glass")
+	annotateViolations(r, violations)
+}
+
+// annotateViolations reports allowed violations to clients that asked for
+// annotations; snippets stay out
+func annotateViolations(r *http.Request, violations []Violation) {
+	for _, v := range violations {
+		annotate.Add(r.Context(), annotate.SourceGuardrail, v.Rule, v.Severity, v.Action, 1)
+	}
+}
+
+// streamFields are the fields of a request body the response checks use
+type streamFields struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+
+	request string // the body's strings one per line, whose PII answers may echo
+}
+
+// requestFields returns the model and stream fields of r's JSON body, and
+// its strings or the body itself when it isn't JSON, leaving it to be read
+// again
+func requestFields(r *http.Request) streamFields {
+	var fields streamFields
+	if r.Method != http.MethodPost || r.Body == nil || r.Body == http.NoBody {
+		return fields
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(body, &fields)
+	fields.request = string(body)
+	// Compare against the strings as decoded: clients may escape
+	// non-ASCII characters as \uXXXX
+	var data any
+	if json.Unmarshal(body, &data) == nil {
+		fields.request = strings.Join(jsonfields.StringValues(data), "\n")
+	}
+	return fields
 }
 
 func isSSE(r *http.Request) bool {
@@ -88,6 +198,12 @@ func isSSE(r *http.Request) bool {
 	return strings.Contains(accept, "text/event-stream")
 }
 
+// isGeminiStream reports whether r asks Gemini for a stream, which is an SSE
+// stream with alt=sse and a JSON array of chunks without
+func isGeminiStream(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.Path, ":streamGenerateContent")
+}
+
 // responseRecorder captures the response for inspection
 type responseRecorder struct {
 	http.ResponseWriter
@@ -103,13 +219,42 @@ func (r *responseRecorder) Write(b []byte) (int, error) {
 	return r.body.Write(b)
 }
 
-// extractOutputText extracts assistant message text from LLM response
+// extractOutputText extracts assistant message text from LLM response. A
+// JSON array is taken as the chunks of a Gemini stream.
 func extractOutputText(body string) string {
-	var data map[string]any
-	if err := json.Unmarshal([]byte(body), &data); err != nil {
-		return body
+	var texts []string
+	if trimmed := strings.TrimSpace(body); strings.HasPrefix(trimmed, "[") {
+		var chunks []map[string]any
+		if err := json.Unmarshal([]byte(trimmed), &chunks); err != nil {
+			return body
+		}
+		for _, chunk := range chunks {
+			texts = append(texts, outputTexts(chunk)...)
+		}
+	} else {
+		var data map[string]any
+		if err := json.Unmarshal([]byte(body), &data); err != nil {
+			return body
+		}
+		texts = outputTexts(data)
+	}
+
+	if len(texts) == 0 {
+		return ""
 	}
 
+	var sb strings.Builder
+	for i, t := range texts {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(t)
+	}
+	return sb.String()
+}
+
+// outputTexts returns the assistant texts of one response or stream chunk
+func outputTexts(data map[string]any) []string {
 	var texts []string
 
 	// OpenAI format: {"choices": [{"message": {"content": "..."}}]}
@@ -148,25 +293,41 @@ func extractOutputText(body string) string {
 		}
 	}
 
-	if len(texts) == 0 {
-		return ""
-	}
-
-	var sb strings.Builder
-	for i, t := range texts {
-		if i > 0 {
-			sb.WriteString("\n")
+	// Gemini format: {"candidates": [{"content": {"parts": [{"text": "..."}]}}]}
+	if candidates, ok := data["candidates"].([]any); ok {
+		for _, candidate := range candidates {
+			c, ok := candidate.(map[string]any)
+			if !ok {
+				continue
+			}
+			content, _ := c["content"].(map[string]any)
+			parts, _ := content["parts"].([]any)
+			for _, part := range parts {
+				p, ok := part.(map[string]any)
+				if !ok {
+					continue
+				}
+				if text, ok := p["text"].(string); ok {
+					texts = append(texts, text)
+				}
+				// Function call arguments are model output too
+				if call, ok := p["functionCall"].(map[string]any); ok {
+					name, _ := call["name"].(string)
+					args, _ := json.Marshal(call["args"])
+					texts = append(texts, name+" "+string(args))
+				}
+			}
 		}
-		sb.WriteString(t)
 	}
-	return sb.String()
+
+	return texts
 }
 
 // InputMiddleware checks request body content against guardrail blocked topics
 func InputMiddleware(g *Guardrail) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Method != http.MethodPost || r.Body == nil {
+			if r.Method != http.MethodPost || r.Body == nil || g.exempt.Exempt(r) {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -183,6 +344,8 @@ func InputMiddleware(g *Guardrail) func(http.Handler) http.Handler {
 				text := strings.ToLower(string(body))
 				for _, topic := range g.policy.BlockedTopics {
 					if strings.Contains(text, strings.ToLower(topic)) {
+						accesslog.SetGuardrail(r.Context(), "topic_blocked")
+						g.recorder.GuardrailViolation("blocked_topic", "blocked")
 						w.Header().Set("Content-Type", "application/json")
 						w.WriteHeader(http.StatusForbidden)
 						json.NewEncoder(w).Encode(map[string]any{
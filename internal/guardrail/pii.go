@@ -0,0 +1,121 @@
+package guardrail
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/i18n"
+	"github.com/vurakit/agentveil/internal/jsonfields"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// PII output actions. Secrets block whichever is set.
+const (
+	PIIActionBlock  = "block"
+	PIIActionRedact = "redact"
+)
+
+// Option configures a Guardrail
+type Option func(*Guardrail)
+
+// WithDetector scans output for PII and secrets with d when the policy
+// sets BlockPIIInOutput. Without a detector that check is skipped.
+func WithDetector(d *detector.Detector) Option {
+	return func(g *Guardrail) {
+		g.detector = d
+	}
+}
+
+// checkPII scans output for PII and secrets, one violation per category.
+// Values the request carried are not leaks: the proxy restores the user's
+// own PII into answers, so a value found in echo is skipped. Secrets
+// always block; other PII blocks or is redacted per PIIOutputAction, and
+// the values to redact are returned.
+func (g *Guardrail) checkPII(output, echo string, lang i18n.Lang) ([]Violation, []string) {
+	found := make(map[pii.Category][]string)
+	var cats []pii.Category
+	for _, m := range g.detector.Scan(output) {
+		if m.Action == detector.ActionAllow || (echo != "" && strings.Contains(echo, m.Original)) {
+			continue
+		}
+		if _, ok := found[m.Category]; !ok {
+			cats = append(cats, m.Category)
+		}
+		found[m.Category] = append(found[m.Category], m.Original)
+	}
+	sort.Slice(cats, func(i, j int) bool { return cats[i] < cats[j] })
+
+	var violations []Violation
+	var redact []string
+	for _, cat := range cats {
+		v := Violation{
+			Rule:        "pii_in_output:" + string(cat),
+			Severity:    "high",
+			Description: i18n.T(lang, "guardrail.pii_in_output", cat, len(found[cat])),
+			MessageID:   "guardrail.pii_in_output",
+			Action:      "blocked",
+		}
+		switch {
+		case pii.IsSecretCategory(cat):
+			v.Severity = "critical"
+		case g.policy.PIIOutputAction == PIIActionRedact:
+			v.Action = "redacted"
+			redact = append(redact, found[cat]...)
+		}
+		violations = append(violations, v)
+	}
+	return violations, redact
+}
+
+// validPIIAction reports whether action is a PIIOutputAction
+func validPIIAction(action string) error {
+	switch action {
+	case "", PIIActionBlock, PIIActionRedact:
+		return nil
+	}
+	return fmt.Errorf("pii_output_action: unknown action %q", action)
+}
+
+// redactOutput masks values in the model output fields of body and copies
+// the rest byte for byte. A body that isn't JSON is masked as text. ok is
+// false when a value is still in the text the check reads, e.g. in a field
+// that isn't rewritten, so the response must be blocked instead.
+func redactOutput(body []byte, values []string) (out []byte, ok bool) {
+	if len(values) == 0 {
+		return body, true
+	}
+	// Longest first, so a value containing another is masked whole
+	values = append([]string(nil), values...)
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, pii.MaskValue(v))
+	}
+	mask := strings.NewReplacer(pairs...).Replace
+
+	out, ok = jsonfields.Rewrite(body, jsonfields.IsContent, mask)
+	if !ok {
+		out = []byte(mask(string(body)))
+	}
+	left := extractOutputText(string(out))
+	for _, v := range values {
+		if strings.Contains(left, v) {
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// blockRedactions turns the PII violations set to be redacted into blocks,
+// for a response whose values couldn't all be masked
+func (r *CheckResult) blockRedactions() {
+	for i, v := range r.Violations {
+		if v.Action == "redacted" {
+			r.Violations[i].Action = "blocked"
+		}
+	}
+	r.Allowed = false
+	r.redact = nil
+}
@@ -0,0 +1,412 @@
+package guardrail
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/i18n"
+)
+
+// Output schema actions
+const (
+	SchemaActionBlock = "block"
+	SchemaActionWarn  = "warn"
+)
+
+// maxSchemaErrors caps how many schema errors are listed in one violation
+const maxSchemaErrors = 10
+
+// jsonSchema is a compiled subset of JSON Schema (draft 2020-12) covering the
+// keywords agents use for structured output: type, properties, required,
+// additionalProperties, items, enum, const, length/size/range bounds and pattern.
+type jsonSchema struct {
+	types                []string
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema // nil = allowed
+	noAdditional         bool        // additionalProperties: false
+	items                *jsonSchema
+	enum                 []any
+	constVal             any
+	hasConst             bool
+	minItems, maxItems   *int
+	minLength, maxLength *int
+	minimum, maximum     *float64
+	pattern              *regexp.Regexp
+}
+
+var knownSchemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// compileSchema parses a JSON Schema document into a validator
+func compileSchema(raw json.RawMessage) (*jsonSchema, error) {
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("output schema: invalid JSON: %w", err)
+	}
+	return compileSchemaNode(doc, "$")
+}
+
+func compileSchemaNode(node any, path string) (*jsonSchema, error) {
+	// Boolean schemas: true accepts everything, false is unsupported here
+	if b, ok := node.(bool); ok {
+		if b {
+			return &jsonSchema{}, nil
+		}
+		return nil, fmt.Errorf("output schema %s: boolean false schema is not supported", path)
+	}
+
+	m, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("output schema %s: schema must be an object", path)
+	}
+
+	s := &jsonSchema{}
+
+	switch t := m["type"].(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []any:
+		for _, v := range t {
+			name, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("output schema %s: type entries must be strings", path)
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return nil, fmt.Errorf("output schema %s: type must be a string or array", path)
+	}
+	for _, t := range s.types {
+		if !knownSchemaTypes[t] {
+			return nil, fmt.Errorf("output schema %s: unknown type %q", path, t)
+		}
+	}
+
+	if props, ok := m["properties"]; ok {
+		pm, ok := props.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("output schema %s: properties must be an object", path)
+		}
+		s.properties = make(map[string]*jsonSchema, len(pm))
+		for name, sub := range pm {
+			compiled, err := compileSchemaNode(sub, path+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			s.properties[name] = compiled
+		}
+	}
+
+	if req, ok := m["required"]; ok {
+		list, ok := req.([]any)
+		if !ok {
+			return nil, fmt.Errorf("output schema %s: required must be an array", path)
+		}
+		for _, v := range list {
+			name, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("output schema %s: required entries must be strings", path)
+			}
+			s.required = append(s.required, name)
+		}
+	}
+
+	switch ap := m["additionalProperties"].(type) {
+	case nil:
+	case bool:
+		s.noAdditional = !ap
+	default:
+		compiled, err := compileSchemaNode(ap, path+".additionalProperties")
+		if err != nil {
+			return nil, err
+		}
+		s.additionalProperties = compiled
+	}
+
+	if items, ok := m["items"]; ok {
+		compiled, err := compileSchemaNode(items, path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		s.items = compiled
+	}
+
+	if enum, ok := m["enum"]; ok {
+		list, ok := enum.([]any)
+		if !ok {
+			return nil, fmt.Errorf("output schema %s: enum must be an array", path)
+		}
+		s.enum = list
+	}
+	if c, ok := m["const"]; ok {
+		s.constVal = c
+		s.hasConst = true
+	}
+
+	var err error
+	if s.minItems, err = schemaInt(m, "minItems", path); err != nil {
+		return nil, err
+	}
+	if s.maxItems, err = schemaInt(m, "maxItems", path); err != nil {
+		return nil, err
+	}
+	if s.minLength, err = schemaInt(m, "minLength", path); err != nil {
+		return nil, err
+	}
+	if s.maxLength, err = schemaInt(m, "maxLength", path); err != nil {
+		return nil, err
+	}
+	if s.minimum, err = schemaNumber(m, "minimum", path); err != nil {
+		return nil, err
+	}
+	if s.maximum, err = schemaNumber(m, "maximum", path); err != nil {
+		return nil, err
+	}
+
+	if p, ok := m["pattern"]; ok {
+		ps, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("output schema %s: pattern must be a string", path)
+		}
+		compiled, err := regexp.Compile(ps)
+		if err != nil {
+			return nil, fmt.Errorf("output schema %s: invalid pattern: %w", path, err)
+		}
+		s.pattern = compiled
+	}
+
+	return s, nil
+}
+
+func schemaInt(m map[string]any, key, path string) (*int, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("output schema %s: %s must be a non-negative integer", path, key)
+	}
+	n := int(f)
+	return &n, nil
+}
+
+func schemaNumber(m map[string]any, key, path string) (*float64, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("output schema %s: %s must be a number", path, key)
+	}
+	return &f, nil
+}
+
+// validate checks a decoded JSON value and returns human-readable errors
+func (s *jsonSchema) validate(v any, path string) []string {
+	var errs []string
+
+	if len(s.types) > 0 && !matchesAnyType(v, s.types) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(s.types, " or "), jsonTypeName(v))}
+	}
+
+	if s.hasConst && !jsonEqual(v, s.constVal) {
+		errs = append(errs, fmt.Sprintf("%s: must equal %v", path, s.constVal))
+	}
+	if len(s.enum) > 0 {
+		found := false
+		for _, e := range s.enum {
+			if jsonEqual(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: value not in enum %v", path, s.enum))
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := val[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+		// Sorted iteration keeps error output deterministic
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if sub, ok := s.properties[k]; ok {
+				errs = append(errs, sub.validate(val[k], path+"."+k)...)
+				continue
+			}
+			if s.noAdditional {
+				errs = append(errs, fmt.Sprintf("%s: additional property %q not allowed", path, k))
+			} else if s.additionalProperties != nil {
+				errs = append(errs, s.additionalProperties.validate(val[k], path+"."+k)...)
+			}
+		}
+	case []any:
+		if s.minItems != nil && len(val) < *s.minItems {
+			errs = append(errs, fmt.Sprintf("%s: expected at least %d items, got %d", path, *s.minItems, len(val)))
+		}
+		if s.maxItems != nil && len(val) > *s.maxItems {
+			errs = append(errs, fmt.Sprintf("%s: expected at most %d items, got %d", path, *s.maxItems, len(val)))
+		}
+		if s.items != nil {
+			for i, item := range val {
+				errs = append(errs, s.items.validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		n := len([]rune(val))
+		if s.minLength != nil && n < *s.minLength {
+			errs = append(errs, fmt.Sprintf("%s: string shorter than %d", path, *s.minLength))
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			errs = append(errs, fmt.Sprintf("%s: string longer than %d", path, *s.maxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			errs = append(errs, fmt.Sprintf("%s: does not match pattern %s", path, s.pattern.String()))
+		}
+	case float64:
+		if s.minimum != nil && val < *s.minimum {
+			errs = append(errs, fmt.Sprintf("%s: %v is less than minimum %v", path, val, *s.minimum))
+		}
+		if s.maximum != nil && val > *s.maximum {
+			errs = append(errs, fmt.Sprintf("%s: %v is greater than maximum %v", path, val, *s.maximum))
+		}
+	}
+
+	return errs
+}
+
+func matchesAnyType(v any, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "object":
+			if _, ok := v.(map[string]any); ok {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]any); ok {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := v.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "null":
+			if v == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func jsonEqual(a, b any) bool {
+	ab, err1 := json.Marshal(a)
+	bb, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(ab) == string(bb)
+}
+
+var codeFencePattern = regexp.MustCompile("(?s)```[a-zA-Z0-9_-]*\\s*\\n?(.*?)```")
+
+// extractJSONPayload strips markdown code fences that LLMs commonly wrap JSON in
+func extractJSONPayload(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if m := codeFencePattern.FindStringSubmatch(trimmed); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	return trimmed
+}
+
+// CheckStructuredOutput parses output as JSON (tolerating markdown code fences)
+// and validates it against Policy.OutputSchema
+func (g *Guardrail) CheckStructuredOutput(output string) CheckResult {
+	return g.checkStructuredOutput(output, g.lang)
+}
+
+func (g *Guardrail) checkStructuredOutput(output string, lang i18n.Lang) CheckResult {
+	if g.schema == nil {
+		return CheckResult{Allowed: true}
+	}
+
+	action := "blocked"
+	if g.policy.OutputSchemaAction == SchemaActionWarn {
+		action = "warned"
+	}
+
+	var errs []string
+	var doc any
+	if err := json.Unmarshal([]byte(extractJSONPayload(output)), &doc); err != nil {
+		errs = []string{fmt.Sprintf("output is not valid JSON: %v", err)}
+	} else {
+		errs = g.schema.validate(doc, "$")
+	}
+
+	if len(errs) == 0 {
+		return CheckResult{Allowed: true}
+	}
+
+	total := len(errs)
+	if total > maxSchemaErrors {
+		errs = append(errs[:maxSchemaErrors], fmt.Sprintf("... and %d more", total-maxSchemaErrors))
+	}
+
+	return CheckResult{
+		Allowed: action != "blocked",
+		Violations: []Violation{{
+			Rule:        "output_schema",
+			Severity:    "medium",
+			Description: i18n.T(lang, "guardrail.output_schema", strings.Join(errs, "; ")),
+			MessageID:   "guardrail.output_schema",
+			Action:      action,
+		}},
+	}
+}
@@ -0,0 +1,206 @@
+package guardrail
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/annotate"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/i18n"
+	"github.com/vurakit/agentveil/internal/session"
+	"github.com/vurakit/agentveil/internal/streamscan"
+	"github.com/vurakit/agentveil/internal/tokenizer"
+)
+
+// serveStream runs CheckOutput over a streaming response as deltas arrive.
+// A blocking violation ends the stream with an error event, or an error
+// element for Gemini's JSON array streams; the
+// max_output_tokens limit, counted in the tokens of model, cuts it with
+// TruncationMarker as the final delta. Checks see a sliding window of the
+// text, so warnings are collected across them. A failing check ends the
+// stream under a closed failure policy and stops checking under an open one.
+// Forwarded deltas can't be masked any more, so PII the policy redacts is
+// only reported as a warning in streams.
+//
+// A stream is only asked for; an answer that turns out not to be one, e.g.
+// plain JSON from an upstream that ignored "stream", is checked whole.
+func serveStream(g *Guardrail, w http.ResponseWriter, r *http.Request, next http.Handler, sessionID string, fields streamFields) {
+	if g.policy.DisableStreamScan {
+		ss := &streamSwitch{w: w, stream: w, jsonArray: isGeminiStream(r)}
+		next.ServeHTTP(ss, r)
+		if ss.rec != nil {
+			serveBuffered(g, w, r, ss.rec, sessionID, fields)
+			return
+		}
+		accesslog.SetGuardrail(r.Context(), "unscanned")
+		return
+	}
+
+	model := fields.Model
+	var last CheckResult
+	var warnings []Violation
+	warned := make(map[string]bool)
+	bypassed, unchecked := false, false
+	lang := i18n.FromRequest(r, g.lang)
+	cfg := streamscan.Config{
+		Check: func(text string) any {
+			if unchecked {
+				return nil
+			}
+			if !failsafe.Protect(r.Context(), failsafe.Guardrail, sessionID, func() {
+				last = g.checkOutput(model, text, fields.request, false, lang)
+			}) {
+				if failsafe.Allowed(r.Context()) {
+					unchecked = true
+					return nil
+				}
+				return map[string]any{
+					"message": "a protection component failed and the failure mode is closed",
+					"type":    "protection_unavailable",
+				}
+			}
+			for i, v := range last.Violations {
+				if v.Action == "redacted" {
+					v.Action = "warned"
+					last.Violations[i] = v
+				}
+				if !warned[v.Rule] {
+					warned[v.Rule] = true
+					warnings = append(warnings, v)
+				}
+			}
+			if last.Allowed {
+				return nil
+			}
+			if bypassed || g.breakGlass.Active() {
+				if !bypassed {
+					bypass(g, r, sessionID, last.Violations)
+					bypassed = true
+				}
+				return nil
+			}
+			return map[string]any{
+				"message": "Response blocked by guardrail",
+				"type":    "guardrail_violation",
+				"details": last.Violations,
+			}
+		},
+	}
+	if isGeminiStream(r) {
+		cfg.JSONArray = true
+	}
+	if g.policy.MaxOutputTokens > 0 {
+		cfg.Limit = tokenizer.NewLimit(g.tokens.For(model), g.policy.MaxOutputTokens)
+		cfg.Marker = TruncationMarker
+	}
+
+	sw := streamscan.NewWriter(w, cfg)
+	ss := &streamSwitch{w: w, stream: sw, jsonArray: cfg.JSONArray}
+	serveScanned(next, ss, sw, r)
+	if ss.rec != nil {
+		serveBuffered(g, w, r, ss.rec, sessionID, fields)
+		return
+	}
+	sw.Finish()
+	session.AddThreats(r.Context(), len(warnings))
+
+	switch {
+	case sw.Blocked() != nil:
+		accesslog.SetGuardrail(r.Context(), "blocked")
+		g.record(r.Context(), last.Violations, "blocked")
+		slog.Warn("guardrail: stream blocked",
+			"violations", len(last.Violations),
+			"session_id", sessionID,
+		)
+	case bypassed:
+		accesslog.SetGuardrail(r.Context(), "break_glass")
+	case unchecked:
+		accesslog.SetGuardrail(r.Context(), "unchecked")
+	case sw.Truncated():
+		accesslog.SetGuardrail(r.Context(), "truncated")
+		annotate.Add(r.Context(), annotate.SourceGuardrail, "max_output_tokens", "", "truncated", 1)
+		slog.Warn("guardrail: stream truncated at token limit",
+			"max_output_tokens", g.policy.MaxOutputTokens,
+			"session_id", sessionID,
+		)
+	case len(warnings) > 0:
+		accesslog.SetGuardrail(r.Context(), "warned")
+		g.record(r.Context(), warnings, "warned")
+		annotateViolations(r, warnings)
+		slog.Warn("guardrail: stream allowed with warnings",
+			"violations", len(warnings),
+			"rule", warnings[0].Rule,
+			"session_id", sessionID,
+		)
+	case sw.Streamed() > 0:
+		accesslog.SetGuardrail(r.Context(), "allowed")
+	}
+}
+
+// serveScanned runs next on sw. ReverseProxy aborts with ErrAbortHandler
+// when a write fails; after a deliberate stop the terminal event is already
+// out, so the response is finished normally instead.
+func serveScanned(next http.Handler, w http.ResponseWriter, sw *streamscan.Writer, r *http.Request) {
+	defer func() {
+		if sw.Stopped() {
+			if p := recover(); p != nil && p != http.ErrAbortHandler {
+				panic(p)
+			}
+		}
+	}()
+	next.ServeHTTP(w, r)
+}
+
+// streamSwitch sends a response asked for as a stream to stream when its
+// headers show one: an SSE stream, or a successful JSON response taken as
+// a JSON array stream. Any other response is captured in rec to be checked
+// whole.
+type streamSwitch struct {
+	w         http.ResponseWriter
+	stream    http.ResponseWriter
+	jsonArray bool
+
+	decided bool
+	rec     *responseRecorder
+}
+
+func (ss *streamSwitch) Header() http.Header {
+	return ss.w.Header()
+}
+
+func (ss *streamSwitch) WriteHeader(code int) {
+	if ss.decided {
+		return
+	}
+	ss.decided = true
+	contentType := ss.w.Header().Get("Content-Type")
+	if strings.Contains(contentType, "text/event-stream") ||
+		(ss.jsonArray && strings.Contains(contentType, "application/json") && code < 300) {
+		ss.stream.WriteHeader(code)
+		return
+	}
+	ss.rec = &responseRecorder{ResponseWriter: ss.w, body: &bytes.Buffer{}, statusCode: code}
+}
+
+func (ss *streamSwitch) Write(b []byte) (int, error) {
+	if !ss.decided {
+		ss.WriteHeader(http.StatusOK)
+	}
+	if ss.rec != nil {
+		return ss.rec.Write(b)
+	}
+	return ss.stream.Write(b)
+}
+
+// Flush flushes a stream; a captured response is written once checked
+func (ss *streamSwitch) Flush() {
+	if !ss.decided || ss.rec != nil {
+		return
+	}
+	if f, ok := ss.stream.(http.Flusher); ok {
+		f.Flush()
+	}
+}
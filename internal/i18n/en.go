@@ -0,0 +1,213 @@
+package i18n
+
+// en is the English catalog
+var en = map[string]string{
+	// Auditor rules, by category
+	"audit.rule.credential_access":   "Instruction to access credentials or passwords",
+	"audit.rule.data_exfiltration":   "Instruction to send data outside the system",
+	"audit.rule.security_bypass":     "Instruction to bypass security controls",
+	"audit.rule.mass_collection":     "Mass collection of personal data",
+	"audit.rule.audit_destruction":   "Instruction to delete audit records",
+	"audit.rule.code_execution":      "Instruction to execute arbitrary code",
+	"audit.rule.consent_violation":   "Action taken without user consent",
+	"audit.rule.surveillance":        "Unauthorized surveillance of users",
+	"audit.rule.sensitive_storage":   "Storage of highly sensitive data",
+	"audit.rule.data_sharing":        "Sharing personal data with third parties",
+	"audit.rule.url_fetch_injection": "Instruction to read or fetch an external URL in a skill — an indirect injection vector",
+	"audit.rule.skill_tampering":     "Instruction to delete or modify skills or instruction files",
+	"audit.rule.indirect_injection":  "Instruction to follow or execute instructions from an external source",
+	"audit.rule.data_post_external":  "Instruction to POST customer data to a specific endpoint",
+	"audit.obfuscated":               "[Obfuscated] %s",
+
+	// Auditor behavior chains, by name
+	"audit.chain.data_exfiltration":  "Reads a file, then sends HTTP = suspected data leak",
+	"audit.chain.db_exfiltration":    "Queries a database, then sends HTTP = suspected database leak",
+	"audit.chain.credential_theft":   "Accesses credentials, then sends them out",
+	"audit.chain.cover_tracks":       "Executes code, then deletes files = covering tracks",
+	"audit.chain.reverse_shell":      "Executes code + opens a network connection = suspected reverse shell",
+	"audit.chain.indirect_injection": "Reads a URL, then modifies a skill = indirect injection",
+	"audit.chain.url_data_exfil":     "Reads a URL, then sends data out",
+	"audit.chain.skill_sabotage":     "Deletes a skill, then sends data = sabotage + leak",
+
+	// Auditor findings about the analysis itself
+	"audit.truncated_line":         "Line of %d bytes truncated to %d for analysis",
+	"audit.incomplete.deobfuscate": "Anti-evasion pass ran out of its %s budget on %d line(s)",
+	"audit.incomplete.behavior":    "Behavior chain pass stopped after its %s budget; chains are matched on the lines scanned",
+	"audit.incomplete.cross_file":  "Cross-file chain pass stopped after its %s budget; chains are matched on the lines scanned",
+
+	// Suspicious URLs
+	"audit.url.shortener": "URL shortener — may hide the real destination",
+	"audit.url.ip":        "URL uses an IP address instead of a domain — may evade blocklists",
+	"audit.url.hex":       "URL contains hex encoding — may obfuscate the path",
+
+	// Risk levels per Vietnam AI Law 2026
+	"audit.risk.minimal":      "Minimal",
+	"audit.risk.limited":      "Limited",
+	"audit.risk.high":         "High",
+	"audit.risk.unacceptable": "Unacceptable",
+
+	// Audit summaries
+	"audit.summary.clean":       "Skill.md is compliant. No dangerous instructions found.",
+	"audit.summary.issues":      "Found %s. Risk level: %s.",
+	"audit.summary.critical":    "%d critical issue(s)",
+	"audit.summary.high":        "%d high issue(s)",
+	"audit.summary.medium":      "%d medium issue(s)",
+	"audit.summary.occurrences": "%d occurrence(s) in total",
+	"audit.summary.project":     "%d file(s), %d cross-file chain(s). %s",
+
+	// Audit HTML report
+	"audit.html.title":           "Agent Veil Audit Report",
+	"audit.html.risk_level":      "Risk Level",
+	"audit.html.score":           "Compliance Score",
+	"audit.html.rules_profile":   "Rules Profile",
+	"audit.html.findings":        "Findings",
+	"audit.html.line":            "Line",
+	"audit.html.severity":        "Severity",
+	"audit.html.category":        "Category",
+	"audit.html.description":     "Description",
+	"audit.html.behavior_chains": "Behavior Chains",
+	"audit.html.weight":          "weight",
+
+	// Compliance requirements: Vietnam AI Law 2026
+	"compliance.VN-AI-01.article":     "Art. 12",
+	"compliance.VN-AI-01.title":       "Personal Data Protection",
+	"compliance.VN-AI-01.description": "AI systems must detect and anonymize personal data before processing it",
+	"compliance.VN-AI-01.details":     "Personal data detection & anonymization",
+	"compliance.VN-AI-02.article":     "Art. 15",
+	"compliance.VN-AI-02.title":       "Data Subject Consent",
+	"compliance.VN-AI-02.description": "Collecting and processing personal data requires the data subject's consent",
+	"compliance.VN-AI-02.details":     "User consent mechanism",
+	"compliance.VN-AI-03.article":     "Art. 20",
+	"compliance.VN-AI-03.title":       "AI Activity Logs",
+	"compliance.VN-AI-03.description": "Keep complete activity logs of the AI system for audits",
+	"compliance.VN-AI-03.details":     "Structured audit logs",
+	"compliance.VN-AI-04.article":     "Art. 26",
+	"compliance.VN-AI-04.title":       "In-Country Data Storage",
+	"compliance.VN-AI-04.description": "Personal data of Vietnamese citizens must be stored within Vietnam",
+	"compliance.VN-AI-04.details":     "Data stored within Vietnam",
+	"compliance.VN-AI-05.article":     "Art. 30",
+	"compliance.VN-AI-05.title":       "AI Risk Assessment",
+	"compliance.VN-AI-05.description": "AI systems must be assessed and classified by risk level",
+	"compliance.VN-AI-05.details":     "skill.md auditing for AI agents",
+	"compliance.VN-AI-06.article":     "Art. 35",
+	"compliance.VN-AI-06.title":       "Data Security",
+	"compliance.VN-AI-06.description": "Encrypt data at rest and in transit",
+	"compliance.VN-AI-06.details":     "Encryption at rest and in transit",
+	"compliance.VN-AI-07.article":     "Art. 38",
+	"compliance.VN-AI-07.title":       "Access Control",
+	"compliance.VN-AI-07.description": "Role-based access under the principle of least privilege",
+	"compliance.VN-AI-07.details":     "Role-based access control",
+
+	// Compliance requirements: EU AI Act
+	"compliance.EU-AI-01.article":     "Art. 9",
+	"compliance.EU-AI-01.title":       "Risk Management System",
+	"compliance.EU-AI-01.description": "Establish and maintain a risk management system for high-risk AI",
+	"compliance.EU-AI-01.details":     "Risk assessment for AI systems",
+	"compliance.EU-AI-02.article":     "Art. 14",
+	"compliance.EU-AI-02.title":       "Human Oversight",
+	"compliance.EU-AI-02.description": "Ensure appropriate human oversight measures for AI systems",
+	"compliance.EU-AI-02.details":     "Human oversight capabilities",
+	"compliance.EU-AI-03.article":     "Art. 13",
+	"compliance.EU-AI-03.title":       "Transparency",
+	"compliance.EU-AI-03.description": "AI systems must be designed to enable transparency and explainability",
+	"compliance.EU-AI-03.details":     "Transparency and documentation",
+	"compliance.EU-AI-04.article":     "Art. 12",
+	"compliance.EU-AI-04.title":       "Record-keeping",
+	"compliance.EU-AI-04.description": "Maintain logs of AI system operations for traceability",
+	"compliance.EU-AI-04.details":     "Record-keeping of AI operations",
+	"compliance.EU-AI-05.article":     "Art. 15",
+	"compliance.EU-AI-05.title":       "Accuracy and Robustness",
+	"compliance.EU-AI-05.description": "Ensure AI systems achieve appropriate levels of accuracy, robustness and cybersecurity",
+	"compliance.EU-AI-05.details":     "Accuracy, robustness and cybersecurity",
+
+	// Compliance requirements: GDPR
+	"compliance.GDPR-01.article":     "Art. 5(1)(c)",
+	"compliance.GDPR-01.title":       "Data Minimization",
+	"compliance.GDPR-01.description": "Process only data that is necessary for the purpose",
+	"compliance.GDPR-01.details":     "Data minimization (Art. 5(1)(c))",
+	"compliance.GDPR-02.article":     "Art. 6",
+	"compliance.GDPR-02.title":       "Lawful Basis for Processing",
+	"compliance.GDPR-02.description": "Ensure lawful basis for data processing, including consent",
+	"compliance.GDPR-02.details":     "Lawful basis for processing (Art. 6)",
+	"compliance.GDPR-03.article":     "Art. 17",
+	"compliance.GDPR-03.title":       "Right to Erasure",
+	"compliance.GDPR-03.description": "Data subjects have the right to have their data erased",
+	"compliance.GDPR-03.details":     "Right to erasure (Art. 17)",
+	"compliance.GDPR-04.article":     "Art. 20",
+	"compliance.GDPR-04.title":       "Data Portability",
+	"compliance.GDPR-04.description": "Data subjects have the right to receive their data in portable format",
+	"compliance.GDPR-04.details":     "Data portability (Art. 20)",
+	"compliance.GDPR-05.article":     "Art. 32",
+	"compliance.GDPR-05.title":       "Security of Processing",
+	"compliance.GDPR-05.description": "Implement appropriate technical and organizational security measures",
+	"compliance.GDPR-05.details":     "Security of processing (Art. 32)",
+	"compliance.GDPR-06.article":     "Art. 30",
+	"compliance.GDPR-06.title":       "Records of Processing",
+	"compliance.GDPR-06.description": "Maintain records of processing activities",
+	"compliance.GDPR-06.details":     "Records of processing activities (Art. 30)",
+
+	"compliance.unknown_requirement": "Unknown requirement",
+
+	// Compliance statuses and frameworks
+	"compliance.status.compliant":          "Compliant",
+	"compliance.status.non_compliant":      "Non-compliant",
+	"compliance.status.partial":            "Partial",
+	"compliance.status.not_applicable":     "N/A",
+	"compliance.status.unknown":            "Unknown",
+	"compliance.framework.vietnam_ai_2026": "Vietnam AI Law 2026",
+	"compliance.framework.eu_ai_act":       "EU AI Act",
+	"compliance.framework.gdpr":            "GDPR",
+	"compliance.summary":                   "Compliance assessment: %.0f/100. Compliant: %d, non-compliant: %d, partial: %d of %d requirements.",
+
+	// Compliance HTML reports
+	"compliance.html.title":           "Agent Veil Compliance Report",
+	"compliance.html.fleet_title":     "Agent Veil Fleet Compliance Report",
+	"compliance.html.generated":       "Generated",
+	"compliance.html.id":              "ID",
+	"compliance.html.article":         "Article",
+	"compliance.html.requirement":     "Requirement",
+	"compliance.html.requirements":    "Requirements",
+	"compliance.html.status":          "Status",
+	"compliance.html.details":         "Details",
+	"compliance.html.recommendations": "Recommendations",
+	"compliance.html.instances":       "Instances",
+	"compliance.html.instance":        "Instance",
+	"compliance.html.score":           "Score",
+	"compliance.html.worst_instance":  "Worst instance",
+
+	// Prompt guard detections, by category
+	"promptguard.instruction_override":      "Attempt to override system instructions",
+	"promptguard.prompt_extraction":         "Attempt to extract the system prompt",
+	"promptguard.jailbreak_roleplay":        "Role-play jailbreak",
+	"promptguard.jailbreak_dan":             "DAN-style jailbreak",
+	"promptguard.delimiter_injection":       "Delimiter injection to impersonate a role",
+	"promptguard.encoded_payload":           "Encoded payload to evade inspection",
+	"promptguard.format_injection":          "Hidden instructions injected through formatting",
+	"promptguard.context_manipulation":      "Manipulation of the conversation context",
+	"promptguard.token_smuggling":           "Token smuggling to redirect instructions",
+	"promptguard.prompt_leak_indirect":      "Indirect prompt extraction through translation or summary",
+	"promptguard.instruction_override_vi":   "Instruction override in Vietnamese",
+	"promptguard.gradual_game_framing":      "Conversation framed as a game",
+	"promptguard.gradual_no_restrictions":   "Suggests the model has no restrictions",
+	"promptguard.gradual_stay_in_character": "Pushes the model to stay in character",
+	"promptguard.gradual_hypothetical":      "Hypothetical framing to evade moderation",
+	"promptguard.gradual_anything_goes":     "Suggests anything is allowed",
+	"promptguard.gradual_no_refusal":        "Demands that the model never refuse",
+	"promptguard.prompt_leak":               "The model may have revealed its system prompt",
+	"promptguard.harmful_content":           "The model produced attack instructions",
+	"promptguard.code_injection_output":     "Output contains malicious code execution calls",
+	"promptguard.jailbreak_success":         "The model appears to have been jailbroken",
+	"promptguard.canary_leak":               "Canary token leaked: session %s",
+
+	// Guardrail violations
+	"guardrail.dangerous_instructions": "Instructions for making dangerous items",
+	"guardrail.violence":               "Violent or harmful content",
+	"guardrail.cyber_attack":           "Cyber attack instructions",
+	"guardrail.theft_instructions":     "Instructions for stealing information",
+	"guardrail.self_harm":              "Self-harm content",
+	"guardrail.max_output_tokens":      "Output exceeds token limit: %d tokens (max: %d, %s)",
+	"guardrail.blocked_topic":          "Output contains blocked topic: %s",
+	"guardrail.session_rate_limit":     "Session %s exceeded %d requests/min",
+	"guardrail.output_schema":          "Output does not match schema: %s",
+	"guardrail.pii_in_output":          "Output leaks %s: %d found",
+}
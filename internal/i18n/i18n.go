@@ -0,0 +1,127 @@
+// Package i18n localizes the user-facing text of reports: audit findings
+// and summaries, risk labels, compliance results, prompt guard detections
+// and guardrail violations.
+//
+// Text is looked up by stable message IDs such as "audit.rule.code_execution".
+// Reports carry the ID next to the text, so machine consumers key off IDs and
+// never off wording. Vietnamese is the default and the fallback: a message
+// missing from a catalog is the Vietnamese text followed by its ID.
+package i18n
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Lang is a report language, by its ISO 639-1 code
+type Lang string
+
+const (
+	Vietnamese Lang = "vi"
+	English    Lang = "en"
+)
+
+// Default is the language of reports when none is selected
+const Default = Vietnamese
+
+// Code returns the language code of l, that of Default when l is empty
+func (l Lang) Code() Lang {
+	if l == "" {
+		return Default
+	}
+	return l
+}
+
+// catalogs maps every supported language to its messages by ID
+var catalogs = map[Lang]map[string]string{
+	Vietnamese: vi,
+	English:    en,
+}
+
+// Langs lists the supported languages, Default first
+func Langs() []Lang {
+	return []Lang{Vietnamese, English}
+}
+
+// Parse parses a language code such as "en" or a tag such as "en-GB";
+// empty is Default
+func Parse(s string) (Lang, error) {
+	if s == "" {
+		return Default, nil
+	}
+	if l, ok := match(s); ok {
+		return l, nil
+	}
+	return "", fmt.Errorf("unsupported language %q (supported: vi, en)", s)
+}
+
+// match returns the supported language of a tag by its primary subtag
+func match(tag string) (Lang, bool) {
+	primary, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	primary, _, _ = strings.Cut(primary, "_")
+	l := Lang(strings.ToLower(primary))
+	_, ok := catalogs[l]
+	return l, ok
+}
+
+// Negotiate returns the supported language an Accept-Language header
+// prefers most, or fallback when it names none
+func Negotiate(acceptLanguage string, fallback Lang) Lang {
+	type choice struct {
+		lang Lang
+		q    float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if l, ok := match(tag); ok && q > 0 {
+			choices = append(choices, choice{l, q})
+		}
+	}
+	if len(choices) == 0 {
+		return fallback
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	return choices[0].lang
+}
+
+// FromRequest returns the language r asks for with Accept-Language, or
+// fallback
+func FromRequest(r *http.Request, fallback Lang) Lang {
+	return Negotiate(r.Header.Get("Accept-Language"), fallback)
+}
+
+// T returns message id in lang, formatted with args. A message lang has no
+// text for is the Vietnamese text followed by the ID in brackets; one
+// missing from every catalog is the ID.
+func T(lang Lang, id string, args ...any) string {
+	if lang == "" {
+		lang = Default
+	}
+	text, ok := catalogs[lang][id]
+	if !ok {
+		if text, ok = catalogs[Default][id]; !ok {
+			return id
+		}
+		text += " [" + id + "]"
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// Has reports whether lang has its own text for id
+func Has(lang Lang, id string) bool {
+	_, ok := catalogs[lang][id]
+	return ok
+}
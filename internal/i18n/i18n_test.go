@@ -0,0 +1,83 @@
+package i18n
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCatalogs_Complete(t *testing.T) {
+	for _, l := range Langs() {
+		for id, text := range vi {
+			other, ok := catalogs[l][id]
+			if !ok {
+				t.Errorf("%s: %s missing", l, id)
+				continue
+			}
+			if strings.Count(other, "%") != strings.Count(text, "%") {
+				t.Errorf("%s: %s has different verbs than vi: %q vs %q", l, id, other, text)
+			}
+		}
+		for id := range catalogs[l] {
+			if _, ok := vi[id]; !ok {
+				t.Errorf("%s: %s is not in the vi catalog", l, id)
+			}
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T(English, "guardrail.blocked_topic", "weapons"); got != "Output contains blocked topic: weapons" {
+		t.Errorf("en = %q", got)
+	}
+	if got := T("", "audit.risk.high"); got != "Cao" {
+		t.Errorf("default = %q", got)
+	}
+	if got := T("fr", "audit.risk.high"); got != "Cao [audit.risk.high]" {
+		t.Errorf("unsupported language = %q", got)
+	}
+
+	delete(en, "audit.risk.high")
+	defer func() { en["audit.risk.high"] = "High" }()
+	if got := T(English, "audit.risk.high"); got != "Cao [audit.risk.high]" {
+		t.Errorf("missing translation = %q, want Vietnamese with the ID", got)
+	}
+	if got := T(English, "no.such.message"); got != "no.such.message" {
+		t.Errorf("unknown id = %q", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for in, want := range map[string]Lang{"": Default, "en": English, "EN-gb": English, "vi_VN": Vietnamese} {
+		if got, err := Parse(in); err != nil || got != want {
+			t.Errorf("Parse(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := Parse("fr"); err == nil {
+		t.Error("Parse(fr) accepted")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   Lang
+	}{
+		{"", Vietnamese},
+		{"en-US,en;q=0.9", English},
+		{"fr-FR, de;q=0.8, en;q=0.5", English},
+		{"vi;q=0.4, en;q=0.7", English},
+		{"en;q=0, vi", Vietnamese},
+		{"fr, *;q=0.1", Vietnamese},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.header, Vietnamese); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if got := FromRequest(r, English); got != English {
+		t.Errorf("no header = %q, want the fallback", got)
+	}
+}
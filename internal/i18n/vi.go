@@ -0,0 +1,214 @@
+package i18n
+
+// vi is the Vietnamese catalog, the reference every other catalog
+// translates
+var vi = map[string]string{
+	// Auditor rules, by category
+	"audit.rule.credential_access":   "Chỉ dẫn truy cập thông tin xác thực / mật khẩu",
+	"audit.rule.data_exfiltration":   "Chỉ dẫn gửi dữ liệu ra ngoài hệ thống",
+	"audit.rule.security_bypass":     "Chỉ dẫn bỏ qua cơ chế bảo mật",
+	"audit.rule.mass_collection":     "Thu thập hàng loạt dữ liệu cá nhân",
+	"audit.rule.audit_destruction":   "Chỉ dẫn xóa bản ghi kiểm toán",
+	"audit.rule.code_execution":      "Chỉ dẫn thực thi mã tùy ý",
+	"audit.rule.consent_violation":   "Hành động không có sự đồng ý của người dùng",
+	"audit.rule.surveillance":        "Giám sát người dùng trái phép",
+	"audit.rule.sensitive_storage":   "Lưu trữ dữ liệu nhạy cảm cao",
+	"audit.rule.data_sharing":        "Chia sẻ dữ liệu cá nhân cho bên thứ ba",
+	"audit.rule.url_fetch_injection": "Chỉ dẫn đọc/fetch URL/link ngoài trong skill — vector injection gián tiếp",
+	"audit.rule.skill_tampering":     "Chỉ dẫn xóa/sửa/bỏ skill hoặc file chỉ dẫn",
+	"audit.rule.indirect_injection":  "Chỉ dẫn follow/execute instructions từ nguồn bên ngoài",
+	"audit.rule.data_post_external":  "Chỉ dẫn POST/gửi data khách hàng ra endpoint cụ thể",
+	"audit.obfuscated":               "[Ngụy trang] %s",
+
+	// Auditor behavior chains, by name
+	"audit.chain.data_exfiltration":  "Đọc file rồi gửi HTTP = nghi ngờ rò rỉ dữ liệu",
+	"audit.chain.db_exfiltration":    "Truy vấn DB rồi gửi HTTP = nghi ngờ rò rỉ CSDL",
+	"audit.chain.credential_theft":   "Truy cập credentials rồi gửi ra ngoài",
+	"audit.chain.cover_tracks":       "Thực thi mã rồi xóa file = xóa dấu vết",
+	"audit.chain.reverse_shell":      "Thực thi mã + kết nối mạng = nghi ngờ reverse shell",
+	"audit.chain.indirect_injection": "Đọc URL rồi sửa skill = injection gián tiếp",
+	"audit.chain.url_data_exfil":     "Đọc URL rồi gửi dữ liệu ra ngoài",
+	"audit.chain.skill_sabotage":     "Xóa skill rồi gửi dữ liệu = phá hoại + rò rỉ",
+
+	// Auditor findings about the analysis itself
+	"audit.truncated_line":         "Dòng %d byte được cắt còn %d byte để phân tích",
+	"audit.incomplete.deobfuscate": "Bước chống lẩn tránh hết ngân sách %s trên %d dòng",
+	"audit.incomplete.behavior":    "Bước phân tích chuỗi hành vi dừng sau ngân sách %s; chuỗi chỉ được so khớp trên các dòng đã quét",
+	"audit.incomplete.cross_file":  "Bước phân tích chuỗi liên file dừng sau ngân sách %s; chuỗi chỉ được so khớp trên các dòng đã quét",
+
+	// Suspicious URLs
+	"audit.url.shortener": "URL shortener — có thể ẩn đích thực",
+	"audit.url.ip":        "URL dùng IP thay vì domain — có thể tránh blocklist",
+	"audit.url.hex":       "URL chứa hex encoding — có thể obfuscate đường dẫn",
+
+	// Risk levels per Vietnam AI Law 2026
+	"audit.risk.minimal":      "Tối thiểu",
+	"audit.risk.limited":      "Hạn chế",
+	"audit.risk.high":         "Cao",
+	"audit.risk.unacceptable": "Không chấp nhận được",
+
+	// Audit summaries
+	"audit.summary.clean":       "Skill.md tuân thủ tốt. Không phát hiện chỉ dẫn nguy hiểm.",
+	"audit.summary.issues":      "Phát hiện %s. Mức rủi ro: %s.",
+	"audit.summary.critical":    "%d vấn đề nghiêm trọng",
+	"audit.summary.high":        "%d vấn đề cao",
+	"audit.summary.medium":      "%d vấn đề trung bình",
+	"audit.summary.occurrences": "tổng cộng %d lần xuất hiện",
+	"audit.summary.project":     "%d file, %d chuỗi liên file. %s",
+
+	// Audit HTML report
+	"audit.html.title":           "Báo cáo kiểm toán Agent Veil",
+	"audit.html.risk_level":      "Mức rủi ro",
+	"audit.html.score":           "Điểm tuân thủ",
+	"audit.html.rules_profile":   "Bộ quy tắc",
+	"audit.html.findings":        "Phát hiện",
+	"audit.html.line":            "Dòng",
+	"audit.html.severity":        "Mức độ",
+	"audit.html.category":        "Loại",
+	"audit.html.description":     "Mô tả",
+	"audit.html.behavior_chains": "Chuỗi hành vi",
+	"audit.html.weight":          "trọng số",
+
+	// Compliance requirements: Vietnam AI Law 2026
+	"compliance.VN-AI-01.article":     "Điều 12",
+	"compliance.VN-AI-01.title":       "Bảo vệ dữ liệu cá nhân",
+	"compliance.VN-AI-01.description": "Hệ thống AI phải phát hiện và ẩn danh hóa dữ liệu cá nhân trước khi xử lý",
+	"compliance.VN-AI-01.details":     "Phát hiện & ẩn danh hóa dữ liệu cá nhân",
+	"compliance.VN-AI-02.article":     "Điều 15",
+	"compliance.VN-AI-02.title":       "Đồng ý của chủ thể dữ liệu",
+	"compliance.VN-AI-02.description": "Thu thập và xử lý dữ liệu cá nhân phải có sự đồng ý của chủ thể",
+	"compliance.VN-AI-02.details":     "Cơ chế đồng ý người dùng",
+	"compliance.VN-AI-03.article":     "Điều 20",
+	"compliance.VN-AI-03.title":       "Nhật ký hoạt động AI",
+	"compliance.VN-AI-03.description": "Ghi nhận đầy đủ nhật ký hoạt động của hệ thống AI để kiểm toán",
+	"compliance.VN-AI-03.details":     "Nhật ký kiểm toán có cấu trúc",
+	"compliance.VN-AI-04.article":     "Điều 26",
+	"compliance.VN-AI-04.title":       "Lưu trữ dữ liệu trong nước",
+	"compliance.VN-AI-04.description": "Dữ liệu cá nhân công dân Việt Nam phải được lưu trữ trong lãnh thổ Việt Nam",
+	"compliance.VN-AI-04.details":     "Dữ liệu lưu trữ trong lãnh thổ Việt Nam",
+	"compliance.VN-AI-05.article":     "Điều 30",
+	"compliance.VN-AI-05.title":       "Đánh giá rủi ro AI",
+	"compliance.VN-AI-05.description": "Hệ thống AI phải được đánh giá và phân loại mức độ rủi ro",
+	"compliance.VN-AI-05.details":     "Kiểm toán skill.md cho AI agents",
+	"compliance.VN-AI-06.article":     "Điều 35",
+	"compliance.VN-AI-06.title":       "An ninh dữ liệu",
+	"compliance.VN-AI-06.description": "Mã hóa dữ liệu tại chỗ và trong quá trình truyền tải",
+	"compliance.VN-AI-06.details":     "Mã hóa dữ liệu tại chỗ và truyền tải",
+	"compliance.VN-AI-07.article":     "Điều 38",
+	"compliance.VN-AI-07.title":       "Kiểm soát truy cập",
+	"compliance.VN-AI-07.description": "Phân quyền truy cập dựa trên vai trò và nguyên tắc tối thiểu quyền",
+	"compliance.VN-AI-07.details":     "Kiểm soát truy cập theo vai trò",
+
+	// Compliance requirements: EU AI Act
+	"compliance.EU-AI-01.article":     "Art. 9",
+	"compliance.EU-AI-01.title":       "Hệ thống quản lý rủi ro",
+	"compliance.EU-AI-01.description": "Thiết lập và duy trì hệ thống quản lý rủi ro cho AI rủi ro cao",
+	"compliance.EU-AI-01.details":     "Đánh giá rủi ro cho hệ thống AI",
+	"compliance.EU-AI-02.article":     "Art. 14",
+	"compliance.EU-AI-02.title":       "Giám sát của con người",
+	"compliance.EU-AI-02.description": "Bảo đảm biện pháp giám sát phù hợp của con người đối với hệ thống AI",
+	"compliance.EU-AI-02.details":     "Khả năng giám sát của con người",
+	"compliance.EU-AI-03.article":     "Art. 13",
+	"compliance.EU-AI-03.title":       "Minh bạch",
+	"compliance.EU-AI-03.description": "Hệ thống AI phải được thiết kế để minh bạch và giải thích được",
+	"compliance.EU-AI-03.details":     "Minh bạch và tài liệu hóa",
+	"compliance.EU-AI-04.article":     "Art. 12",
+	"compliance.EU-AI-04.title":       "Lưu giữ hồ sơ",
+	"compliance.EU-AI-04.description": "Lưu nhật ký hoạt động của hệ thống AI để truy vết",
+	"compliance.EU-AI-04.details":     "Lưu giữ hồ sơ hoạt động AI",
+	"compliance.EU-AI-05.article":     "Art. 15",
+	"compliance.EU-AI-05.title":       "Chính xác và vững chắc",
+	"compliance.EU-AI-05.description": "Bảo đảm hệ thống AI đạt mức chính xác, vững chắc và an ninh mạng phù hợp",
+	"compliance.EU-AI-05.details":     "Chính xác, vững chắc và an ninh mạng",
+
+	// Compliance requirements: GDPR
+	"compliance.GDPR-01.article":     "Art. 5(1)(c)",
+	"compliance.GDPR-01.title":       "Tối thiểu hóa dữ liệu",
+	"compliance.GDPR-01.description": "Chỉ xử lý dữ liệu cần thiết cho mục đích",
+	"compliance.GDPR-01.details":     "Tối thiểu hóa dữ liệu (Art. 5(1)(c))",
+	"compliance.GDPR-02.article":     "Art. 6",
+	"compliance.GDPR-02.title":       "Cơ sở pháp lý để xử lý",
+	"compliance.GDPR-02.description": "Bảo đảm cơ sở pháp lý cho việc xử lý dữ liệu, bao gồm sự đồng ý",
+	"compliance.GDPR-02.details":     "Cơ sở pháp lý để xử lý (Art. 6)",
+	"compliance.GDPR-03.article":     "Art. 17",
+	"compliance.GDPR-03.title":       "Quyền được xóa",
+	"compliance.GDPR-03.description": "Chủ thể dữ liệu có quyền yêu cầu xóa dữ liệu của mình",
+	"compliance.GDPR-03.details":     "Quyền được xóa (Art. 17)",
+	"compliance.GDPR-04.article":     "Art. 20",
+	"compliance.GDPR-04.title":       "Khả năng di chuyển dữ liệu",
+	"compliance.GDPR-04.description": "Chủ thể dữ liệu có quyền nhận dữ liệu của mình ở định dạng di chuyển được",
+	"compliance.GDPR-04.details":     "Khả năng di chuyển dữ liệu (Art. 20)",
+	"compliance.GDPR-05.article":     "Art. 32",
+	"compliance.GDPR-05.title":       "An ninh khi xử lý",
+	"compliance.GDPR-05.description": "Áp dụng biện pháp an ninh kỹ thuật và tổ chức phù hợp",
+	"compliance.GDPR-05.details":     "An ninh khi xử lý (Art. 32)",
+	"compliance.GDPR-06.article":     "Art. 30",
+	"compliance.GDPR-06.title":       "Hồ sơ hoạt động xử lý",
+	"compliance.GDPR-06.description": "Lưu hồ sơ các hoạt động xử lý",
+	"compliance.GDPR-06.details":     "Hồ sơ hoạt động xử lý (Art. 30)",
+
+	"compliance.unknown_requirement": "Yêu cầu không xác định",
+
+	// Compliance statuses and frameworks
+	"compliance.status.compliant":          "Đạt",
+	"compliance.status.non_compliant":      "Không đạt",
+	"compliance.status.partial":            "Một phần",
+	"compliance.status.not_applicable":     "N/A",
+	"compliance.status.unknown":            "Không xác định",
+	"compliance.framework.vietnam_ai_2026": "Luật AI Việt Nam 2026",
+	"compliance.framework.eu_ai_act":       "EU AI Act",
+	"compliance.framework.gdpr":            "GDPR",
+	"compliance.summary":                   "Đánh giá tuân thủ: %.0f/100. Đạt: %d, Không đạt: %d, Một phần: %d trên tổng %d yêu cầu.",
+
+	// Compliance HTML reports
+	"compliance.html.title":           "Báo cáo tuân thủ Agent Veil",
+	"compliance.html.fleet_title":     "Báo cáo tuân thủ Agent Veil theo cụm",
+	"compliance.html.generated":       "Tạo lúc",
+	"compliance.html.id":              "Mã",
+	"compliance.html.article":         "Điều khoản",
+	"compliance.html.requirement":     "Yêu cầu",
+	"compliance.html.requirements":    "Các yêu cầu",
+	"compliance.html.status":          "Trạng thái",
+	"compliance.html.details":         "Chi tiết",
+	"compliance.html.recommendations": "Khuyến nghị",
+	"compliance.html.instances":       "Các instance",
+	"compliance.html.instance":        "Instance",
+	"compliance.html.score":           "Điểm",
+	"compliance.html.worst_instance":  "Instance kém nhất",
+
+	// Prompt guard detections, by category
+	"promptguard.instruction_override":      "Cố gắng ghi đè chỉ dẫn hệ thống",
+	"promptguard.prompt_extraction":         "Cố gắng trích xuất system prompt",
+	"promptguard.jailbreak_roleplay":        "Tấn công jailbreak qua role-play",
+	"promptguard.jailbreak_dan":             "Tấn công jailbreak kiểu DAN",
+	"promptguard.delimiter_injection":       "Tiêm dấu phân cách để giả mạo vai trò",
+	"promptguard.encoded_payload":           "Payload mã hóa để lẩn tránh kiểm tra",
+	"promptguard.format_injection":          "Chèn chỉ dẫn ẩn qua định dạng",
+	"promptguard.context_manipulation":      "Thao túng ngữ cảnh hội thoại",
+	"promptguard.token_smuggling":           "Lén chèn token để chuyển hướng chỉ dẫn",
+	"promptguard.prompt_leak_indirect":      "Trích xuất prompt gián tiếp qua dịch/tóm tắt",
+	"promptguard.instruction_override_vi":   "Ghi đè chỉ dẫn bằng tiếng Việt",
+	"promptguard.gradual_game_framing":      "Đóng khung hội thoại thành trò chơi",
+	"promptguard.gradual_no_restrictions":   "Gợi ý mô hình không bị giới hạn",
+	"promptguard.gradual_stay_in_character": "Ép mô hình giữ vai diễn",
+	"promptguard.gradual_hypothetical":      "Đóng khung giả định để né kiểm duyệt",
+	"promptguard.gradual_anything_goes":     "Gợi ý mọi thứ đều được phép",
+	"promptguard.gradual_no_refusal":        "Yêu cầu mô hình không được từ chối",
+	"promptguard.prompt_leak":               "LLM có thể đã tiết lộ system prompt",
+	"promptguard.harmful_content":           "LLM tạo nội dung hướng dẫn tấn công",
+	"promptguard.code_injection_output":     "Output chứa lệnh thực thi mã độc",
+	"promptguard.jailbreak_success":         "LLM có vẻ đã bị jailbreak thành công",
+	"promptguard.canary_leak":               "Lộ canary token: phiên %s",
+
+	// Guardrail violations
+	"guardrail.dangerous_instructions": "Hướng dẫn tạo vật phẩm nguy hiểm",
+	"guardrail.violence":               "Nội dung bạo lực / gây hại",
+	"guardrail.cyber_attack":           "Hướng dẫn tấn công mạng",
+	"guardrail.theft_instructions":     "Hướng dẫn đánh cắp thông tin",
+	"guardrail.self_harm":              "Nội dung tự gây hại",
+	"guardrail.max_output_tokens":      "Output vượt giới hạn token: %d token (tối đa: %d, %s)",
+	"guardrail.blocked_topic":          "Output chứa chủ đề bị chặn: %s",
+	"guardrail.session_rate_limit":     "Phiên %s vượt quá %d yêu cầu/phút",
+	"guardrail.output_schema":          "Output không khớp schema: %s",
+	"guardrail.pii_in_output":          "Output làm lộ %s: tìm thấy %d",
+}
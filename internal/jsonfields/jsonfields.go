@@ -0,0 +1,185 @@
+// Package jsonfields reads and rewrites the strings of JSON documents by
+// path, such as the model output fields of LLM responses, leaving the rest
+// of a document as it was.
+//
+// Paths join object keys with "." and write array elements as "[]":
+// "choices.[].message.content".
+package jsonfields
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// contentFields are the JSON paths of response fields that carry model
+// output, with array elements written as "[]". Ids, error messages,
+// system_fingerprint, logprobs and the rest of a response are not output.
+var contentFields = map[string]bool{
+	// OpenAI chat completions, streamed and not, and legacy completions
+	"choices.[].message.content":                          true,
+	"choices.[].delta.content":                            true,
+	"choices.[].text":                                     true,
+	"choices.[].message.tool_calls.[].function.arguments": true,
+	"choices.[].delta.tool_calls.[].function.arguments":   true,
+	// Anthropic messages, and the content_block_start and
+	// content_block_delta stream events
+	"content.[].text":    true,
+	"content_block.text": true,
+	"delta.text":         true,
+	"delta.partial_json": true,
+	// Gemini generateContent
+	"candidates.[].content.parts.[].text": true,
+}
+
+// contentTrees are paths under which every string is model output: tool
+// call inputs given as JSON objects rather than strings
+var contentTrees = []string{
+	"content.[].input",
+	"content_block.input",
+	"candidates.[].content.parts.[].functionCall.args",
+}
+
+// IsContent reports whether a string at path is model output, in an
+// OpenAI, Anthropic or Gemini response or stream chunk
+func IsContent(path string) bool {
+	if contentFields[path] {
+		return true
+	}
+	for _, tree := range contentTrees {
+		if path == tree || strings.HasPrefix(path, tree+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Rewrite applies replace to the strings of a JSON document whose path
+// field accepts and copies everything else byte for byte: key order,
+// numbers and escaping stay as they were. ok is false when body is not
+// valid JSON.
+func Rewrite(body []byte, field func(path string) bool, replace func(string) string) (out []byte, ok bool) {
+	type frame struct {
+		array   bool
+		wantKey bool
+	}
+	var (
+		stack   []frame
+		path    []string
+		key     string
+		buf     bytes.Buffer
+		copied  int
+		changed bool
+	)
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for {
+		before := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+
+		if n := len(stack); n > 0 && !stack[n-1].array && stack[n-1].wantKey {
+			if d, isDelim := tok.(json.Delim); !isDelim || d != '}' {
+				key, _ = tok.(string)
+				stack[n-1].wantKey = false
+				continue
+			}
+		}
+
+		if d, isDelim := tok.(json.Delim); isDelim && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+			if n := len(stack); n > 0 && !stack[n-1].array {
+				stack[n-1].wantKey = true
+			}
+			continue
+		}
+
+		// tok is a value; find where it sits
+		valuePath := path
+		if n := len(stack); n > 0 {
+			elem := key
+			if stack[n-1].array {
+				elem = "[]"
+			}
+			valuePath = append(path[:len(path):len(path)], elem)
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			stack = append(stack, frame{array: v == '[', wantKey: v == '{'})
+			if len(stack) > 1 {
+				path = valuePath
+			}
+			continue
+		case string:
+			if field(strings.Join(valuePath, ".")) {
+				if r := replace(v); r != v {
+					start := before + bytes.IndexByte(body[before:], '"')
+					buf.Write(body[copied:start])
+					buf.Write(MarshalString(r))
+					copied = int(dec.InputOffset())
+					changed = true
+				}
+			}
+		}
+		if n := len(stack); n > 0 && !stack[n-1].array {
+			stack[n-1].wantKey = true
+		}
+	}
+
+	if len(stack) > 0 {
+		// Token reports a truncated document as a clean EOF
+		return nil, false
+	}
+	if !changed {
+		return body, true
+	}
+	buf.Write(body[copied:])
+	return buf.Bytes(), true
+}
+
+// MarshalString encodes s as a JSON string without HTML escaping
+func MarshalString(s string) []byte {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return bytes.TrimRight(b.Bytes(), "\n")
+}
+
+// StringValues returns every string in a decoded JSON value, object
+// members in key order
+func StringValues(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, e := range v {
+			out = append(out, StringValues(e)...)
+		}
+		return out
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var out []string
+		for _, k := range keys {
+			out = append(out, StringValues(v[k])...)
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package jsonfields
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	body := `{"id":9007199254740993,"choices":[{"message":{"content":"a <b>"},"logprobs":{"content":"a"}}],"z":1}`
+	out, ok := Rewrite([]byte(body), IsContent, strings.ToUpper)
+	want := `{"id":9007199254740993,"choices":[{"message":{"content":"A <B>"},"logprobs":{"content":"a"}}],"z":1}`
+	if !ok || string(out) != want {
+		t.Errorf("Rewrite = %s, %v; want %s", out, ok, want)
+	}
+
+	// Strings under a content tree, such as tool call arguments
+	body = `{"candidates":[{"content":{"parts":[{"functionCall":{"name":"f","args":{"q":["x",{"y":"z"}]}}}]}}]}`
+	out, _ = Rewrite([]byte(body), IsContent, strings.ToUpper)
+	if want := strings.NewReplacer(`"x"`, `"X"`, `"z"`, `"Z"`).Replace(body); string(out) != want {
+		t.Errorf("Rewrite = %s, want %s", out, want)
+	}
+
+	for _, bad := range []string{`{"content":`, `not json`} {
+		if _, ok := Rewrite([]byte(bad), IsContent, strings.ToUpper); ok {
+			t.Errorf("%q: expected ok = false", bad)
+		}
+	}
+}
+
+func TestStringValues(t *testing.T) {
+	var v any
+	json.Unmarshal([]byte(`{"b":["x",1,{"c":"y"}],"a":"Nguyễn"}`), &v)
+	if got := strings.Join(StringValues(v), ","); got != "Nguyễn,x,y" {
+		t.Errorf("StringValues = %q", got)
+	}
+}
@@ -7,9 +7,10 @@ import (
 	"strings"
 )
 
-// Setup initializes structured JSON logging at the given level.
-// Returns the logger instance.
-func Setup(level string, w io.Writer) *slog.Logger {
+// Setup initializes structured JSON logging at the given level and makes it
+// the default for both slog and the standard log package. With redact, every
+// record passes through a RedactHandler first. Returns the logger instance.
+func Setup(level string, w io.Writer, redact bool) *slog.Logger {
 	if w == nil {
 		w = os.Stdout
 	}
@@ -26,9 +27,12 @@ func Setup(level string, w io.Writer) *slog.Logger {
 		lvl = slog.LevelInfo
 	}
 
-	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+	var handler slog.Handler = slog.NewJSONHandler(w, &slog.HandlerOptions{
 		Level: lvl,
 	})
+	if redact {
+		handler = NewRedactHandler(handler)
+	}
 
 	logger := slog.New(handler)
 	slog.SetDefault(logger)
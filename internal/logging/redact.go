@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/vurakit/agentveil/internal/detector"
+)
+
+// minRedactLen is the shortest string scanned; no secret pattern matches
+// anything shorter
+const minRedactLen = 12
+
+// RedactHandler wraps a slog.Handler and partially masks secrets (API keys,
+// tokens, passwords) in the message and string attributes of every record
+// before it is written. Header values and URLs end up in log lines through
+// errors, so error and fmt.Stringer attributes are masked as strings too.
+type RedactHandler struct {
+	inner slog.Handler
+	det   *detector.Detector
+}
+
+// NewRedactHandler returns inner wrapped with a secrets-only detector
+func NewRedactHandler(inner slog.Handler) *RedactHandler {
+	return &RedactHandler{
+		inner: inner,
+		det: detector.NewWithConfig(detector.Config{
+			Sensitivity:   detector.SensitivityMedium,
+			EnableSecrets: true,
+		}),
+	}
+}
+
+// Enabled reports whether the wrapped handler handles level
+func (h *RedactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+// Handle masks the record's message and attributes, then passes it on
+func (h *RedactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, h.redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return h.inner.Handle(ctx, out)
+}
+
+// WithAttrs masks attrs once, when they are attached
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		masked[i] = h.redactAttr(a)
+	}
+	return &RedactHandler{inner: h.inner.WithAttrs(masked), det: h.det}
+}
+
+// WithGroup returns a handler for attributes under the group name
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	return &RedactHandler{inner: h.inner.WithGroup(name), det: h.det}
+}
+
+func (h *RedactHandler) redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		masked := make([]any, len(group))
+		for i, ga := range group {
+			masked[i] = h.redactAttr(ga)
+		}
+		return slog.Group(a.Key, masked...)
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, h.redact(x.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, h.redact(x.String()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// redact replaces each secret in s with its partial mask
+func (h *RedactHandler) redact(s string) string {
+	if len(s) < minRedactLen {
+		return s
+	}
+	masked, _ := h.det.AnonymizeMatches(s)
+	return masked
+}
@@ -0,0 +1,335 @@
+// Package metrics counts proxy events and serves them on /metrics in the
+// Prometheus text format.
+//
+// Components report events through a Recorder, so none of them depends on
+// the exposition format. Labels carry categories, rules, limiters, providers
+// and routes, never request content.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Path is where Handler is served
+const Path = "/metrics"
+
+// Recorder receives the events counted on /metrics
+type Recorder interface {
+	PIIDetected(category string, n int)
+	InjectionBlocked(category string)
+	GuardrailViolation(rule, outcome string) // outcome: blocked, warned or break_glass
+	RateLimited(limiter string)
+	ProviderSelected(provider string)
+	FallbackAttempt(provider string)
+	UpstreamLatency(provider string, d time.Duration)
+}
+
+// Nop discards every event, the Recorder of components not given one
+type Nop struct{}
+
+func (Nop) PIIDetected(string, int)               {}
+func (Nop) InjectionBlocked(string)               {}
+func (Nop) GuardrailViolation(string, string)     {}
+func (Nop) RateLimited(string)                    {}
+func (Nop) ProviderSelected(string)               {}
+func (Nop) FallbackAttempt(string)                {}
+func (Nop) UpstreamLatency(string, time.Duration) {}
+
+// LatencyBuckets are the upper bounds, in seconds, of the upstream latency
+// histogram. Completions take seconds, so the buckets reach a minute.
+var LatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// maxRoutes caps the distinct route labels; further routes count as "other"
+// so that scanning clients can't grow the series without bound
+const maxRoutes = 64
+
+// Registry is a Recorder that keeps every counter in memory and serves them
+type Registry struct {
+	requests   *counterVec
+	pii        *counterVec
+	injections *counterVec
+	guardrail  *counterVec
+	rateLimits *counterVec
+	selections *counterVec
+	fallbacks  *counterVec
+	latency    *histogramVec
+
+	mu     sync.Mutex
+	routes map[string]bool
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		requests:   newCounterVec("veil_requests_total", "Requests served, by route and status code.", "route", "code"),
+		pii:        newCounterVec("veil_pii_detected_total", "PII entities anonymized in requests, by category.", "category"),
+		injections: newCounterVec("veil_prompt_injections_blocked_total", "Requests blocked for prompt injection, by detection category.", "category"),
+		guardrail:  newCounterVec("veil_guardrail_violations_total", "Guardrail violations, by rule and outcome.", "rule", "outcome"),
+		rateLimits: newCounterVec("veil_rate_limited_total", "Requests rejected by a rate limiter.", "limiter"),
+		selections: newCounterVec("veil_provider_selected_total", "Requests forwarded to a provider in router mode.", "provider"),
+		fallbacks:  newCounterVec("veil_fallback_attempts_total", "Requests retried on a provider after another failed.", "provider"),
+		latency:    newHistogramVec("veil_upstream_latency_seconds", "Time from forwarding a request to the upstream's response headers.", LatencyBuckets, "provider"),
+		routes:     make(map[string]bool),
+	}
+}
+
+// The Recorder methods add to the counters of Handler
+
+func (r *Registry) PIIDetected(category string, n int) { r.pii.add(float64(n), category) }
+func (r *Registry) InjectionBlocked(category string)   { r.injections.add(1, category) }
+func (r *Registry) GuardrailViolation(rule, outcome string) {
+	r.guardrail.add(1, rule, outcome)
+}
+func (r *Registry) RateLimited(limiter string)       { r.rateLimits.add(1, limiter) }
+func (r *Registry) ProviderSelected(provider string) { r.selections.add(1, provider) }
+func (r *Registry) FallbackAttempt(provider string)  { r.fallbacks.add(1, provider) }
+func (r *Registry) UpstreamLatency(provider string, d time.Duration) {
+	r.latency.observe(d.Seconds(), provider)
+}
+
+// Middleware counts every request by route and status code
+func (r *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, req)
+		code := sw.status
+		if code == 0 {
+			code = http.StatusOK
+		}
+		r.requests.add(1, r.route(req.URL.Path), strconv.Itoa(code))
+	})
+}
+
+// route reduces path to a label: at most three segments, with segments
+// holding digits or a model action (models/gemini-pro:generateContent)
+// replaced by {id}
+func (r *Registry) route(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 3 {
+		segments = segments[:3]
+	}
+	for i, seg := range segments {
+		if strings.ContainsAny(seg, "0123456789:") && !isVersion(seg) {
+			segments[i] = "{id}"
+		}
+	}
+	route := "/" + strings.Join(segments, "/")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.routes[route] {
+		if len(r.routes) >= maxRoutes {
+			return "other"
+		}
+		r.routes[route] = true
+	}
+	return route
+}
+
+// isVersion reports whether seg is an API version such as v1 or v1beta
+func isVersion(seg string) bool {
+	if len(seg) < 2 || seg[0] != 'v' || seg[1] < '0' || seg[1] > '9' {
+		return false
+	}
+	return !strings.ContainsAny(seg, ":-_.")
+}
+
+// Handler serves every metric in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// WriteTo writes every metric in the Prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	for _, c := range []*counterVec{r.requests, r.pii, r.injections, r.guardrail, r.rateLimits, r.selections, r.fallbacks} {
+		c.write(&sb)
+	}
+	r.latency.write(&sb)
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// Transport reports the time to response headers of every request through
+// next as the upstream latency of provider
+func Transport(rec Recorder, provider string, next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		if err == nil {
+			rec.UpstreamLatency(provider, time.Since(start))
+		}
+		return resp, err
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// statusWriter records the status code written through it
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach Flush on the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// counterVec is a counter per label set
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // by formatted label set
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counterVec) add(v float64, values ...string) {
+	key := labelSet(c.labels, values)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(sb *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(sb, "%s%s %s\n", c.name, key, formatValue(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram per label set
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(v float64, values ...string) {
+	key := labelSet(h.labels, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.count++
+	hist.sum += v
+}
+
+func (h *histogramVec) write(sb *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.values) {
+		hist := h.values[key]
+		// Bucket labels go after the others: {provider="x",le="0.5"}
+		prefix := "{"
+		if key != "" {
+			prefix = strings.TrimSuffix(key, "}") + ","
+		}
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(sb, "%s_bucket%sle=\"%s\"} %d\n", h.name, prefix, formatValue(le), cumulative)
+		}
+		fmt.Fprintf(sb, "%s_bucket%sle=\"+Inf\"} %d\n", h.name, prefix, hist.count)
+		fmt.Fprintf(sb, "%s_sum%s %s\n", h.name, key, formatValue(hist.sum))
+		fmt.Fprintf(sb, "%s_count%s %d\n", h.name, key, hist.count)
+	}
+}
+
+// labelSet formats names and values as {name="value",...}
+func labelSet(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		fmt.Fprintf(&sb, "%s=\"%s\"", name, labelEscaper.Replace(v))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// labelEscaper escapes label values as the text format expects
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
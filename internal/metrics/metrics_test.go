@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, reg *Registry) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, Path, nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	return w.Body.String()
+}
+
+func TestRegistry_Counters(t *testing.T) {
+	reg := NewRegistry()
+	reg.PIIDetected("EMAIL", 2)
+	reg.PIIDetected("EMAIL", 1)
+	reg.InjectionBlocked("jailbreak")
+	reg.GuardrailViolation(`custom "quoted"\rule`, "blocked")
+	reg.RateLimited("global")
+	reg.ProviderSelected("openai")
+	reg.FallbackAttempt("anthropic")
+
+	out := scrape(t, reg)
+	for _, want := range []string{
+		"# TYPE veil_pii_detected_total counter",
+		`veil_pii_detected_total{category="EMAIL"} 3`,
+		`veil_prompt_injections_blocked_total{category="jailbreak"} 1`,
+		`veil_guardrail_violations_total{rule="custom \"quoted\"\\rule",outcome="blocked"} 1`,
+		`veil_rate_limited_total{limiter="global"} 1`,
+		`veil_provider_selected_total{provider="openai"} 1`,
+		`veil_fallback_attempts_total{provider="anthropic"} 1`,
+		"# TYPE veil_upstream_latency_seconds histogram",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in:\n%s", want, out)
+		}
+	}
+}
+
+func TestRegistry_Histogram(t *testing.T) {
+	reg := NewRegistry()
+	for _, d := range []time.Duration{80 * time.Millisecond, 2 * time.Second, 2 * time.Minute} {
+		reg.UpstreamLatency("openai", d)
+	}
+
+	out := scrape(t, reg)
+	for _, want := range []string{
+		`veil_upstream_latency_seconds_bucket{provider="openai",le="0.05"} 0`,
+		`veil_upstream_latency_seconds_bucket{provider="openai",le="0.1"} 1`,
+		`veil_upstream_latency_seconds_bucket{provider="openai",le="2.5"} 2`,
+		`veil_upstream_latency_seconds_bucket{provider="openai",le="60"} 2`,
+		`veil_upstream_latency_seconds_bucket{provider="openai",le="+Inf"} 3`,
+		`veil_upstream_latency_seconds_sum{provider="openai"} 122.08`,
+		`veil_upstream_latency_seconds_count{provider="openai"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in:\n%s", want, out)
+		}
+	}
+}
+
+func TestMiddleware_Routes(t *testing.T) {
+	reg := NewRegistry()
+	h := reg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	for _, path := range []string{
+		"/v1/chat/completions",
+		"/v1/chat/completions",
+		"/v1beta/models/gemini-1.5-pro:generateContent",
+		"/admin/sessions/3f2a9c",
+		"/missing",
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+
+	out := scrape(t, reg)
+	for _, want := range []string{
+		`veil_requests_total{route="/v1/chat/completions",code="200"} 2`,
+		`veil_requests_total{route="/v1beta/models/{id}",code="200"} 1`,
+		`veil_requests_total{route="/admin/sessions/{id}",code="200"} 1`,
+		`veil_requests_total{route="/missing",code="404"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in:\n%s", want, out)
+		}
+	}
+}
+
+func TestMiddleware_RouteCap(t *testing.T) {
+	reg := NewRegistry()
+	h := reg.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for i := range maxRoutes + 10 {
+		path := "/probe-" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/scanner/abc", nil))
+
+	out := scrape(t, reg)
+	if !strings.Contains(out, `veil_requests_total{route="other",code="200"}`) {
+		t.Errorf("routes past the cap should count as other:\n%s", out)
+	}
+	if strings.Contains(out, "/scanner/abc") {
+		t.Error("a route past the cap got its own series")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer upstream.Close()
+	reg := NewRegistry()
+	client := &http.Client{Transport: Transport(reg, "upstream", http.DefaultTransport)}
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	client.Get("http://127.0.0.1:1")
+
+	if out := scrape(t, reg); !strings.Contains(out, `veil_upstream_latency_seconds_count{provider="upstream"} 1`) {
+		t.Errorf("a response and a transport error should count once:\n%s", out)
+	}
+}
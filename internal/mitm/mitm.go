@@ -0,0 +1,246 @@
+// Package mitm is an HTTPS forward proxy for tools that ignore base-URL
+// settings but honor HTTPS_PROXY.
+//
+// CONNECT requests to allowlisted LLM hosts are intercepted: the tunnel is
+// terminated with a certificate minted by a local CA (agentveil setup
+// --gen-ca) and the decrypted requests, HTTP/1.1 or h2, are served by that
+// host's handler, normally the same anonymize/guard/rehydrate pipeline as
+// the main listener. Every other host is tunneled untouched.
+package mitm
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHosts are intercepted when no allowlist is configured
+var DefaultHosts = []string{
+	"api.openai.com",
+	"api.anthropic.com",
+	"generativelanguage.googleapis.com",
+}
+
+// Config configures the forward-proxy listener
+type Config struct {
+	Addr   string   // listen address, e.g. 127.0.0.1:8443
+	Hosts  []string // hostnames to intercept
+	CACert string   // PEM CA certificate
+	CAKey  string   // PEM CA private key
+}
+
+// DefaultConfig intercepts DefaultHosts with the CA from DefaultCAPaths
+func DefaultConfig() Config {
+	cert, key := DefaultCAPaths()
+	return Config{Hosts: append([]string(nil), DefaultHosts...), CACert: cert, CAKey: key}
+}
+
+// dialTimeout bounds connecting to a tunneled host
+const dialTimeout = 10 * time.Second
+
+// Server handles CONNECT requests. It implements http.Handler; serve it with
+// an http.Server on its own port and Close it on shutdown.
+type Server struct {
+	ca       *CA
+	handlers map[string]http.Handler
+	dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	conns chan net.Conn
+	inner *http.Server
+	done  chan struct{}
+	once  sync.Once
+}
+
+type hostKey struct{}
+
+// New creates a Server. handlers maps each intercepted hostname to the
+// handler for its decrypted requests; other hosts are tunneled.
+func New(ca *CA, handlers map[string]http.Handler) *Server {
+	s := &Server{
+		ca:       ca,
+		handlers: handlers,
+		dial:     (&net.Dialer{Timeout: dialTimeout}).DialContext,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	s.inner = &http.Server{
+		Handler: http.HandlerFunc(s.serveDecrypted),
+		TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				host := connectHost(hello.Conn)
+				if host == "" {
+					host = hello.ServerName
+				}
+				return s.ca.CertFor(host)
+			},
+		},
+		// Route each decrypted request by the host its tunnel was opened for
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, hostKey{}, connectHost(c))
+		},
+		IdleTimeout: 120 * time.Second,
+	}
+	// ServeTLS enables h2 alongside HTTP/1.1 via ALPN
+	go s.inner.ServeTLS(&chanListener{s: s}, "", "")
+	return s
+}
+
+// Close stops serving intercepted connections
+func (s *Server) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.inner.Close()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, `{"error":"method_not_allowed","message":"this listener only accepts CONNECT (use it as HTTPS_PROXY)"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, port = r.Host, "443"
+	}
+	host = strings.ToLower(host)
+	_, intercept := s.handlers[host]
+	intercept = intercept && port == "443"
+
+	var upstream net.Conn
+	if !intercept {
+		upstream, err = s.dial(r.Context(), "tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			slog.Warn("forward proxy: dial failed", "host", r.Host, "error", err)
+			http.Error(w, `{"error":"bad_gateway","message":"cannot reach host"}`, http.StatusBadGateway)
+			return
+		}
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, `{"error":"internal_error"}`, http.StatusInternalServerError)
+		return
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		if upstream != nil {
+			upstream.Close()
+		}
+		return
+	}
+	// Hijacked connections keep the listener's deadlines otherwise
+	conn.SetDeadline(time.Time{})
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		conn.Close()
+		if upstream != nil {
+			upstream.Close()
+		}
+		return
+	}
+	client := &hostConn{Conn: conn, r: brw.Reader, host: host}
+
+	if !intercept {
+		tunnel(client, upstream)
+		return
+	}
+	select {
+	case s.conns <- client:
+	case <-s.done:
+		client.Close()
+	}
+}
+
+// serveDecrypted dispatches a request read from an intercepted tunnel
+func (s *Server) serveDecrypted(w http.ResponseWriter, r *http.Request) {
+	host, _ := r.Context().Value(hostKey{}).(string)
+	reqHost := r.Host
+	if h, _, err := net.SplitHostPort(reqHost); err == nil {
+		reqHost = h
+	}
+	if !strings.EqualFold(reqHost, host) {
+		http.Error(w, `{"error":"misdirected_request","message":"Host does not match the CONNECT target"}`, http.StatusMisdirectedRequest)
+		return
+	}
+	s.handlers[host].ServeHTTP(w, r)
+}
+
+// tunnel copies bytes both ways until either side closes
+func tunnel(client, upstream net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if c, ok := dst.(interface{ CloseWrite() error }); ok {
+			c.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go cp(upstream, client)
+	go cp(client, upstream)
+	<-done
+	<-done
+	client.Close()
+	upstream.Close()
+}
+
+// hostConn is a hijacked client connection that remembers its CONNECT host
+// and replays anything already buffered by the HTTP server
+type hostConn struct {
+	net.Conn
+	r    *bufio.Reader
+	host string
+}
+
+func (c *hostConn) Read(b []byte) (int, error) {
+	if c.r != nil && c.r.Buffered() > 0 {
+		return c.r.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// CloseWrite half-closes the client side when the upstream finishes
+func (c *hostConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func connectHost(c net.Conn) string {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if hc, ok := c.(*hostConn); ok {
+		return hc.host
+	}
+	return ""
+}
+
+// chanListener hands intercepted connections to the inner TLS server
+type chanListener struct {
+	s *Server
+}
+
+func (l *chanListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.s.conns:
+		return c, nil
+	case <-l.s.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *chanListener) Close() error {
+	l.s.once.Do(func() { close(l.s.done) })
+	return nil
+}
+
+func (l *chanListener) Addr() net.Addr {
+	return &net.TCPAddr{}
+}
@@ -0,0 +1,139 @@
+package mitm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCA(t *testing.T) (*CA, string) {
+	t.Helper()
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	if err := GenerateCA(certPath, keyPath); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := LoadCA(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, certPath
+}
+
+func TestGenerateCA(t *testing.T) {
+	ca, certPath := newCA(t)
+	keyPath := filepath.Join(filepath.Dir(certPath), "ca-key.pem")
+
+	if info, _ := os.Stat(keyPath); info.Mode().Perm() != 0o600 {
+		t.Errorf("key mode = %v, want 0600", info.Mode().Perm())
+	}
+	if err := GenerateCA(certPath, keyPath); err == nil {
+		t.Error("GenerateCA must not overwrite an existing CA")
+	}
+	if !ca.Certificate().IsCA {
+		t.Error("generated certificate is not a CA")
+	}
+	if _, err := LoadCA(filepath.Join(t.TempDir(), "missing.pem"), keyPath); err == nil {
+		t.Error("LoadCA should fail for a missing file")
+	}
+}
+
+func TestCA_CertFor(t *testing.T) {
+	ca, _ := newCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate())
+
+	c1, err := ca.CertFor("api.openai.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c1.Leaf.Verify(x509.VerifyOptions{DNSName: "api.openai.com", Roots: pool}); err != nil {
+		t.Errorf("minted certificate does not verify: %v", err)
+	}
+	if c2, _ := ca.CertFor("api.openai.com"); c2 != c1 {
+		t.Error("certificate should be cached per host")
+	}
+
+	// Renewed shortly before expiry
+	ca.now = func() time.Time { return time.Now().Add(leafValidity - time.Hour) }
+	if c3, _ := ca.CertFor("api.openai.com"); c3 == c1 {
+		t.Error("certificate close to expiry should be re-minted")
+	}
+}
+
+func TestServer_InterceptAndTunnel(t *testing.T) {
+	ca, _ := newCA(t)
+
+	var gotProto []int
+	intercepted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotProto = append(gotProto, r.ProtoMajor)
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("veil:" + r.Host + r.URL.Path + ":" + string(body)))
+	})
+	srv := New(ca, map[string]http.Handler{"api.openai.com": intercepted})
+	defer srv.Close()
+	front := httptest.NewServer(srv)
+	defer front.Close()
+
+	// A host that is not allowlisted, reached through a plain tunnel
+	direct := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer direct.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+	roots.AddCert(direct.Certificate())
+	proxyURL, _ := url.Parse(front.URL)
+
+	for _, h2 := range []bool{false, true} {
+		client := &http.Client{Transport: &http.Transport{
+			Proxy:             http.ProxyURL(proxyURL),
+			TLSClientConfig:   &tls.Config{RootCAs: roots},
+			ForceAttemptHTTP2: h2,
+		}}
+
+		resp, err := client.Post("https://api.openai.com/v1/chat/completions", "application/json", strings.NewReader("hi"))
+		if err != nil {
+			t.Fatalf("h2=%v: intercepted request: %v", h2, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "veil:api.openai.com/v1/chat/completions:hi" {
+			t.Errorf("h2=%v: intercepted body = %q", h2, body)
+		}
+
+		resp, err = client.Get(direct.URL)
+		if err != nil {
+			t.Fatalf("h2=%v: tunneled request: %v", h2, err)
+		}
+		body, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "direct" {
+			t.Errorf("h2=%v: tunneled body = %q", h2, body)
+		}
+	}
+	if len(gotProto) != 2 || gotProto[0] != 1 || gotProto[1] != 2 {
+		t.Errorf("protocols seen = %v, want HTTP/1.1 then h2", gotProto)
+	}
+}
+
+func TestServer_RejectsPlainRequests(t *testing.T) {
+	ca, _ := newCA(t)
+	srv := New(ca, nil)
+	defer srv.Close()
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want 405", w.Code)
+	}
+}
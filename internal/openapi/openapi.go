@@ -0,0 +1,378 @@
+// Package openapi builds the OpenAPI 3.1 document of the proxy's own
+// endpoints. Schemas are derived from the Go types the handlers encode and
+// decode, following encoding/json rules, so the document follows the
+// handlers as they change.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of the documents built here
+const Version = "3.1.0"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of one path, keyed by lower-case method
+type PathItem map[string]*Operation
+
+// Operation is one method on a path
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	// Roles lists the Veil key roles admitted, for endpoints behind
+	// RequireRole
+	Roles []string `json:"x-veil-roles,omitempty"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Schema      Schema `json:"schema"`
+}
+
+// RequestBody is the body of an operation
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is one response of an operation
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body in one content type
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+// Components holds the named schemas and the security schemes
+type Components struct {
+	Schemas         map[string]Schema         `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme is how a Veil API key is presented
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is a JSON Schema (2020-12, as used by OpenAPI 3.1)
+type Schema map[string]any
+
+// ErrorResponse is the standard error body of the first-party endpoints
+type ErrorResponse struct {
+	Error   string `json:"error"`             // machine-readable code, e.g. bad_request
+	Message string `json:"message,omitempty"` // human-readable detail
+}
+
+// Op describes an endpoint for Builder.Add
+type Op struct {
+	ID          string
+	Summary     string
+	Description string
+	Tag         string
+	Query       []Parameter // in is set to query
+	// Request is a value of the JSON request body type, nil without a body
+	Request any
+	// Response is a value of the response type: a Go value for JSON,
+	// Raw for other content, nil for an empty response
+	Response any
+	Status   int   // success status, 200 when zero
+	Formats  []Raw // further content types of the success response
+	Errors   []int // statuses answered with ErrorResponse
+	// Also maps further statuses to a value of their JSON body type, for
+	// failures answered with something other than ErrorResponse
+	Also map[int]any
+	// Roles restricts the endpoint to Veil keys bound to these roles
+	Roles []string
+}
+
+// Raw is a non-JSON response body of the given content type, such as
+// JSONL or CSV, described by Schema
+type Raw struct {
+	ContentType string
+	Schema      any // Go value whose schema each line or row follows, or nil
+}
+
+// Builder collects operations and the schemas of their types
+type Builder struct {
+	doc   Document
+	names map[reflect.Type]string
+}
+
+// New creates a Builder for a document
+func New(info Info) *Builder {
+	b := &Builder{
+		doc: Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   make(map[string]PathItem),
+			Components: Components{
+				Schemas: make(map[string]Schema),
+				SecuritySchemes: map[string]SecurityScheme{
+					"veilKey": {Type: "apiKey", In: "header", Name: "X-Veil-Key", Description: "Veil API key"},
+					"bearer":  {Type: "http", Scheme: "bearer", Description: "Veil API key as a bearer token"},
+				},
+			},
+		},
+		names: make(map[reflect.Type]string),
+	}
+	b.SchemaOf(ErrorResponse{})
+	return b
+}
+
+// Add registers method on path. Path parameters are taken from {name}
+// segments of path.
+func (b *Builder) Add(method, path string, op Op) {
+	o := &Operation{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Responses:   make(map[string]Response),
+		Roles:       op.Roles,
+	}
+	if op.Tag != "" {
+		o.Tags = []string{op.Tag}
+	}
+	for _, seg := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(seg, "{"); ok {
+			name = strings.TrimSuffix(name, "}")
+			o.Parameters = append(o.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: Schema{"type": "string"}})
+		}
+	}
+	for _, p := range op.Query {
+		p.In = "query"
+		o.Parameters = append(o.Parameters, p)
+	}
+	if op.Request != nil {
+		o.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"application/json": {Schema: b.SchemaOf(op.Request)},
+		}}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := b.response(status, op.Response)
+	for _, f := range op.Formats {
+		if ok.Content == nil {
+			ok.Content = make(map[string]MediaType)
+		}
+		ok.Content[f.ContentType] = b.response(status, f).Content[f.ContentType]
+	}
+	o.Responses[strconv.Itoa(status)] = ok
+	for code, body := range op.Also {
+		o.Responses[strconv.Itoa(code)] = b.response(code, body)
+	}
+
+	errs := op.Errors
+	if len(op.Roles) > 0 {
+		o.Security = []map[string][]string{{"veilKey": {}}, {"bearer": {}}}
+		errs = append(errs, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	for _, code := range errs {
+		o.Responses[strconv.Itoa(code)] = b.response(code, ErrorResponse{})
+	}
+
+	item := b.doc.Paths[path]
+	if item == nil {
+		item = make(PathItem)
+		b.doc.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = o
+}
+
+// response describes a status answered with body: a Go value for JSON, Raw
+// for other content, nil for none
+func (b *Builder) response(status int, body any) Response {
+	r := Response{Description: http.StatusText(status)}
+	switch body := body.(type) {
+	case nil:
+	case Raw:
+		schema := Schema{"type": "string"}
+		if body.Schema != nil {
+			schema = b.SchemaOf(body.Schema)
+		}
+		r.Content = map[string]MediaType{body.ContentType: {Schema: schema}}
+	default:
+		r.Content = map[string]MediaType{"application/json": {Schema: b.SchemaOf(body)}}
+	}
+	return r
+}
+
+// Document returns the document built so far
+func (b *Builder) Document() Document {
+	return b.doc
+}
+
+var (
+	timeType     = reflect.TypeFor[time.Time]()
+	durationType = reflect.TypeFor[time.Duration]()
+)
+
+// SchemaOf returns the schema of v's type. Named struct types are added to
+// the components and referenced.
+func (b *Builder) SchemaOf(v any) Schema {
+	return b.schema(reflect.TypeOf(v))
+}
+
+func (b *Builder) schema(t reflect.Type) Schema {
+	if t == nil {
+		return Schema{}
+	}
+	switch t {
+	case timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case durationType:
+		return Schema{"type": "integer", "description": "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return Schema{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		return Schema{"$ref": "#/components/schemas/" + b.component(t)}
+	}
+	return Schema{} // interfaces: any JSON value
+}
+
+// component registers a named struct type and returns its schema name.
+// Types of the same name from different packages are told apart by
+// package.
+func (b *Builder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := b.doc.Components.Schemas[name]; taken {
+		pkg := path.Base(t.PkgPath())
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	b.names[t] = name
+	b.doc.Components.Schemas[name] = Schema{} // placeholder for recursive types
+	b.doc.Components.Schemas[name] = b.object(t)
+	return name
+}
+
+// object builds a struct's schema the way encoding/json encodes it:
+// exported fields under their json names, embedded structs inlined, and
+// fields without omitempty required
+func (b *Builder) object(t reflect.Type) Schema {
+	props := make(map[string]any)
+	var required []string
+	b.fields(t, props, &required)
+	s := Schema{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+func (b *Builder) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			b.fields(ft, props, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema := b.schema(f.Type)
+		if strings.Contains(opts, "string") {
+			schema = Schema{"type": "string"}
+		}
+		props[name] = schema
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// Check reports operations that are missing an ID or share one, which
+// client generators need to be unique
+func (d Document) Check() error {
+	seen := make(map[string]string)
+	for path, item := range d.Paths {
+		for method, op := range item {
+			where := strings.ToUpper(method) + " " + path
+			if op.OperationID == "" {
+				return fmt.Errorf("%s has no operation ID", where)
+			}
+			if other, dup := seen[op.OperationID]; dup {
+				return fmt.Errorf("%s and %s share operation ID %s", other, where, op.OperationID)
+			}
+			seen[op.OperationID] = where
+		}
+	}
+	return nil
+}
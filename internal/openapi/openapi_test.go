@@ -0,0 +1,105 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	ID string `json:"id"`
+}
+
+type sample struct {
+	inner
+	Name     string         `json:"name"`
+	Count    int            `json:"count,omitempty"`
+	When     time.Time      `json:"when"`
+	Tags     []string       `json:"tags"`
+	Labels   map[string]int `json:"labels,omitzero"`
+	Raw      []byte         `json:"raw,omitempty"`
+	Next     *sample        `json:"next,omitempty"`
+	Big      int64          `json:"big,string"`
+	Skipped  string         `json:"-"`
+	internal string
+}
+
+func TestSchemaOf(t *testing.T) {
+	b := New(Info{Title: "test", Version: "1"})
+	if ref := b.SchemaOf(sample{}); ref["$ref"] != "#/components/schemas/sample" {
+		t.Fatalf("ref = %v", ref)
+	}
+	s := b.Document().Components.Schemas["sample"]
+	props := s["properties"].(map[string]any)
+
+	want := map[string]Schema{
+		"id":     {"type": "string"},
+		"name":   {"type": "string"},
+		"count":  {"type": "integer"},
+		"when":   {"type": "string", "format": "date-time"},
+		"tags":   {"type": "array", "items": Schema{"type": "string"}},
+		"labels": {"type": "object", "additionalProperties": Schema{"type": "integer"}},
+		"raw":    {"type": "string", "contentEncoding": "base64"},
+		"next":   {"$ref": "#/components/schemas/sample"},
+		"big":    {"type": "string"},
+	}
+	if len(props) != len(want) {
+		t.Errorf("properties = %v", props)
+	}
+	for name, schema := range want {
+		if !reflect.DeepEqual(props[name], schema) {
+			t.Errorf("%s = %v, want %v", name, props[name], schema)
+		}
+	}
+	required := s["required"].([]string)
+	if strings.Join(required, ",") != "big,id,name,tags,when" {
+		t.Errorf("required = %v", required)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	b := New(Info{Title: "test", Version: "1"})
+	b.Add(http.MethodGet, "/items/{id}", Op{
+		ID: "getItem", Response: inner{},
+		Query:  []Parameter{{Name: "full", Schema: Schema{"type": "boolean"}}},
+		Errors: []int{http.StatusNotFound},
+		Roles:  []string{"admin"},
+	})
+	b.Add(http.MethodDelete, "/items/{id}", Op{ID: "deleteItem", Status: http.StatusNoContent})
+	doc := b.Document()
+	if err := doc.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	get := doc.Paths["/items/{id}"]["get"]
+	if len(get.Parameters) != 2 || get.Parameters[0].In != "path" || !get.Parameters[0].Required || get.Parameters[1].In != "query" {
+		t.Errorf("parameters = %+v", get.Parameters)
+	}
+	for _, code := range []string{"404", "401", "403"} {
+		if get.Responses[code].Content["application/json"].Schema["$ref"] != "#/components/schemas/ErrorResponse" {
+			t.Errorf("%s response = %+v", code, get.Responses[code])
+		}
+	}
+	if len(get.Security) == 0 {
+		t.Error("role-restricted operation has no security")
+	}
+
+	del := doc.Paths["/items/{id}"]["delete"]
+	if r, ok := del.Responses["204"]; !ok || r.Content != nil {
+		t.Errorf("delete responses = %+v", del.Responses)
+	}
+	if del.Security != nil {
+		t.Error("public operation has security")
+	}
+}
+
+func TestCheck_DuplicateID(t *testing.T) {
+	b := New(Info{Title: "test", Version: "1"})
+	b.Add(http.MethodGet, "/a", Op{ID: "get"})
+	b.Add(http.MethodGet, "/b", Op{ID: "get"})
+	if err := b.Document().Check(); err == nil {
+		t.Error("duplicate operation IDs accepted")
+	}
+}
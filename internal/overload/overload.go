@@ -0,0 +1,304 @@
+// Package overload protects the proxy from traffic spikes. It caps the
+// number of requests in flight, lets a few more wait briefly for a slot and
+// rejects the rest with 503 before they buffer bodies or take Redis
+// connections. Independently it watches heap usage and, past a high-water
+// mark, sheds the requests that are cheapest to turn away first.
+package overload
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults
+const (
+	// DefaultInFlightPerCPU sizes the in-flight cap from GOMAXPROCS. LLM
+	// calls mostly wait on the provider, so the cap is well above the core
+	// count.
+	DefaultInFlightPerCPU = 64
+	DefaultQueueSize      = 64
+	DefaultQueueTimeout   = 2 * time.Second
+	DefaultRetryAfter     = 1 * time.Second
+
+	// Fractions of GOMEMLIMIT used for the memory marks when it is set
+	highWaterFraction = 0.80
+	criticalFraction  = 0.95
+)
+
+// heapMetric is the heap memory occupied by objects, live or not yet swept
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// Config controls load shedding
+type Config struct {
+	MaxInFlight  int           // concurrent requests served
+	QueueSize    int           // requests allowed to wait for a slot beyond MaxInFlight
+	QueueTimeout time.Duration // how long a queued request waits before it is shed
+	RetryAfter   time.Duration // advertised in the Retry-After header of a 503
+
+	// MemoryHighWater is the heap size above which cheap requests
+	// (unauthenticated, /scan, /audit) are shed. MemoryCritical is where
+	// every request is shed. Zero for both disables memory shedding.
+	MemoryHighWater uint64
+	MemoryCritical  uint64
+	// MemoryCheckInterval is how often the heap size is sampled
+	MemoryCheckInterval time.Duration
+}
+
+// DefaultConfig derives the in-flight cap from GOMAXPROCS and the memory
+// marks from GOMEMLIMIT, leaving memory shedding off when no limit is set
+func DefaultConfig() Config {
+	cfg := Config{
+		MaxInFlight:         DefaultInFlightPerCPU * runtime.GOMAXPROCS(0),
+		QueueSize:           DefaultQueueSize,
+		QueueTimeout:        DefaultQueueTimeout,
+		RetryAfter:          DefaultRetryAfter,
+		MemoryCheckInterval: 250 * time.Millisecond,
+	}
+	if limit := debug.SetMemoryLimit(-1); limit > 0 && limit < math.MaxInt64 {
+		cfg.MemoryHighWater = uint64(float64(limit) * highWaterFraction)
+		cfg.MemoryCritical = uint64(float64(limit) * criticalFraction)
+	}
+	return cfg
+}
+
+// Stats is a snapshot of the limiter
+type Stats struct {
+	InFlight    int64  `json:"in_flight"`
+	Queued      int64  `json:"queued"`
+	MaxInFlight int    `json:"max_in_flight"`
+	QueueSize   int    `json:"queue_size"`
+	Served      uint64 `json:"served"`
+	ShedQueue   uint64 `json:"shed_queue_full"`
+	ShedTimeout uint64 `json:"shed_queue_timeout"`
+	ShedMemory  uint64 `json:"shed_memory"`
+	HeapBytes   uint64 `json:"heap_bytes"`
+	HighWater   uint64 `json:"memory_high_water,omitempty"`
+	Critical    uint64 `json:"memory_critical,omitempty"`
+}
+
+// Limiter enforces the in-flight cap and memory marks
+type Limiter struct {
+	cfg   Config
+	slots chan struct{}
+
+	inflight atomic.Int64
+	queued   atomic.Int64
+	heap     atomic.Uint64
+
+	served      atomic.Uint64
+	shedQueue   atomic.Uint64
+	shedTimeout atomic.Uint64
+	shedMemory  atomic.Uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates a Limiter. Zero fields of cfg take their defaults; the
+// memory sampler runs until Close when a memory mark is set.
+func New(cfg Config) *Limiter {
+	def := DefaultConfig()
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = def.MaxInFlight
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = def.QueueTimeout
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = def.RetryAfter
+	}
+	if cfg.MemoryCheckInterval <= 0 {
+		cfg.MemoryCheckInterval = def.MemoryCheckInterval
+	}
+	if cfg.MemoryCritical == 0 {
+		cfg.MemoryCritical = cfg.MemoryHighWater
+	}
+
+	l := &Limiter{
+		cfg:   cfg,
+		slots: make(chan struct{}, cfg.MaxInFlight),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	l.sampleHeap()
+	if cfg.MemoryHighWater > 0 {
+		go l.watchMemory()
+	} else {
+		close(l.done)
+	}
+	return l
+}
+
+// Close stops the memory sampler
+func (l *Limiter) Close() {
+	select {
+	case <-l.stop:
+	default:
+		close(l.stop)
+	}
+	<-l.done
+}
+
+func (l *Limiter) watchMemory() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.cfg.MemoryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.sampleHeap()
+		}
+	}
+}
+
+// sampleHeap reads the heap size through runtime/metrics, which unlike
+// runtime.ReadMemStats doesn't stop the world
+func (l *Limiter) sampleHeap() {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() == metrics.KindUint64 {
+		l.heap.Store(sample[0].Value.Uint64())
+	}
+}
+
+// Stats returns current counters
+func (l *Limiter) Stats() Stats {
+	return Stats{
+		InFlight:    l.inflight.Load(),
+		Queued:      l.queued.Load(),
+		MaxInFlight: l.cfg.MaxInFlight,
+		QueueSize:   l.cfg.QueueSize,
+		Served:      l.served.Load(),
+		ShedQueue:   l.shedQueue.Load(),
+		ShedTimeout: l.shedTimeout.Load(),
+		ShedMemory:  l.shedMemory.Load(),
+		HeapBytes:   l.heap.Load(),
+		HighWater:   l.cfg.MemoryHighWater,
+		Critical:    l.cfg.MemoryCritical,
+	}
+}
+
+// StatusHandler serves Stats as JSON (GET /admin/status)
+func (l *Limiter) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(StatusResponse{Overload: l.Stats()})
+	})
+}
+
+// StatusResponse is the JSON body of GET /admin/status
+type StatusResponse struct {
+	Overload Stats `json:"overload"`
+}
+
+// Middleware sheds requests beyond the in-flight cap and memory marks. It
+// belongs outermost so shed requests cost as little as possible. Health
+// probes, /admin/status and /admin/breakglass are never shed.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if l.cfg.MemoryHighWater > 0 {
+			heap := l.heap.Load()
+			if heap >= l.cfg.MemoryCritical || (heap >= l.cfg.MemoryHighWater && cheap(r)) {
+				l.shedMemory.Add(1)
+				slog.Warn("overload: shedding request over memory mark", "path", r.URL.Path, "heap_bytes", heap)
+				l.reject(w, "memory")
+				return
+			}
+		}
+
+		if !l.acquire(r.Context(), w) {
+			return
+		}
+		defer l.release()
+		l.served.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire takes a slot, waiting in the queue if there is room. It writes
+// the 503 itself and returns false when the request is shed.
+func (l *Limiter) acquire(ctx context.Context, w http.ResponseWriter) bool {
+	select {
+	case l.slots <- struct{}{}:
+		l.inflight.Add(1)
+		return true
+	default:
+	}
+
+	if l.queued.Add(1) > int64(l.cfg.QueueSize) {
+		l.queued.Add(-1)
+		l.shedQueue.Add(1)
+		l.reject(w, "queue_full")
+		return false
+	}
+	defer l.queued.Add(-1)
+
+	timer := time.NewTimer(l.cfg.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		l.inflight.Add(1)
+		return true
+	case <-timer.C:
+		l.shedTimeout.Add(1)
+		l.reject(w, "queue_timeout")
+		return false
+	case <-ctx.Done():
+		// Client gave up; nothing to write
+		return false
+	}
+}
+
+func (l *Limiter) release() {
+	l.inflight.Add(-1)
+	<-l.slots
+}
+
+func (l *Limiter) reject(w http.ResponseWriter, reason string) {
+	retry := int(math.Ceil(l.cfg.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+	w.Header().Set("X-Veil-Overload", reason)
+	http.Error(w, `{"error":"overloaded","message":"proxy is overloaded, retry later"}`, http.StatusServiceUnavailable)
+}
+
+// exempt reports whether r must never be shed
+func exempt(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/health", "/healthz", "/readyz", "/admin/status", "/admin/readiness", "/admin/breakglass":
+		return true
+	}
+	return false
+}
+
+// cheap reports whether r is among the first to shed under memory pressure:
+// utility endpoints, and requests carrying no credential at all (auth runs
+// later, so presence is all that can be checked here)
+func cheap(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/scan", "/audit", "/audit/project":
+		return true
+	}
+	return r.Header.Get("Authorization") == "" &&
+		r.Header.Get("X-Veil-Key") == "" &&
+		r.Header.Get("x-api-key") == "" &&
+		r.URL.Query().Get("key") == ""
+}
@@ -0,0 +1,294 @@
+package overload
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddleware_ShedsBeyondQueue(t *testing.T) {
+	l := New(Config{MaxInFlight: 2, QueueSize: 1, QueueTimeout: time.Second})
+	defer l.Close()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	// Two requests fill the slots, a third waits in the queue
+	var wg sync.WaitGroup
+	codes := make([]int, 3)
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+			codes[i] = rec.Code
+		}()
+	}
+	<-started
+	<-started
+	waitFor(t, func() bool { return l.Stats().Queued == 1 })
+
+	// The fourth finds the queue full
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" || rec.Header().Get("X-Veil-Overload") != "queue_full" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] != "overloaded" {
+		t.Errorf("body = %s", rec.Body.String())
+	}
+
+	close(release)
+	wg.Wait()
+	for i, c := range codes {
+		if c != http.StatusOK {
+			t.Errorf("request %d: expected 200 once a slot freed, got %d", i, c)
+		}
+	}
+	s := l.Stats()
+	if s.Served != 3 || s.ShedQueue != 1 || s.InFlight != 0 || s.Queued != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestMiddleware_QueueTimeout(t *testing.T) {
+	l := New(Config{MaxInFlight: 1, QueueSize: 1, QueueTimeout: 20 * time.Millisecond})
+	defer l.Close()
+
+	release := make(chan struct{})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/x", nil))
+	waitFor(t, func() bool { return l.Stats().InFlight == 1 })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/x", nil))
+	close(release)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("X-Veil-Overload") != "queue_timeout" {
+		t.Errorf("expected queue_timeout 503, got %d %v", rec.Code, rec.Header())
+	}
+	if l.Stats().ShedTimeout != 1 {
+		t.Errorf("stats = %+v", l.Stats())
+	}
+}
+
+func TestMiddleware_HealthNeverShed(t *testing.T) {
+	l := New(Config{MaxInFlight: 1, QueueSize: 0})
+	defer l.Close()
+
+	release := make(chan struct{})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/x" {
+			<-release
+		}
+	}))
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/x", nil))
+	waitFor(t, func() bool { return l.Stats().InFlight == 1 })
+	defer close(release)
+
+	for _, path := range []string{"/health", "/healthz", "/readyz", "/admin/status"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 while saturated, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestMiddleware_MemoryShedsCheapFirst(t *testing.T) {
+	// The sampler won't tick during the test, so heap can be set by hand
+	l := New(Config{MaxInFlight: 10, MemoryHighWater: 1 << 40, MemoryCritical: 2 << 40, MemoryCheckInterval: time.Hour})
+	defer l.Close()
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	authed := func(path string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.Header.Set("Authorization", "Bearer veil_sk_x")
+		return r
+	}
+	serve := func(r *http.Request) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	// Between the marks: cheap requests go, authenticated traffic stays
+	l.heap.Store(1<<40 + 1)
+	if code := serve(httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)); code != http.StatusServiceUnavailable {
+		t.Errorf("unauthenticated: expected 503, got %d", code)
+	}
+	if code := serve(authed("/scan")); code != http.StatusServiceUnavailable {
+		t.Errorf("/scan: expected 503, got %d", code)
+	}
+	if code := serve(authed("/v1/chat/completions")); code != http.StatusOK {
+		t.Errorf("authenticated: expected 200, got %d", code)
+	}
+
+	// Past the critical mark everything is shed
+	l.heap.Store(2<<40 + 1)
+	if code := serve(authed("/v1/chat/completions")); code != http.StatusServiceUnavailable {
+		t.Errorf("critical: expected 503, got %d", code)
+	}
+	if s := l.Stats(); s.ShedMemory != 3 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	l := New(Config{MaxInFlight: 7})
+	defer l.Close()
+
+	rec := httptest.NewRecorder()
+	l.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/status", nil))
+	var body struct {
+		Overload Stats `json:"overload"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Overload.MaxInFlight != 7 || body.Overload.HeapBytes == 0 {
+		t.Errorf("status = %+v", body.Overload)
+	}
+}
+
+// zeros is an endless reader that allocates nothing, so the load test
+// measures what the server side buffers rather than the clients
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// TestLoad_BoundedMemory sends 1000 concurrent 1MB requests to a handler
+// that buffers each body, as the proxy does. With the cap at 16 the heap
+// stays near 16 buffered bodies instead of growing to 1000.
+func TestLoad_BoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	const (
+		clients  = 1000
+		bodySize = 1 << 20
+		maxSlots = 16
+	)
+
+	l := New(Config{MaxInFlight: maxSlots, QueueSize: 64, QueueTimeout: 10 * time.Second})
+	defer l.Close()
+
+	var concurrent, peakConcurrent atomic.Int64
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := concurrent.Add(1)
+		defer concurrent.Add(-1)
+		for {
+			p := peakConcurrent.Load()
+			if n <= p || peakConcurrent.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil || len(body) != bodySize {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// Hold the body for the length of an upstream call
+		time.Sleep(20 * time.Millisecond)
+		runtime.KeepAlive(body)
+	}))
+
+	runtime.GC()
+	base := heapBytes()
+	var peak atomic.Uint64
+	stopSampling := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-stopSampling:
+				return
+			case <-time.After(time.Millisecond):
+				if h := heapBytes(); h > peak.Load() {
+					peak.Store(h)
+				}
+			}
+		}
+	}()
+
+	var ok, shed atomic.Int64
+	var wg sync.WaitGroup
+	for range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", io.LimitReader(zeros{}, bodySize))
+			req.Header.Set("Authorization", "Bearer veil_sk_x")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			switch rec.Code {
+			case http.StatusOK:
+				ok.Add(1)
+			case http.StatusServiceUnavailable:
+				shed.Add(1)
+			default:
+				t.Errorf("unexpected status %d", rec.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stopSampling)
+	<-sampled
+
+	if ok.Load()+shed.Load() != clients {
+		t.Fatalf("served %d + shed %d != %d", ok.Load(), shed.Load(), clients)
+	}
+	if ok.Load() == 0 || shed.Load() == 0 {
+		t.Errorf("expected both served and shed requests, got %d/%d", ok.Load(), shed.Load())
+	}
+	if p := peakConcurrent.Load(); p > maxSlots {
+		t.Errorf("handler saw %d concurrent requests, cap is %d", p, maxSlots)
+	}
+
+	// io.ReadAll grows its buffer by doubling, so a held 1MB body can take
+	// ~2MB plus garbage awaiting collection. Without the cap this handler
+	// peaks at well over 100MB.
+	growth := int64(peak.Load()) - int64(base)
+	if limit := int64(maxSlots * bodySize * 4); growth > limit {
+		t.Errorf("heap grew by %d MB, want under %d MB", growth>>20, limit>>20)
+	}
+	t.Logf("served %d, shed %d, peak heap growth %d MB", ok.Load(), shed.Load(), growth>>20)
+}
+
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
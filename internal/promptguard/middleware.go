@@ -5,7 +5,17 @@ import (
 	"encoding/json"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/annotate"
+	"github.com/vurakit/agentveil/internal/breakglass"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/jsonfields"
+	"github.com/vurakit/agentveil/internal/metrics"
+	"github.com/vurakit/agentveil/internal/session"
+	"github.com/vurakit/agentveil/internal/webhook"
 )
 
 // Middleware intercepts HTTP requests/responses and scans for prompt injection
@@ -17,45 +27,106 @@ func Middleware(guard *Guard) func(http.Handler) http.Handler {
 				return
 			}
 
-			body, err := io.ReadAll(io.LimitReader(r.Body, 10<<20)) // 10MB
-			r.Body.Close()
+			if r.ContentLength > guard.maxScanBytes {
+				skipScan(guard, w, r)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Read one byte past the limit to spot oversized chunked bodies
+			body, err := io.ReadAll(io.LimitReader(r.Body, guard.maxScanBytes+1))
 			if err != nil {
+				r.Body.Close()
 				slog.Warn("promptguard: read body failed", "error", err)
+				http.Error(w, `{"error":"bad_request","message":"cannot read body"}`, http.StatusBadRequest)
+				return
+			}
+			if int64(len(body)) > guard.maxScanBytes {
+				// Hand on what was read followed by the unread rest
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+				skipScan(guard, w, r)
 				next.ServeHTTP(w, r)
 				return
 			}
+			r.Body.Close()
+			restoreBody(r, body)
 
-			// Extract text content from OpenAI/Anthropic request body
+			// Extract text content from OpenAI/Anthropic/Gemini request body
 			text := extractTextFromBody(body)
 			if text == "" {
-				r.Body = io.NopCloser(bytes.NewReader(body))
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			result := guard.ScanInput(text)
+			var result ScanResult
+			sessionID, turn := "", ""
+			if guard.SessionTracking() {
+				sessionID = sessionKey(r)
+				turn = extractLatestUserText(body)
+			}
+			scanned := failsafe.Protect(r.Context(), failsafe.PromptGuard, r.Header.Get("X-Session-ID"), func() {
+				result = guard.ScanInputSession(r.Context(), sessionID, text, turn)
+			})
+			if !failsafe.Allowed(r.Context()) {
+				failsafe.Deny(w)
+				return
+			}
+			if !scanned {
+				accesslog.SetThreatLevel(r.Context(), "unscanned")
+				next.ServeHTTP(w, r)
+				return
+			}
 
+			accesslog.SetThreatLevel(r.Context(), result.ThreatLevel.String())
+			session.AddThreats(r.Context(), len(result.Detections))
+
+			if guard.ShouldBlock(result) && guard.breakGlass.Active() {
+				guard.breakGlass.Bypass(breakglass.SourcePromptGuard, webhook.EventPromptInjection, r.Header.Get("X-Session-ID"), map[string]any{
+					"threat":     result.ThreatLevel.String(),
+					"score":      result.Score,
+					"detections": len(result.Detections),
+				})
+				annotate.Add(r.Context(), annotate.SourcePromptGuard, "break_glass", result.ThreatLevel.String(), "allowed", 1)
+				next.ServeHTTP(w, r)
+				return
+			}
 			if guard.ShouldBlock(result) {
 				slog.Warn("promptguard: blocked request",
 					"threat_level", result.ThreatLevel.String(),
 					"score", result.Score,
 					"detections", len(result.Detections),
+					"session_id", sessionID,
+					"session_score", result.SessionScore,
+					"session_flagged", result.SessionFlagged,
 				)
+				recordBlocked(guard.recorder, result)
+
+				errBody := map[string]any{
+					"message": "Request blocked: prompt injection detected",
+					"type":    "prompt_injection",
+					"threat":  result.ThreatLevel.String(),
+					"score":   result.Score,
+				}
+				if result.SessionCrossed || result.SessionFlagged {
+					errBody["message"] = "Request blocked: accumulated prompt injection risk for this session"
+					errBody["session_score"] = result.SessionScore
+				}
 
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusForbidden)
 				resp := map[string]any{
-					"error": map[string]any{
-						"message": "Request blocked: prompt injection detected",
-						"type":    "prompt_injection",
-						"threat":  result.ThreatLevel.String(),
-						"score":   result.Score,
-					},
+					"error": errBody,
 				}
 				json.NewEncoder(w).Encode(resp)
 				return
 			}
 
+			for _, d := range result.Detections {
+				annotate.Add(r.Context(), annotate.SourcePromptGuard, d.Category, d.ThreatLevel.String(), "allowed", 1)
+			}
 			if len(result.Detections) > 0 {
 				slog.Info("promptguard: suspicious input (allowed)",
 					"threat_level", result.ThreatLevel.String(),
@@ -64,14 +135,93 @@ func Middleware(guard *Guard) func(http.Handler) http.Handler {
 				)
 			}
 
-			// Restore body for downstream handlers
-			r.Body = io.NopCloser(bytes.NewReader(body))
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// extractTextFromBody extracts user message text from OpenAI/Anthropic request formats
+// recordBlocked counts a blocked request once per detected category, or as
+// "session" when only the session's accumulated score blocked it
+func recordBlocked(rec metrics.Recorder, result ScanResult) {
+	seen := make(map[string]bool)
+	for _, d := range result.Detections {
+		if !seen[d.Category] {
+			seen[d.Category] = true
+			rec.InjectionBlocked(d.Category)
+		}
+	}
+	if len(seen) == 0 {
+		rec.InjectionBlocked("session")
+	}
+}
+
+// HeaderScanSkipped is set on responses whose request body was too large to
+// scan for prompt injection
+const HeaderScanSkipped = "X-Veil-Promptguard"
+
+// skipScan records a request passed through unscanned because of its size
+func skipScan(guard *Guard, w http.ResponseWriter, r *http.Request) {
+	guard.skipped.Add(1)
+	accesslog.SetThreatLevel(r.Context(), "unscanned")
+	w.Header().Set(HeaderScanSkipped, "skipped; body exceeds scan limit")
+	slog.Warn("promptguard: body too large, passing through unscanned",
+		"content_length", r.ContentLength,
+		"max_scan_bytes", guard.maxScanBytes,
+		"path", r.URL.Path,
+	)
+}
+
+// restoreBody replaces the consumed body with buf so downstream handlers,
+// and retries through GetBody, read the identical bytes
+func restoreBody(r *http.Request, buf []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(buf))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	r.ContentLength = int64(len(buf))
+}
+
+// sessionKey identifies the conversation for threat accumulation:
+// X-Session-ID, then the authenticated key, then the client IP so that
+// omitting the session header does not reset the score
+func sessionKey(r *http.Request) string {
+	if sid := r.Header.Get("X-Session-ID"); sid != "" {
+		return "sid:" + sid
+	}
+	if keyID := r.Header.Get("X-Veil-Key-ID"); keyID != "" {
+		return "key:" + keyID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// extractLatestUserText returns the last user message, which is the new turn
+// in chat APIs that resend the whole history
+func extractLatestUserText(body []byte) string {
+	var data struct {
+		Messages []json.RawMessage `json:"messages"`
+		Contents []json.RawMessage `json:"contents"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return ""
+	}
+	field, turns := "messages", data.Messages
+	if len(turns) == 0 {
+		field, turns = "contents", data.Contents
+	}
+	for i := len(turns) - 1; i >= 0; i-- {
+		single, _ := json.Marshal(map[string]any{field: []json.RawMessage{turns[i]}})
+		if text := extractTextFromBody(single); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// extractTextFromBody extracts user message text from OpenAI/Anthropic/Gemini request formats
 func extractTextFromBody(body []byte) string {
 	var data map[string]any
 	if err := json.Unmarshal(body, &data); err != nil {
@@ -80,42 +230,49 @@ func extractTextFromBody(body []byte) string {
 
 	var texts []string
 
-	// OpenAI format: {"messages": [{"role": "user", "content": "..."}]}
+	// OpenAI format: {"messages": [{"role": "user", "content": "..."}]}.
+	// Anthropic uses the same list with content as typed blocks, and sends
+	// tool output back as tool_result blocks in user messages; OpenAI sends
+	// it as "tool" messages. Tool output is scanned like user text since
+	// injected instructions often arrive that way.
 	if messages, ok := data["messages"].([]any); ok {
 		for _, msg := range messages {
 			m, ok := msg.(map[string]any)
 			if !ok {
 				continue
 			}
-			// Only scan user messages (not system/assistant)
+			// Only scan user and tool messages (not system/assistant)
 			role, _ := m["role"].(string)
-			if role != "user" {
+			if role != "user" && role != "tool" {
 				continue
 			}
+			texts = append(texts, contentTexts(m["content"])...)
+		}
+	}
 
-			switch content := m["content"].(type) {
-			case string:
-				texts = append(texts, content)
-			case []any:
-				// Multi-part content (text + images)
-				for _, part := range content {
-					p, ok := part.(map[string]any)
-					if !ok {
-						continue
-					}
-					if p["type"] == "text" {
-						if t, ok := p["text"].(string); ok {
-							texts = append(texts, t)
-						}
-					}
-				}
+	// Anthropic system prompt: {"system": "..."} or {"system": [{"type": "text", "text": "..."}]}
+	texts = append(texts, contentTexts(data["system"])...)
+
+	// Gemini format: {"contents": [{"role": "user", "parts": [{"text": "..."}]}]}.
+	// The role may be left out on single-turn requests; "model" turns are
+	// skipped and systemInstruction is scanned as well. Function responses
+	// come back in "user" or "function" turns.
+	if sys, ok := data["systemInstruction"].(map[string]any); ok {
+		texts = append(texts, partTexts(sys["parts"])...)
+	}
+	if contents, ok := data["contents"].([]any); ok {
+		for _, c := range contents {
+			m, ok := c.(map[string]any)
+			if !ok {
+				continue
 			}
+			if role, _ := m["role"].(string); role != "" && role != "user" && role != "function" {
+				continue
+			}
+			texts = append(texts, partTexts(m["parts"])...)
 		}
 	}
 
-	// Anthropic format: {"messages": [{"role": "user", "content": [...]}]}
-	// Same structure, already handled above
-
 	// Fallback: raw prompt field
 	if prompt, ok := data["prompt"].(string); ok {
 		texts = append(texts, prompt)
@@ -127,6 +284,54 @@ func extractTextFromBody(body []byte) string {
 	return joinTexts(texts)
 }
 
+// contentTexts returns the text of message content: a string, or a list
+// of text parts or blocks. tool_result blocks are followed into their own
+// content, which is a string or blocks in turn.
+func contentTexts(content any) []string {
+	switch content := content.(type) {
+	case string:
+		return []string{content}
+	case []any:
+		var texts []string
+		for _, part := range content {
+			p, ok := part.(map[string]any)
+			if !ok {
+				continue
+			}
+			switch p["type"] {
+			case "text":
+				if t, ok := p["text"].(string); ok {
+					texts = append(texts, t)
+				}
+			case "tool_result":
+				texts = append(texts, contentTexts(p["content"])...)
+			}
+		}
+		return texts
+	}
+	return nil
+}
+
+// partTexts returns the text of Gemini parts, including the strings in
+// function responses
+func partTexts(parts any) []string {
+	list, _ := parts.([]any)
+	var texts []string
+	for _, part := range list {
+		p, ok := part.(map[string]any)
+		if !ok {
+			continue
+		}
+		if t, ok := p["text"].(string); ok {
+			texts = append(texts, t)
+		}
+		if fr, ok := p["functionResponse"].(map[string]any); ok {
+			texts = append(texts, jsonfields.StringValues(fr["response"])...)
+		}
+	}
+	return texts
+}
+
 func joinTexts(texts []string) string {
 	if len(texts) == 0 {
 		return ""
@@ -4,9 +4,16 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/breakglass"
+	"github.com/vurakit/agentveil/internal/i18n"
+	"github.com/vurakit/agentveil/internal/metrics"
 )
 
 // ThreatLevel represents the severity of a prompt injection attempt
@@ -40,6 +47,7 @@ type Detection struct {
 	Type        string      `json:"type"`
 	Category    string      `json:"category"`
 	Description string      `json:"description"`
+	MessageID   string      `json:"message_id,omitempty"` // of Description
 	ThreatLevel ThreatLevel `json:"threat_level"`
 	Snippet     string      `json:"snippet"`
 	Score       float64     `json:"score"`
@@ -51,23 +59,40 @@ type ScanResult struct {
 	ThreatLevel ThreatLevel `json:"threat_level"`
 	Detections  []Detection `json:"detections,omitempty"`
 	Score       float64     `json:"score"` // 0-100, higher = more dangerous
+
+	// Session accumulation (only set by ScanInputSession)
+	SessionScore   float64 `json:"session_score,omitempty"`
+	SessionFlagged bool    `json:"session_flagged,omitempty"` // in cool-down
+	SessionCrossed bool    `json:"session_crossed,omitempty"` // this message pushed the session over threshold
 }
 
 // injectionPattern defines a regex-based injection detection rule
 type injectionPattern struct {
 	Pattern     *regexp.Regexp
 	Category    string
-	Description string
+	MessageID   string
 	ThreatLevel ThreatLevel
 	Weight      float64
 }
 
+// DefaultMaxScanBytes is the largest request body scanned unless configured
+// with WithMaxScanBytes
+const DefaultMaxScanBytes = 10 << 20 // 10MB
+
 // Guard is the main prompt injection protection engine
 type Guard struct {
 	inputPatterns  []injectionPattern
 	outputPatterns []injectionPattern
-	canaryStore    *CanaryStore
+	canaryStore    Canaries
 	blockThreshold ThreatLevel // block if threat >= this level
+	sessions       SessionStore
+	sessionCfg     SessionConfig
+	now            func() time.Time
+	maxScanBytes   int64
+	skipped        atomic.Uint64
+	breakGlass     *breakglass.Switch
+	lang           i18n.Lang
+	recorder       metrics.Recorder
 }
 
 // Option configures Guard behavior
@@ -80,6 +105,44 @@ func WithBlockThreshold(level ThreatLevel) Option {
 	}
 }
 
+// WithMaxScanBytes sets the largest request body the middleware buffers and
+// scans. Larger bodies pass through unscanned.
+func WithMaxScanBytes(n int64) Option {
+	return func(g *Guard) {
+		g.maxScanBytes = n
+	}
+}
+
+// WithBreakGlass lets the middleware through requests it would block while
+// s is active, reporting them to s instead
+func WithBreakGlass(s *breakglass.Switch) Option {
+	return func(g *Guard) {
+		g.breakGlass = s
+	}
+}
+
+// WithCanaries replaces the in-memory canary store
+func WithCanaries(c Canaries) Option {
+	return func(g *Guard) {
+		g.canaryStore = c
+	}
+}
+
+// WithLang sets the language of detection descriptions, i18n.Default by
+// default
+func WithLang(l i18n.Lang) Option {
+	return func(g *Guard) {
+		g.lang = l
+	}
+}
+
+// WithRecorder reports the categories of blocked requests to rec
+func WithRecorder(rec metrics.Recorder) Option {
+	return func(g *Guard) {
+		g.recorder = rec
+	}
+}
+
 // New creates a Guard with default patterns
 func New(opts ...Option) *Guard {
 	g := &Guard{
@@ -87,6 +150,9 @@ func New(opts ...Option) *Guard {
 		outputPatterns: defaultOutputPatterns(),
 		canaryStore:    NewCanaryStore(),
 		blockThreshold: ThreatHigh,
+		now:            time.Now,
+		maxScanBytes:   DefaultMaxScanBytes,
+		recorder:       metrics.Nop{},
 	}
 	for _, opt := range opts {
 		opt(g)
@@ -94,24 +160,50 @@ func New(opts ...Option) *Guard {
 	return g
 }
 
+// SkippedOversize returns how many request bodies passed through unscanned
+// because they exceeded the scan limit
+func (g *Guard) SkippedOversize() uint64 {
+	return g.skipped.Load()
+}
+
 // ScanInput analyzes user/agent input for prompt injection attempts
 func (g *Guard) ScanInput(text string) ScanResult {
-	return g.scan(text, g.inputPatterns)
+	result, err := g.scan(text, g.inputPatterns)
+	if err != nil {
+		slog.Error("promptguard: canary check failed", "error", err)
+	}
+	return result
 }
 
 // ScanOutput analyzes LLM output for leaked data or harmful content
 func (g *Guard) ScanOutput(text string) ScanResult {
-	return g.scan(text, g.outputPatterns)
+	result, err := g.scan(text, g.outputPatterns)
+	if err != nil {
+		slog.Error("promptguard: canary check failed", "error", err)
+	}
+	return result
 }
 
-// ShouldBlock returns true if the scan result warrants blocking
+// ShouldBlock returns true if the scan result warrants blocking: the message
+// itself reaches the block threshold, it pushes its session over the session
+// threshold, or the session is in cool-down and the message reaches the
+// stricter threshold
 func (g *Guard) ShouldBlock(result ScanResult) bool {
-	return result.ThreatLevel >= g.blockThreshold
+	if result.ThreatLevel >= g.blockThreshold {
+		return true
+	}
+	if result.SessionCrossed {
+		return true
+	}
+	return result.SessionFlagged && result.ThreatLevel != ThreatNone &&
+		result.ThreatLevel >= g.sessionCfg.StrictThreshold
 }
 
-func (g *Guard) scan(text string, patterns []injectionPattern) ScanResult {
+// scan matches text against patterns and the issued canaries. A failing
+// canary store is returned as the error along with the pattern results.
+func (g *Guard) scan(text string, patterns []injectionPattern) (ScanResult, error) {
 	if text == "" {
-		return ScanResult{Safe: true, ThreatLevel: ThreatNone, Score: 0}
+		return ScanResult{Safe: true, ThreatLevel: ThreatNone, Score: 0}, nil
 	}
 
 	lower := strings.ToLower(text)
@@ -125,7 +217,8 @@ func (g *Guard) scan(text string, patterns []injectionPattern) ScanResult {
 			detections = append(detections, Detection{
 				Type:        "pattern",
 				Category:    p.Category,
-				Description: p.Description,
+				Description: i18n.T(g.lang, p.MessageID),
+				MessageID:   p.MessageID,
 				ThreatLevel: p.ThreatLevel,
 				Snippet:     snippet,
 				Score:       p.Weight,
@@ -146,21 +239,19 @@ func (g *Guard) scan(text string, patterns []injectionPattern) ScanResult {
 	}
 
 	// Canary leak check
-	if g.canaryStore != nil {
-		if leaked := g.canaryStore.CheckLeaked(text); len(leaked) > 0 {
-			for _, canary := range leaked {
-				detections = append(detections, Detection{
-					Type:        "canary_leak",
-					Category:    "data_leak",
-					Description: fmt.Sprintf("Canary token leaked: session %s", canary.SessionID),
-					ThreatLevel: ThreatCritical,
-					Snippet:     canary.Token,
-					Score:       50,
-				})
-				totalWeight += 50
-				maxThreat = ThreatCritical
-			}
-		}
+	leaked, err := g.leakedCanaries(text)
+	for _, canary := range leaked {
+		detections = append(detections, Detection{
+			Type:        "canary_leak",
+			Category:    "data_leak",
+			Description: i18n.T(g.lang, "promptguard.canary_leak", canary.SessionID),
+			MessageID:   "promptguard.canary_leak",
+			ThreatLevel: ThreatCritical,
+			Snippet:     canary.Token,
+			Score:       50,
+		})
+		totalWeight += 50
+		maxThreat = ThreatCritical
 	}
 
 	score := totalWeight
@@ -173,7 +264,7 @@ func (g *Guard) scan(text string, patterns []injectionPattern) ScanResult {
 		ThreatLevel: maxThreat,
 		Detections:  detections,
 		Score:       score,
-	}
+	}, err
 }
 
 func extractSnippet(text string, pattern *regexp.Regexp, maxLen int) string {
@@ -212,7 +303,7 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:ignore|disregard|forget|override|bypass)\s+(?:all\s+)?(?:your\s+|the\s+|my\s+)?(?:previous|prior|above|earlier|original|system)\s+(?:instructions?|prompts?|rules?|guidelines?|constraints?)`),
 			Category:    "instruction_override",
-			Description: "Cố gắng ghi đè chỉ dẫn hệ thống",
+			MessageID:   "promptguard.instruction_override",
 			ThreatLevel: ThreatCritical,
 			Weight:      40,
 		},
@@ -220,7 +311,7 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:show|display|reveal|print|output|repeat|tell)\s+(?:me\s+)?(?:your|the)?\s*(?:system\s+(?:prompt|message|instructions?)|initial\s+(?:prompt|instructions?)|hidden\s+(?:prompt|instructions?))|(?i)what\s+(?:are|is)\s+(?:your|the)\s+(?:system\s+)?(?:prompt|instructions?|rules?)`),
 			Category:    "prompt_extraction",
-			Description: "Cố gắng trích xuất system prompt",
+			MessageID:   "promptguard.prompt_extraction",
 			ThreatLevel: ThreatHigh,
 			Weight:      30,
 		},
@@ -228,7 +319,7 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:you\s+are\s+now|act\s+as|pretend\s+(?:to\s+be|you\s+are)|roleplay\s+as|from\s+now\s+on\s+you\s+are|imagine\s+you\s+are)\s+(?:(?:a|an)\s+)?(?:different|new|unrestricted|unfiltered|evil|malicious|DAN|jailbroken)`),
 			Category:    "jailbreak_roleplay",
-			Description: "Tấn công jailbreak qua role-play",
+			MessageID:   "promptguard.jailbreak_roleplay",
 			ThreatLevel: ThreatCritical,
 			Weight:      40,
 		},
@@ -236,7 +327,7 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)\b(?:DAN|do\s+anything\s+now|developer\s+mode|god\s+mode|sudo\s+mode|admin\s+mode|unrestricted\s+mode)\b`),
 			Category:    "jailbreak_dan",
-			Description: "Tấn công jailbreak kiểu DAN",
+			MessageID:   "promptguard.jailbreak_dan",
 			ThreatLevel: ThreatHigh,
 			Weight:      35,
 		},
@@ -244,7 +335,7 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:\[/?SYSTEM\]|\[/?INST\]|<\|(?:im_start|im_end|system|user|assistant)\|>|<<SYS>>|<\/s>)`),
 			Category:    "delimiter_injection",
-			Description: "Tiêm dấu phân cách để giả mạo vai trò",
+			MessageID:   "promptguard.delimiter_injection",
 			ThreatLevel: ThreatCritical,
 			Weight:      45,
 		},
@@ -252,7 +343,7 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:decode|base64|eval|execute)\s*(?:\(|:)\s*[A-Za-z0-9+/]{20,}={0,2}`),
 			Category:    "encoded_payload",
-			Description: "Payload mã hóa để lẩn tránh kiểm tra",
+			MessageID:   "promptguard.encoded_payload",
 			ThreatLevel: ThreatHigh,
 			Weight:      30,
 		},
@@ -260,7 +351,7 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile("(?i)<!--\\s*(?:system|instruction|override)[\\s\\S]*?-->"),
 			Category:    "format_injection",
-			Description: "Chèn chỉ dẫn ẩn qua định dạng",
+			MessageID:   "promptguard.format_injection",
 			ThreatLevel: ThreatMedium,
 			Weight:      20,
 		},
@@ -268,7 +359,7 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:new\s+conversation|reset\s+context|clear\s+(?:history|memory|context)|start\s+(?:fresh|over|new\s+session))\s*[.!]?\s*(?:you\s+(?:are|will|must|should))`),
 			Category:    "context_manipulation",
-			Description: "Thao túng ngữ cảnh hội thoại",
+			MessageID:   "promptguard.context_manipulation",
 			ThreatLevel: ThreatMedium,
 			Weight:      20,
 		},
@@ -276,7 +367,7 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:ignore\s+(?:the\s+)?(?:following|next|rest)|skip\s+to\s+(?:the\s+)?end|begin\s+(?:new|real)\s+(?:task|instruction))`),
 			Category:    "token_smuggling",
-			Description: "Lén chèn token để chuyển hướng chỉ dẫn",
+			MessageID:   "promptguard.token_smuggling",
 			ThreatLevel: ThreatMedium,
 			Weight:      25,
 		},
@@ -284,7 +375,7 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:translate|summarize|rephrase|rewrite)\s+(?:your|the|all)?\s*(?:system|initial|original|hidden|secret)\s+(?:prompt|instructions?|message|rules?)\s+(?:to|in|into)`),
 			Category:    "prompt_leak_indirect",
-			Description: "Trích xuất prompt gián tiếp qua dịch/tóm tắt",
+			MessageID:   "promptguard.prompt_leak_indirect",
 			ThreatLevel: ThreatHigh,
 			Weight:      25,
 		},
@@ -292,10 +383,53 @@ func defaultInputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:bỏ\s+qua|bỏ\s+quên|quên\s+đi|phớt\s+lờ|không\s+tuân\s+theo)\s+(?:tất\s+cả\s+)?(?:hướng\s+dẫn|chỉ\s+dẫn|quy\s+tắc|luật)`),
 			Category:    "instruction_override_vi",
-			Description: "Ghi đè chỉ dẫn bằng tiếng Việt",
+			MessageID:   "promptguard.instruction_override_vi",
 			ThreatLevel: ThreatCritical,
 			Weight:      40,
 		},
+		// Gradual jailbreak signals: harmless alone, they add up per session
+		{
+			Pattern:     regexp.MustCompile(`(?i)(?:let'?s|let\s+us|we\s+(?:will|are\s+going\s+to))\s+play\s+a\s+(?:game|role.?play)`),
+			Category:    "gradual_game_framing",
+			MessageID:   "promptguard.gradual_game_framing",
+			ThreatLevel: ThreatLow,
+			Weight:      10,
+		},
+		{
+			Pattern:     regexp.MustCompile(`(?i)(?:have|with|there\s+are)\s+no\s+(?:restrictions?|limits?|limitations?|rules|filters?|boundaries)|without\s+(?:any\s+)?(?:restrictions?|limits?|filters?|censorship)`),
+			Category:    "gradual_no_restrictions",
+			MessageID:   "promptguard.gradual_no_restrictions",
+			ThreatLevel: ThreatLow,
+			Weight:      10,
+		},
+		{
+			Pattern:     regexp.MustCompile(`(?i)(?:stay|remain|keep)\s+in\s+character|(?:don'?t|do\s+not|never)\s+break\s+character`),
+			Category:    "gradual_stay_in_character",
+			MessageID:   "promptguard.gradual_stay_in_character",
+			ThreatLevel: ThreatLow,
+			Weight:      10,
+		},
+		{
+			Pattern:     regexp.MustCompile(`(?i)\bhypothetically\b|purely\s+(?:fictional|hypothetical)|for\s+(?:educational|research)\s+purposes\s+only`),
+			Category:    "gradual_hypothetical",
+			MessageID:   "promptguard.gradual_hypothetical",
+			ThreatLevel: ThreatLow,
+			Weight:      10,
+		},
+		{
+			Pattern:     regexp.MustCompile(`(?i)you\s+can\s+(?:say|do|answer)\s+anything|nothing\s+is\s+(?:off[\s-]limits|forbidden)`),
+			Category:    "gradual_anything_goes",
+			MessageID:   "promptguard.gradual_anything_goes",
+			ThreatLevel: ThreatLow,
+			Weight:      10,
+		},
+		{
+			Pattern:     regexp.MustCompile(`(?i)(?:never|don'?t|do\s+not)\s+(?:refuse|decline|say\s+(?:no|you\s+can'?t))|(?:must|will)\s+always\s+(?:answer|comply)`),
+			Category:    "gradual_no_refusal",
+			MessageID:   "promptguard.gradual_no_refusal",
+			ThreatLevel: ThreatLow,
+			Weight:      10,
+		},
 	}
 }
 
@@ -307,7 +441,7 @@ func defaultOutputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:my\s+(?:system\s+)?(?:prompt|instructions?)\s+(?:is|are|says?)|i\s+was\s+(?:instructed|told|programmed|configured)\s+to|here\s+(?:is|are)\s+my\s+(?:system\s+)?instructions?)`),
 			Category:    "prompt_leak",
-			Description: "LLM có thể đã tiết lộ system prompt",
+			MessageID:   "promptguard.prompt_leak",
 			ThreatLevel: ThreatHigh,
 			Weight:      35,
 		},
@@ -315,7 +449,7 @@ func defaultOutputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:here(?:'s|\s+is)\s+(?:how\s+to|a\s+(?:guide|tutorial|script)\s+(?:to|for))\s+(?:hack|exploit|attack|break\s+into|compromise|inject|bypass\s+security))`),
 			Category:    "harmful_content",
-			Description: "LLM tạo nội dung hướng dẫn tấn công",
+			MessageID:   "promptguard.harmful_content",
 			ThreatLevel: ThreatHigh,
 			Weight:      30,
 		},
@@ -323,7 +457,7 @@ func defaultOutputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:os\.system|subprocess\.(?:call|run|Popen)|exec\(|eval\(|child_process|Runtime\.exec)\s*\(`),
 			Category:    "code_injection_output",
-			Description: "Output chứa lệnh thực thi mã độc",
+			MessageID:   "promptguard.code_injection_output",
 			ThreatLevel: ThreatCritical,
 			Weight:      40,
 		},
@@ -331,7 +465,7 @@ func defaultOutputPatterns() []injectionPattern {
 		{
 			Pattern:     regexp.MustCompile(`(?i)(?:i(?:'m|\s+am)\s+now\s+(?:in\s+)?(?:DAN|developer|unrestricted|jailbroken|unfiltered)\s+mode|sure[,!]?\s+(?:i'll|i\s+will|let\s+me)\s+(?:ignore|bypass|override)\s+(?:my|the)\s+(?:rules|guidelines|restrictions))`),
 			Category:    "jailbreak_success",
-			Description: "LLM có vẻ đã bị jailbreak thành công",
+			MessageID:   "promptguard.jailbreak_success",
 			ThreatLevel: ThreatCritical,
 			Weight:      45,
 		},
@@ -346,7 +480,28 @@ type CanaryToken struct {
 	SessionID string `json:"session_id"`
 }
 
-// CanaryStore manages canary tokens
+// Canaries issues canary tokens and finds them in text
+type Canaries interface {
+	Generate(sessionID string) CanaryToken
+	CheckLeaked(text string) []CanaryToken
+	RemoveSession(sessionID string)
+}
+
+// leakedCanaries returns the canaries found in text. A canary store that
+// panics is returned as an error instead of failing the whole scan.
+func (g *Guard) leakedCanaries(text string) (leaked []CanaryToken, err error) {
+	if g.canaryStore == nil {
+		return nil, nil
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			leaked, err = nil, fmt.Errorf("canary store: %v", v)
+		}
+	}()
+	return g.canaryStore.CheckLeaked(text), nil
+}
+
+// CanaryStore manages canary tokens in memory
 type CanaryStore struct {
 	mu     sync.RWMutex
 	tokens map[string]CanaryToken // token -> canary info
@@ -406,7 +561,18 @@ func (cs *CanaryStore) Remove(token string) {
 	cs.mu.Unlock()
 }
 
+// RemoveSession deletes every canary token of a session
+func (cs *CanaryStore) RemoveSession(sessionID string) {
+	cs.mu.Lock()
+	for token, canary := range cs.tokens {
+		if canary.SessionID == sessionID {
+			delete(cs.tokens, token)
+		}
+	}
+	cs.mu.Unlock()
+}
+
 // CanaryStore returns the guard's canary store for external use
-func (g *Guard) CanaryStore() *CanaryStore {
+func (g *Guard) CanaryStore() Canaries {
 	return g.canaryStore
 }
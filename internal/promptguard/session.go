@@ -0,0 +1,266 @@
+package promptguard
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/failsafe"
+)
+
+// SessionConfig controls per-session threat accumulation. A patient attacker
+// can spread an injection across many messages that each score below the
+// block threshold; the session score catches the sum.
+type SessionConfig struct {
+	HalfLife        time.Duration // accumulated score halves after this long
+	Threshold       float64       // block when the decayed session score reaches this
+	CoolDown        time.Duration // stricter treatment after crossing Threshold
+	StrictThreshold ThreatLevel   // per-message block level during cool-down
+	TTL             time.Duration // idle sessions are forgotten after this long
+}
+
+// DefaultSessionConfig returns a 10 minute half-life, threshold 50 and a
+// 15 minute cool-down during which any detection is blocked
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		HalfLife:        10 * time.Minute,
+		Threshold:       50,
+		CoolDown:        15 * time.Minute,
+		StrictThreshold: ThreatLow,
+		TTL:             time.Hour,
+	}
+}
+
+// SessionStore persists decaying session scores
+type SessionStore interface {
+	// Observe decays the stored score to now, adds score and returns the new
+	// total and the end of the cool-down (zero if the session is not flagged)
+	Observe(ctx context.Context, sessionID string, score float64, now time.Time, cfg SessionConfig) (float64, time.Time, error)
+	// Forget drops the score of a session, e.g. when it ends explicitly
+	Forget(ctx context.Context, sessionID string) error
+}
+
+// WithSessionTracking enables per-session threat accumulation, kept in
+// memory unless WithSessionStore is also given
+func WithSessionTracking(cfg SessionConfig) Option {
+	return func(g *Guard) {
+		g.sessionCfg = cfg
+		if g.sessions == nil {
+			g.sessions = NewMemorySessionStore()
+		}
+	}
+}
+
+// WithSessionStore sets the session store, e.g. Redis for multi-replica consistency
+func WithSessionStore(store SessionStore) Option {
+	return func(g *Guard) { g.sessions = store }
+}
+
+// SessionTracking reports whether session accumulation is enabled
+func (g *Guard) SessionTracking() bool {
+	return g.sessions != nil
+}
+
+// ScanInputSession scans text like ScanInput and adds the score of turnText
+// (the message new in this request; text itself when empty) to the session.
+// Callers pass the full conversation as text so fabricated history is still
+// checked, while only the new turn counts toward the session score. An empty
+// sessionID scans text alone. Canary and session store failures are
+// reported to the failure policy of ctx.
+func (g *Guard) ScanInputSession(ctx context.Context, sessionID, text, turnText string) ScanResult {
+	result, err := g.scan(text, g.inputPatterns)
+	if err != nil {
+		failsafe.Report(ctx, failsafe.Canary, sessionID, err)
+	}
+	if g.sessions == nil || sessionID == "" {
+		return result
+	}
+
+	turnScore := result.Score
+	if turnText != "" && turnText != text {
+		turn, _ := g.scan(turnText, g.inputPatterns)
+		turnScore = turn.Score
+	}
+
+	now := g.now()
+	score, flaggedUntil, err := g.sessions.Observe(ctx, sessionID, turnScore, now, g.sessionCfg)
+	if err != nil {
+		// The single-message check still applies; the failure policy
+		// decides whether the request goes on without the session score
+		failsafe.Report(ctx, failsafe.PromptGuard, sessionID, fmt.Errorf("session store: %w", err))
+		return result
+	}
+
+	result.SessionScore = math.Round(score*100) / 100
+	result.SessionFlagged = now.Before(flaggedUntil)
+	result.SessionCrossed = turnScore > 0 && score >= g.sessionCfg.Threshold
+	return result
+}
+
+// PurgeSession drops the state kept for an explicit session: its
+// accumulated threat score and the canary tokens issued for it
+func (g *Guard) PurgeSession(ctx context.Context, sessionID string) error {
+	if g.canaryStore != nil {
+		g.canaryStore.RemoveSession(sessionID)
+	}
+	if g.sessions == nil {
+		return nil
+	}
+	return g.sessions.Forget(ctx, "sid:"+sessionID)
+}
+
+// IssueCanary generates a canary token for a session. A request that
+// contains it later is blocked as a leak.
+func (g *Guard) IssueCanary(sessionID string) string {
+	if g.canaryStore == nil {
+		return ""
+	}
+	return g.canaryStore.Generate(sessionID).Token
+}
+
+// decayScore applies exponential decay over elapsed time
+func decayScore(score float64, elapsed, halfLife time.Duration) float64 {
+	if halfLife <= 0 || elapsed <= 0 {
+		return score
+	}
+	return score * math.Pow(0.5, float64(elapsed)/float64(halfLife))
+}
+
+// MemorySessionStore keeps session scores in process with TTL eviction
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]*sessionEntry
+	lastSweep time.Time
+}
+
+type sessionEntry struct {
+	score        float64
+	updated      time.Time
+	flaggedUntil time.Time
+}
+
+// NewMemorySessionStore creates an in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]*sessionEntry)}
+}
+
+// Observe implements SessionStore
+func (m *MemorySessionStore) Observe(_ context.Context, sessionID string, score float64, now time.Time, cfg SessionConfig) (float64, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now, cfg.TTL)
+
+	e, ok := m.sessions[sessionID]
+	if !ok {
+		e = &sessionEntry{updated: now}
+		m.sessions[sessionID] = e
+	}
+	e.score = decayScore(e.score, now.Sub(e.updated), cfg.HalfLife) + score
+	e.updated = now
+	if score > 0 && e.score >= cfg.Threshold {
+		e.flaggedUntil = now.Add(cfg.CoolDown)
+	}
+	return e.score, e.flaggedUntil, nil
+}
+
+// Forget implements SessionStore
+func (m *MemorySessionStore) Forget(_ context.Context, sessionID string) error {
+	m.mu.Lock()
+	delete(m.sessions, sessionID)
+	m.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of tracked sessions
+func (m *MemorySessionStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// sweep drops idle sessions at most once a minute. Caller holds m.mu.
+func (m *MemorySessionStore) sweep(now time.Time, ttl time.Duration) {
+	if ttl <= 0 || now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for id, e := range m.sessions {
+		if now.Sub(e.updated) > ttl && !now.Before(e.flaggedUntil) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// RedisSessionStore shares session scores between replicas. Decay and
+// accumulation run in a Lua script so concurrent requests don't race.
+type RedisSessionStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisSessionStore creates a Redis-backed session store
+func NewRedisSessionStore(client redis.UniversalClient) *RedisSessionStore {
+	return &RedisSessionStore{client: client}
+}
+
+var observeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local add = tonumber(ARGV[2])
+local halfLife = tonumber(ARGV[3])
+local score = tonumber(redis.call('HGET', KEYS[1], 'score') or '0')
+local updated = tonumber(redis.call('HGET', KEYS[1], 'updated') or ARGV[1])
+local flagged = tonumber(redis.call('HGET', KEYS[1], 'flagged_until') or '0')
+if halfLife > 0 and now > updated then
+  score = score * math.pow(0.5, (now - updated) / halfLife)
+end
+score = score + add
+if add > 0 and score >= tonumber(ARGV[4]) then
+  flagged = now + tonumber(ARGV[5])
+end
+redis.call('HSET', KEYS[1], 'score', tostring(score), 'updated', ARGV[1], 'flagged_until', tostring(flagged))
+local ttl = tonumber(ARGV[6])
+if flagged - now > ttl then ttl = flagged - now end
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {tostring(score), tostring(flagged)}
+`)
+
+// Observe implements SessionStore
+func (s *RedisSessionStore) Observe(ctx context.Context, sessionID string, score float64, now time.Time, cfg SessionConfig) (float64, time.Time, error) {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	res, err := observeScript.Run(ctx, s.client, []string{"promptguard:session:" + sessionID},
+		now.UnixMilli(), score, cfg.HalfLife.Milliseconds(), cfg.Threshold,
+		cfg.CoolDown.Milliseconds(), ttl.Milliseconds(),
+	).StringSlice()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if len(res) != 2 {
+		return 0, time.Time{}, redis.Nil
+	}
+
+	total, err := strconv.ParseFloat(res[0], 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	flaggedMs, err := strconv.ParseFloat(res[1], 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	var flaggedUntil time.Time
+	if flaggedMs > 0 {
+		flaggedUntil = time.UnixMilli(int64(flaggedMs))
+	}
+	return total, flaggedUntil, nil
+}
+
+// Forget implements SessionStore
+func (s *RedisSessionStore) Forget(ctx context.Context, sessionID string) error {
+	return s.client.Del(ctx, "promptguard:session:"+sessionID).Err()
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+
+	"github.com/vurakit/agentveil/internal/auth"
+)
+
+// AdminListener is a second listener for the admin API, MCP over HTTP and
+// pprof, so they can be bound to an internal interface with their own TLS
+// and auth while the main listener serves only proxy traffic and health
+type AdminListener struct {
+	Addr    string
+	TLSCert string // empty = plain HTTP
+	TLSKey  string
+	// ClientCA is a PEM bundle; when set, clients authenticate with a
+	// certificate it signed instead of an admin Veil key
+	ClientCA string
+	Pprof    bool // serve /debug/pprof/
+}
+
+// TLSConfig returns the listener's TLS configuration, nil for plain HTTP
+func (c AdminListener) TLSConfig() (*tls.Config, error) {
+	if c.TLSCert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("load admin TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.ClientCA != "" {
+		pem, err := os.ReadFile(c.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("read admin client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("admin client CA %s has no PEM certificates", c.ClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// Guard wraps an admin endpoint in the auth it needs. roles are the key
+// roles the endpoint admits on the main listener; none means it is open
+// there.
+type Guard func(roles ...auth.Role) func(http.Handler) http.Handler
+
+// RoleGuard admits the endpoint's roles with am, as the main listener does.
+// It is nil without auth, and endpoints that need a role are not served.
+func RoleGuard(am *auth.Manager) Guard {
+	if am == nil {
+		return nil
+	}
+	return func(roles ...auth.Role) func(http.Handler) http.Handler {
+		if len(roles) == 0 {
+			return func(next http.Handler) http.Handler { return next }
+		}
+		return am.RequireRole(roles...)
+	}
+}
+
+// Guard returns the admin listener's guard: a verified client certificate
+// with ClientCA, otherwise an admin Veil key for every endpoint
+func (c AdminListener) Guard(am *auth.Manager) Guard {
+	if c.ClientCA != "" {
+		return func(...auth.Role) func(http.Handler) http.Handler { return requireClientCert }
+	}
+	if am == nil {
+		return nil
+	}
+	return func(...auth.Role) func(http.Handler) http.Handler { return am.RequireRole(auth.RoleAdmin) }
+}
+
+// requireClientCert admits requests with a verified client certificate as
+// admin, keyed by the certificate's common name
+func requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only this middleware may vouch for a key and its role
+		r.Header.Del("X-Veil-Key-ID")
+		r.Header.Del("X-User-Role")
+		r.Header.Del("X-Veil-Detector-Profile")
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, `{"error":"unauthorized","message":"client certificate required"}`, http.StatusUnauthorized)
+			return
+		}
+		r.Header.Set("X-Veil-Key-ID", "cert:"+r.TLS.VerifiedChains[0][0].Subject.CommonName)
+		r.Header.Set("X-User-Role", string(auth.RoleAdmin))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleExtras registers what only the admin listener serves: /healthz for
+// its own probes, the MCP server under /mcp/ when mcp is set, and pprof when
+// enabled
+func (c AdminListener) HandleExtras(mux interface{ Handle(string, http.Handler) }, guard Guard, mcp http.Handler) {
+	mux.Handle("GET /healthz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	if guard == nil {
+		return
+	}
+	admin := guard(auth.RoleAdmin)
+	if mcp != nil {
+		mux.Handle("/mcp/", admin(mcp))
+	}
+	if c.Pprof {
+		mux.Handle("/debug/pprof/", admin(http.HandlerFunc(pprof.Index)))
+		mux.Handle("/debug/pprof/cmdline", admin(http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("/debug/pprof/profile", admin(http.HandlerFunc(pprof.Profile)))
+		mux.Handle("/debug/pprof/symbol", admin(http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("/debug/pprof/trace", admin(http.HandlerFunc(pprof.Trace)))
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/vault"
+)
+
+func TestAdminListener_SplitsRoutes(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	am := auth.NewManager(client)
+	ctx := context.Background()
+	adminKey, _, _ := am.GenerateKey(ctx, auth.RoleAdmin, "admin")
+	auditorKey, _, _ := am.GenerateKey(ctx, auth.RoleAuditor, "auditor")
+	v := vault.NewWithClient(client)
+	resolver := NewResolver(v, accesslog.NewWithWriter(&bytes.Buffer{}, accesslog.FieldsCommon), 10, nil)
+	srv, err := New(Config{TargetURL: "http://127.0.0.1:1"}, detector.New(), v, WithAuth(am), WithResolver(resolver))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := AdminListener{Addr: ":9090", Pprof: true}
+	adminMux := http.NewServeMux()
+	guard := listener.Guard(am)
+	srv.HandleAdmin(adminMux, guard)
+	listener.HandleExtras(adminMux, guard, nil)
+
+	do := func(h http.Handler, method, path, key string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			req.Header.Set("X-Veil-Key", key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	public := srv.PublicHandler()
+	for _, path := range []string{"/admin/status", "/admin/readiness", "/admin/sessions", "/debug/pprof/"} {
+		if code := do(public, http.MethodGet, path, adminKey); code != http.StatusNotFound {
+			t.Errorf("public GET %s = %d, want 404", path, code)
+		}
+	}
+	if code := do(public, http.MethodGet, "/healthz", ""); code != http.StatusOK {
+		t.Errorf("public /healthz = %d", code)
+	}
+
+	if code := do(adminMux, http.MethodGet, "/admin/status", adminKey); code != http.StatusOK {
+		t.Errorf("admin /admin/status = %d", code)
+	}
+	if code := do(adminMux, http.MethodGet, "/admin/status", ""); code != http.StatusUnauthorized {
+		t.Errorf("admin /admin/status without key = %d", code)
+	}
+	// Admin keys only: the auditor role the main listener admits is refused
+	if code := do(adminMux, http.MethodPost, "/admin/vault/resolve", auditorKey); code != http.StatusForbidden {
+		t.Errorf("auditor /admin/vault/resolve = %d", code)
+	}
+	if code := do(adminMux, http.MethodGet, "/debug/pprof/", adminKey); code != http.StatusOK {
+		t.Errorf("admin pprof = %d", code)
+	}
+	if code := do(adminMux, http.MethodGet, "/v1/models", adminKey); code != http.StatusNotFound {
+		t.Errorf("admin /v1/models = %d, want 404", code)
+	}
+}
+
+func TestRequireClientCert(t *testing.T) {
+	var role, id string
+	h := requireClientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, id = r.Header.Get("X-User-Role"), r.Header.Get("X-Veil-Key-ID")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/status", nil)
+	req.Header.Set("X-User-Role", "admin")
+	req.Header.Set("X-Veil-Key-ID", "spoofed")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || role != "" {
+		t.Errorf("without certificate: %d, role %q", w.Code, role)
+	}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || role != string(auth.RoleAdmin) || id != "cert:ops" {
+		t.Errorf("with certificate: %d, role %q, id %q", w.Code, role, id)
+	}
+}
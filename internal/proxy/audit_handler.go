@@ -2,10 +2,13 @@ package proxy
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 
 	"github.com/vurakit/agentveil/internal/auditor"
+	"github.com/vurakit/agentveil/internal/i18n"
 )
 
 // AuditRequest is the JSON body for skill.md audit requests
@@ -15,13 +18,21 @@ type AuditRequest struct {
 
 // HandleAudit returns an http.HandlerFunc for POST /audit (standalone, no Server needed).
 // Used in router mode where /audit is registered outside the Server handler chain.
-func HandleAudit() http.HandlerFunc {
+// Reports are in lang unless the request's Accept-Language names another.
+func HandleAudit(lang i18n.Lang) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		srv := &Server{}
+		srv := &Server{config: Config{Lang: lang}}
 		srv.handleAudit(w, r)
 	}
 }
 
+// newAuditor returns an auditor reporting in the language r asks for
+func (s *Server) newAuditor(r *http.Request) *auditor.Auditor {
+	a := auditor.New()
+	a.SetLang(i18n.FromRequest(r, s.config.Lang))
+	return a
+}
+
 // handleAudit handles POST /audit to analyze skill.md content
 func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -29,7 +40,7 @@ func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxBodySize))
 	if err != nil {
 		http.Error(w, `{"error":"bad_request","message":"cannot read body"}`, http.StatusBadRequest)
 		return
@@ -47,8 +58,16 @@ func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a := auditor.New()
-	report := a.Analyze(req.Content)
+	a := s.newAuditor(r)
+	report, err := a.AnalyzeContext(r.Context(), req.Content)
+	if errors.Is(err, auditor.ErrContentTooLarge) {
+		http.Error(w, fmt.Sprintf(`{"error":"content_too_large","message":%q}`, err.Error()), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"canceled","message":"audit canceled"}`, http.StatusServiceUnavailable)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -58,3 +77,165 @@ func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(report)
 }
+
+// maxAuditProjectFiles bounds the files of one POST /audit/project
+const maxAuditProjectFiles = 500
+
+// AuditProjectRequest is the JSON body for POST /audit/project. Files maps
+// paths to contents; references between files are found by path and file
+// name.
+type AuditProjectRequest struct {
+	Files map[string]string `json:"files"`
+	// RequireReference only chains files that reference each other, true
+	// when unset
+	RequireReference *bool `json:"require_reference,omitempty"`
+	// MaxFileDistance is the most reference hops between two files of a
+	// chain, any number when 0
+	MaxFileDistance int `json:"max_file_distance,omitempty"`
+}
+
+// HandleAuditProject returns an http.HandlerFunc for POST /audit/project
+// (standalone, for router mode), reporting in lang by default
+func HandleAuditProject(lang i18n.Lang) http.HandlerFunc {
+	return (&Server{config: Config{Lang: lang}}).handleAuditProject
+}
+
+// handleAuditProject audits several files of one project, chains across
+// files included
+func (s *Server) handleAuditProject(w http.ResponseWriter, r *http.Request) {
+	var req AuditProjectRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, MaxBodySize)).Decode(&req); err != nil {
+		http.Error(w, `{"error":"bad_request","message":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.Files) == 0 || len(req.Files) > maxAuditProjectFiles {
+		http.Error(w, `{"error":"bad_request","message":"files must hold 1 to 500 entries"}`, http.StatusBadRequest)
+		return
+	}
+	if req.MaxFileDistance < 0 {
+		http.Error(w, `{"error":"bad_request","message":"max_file_distance must not be negative"}`, http.StatusBadRequest)
+		return
+	}
+
+	opts := auditor.DefaultProjectOptions()
+	if req.RequireReference != nil {
+		opts.RequireReference = *req.RequireReference
+	}
+	opts.MaxFileDistance = req.MaxFileDistance
+	a := s.newAuditor(r)
+	a.SetProjectOptions(opts)
+	report, err := a.AnalyzeProjectContext(r.Context(), req.Files)
+	if errors.Is(err, auditor.ErrContentTooLarge) {
+		http.Error(w, fmt.Sprintf(`{"error":"content_too_large","message":%q}`, err.Error()), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"canceled","message":"audit canceled"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.RiskLevel >= auditor.RiskHigh {
+		w.WriteHeader(http.StatusForbidden)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Limits for POST /audit/test
+const (
+	maxAuditTestSamples   = 100
+	maxAuditTestSampleLen = 8 << 10
+	maxAuditPatternLen    = 1 << 10
+)
+
+// AuditTestRequest is the JSON body for POST /audit/test. Exactly one of
+// RuleID and Pattern is set.
+type AuditTestRequest struct {
+	RuleID  string   `json:"rule_id,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+	Samples []string `json:"samples"`
+}
+
+// HandleAuditRules returns an http.HandlerFunc for GET /audit/rules
+// (standalone, for router mode), describing rules in lang by default
+func HandleAuditRules(lang i18n.Lang) http.HandlerFunc {
+	return (&Server{config: Config{Lang: lang}}).handleAuditRules
+}
+
+// HandleAuditTest returns an http.HandlerFunc for POST /audit/test
+// (standalone, for router mode)
+func HandleAuditTest() http.HandlerFunc {
+	return (&Server{}).handleAuditTest
+}
+
+// handleAuditRules lists the auditor's rules, regexes included
+func (s *Server) handleAuditRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditRulesResponse{Rules: s.newAuditor(r).Rules()})
+}
+
+// AuditRulesResponse is the body of GET /audit/rules
+type AuditRulesResponse struct {
+	Rules []auditor.Rule `json:"rules"`
+}
+
+// AuditTestResponse is the body of POST /audit/test
+type AuditTestResponse struct {
+	Results []auditor.SampleResult `json:"results"`
+	Matched int                    `json:"matched"` // samples matched by the rule or pattern
+}
+
+// handleAuditTest evaluates a rule or an inline pattern against samples
+func (s *Server) handleAuditTest(w http.ResponseWriter, r *http.Request) {
+	var req AuditTestRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, MaxBodySize)).Decode(&req); err != nil {
+		http.Error(w, `{"error":"bad_request","message":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	if (req.RuleID == "") == (req.Pattern == "") {
+		http.Error(w, `{"error":"bad_request","message":"set exactly one of rule_id and pattern"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.Samples) == 0 || len(req.Samples) > maxAuditTestSamples {
+		http.Error(w, `{"error":"bad_request","message":"samples must hold 1 to 100 strings"}`, http.StatusBadRequest)
+		return
+	}
+	for _, sample := range req.Samples {
+		if len(sample) > maxAuditTestSampleLen {
+			http.Error(w, `{"error":"bad_request","message":"samples are limited to 8 KiB each"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	a := auditor.New()
+	var results []auditor.SampleResult
+	var err error
+	if req.RuleID != "" {
+		results, err = a.TestRule(req.RuleID, req.Samples)
+		if errors.Is(err, auditor.ErrUnknownRule) {
+			http.Error(w, `{"error":"not_found","message":"unknown rule_id, see GET /audit/rules"}`, http.StatusNotFound)
+			return
+		}
+	} else {
+		if len(req.Pattern) > maxAuditPatternLen {
+			http.Error(w, `{"error":"bad_request","message":"pattern is limited to 1 KiB"}`, http.StatusBadRequest)
+			return
+		}
+		results, err = a.TestPattern(req.Pattern, req.Samples)
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "bad_request", "message": err.Error()})
+		return
+	}
+
+	matched := 0
+	for _, res := range results {
+		if res.Matched {
+			matched++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditTestResponse{Results: results, Matched: matched})
+}
@@ -0,0 +1,261 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/forensic"
+	"github.com/vurakit/agentveil/internal/vault"
+)
+
+// DefaultBinaryMinLength is the shortest JSON string checked for raw
+// base64 media (Anthropic image sources, OpenAI input_audio, Gemini
+// inline_data). Data URIs are skipped at any length.
+const DefaultBinaryMinLength = 1024
+
+// minBinaryEntropy is the Shannon entropy, in bits per character, below
+// which a base64-looking string is treated as text. Encoded compressed
+// media sits close to the maximum of 6.
+const minBinaryEntropy = 4.0
+
+// dataURIPattern matches base64 data URIs for media, with the slashes of
+// the payload possibly JSON-escaped
+var dataURIPattern = regexp.MustCompile(`data:(?:image|audio|video|application)/[\w.+-]+;base64,(?:[A-Za-z0-9+/=]|\\/)+`)
+
+// binaryPlaceholder marks a masked span. NUL never appears unescaped in a
+// JSON or form body and no detector pattern matches it.
+const binaryPlaceholder = "\x00veil-binary-%d\x00"
+
+// anonymizeBody is anonymize for request bodies. Binary content types are
+// passed through, and media embedded in the body is masked while the
+// detector runs so base64 data is neither scanned nor tokenized. The
+// transformation is recorded in the context's forensic record, if any.
+func anonymizeBody(ctx context.Context, det Detector, v *vault.Vault, sessionID, contentType, body string, minLen int) (string, []detector.Match, map[string]string) {
+	rec := forensic.From(ctx)
+	if isBinaryContentType(contentType) {
+		rec.SetBody(body, body, nil)
+		return body, nil, nil
+	}
+	masked, spans := maskBinary(contentType, body, minLen)
+	anonymized, applied, mapping, neutralized := anonymizeTraced(ctx, det, v, sessionID, masked, rec != nil)
+	out := unmaskBinary(anonymized, spans)
+	if rec != nil {
+		rec.SetBody(body, out, bodyEdits(masked, spans, neutralized, applied))
+	}
+	return out, applied, mapping
+}
+
+// isBinaryContentType reports whether a whole body is media rather than text
+func isBinaryContentType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "image/"), strings.HasPrefix(mt, "audio/"), strings.HasPrefix(mt, "video/"):
+		return true
+	case mt == "application/octet-stream", mt == "application/pdf", mt == "application/zip":
+		return true
+	}
+	return false
+}
+
+// maskBinary replaces embedded media in text with placeholders and returns
+// the originals in placeholder order. A minLen below zero turns off the
+// raw base64 heuristic.
+func maskBinary(contentType, text string, minLen int) (string, []string) {
+	if strings.Contains(text, "\x00veil-binary-") {
+		// Masking could not be undone unambiguously
+		return text, nil
+	}
+	var spans []string
+	mask := func(s string) string {
+		spans = append(spans, s)
+		return fmt.Sprintf(binaryPlaceholder, len(spans)-1)
+	}
+
+	if mt, params, err := mime.ParseMediaType(contentType); err == nil && strings.HasPrefix(mt, "multipart/") && params["boundary"] != "" {
+		text = maskMultipart(text, params["boundary"], mask)
+	}
+	if strings.Contains(text, ";base64,") {
+		text = dataURIPattern.ReplaceAllStringFunc(text, mask)
+	}
+	if minLen >= 0 {
+		if minLen == 0 {
+			minLen = DefaultBinaryMinLength
+		}
+		text = maskBase64Strings(text, minLen, mask)
+	}
+	return text, spans
+}
+
+// unmaskBinary restores the spans masked by maskBinary
+func unmaskBinary(text string, spans []string) string {
+	if len(spans) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(spans))
+	for i, s := range spans {
+		pairs = append(pairs, fmt.Sprintf(binaryPlaceholder, i), s)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// maskBase64Strings masks JSON string literals of at least minLen
+// characters that decode as base64 media
+func maskBase64Strings(text string, minLen int, mask func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] != '"' {
+			continue
+		}
+		end := closingQuote(text, i+1)
+		if end < 0 {
+			break
+		}
+		if s := text[i+1 : end]; len(s) >= minLen && isBase64Media(s) {
+			b.WriteString(text[last : i+1])
+			b.WriteString(mask(s))
+			last = end
+		}
+		i = end
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// closingQuote returns the index of the quote ending a JSON string that
+// starts at from, or -1
+func closingQuote(text string, from int) int {
+	for i := from; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// isBase64Media reports whether s is standard base64 with high entropy
+// whose decoded bytes start like an image, audio, video or PDF file
+func isBase64Media(s string) bool {
+	s = strings.ReplaceAll(s, `\/`, "/")
+	if len(s) < 64 {
+		return false
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' || c == '=') {
+			return false
+		}
+		counts[c]++
+	}
+	if entropy(counts[:], len(s)) < minBinaryEntropy {
+		return false
+	}
+
+	// 64 characters decode to 48 bytes, enough for content sniffing
+	head, err := base64.StdEncoding.DecodeString(s[:64])
+	if err != nil {
+		return false
+	}
+	switch ct := http.DetectContentType(head); {
+	case strings.HasPrefix(ct, "image/"), strings.HasPrefix(ct, "audio/"), strings.HasPrefix(ct, "video/"):
+		return true
+	case ct == "application/pdf", ct == "application/ogg":
+		return true
+	}
+	return false
+}
+
+func entropy(counts []int, n int) float64 {
+	var h float64
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// maskMultipart masks the content of form parts with non-text content,
+// leaving text fields and text files to the detector
+func maskMultipart(text, boundary string, mask func(string) string) string {
+	delim := "--" + boundary
+	parts := strings.Split(text, delim)
+	for i := 1; i < len(parts); i++ {
+		headerEnd := strings.Index(parts[i], "\r\n\r\n")
+		if headerEnd < 0 {
+			continue
+		}
+		if !isBinaryPart(parts[i][:headerEnd]) {
+			continue
+		}
+		content := parts[i][headerEnd+4:]
+		// The CRLF before the next delimiter belongs to the framing
+		trail := ""
+		if strings.HasSuffix(content, "\r\n") {
+			content, trail = content[:len(content)-2], "\r\n"
+		}
+		parts[i] = parts[i][:headerEnd+4] + mask(content) + trail
+	}
+	return strings.Join(parts, delim)
+}
+
+// isBinaryPart reports whether a form part's headers describe non-text
+// content. A file part without a Content-Type is octet-stream (RFC 7578);
+// uploaded text files are still scanned.
+func isBinaryPart(header string) bool {
+	disposition, contentType := "", ""
+	for _, line := range strings.Split(header, "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "content-disposition":
+			disposition = strings.TrimSpace(value)
+		case "content-type":
+			contentType = strings.TrimSpace(value)
+		}
+	}
+	return isBinaryPartType(disposition, contentType, nil)
+}
+
+// isBinaryPartType is isBinaryPart on parsed headers. When head, the start
+// of the content, is given, octet-stream files are sniffed instead: SDKs
+// send .jsonl files as application/octet-stream.
+func isBinaryPartType(disposition, contentType string, head []byte) bool {
+	isFile := false
+	if _, params, err := mime.ParseMediaType(disposition); err == nil {
+		_, isFile = params["filename"]
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	if head != nil && (mt == "" || mt == "application/octet-stream") {
+		return !strings.HasPrefix(http.DetectContentType(head), "text/")
+	}
+	if mt == "" {
+		return isFile
+	}
+	switch mt {
+	case "application/json", "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+		return false
+	}
+	return !strings.HasPrefix(mt, "text/")
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// SessionBinding restricts rehydration to the identity that created a
+// vault session, so a caller who learns or guesses a session ID cannot
+// have the LLM echo its tokens back and receive the originals. The
+// identity is the Veil key, or the client IP for requests without one.
+// Admin keys may rehydrate any session; each override is audit-logged.
+// Denied responses pass through tokenized and are reported as
+// session.replay_denied events.
+type SessionBinding struct {
+	// Disabled skips the check, for single-user dev setups
+	Disabled bool
+	// Audit receives overrides and denials, stdout when nil
+	Audit   *accesslog.Logger
+	Webhook *webhook.Dispatcher
+}
+
+// requestOwner is the identity a request binds new sessions to
+func requestOwner(req *http.Request) string {
+	if id := req.Header.Get("X-Veil-Key-ID"); id != "" {
+		return "key:" + id
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// withOwner makes the vault bind sessions created by req to its caller
+func withOwner(req *http.Request) *http.Request {
+	return req.WithContext(vault.WithOwner(req.Context(), requestOwner(req)))
+}
+
+// allow reports whether the response to req may be rehydrated from
+// sessionID. Sessions stored without an owner, before binding existed,
+// are allowed.
+func (b SessionBinding) allow(v *vault.Vault, req *http.Request, sessionID, source string) bool {
+	if b.Disabled || req == nil {
+		return true
+	}
+	owner, err := v.Owner(req.Context(), sessionID)
+	if err != nil {
+		failsafe.Report(req.Context(), failsafe.Vault, sessionID, fmt.Errorf("%s: owner lookup: %w", source, err))
+		return false
+	}
+	caller := requestOwner(req)
+	if owner == "" || owner == caller {
+		return true
+	}
+
+	keyID, role := req.Header.Get("X-Veil-Key-ID"), req.Header.Get("X-User-Role")
+	if keyID != "" && role == string(auth.RoleAdmin) {
+		b.audit(accesslog.AuditEvent{
+			Event:     "session_rehydrate",
+			KeyID:     keyID,
+			Role:      role,
+			SessionID: sessionID,
+			Reason:    "session owned by " + owner,
+			Outcome:   "admin_override",
+		})
+		return true
+	}
+
+	slog.Warn(source+": rehydration denied", "session", sessionID, "owner", owner, "caller", caller)
+	b.audit(accesslog.AuditEvent{
+		Event:     "session_rehydrate",
+		KeyID:     keyID,
+		Role:      role,
+		SessionID: sessionID,
+		Reason:    "session owned by " + owner,
+		Outcome:   "denied",
+	})
+	if b.Webhook != nil {
+		b.Webhook.Emit(webhook.Event{
+			Type:      webhook.EventSessionReplayDenied,
+			SessionID: sessionID,
+			Data:      map[string]any{"caller": caller, "owner": owner, "source": source},
+		})
+	}
+	return false
+}
+
+func (b SessionBinding) audit(e accesslog.AuditEvent) {
+	logger := b.Audit
+	if logger == nil {
+		logger = accesslog.NewWithWriter(os.Stdout, accesslog.FieldsCommon)
+	}
+	logger.Audit(e)
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// recallUpstream answers every request with completion, like an LLM that
+// repeats a token from earlier in the conversation. Tokens a client sends
+// are neutralized, so a replay needs the model to produce the token.
+func recallUpstream(t *testing.T, completion string) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		writeEchoCompletion(w, []byte(completion))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestSessionBinding_CrossKeyReplay(t *testing.T) {
+	var mu sync.Mutex
+	var events []webhook.Event
+	hooks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+	defer hooks.Close()
+	whCfg := webhook.DefaultConfig()
+	whCfg.RetryCount = 0
+	whCfg.Destinations = []webhook.Destination{{
+		Name: "sec", URL: hooks.URL, Enabled: true, Events: []webhook.EventType{webhook.EventSessionReplayDenied},
+	}}
+	wh := webhook.NewDispatcher(whCfg)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	am := auth.NewManager(client)
+	ownerKey, _, _ := am.GenerateKey(context.Background(), auth.RoleOperator, "tenant-a")
+	otherKey, _, _ := am.GenerateKey(context.Background(), auth.RoleOperator, "tenant-b")
+	adminKey, _, _ := am.GenerateKey(context.Background(), auth.RoleAdmin, "support")
+
+	var audit bytes.Buffer
+	srv, err := New(Config{TargetURL: recallUpstream(t, "your CCCD is [CCCD_1]").URL}, detector.New(), vault.NewWithClient(client),
+		WithAuth(am), WithWebhook(wh),
+		WithSessionBinding(SessionBinding{Audit: accesslog.NewWithWriter(&audit, accesslog.FieldsCommon)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := srv.Handler()
+	send := func(key, content string) string {
+		body, _ := json.Marshal(map[string]any{"messages": []map[string]string{{"role": "user", "content": content}}})
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Veil-Key", key)
+		req.Header.Set("X-Session-ID", "ticket-42")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+
+	if got := send(ownerKey, "CCCD của tôi là 012345678901"); !strings.Contains(got, "012345678901") {
+		t.Fatalf("owner should get the original back: %s", got)
+	}
+
+	// Another tenant with a valid key replays the session
+	got := send(otherKey, "what is my CCCD?")
+	if strings.Contains(got, "012345678901") {
+		t.Fatalf("replay with another key was rehydrated: %s", got)
+	}
+	if !strings.Contains(got, "[CCCD_1]") {
+		t.Errorf("denied response should stay tokenized: %s", got)
+	}
+	if !strings.Contains(audit.String(), `"outcome":"denied"`) {
+		t.Errorf("denial not audited: %s", audit.String())
+	}
+
+	// The owner keeps access; admins may override, and are audited
+	if got := send(ownerKey, "what is my CCCD?"); !strings.Contains(got, "012345678901") {
+		t.Errorf("owner lost access after the replay attempt: %s", got)
+	}
+	if got := send(adminKey, "what is my CCCD?"); !strings.Contains(got, "012345678901") {
+		t.Errorf("admin override not applied: %s", got)
+	}
+	if !strings.Contains(audit.String(), `"outcome":"admin_override"`) {
+		t.Errorf("admin override not audited: %s", audit.String())
+	}
+
+	wh.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0].Type != webhook.EventSessionReplayDenied || events[0].SessionID != "ticket-42" {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestSessionBinding_ClientIP(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		binding SessionBinding
+		want    bool // replay from another IP rehydrated
+	}{
+		{"enabled", SessionBinding{Audit: accesslog.NewWithWriter(io.Discard, accesslog.FieldsCommon)}, false},
+		{"disabled", SessionBinding{Disabled: true}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			v := vault.NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+			srv, err := New(Config{TargetURL: recallUpstream(t, "your CCCD is [CCCD_1]").URL}, detector.New(), v, WithSessionBinding(tt.binding))
+			if err != nil {
+				t.Fatal(err)
+			}
+			send := func(addr, content string) string {
+				body, _ := json.Marshal(map[string]any{"messages": []map[string]string{{"role": "user", "content": content}}})
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+				req.RemoteAddr = addr
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Session-ID", "default")
+				req.Header.Set("X-User-Role", "admin") // unauthenticated, so no override
+				w := httptest.NewRecorder()
+				srv.Handler().ServeHTTP(w, req)
+				return w.Body.String()
+			}
+
+			if got := send("10.0.0.1:5000", "CCCD của tôi là 012345678901"); !strings.Contains(got, "012345678901") {
+				t.Fatalf("owner should get the original back: %s", got)
+			}
+			if got := send("10.0.0.1:6000", "what is my CCCD?"); !strings.Contains(got, "012345678901") {
+				t.Errorf("same IP on another port was denied: %s", got)
+			}
+			if got := send("10.0.0.2:5000", "what is my CCCD?"); strings.Contains(got, "012345678901") != tt.want {
+				t.Errorf("replay from another IP: rehydrated = %v, want %v", !tt.want, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package proxy_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vurakit/agentveil/pkg/veiltest"
+)
+
+// End-to-end tests run through pkg/veiltest, over real HTTP, the way
+// users test their agents
+
+func TestProxy_AnonymizeAndRehydrate(t *testing.T) {
+	p := veiltest.NewTestProxy(t, veiltest.Options{})
+
+	p.Chat(t, "CCCD của tôi là 012345678901")
+
+	p.UpstreamNeverSaw(t, "012345678901")
+	p.UpstreamSaw(t, "[CCCD_1]")
+	// The provider echoes the token; admins get the original back
+	p.ResponseContains(t, "012345678901")
+}
+
+func TestProxy_ViewerMasking(t *testing.T) {
+	p := veiltest.NewTestProxy(t, veiltest.Options{})
+
+	p.Chat(t, "CCCD: 012345678901", veiltest.WithRole("viewer"))
+
+	p.ResponseNotContains(t, "012345678901")
+	p.ResponseContains(t, "xx")
+}
+
+func TestProxy_NoPII(t *testing.T) {
+	p := veiltest.NewTestProxy(t, veiltest.Options{})
+
+	p.Chat(t, "Xin chào, tôi muốn hỏi về sản phẩm")
+
+	p.UpstreamSaw(t, "Xin chào, tôi muốn hỏi về sản phẩm")
+	p.ResponseContains(t, "sản phẩm")
+}
+
+func TestProxy_UnknownRoleRejected(t *testing.T) {
+	p := veiltest.NewTestProxy(t, veiltest.Options{})
+
+	resp := p.Do(t, http.MethodPost, "/v1/chat/completions", `{}`, veiltest.WithRole("hacker"))
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for unknown role, got %d", resp.StatusCode)
+	}
+	p.WasBlockedWithType(t, "forbidden")
+}
+
+func TestProxy_SSEStreaming(t *testing.T) {
+	p := veiltest.NewTestProxy(t, veiltest.Options{})
+	p.Chat(t, "CCCD 012345678901", veiltest.WithSession("sse-session"))
+	p.Provider.Script(veiltest.Reply{Stream: []string{"Hello ", "[CCCD_1]"}})
+
+	p.Chat(t, "repeat it", veiltest.WithSession("sse-session"))
+
+	p.ResponseContains(t, "012345678901")
+	p.ResponseContains(t, "data: [DONE]")
+}
+
+func TestProxy_SessionTokensStable(t *testing.T) {
+	p := veiltest.NewTestProxy(t, veiltest.Options{})
+	upstreamBody := func() string { return p.Provider.LastRequest().Body }
+
+	p.Chat(t, "gọi 0901234567", veiltest.WithSession("s1"))
+	if !strings.Contains(upstreamBody(), "gọi [PHONE_1]") {
+		t.Fatalf("first request: upstream got %s", upstreamBody())
+	}
+
+	p.Chat(t, "gọi 0912345678 hoặc 0901234567", veiltest.WithSession("s1"))
+	if !strings.Contains(upstreamBody(), "gọi [PHONE_2] hoặc [PHONE_1]") {
+		t.Errorf("known value should keep its token, new one continue: %s", upstreamBody())
+	}
+	// Rehydration must not mix up the session's tokens
+	p.ResponseContains(t, "gọi 0912345678 hoặc 0901234567")
+
+	p.Chat(t, "gọi 0987654321", veiltest.WithSession("s2"))
+	if !strings.Contains(upstreamBody(), "gọi [PHONE_1]") {
+		t.Errorf("a new session should start at _1: %s", upstreamBody())
+	}
+	p.UpstreamNeverSaw(t, "0901234567")
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// CountTokensMode is how requests to token counting endpoints, such as
+// Anthropic's /v1/messages/count_tokens, are processed
+type CountTokensMode string
+
+const (
+	// CountTokensAnonymize anonymizes a counting request exactly as the
+	// request it counts for will be, so the count matches what is sent.
+	// Its mapping is stored, and the real request reuses the tokens.
+	CountTokensAnonymize CountTokensMode = "anonymize"
+	// CountTokensPassthrough forwards counting requests untouched, PII
+	// included, and stores nothing
+	CountTokensPassthrough CountTokensMode = "passthrough"
+)
+
+// ParseCountTokensMode parses a VEIL_COUNT_TOKENS value; empty is
+// CountTokensAnonymize
+func ParseCountTokensMode(s string) (CountTokensMode, error) {
+	switch m := CountTokensMode(s); m {
+	case "":
+		return CountTokensAnonymize, nil
+	case CountTokensAnonymize, CountTokensPassthrough:
+		return m, nil
+	}
+	return "", fmt.Errorf("must be %s or %s, got %q", CountTokensAnonymize, CountTokensPassthrough, s)
+}
+
+// endpointKind is how the proxy treats the bodies of an endpoint
+type endpointKind int
+
+const (
+	endpointDefault  endpointKind = iota // request anonymized, response rehydrated
+	endpointCount                        // token counting, see CountTokensMode
+	endpointMetadata                     // bodies left alone both ways
+)
+
+// endpointPolicies lists the provider endpoints that are not processed like
+// completions. Paths match at the end, so a target path or a router prefix
+// such as /gemini in front still matches.
+var endpointPolicies = []struct {
+	method string
+	path   *regexp.Regexp
+	kind   endpointKind
+}{
+	{http.MethodPost, regexp.MustCompile(`/v1/messages/count_tokens$`), endpointCount},
+	{http.MethodPost, regexp.MustCompile(`/v1/responses/input_tokens$`), endpointCount},
+	{http.MethodPost, regexp.MustCompile(`/models/[^/]+:countTokens$`), endpointCount},
+	{http.MethodGet, regexp.MustCompile(`/v1(beta)?/models(/[^/]+)?$`), endpointMetadata},
+}
+
+// endpointOf classifies req by endpointPolicies
+func endpointOf(req *http.Request) endpointKind {
+	if req == nil {
+		return endpointDefault
+	}
+	for _, p := range endpointPolicies {
+		if req.Method == p.method && p.path.MatchString(req.URL.Path) {
+			return p.kind
+		}
+	}
+	return endpointDefault
+}
+
+// skipsRehydration reports whether the response to req is returned as the
+// provider sent it: model metadata and token counts hold no tokens
+func skipsRehydration(req *http.Request) bool {
+	return endpointOf(req) != endpointDefault
+}
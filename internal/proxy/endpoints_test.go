@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/vault"
+)
+
+// countingUpstream answers count_tokens with the length of the first
+// message it received, standing in for the provider's tokenizer, and
+// records the first message of every other request
+func countingUpstream(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var sent []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		content := ""
+		if len(body.Messages) > 0 {
+			content = body.Messages[0].Content
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/count_tokens") {
+			fmt.Fprintf(w, `{"input_tokens":%d}`, len(content))
+			return
+		}
+		mu.Lock()
+		sent = append(sent, content)
+		mu.Unlock()
+		w.Write([]byte(`{"type":"message","content":[{"type":"text","text":"ok"}]}`))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, func() []string { mu.Lock(); defer mu.Unlock(); return append([]string(nil), sent...) }
+}
+
+func postMessages(t *testing.T, h http.Handler, path, session, body string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Session-ID", session)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: status %d: %s", path, w.Code, w.Body)
+	}
+	return w.Body.String()
+}
+
+func TestCountTokens_MatchesForwardedRequest(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		tiers detector.TierConfig
+	}{
+		{"every pattern", detector.TierConfig{DeepSamplePercent: 100}},
+		// The email is only found by the deep tier, which the counted
+		// request almost never draws
+		{"sampled deep tier", detector.TierConfig{DeepSamplePercent: 1}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, sent := countingUpstream(t)
+			mr := miniredis.RunT(t)
+			v := vault.NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+			detCfg := detector.DefaultConfig()
+			detCfg.Tiers = tt.tiers
+			srv, err := New(Config{TargetURL: upstream.URL}, detector.NewWithConfig(detCfg), v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := srv.Handler()
+
+			for i := range 5 {
+				session := fmt.Sprintf("claude-%d", i)
+				content := fmt.Sprintf("CCCD 0123456789%02d, email user%d@example.com, call me back", i, i)
+				messages := `"messages":[{"role":"user","content":"` + content + `"}]`
+
+				var count struct {
+					InputTokens int `json:"input_tokens"`
+				}
+				json.Unmarshal([]byte(postMessages(t, h, "/v1/messages/count_tokens", session, `{"model":"claude-sonnet-4",`+messages+`}`)), &count)
+				postMessages(t, h, "/v1/messages", session, `{"model":"claude-sonnet-4","max_tokens":1024,`+messages+`}`)
+
+				forwarded := sent()[i]
+				if strings.Contains(forwarded, "@example.com") || strings.Contains(forwarded, "0123456789") {
+					t.Fatalf("PII forwarded: %s", forwarded)
+				}
+				if count.InputTokens != len(forwarded) {
+					t.Errorf("session %s: count_tokens saw %d bytes, the request forwarded %d: %q", session, count.InputTokens, len(forwarded), forwarded)
+				}
+			}
+		})
+	}
+}
+
+func TestCountTokens_Passthrough(t *testing.T) {
+	upstream, _ := countingUpstream(t)
+	mr := miniredis.RunT(t)
+	v := vault.NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	srv, err := New(Config{TargetURL: upstream.URL, CountTokens: CountTokensPassthrough}, detector.New(), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const content = "email a@example.com"
+	got := postMessages(t, srv.Handler(), "/v1/messages/count_tokens", "s1",
+		`{"model":"claude-sonnet-4","messages":[{"role":"user","content":"`+content+`"}]}`)
+	if want := fmt.Sprintf(`{"input_tokens":%d}`, len(content)); got != want {
+		t.Errorf("count = %s, want %s for the untouched body", got, want)
+	}
+	if _, err := v.SessionInfo(context.Background(), "s1"); err == nil {
+		t.Error("passthrough count stored a mapping")
+	}
+}
+
+func TestMetadataEndpoints_NotProcessed(t *testing.T) {
+	const models = `{"data":[{"id":"gpt-4o","description":"replies with [EMAIL_1]"}]}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(models))
+	}))
+	defer upstream.Close()
+	mr := miniredis.RunT(t)
+	v := vault.NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	v.Store(context.Background(), "s1", map[string]string{"[EMAIL_1]": "a@example.com"})
+	srv, err := New(Config{TargetURL: upstream.URL}, detector.New(), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/v1/models", "/v1/models/gpt-4o"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Session-ID", "s1")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		if w.Body.String() != models {
+			t.Errorf("%s: body = %s, want it unchanged", path, w.Body)
+		}
+	}
+}
+
+func TestEndpointOf(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         endpointKind
+	}{
+		{http.MethodPost, "/v1/messages/count_tokens", endpointCount},
+		{http.MethodPost, "/anthropic/v1/messages/count_tokens", endpointCount},
+		{http.MethodPost, "/v1/responses/input_tokens", endpointCount},
+		{http.MethodPost, "/gemini/v1beta/models/gemini-2.0-flash:countTokens", endpointCount},
+		{http.MethodPost, "/v1/messages", endpointDefault},
+		{http.MethodPost, "/gemini/v1beta/models/gemini-2.0-flash:generateContent", endpointDefault},
+		{http.MethodGet, "/v1/models", endpointMetadata},
+		{http.MethodGet, "/v1/models/claude-sonnet-4", endpointMetadata},
+		{http.MethodGet, "/gemini/v1beta/models", endpointMetadata},
+		{http.MethodGet, "/v1/files/file-1/content", endpointDefault},
+		{http.MethodPost, "/v1/models", endpointDefault},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := endpointOf(req); got != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
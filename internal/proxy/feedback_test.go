@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/feedback"
+	"github.com/vurakit/agentveil/internal/vault"
+)
+
+func TestProxy_FeedbackSuppressesAfterReports(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	am := auth.NewManager(client)
+	ctx := context.Background()
+	adminKey, _, _ := am.GenerateKey(ctx, auth.RoleAdmin, "admin")
+	devKey, _, _ := am.GenerateKey(ctx, auth.RoleViewer, "developer")
+
+	det := detector.New()
+	fb, err := feedback.New(client, feedback.Config{SuppressAfter: 2, Key: []byte(strings.Repeat("k", 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	det.SetSuppressor(fb)
+	srv, err := New(Config{TargetURL: "http://127.0.0.1:1"}, det, vault.NewWithClient(client), WithAuth(am), WithFeedback(fb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := srv.Handler()
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-Veil-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	scan := func() []ScanEntity {
+		var resp ScanResponse
+		json.Unmarshal(do(http.MethodPost, "/scan", "", `{"text":"write to noreply@example.com"}`).Body.Bytes(), &resp)
+		return resp.Entities
+	}
+
+	entities := scan()
+	if len(entities) != 1 || entities[0].Source != string(detector.SourceBuiltin) || entities[0].Rule == "" {
+		t.Fatalf("scan = %+v", entities)
+	}
+	report, _ := json.Marshal(feedback.DetectionReport{
+		EntityID: entities[0].EntityID, Category: entities[0].Category, Verdict: feedback.FalsePositive,
+		Source: entities[0].Source, Rule: entities[0].Rule,
+	})
+
+	if w := do(http.MethodPost, "/feedback/detection", "", string(report)); w.Code != http.StatusUnauthorized {
+		t.Errorf("report without a key: status %d", w.Code)
+	}
+	for _, key := range []string{devKey, devKey, adminKey} {
+		if w := do(http.MethodPost, "/feedback/detection", key, string(report)); w.Code != http.StatusOK {
+			t.Fatalf("report: status %d: %s", w.Code, w.Body)
+		}
+	}
+	if entities := scan(); len(entities) != 0 {
+		t.Errorf("value reported by two keys should be suppressed: %+v", entities)
+	}
+
+	if w := do(http.MethodGet, "/admin/feedback/summary", devKey, ""); w.Code != http.StatusForbidden {
+		t.Errorf("summary with a viewer key: status %d", w.Code)
+	}
+	w := do(http.MethodGet, "/admin/feedback/summary", adminKey, "")
+	var summary feedback.Summary
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil || len(summary.Patterns) != 1 ||
+		summary.Patterns[0].FalsePositives != 3 || summary.Suppressed != 1 {
+		t.Errorf("summary = %s", w.Body)
+	}
+}
@@ -0,0 +1,317 @@
+package proxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/forensic"
+)
+
+// FieldAction is what a FieldPolicy does to a matched request field
+type FieldAction string
+
+const (
+	// FieldRemove deletes the field, or the array element
+	FieldRemove FieldAction = "remove"
+	// FieldHash replaces the value with its hex HMAC-SHA256 under the
+	// policy key, so the operator's own systems can still correlate
+	FieldHash FieldAction = "hash"
+	// FieldConstant replaces the value with a constant per session
+	FieldConstant FieldAction = "constant"
+)
+
+// ParseFieldAction parses a field action name
+func ParseFieldAction(s string) (FieldAction, error) {
+	switch a := FieldAction(strings.ToLower(strings.TrimSpace(s))); a {
+	case FieldRemove, FieldHash, FieldConstant:
+		return a, nil
+	}
+	return "", fmt.Errorf("invalid field action %q (want remove, hash or constant)", s)
+}
+
+// DefaultFieldPaths are redacted unless VEIL_REQUEST_FIELDS says otherwise:
+// OpenAI's user and the metadata Anthropic and OpenAI accept
+var DefaultFieldPaths = []string{"user", "metadata.*"}
+
+// DefaultFieldAction applies to paths configured without an action
+const DefaultFieldAction = FieldRemove
+
+// FieldRule applies Action to the values at Path. Path segments are
+// separated by dots; "*" matches every member of an object and every
+// element of an array, and any other segment reaching an array applies to
+// each element, so "messages.name" is the name of every message.
+type FieldRule struct {
+	Path   string
+	Action FieldAction
+}
+
+// ParseFieldRules parses comma-separated "path" or "path=action" entries;
+// paths without an action get def
+func ParseFieldRules(s string, def FieldAction) ([]FieldRule, error) {
+	var rules []FieldRule
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		path, action, found := strings.Cut(entry, "=")
+		rule := FieldRule{Path: strings.TrimSpace(path), Action: def}
+		if found {
+			a, err := ParseFieldAction(action)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", rule.Path, err)
+			}
+			rule.Action = a
+		}
+		if slices.Contains(strings.Split(rule.Path, "."), "") {
+			return nil, fmt.Errorf("invalid field path %q", rule.Path)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// FieldPolicy redacts identifier fields, such as OpenAI's user or request
+// metadata, from JSON request bodies after anonymization. Tokens are
+// pseudonymous, yet a stable user ID or email still lets a provider link
+// requests, so these fields never reach it in any form. Redaction is not
+// reversible: responses don't get the values back.
+type FieldPolicy struct {
+	Rules []FieldRule
+	// Key is the HMAC key of FieldHash and FieldConstant
+	Key []byte
+}
+
+// apply redacts the policy's fields in a JSON body and records the edits in
+// the forensic record of ctx. Hashed values have their tokens restored from
+// mapping first, so a hash depends on what the client sent and not on the
+// session's tokens.
+func (p FieldPolicy) apply(ctx context.Context, sessionID, body string, mapping map[string]string) string {
+	if len(p.Rules) == 0 || !strings.HasPrefix(strings.TrimSpace(body), "{") || !json.Valid([]byte(body)) {
+		return body
+	}
+	rules := make([]fieldMatch, len(p.Rules))
+	for i, r := range p.Rules {
+		rules[i] = fieldMatch{segs: strings.Split(r.Path, "."), action: r.Action}
+	}
+	w := &fieldWalker{body: body}
+	w.skipSpace()
+	if err := w.value(rules, ""); err != nil {
+		slog.Warn("proxy: request fields not redacted", "error", err)
+		return body
+	}
+	if len(w.edits) == 0 {
+		return body
+	}
+	slices.SortFunc(w.edits, func(a, b forensic.Edit) int { return a.Start - b.Start })
+
+	var restore *strings.Replacer
+	if len(mapping) > 0 {
+		pairs := make([]string, 0, 2*len(mapping))
+		for token, original := range mapping {
+			pairs = append(pairs, token, original)
+		}
+		restore = strings.NewReplacer(pairs...)
+	}
+	var out strings.Builder
+	last := 0
+	for i, e := range w.edits {
+		switch FieldAction(e.Action) {
+		case FieldHash:
+			value := body[e.Start:e.End]
+			var s string
+			if json.Unmarshal([]byte(value), &s) == nil {
+				value = s
+			}
+			if restore != nil {
+				value = restore.Replace(value)
+			}
+			w.edits[i].Token = strconv.Quote(p.sum(value))
+		case FieldConstant:
+			w.edits[i].Token = strconv.Quote("veil-" + p.sum("session\x00" + sessionID)[:16])
+		}
+		out.WriteString(body[last:e.Start])
+		out.WriteString(w.edits[i].Token)
+		last = e.End
+	}
+	out.WriteString(body[last:])
+	result := out.String()
+
+	forensic.From(ctx).Rewrite(result, w.edits)
+	slog.Debug("proxy: redacted request fields", "count", len(w.edits), "session", sessionID)
+	return result
+}
+
+// sum returns the hex HMAC-SHA256 of s under the policy key
+func (p FieldPolicy) sum(s string) string {
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// fieldMatch is a rule partway down a body: the path segments left
+type fieldMatch struct {
+	segs   []string
+	action FieldAction
+}
+
+// descend returns the rules that go on into the member named key, or an
+// array element when key is empty, and the action of the first rule that
+// ends there
+func descend(rules []fieldMatch, key string, element bool) ([]fieldMatch, FieldAction) {
+	var next []fieldMatch
+	for _, r := range rules {
+		seg := r.segs[0]
+		switch {
+		case seg == "*" || !element && seg == key:
+			if len(r.segs) == 1 {
+				return nil, r.action
+			}
+			next = append(next, fieldMatch{segs: r.segs[1:], action: r.action})
+		case element:
+			next = append(next, r)
+		}
+	}
+	return next, ""
+}
+
+// fieldWalker finds the spans of matched fields in a valid JSON body
+type fieldWalker struct {
+	body  string
+	pos   int
+	edits []forensic.Edit
+}
+
+// fieldItem is an object member or array element: start is where its key
+// or value starts, value and end delimit the value
+type fieldItem struct {
+	start, value, end int
+	path              string
+	action            FieldAction
+}
+
+func (w *fieldWalker) skipSpace() {
+	for w.pos < len(w.body) && strings.IndexByte(" \t\r\n", w.body[w.pos]) >= 0 {
+		w.pos++
+	}
+}
+
+// value walks the value at pos, redacting what rules match inside it
+func (w *fieldWalker) value(rules []fieldMatch, path string) error {
+	if w.pos >= len(w.body) {
+		return errors.New("unexpected end of body")
+	}
+	switch w.body[w.pos] {
+	case '{':
+		return w.container(rules, path, '}')
+	case '[':
+		return w.container(rules, path, ']')
+	case '"':
+		_, err := w.str()
+		return err
+	}
+	for w.pos < len(w.body) && strings.IndexByte(",}] \t\r\n", w.body[w.pos]) < 0 {
+		w.pos++
+	}
+	return nil
+}
+
+// str skips the string at pos and returns it decoded
+func (w *fieldWalker) str() (string, error) {
+	start := w.pos
+	for w.pos++; w.pos < len(w.body); w.pos++ {
+		switch w.body[w.pos] {
+		case '\\':
+			w.pos++
+		case '"':
+			w.pos++
+			var s string
+			err := json.Unmarshal([]byte(w.body[start:w.pos]), &s)
+			return s, err
+		}
+	}
+	return "", errors.New("unterminated string")
+}
+
+// container walks an object or array and records the edits of its matched
+// items. Removed items take a separating comma with them: the one after
+// them, or the one before for items after the last kept one.
+func (w *fieldWalker) container(rules []fieldMatch, path string, closer byte) error {
+	element := closer == ']'
+	var items []fieldItem
+	w.pos++
+	for {
+		w.skipSpace()
+		if w.pos < len(w.body) && w.body[w.pos] == closer {
+			w.pos++
+			break
+		}
+		it := fieldItem{start: w.pos}
+		key := strconv.Itoa(len(items))
+		if !element {
+			var err error
+			if key, err = w.str(); err != nil {
+				return err
+			}
+			w.skipSpace()
+			if w.pos >= len(w.body) || w.body[w.pos] != ':' {
+				return errors.New("expected ':' after object key")
+			}
+			w.pos++
+			w.skipSpace()
+		}
+		it.value = w.pos
+		it.path = key
+		if path != "" {
+			it.path = path + "." + key
+		}
+		var next []fieldMatch
+		next, it.action = descend(rules, key, element)
+		if it.action != "" {
+			next = nil
+		}
+		if err := w.value(next, it.path); err != nil {
+			return err
+		}
+		it.end = w.pos
+		items = append(items, it)
+
+		w.skipSpace()
+		if w.pos < len(w.body) && w.body[w.pos] == ',' {
+			w.pos++
+		}
+	}
+
+	lastKept := -1
+	for i, it := range items {
+		if it.action != FieldRemove {
+			lastKept = i
+		}
+	}
+	for i, it := range items {
+		e := forensic.Edit{Action: string(it.action), Field: it.path}
+		switch {
+		case it.action == "":
+			continue
+		case it.action != FieldRemove:
+			e.Start, e.End = it.value, it.end
+		case i < lastKept || lastKept < 0 && i < len(items)-1:
+			e.Start, e.End = it.start, items[i+1].start
+		case lastKept < 0:
+			e.Start, e.End = it.start, it.end
+		default:
+			e.Start, e.End = items[i-1].end, it.end
+		}
+		w.edits = append(w.edits, e)
+	}
+	return nil
+}
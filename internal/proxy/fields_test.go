@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/forensic"
+	"github.com/vurakit/agentveil/internal/vault"
+)
+
+func TestParseFieldRules(t *testing.T) {
+	rules, err := ParseFieldRules(" user , metadata.*=hash,messages.name=Constant", FieldRemove)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FieldRule{{"user", FieldRemove}, {"metadata.*", FieldHash}, {"messages.name", FieldConstant}}
+	if len(rules) != len(want) {
+		t.Fatalf("rules = %+v", rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+	for _, bad := range []string{"user=drop", "metadata.", ".user"} {
+		if _, err := ParseFieldRules(bad, FieldRemove); err == nil {
+			t.Errorf("ParseFieldRules(%q) accepted", bad)
+		}
+	}
+}
+
+func TestFieldPolicy_Apply(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	tests := []struct {
+		name  string
+		rules string
+		body  string
+		want  string
+	}{
+		{
+			"remove first member",
+			"user",
+			`{"user": "u-42", "model": "gpt-4o"}`,
+			`{"model": "gpt-4o"}`,
+		},
+		{
+			"remove last member",
+			"user",
+			`{"model":"gpt-4o","user":{"id":1,"tags":["a","b"]}}`,
+			`{"model":"gpt-4o"}`,
+		},
+		{
+			"remove every member",
+			"metadata.*",
+			`{"metadata": {"email": "a@example.com", "tenant": 7}, "model": "m"}`,
+			`{"metadata": {}, "model": "m"}`,
+		},
+		{
+			"remove trailing members",
+			"metadata.b,metadata.c",
+			`{"metadata":{"a":1, "b":2, "c":3}}`,
+			`{"metadata":{"a":1}}`,
+		},
+		{
+			"nested path",
+			"metadata.customer.email",
+			`{"metadata":{"customer":{"email":"a@example.com","plan":"pro"}}}`,
+			`{"metadata":{"customer":{"plan":"pro"}}}`,
+		},
+		{
+			"named segment through an array",
+			"messages.name",
+			`{"messages":[{"role":"user","name":"alice","content":"hi"},{"role":"assistant","content":"yo"},{"name":"bob","role":"user"}]}`,
+			`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"yo"},{"role":"user"}]}`,
+		},
+		{
+			"wildcard over array elements",
+			"tags.*",
+			`{"tags":["a","b"],"n":1}`,
+			`{"tags":[],"n":1}`,
+		},
+		{
+			"constant",
+			"user=constant,metadata.*=constant",
+			`{"user":"u-42","metadata":{"a":"x","b":{"c":1}}}`,
+			`{"user":"veil-SESSION","metadata":{"a":"veil-SESSION","b":"veil-SESSION"}}`,
+		},
+		{
+			"no match",
+			"user",
+			`{"model":"m","messages":[{"content":"the user field"}]}`,
+			`{"model":"m","messages":[{"content":"the user field"}]}`,
+		},
+		{
+			"not an object",
+			"user",
+			`[{"user":"u-42"}]`,
+			`[{"user":"u-42"}]`,
+		},
+	}
+	constant := "veil-" + FieldPolicy{Key: key}.sum("session\x00s1")[:16]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseFieldRules(tt.rules, FieldRemove)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := FieldPolicy{Rules: rules, Key: key}.apply(context.Background(), "s1", tt.body, nil)
+			if want := strings.ReplaceAll(tt.want, "veil-SESSION", constant); got != want {
+				t.Errorf("got  %s\nwant %s", got, want)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Errorf("result is not valid JSON: %s", got)
+			}
+		})
+	}
+}
+
+func TestFieldPolicy_Hash(t *testing.T) {
+	p := FieldPolicy{Rules: []FieldRule{{"user", FieldHash}, {"metadata.email", FieldHash}, {"metadata.ids", FieldHash}}, Key: []byte("k")}
+	// The email was tokenized before; the hash is of what the client sent
+	body := `{"user":"u-42","metadata":{"email":"[EMAIL_1]","ids":[1, 2]}}`
+	got := p.apply(context.Background(), "s1", body, map[string]string{"[EMAIL_1]": "a@example.com"})
+
+	var out struct {
+		User     string
+		Metadata struct{ Email, IDs string }
+	}
+	if err := json.Unmarshal([]byte(got), &out); err != nil {
+		t.Fatalf("%v: %s", err, got)
+	}
+	if out.User != p.sum("u-42") || out.Metadata.Email != p.sum("a@example.com") || out.Metadata.IDs != p.sum("[1, 2]") {
+		t.Errorf("hashes = %s", got)
+	}
+	if again := p.apply(context.Background(), "other-session", body, map[string]string{"[EMAIL_1]": "a@example.com"}); again != got {
+		t.Error("hashes should not depend on the session")
+	}
+}
+
+func TestProxy_RequestFields(t *testing.T) {
+	var sent []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent, _ = io.ReadAll(r.Body)
+		writeEchoCompletion(w, sent)
+	}))
+	defer upstream.Close()
+
+	mr := miniredis.RunT(t)
+	v := vault.NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	rules, _ := ParseFieldRules(strings.Join(DefaultFieldPaths, ","), DefaultFieldAction)
+	srv, err := New(Config{TargetURL: upstream.URL, Fields: FieldPolicy{Rules: rules}}, detector.New(), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs strings.Builder
+	handler := accesslog.NewWithWriter(&logs, accesslog.FieldsForensic).Middleware(srv.Handler())
+
+	original := `{"model":"gpt-4o","messages":[{"role":"user","content":"mail bob@example.com"}],` +
+		`"user":"internal-user-1234","metadata":{"email":"alice@example.com","team":"billing"}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(original))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Session-ID", "fields-session")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, value := range []string{"internal-user-1234", "alice@example.com", "billing", "bob@example.com"} {
+		if strings.Contains(string(sent), value) {
+			t.Errorf("upstream received %q: %s", value, sent)
+		}
+	}
+	if !strings.Contains(string(sent), `"metadata":{}`) {
+		t.Errorf("upstream body = %s", sent)
+	}
+
+	var entry accesslog.Entry
+	if err := json.Unmarshal([]byte(logs.String()), &entry); err != nil {
+		t.Fatalf("invalid access log line: %v", err)
+	}
+	rec := entry.Transform
+	if rec == nil || rec.Partial {
+		t.Fatalf("transform = %+v", rec)
+	}
+	fields := map[string]string{}
+	for _, e := range rec.Edits {
+		if e.Field != "" {
+			fields[e.Field] = e.Action
+		}
+	}
+	if len(fields) != 3 || fields["user"] != "remove" || fields["metadata.email"] != "remove" || fields["metadata.team"] != "remove" {
+		t.Errorf("field edits = %+v", rec.Edits)
+	}
+	// The email in metadata was tokenized first; its edit is folded into the removal
+	replayed, err := forensic.Replay([]byte(original), rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(replayed) != string(sent) {
+		t.Errorf("replay differs from what upstream received:\n%s\n%s", replayed, sent)
+	}
+}
@@ -0,0 +1,357 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/annotate"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/forensic"
+	"github.com/vurakit/agentveil/internal/jsonfields"
+	"github.com/vurakit/agentveil/internal/stats"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// DefaultMaxFileSize is the largest multipart upload to /v1/files, the
+// OpenAI Files API limit (512MB)
+const DefaultMaxFileSize = 512 << 20
+
+// maxFileLine is the longest line of an uploaded text file. A batch input
+// line is one request, so it gets the request body limit.
+const maxFileLine = MaxBodySize
+
+var (
+	errFileTooLarge    = errors.New("file upload exceeds size limit")
+	errFileLineTooLong = errors.New("file line exceeds size limit")
+)
+
+// fileContentPath matches file downloads, e.g. batch results
+var fileContentPath = regexp.MustCompile(`/v1/files/[^/]+/content$`)
+
+// isFileUpload reports whether req uploads a file to the OpenAI Files API
+func isFileUpload(req *http.Request) bool {
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/v1/files") {
+		return false
+	}
+	mt, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mt == "multipart/form-data" && params["boundary"] != ""
+}
+
+// isFileContent reports whether req downloads the content of a file
+func isFileContent(req *http.Request) bool {
+	return req != nil && req.Method == http.MethodGet && fileContentPath.MatchString(req.URL.Path)
+}
+
+// filesSessionID is the vault session of the files a caller uploads with
+// purpose. Batch output is rehydrated from the batch session, which is
+// also used when the file part comes before the purpose field.
+func filesSessionID(req *http.Request, purpose string) string {
+	if purpose == "" || purpose == "batch_output" {
+		purpose = "batch"
+	}
+	return "files:" + purpose + ":" + callerID(req)
+}
+
+// callerID identifies the API key of a request: the Veil key when
+// authenticated, otherwise a hash of the provider key
+func callerID(req *http.Request) string {
+	if id := req.Header.Get("X-Veil-Key-ID"); id != "" {
+		return "key:" + id
+	}
+	for _, h := range []string{"Authorization", "X-Api-Key", "Api-Key"} {
+		if v := req.Header.Get(h); v != "" {
+			sum := sha256.Sum256([]byte(v))
+			return "sk:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return "anonymous"
+}
+
+// fileUpload anonymizes multipart uploads to /v1/files while they stream
+// upstream: text file parts in chunks of whole lines, binary parts
+// untouched
+type fileUpload struct {
+	det     Detector
+	vault   *vault.Vault
+	minLen  int   // as Config.BinaryMinLength
+	maxSize int64 // zero uses DefaultMaxFileSize
+	webhook *webhook.Dispatcher
+	source  string // webhook event source
+}
+
+// rewrite replaces req's body with the anonymized multipart stream. Read
+// errors, including an upload over the size limit, fail the upstream
+// request.
+func (u fileUpload) rewrite(req *http.Request) {
+	_, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	maxSize := u.maxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFileSize
+	}
+
+	src := req.Body
+	if req.ContentLength > maxSize {
+		src.Close()
+		src = io.NopCloser(errReader{errFileTooLarge})
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer src.Close()
+		pw.CloseWithError(u.copyForm(req, pw, &limitedBody{r: src, n: maxSize}, params["boundary"]))
+	}()
+
+	req.Body = pr
+	req.ContentLength = -1
+	req.Header.Del("Content-Length")
+	req.GetBody = nil
+}
+
+// copyForm writes the form read from src to dst with the same boundary,
+// anonymizing text files under the session of the form's purpose
+func (u fileUpload) copyForm(req *http.Request, dst io.Writer, src io.Reader, boundary string) error {
+	mr := multipart.NewReader(src, boundary)
+	mw := multipart.NewWriter(dst)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	purpose := ""
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		w, err := mw.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case part.FileName() == "" && part.FormName() == "purpose":
+			var value bytes.Buffer
+			if _, err := io.Copy(io.MultiWriter(w, &value), part); err != nil {
+				return err
+			}
+			purpose = strings.TrimSpace(value.String())
+		case part.FileName() != "":
+			br := bufio.NewReaderSize(part, 64<<10)
+			head, _ := br.Peek(512)
+			if isBinaryPartType(part.Header.Get("Content-Disposition"), part.Header.Get("Content-Type"), head) {
+				_, err = io.Copy(w, br)
+			} else {
+				err = u.copyLines(req, w, br, filesSessionID(req, purpose))
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			if _, err := io.Copy(w, part); err != nil {
+				return err
+			}
+		}
+	}
+	return mw.Close()
+}
+
+// fileChunkLines is how many lines are anonymized together. Each chunk
+// reads the session's mapping once, which grows with the file.
+const fileChunkLines = 256
+
+// copyLines anonymizes a text file in chunks of whole lines
+func (u fileUpload) copyLines(req *http.Request, dst io.Writer, src *bufio.Reader, sessionID string) error {
+	// The forensic record describes one buffered body; a streamed upload
+	// has no such body
+	ctx := forensic.WithRecord(req.Context(), nil)
+	var (
+		chunk    bytes.Buffer
+		lines    int
+		applied  []detector.Match
+		entities int
+	)
+	flush := func() error {
+		out := chunk.String()
+		if strings.TrimSpace(out) != "" {
+			anonymized, matches, mapping := anonymizeBody(ctx, u.det, u.vault, sessionID,
+				"application/json", out, u.minLen)
+			if err := failsafe.Err(ctx); err != nil {
+				// The upload is already streaming; abort it mid-body
+				return err
+			}
+			applied = append(applied, matches...)
+			entities += len(mapping)
+			out = anonymized
+		}
+		chunk.Reset()
+		lines = 0
+		_, err := io.WriteString(dst, out)
+		return err
+	}
+
+	for {
+		line, tooLong, err := readLine(src, maxFileLine)
+		if tooLong {
+			return errFileLineTooLong
+		}
+		chunk.Write(line)
+		lines++
+		if lines >= fileChunkLines || chunk.Len() >= maxFileLine || err != nil {
+			if ferr := flush(); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	categories := categoriesOf(applied)
+	stats.AddDetections(ctx, sessionID, categories)
+	accesslog.AddEntities(ctx, categories)
+	annotate.AddEntities(ctx, categories)
+	if entities > 0 {
+		slog.Info("files: anonymized PII entities in upload", "count", entities, "session", sessionID)
+		if u.webhook != nil {
+			u.webhook.Emit(webhook.Event{
+				Type:      webhook.EventPIIDetected,
+				SessionID: sessionID,
+				Data:      map[string]any{"count": entities, "categories": categories, "source": u.source},
+			})
+		}
+	}
+	return nil
+}
+
+// readLine reads up to and including the next newline. When the line runs
+// past max, the first max bytes or more are returned with tooLong set and
+// the rest is left unread.
+func readLine(r *bufio.Reader, max int) (line []byte, tooLong bool, err error) {
+	for {
+		chunk, rerr := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > max {
+			return line, true, nil
+		}
+		if rerr != bufio.ErrBufferFull {
+			return line, false, rerr
+		}
+	}
+}
+
+// limitedBody fails with errFileTooLarge once more than n bytes are read
+type limitedBody struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
+
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
+
+// rehydrateFileContent rehydrates downloaded file content line by line
+// from the caller's batch session. Batch result lines are rehydrated in the
+// content fields of response.body, other JSON lines are left alone and
+// text lines are rehydrated whole. Lines longer than the request body
+// limit pass through as they are.
+func rehydrateFileContent(resp *http.Response, v *vault.Vault, role string) {
+	sessionID := filesSessionID(resp.Request, "batch_output")
+	mappings, err := lookupMappings(resp.Request.Context(), v, sessionID)
+	if err != nil || len(mappings) == 0 {
+		return
+	}
+	resp.Body = &fileRehydrator{
+		src:     bufio.NewReaderSize(resp.Body, 64<<10),
+		body:    resp.Body,
+		replace: tokenReplacer(mappings, role),
+	}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+}
+
+type fileRehydrator struct {
+	src     *bufio.Reader
+	body    io.Closer
+	replace func(string) string
+	pending []byte
+	raw     bool // inside a line too long to rehydrate
+	err     error
+}
+
+func (f *fileRehydrator) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		if f.raw {
+			chunk, err := f.src.ReadSlice('\n')
+			f.pending = append(f.pending[:0], chunk...)
+			f.raw = err == bufio.ErrBufferFull
+			if err != nil && err != bufio.ErrBufferFull {
+				f.err = err
+			}
+			continue
+		}
+		line, tooLong, err := readLine(f.src, maxFileLine)
+		if tooLong {
+			f.pending, f.raw = line, line[len(line)-1] != '\n'
+			continue
+		}
+		f.pending = rehydrateFileLine(line, f.replace)
+		f.err = err
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+func (f *fileRehydrator) Close() error {
+	return f.body.Close()
+}
+
+// rehydrateFileLine rehydrates one line of downloaded file content
+func rehydrateFileLine(line []byte, replace func(string) string) []byte {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 {
+		return line
+	}
+	if trimmed[0] == '{' {
+		if out, ok := jsonfields.Rewrite(line, isBatchContentField, replace); ok {
+			return out
+		}
+	}
+	return []byte(replace(string(line)))
+}
+
+// isBatchContentField reports whether path is model output in a batch
+// result line, whose response.body is a regular API response
+func isBatchContentField(path string) bool {
+	rest, ok := strings.CutPrefix(path, "response.body.")
+	return ok && jsonfields.IsContent(rest)
+}
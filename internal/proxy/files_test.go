@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/vault"
+)
+
+// batchLines is a batch input file with an email and a phone number on
+// every line
+func batchLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		req := map[string]any{
+			"custom_id": fmt.Sprintf("req-%d", i),
+			"method":    "POST",
+			"url":       "/v1/chat/completions",
+			"body": map[string]any{
+				"model": "gpt-4o-mini",
+				"messages": []map[string]string{{
+					"role":    "user",
+					"content": fmt.Sprintf("Khách hàng user%d@example.com, SĐT 09%08d, cần hỗ trợ", i, i),
+				}},
+			},
+		}
+		b, _ := json.Marshal(req)
+		lines[i] = string(b)
+	}
+	return lines
+}
+
+// fileForm builds a /v1/files upload with the purpose field first
+func fileForm(t *testing.T, purpose, filename, contentType string, content []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("purpose", purpose)
+	h := make(map[string][]string)
+	h["Content-Disposition"] = []string{fmt.Sprintf(`form-data; name="file"; filename=%q`, filename)}
+	h["Content-Type"] = []string{contentType}
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(content)
+	mw.Close()
+	return &buf, mw.FormDataContentType()
+}
+
+// filesUpstream stores uploaded batch files and serves their batch results,
+// echoing each request's message as the model answer
+func filesUpstream(t *testing.T) (http.HandlerFunc, func() (string, []byte)) {
+	var purpose string
+	var file []byte
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/files":
+			if err := r.ParseMultipartForm(64 << 20); err != nil {
+				t.Errorf("upstream got a malformed form: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			purpose = r.FormValue("purpose")
+			f, _, err := r.FormFile("file")
+			if err != nil {
+				t.Errorf("upstream got no file: %v", err)
+				return
+			}
+			file, _ = io.ReadAll(f)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"file-in","object":"file","purpose":"batch"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/files/file-out/content":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			scanner := bufio.NewScanner(bytes.NewReader(file))
+			scanner.Buffer(nil, 1<<20)
+			for scanner.Scan() {
+				var in struct {
+					CustomID string `json:"custom_id"`
+					Body     struct {
+						Messages []struct {
+							Content string `json:"content"`
+						} `json:"messages"`
+					} `json:"body"`
+				}
+				json.Unmarshal(scanner.Bytes(), &in)
+				out, _ := json.Marshal(map[string]any{
+					"id":        "batch_req_" + in.CustomID,
+					"custom_id": in.CustomID,
+					"response": map[string]any{
+						"status_code": 200,
+						"body": map[string]any{
+							"choices": []any{map[string]any{"message": map[string]string{
+								"role": "assistant", "content": in.Body.Messages[0].Content,
+							}}},
+						},
+					},
+					"error": nil,
+				})
+				w.Write(append(out, '\n'))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}
+	return handler, func() (string, []byte) { return purpose, file }
+}
+
+func TestProxy_FileUploadAnonymizesJSONL(t *testing.T) {
+	handler, received := filesUpstream(t)
+	srv, upstream := setupTestProxy(t, handler)
+	defer upstream.Close()
+
+	lines := batchLines(3000)
+	body, contentType := fileForm(t, "batch", "batch.jsonl", "application/octet-stream", []byte(strings.Join(lines, "\n")+"\n"))
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer sk-test")
+	req.Header.Set("X-User-Role", "admin")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	purpose, file := received()
+	if purpose != "batch" {
+		t.Errorf("purpose = %q, want batch", purpose)
+	}
+	sent := strings.Split(strings.TrimSuffix(string(file), "\n"), "\n")
+	if len(sent) != len(lines) {
+		t.Fatalf("upstream got %d lines, want %d", len(sent), len(lines))
+	}
+	for i, line := range sent {
+		if strings.Contains(line, "@example.com") {
+			t.Fatalf("line %d still has an email: %s", i, line)
+		}
+		if !json.Valid([]byte(line)) {
+			t.Fatalf("line %d is no longer JSON: %s", i, line)
+		}
+	}
+	if !strings.Contains(sent[0], `"custom_id":"req-0"`) {
+		t.Errorf("custom_id changed: %s", sent[0])
+	}
+
+	// Batch results are rehydrated for the same API key
+	req = httptest.NewRequest(http.MethodGet, "/v1/files/file-out/content", nil)
+	req.Header.Set("Authorization", "Bearer sk-test")
+	req.Header.Set("X-User-Role", "admin")
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	results := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	if len(results) != len(lines) {
+		t.Fatalf("got %d result lines, want %d", len(results), len(lines))
+	}
+	for _, i := range []int{0, 1234, len(lines) - 1} {
+		want := fmt.Sprintf("user%d@example.com", i)
+		if !strings.Contains(results[i], want) {
+			t.Errorf("result %d not rehydrated, want %s: %s", i, want, results[i])
+		}
+	}
+
+	// Another key gets the tokens
+	req = httptest.NewRequest(http.MethodGet, "/v1/files/file-out/content", nil)
+	req.Header.Set("Authorization", "Bearer sk-other")
+	req.Header.Set("X-User-Role", "admin")
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if strings.Contains(rec.Body.String(), "@example.com") {
+		t.Error("results rehydrated for a different API key")
+	}
+}
+
+func TestProxy_FileUploadBinaryUntouched(t *testing.T) {
+	handler, received := filesUpstream(t)
+	srv, upstream := setupTestProxy(t, handler)
+	defer upstream.Close()
+
+	pngBytes := withBase64Text(t, noisePNG(t, 64), "A+079203001234+A")
+	body, contentType := fileForm(t, "vision", "scan.png", "application/octet-stream", pngBytes)
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-User-Role", "admin")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, file := received(); !bytes.Equal(file, pngBytes) {
+		t.Errorf("binary file changed in transit: %d bytes sent, %d received", len(pngBytes), len(file))
+	}
+}
+
+func TestProxy_FileUploadTooLarge(t *testing.T) {
+	called := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer upstream.Close()
+	mr := miniredis.RunT(t)
+	v := vault.NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	srv, err := New(Config{TargetURL: upstream.URL, MaxFileSize: 64 << 10}, detector.New(), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := batchLines(1000)
+	body, contentType := fileForm(t, "batch", "batch.jsonl", "application/jsonl", []byte(strings.Join(lines, "\n")))
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-User-Role", "admin")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413: %s", rec.Code, rec.Body.String())
+	}
+	if called {
+		t.Error("oversized upload reached the upstream")
+	}
+}
+
+func TestIsBinaryPartType(t *testing.T) {
+	tests := []struct {
+		name, disposition, contentType string
+		head                           []byte
+		want                           bool
+	}{
+		{"jsonl as octet-stream", `form-data; name="file"; filename="b.jsonl"`, "application/octet-stream", []byte(`{"custom_id":"1"}`), false},
+		{"png as octet-stream", `form-data; name="file"; filename="a.png"`, "application/octet-stream", []byte("\x89PNG\r\n\x1a\n"), true},
+		{"jsonl type", `form-data; name="file"; filename="b.jsonl"`, "application/jsonl", nil, false},
+		{"unsniffed file", `form-data; name="file"; filename="b.bin"`, "", nil, true},
+		{"pdf", `form-data; name="file"; filename="a.pdf"`, "application/pdf", []byte("%PDF-1.7"), true},
+	}
+	for _, tt := range tests {
+		if got := isBinaryPartType(tt.disposition, tt.contentType, tt.head); got != tt.want {
+			t.Errorf("%s: isBinaryPartType = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/forensic"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// shift is a replacement in a transformed text: it ends at end, in the
+// transformed text's offsets, and was delta bytes longer in the text it
+// came from
+type shift struct {
+	end, delta int
+}
+
+// originalOffset maps pos in a transformed text back to the text the
+// shifts were made in
+func originalOffset(shifts []shift, pos int) int {
+	out := pos
+	for _, s := range shifts {
+		if s.end > pos {
+			break
+		}
+		out += s.delta
+	}
+	return out
+}
+
+// bodyEdits maps what anonymizeBody did onto the original body's offsets.
+// The detector ran on masked, the body with binary spans replaced by
+// placeholders, after the neutralized spans of masked were replaced; its
+// matches are relative to that text.
+func bodyEdits(masked string, binary []string, neutralized [][2]int, applied []detector.Match) []forensic.Edit {
+	placeholders := placeholderShifts(masked, binary)
+	edits := make([]forensic.Edit, 0, len(neutralized)+len(applied))
+
+	var tokens []shift
+	removed := 0
+	for _, s := range neutralized {
+		edits = append(edits, forensic.Edit{
+			Start:  originalOffset(placeholders, s[0]),
+			End:    originalOffset(placeholders, s[1]),
+			Action: forensic.ActionNeutralize,
+			Token:  detector.NeutralizedToken,
+		})
+		delta := s[1] - s[0] - len(detector.NeutralizedToken)
+		tokens = append(tokens, shift{end: s[0] - removed + len(detector.NeutralizedToken), delta: delta})
+		removed += delta
+	}
+
+	for _, m := range applied {
+		e := forensic.Edit{
+			Start:    originalOffset(placeholders, originalOffset(tokens, m.Start)),
+			End:      originalOffset(placeholders, originalOffset(tokens, m.End)),
+			Category: m.Category,
+			Action:   string(cmp.Or(m.Action, detector.ActionTokenize)),
+			Token:    m.Token,
+		}
+		if m.Token == pii.PartialMask(m.Original) {
+			// The mask is part of the value; replay recomputes it
+			e.Action, e.Token = forensic.ActionMask, ""
+		}
+		edits = append(edits, e)
+	}
+	slices.SortFunc(edits, func(a, b forensic.Edit) int { return cmp.Compare(a.Start, b.Start) })
+	return edits
+}
+
+// placeholderShifts returns the shifts of the binary placeholders in masked
+func placeholderShifts(masked string, binary []string) []shift {
+	if len(binary) == 0 {
+		return nil
+	}
+	const marker = "\x00veil-binary-"
+	var shifts []shift
+	for i := 0; ; {
+		start := strings.Index(masked[i:], marker)
+		if start < 0 {
+			return shifts
+		}
+		start += i
+		n := strings.IndexByte(masked[start+len(marker):], 0)
+		if n < 0 {
+			return shifts
+		}
+		end := start + len(marker) + n + 1
+		if idx, err := strconv.Atoi(masked[start+len(marker) : end-1]); err == nil && idx < len(binary) {
+			shifts = append(shifts, shift{end: end, delta: len(binary[idx]) - (end - start)})
+		}
+		i = end
+	}
+}
+
+// tracedReplacer counts the tokens replace rehydrates into rec, leaving
+// masked values out
+func tracedReplacer(rec *forensic.Record, mappings map[string]string, replace func(string) string) func(string) string {
+	if rec == nil {
+		return replace
+	}
+	return func(s string) string {
+		out := replace(s)
+		if out == s {
+			return out
+		}
+		for token := range mappings {
+			// Masks are stored too, but are part of the value
+			if strings.HasPrefix(token, "[") {
+				rec.AddSubstitution(token, strings.Count(s, token))
+			}
+		}
+		return out
+	}
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/forensic"
+	"github.com/vurakit/agentveil/internal/vault"
+)
+
+func TestProxy_ForensicRecordReplays(t *testing.T) {
+	var sent []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent, _ = io.ReadAll(r.Body)
+		writeEchoCompletion(w, sent)
+	}))
+	defer upstream.Close()
+
+	mr := miniredis.RunT(t)
+	v := vault.NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	srv, err := New(Config{
+		TargetURL: upstream.URL,
+		Headers:   HeaderPolicy{Enabled: true, Deny: []string{"X-Internal-*"}},
+	}, detector.New(), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	handler := accesslog.NewWithWriter(&logs, accesslog.FieldsForensic).Middleware(srv.Handler())
+
+	// Media is masked while the detector runs, so edits after it have to
+	// be mapped back over the placeholder, and over the neutralized token
+	b64 := base64.StdEncoding.EncodeToString(noisePNG(t, 64))
+	secret := "sk-proj-abcdefghijklmnopqrstuvwxyz1234567890ABCDEF"
+	original := `{"messages":[{"role":"user","content":[` +
+		`{"type":"image_url","image_url":{"url":"data:image/png;base64,` + b64 + `"}},` +
+		`{"type":"text","text":"what is [CCCD_1]? CCCD 079203001234, mail alice@example.com, key ` + secret + `"}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(original))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Session-ID", "forensic-session")
+	req.Header.Set("X-Internal-Tenant", "acme")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	line := logs.String()
+	for _, value := range []string{"079203001234", "alice@example.com", secret, secret[:12], b64[:32]} {
+		if strings.Contains(line, value) {
+			t.Errorf("access log holds %q: %s", value, line)
+		}
+	}
+	var entry accesslog.Entry
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("invalid access log line: %v", err)
+	}
+	rec := entry.Transform
+	if rec == nil || rec.Partial || len(rec.Edits) != 4 {
+		t.Fatalf("transform = %+v", rec)
+	}
+	if rec.Edits[0].Action != forensic.ActionNeutralize {
+		t.Errorf("first edit = %+v, want the neutralized token", rec.Edits[0])
+	}
+
+	replayed, err := forensic.Replay([]byte(original), rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replayed, sent) {
+		t.Errorf("replay differs from what the upstream received:\n got %s\nwant %s", replayed, sent)
+	}
+
+	if len(rec.Headers) != 1 || rec.Headers[0].Name != "X-Internal-Tenant" || rec.Headers[0].Action != forensic.HeaderRemoved {
+		t.Errorf("headers = %+v", rec.Headers)
+	}
+	// The echoed CCCD and email tokens were rehydrated once each
+	if len(rec.ResponseTokens) != 2 || rec.ResponseTokens[0].Count != 1 || rec.ResponseTokens[1].Count != 1 {
+		t.Errorf("response tokens = %+v", rec.ResponseTokens)
+	}
+}
+
+func TestProxy_ForensicRecordOff(t *testing.T) {
+	srv, upstream := setupTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	defer upstream.Close()
+
+	var logs bytes.Buffer
+	handler := accesslog.NewWithWriter(&logs, accesslog.FieldsExtended).Middleware(srv.Handler())
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"content":"mail alice@example.com"}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if strings.Contains(logs.String(), "transform") {
+		t.Errorf("extended fields should not record transformations: %s", logs.String())
+	}
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/annotate"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/forensic"
+	"github.com/vurakit/agentveil/internal/stats"
+	"github.com/vurakit/agentveil/internal/webhook"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// HeaderPolicy controls PII scanning of request headers. Header name
+// patterns match case-insensitively; a trailing "*" matches any suffix.
+type HeaderPolicy struct {
+	Enabled bool
+	Allow   []string // forwarded unscanned, on top of ManagedHeaders
+	Deny    []string // always removed before forwarding, whatever their value
+}
+
+// ManagedHeaders are never scanned: hop-by-hop and transport headers,
+// credentials the auth middleware handles or the provider needs, and the
+// proxy's own control headers
+var ManagedHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-*", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+	"Authorization", "X-Api-Key", "Api-Key", "X-Goog-Api-Key", "Cookie",
+	"Host", "Content-*", "Accept*", "User-Agent",
+	"X-Veil-*", "X-Session-Id", "X-Request-Id", "X-User-Role",
+	"X-Forwarded-*", "X-Real-Ip",
+	"Anthropic-*", "Openai-*", "X-Stainless-*",
+}
+
+// ValidHeaderPattern reports whether p is a header name, optionally ending
+// in "*"
+func ValidHeaderPattern(p string) bool {
+	name := strings.TrimSuffix(p, "*")
+	if name == "" && p != "*" {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHeader reports whether name matches any of patterns
+func matchHeader(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanHeaders anonymizes PII in the upstream request's headers with the
+// session's token mapping, so echoed tokens rehydrate like body tokens.
+// Denied headers are dropped, as are headers carrying a secret: a token
+// would still tell the provider a credential was there.
+func (s *Server) scanHeaders(req *http.Request, sessionID string) {
+	policy := s.config.Headers
+	if !policy.Enabled {
+		return
+	}
+
+	var found []detector.Match
+	for name, values := range req.Header {
+		if matchHeader(name, policy.Deny) {
+			req.Header.Del(name)
+			slog.Info("proxy: removed denied header", "header", name)
+			forensic.From(req.Context()).AddHeader(name, forensic.HeaderRemoved, nil)
+			continue
+		}
+		if matchHeader(name, ManagedHeaders) || matchHeader(name, policy.Allow) {
+			continue
+		}
+
+		for i, v := range values {
+			// The name gives context-hinted patterns (password=, token:) a hint
+			matches := s.detector.Scan(name + ": " + v)
+			if len(matches) == 0 {
+				continue
+			}
+			if secrets := secretCategories(matches); len(secrets) > 0 {
+				req.Header.Del(name)
+				s.reportSecretHeader(req, sessionID, name, secrets)
+				break
+			}
+			anonymized, applied, _ := anonymize(req.Context(), s.detector, s.vault, sessionID, v)
+			values[i] = anonymized
+			found = append(found, applied...)
+			forensic.From(req.Context()).AddHeader(name, forensic.HeaderAnonymized, categoriesOf(applied))
+		}
+	}
+
+	if len(found) == 0 {
+		return
+	}
+	categories := categoriesOf(found)
+	stats.AddDetections(req.Context(), sessionID, categories)
+	accesslog.AddEntities(req.Context(), categories)
+	annotate.AddEntities(req.Context(), categories)
+	slog.Info("proxy: anonymized PII entities in headers", "count", len(found), "session", sessionID)
+	if s.webhook != nil {
+		s.webhook.Emit(webhook.Event{
+			Type:      webhook.EventPIIDetected,
+			SessionID: sessionID,
+			Data:      map[string]any{"count": len(found), "categories": categories, "source": "header"},
+		})
+	}
+}
+
+func (s *Server) reportSecretHeader(req *http.Request, sessionID, name string, categories []pii.Category) {
+	slog.Warn("proxy: stripped header carrying secrets", "header", name, "categories", categories, "session", sessionID)
+	forensic.From(req.Context()).AddHeader(name, forensic.HeaderStripped, categories)
+	accesslog.AddEntities(req.Context(), categories)
+	annotate.AddEntities(req.Context(), categories)
+	if s.webhook != nil {
+		s.webhook.Emit(webhook.Event{
+			Type:      webhook.EventPIIHighRisk,
+			SessionID: sessionID,
+			Data:      map[string]any{"source": "header", "header": name, "categories": categories, "action": "stripped"},
+		})
+	}
+}
+
+// secretCategories returns the secret categories among matches
+func secretCategories(matches []detector.Match) []pii.Category {
+	var cats []pii.Category
+	for _, m := range matches {
+		if pii.IsSecretCategory(m.Category) {
+			cats = append(cats, m.Category)
+		}
+	}
+	return cats
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// maxReportedTokens caps the tokens listed in a session.token_injection event
+const maxReportedTokens = 10
+
+// neutralizeTokens replaces the tokens in text, a part of a request not yet
+// anonymized, with detector.NeutralizedToken. A client has no business
+// sending tokens: responses to it are rehydrated, so a token in a request
+// is a guess at the session's mapping, and a model echoing it would turn
+// the response into an oracle for the value behind it. Each occurrence is
+// logged; the first of a request also emits a session.token_injection
+// event.
+func neutralizeTokens(ctx context.Context, sessionID, text string, existing map[string]string) string {
+	out, tokens := detector.NeutralizeTokens(text, existing)
+	if len(tokens) == 0 {
+		return text
+	}
+
+	plan, _ := ctx.Value(scanPlanKey{}).(*scanPlan)
+	source := "proxy"
+	if plan != nil && plan.source != "" {
+		source = plan.source
+	}
+	known := 0
+	for _, token := range tokens {
+		if _, ok := existing[token]; ok {
+			known++
+		}
+	}
+	slog.Warn(source+": neutralized client-supplied tokens", "count", len(tokens), "in_vault", known, "session", sessionID)
+
+	if plan == nil || plan.webhook == nil {
+		return out
+	}
+	plan.mu.Lock()
+	first := !plan.tokensReported
+	plan.tokensReported = true
+	plan.mu.Unlock()
+	if first {
+		data := map[string]any{
+			"tokens":   tokens[:min(len(tokens), maxReportedTokens)],
+			"count":    len(tokens),
+			"in_vault": known,
+			"source":   source,
+		}
+		if plan.keyID != "" {
+			data["key_id"] = plan.keyID
+		}
+		plan.webhook.Emit(webhook.Event{Type: webhook.EventTokenInjection, SessionID: sessionID, Data: data})
+	}
+	return out
+}
@@ -1,7 +1,7 @@
 package proxy
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 )
@@ -22,13 +22,12 @@ func (s *Server) roleMiddleware(next http.Handler) http.Handler {
 		case "admin", "viewer", "operator":
 			// allowed roles
 		default:
-			log.Printf("[middleware] rejected unknown role: %s", role)
+			slog.Warn("middleware: rejected unknown role", "role", role)
 			http.Error(w, `{"error":"forbidden","message":"unknown role"}`, http.StatusForbidden)
 			return
 		}
 
-		log.Printf("[middleware] %s %s role=%s session=%s",
-			r.Method, r.URL.Path, role, extractSessionID(r))
+		slog.Info("middleware: request", "method", r.Method, "path", r.URL.Path, "role", role, "session", extractSessionID(r))
 
 		next.ServeHTTP(w, r)
 	})
@@ -41,7 +40,7 @@ func (s *Server) securityEnforcer(next http.Handler) http.Handler {
 		for key, values := range r.Header {
 			for _, v := range values {
 				if containsSuspiciousPayload(key) || containsSuspiciousPayload(v) {
-					log.Printf("[security] blocked suspicious header: %s", key)
+					slog.Warn("security: blocked suspicious header", "header", key)
 					http.Error(w, `{"error":"forbidden","message":"security violation detected"}`, http.StatusForbidden)
 					return
 				}
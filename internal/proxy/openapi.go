@@ -0,0 +1,272 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/vurakit/agentveil/internal/auditor"
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/breakglass"
+	"github.com/vurakit/agentveil/internal/cache"
+	"github.com/vurakit/agentveil/internal/compliance"
+	"github.com/vurakit/agentveil/internal/detector/bundle"
+	"github.com/vurakit/agentveil/internal/feedback"
+	"github.com/vurakit/agentveil/internal/metrics"
+	"github.com/vurakit/agentveil/internal/openapi"
+	"github.com/vurakit/agentveil/internal/readiness"
+	"github.com/vurakit/agentveil/internal/session"
+	"github.com/vurakit/agentveil/internal/stats"
+	"github.com/vurakit/agentveil/internal/transcript"
+	"github.com/vurakit/agentveil/internal/version"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// OpenAPIPath is where the proxy serves its OpenAPI document
+const OpenAPIPath = "/openapi.json"
+
+// APIVersion is the version of the first-party API in the OpenAPI document
+const APIVersion = "1.0.0"
+
+// routeMux is a ServeMux that remembers its patterns, so tests can check
+// every route is described by OpenAPI
+type routeMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func newRouteMux() *routeMux {
+	return &routeMux{ServeMux: http.NewServeMux()}
+}
+
+func (m *routeMux) Handle(pattern string, h http.Handler) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.Handle(pattern, h)
+}
+
+func (m *routeMux) HandleFunc(pattern string, h http.HandlerFunc) {
+	m.Handle(pattern, h)
+}
+
+// OpenAPI returns the OpenAPI 3.1 document of the first-party endpoints:
+// everything Handler serves except the /v1/ and /gemini/ passthroughs to
+// the providers.
+// Endpoints that only exist with a feature enabled are always listed.
+func OpenAPI() openapi.Document {
+	b := openapi.New(openapi.Info{
+		Title:       "Agent Veil",
+		Version:     APIVersion,
+		Description: "Utility and admin endpoints of the Agent Veil proxy. Admin endpoints need a Veil key bound to one of the roles in x-veil-roles.",
+	})
+	admin := []string{string(auth.RoleAdmin)}
+
+	b.Add(http.MethodPost, "/scan", openapi.Op{
+		ID: "scanText", Tag: "detection", Summary: "Detect PII in text",
+		Request: ScanRequest{}, Response: ScanResponse{},
+		Errors: []int{http.StatusBadRequest},
+	})
+	b.Add(http.MethodPost, "/feedback/detection", openapi.Op{
+		ID: "reportDetection", Tag: "detection", Summary: "Report a detection as a false or true positive",
+		Description: "Only served with feedback enabled. The detection is named by its entity_id, never by its value. With suppression on, a value reported as a false positive by enough independent reporters is no longer flagged.",
+		Request:     feedback.DetectionReport{}, Response: feedback.Receipt{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusServiceUnavailable},
+	})
+	b.Add(http.MethodPost, "/v1/sessions", openapi.Op{
+		ID: "beginSession", Tag: "sessions", Summary: "Begin an explicit session",
+		Description: "Only served with Redis. Send the returned id as X-Session-ID. The body is optional. Implicit sessions, any X-Session-ID not begun here, keep working unchanged.",
+		Request:     BeginSessionRequest{}, Response: session.Session{},
+		Status: http.StatusCreated,
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusServiceUnavailable},
+	})
+	b.Add(http.MethodGet, "/v1/sessions/{id}/summary", openapi.Op{
+		ID: "getSessionSummary", Tag: "sessions", Summary: "Counts of an explicit session",
+		Description: "Only the caller that began the session, or an admin key, may read it. Counts only, never values.",
+		Response:    session.Totals{},
+		Errors:      []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusServiceUnavailable},
+	})
+	b.Add(http.MethodDelete, "/v1/sessions/{id}", openapi.Op{
+		ID: "endSession", Tag: "sessions", Summary: "End an explicit session",
+		Description: "Purges the session's vault mappings, canary tokens and threat score at once, returns the final counts and sends a session.ended webhook.",
+		Response:    session.Totals{},
+		Errors:      []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusServiceUnavailable},
+	})
+	b.Add(http.MethodPost, "/audit", openapi.Op{
+		ID: "auditSkill", Tag: "audit", Summary: "Audit skill.md content",
+		Description: "High and unacceptable risk reports are answered with 403. Texts are in the language of Accept-Language (vi or en), VEIL_LANG otherwise.",
+		Request:     AuditRequest{}, Response: auditor.Report{},
+		Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusServiceUnavailable},
+		Also:   map[int]any{http.StatusForbidden: auditor.Report{}},
+	})
+	b.Add(http.MethodGet, "/audit/rules", openapi.Op{
+		ID: "listAuditRules", Tag: "audit", Summary: "List the auditor rules",
+		Description: "Descriptions are in the language of Accept-Language (vi or en), VEIL_LANG otherwise.",
+		Response:    AuditRulesResponse{},
+	})
+	b.Add(http.MethodPost, "/audit/test", openapi.Op{
+		ID: "testAuditRule", Tag: "audit", Summary: "Test a rule or pattern against samples",
+		Request: AuditTestRequest{}, Response: AuditTestResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound},
+	})
+	b.Add(http.MethodPost, "/audit/project", openapi.Op{
+		ID: "auditProject", Tag: "audit", Summary: "Audit the files of a project together",
+		Description: "Behavior chains may span files that reference each other. High and unacceptable risk reports are answered with 403. Texts are in the language of Accept-Language (vi or en), VEIL_LANG otherwise.",
+		Request:     AuditProjectRequest{}, Response: auditor.ProjectReport{},
+		Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusServiceUnavailable},
+		Also:   map[int]any{http.StatusForbidden: auditor.ProjectReport{}},
+	})
+	b.Add(http.MethodGet, "/cache/stats", openapi.Op{
+		ID: "getCacheStats", Tag: "cache", Summary: "Response cache counters",
+		Description: "Only served with the response cache enabled.",
+		Response:    cache.Stats{},
+	})
+
+	b.Add(http.MethodGet, "/auth/whoami", openapi.Op{
+		ID: "whoAmI", Tag: "auth", Summary: "Describe the Veil key of the request",
+		Description: "Clients use it to check a key authenticates.",
+		Response:    auth.KeyInfo{},
+		Errors:      []int{http.StatusUnauthorized},
+		Roles:       []string{string(auth.RoleAdmin), string(auth.RoleViewer), string(auth.RoleOperator), string(auth.RoleAuditor)},
+	})
+
+	b.Add(http.MethodPost, "/admin/webhooks/test", openapi.Op{
+		ID: "testWebhooks", Tag: "admin", Summary: "Send a synthetic event to webhook destinations",
+		Request: webhook.TestRequest{}, Response: webhook.TestResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound},
+		Roles:  admin,
+	})
+	b.Add(http.MethodGet, "/admin/stats/pii", openapi.Op{
+		ID: "getPIIStats", Tag: "admin", Summary: "Aggregate PII detection counts",
+		Query: []openapi.Parameter{
+			{Name: "from", Description: "RFC 3339 timestamp or YYYY-MM-DD date (default: 7 days ago)", Schema: openapi.Schema{"type": "string"}},
+			{Name: "to", Description: "RFC 3339 timestamp or YYYY-MM-DD date (default: now)", Schema: openapi.Schema{"type": "string"}},
+			{Name: "bucket", Schema: openapi.Schema{"type": "string", "enum": []string{"day", "hour"}}},
+			{Name: "group_by", Description: "comma-separated: category, key", Schema: openapi.Schema{"type": "string"}},
+			{Name: "format", Schema: openapi.Schema{"type": "string", "enum": []string{"json", "csv"}}},
+		},
+		Response: stats.Report{},
+		Formats:  []openapi.Raw{{ContentType: "text/csv"}},
+		Errors:   []int{http.StatusBadRequest, http.StatusServiceUnavailable},
+		Roles:    admin,
+	})
+	b.Add(http.MethodGet, "/admin/feedback/summary", openapi.Op{
+		ID: "getFeedbackSummary", Tag: "admin", Summary: "False-positive rates per pattern",
+		Response: feedback.Summary{},
+		Errors:   []int{http.StatusServiceUnavailable},
+		Roles:    admin,
+	})
+	b.Add(http.MethodGet, "/admin/transcripts", openapi.Op{
+		ID: "exportTranscripts", Tag: "admin", Summary: "Export recorded transcripts as JSONL",
+		Query: []openapi.Parameter{
+			{Name: "since", Description: "RFC 3339 timestamp, YYYY-MM-DD date, or a duration such as 24h", Schema: openapi.Schema{"type": "string"}},
+		},
+		Response: openapi.Raw{ContentType: "application/x-ndjson", Schema: transcript.Record{}},
+		Errors:   []int{http.StatusBadRequest, http.StatusServiceUnavailable},
+		Roles:    admin,
+	})
+	b.Add(http.MethodGet, "/admin/transcripts/{session}", openapi.Op{
+		ID: "getTranscript", Tag: "admin", Summary: "Recorded transcript of a session",
+		Response: transcript.SessionTranscript{},
+		Errors:   []int{http.StatusNotFound, http.StatusServiceUnavailable},
+		Roles:    admin,
+	})
+	b.Add(http.MethodPost, "/admin/vault/resolve", openapi.Op{
+		ID: "resolveToken", Tag: "admin", Summary: "Resolve a token to its original value",
+		Description: "Every attempt is audit-logged. Values are masked for the auditor role.",
+		Request:     ResolveRequest{}, Response: ResolveResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusTooManyRequests, http.StatusServiceUnavailable},
+		Roles:  []string{string(auth.RoleAdmin), string(auth.RoleAuditor)},
+	})
+	b.Add(http.MethodGet, "/admin/sessions", openapi.Op{
+		ID: "listSessions", Tag: "admin", Summary: "List vault sessions",
+		Query: []openapi.Parameter{
+			{Name: "cursor", Description: "next_cursor of the previous page", Schema: openapi.Schema{"type": "string"}},
+			{Name: "limit", Schema: openapi.Schema{"type": "integer", "minimum": 1}},
+		},
+		Response: SessionList{},
+		Errors:   []int{http.StatusBadRequest, http.StatusServiceUnavailable},
+		Roles:    admin,
+	})
+	b.Add(http.MethodGet, "/admin/sessions/{id}", openapi.Op{
+		ID: "getSession", Tag: "admin", Summary: "Describe a vault session",
+		Response: SessionSummary{},
+		Errors:   []int{http.StatusNotFound, http.StatusServiceUnavailable},
+		Roles:    admin,
+	})
+	b.Add(http.MethodDelete, "/admin/sessions/{id}", openapi.Op{
+		ID: "purgeSession", Tag: "admin", Summary: "Erase a vault session",
+		Description: "Removes the session's mappings at once, for the right to erasure. The erasure is audit-logged and sent as a session.erased event.",
+		Response:    SessionErasure{},
+		Errors:      []int{http.StatusServiceUnavailable},
+		Roles:       admin,
+	})
+	b.Add(http.MethodGet, "/admin/status", openapi.Op{
+		ID: "getStatus", Tag: "admin", Summary: "Overload protection and break-glass status",
+		Description: "protection counts protection component failures by component and the requests refused under the closed failure mode.",
+		Response:    StatusResponse{},
+		Roles:       admin,
+	})
+	b.Add(http.MethodGet, "/admin/readiness", openapi.Op{
+		ID: "getReadiness", Tag: "admin", Summary: "Startup probe results",
+		Description: "Every check of the VEIL_STARTUP_PROBE=strict gate with its last error, and why the gate failed. Without the probe the phase is ready and there are no checks.",
+		Response:    readiness.Status{},
+		Roles:       admin,
+	})
+	b.Add(http.MethodPost, "/admin/breakglass", openapi.Op{
+		ID: "activateBreakGlass", Tag: "admin", Summary: "Switch the prompt guard and guardrails to log-only for a while",
+		Description: "Requires the header " + breakglass.ConfirmHeader + ": " + breakglass.ConfirmValue + ". Activation and expiry are audit-logged.",
+		Request:     breakglass.Request{}, Response: breakglass.Status{},
+		Errors: []int{http.StatusBadRequest, http.StatusPreconditionRequired},
+		Roles:  admin,
+	})
+	b.Add(http.MethodPost, "/admin/patterns/reload", openapi.Op{
+		ID: "reloadPatterns", Tag: "admin", Summary: "Reload the signed pattern bundle",
+		Description: "A rejected bundle is answered with 422; the previous patterns stay active.",
+		Response:    bundle.ReloadResponse{},
+		Also:        map[int]any{http.StatusUnprocessableEntity: bundle.ReloadResponse{}},
+		Roles:       admin,
+	})
+
+	b.Add(http.MethodGet, "/health", openapi.Op{
+		ID: "health", Tag: "system", Summary: "Health probe", Response: HealthResponse{},
+	})
+	b.Add(http.MethodGet, "/healthz", openapi.Op{
+		ID: "healthz", Tag: "system", Summary: "Health probe", Response: HealthResponse{},
+	})
+	b.Add(http.MethodGet, "/readyz", openapi.Op{
+		ID: "readyz", Tag: "system", Summary: "Readiness probe",
+		Description: "503 until the VEIL_STARTUP_PROBE=strict gate reaches its quorum, and for good once it times out. Ready at once without the probe.",
+		Response:    readiness.Response{},
+		Also:        map[int]any{http.StatusServiceUnavailable: readiness.Response{}},
+	})
+	b.Add(http.MethodGet, "/version", openapi.Op{
+		ID: "getVersion", Tag: "system", Summary: "Version, commit and build date of the proxy",
+		Response: version.BuildInfo{},
+	})
+	b.Add(http.MethodGet, compliance.CapabilitiesPath, openapi.Op{
+		ID: "getCapabilities", Tag: "system", Summary: "Security capabilities for fleet compliance checks",
+		Response: compliance.SystemCapabilities{},
+	})
+	b.Add(http.MethodGet, metrics.Path, openapi.Op{
+		ID: "getMetrics", Tag: "system", Summary: "Prometheus metrics",
+		Description: "Served with VEIL_METRICS=true. With VEIL_METRICS_AUTH=true it requires a Veil API key of any role.",
+		Response:    openapi.Raw{ContentType: "text/plain"},
+		Errors:      []int{http.StatusUnauthorized},
+	})
+	b.Add(http.MethodGet, OpenAPIPath, openapi.Op{
+		ID: "getOpenAPI", Tag: "system", Summary: "This document",
+		Response: openapi.Raw{ContentType: "application/json", Schema: openapi.Schema{}},
+	})
+	return b.Document()
+}
+
+// OpenAPIHandler serves the OpenAPI document
+func OpenAPIHandler() http.HandlerFunc {
+	body := sync.OnceValue(func() []byte {
+		data, _ := json.MarshalIndent(OpenAPI(), "", "  ")
+		return data
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body())
+	}
+}
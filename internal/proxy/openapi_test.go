@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/breakglass"
+	"github.com/vurakit/agentveil/internal/cache"
+	"github.com/vurakit/agentveil/internal/compliance"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/detector/bundle"
+	"github.com/vurakit/agentveil/internal/feedback"
+	"github.com/vurakit/agentveil/internal/metrics"
+	"github.com/vurakit/agentveil/internal/overload"
+	"github.com/vurakit/agentveil/internal/session"
+	"github.com/vurakit/agentveil/internal/stats"
+	"github.com/vurakit/agentveil/internal/transcript"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// passthrough lists the patterns forwarded to the provider, which OpenAPI
+// does not describe
+var passthrough = []string{"/v1/", GeminiPrefix + "/"}
+
+// methodsOf lists the methods served on method-less patterns
+var methodsOf = map[string][]string{
+	"/scan":                {http.MethodPost},
+	"/audit":               {http.MethodPost},
+	"/cache/stats":         {http.MethodGet},
+	"/admin/webhooks/test": {http.MethodPost},
+	"/health":              {http.MethodGet},
+	"/healthz":             {http.MethodGet},
+}
+
+func TestOpenAPI_CoversEveryRoute(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	v := vault.NewWithClient(client)
+	det := detector.New()
+	fb, err := feedback.New(client, feedback.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := New(Config{TargetURL: "http://127.0.0.1:1", GeminiTargetURL: "http://127.0.0.1:2"}, det, v,
+		WithAuth(auth.NewManager(client)),
+		WithResolver(NewResolver(v, accesslog.NewWithWriter(&bytes.Buffer{}, accesslog.FieldsCommon), 2, nil)),
+		WithOverload(overload.New(overload.Config{MaxInFlight: 5})),
+		WithWebhook(webhook.NewDispatcher(webhook.DefaultConfig())),
+		WithStats(stats.New(stats.NewMemoryStore(), stats.DefaultConfig())),
+		WithFeedback(fb),
+		WithTranscripts(transcript.New(transcript.NewRedisStore(client), 0)),
+		WithCache(cache.New(cache.NewMemoryStore(10), cache.DefaultConfig())),
+		WithCapabilities(compliance.SystemCapabilities{}),
+		WithPatternBundle(bundle.NewLoader(bundle.Config{Source: "bundle.yaml"}, det)),
+		WithBreakGlass(breakglass.New(breakglass.DefaultConfig(), nil, nil)),
+		WithSessions(session.New(client, v, session.Config{})),
+		WithMetrics(metrics.NewRegistry()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := OpenAPI()
+	if err := doc.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	registered := make(map[string]bool)
+	for _, pattern := range srv.routes().patterns {
+		if slices.Contains(passthrough, pattern) {
+			continue
+		}
+		methods := methodsOf[pattern]
+		if method, path, ok := strings.Cut(pattern, " "); ok {
+			methods, pattern = []string{method}, path
+		}
+		if len(methods) == 0 {
+			t.Errorf("%s has no method, add it to methodsOf", pattern)
+		}
+		for _, method := range methods {
+			key := method + " " + pattern
+			registered[key] = true
+			op := doc.Paths[pattern][strings.ToLower(method)]
+			if op == nil {
+				t.Errorf("%s is not in the OpenAPI document", key)
+				continue
+			}
+			if len(op.Responses) == 0 {
+				t.Errorf("%s has no responses", key)
+			}
+			if strings.HasPrefix(pattern, "/admin/") && len(op.Roles) == 0 {
+				t.Errorf("%s is not marked as needing an admin key", key)
+			}
+		}
+	}
+	for path, item := range doc.Paths {
+		for method := range item {
+			if key := strings.ToUpper(method) + " " + path; !registered[key] {
+				t.Errorf("%s is in the OpenAPI document but not registered", key)
+			}
+		}
+	}
+}
+
+func TestOpenAPI_Schemas(t *testing.T) {
+	doc := OpenAPI()
+	scan := doc.Paths["/scan"]["post"]
+	if ref := scan.RequestBody.Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/ScanRequest" {
+		t.Errorf("scan request schema = %v", ref)
+	}
+	if ref := scan.Responses["400"].Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/ErrorResponse" {
+		t.Errorf("scan 400 schema = %v", ref)
+	}
+
+	resolve := doc.Paths["/admin/vault/resolve"]["post"]
+	if !slices.Equal(resolve.Roles, []string{"admin", "auditor"}) {
+		t.Errorf("resolve roles = %v", resolve.Roles)
+	}
+	if _, ok := resolve.Responses["403"]; !ok || len(resolve.Security) == 0 {
+		t.Errorf("resolve has no security or 403: %+v", resolve)
+	}
+	if len(doc.Paths["/scan"]["post"].Security) != 0 {
+		t.Error("public endpoint requires a key")
+	}
+
+	if _, ok := doc.Paths["/admin/transcripts"]["get"].Responses["200"].Content["application/x-ndjson"]; !ok {
+		t.Error("transcript export is not JSONL")
+	}
+	if _, ok := doc.Components.Schemas["ScanEntity"]; !ok {
+		t.Error("ScanEntity is not a component")
+	}
+}
+
+func TestOpenAPI_Served(t *testing.T) {
+	srv, err := New(Config{TargetURL: "http://127.0.0.1:1"}, detector.New(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("openapi = %v", doc["openapi"])
+	}
+}
+
+// TestOpenAPI_SDKUpToDate keeps the document the SDK clients are generated
+// from in step with the code; refresh it with make openapi
+func TestOpenAPI_SDKUpToDate(t *testing.T) {
+	committed, err := os.ReadFile("../../sdk/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.MarshalIndent(OpenAPI(), "", "  ")
+	if !bytes.Equal(bytes.TrimSpace(committed), want) {
+		t.Error("sdk/openapi.json is out of date, run make openapi")
+	}
+}
@@ -0,0 +1,22 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/vurakit/agentveil/internal/detector"
+)
+
+// withProfile selects the detector profile of req: the Veil key's profile,
+// else the one its router route set, else the detector's defaults. Only
+// the auth middleware sets X-Veil-Detector-Profile, and only alongside a
+// key ID, so clients cannot pick a laxer profile.
+func withProfile(req *http.Request) *http.Request {
+	if req.Header.Get("X-Veil-Key-ID") == "" {
+		return req
+	}
+	profile := req.Header.Get("X-Veil-Detector-Profile")
+	if profile == "" {
+		return req
+	}
+	return req.WithContext(detector.WithProfile(req.Context(), profile))
+}
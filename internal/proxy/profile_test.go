@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/vault"
+)
+
+func TestDetectorProfile_PerKey(t *testing.T) {
+	var forwarded []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = append(forwarded, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	am := auth.NewManager(client)
+	ctx := context.Background()
+	supportKey, support, _ := am.GenerateKey(ctx, auth.RoleOperator, "support agent")
+	codeKey, code, _ := am.GenerateKey(ctx, auth.RoleOperator, "code assistant")
+	am.SetDetectorProfile(ctx, support.ID, "support")
+	am.SetDetectorProfile(ctx, code.ID, "code")
+
+	cfg := detector.DefaultConfig()
+	cfg.Profiles = map[string]detector.Profile{
+		"support": {Sensitivity: detector.SensitivityHigh},
+		"code":    {Sensitivity: detector.SensitivityMedium, Sets: []detector.PatternSet{detector.SetSecrets}},
+	}
+	srv, err := New(Config{TargetURL: upstream.URL}, detector.NewWithConfig(cfg), vault.NewWithClient(client), WithAuth(am))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"messages":[{"role":"user","content":"email a@example.com, OPENAI_API_KEY=sk-proj-abcdefghijklmnopqrstuvwxyz1234567890ABCDEF"}]}`
+	for _, key := range []string{supportKey, codeKey} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Veil-Key", key)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+	}
+
+	if len(forwarded) != 2 {
+		t.Fatalf("forwarded %d requests", len(forwarded))
+	}
+	if strings.Contains(forwarded[0], "a@example.com") || !strings.Contains(forwarded[0], "[EMAIL_1]") {
+		t.Errorf("support key should tokenize the email: %s", forwarded[0])
+	}
+	if !strings.Contains(forwarded[1], "a@example.com") {
+		t.Errorf("code key should only scan for secrets: %s", forwarded[1])
+	}
+	for i, f := range forwarded {
+		if strings.Contains(f, "abcdefghijklmnopqrstuvwxyz1234567890ABCDEF") {
+			t.Errorf("request %d leaked the API key: %s", i, f)
+		}
+	}
+}
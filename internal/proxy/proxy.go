@@ -3,24 +3,204 @@ package proxy
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/annotate"
 	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/breakglass"
+	"github.com/vurakit/agentveil/internal/cache"
+	"github.com/vurakit/agentveil/internal/compliance"
 	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/detector/bundle"
+	"github.com/vurakit/agentveil/internal/detector/remote"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/feedback"
+	"github.com/vurakit/agentveil/internal/forensic"
+	"github.com/vurakit/agentveil/internal/i18n"
+	"github.com/vurakit/agentveil/internal/metrics"
+	"github.com/vurakit/agentveil/internal/overload"
 	"github.com/vurakit/agentveil/internal/promptguard"
+	"github.com/vurakit/agentveil/internal/ratelimit"
+	"github.com/vurakit/agentveil/internal/readiness"
+	"github.com/vurakit/agentveil/internal/session"
+	"github.com/vurakit/agentveil/internal/stats"
+	"github.com/vurakit/agentveil/internal/transcript"
+	"github.com/vurakit/agentveil/internal/upstream"
 	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/version"
 	"github.com/vurakit/agentveil/internal/webhook"
+	"github.com/vurakit/agentveil/pkg/pii"
+	"github.com/vurakit/agentveil/pkg/veilsig"
 )
 
 // Config holds proxy configuration
 type Config struct {
 	TargetURL   string // upstream LLM API base URL
+	// GeminiTargetURL is the upstream of the GeminiPrefix route, usually
+	// DefaultGeminiTargetURL. Empty leaves the route out.
+	GeminiTargetURL string
 	DefaultRole string // default role when X-User-Role not set (viewer/admin/operator)
+	// SSEHeartbeat is the silence after which a ": ping" comment is sent on
+	// streaming responses. Zero uses DefaultSSEHeartbeat, negative disables.
+	SSEHeartbeat time.Duration
+	// SigningKey, when set, signs every upstream request with
+	// X-Veil-Signature and X-Veil-Timestamp (see pkg/veilsig)
+	SigningKey ed25519.PrivateKey
+	// DetectorAddr, when set, sends detection to a remote detector service
+	// (agentveil detector serve). The in-process detector passed to New is
+	// used automatically while the remote is unavailable.
+	DetectorAddr string
+
+	// UpstreamTimeout bounds a whole upstream exchange, streams included.
+	// Zero means no limit.
+	UpstreamTimeout time.Duration
+	// ResponseHeaderTimeout is the wait for upstream response headers. Zero
+	// uses upstream.DefaultResponseHeaderTimeout.
+	ResponseHeaderTimeout time.Duration
+	// MaxIdleConnsPerHost sizes the keep-alive pool to the upstream. Zero
+	// uses upstream.DefaultMaxIdleConnsPerHost.
+	MaxIdleConnsPerHost int
+	// RetryUpstream resends a request once after a connection reset or EOF
+	// when it is idempotent or its body is small enough to buffer
+	RetryUpstream bool
+	// UpstreamUserAgent is appended to the client's User-Agent on upstream
+	// requests, see upstream.Config.UserAgent. Empty leaves it untouched.
+	UpstreamUserAgent string
+
+	// Headers controls PII scanning of request headers
+	Headers HeaderPolicy
+
+	// Fields redacts identifier fields of JSON request bodies after
+	// anonymization. The zero value redacts nothing.
+	Fields FieldPolicy
+	// BinaryMinLength is the shortest JSON string checked for raw base64
+	// media, which is left out of PII detection like data URIs are. Zero
+	// uses DefaultBinaryMinLength, negative checks data URIs only.
+	BinaryMinLength int
+	// MaxFileSize is the largest multipart upload to /v1/files. Zero uses
+	// DefaultMaxFileSize.
+	MaxFileSize int64
+	// BlockSecrets rejects requests carrying secrets the detector blocks,
+	// see BlockSecrets. Set it when the detector's Secrets block any.
+	BlockSecrets bool
+	// CountTokens is how token counting requests are processed. Empty uses
+	// CountTokensAnonymize. Model listings are never processed.
+	CountTokens CountTokensMode
+	// Lang is the language of audit reports for requests without a
+	// supported Accept-Language. Empty uses i18n.Default.
+	Lang i18n.Lang
+	// FailureMode is what a request does when the detector, the vault, the
+	// prompt guard or its canary store fails while serving it. Empty uses
+	// failsafe.DefaultMode.
+	FailureMode failsafe.Mode
+	// MetricsRequireKey makes GET /metrics, served with WithMetrics,
+	// require a Veil API key of any role
+	MetricsRequireKey bool
+}
+
+// Upstream returns the transport settings derived from the config
+func (c Config) Upstream() upstream.Config {
+	return upstream.Config{
+		Timeout:               c.UpstreamTimeout,
+		ResponseHeaderTimeout: c.ResponseHeaderTimeout,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		Retry:                 c.RetryUpstream,
+		UserAgent:             c.UpstreamUserAgent,
+	}
+}
+
+// Detector is the PII detection backend: *detector.Detector in-process or
+// *remote.Client for a detector service
+type Detector interface {
+	Scan(text string) []detector.Match
+	AnonymizeWith(text string, existing map[string]string) (string, []detector.Match)
+	Mapping(applied []detector.Match) map[string]string
+}
+
+// sessionAnonymizer is implemented by detectors that use the session for
+// routing, such as the remote client
+type sessionAnonymizer interface {
+	AnonymizeSession(ctx context.Context, sessionID, text string, existing map[string]string) (string, []detector.Match)
+}
+
+// sessionLocks serialize anonymization per session (striped by hash) so
+// concurrent requests of one session can't mint the same new token for
+// different values between the vault read and the vault write
+var sessionLocks [64]sync.Mutex
+
+func lockSession(sessionID string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	mu := &sessionLocks[h.Sum32()%uint32(len(sessionLocks))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// anonymize replaces PII in text, continuing the session's token numbering
+// from the vault, and stores the new mapping. Tokens the client wrote
+// itself are neutralized first. It returns the anonymized text,
+// the applied matches and the mapping. Vault and detector failures are
+// reported to the failure policy; a failed detector returns the text
+// unanonymized, to be forwarded only if the policy allows.
+func anonymize(ctx context.Context, det Detector, v *vault.Vault, sessionID, text string) (string, []detector.Match, map[string]string) {
+	anonymized, applied, mapping, _ := anonymizeTraced(ctx, det, v, sessionID, text, false)
+	return anonymized, applied, mapping
+}
+
+// anonymizeTraced is anonymize that, with trace set, also returns the
+// spans of text neutralized before the detector ran. The matches' offsets
+// are relative to the neutralized text.
+func anonymizeTraced(ctx context.Context, det Detector, v *vault.Vault, sessionID, text string, trace bool) (string, []detector.Match, map[string]string, [][2]int) {
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	existing, err := v.LookupAll(ctx, sessionID)
+	if err != nil {
+		failsafe.Report(ctx, failsafe.Vault, sessionID, fmt.Errorf("lookup: %w", err))
+	}
+	var neutralized [][2]int
+	if trace {
+		neutralized = detector.TokenSpans(text, existing)
+	}
+	text = neutralizeTokens(ctx, sessionID, text, existing)
+	var anonymized string
+	var applied []detector.Match
+	var mapping map[string]string
+	ok := failsafe.Protect(ctx, failsafe.Detector, sessionID, func() {
+		if sa, ok := det.(sessionAnonymizer); ok {
+			anonymized, applied = sa.AnonymizeSession(ctx, sessionID, text, existing)
+		} else if td, ok := det.(tieredDetector); ok {
+			anonymized, applied = anonymizeTiered(ctx, td, v, sessionID, text, existing)
+		} else {
+			anonymized, applied = det.AnonymizeWith(text, existing)
+		}
+		mapping = det.Mapping(applied)
+	})
+	if !ok {
+		return text, nil, nil, neutralized
+	}
+
+	if len(mapping) > 0 {
+		if err := v.Store(ctx, sessionID, mapping); err != nil {
+			failsafe.Report(ctx, failsafe.Vault, sessionID, fmt.Errorf("store: %w", err))
+		}
+	}
+	return anonymized, applied, mapping, neutralized
 }
 
 // Option configures the Server
@@ -31,6 +211,23 @@ func WithAuth(am *auth.Manager) Option {
 	return func(s *Server) { s.auth = am }
 }
 
+// WithKeyRateLimit limits the requests of each authenticated Veil key
+// with l, which is keyed by ratelimit.ByVeilKey. It runs inside auth, so
+// the key is known.
+func WithKeyRateLimit(l *ratelimit.Limiter) Option {
+	return func(s *Server) { s.keyLimit = l }
+}
+
+// WithResolver enables POST /admin/vault/resolve for admin and auditor keys
+func WithResolver(rs *Resolver) Option {
+	return func(s *Server) { s.resolver = rs }
+}
+
+// WithOverload serves the load shedder's counters at /admin/status
+func WithOverload(l *overload.Limiter) Option {
+	return func(s *Server) { s.overload = l }
+}
+
 // WithPromptGuard adds prompt injection protection
 func WithPromptGuard(pg *promptguard.Guard) Option {
 	return func(s *Server) { s.promptGuard = pg }
@@ -41,18 +238,107 @@ func WithWebhook(d *webhook.Dispatcher) Option {
 	return func(s *Server) { s.webhook = d }
 }
 
+// WithStats records aggregate detection counters and serves /admin/stats/pii
+func WithStats(c *stats.Collector) Option {
+	return func(s *Server) { s.stats = c }
+}
+
+// WithFeedback serves POST /feedback/detection and
+// GET /admin/feedback/summary
+func WithFeedback(c *feedback.Collector) Option {
+	return func(s *Server) { s.feedback = c }
+}
+
+// WithTranscripts records flagged sessions and serves /admin/transcripts
+func WithTranscripts(r *transcript.Recorder) Option {
+	return func(s *Server) { s.transcripts = r }
+}
+
+// WithCache serves repeated anonymized requests from a response cache
+func WithCache(c *cache.Cache) Option {
+	return func(s *Server) { s.cache = c }
+}
+
+// WithCapabilities serves caps at /capabilities for fleet compliance checks
+func WithCapabilities(caps compliance.SystemCapabilities) Option {
+	return func(s *Server) { s.capabilities = &caps }
+}
+
+// WithPatternBundle reports the pattern bundle in health checks and
+// enables POST /admin/patterns/reload
+func WithPatternBundle(l *bundle.Loader) Option {
+	return func(s *Server) { s.patterns = l }
+}
+
+// WithBreakGlass enables POST /admin/breakglass and reports the switch in
+// health checks and /admin/status. The prompt guard gets the same switch
+// through promptguard.WithBreakGlass.
+func WithBreakGlass(sw *breakglass.Switch) Option {
+	return func(s *Server) { s.breakGlass = sw }
+}
+
+// WithSessionBinding replaces the default session binding, which is
+// enabled and audits to stdout
+func WithSessionBinding(b SessionBinding) Option {
+	return func(s *Server) { s.binding = b }
+}
+
+// WithSessions enables explicit sessions: POST /v1/sessions,
+// GET /v1/sessions/{id}/summary and DELETE /v1/sessions/{id}, and counts
+// the requests, tokens and threats of the sessions begun there
+func WithSessions(m *session.Manager) Option {
+	return func(s *Server) { s.sessions = m }
+}
+
+// WithReadiness gates GET /readyz on g and serves its check results at
+// GET /admin/readiness. Without it /readyz is ready as soon as the proxy
+// listens.
+func WithReadiness(g *readiness.Gate) Option {
+	return func(s *Server) { s.readiness = g }
+}
+
+// WithMetrics serves reg at GET /metrics and reports the upstream latency
+// to it
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(s *Server) { s.metrics = reg }
+}
+
 // Server is the Agent Veil reverse proxy
 type Server struct {
-	config      Config
-	proxy       *httputil.ReverseProxy
-	target      *url.URL
-	detector    *detector.Detector
-	vault       *vault.Vault
-	auth        *auth.Manager
-	promptGuard *promptguard.Guard
-	webhook     *webhook.Dispatcher
+	config       Config
+	proxy        *httputil.ReverseProxy
+	target       *url.URL
+	detector     Detector
+	vault        *vault.Vault
+	auth         *auth.Manager
+	keyLimit     *ratelimit.Limiter
+	promptGuard  *promptguard.Guard
+	capabilities *compliance.SystemCapabilities
+	webhook      *webhook.Dispatcher
+	cache        *cache.Cache
+	stats        *stats.Collector
+	feedback     *feedback.Collector
+	transcripts  *transcript.Recorder
+	resolver     *Resolver
+	overload     *overload.Limiter
+	patterns     *bundle.Loader
+	breakGlass   *breakglass.Switch
+	binding      SessionBinding
+	sessions     *session.Manager
+	failures     *failsafe.Policy
+	readiness    *readiness.Gate
+	metrics      *metrics.Registry
+	gemini       *Server // serves GeminiPrefix, nil without GeminiTargetURL
 }
 
+// GeminiPrefix is the route of Gemini SDK traffic next to the /v1/
+// passthrough: /gemini/v1beta/models/... is sent to GeminiTargetURL as
+// /v1beta/models/...
+const GeminiPrefix = "/gemini"
+
+// DefaultGeminiTargetURL is the Gemini API
+const DefaultGeminiTargetURL = "https://generativelanguage.googleapis.com"
+
 // New creates a new proxy Server
 func New(cfg Config, det *detector.Detector, v *vault.Vault, opts ...Option) (*Server, error) {
 	target, err := url.Parse(cfg.TargetURL)
@@ -63,6 +349,9 @@ func New(cfg Config, det *detector.Detector, v *vault.Vault, opts ...Option) (*S
 	if cfg.DefaultRole == "" {
 		cfg.DefaultRole = "viewer"
 	}
+	if cfg.SSEHeartbeat == 0 {
+		cfg.SSEHeartbeat = DefaultSSEHeartbeat
+	}
 
 	s := &Server{
 		config:   cfg,
@@ -70,44 +359,282 @@ func New(cfg Config, det *detector.Detector, v *vault.Vault, opts ...Option) (*S
 		detector: det,
 		vault:    v,
 	}
+	if cfg.DetectorAddr != "" {
+		client, err := remote.NewClient(cfg.DetectorAddr, det)
+		if err != nil {
+			return nil, err
+		}
+		s.detector = client
+	}
 
 	for _, opt := range opts {
 		opt(s)
 	}
+	if s.binding.Webhook == nil {
+		s.binding.Webhook = s.webhook
+	}
+	s.failures = failsafe.New(cfg.FailureMode, s.webhook)
 
 	s.proxy = &httputil.ReverseProxy{
 		Director:       s.director,
 		ModifyResponse: s.modifyResponse,
 		ErrorHandler:   s.errorHandler,
+		// Flush every write so SSE events aren't held in the proxy's buffer
+		FlushInterval: -1,
+		Transport:     upstream.NewTransport(cfg.Upstream()),
+	}
+	if s.metrics != nil {
+		s.proxy.Transport = metrics.Transport(s.metrics, target.Host, s.proxy.Transport)
 	}
+	if s.cache != nil {
+		s.proxy.Transport = s.cache.Wrap(s.proxy.Transport)
+	}
+	// Outermost, so a refused request isn't answered from the cache either
+	s.proxy.Transport = failsafe.Transport(s.proxy.Transport)
 
+	if cfg.GeminiTargetURL != "" {
+		if err := s.addGemini(det, opts); err != nil {
+			return nil, err
+		}
+	}
 	return s, nil
 }
 
+// addGemini builds the pipeline of the GeminiPrefix route: the same
+// protections as s with GeminiTargetURL as the upstream. The detector and
+// the failure counters are shared with s.
+func (s *Server) addGemini(det *detector.Detector, opts []Option) error {
+	cfg := s.config
+	cfg.TargetURL, cfg.GeminiTargetURL, cfg.DetectorAddr = cfg.GeminiTargetURL, "", ""
+	gemini, err := New(cfg, det, s.vault, opts...)
+	if err != nil {
+		return fmt.Errorf("gemini route: %w", err)
+	}
+	gemini.detector = s.detector
+	gemini.failures = s.failures
+	s.gemini = gemini
+	return nil
+}
+
 // MaxBodySize is the maximum allowed request body size (10MB)
 const MaxBodySize = 10 * 1024 * 1024
 
-// Handler returns the HTTP handler with middleware chain
-func (s *Server) Handler() http.Handler {
-	mux := http.NewServeMux()
-	// Chain: [auth →] [promptGuard →] securityEnforcer → roleMiddleware → proxy
+// Pipeline returns the middleware chain that anonymizes, forwards and
+// rehydrates a request, without the utility endpoints. It serves any path,
+// e.g. decrypted traffic from the HTTPS forward proxy.
+func (s *Server) Pipeline() http.Handler {
+	// Chain: [auth →] [key rate limit →] [sessions →] [transcripts →] [stats →] failsafe → annotations → [promptGuard →] [secrets →] securityEnforcer → roleMiddleware → proxy
 	var handler http.Handler = s.securityEnforcer(s.roleMiddleware(s.proxy))
+	if s.config.BlockSecrets {
+		handler = BlockSecrets(s.detector, s.webhook, s.config.BinaryMinLength, "proxy")(handler)
+	}
 	if s.promptGuard != nil {
 		handler = promptguard.Middleware(s.promptGuard)(handler)
 	}
+	handler = annotate.Middleware(handler)
+	handler = s.failures.Middleware(handler)
+	if s.stats != nil {
+		handler = s.stats.Middleware(handler)
+	}
+	if s.transcripts != nil {
+		handler = s.transcripts.Middleware(handler)
+	}
+	if s.sessions != nil {
+		handler = s.sessions.Middleware(handler)
+	}
+	if s.keyLimit != nil {
+		handler = s.keyLimit.Middleware(handler)
+	}
 	if s.auth != nil {
 		handler = s.auth.Middleware(handler)
 	}
+	return handler
+}
+
+// Handler returns the HTTP handler for every endpoint, the admin API
+// included, for a proxy with a single listener
+func (s *Server) Handler() http.Handler {
+	return s.routes()
+}
+
+// PublicHandler returns the handler for a main listener that leaves the
+// admin API to an AdminListener: /admin/* is not registered and answers 404
+func (s *Server) PublicHandler() http.Handler {
+	mux := newRouteMux()
+	s.publicRoutes(mux)
+	return mux
+}
+
+// HandleAdmin registers the admin API on mux, behind guard
+func (s *Server) HandleAdmin(mux interface{ Handle(string, http.Handler) }, guard Guard) {
+	s.adminRoutes(mux, guard)
+}
+
+// routes registers the passthrough and every first-party endpoint enabled
+// on s. Endpoints added here must be described in OpenAPI.
+func (s *Server) routes() *routeMux {
+	mux := newRouteMux()
+	s.publicRoutes(mux)
+	s.adminRoutes(mux, RoleGuard(s.auth))
+	return mux
+}
+
+// publicRoutes registers proxy traffic, the first-party API for clients and
+// health
+func (s *Server) publicRoutes(mux *routeMux) {
+	handler := s.Pipeline()
 	mux.Handle("/v1/", handler)
+	if s.gemini != nil {
+		// Gemini SDKs carry their API key in ?key=, which is kept
+		mux.Handle(GeminiPrefix+"/", http.StripPrefix(GeminiPrefix, s.gemini.Pipeline()))
+	}
 	mux.Handle("/audit", http.HandlerFunc(s.handleAudit))
+	mux.Handle("GET /audit/rules", http.HandlerFunc(s.handleAuditRules))
+	mux.Handle("POST /audit/test", http.HandlerFunc(s.handleAuditTest))
+	mux.Handle("POST /audit/project", http.HandlerFunc(s.handleAuditProject))
 	mux.Handle("/scan", http.HandlerFunc(s.handleScan))
-	healthHandler := func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"status":"ok"}`))
+	if s.sessions != nil {
+		HandleSessions(mux, s.sessions, s.auth)
+	}
+	if s.auth != nil && s.feedback != nil {
+		// Reports are attributed to the caller's key, so they need auth too
+		mux.Handle("POST /feedback/detection", s.auth.Middleware(s.feedback.Handler()))
 	}
+	if s.auth != nil {
+		mux.Handle("GET /auth/whoami", s.auth.WhoAmIHandler())
+	}
+	healthHandler := HealthHandler(s.vault, s.patterns, s.breakGlass)
 	mux.HandleFunc("/health", healthHandler)
 	mux.HandleFunc("/healthz", healthHandler)
-	return mux
+	mux.Handle("GET /readyz", s.readiness.Handler())
+	mux.Handle("GET /version", VersionHandler())
+	if s.capabilities != nil {
+		mux.Handle("GET "+compliance.CapabilitiesPath, compliance.CapabilitiesHandler(*s.capabilities))
+	}
+	mux.Handle("GET "+OpenAPIPath, OpenAPIHandler())
+	if s.metrics != nil {
+		var h http.Handler = s.metrics.Handler()
+		if s.config.MetricsRequireKey && s.auth != nil {
+			h = s.auth.RequireRole(auth.RoleAdmin, auth.RoleOperator, auth.RoleViewer, auth.RoleAuditor)(h)
+		}
+		mux.Handle("GET "+metrics.Path, h)
+	}
+}
+
+// adminRoutes registers the admin API behind guard. Endpoints that need a
+// role exist only with a guard.
+func (s *Server) adminRoutes(mux interface{ Handle(string, http.Handler) }, guard Guard) {
+	if s.cache != nil {
+		var stats http.Handler = s.cache.StatsHandler()
+		if guard != nil {
+			stats = guard()(stats)
+		}
+		mux.Handle("/cache/stats", stats)
+	}
+	if guard == nil {
+		return
+	}
+	admin := guard(auth.RoleAdmin)
+	if s.webhook != nil {
+		mux.Handle("/admin/webhooks/test", admin(s.webhook.TestHandler()))
+	}
+	if s.stats != nil {
+		mux.Handle("GET /admin/stats/pii", admin(s.stats.Handler()))
+	}
+	if s.feedback != nil {
+		mux.Handle("GET /admin/feedback/summary", admin(s.feedback.SummaryHandler()))
+	}
+	if s.transcripts != nil {
+		mux.Handle("GET /admin/transcripts", admin(s.transcripts.ExportHandler()))
+		mux.Handle("GET /admin/transcripts/{session}", admin(s.transcripts.SessionHandler()))
+	}
+	if s.resolver != nil {
+		mux.Handle("POST /admin/vault/resolve", guard(auth.RoleAdmin, auth.RoleAuditor)(s.resolver.Handler()))
+	}
+	mux.Handle("GET /admin/sessions", admin(http.HandlerFunc(s.handleListSessions)))
+	mux.Handle("GET /admin/sessions/{id}", admin(http.HandlerFunc(s.handleSessionInfo)))
+	mux.Handle("DELETE /admin/sessions/{id}", admin(http.HandlerFunc(s.handlePurgeSession)))
+	mux.Handle("GET /admin/status", admin(StatusHandler(s.overload, s.breakGlass, s.failures)))
+	mux.Handle("GET /admin/readiness", admin(s.readiness.StatusHandler()))
+	if s.breakGlass != nil {
+		mux.Handle("POST /admin/breakglass", admin(s.breakGlass.Handler()))
+	}
+	if s.patterns != nil {
+		mux.Handle("POST /admin/patterns/reload", admin(s.patterns.ReloadHandler()))
+	}
+}
+
+// HealthHandler answers health probes with the proxy version and the
+// vault's encryption posture, plus the pattern bundle version and pattern
+// counts when a bundle is configured and whether break-glass is active when
+// it is enabled
+func HealthHandler(v *vault.Vault, patterns *bundle.Loader, breakGlass *breakglass.Switch) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		resp := HealthResponse{Status: "ok", Version: version.Get().Version}
+		if v != nil {
+			h := v.EncryptionStatus()
+			resp.Vault = &h
+		}
+		if patterns != nil {
+			info, status := patterns.Patterns(), patterns.Status()
+			resp.Patterns, resp.Bundle = &info, &status
+		}
+		if breakGlass != nil {
+			bg := breakGlass.Status().Public()
+			resp.BreakGlass = &bg
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// HealthResponse is the body of GET /health. Patterns and Bundle are set
+// when a pattern bundle is configured, BreakGlass when break-glass is
+// enabled.
+type HealthResponse struct {
+	Status     string                  `json:"status"`
+	Version    string                  `json:"version"`
+	Vault      *vault.EncryptionStatus `json:"vault,omitempty"`
+	Patterns   *detector.PatternInfo   `json:"patterns,omitempty"`
+	Bundle     *bundle.Status          `json:"bundle,omitempty"`
+	BreakGlass *breakglass.Status      `json:"break_glass,omitempty"`
+}
+
+// VersionHandler serves GET /version with the build information
+func VersionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(version.Get())
+	}
+}
+
+// StatusResponse is the body of GET /admin/status
+type StatusResponse struct {
+	Overload   *overload.Stats    `json:"overload,omitempty"`
+	BreakGlass *breakglass.Status `json:"break_glass,omitempty"`
+	Protection *failsafe.Stats    `json:"protection,omitempty"`
+}
+
+// StatusHandler serves GET /admin/status with the counters of whichever
+// of the load shedder, break-glass switch and failure policy are set
+func StatusHandler(l *overload.Limiter, sw *breakglass.Switch, failures *failsafe.Policy) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp StatusResponse
+		if l != nil {
+			stats := l.Stats()
+			resp.Overload = &stats
+		}
+		if sw != nil {
+			bg := sw.Status()
+			resp.BreakGlass = &bg
+		}
+		if failures != nil {
+			st := failures.Stats()
+			resp.Protection = &st
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
 }
 
 // director rewrites the request to the upstream target and anonymizes PII
@@ -122,6 +649,37 @@ func (s *Server) director(req *http.Request) {
 		req.URL.Path = singleJoiningSlash(s.target.Path, req.URL.Path)
 	}
 
+	stats.Forwarded(req.Context())
+	accesslog.SetProvider(req.Context(), s.target.Host)
+	transcript.SetProvider(req.Context(), s.target.Host)
+	if s.config.SigningKey != nil {
+		// Deferred so the signature covers the anonymized body
+		defer s.sign(req)
+	}
+
+	*req = *withScanPlan(req, s.webhook, "proxy")
+	*req = *withOwner(req)
+	*req = *withProfile(req)
+	s.scanHeaders(req, extractSessionID(req))
+
+	kind := endpointOf(req)
+	if kind == endpointMetadata || kind == endpointCount && s.config.CountTokens == CountTokensPassthrough {
+		return
+	}
+
+	// File uploads stream through line by line instead of being buffered
+	if isFileUpload(req) {
+		fileUpload{
+			det:     s.detector,
+			vault:   s.vault,
+			minLen:  s.config.BinaryMinLength,
+			maxSize: s.config.MaxFileSize,
+			webhook: s.webhook,
+			source:  "proxy",
+		}.rewrite(req)
+		return
+	}
+
 	// Skip body processing for non-POST/PUT
 	if req.Body == nil || (req.Method != http.MethodPost && req.Method != http.MethodPut) {
 		return
@@ -131,47 +689,79 @@ func (s *Server) director(req *http.Request) {
 	limited := io.LimitReader(req.Body, MaxBodySize+1)
 	body, err := io.ReadAll(limited)
 	if err != nil {
-		log.Printf("[proxy] error reading request body: %v", err)
+		slog.Error("proxy: error reading request body", "error", err)
 		return
 	}
 	req.Body.Close()
 
 	if int64(len(body)) > MaxBodySize {
-		log.Printf("[proxy] request body too large: %d bytes", len(body))
+		slog.Warn("proxy: request body too large", "bytes", len(body))
 		return
 	}
 
 	sessionID := extractSessionID(req)
-	anonymized, mapping := s.detector.Anonymize(string(body))
+	anonymized, applied, mapping := anonymizeBody(req.Context(), s.detector, s.vault, sessionID,
+		req.Header.Get("Content-Type"), string(body), s.config.BinaryMinLength)
+	anonymized = s.config.Fields.apply(req.Context(), sessionID, anonymized, mapping)
+	req.Body = io.NopCloser(bytes.NewBufferString(anonymized))
+	req.ContentLength = int64(len(anonymized))
+	if kind == endpointCount {
+		// Detections are reported once, by the request the count is for
+		return
+	}
 
-	if len(mapping) > 0 {
-		log.Printf("[proxy] anonymized %d PII entities for session %s", len(mapping), sessionID)
+	categories := categoriesOf(applied)
+	stats.AddDetections(req.Context(), sessionID, categories)
+	accesslog.AddEntities(req.Context(), categories)
+	annotate.AddEntities(req.Context(), categories)
+	transcript.SetRequest(req.Context(), sessionID, anonymized)
 
-		if err := s.vault.Store(context.Background(), sessionID, mapping); err != nil {
-			log.Printf("[proxy] vault store error: %v", err)
-		}
+	if len(mapping) > 0 {
+		slog.Info("proxy: anonymized PII entities", "count", len(mapping), "session", sessionID)
 
 		if s.webhook != nil {
 			s.webhook.Emit(webhook.Event{
 				Type:      webhook.EventPIIDetected,
 				SessionID: sessionID,
-				Data:      map[string]any{"count": len(mapping), "source": "proxy"},
+				Data:      map[string]any{"count": len(mapping), "categories": categories, "source": "proxy"},
 			})
 		}
 	}
+}
 
-	req.Body = io.NopCloser(bytes.NewBufferString(anonymized))
-	req.ContentLength = int64(len(anonymized))
+// sign adds the Veil signature headers to an upstream request
+func (s *Server) sign(req *http.Request) {
+	if err := veilsig.Sign(s.config.SigningKey, req); err != nil {
+		slog.Error("proxy: request signing failed", "error", err)
+	}
 }
 
 // modifyResponse handles outbound rehydration for non-streaming responses
 func (s *Server) modifyResponse(resp *http.Response) error {
+	transcript.CaptureResponse(resp)
 	contentType := resp.Header.Get("Content-Type")
 
+	if skipsRehydration(resp.Request) {
+		return nil
+	}
+
+	// File content, such as batch results, is rehydrated as it streams
+	if isFileContent(resp.Request) {
+		if s.binding.allow(s.vault, resp.Request, filesSessionID(resp.Request, "batch_output"), "proxy") {
+			rehydrateFileContent(resp, s.vault, resp.Request.Header.Get("X-User-Role"))
+		}
+		return failsafe.Err(resp.Request.Context())
+	}
+
+	// Responses to anyone but the session's owner stay tokenized
+	sessionID := extractSessionIDFromResponse(resp)
+	if !s.binding.allow(s.vault, resp.Request, sessionID, "proxy") {
+		return failsafe.Err(resp.Request.Context())
+	}
+
 	// For SSE streams, we handle rehydration in the streaming transport
 	if strings.Contains(contentType, "text/event-stream") {
-		sessionID := extractSessionIDFromResponse(resp)
-		resp.Body = newSSERehydrator(resp.Body, s.vault, sessionID)
+		resp.Body = newSSERehydrator(resp.Request.Context(), resp.Body, s.vault, sessionID, s.config.SSEHeartbeat)
 		return nil
 	}
 
@@ -182,66 +772,74 @@ func (s *Server) modifyResponse(resp *http.Response) error {
 	}
 	resp.Body.Close()
 
-	sessionID := extractSessionIDFromResponse(resp)
 	role := resp.Request.Header.Get("X-User-Role")
 
-	rehydrated := s.rehydrateText(string(body), sessionID, role)
+	rehydrated, err := s.rehydrate(resp.Request.Context(), contentType, body, sessionID, role)
+	if err != nil {
+		return err
+	}
 
-	resp.Body = io.NopCloser(bytes.NewBufferString(rehydrated))
+	resp.Body = io.NopCloser(bytes.NewReader(rehydrated))
 	resp.ContentLength = int64(len(rehydrated))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(rehydrated)))
 
 	return nil
 }
 
-// rehydrateText replaces pseudonym tokens with real values, applying role masking
-func (s *Server) rehydrateText(text, sessionID, role string) string {
-	mappings, err := s.vault.LookupAll(context.Background(), sessionID)
+// rehydrate replaces pseudonym tokens with real values in the content
+// fields of a response body, applying role masking, and counts them into
+// the request's forensic record. It fails with failsafe.ErrUnavailable
+// when the vault fails and the failure policy is closed.
+func (s *Server) rehydrate(ctx context.Context, contentType string, body []byte, sessionID, role string) ([]byte, error) {
+	mappings, err := lookupMappings(ctx, s.vault, sessionID)
 	if err != nil || len(mappings) == 0 {
-		return text
+		return body, err
 	}
+	return rehydrateBody(contentType, body, tracedReplacer(forensic.From(ctx), mappings, tokenReplacer(mappings, role))), nil
+}
 
-	result := text
-	for token, original := range mappings {
-		replacement := original
-		if strings.EqualFold(role, "viewer") {
-			replacement = maskValue(original)
-		}
-		result = strings.ReplaceAll(result, token, replacement)
+// lookupMappings loads a session's mapping for rehydration, reporting a
+// failing vault to the failure policy. The error is failsafe.ErrUnavailable
+// when the policy refuses to answer without the mapping.
+func lookupMappings(ctx context.Context, v *vault.Vault, sessionID string) (map[string]string, error) {
+	mappings, err := v.LookupAll(ctx, sessionID)
+	if err != nil {
+		failsafe.Report(ctx, failsafe.Vault, sessionID, fmt.Errorf("lookup: %w", err))
+		return nil, failsafe.Err(ctx)
 	}
-
-	return result
+	return mappings, nil
 }
 
-// maskValue hides ~70% of a value for viewer role
-func maskValue(val string) string {
-	runes := []rune(val)
-	n := len(runes)
-	if n <= 3 {
-		return val
+// errorHandler handles proxy errors
+func (s *Server) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, failsafe.ErrUnavailable) {
+		failsafe.Deny(w)
+		return
 	}
-
-	visible := n * 30 / 100 // show ~30%
-	if visible < 2 {
-		visible = 2
+	if upstream.ClientGone(r) {
+		slog.Debug("proxy: client went away, upstream request aborted", "url", r.URL.String())
+		w.WriteHeader(upstream.StatusClientClosed)
+		return
 	}
-	front := visible / 2
-	back := visible - front
-
-	masked := make([]rune, n)
-	for i := range masked {
-		if i < front || i >= n-back {
-			masked[i] = runes[i]
-		} else {
-			masked[i] = 'x'
-		}
+	slog.Error("proxy: upstream error", "url", r.URL.String(), "error", err)
+	if errors.Is(err, errFileTooLarge) || errors.Is(err, errFileLineTooLong) {
+		http.Error(w, fmt.Sprintf(`{"error":"file_too_large","message":%q}`, err.Error()), http.StatusRequestEntityTooLarge)
+		return
 	}
-	return string(masked)
+	if upstream.IsTimeout(err) {
+		http.Error(w, `{"error":"upstream_timeout","message":"LLM provider did not respond in time"}`, http.StatusGatewayTimeout)
+		return
+	}
+	http.Error(w, `{"error":"upstream_error","message":"failed to reach LLM provider"}`, http.StatusBadGateway)
 }
 
-// errorHandler handles proxy errors
-func (s *Server) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
-	log.Printf("[proxy] upstream error: %v", err)
-	http.Error(w, `{"error":"upstream_error","message":"failed to reach LLM provider"}`, http.StatusBadGateway)
+// categoriesOf lists the category of each applied match, for stats
+func categoriesOf(matches []detector.Match) []pii.Category {
+	cats := make([]pii.Category, len(matches))
+	for i, m := range matches {
+		cats[i] = m.Category
+	}
+	return cats
 }
 
 // extractSessionID gets session ID from request header or generates one
@@ -265,102 +863,149 @@ func extractSessionIDFromResponse(resp *http.Response) string {
 
 // AnonymizeRequest returns a request modifier that anonymizes PII in the request body.
 // Used by the router to apply PII protection in multi-provider mode.
+// countTokens and fields have the same meaning as Config.CountTokens and Config.Fields.
 // If a webhook Dispatcher is provided, PII detection events will be emitted.
-func AnonymizeRequest(det *detector.Detector, v *vault.Vault, wh ...*webhook.Dispatcher) func(*http.Request) {
+func AnonymizeRequest(det Detector, v *vault.Vault, countTokens CountTokensMode, fields FieldPolicy, wh ...*webhook.Dispatcher) func(*http.Request) {
 	var dispatcher *webhook.Dispatcher
 	if len(wh) > 0 {
 		dispatcher = wh[0]
 	}
 
 	return func(req *http.Request) {
+		stats.Forwarded(req.Context())
 		if req.Body == nil || (req.Method != http.MethodPost && req.Method != http.MethodPut) {
 			return
 		}
+		kind := endpointOf(req)
+		if kind == endpointCount && countTokens == CountTokensPassthrough {
+			return
+		}
+		*req = *withScanPlan(req, dispatcher, "router")
+		*req = *withOwner(req)
+		*req = *withProfile(req)
+		if isFileUpload(req) {
+			fileUpload{det: det, vault: v, webhook: dispatcher, source: "router"}.rewrite(req)
+			return
+		}
 
 		limited := io.LimitReader(req.Body, MaxBodySize+1)
 		body, err := io.ReadAll(limited)
 		if err != nil {
-			log.Printf("[router] error reading request body: %v", err)
+			slog.Error("router: error reading request body", "error", err)
 			return
 		}
 		req.Body.Close()
 
 		if int64(len(body)) > MaxBodySize {
-			log.Printf("[router] request body too large: %d bytes", len(body))
+			slog.Warn("router: request body too large", "bytes", len(body))
 			return
 		}
 
 		sessionID := extractSessionID(req)
-		anonymized, mapping := det.Anonymize(string(body))
+		anonymized, applied, mapping := anonymizeBody(req.Context(), det, v, sessionID,
+			req.Header.Get("Content-Type"), string(body), DefaultBinaryMinLength)
+		anonymized = fields.apply(req.Context(), sessionID, anonymized, mapping)
+		req.Body = io.NopCloser(bytes.NewBufferString(anonymized))
+		req.ContentLength = int64(len(anonymized))
+		if kind == endpointCount {
+			return
+		}
 
-		if len(mapping) > 0 {
-			log.Printf("[router] anonymized %d PII entities for session %s", len(mapping), sessionID)
+		categories := categoriesOf(applied)
+		stats.AddDetections(req.Context(), sessionID, categories)
+		accesslog.AddEntities(req.Context(), categories)
+		annotate.AddEntities(req.Context(), categories)
+		transcript.SetRequest(req.Context(), sessionID, anonymized)
 
-			if err := v.Store(context.Background(), sessionID, mapping); err != nil {
-				log.Printf("[router] vault store error: %v", err)
-			}
+		if len(mapping) > 0 {
+			slog.Info("router: anonymized PII entities", "count", len(mapping), "session", sessionID)
 
 			if dispatcher != nil {
 				dispatcher.Emit(webhook.Event{
 					Type:      webhook.EventPIIDetected,
 					SessionID: sessionID,
-					Data:      map[string]any{"count": len(mapping), "source": "router"},
+					Data:      map[string]any{"count": len(mapping), "categories": categories, "source": "router"},
 				})
 			}
 		}
+	}
+}
 
-		req.Body = io.NopCloser(bytes.NewBufferString(anonymized))
-		req.ContentLength = int64(len(anonymized))
+// DetectCategories returns the router's category detector: the PII
+// categories det finds in the text of a request, before it is anonymized
+func DetectCategories(det Detector) func(text string) []string {
+	return func(text string) []string {
+		var cats []string
+		for _, c := range categoriesOf(det.Scan(text)) {
+			if !slices.Contains(cats, string(c)) {
+				cats = append(cats, string(c))
+			}
+		}
+		return cats
 	}
 }
 
 // RehydrateResponse returns a response modifier that rehydrates PII tokens in responses.
 // Used by the router to apply PII rehydration in multi-provider mode.
-func RehydrateResponse(v *vault.Vault, defaultRole string) func(*http.Response) error {
+// sseHeartbeat has the same meaning as Config.SSEHeartbeat.
+func RehydrateResponse(v *vault.Vault, defaultRole string, sseHeartbeat time.Duration, binding SessionBinding) func(*http.Response) error {
+	if sseHeartbeat == 0 {
+		sseHeartbeat = DefaultSSEHeartbeat
+	}
 	return func(resp *http.Response) error {
+		transcript.CaptureResponse(resp)
 		contentType := resp.Header.Get("Content-Type")
 
 		sessionID := extractSessionIDFromResponse(resp)
 		role := ""
+		ctx := context.Background()
 		if resp.Request != nil {
 			role = resp.Request.Header.Get("X-User-Role")
+			ctx = resp.Request.Context()
 		}
 		if role == "" {
 			role = defaultRole
 		}
 
+		if skipsRehydration(resp.Request) {
+			return nil
+		}
+		if isFileContent(resp.Request) {
+			if binding.allow(v, resp.Request, filesSessionID(resp.Request, "batch_output"), "router") {
+				rehydrateFileContent(resp, v, role)
+			}
+			return failsafe.Err(ctx)
+		}
+		if !binding.allow(v, resp.Request, sessionID, "router") {
+			return failsafe.Err(ctx)
+		}
+
 		// For SSE streams, wrap with streaming rehydrator
 		if strings.Contains(contentType, "text/event-stream") {
-			resp.Body = newSSERehydrator(resp.Body, v, sessionID)
+			resp.Body = newSSERehydrator(ctx, resp.Body, v, sessionID, sseHeartbeat)
 			return nil
 		}
 
-		// Standard JSON response — read, rehydrate, replace
+		// Standard response — read, rehydrate content fields, replace
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			return err
 		}
 		resp.Body.Close()
 
-		mappings, err := v.LookupAll(context.Background(), sessionID)
+		mappings, err := lookupMappings(ctx, v, sessionID)
 		if err != nil || len(mappings) == 0 {
 			resp.Body = io.NopCloser(bytes.NewReader(body))
-			return nil
+			return err
 		}
 
-		result := string(body)
-		for token, original := range mappings {
-			replacement := original
-			if strings.EqualFold(role, "viewer") {
-				replacement = maskValue(original)
-			}
-			result = strings.ReplaceAll(result, token, replacement)
-		}
+		result := rehydrateBody(contentType, body, tracedReplacer(forensic.From(ctx), mappings, tokenReplacer(mappings, role)))
 
-		log.Printf("[router] rehydrated %d tokens for session %s (role=%s)", len(mappings), sessionID, role)
+		slog.Info("router: rehydrated tokens", "count", len(mappings), "session", sessionID, "role", role)
 
-		resp.Body = io.NopCloser(bytes.NewBufferString(result))
+		resp.Body = io.NopCloser(bytes.NewReader(result))
 		resp.ContentLength = int64(len(result))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(result)))
 		return nil
 	}
 }
@@ -381,13 +1026,12 @@ func RoleMiddleware(defaultRole string) func(http.Handler) http.Handler {
 			case "admin", "viewer", "operator":
 				// allowed
 			default:
-				log.Printf("[middleware] rejected unknown role: %s", role)
+				slog.Warn("middleware: rejected unknown role", "role", role)
 				http.Error(w, `{"error":"forbidden","message":"unknown role"}`, http.StatusForbidden)
 				return
 			}
 
-			log.Printf("[middleware] %s %s role=%s session=%s",
-				r.Method, r.URL.Path, role, extractSessionID(r))
+			slog.Info("middleware: request", "method", r.Method, "path", r.URL.Path, "role", role, "session", extractSessionID(r))
 
 			next.ServeHTTP(w, r)
 		})
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/jsonfields"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// tokenReplacer returns a function replacing tokens with their originals,
+// masked for the viewer role
+func tokenReplacer(mappings map[string]string, role string) func(string) string {
+	pairs := make([]string, 0, 2*len(mappings))
+	for token, original := range mappings {
+		if strings.EqualFold(role, "viewer") {
+			original = pii.MaskValue(original)
+		}
+		pairs = append(pairs, token, original)
+	}
+	r := strings.NewReplacer(pairs...)
+	return r.Replace
+}
+
+// isJSONContentType reports whether a response body is JSON
+func isJSONContentType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// rehydrateBody rehydrates a non-streaming response body. JSON bodies are
+// only rehydrated in their content fields and are returned unchanged when
+// they don't parse; other content types get whole-body replacement.
+func rehydrateBody(contentType string, body []byte, replace func(string) string) []byte {
+	if !isJSONContentType(contentType) {
+		return []byte(replace(string(body)))
+	}
+	if out, ok := rehydrateJSON(body, replace); ok {
+		return out
+	}
+	return body
+}
+
+// rehydrateJSON replaces tokens in the content fields of a JSON document
+// and copies everything else byte for byte. ok is false when body is not
+// valid JSON.
+func rehydrateJSON(body []byte, replace func(string) string) (out []byte, ok bool) {
+	return jsonfields.Rewrite(body, jsonfields.IsContent, replace)
+}
+
+// rehydrateSSEEvent rehydrates one server-sent event. JSON data lines are
+// only rehydrated in their content fields, other data lines as a whole;
+// event, id and comment lines are left alone.
+func rehydrateSSEEvent(event string, replace func(string) string) string {
+	lines := strings.SplitAfter(event, "\n")
+	for i, line := range lines {
+		payload, isData := strings.CutPrefix(line, "data:")
+		if !isData {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(payload), "{") {
+			if out, ok := rehydrateJSON([]byte(payload), replace); ok {
+				lines[i] = "data:" + string(out)
+				continue
+			}
+		}
+		lines[i] = "data:" + replace(payload)
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vurakit/agentveil/internal/jsonfields"
+)
+
+var testReplace = tokenReplacer(map[string]string{
+	"[CCCD_1]":  "012345678901",
+	"[EMAIL_1]": `a"b@example.com`,
+}, "admin")
+
+func TestRehydrateJSON_OnlyContentFields(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			"openai",
+			`{"id":"chatcmpl-[CCCD_1]","system_fingerprint":"fp_[CCCD_1]","choices":[{"index":0,` +
+				`"message":{"role":"assistant","content":"CCCD: [CCCD_1]","tool_calls":[{"id":"call_[CCCD_1]","function":{"name":"lookup","arguments":"{\"id\":\"[CCCD_1]\"}"}}]},` +
+				`"logprobs":{"content":[{"token":"[CCCD_1]","logprob":-0.5}]}}]}`,
+			`{"id":"chatcmpl-[CCCD_1]","system_fingerprint":"fp_[CCCD_1]","choices":[{"index":0,` +
+				`"message":{"role":"assistant","content":"CCCD: 012345678901","tool_calls":[{"id":"call_[CCCD_1]","function":{"name":"lookup","arguments":"{\"id\":\"012345678901\"}"}}]},` +
+				`"logprobs":{"content":[{"token":"[CCCD_1]","logprob":-0.5}]}}]}`,
+		},
+		{
+			"anthropic",
+			`{"id":"msg_[CCCD_1]","content":[{"type":"text","text":"CCCD: [CCCD_1]"},{"type":"tool_use","id":"toolu_[CCCD_1]","input":{"cccd":"[CCCD_1]","nested":["[CCCD_1]"]}}],"stop_reason":"end_turn"}`,
+			`{"id":"msg_[CCCD_1]","content":[{"type":"text","text":"CCCD: 012345678901"},{"type":"tool_use","id":"toolu_[CCCD_1]","input":{"cccd":"012345678901","nested":["012345678901"]}}],"stop_reason":"end_turn"}`,
+		},
+		{
+			"gemini",
+			`{"candidates":[{"content":{"parts":[{"text":"CCCD: [CCCD_1]"}],"role":"model"},"citationMetadata":{"uri":"[CCCD_1]"}}],"responseId":"[CCCD_1]"}`,
+			`{"candidates":[{"content":{"parts":[{"text":"CCCD: 012345678901"}],"role":"model"},"citationMetadata":{"uri":"[CCCD_1]"}}],"responseId":"[CCCD_1]"}`,
+		},
+		{
+			"provider error",
+			`{"error":{"message":"Invalid value '[CCCD_1]' at messages[0].content","type":"invalid_request_error"}}`,
+			`{"error":{"message":"Invalid value '[CCCD_1]' at messages[0].content","type":"invalid_request_error"}}`,
+		},
+		{
+			"escaping and layout kept",
+			"{\n  \"content\": [ {\"text\": \"mail [EMAIL_1] <ok>\"} ],\n  \"id\": \"[EMAIL_1]\"\n}",
+			"{\n  \"content\": [ {\"text\": \"mail a\\\"b@example.com <ok>\"} ],\n  \"id\": \"[EMAIL_1]\"\n}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(rehydrateBody("application/json; charset=utf-8", []byte(tt.body), testReplace))
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Error("result is not valid JSON")
+			}
+		})
+	}
+}
+
+func TestRehydrateJSON_SpecialCharacters(t *testing.T) {
+	mappings := map[string]string{
+		"[PERSON_1]":  `Trần "Bo" Văn`,
+		"[ADDRESS_1]": `C:\Users\an\"q"`,
+		"[EMAIL_1]":   "ngọc.ánh😀@ví-dụ.vn",
+	}
+	const text = "[PERSON_1] lives at [ADDRESS_1], mail [EMAIL_1]"
+	shapes := map[string]struct {
+		body string
+		text func(map[string]any) any
+	}{
+		"openai": {`{"choices":[{"message":{"role":"assistant","content":` + string(jsonfields.MarshalString(text)) + `}}]}`, func(m map[string]any) any {
+			return m["choices"].([]any)[0].(map[string]any)["message"].(map[string]any)["content"]
+		}},
+		"anthropic": {`{"content":[{"type":"text","text":` + string(jsonfields.MarshalString(text)) + `}]}`, func(m map[string]any) any {
+			return m["content"].([]any)[0].(map[string]any)["text"]
+		}},
+		"gemini": {`{"candidates":[{"content":{"parts":[{"text":` + string(jsonfields.MarshalString(text)) + `}]}}]}`, func(m map[string]any) any {
+			return m["candidates"].([]any)[0].(map[string]any)["content"].(map[string]any)["parts"].([]any)[0].(map[string]any)["text"]
+		}},
+	}
+	for _, role := range []string{"admin", "viewer"} {
+		replace := tokenReplacer(mappings, role)
+		for name, shape := range shapes {
+			got := rehydrateBody("application/json", []byte(shape.body), replace)
+			var doc map[string]any
+			if err := json.Unmarshal(got, &doc); err != nil {
+				t.Errorf("%s/%s: invalid JSON %s: %v", role, name, got, err)
+				continue
+			}
+			if want := replace(text); shape.text(doc) != want {
+				t.Errorf("%s/%s: text = %q, want %q", role, name, shape.text(doc), want)
+			}
+		}
+
+		event := rehydrateSSEEvent(`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":`+string(jsonfields.MarshalString(text))+"}}\n\n", replace)
+		var delta struct {
+			Delta struct{ Text string } `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(event), "data: ")), &delta); err != nil || delta.Delta.Text != replace(text) {
+			t.Errorf("%s/stream: %q, %v", role, event, err)
+		}
+	}
+}
+
+func TestRehydrateBody_NonJSON(t *testing.T) {
+	if got := string(rehydrateBody("text/plain", []byte("CCCD [CCCD_1]"), testReplace)); got != "CCCD 012345678901" {
+		t.Errorf("plain text should be rehydrated as a whole, got %q", got)
+	}
+	// A JSON content type whose body doesn't parse is left alone
+	broken := `{"choices":[{"message":{"content":"[CCCD_1]"`
+	if got := string(rehydrateBody("application/json", []byte(broken), testReplace)); got != broken {
+		t.Errorf("invalid JSON should pass through, got %q", got)
+	}
+}
+
+func TestRehydrateSSEEvent(t *testing.T) {
+	event := "id: [CCCD_1]\n" +
+		"event: content_block_delta\n" +
+		`data: {"id":"chatcmpl-[CCCD_1]","choices":[{"delta":{"content":"is [CCCD_1]"}}]}` + "\n\n"
+	want := "id: [CCCD_1]\n" +
+		"event: content_block_delta\n" +
+		`data: {"id":"chatcmpl-[CCCD_1]","choices":[{"delta":{"content":"is 012345678901"}}]}` + "\n\n"
+	if got := rehydrateSSEEvent(event, testReplace); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	anthropic := `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"[CCCD_1]"}}` + "\n\n"
+	if got := rehydrateSSEEvent(anthropic, testReplace); !strings.Contains(got, `"text":"012345678901"`) {
+		t.Errorf("anthropic delta not rehydrated: %s", got)
+	}
+
+	if got := rehydrateSSEEvent("data: plain [CCCD_1]\n\n", testReplace); got != "data: plain 012345678901\n\n" {
+		t.Errorf("non-JSON data should be rehydrated as a whole, got %q", got)
+	}
+}
+
+func TestProxy_UpstreamErrorNotRehydrated(t *testing.T) {
+	const errBody = `{"error":{"message":"content '[CCCD_1]' was flagged","code":"content_filter"}}`
+	srv, upstream := setupTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(errBody))
+	})
+	defer upstream.Close()
+	srv.vault.Store(context.Background(), "err-session", map[string]string{"[CCCD_1]": "012345678901"})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[]}`))
+	req.Header.Set("X-Session-ID", "err-session")
+	req.Header.Set("X-User-Role", "admin")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+
+	body, _ := io.ReadAll(rec.Result().Body)
+	if rec.Code != http.StatusBadRequest || string(body) != errBody {
+		t.Errorf("upstream error should reach the client unchanged, got %d %s", rec.Code, body)
+	}
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/ratelimit"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// DefaultResolveRate is the number of vault resolutions allowed per key per
+// minute unless configured otherwise
+const DefaultResolveRate = 10
+
+// ResolveRequest is the JSON body for POST /admin/vault/resolve
+type ResolveRequest struct {
+	SessionID string `json:"session_id"`
+	Token     string `json:"token"`
+	Reason    string `json:"reason"`
+}
+
+// ResolveResponse returns the original value, masked for the auditor role
+type ResolveResponse struct {
+	SessionID string `json:"session_id"`
+	Token     string `json:"token"`
+	Value     string `json:"value"`
+	Masked    bool   `json:"masked"`
+}
+
+// Resolver lets support staff turn a token seen in logs or tickets back
+// into its original value. Every attempt, including refused ones, is
+// written to the audit log with the caller's key, the token and the reason.
+type Resolver struct {
+	vault   *vault.Vault
+	audit   *accesslog.Logger
+	limiter *ratelimit.Limiter
+}
+
+// NewResolver creates a Resolver allowing perMinute resolutions per key
+// (DefaultResolveRate if zero), counted in backend (in memory if nil). A nil
+// audit logger writes audit lines to stdout so resolutions are never
+// unrecorded.
+func NewResolver(v *vault.Vault, audit *accesslog.Logger, perMinute int, backend ratelimit.Backend) *Resolver {
+	if perMinute <= 0 {
+		perMinute = DefaultResolveRate
+	}
+	if audit == nil {
+		audit = accesslog.NewWithWriter(os.Stdout, accesslog.FieldsCommon)
+	}
+	limiter := ratelimit.New(ratelimit.Config{
+		Name:              "vault_resolve",
+		RequestsPerMinute: perMinute,
+		Key:               ratelimit.ByAPIKey,
+		Backend:           backend,
+	})
+	return &Resolver{vault: v, audit: audit, limiter: limiter}
+}
+
+// Limiter returns the per-key limiter, e.g. to hook rate limit events
+func (rs *Resolver) Limiter() *ratelimit.Limiter {
+	return rs.limiter
+}
+
+// Close stops the rate limiter
+func (rs *Resolver) Close() {
+	rs.limiter.Close()
+}
+
+// Handler serves POST /admin/vault/resolve. It expects to run behind
+// auth.Manager.RequireRole(auth.RoleAdmin, auth.RoleAuditor).
+func (rs *Resolver) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req ResolveRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, `{"error":"bad_request","message":"invalid JSON body"}`, http.StatusBadRequest)
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.SessionID == "" || req.Token == "" || req.Reason == "" {
+			http.Error(w, `{"error":"bad_request","message":"session_id, token and reason are required"}`, http.StatusBadRequest)
+			return
+		}
+
+		keyID := r.Header.Get("X-Veil-Key-ID")
+		role := auth.Role(r.Header.Get("X-User-Role"))
+		event := accesslog.AuditEvent{
+			Event:     "vault_resolve",
+			RequestID: w.Header().Get("X-Request-ID"),
+			KeyID:     keyID,
+			Role:      string(role),
+			SessionID: req.SessionID,
+			Token:     req.Token,
+			Reason:    req.Reason,
+		}
+
+		if d := rs.limiter.Check(r.Context(), ratelimit.ByAPIKey(r)); !d.Allowed {
+			event.Outcome = "rate_limited"
+			rs.audit.Audit(event)
+			rs.limiter.Reject(w, d)
+			return
+		}
+
+		value, err := rs.vault.Lookup(r.Context(), req.SessionID, req.Token)
+		if errors.Is(err, redis.Nil) {
+			event.Outcome = "not_found"
+			rs.audit.Audit(event)
+			http.Error(w, `{"error":"not_found","message":"token not found in session"}`, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			event.Outcome = "error"
+			rs.audit.Audit(event)
+			http.Error(w, `{"error":"vault_unavailable","message":"vault lookup failed"}`, http.StatusServiceUnavailable)
+			return
+		}
+
+		resp := ResolveResponse{SessionID: req.SessionID, Token: req.Token, Value: value}
+		event.Outcome = "resolved"
+		if role != auth.RoleAdmin {
+			resp.Value = pii.MaskValue(value)
+			resp.Masked = true
+			event.Outcome = "resolved_masked"
+		}
+		rs.audit.Audit(event)
+		json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -20,6 +20,12 @@ type ScanEntity struct {
 	Start      int    `json:"start"`
 	End        int    `json:"end"`
 	Confidence int    `json:"confidence"`
+	Line       int    `json:"line"`   // 1-based
+	Column     int    `json:"column"` // 1-based, in runes
+	EntityID   string `json:"entity_id"`
+	// Source and Rule name the pattern, for POST /feedback/detection
+	Source string `json:"source,omitempty"`
+	Rule   string `json:"rule,omitempty"`
 }
 
 // ScanResponse is the JSON response for /scan
@@ -30,7 +36,7 @@ type ScanResponse struct {
 
 // HandleScan returns an http.HandlerFunc for POST /scan (standalone, no Server needed).
 // Used in router mode where /scan is registered outside the Server handler chain.
-func HandleScan(det *detector.Detector) http.HandlerFunc {
+func HandleScan(det Detector) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		srv := &Server{detector: det}
 		srv.handleScan(w, r)
@@ -62,7 +68,7 @@ func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	matches := s.detector.Scan(req.Text)
+	matches := detector.WithPositions(req.Text, s.detector.Scan(req.Text))
 
 	entities := make([]ScanEntity, 0, len(matches))
 	for _, m := range matches {
@@ -72,6 +78,11 @@ func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
 			Start:      m.Start,
 			End:        m.End,
 			Confidence: m.Confidence,
+			Line:       m.Line,
+			Column:     m.Column,
+			EntityID:   m.EntityID,
+			Source:     string(m.Source),
+			Rule:       m.Rule,
 		})
 	}
 
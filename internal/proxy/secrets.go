@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/webhook"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// SecretBlockedResponse is the 422 body of a request rejected for a secret.
+// It names the categories, never the values.
+type SecretBlockedResponse struct {
+	Error      string         `json:"error"`
+	Message    string         `json:"message"`
+	Categories []pii.Category `json:"categories"`
+}
+
+// BlockSecrets returns middleware that rejects requests whose body holds a
+// secret the detector's policy blocks (detector.ActionBlock) with 422, before
+// anything is stored in the vault or sent upstream. Masking leaves part of a
+// secret in the provider's logs; a rejected request leaves none. File
+// uploads stream through unbuffered, so their blocked secrets are stripped
+// instead. minLen has the meaning of Config.BinaryMinLength and source
+// names the pipeline in webhook events.
+func BlockSecrets(det Detector, wh *webhook.Dispatcher, minLen int, source string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || (r.Method != http.MethodPost && r.Method != http.MethodPut) || isFileUpload(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			contentType := r.Header.Get("Content-Type")
+			if isBinaryContentType(contentType) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body, err := io.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if err != nil || int64(len(body)) > MaxBodySize {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			masked, _ := maskBinary(contentType, string(body), minLen)
+			blocked := blockedCategories(det.Scan(masked))
+			if len(blocked) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			sessionID := extractSessionID(r)
+			slog.Warn(source+": blocked request carrying secrets", "categories", blocked, "session", sessionID)
+			accesslog.AddEntities(r.Context(), blocked)
+			if wh != nil {
+				wh.Emit(webhook.Event{
+					Type:      webhook.EventPIIHighRisk,
+					SessionID: sessionID,
+					Data:      map[string]any{"source": source, "categories": blocked, "action": "blocked"},
+				})
+			}
+			names := make([]string, len(blocked))
+			for i, cat := range blocked {
+				names[i] = string(cat)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(SecretBlockedResponse{
+				Error:      "secret_detected",
+				Message:    fmt.Sprintf("request contains a secret (%s); remove it and retry", strings.Join(names, ", ")),
+				Categories: blocked,
+			})
+		})
+	}
+}
+
+// blockedCategories returns the distinct categories of matches the policy
+// blocks, sorted
+func blockedCategories(matches []detector.Match) []pii.Category {
+	var cats []pii.Category
+	for _, m := range matches {
+		if m.Action == detector.ActionBlock && !slices.Contains(cats, m.Category) {
+			cats = append(cats, m.Category)
+		}
+	}
+	slices.Sort(cats)
+	return cats
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/auth"
+	"github.com/vurakit/agentveil/internal/session"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// SessionSummary is one vault session in GET /admin/sessions. Sessions are
+// described by counts only; original values are never returned.
+type SessionSummary struct {
+	ID         string         `json:"id"`
+	Entries    int64          `json:"entries"`
+	TTLSeconds int64          `json:"ttl_seconds"` // -1 without expiry
+	Categories map[string]int `json:"categories,omitempty"`
+	DeepScan   bool           `json:"deep_scan,omitempty"` // promoted to every pattern
+}
+
+// SessionList is a page of GET /admin/sessions
+type SessionList struct {
+	Sessions   []SessionSummary `json:"sessions"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// defaultSessionPage is the page size when no limit is given
+const defaultSessionPage = 100
+
+func summaryOf(s vault.SessionSummary) SessionSummary {
+	ttl := int64(-1)
+	if s.TTL >= 0 {
+		ttl = int64(s.TTL / time.Second)
+	}
+	return SessionSummary{ID: s.ID, Entries: s.Entries, TTLSeconds: ttl}
+}
+
+// handleListSessions serves GET /admin/sessions?cursor=...&limit=...
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	limit := defaultSessionPage
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, `{"error":"bad_request","message":"limit must be a positive integer"}`, http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	page, next, err := s.vault.ListSessions(r.Context(), r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, vault.ErrInvalidCursor) {
+		http.Error(w, `{"error":"bad_request","message":"invalid cursor"}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"vault_unavailable","message":"session listing failed"}`, http.StatusServiceUnavailable)
+		return
+	}
+	list := SessionList{Sessions: make([]SessionSummary, len(page)), NextCursor: next}
+	for i, sess := range page {
+		list.Sessions[i] = summaryOf(sess)
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleSessionInfo serves GET /admin/sessions/{id}
+func (s *Server) handleSessionInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	info, err := s.vault.SessionInfo(r.Context(), r.PathValue("id"))
+	if errors.Is(err, vault.ErrSessionNotFound) {
+		http.Error(w, `{"error":"not_found","message":"session not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"vault_unavailable","message":"session lookup failed"}`, http.StatusServiceUnavailable)
+		return
+	}
+	summary := summaryOf(info.SessionSummary)
+	summary.Categories = info.Categories
+	summary.DeepScan = info.Deep
+	json.NewEncoder(w).Encode(summary)
+}
+
+// SessionErasure is the response of DELETE /admin/sessions/{id}
+type SessionErasure struct {
+	ID     string `json:"id"`
+	Erased int64  `json:"erased"` // tokens removed, 0 when the session was unknown
+}
+
+// handlePurgeSession serves DELETE /admin/sessions/{id}, the right to
+// erasure: the session's mappings are removed at once instead of at expiry
+func (s *Server) handlePurgeSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	erased, err := s.vault.Erase(r.Context(), id)
+	if err != nil {
+		http.Error(w, `{"error":"vault_unavailable","message":"session purge failed"}`, http.StatusServiceUnavailable)
+		return
+	}
+	keyID := r.Header.Get("X-Veil-Key-ID")
+	slog.Info("admin: purged session", "session", id, "erased", erased, "key_id", keyID)
+	s.binding.audit(accesslog.AuditEvent{
+		Event:     "session_erase",
+		KeyID:     keyID,
+		Role:      r.Header.Get("X-User-Role"),
+		SessionID: id,
+		Reason:    strconv.FormatInt(erased, 10) + " tokens erased",
+		Outcome:   "erased",
+	})
+	if s.webhook != nil {
+		s.webhook.Emit(webhook.Event{
+			Type:      webhook.EventDataErased,
+			SessionID: id,
+			Data:      map[string]any{"erased": erased, "key_id": keyID},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionErasure{ID: id, Erased: erased})
+}
+
+// BeginSessionRequest is the optional body of POST /v1/sessions
+type BeginSessionRequest struct {
+	// Canary asks for a canary token to embed in the system prompt; a
+	// request that contains it later is blocked as a prompt leak
+	Canary bool `json:"canary,omitempty"`
+}
+
+// HandleSessions registers the explicit session endpoints on mux, behind
+// am when it is set, for handlers built without a Server such as router
+// mode. Sessions belong to the caller's key, as vault sessions do.
+func HandleSessions(mux interface{ Handle(string, http.Handler) }, m *session.Manager, am *auth.Manager) {
+	srv := &Server{sessions: m}
+	authed := func(h http.HandlerFunc) http.Handler {
+		if am != nil {
+			return am.Middleware(h)
+		}
+		return h
+	}
+	mux.Handle("POST /v1/sessions", authed(srv.handleBeginSession))
+	mux.Handle("GET /v1/sessions/{id}/summary", authed(srv.handleSessionTotals))
+	mux.Handle("DELETE /v1/sessions/{id}", authed(srv.handleEndSession))
+}
+
+// handleBeginSession serves POST /v1/sessions
+func (s *Server) handleBeginSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req BeginSessionRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error":"bad_request","message":"invalid JSON body"}`, http.StatusBadRequest)
+		return
+	}
+	sess, err := s.sessions.Begin(r.Context(), requestOwner(r), req.Canary)
+	if err != nil {
+		slog.Error("proxy: begin session failed", "error", err)
+		http.Error(w, `{"error":"vault_unavailable","message":"session could not be created"}`, http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sess)
+}
+
+// handleSessionTotals serves GET /v1/sessions/{id}/summary
+func (s *Server) handleSessionTotals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	totals, ok := s.ownSession(w, r)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(totals)
+}
+
+// handleEndSession serves DELETE /v1/sessions/{id}
+func (s *Server) handleEndSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, ok := s.ownSession(w, r); !ok {
+		return
+	}
+	totals, err := s.sessions.End(r.Context(), r.PathValue("id"))
+	if !s.sessionFound(w, err) {
+		return
+	}
+	json.NewEncoder(w).Encode(totals)
+}
+
+// ownSession looks up the explicit session in the path and checks it was
+// begun by the caller or the caller holds an admin key. Other callers get
+// 404, so session IDs can't be probed.
+func (s *Server) ownSession(w http.ResponseWriter, r *http.Request) (session.Totals, bool) {
+	totals, err := s.sessions.Summary(r.Context(), r.PathValue("id"))
+	if !s.sessionFound(w, err) {
+		return session.Totals{}, false
+	}
+	admin := r.Header.Get("X-Veil-Key-ID") != "" && r.Header.Get("X-User-Role") == string(auth.RoleAdmin)
+	if totals.Owner != requestOwner(r) && !admin {
+		slog.Warn("proxy: session access denied", "session", totals.ID, "caller", requestOwner(r))
+		http.Error(w, `{"error":"not_found","message":"session not found"}`, http.StatusNotFound)
+		return session.Totals{}, false
+	}
+	return totals, true
+}
+
+// sessionFound writes the error response for a failed session lookup
+func (s *Server) sessionFound(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, session.ErrNotFound):
+		http.Error(w, `{"error":"not_found","message":"session not found"}`, http.StatusNotFound)
+		return false
+	case err != nil:
+		slog.Error("proxy: session lookup failed", "error", err)
+		http.Error(w, `{"error":"vault_unavailable","message":"session lookup failed"}`, http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
@@ -5,29 +5,99 @@ import (
 	"bytes"
 	"context"
 	"io"
-	"log"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/vurakit/agentveil/internal/forensic"
 	"github.com/vurakit/agentveil/internal/vault"
 )
 
-// sseRehydrator wraps an SSE response body and rehydrates PII tokens line-by-line
+// DefaultSSEHeartbeat is how long an SSE stream may stay silent before a
+// ": ping" comment is injected to keep idle-timeout load balancers happy
+const DefaultSSEHeartbeat = 15 * time.Second
+
+// sseHeartbeat is the comment written while the upstream is silent. SSE
+// clients ignore comment lines.
+var sseHeartbeat = []byte(": ping\n\n")
+
+// sseChunk is one complete event (or the trailing partial data) read from upstream
+type sseChunk struct {
+	data []byte
+	err  error
+}
+
+// sseRehydrator wraps an SSE response body and rehydrates PII tokens one
+// complete event at a time. Each Read returns as soon as an event is
+// available, so with an immediate-flush ReverseProxy every event reaches
+// the client without waiting for the next one.
 type sseRehydrator struct {
-	reader    *bufio.Scanner
+	ctx       context.Context
+	body      io.ReadCloser
 	vault     *vault.Vault
 	sessionID string
 	mappings  map[string]string
+	replace   func(string) string
 	loaded    bool
-	buf       *bytes.Buffer
-	done      bool
+	heartbeat time.Duration
+	record    *forensic.Record
+
+	events    chan sseChunk
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	buf bytes.Buffer
+	err error // terminal error, returned once buf is drained
 }
 
-func newSSERehydrator(body io.ReadCloser, v *vault.Vault, sessionID string) io.ReadCloser {
-	return &sseRehydrator{
-		reader:    bufio.NewScanner(body),
+// newSSERehydrator starts reading events from body in the background.
+// heartbeat <= 0 disables ping injection. Rehydrated tokens are counted
+// into the forensic record of ctx, the request's context, if it has one.
+func newSSERehydrator(ctx context.Context, body io.ReadCloser, v *vault.Vault, sessionID string, heartbeat time.Duration) io.ReadCloser {
+	s := &sseRehydrator{
+		ctx:       ctx,
+		body:      body,
 		vault:     v,
 		sessionID: sessionID,
-		buf:       &bytes.Buffer{},
+		heartbeat: heartbeat,
+		record:    forensic.From(ctx),
+		events:    make(chan sseChunk),
+		closed:    make(chan struct{}),
+	}
+	go s.readEvents()
+	return s
+}
+
+// readEvents splits the upstream body into events (terminated by a blank
+// line) and hands them to Read
+func (s *sseRehydrator) readEvents() {
+	scanner := bufio.NewScanner(s.body)
+	var event bytes.Buffer
+	for scanner.Scan() {
+		event.Write(scanner.Bytes())
+		event.WriteByte('\n')
+		if len(scanner.Bytes()) > 0 {
+			continue
+		}
+		if !s.send(sseChunk{data: bytes.Clone(event.Bytes())}) {
+			return
+		}
+		event.Reset()
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	s.send(sseChunk{data: event.Bytes(), err: err})
+}
+
+func (s *sseRehydrator) send(c sseChunk) bool {
+	select {
+	case s.events <- c:
+		return true
+	case <-s.closed:
+		return false
 	}
 }
 
@@ -36,46 +106,64 @@ func (s *sseRehydrator) Read(p []byte) (int, error) {
 	if s.buf.Len() > 0 {
 		return s.buf.Read(p)
 	}
-
-	if s.done {
-		return 0, io.EOF
+	if s.err != nil {
+		return 0, s.err
 	}
 
-	// Lazy-load mappings on first read
+	// Lazy-load mappings on first read. Under a closed failure policy a
+	// failing vault ends the stream before any event is sent.
 	if !s.loaded {
-		mappings, err := s.vault.LookupAll(context.Background(), s.sessionID)
+		mappings, err := lookupMappings(s.ctx, s.vault, s.sessionID)
 		if err != nil {
-			log.Printf("[sse] failed to load vault mappings: %v", err)
+			s.err = err
+			return 0, err
 		}
 		s.mappings = mappings
 		s.loaded = true
 	}
 
-	// Read next SSE line
-	if !s.reader.Scan() {
-		s.done = true
-		if err := s.reader.Err(); err != nil {
-			return 0, err
-		}
-		return 0, io.EOF
+	var ping <-chan time.Time
+	if s.heartbeat > 0 {
+		t := time.NewTimer(s.heartbeat)
+		defer t.Stop()
+		ping = t.C
 	}
 
-	line := s.reader.Text()
-
-	// Rehydrate any PII tokens found in this SSE line
-	if len(s.mappings) > 0 && strings.Contains(line, "[") {
-		for token, original := range s.mappings {
-			line = strings.ReplaceAll(line, token, original)
-		}
+	select {
+	case c := <-s.events:
+		s.buf.WriteString(s.rehydrate(c.data))
+		s.err = c.err
+	case <-ping:
+		s.buf.Write(sseHeartbeat)
+	case <-s.ctx.Done():
+		// The client went away; Close stops the reader
+		s.err = s.ctx.Err()
 	}
 
-	// Write the processed line + newline to buffer
-	s.buf.WriteString(line)
-	s.buf.WriteByte('\n')
-
+	if s.buf.Len() == 0 {
+		return 0, s.err
+	}
 	return s.buf.Read(p)
 }
 
+// rehydrate replaces PII tokens found in the content fields of one event
+func (s *sseRehydrator) rehydrate(data []byte) string {
+	event := string(data)
+	if len(s.mappings) > 0 && strings.Contains(event, "[") {
+		if s.replace == nil {
+			s.replace = tracedReplacer(s.record, s.mappings, tokenReplacer(s.mappings, ""))
+		}
+		event = rehydrateSSEEvent(event, s.replace)
+	}
+	return event
+}
+
+// Close stops the background reader and closes the upstream body
 func (s *sseRehydrator) Close() error {
-	return nil
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		err = s.body.Close()
+	})
+	return err
 }
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readSSELines reads the stream and records when each non-empty line arrived
+func readSSELines(t *testing.T, url string) ([]string, []time.Duration) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/v1/chat/completions", strings.NewReader(`{"stream":true}`))
+	req.Header.Set("X-Session-ID", "slow-session")
+	req.Header.Set("X-User-Role", "admin")
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var lines []string
+	var arrivals []time.Duration
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		lines = append(lines, scanner.Text())
+		arrivals = append(arrivals, time.Since(start))
+	}
+	return lines, arrivals
+}
+
+func TestProxy_SSESlowUpstreamStreamsPromptly(t *testing.T) {
+	const gap = 2 * time.Second
+	srv, upstream := setupTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		flusher := w.(http.Flusher)
+		for i := 0; i < 3; i++ {
+			if i > 0 {
+				time.Sleep(gap)
+			}
+			w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"part [EMAIL_1]\"}}]}\n\n"))
+			flusher.Flush()
+		}
+	})
+	defer upstream.Close()
+	srv.config.SSEHeartbeat = -1
+
+	srv.vault.Store(context.Background(), "slow-session", map[string]string{
+		"[EMAIL_1]": "test@example.com",
+	})
+
+	front := httptest.NewServer(srv.Handler())
+	defer front.Close()
+
+	lines, arrivals := readSSELines(t, front.URL)
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 events, got %d: %v", len(lines), lines)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, "test@example.com") {
+			t.Errorf("event %d not rehydrated: %s", i, line)
+		}
+		// Each event must arrive before the upstream sends the next one
+		if deadline := time.Duration(i)*gap + gap/2; arrivals[i] > deadline {
+			t.Errorf("event %d arrived after %v, want before %v (buffered?)", i, arrivals[i], deadline)
+		}
+	}
+}
+
+func TestProxy_SSEHeartbeatWhileUpstreamSilent(t *testing.T) {
+	srv, upstream := setupTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(350 * time.Millisecond)
+		w.Write([]byte("data: [DONE]\n\n"))
+	})
+	defer upstream.Close()
+	srv.config.SSEHeartbeat = 100 * time.Millisecond
+
+	front := httptest.NewServer(srv.Handler())
+	defer front.Close()
+
+	lines, _ := readSSELines(t, front.URL)
+	pings := 0
+	for _, line := range lines {
+		if line == ": ping" {
+			pings++
+		}
+	}
+	if pings < 2 {
+		t.Errorf("expected at least 2 heartbeats during 350ms of silence, got %d: %v", pings, lines)
+	}
+	if len(lines) == 0 || lines[len(lines)-1] != "data: [DONE]" {
+		t.Errorf("expected stream to end with the upstream event, got %v", lines)
+	}
+}
+
+// goroutinesRunning counts the goroutines whose stack mentions fn
+func goroutinesRunning(fn string) int {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	return strings.Count(string(buf), fn)
+}
+
+func TestProxy_SSEClientCancelClosesUpstream(t *testing.T) {
+	upstreamClosed := make(chan struct{})
+	srv, upstream := setupTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"first\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		io.ReadAll(r.Body)
+		// A long generation: only ends when the proxy hangs up
+		<-r.Context().Done()
+		close(upstreamClosed)
+	})
+	defer upstream.Close()
+	srv.config.SSEHeartbeat = -1
+
+	front := httptest.NewServer(srv.Handler())
+	defer front.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, front.URL+"/v1/chat/completions", strings.NewReader(`{"stream":true}`))
+	req.Header.Set("X-Session-ID", "cancel-session")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || !strings.Contains(line, "first") {
+		t.Fatalf("first event = %q, %v", line, err)
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case <-upstreamClosed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream request still open 2s after the client went away")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for goroutinesRunning("(*sseRehydrator).readEvents") > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("SSE reader goroutine leaked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// tieredDetector is implemented by detectors that can skip their expensive
+// patterns and apply detector profiles. A remote detector service always
+// scans every pattern with its own configuration.
+type tieredDetector interface {
+	Tiers() detector.TierConfig
+	Profile(name string) (detector.Profile, bool)
+	AnonymizeProfile(text string, existing map[string]string, tier detector.Tier, profile string) (string, []detector.Match)
+}
+
+// scanPlan decides the scan tier of each session once per request, so every
+// part of a request, such as the chunks of an uploaded file, gets the same
+// tier
+type scanPlan struct {
+	keyID, role string
+	webhook     *webhook.Dispatcher
+	source      string
+
+	counting bool // a token counting request, see CountTokensAnonymize
+
+	mu             sync.Mutex
+	sessions       map[string]*sessionScan
+	tokensReported bool // a session.token_injection event was emitted
+}
+
+// sessionScan is one session's tier. promoted is only touched under the
+// session's lock, see anonymize.
+type sessionScan struct {
+	tier     detector.Tier
+	sampled  bool // deep by sampling, so deep-only findings promote the session
+	promoted bool
+}
+
+type scanPlanKey struct{}
+
+// withScanPlan attaches a scan plan for req to its context
+func withScanPlan(req *http.Request, wh *webhook.Dispatcher, source string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), scanPlanKey{}, &scanPlan{
+		keyID:    req.Header.Get("X-Veil-Key-ID"),
+		role:     req.Header.Get("X-User-Role"),
+		webhook:  wh,
+		source:   source,
+		counting: endpointOf(req) == endpointCount,
+		sessions: make(map[string]*sessionScan),
+	}))
+}
+
+// sessionTier returns the scan tier of a session for the request of ctx.
+// Sensitive sessions, keys and roles and promoted sessions are always deep,
+// others are deep for the configured sample of requests.
+func sessionTier(ctx context.Context, tiers detector.TierConfig, v *vault.Vault, sessionID string) *sessionScan {
+	plan, _ := ctx.Value(scanPlanKey{}).(*scanPlan)
+	if plan == nil {
+		plan = &scanPlan{sessions: make(map[string]*sessionScan)}
+	}
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+	if sc, ok := plan.sessions[sessionID]; ok {
+		return sc
+	}
+
+	sc := &sessionScan{tier: detector.TierFast}
+	switch {
+	case tiers.Sensitive(sessionID, plan.keyID, plan.role):
+		sc.tier = detector.TierDeep
+	case isDeep(ctx, v, sessionID):
+		sc.tier = detector.TierDeep
+	case plan.counting && tiers.DeepSamplePercent > 0:
+		// A count scans deep and promotes like a sample, so the request it
+		// counts for finds the same values whichever tier it draws
+		sc.tier, sc.sampled = detector.TierDeep, true
+	case tiers.Sample():
+		sc.tier, sc.sampled = detector.TierDeep, true
+	}
+	plan.sessions[sessionID] = sc
+	return sc
+}
+
+// isDeep reports whether a session was promoted. A vault error scans deep.
+func isDeep(ctx context.Context, v *vault.Vault, sessionID string) bool {
+	deep, err := v.IsDeep(ctx, sessionID)
+	if err != nil {
+		slog.Error("proxy: vault deep scan lookup error", "session", sessionID, "error", err)
+		return true
+	}
+	return deep
+}
+
+// anonymizeTiered is anonymize's detector call for tiered detectors, made
+// with the request's detector profile. When a sampled deep scan finds
+// categories the fast tier skips, the session is promoted to deep scanning
+// and a coverage gap event is emitted.
+func anonymizeTiered(ctx context.Context, det tieredDetector, v *vault.Vault, sessionID, text string, existing map[string]string) (string, []detector.Match) {
+	profile := detector.ProfileFromContext(ctx)
+	if _, ok := det.Profile(profile); !ok && profile != "" {
+		slog.Warn("proxy: unknown detector profile, scanning with the default settings", "profile", profile)
+	}
+	tiers := det.Tiers()
+	if !tiers.Sampled() {
+		return det.AnonymizeProfile(text, existing, detector.TierDeep, profile)
+	}
+	sc := sessionTier(ctx, tiers, v, sessionID)
+	anonymized, applied := det.AnonymizeProfile(text, existing, sc.tier, profile)
+	if !sc.sampled || sc.promoted {
+		return anonymized, applied
+	}
+	missed := tiers.DeepOnly(applied)
+	if len(missed) == 0 {
+		return anonymized, applied
+	}
+
+	sc.promoted = true
+	promoted, err := v.PromoteDeep(ctx, sessionID)
+	if err != nil {
+		failsafe.Report(ctx, failsafe.Vault, sessionID, fmt.Errorf("deep scan promotion: %w", err))
+		return anonymized, applied
+	}
+	if !promoted {
+		return anonymized, applied
+	}
+	slog.Warn("proxy: session promoted to deep scanning", "session", sessionID, "missed", missed)
+	if plan, _ := ctx.Value(scanPlanKey{}).(*scanPlan); plan != nil && plan.webhook != nil {
+		plan.webhook.Emit(webhook.Event{
+			Type:      webhook.EventCoverageGap,
+			SessionID: sessionID,
+			Data:      map[string]any{"categories": missed, "sample_percent": tiers.DeepSamplePercent, "source": plan.source},
+		})
+	}
+	return anonymized, applied
+}
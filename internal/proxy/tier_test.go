@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// tieredProxy is a proxy with a tiered detector,
+// returning the bodies seen upstream and the coverage gap events
+func tieredProxy(t *testing.T, tiers detector.TierConfig) (*Server, *vault.Vault, *webhook.Dispatcher, func() []string, func() []webhook.Event) {
+	t.Helper()
+	var mu sync.Mutex
+	var bodies []string
+	var events []webhook.Event
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(upstream.Close)
+	hooks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+	t.Cleanup(hooks.Close)
+
+	cfg := webhook.DefaultConfig()
+	cfg.RetryCount = 0
+	cfg.Destinations = []webhook.Destination{{
+		Name: "test", URL: hooks.URL, Enabled: true, Events: []webhook.EventType{webhook.EventCoverageGap},
+	}}
+	wh := webhook.NewDispatcher(cfg)
+
+	mr := miniredis.RunT(t)
+	v := vault.NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	detCfg := detector.DefaultConfig()
+	detCfg.Tiers = tiers
+	srv, err := New(Config{TargetURL: upstream.URL}, detector.NewWithConfig(detCfg), v, WithWebhook(wh))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, v, wh,
+		func() []string { mu.Lock(); defer mu.Unlock(); return append([]string(nil), bodies...) },
+		func() []webhook.Event { mu.Lock(); defer mu.Unlock(); return append([]webhook.Event(nil), events...) }
+}
+
+func sendChat(srv *Server, session, role, content string) {
+	body, _ := json.Marshal(map[string]any{"messages": []map[string]string{{"role": "user", "content": content}}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Session-ID", session)
+	req.Header.Set("X-User-Role", cmp.Or(role, "admin"))
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestProxy_FastTierOnly(t *testing.T) {
+	srv, v, wh, bodies, events := tieredProxy(t, detector.TierConfig{SensitiveRoles: []string{"operator"}})
+
+	sendChat(srv, "s1", "admin", "CCCD 012345678901, email a@example.com")
+	sent := bodies()[0]
+	if strings.Contains(sent, "012345678901") {
+		t.Errorf("fast tier missed the CCCD: %s", sent)
+	}
+	if !strings.Contains(sent, "a@example.com") {
+		t.Errorf("fast tier scanned the email: %s", sent)
+	}
+
+	// Sensitive roles always get every pattern
+	sendChat(srv, "s2", "operator", "email b@example.com")
+	if sent := bodies()[1]; strings.Contains(sent, "b@example.com") {
+		t.Errorf("sensitive role was not deep-scanned: %s", sent)
+	}
+
+	wh.Close()
+	if deep, _ := v.IsDeep(context.Background(), "s1"); deep {
+		t.Error("session promoted without a sampled deep scan")
+	}
+	if got := events(); len(got) != 0 {
+		t.Errorf("unexpected coverage gap events: %+v", got)
+	}
+}
+
+func TestProxy_SampledDeepScanPromotesSession(t *testing.T) {
+	srv, v, wh, bodies, events := tieredProxy(t, detector.TierConfig{DeepSamplePercent: 50})
+	ctx := context.Background()
+
+	// Half the sessions are sampled, find the email and get promoted
+	const sessions = 50
+	var promoted, fast []string
+	for i := range sessions {
+		id := fmt.Sprintf("s%d", i)
+		sendChat(srv, id, "", fmt.Sprintf("email user%d@example.com", i))
+		deep, _ := v.IsDeep(ctx, id)
+		anonymized := !strings.Contains(bodies()[i], "@example.com")
+		if deep != anonymized {
+			t.Errorf("session %s: promoted = %v but email anonymized = %v", id, deep, anonymized)
+		}
+		if deep {
+			promoted = append(promoted, id)
+		} else {
+			fast = append(fast, id)
+		}
+	}
+	if len(promoted) == 0 || len(fast) == 0 {
+		t.Fatalf("%d of %d sessions promoted at a 50%% sample", len(promoted), sessions)
+	}
+
+	// Promoted sessions are deep-scanned from then on
+	for _, id := range promoted[:min(5, len(promoted))] {
+		sendChat(srv, id, "", "email again@example.com")
+		if sent := bodies()[len(bodies())-1]; strings.Contains(sent, "@example.com") {
+			t.Errorf("promoted session %s was not deep-scanned: %s", id, sent)
+		}
+	}
+
+	wh.Close()
+	got := events()
+	if len(got) != len(promoted) {
+		t.Fatalf("got %d coverage gap events, want %d", len(got), len(promoted))
+	}
+	for _, e := range got {
+		if e.Type != webhook.EventCoverageGap || !slices.Contains(promoted, e.SessionID) {
+			t.Errorf("event = %+v", e)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/version"
+)
+
+func TestProxy_VersionPropagates(t *testing.T) {
+	defer func(v, c, d string) { version.Version, version.Commit, version.Date = v, c, d }(version.Version, version.Commit, version.Date)
+	version.Version, version.Commit, version.Date = "1.4.0", "1a2b3c4d", "2026-05-01T10:00:00Z"
+
+	agents := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.Header.Get("User-Agent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	mr := miniredis.RunT(t)
+	v := vault.NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	srv, err := New(Config{TargetURL: upstream.URL, UpstreamUserAgent: version.UserAgent()}, detector.New(), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := srv.Handler()
+	get := func(path string) []byte {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, rec.Code)
+		}
+		return rec.Body.Bytes()
+	}
+
+	var health HealthResponse
+	if err := json.Unmarshal(get("/health"), &health); err != nil || health.Status != "ok" || health.Version != "1.4.0" {
+		t.Errorf("/health = %+v, err %v", health, err)
+	}
+	var build version.BuildInfo
+	if err := json.Unmarshal(get("/version"), &build); err != nil || build.Version != "1.4.0" ||
+		build.Commit != "1a2b3c4d" || build.Date != "2026-05-01T10:00:00Z" {
+		t.Errorf("/version = %+v, err %v", build, err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "openai-python/1.30.0")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got := <-agents; got != "openai-python/1.30.0 AgentVeil/1.4.0" {
+		t.Errorf("upstream User-Agent = %q", got)
+	}
+}
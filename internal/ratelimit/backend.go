@@ -0,0 +1,225 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Backend stores request counters. Limiters sharing a Redis backend share
+// their counts across proxy instances.
+type Backend interface {
+	// Hit counts one request for key, opening a window of the given size if
+	// none is open, and returns the count so far and when the window resets
+	Hit(ctx context.Context, key string, window time.Duration) (int, time.Time, error)
+	// ResetAt returns when key's open window resets, if one is open
+	ResetAt(ctx context.Context, key string) (time.Time, bool)
+	// Take removes a token from key's bucket of burst tokens, refilled at
+	// perMinute a minute and full when first used. It reports whether a
+	// token was left, how many whole tokens remain and, when none did, how
+	// long until the next one.
+	Take(ctx context.Context, key string, perMinute, burst int) (bool, int, time.Duration, error)
+}
+
+type window struct {
+	count   int
+	resetAt time.Time
+}
+
+// bucket is a token bucket; full is when it refills completely
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// MemoryBackend keeps counters in process
+type MemoryBackend struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	buckets   map[string]*bucket
+	interval  time.Duration
+	nextPrune time.Time
+}
+
+// NewMemoryBackend creates an in-process backend that drops expired windows
+// every cleanupInterval
+func NewMemoryBackend(cleanupInterval time.Duration) *MemoryBackend {
+	return &MemoryBackend{
+		windows:   make(map[string]*window),
+		buckets:   make(map[string]*bucket),
+		interval:  cleanupInterval,
+		nextPrune: time.Now().Add(cleanupInterval),
+	}
+}
+
+// Hit implements Backend
+func (b *MemoryBackend) Hit(_ context.Context, key string, size time.Duration) (int, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.prune(now)
+
+	w, ok := b.windows[key]
+	if !ok || now.After(w.resetAt) {
+		w = &window{resetAt: now.Add(size)}
+		b.windows[key] = w
+	}
+	w.count++
+	return w.count, w.resetAt, nil
+}
+
+// prune drops expired windows and full buckets every interval; the caller
+// holds b.mu
+func (b *MemoryBackend) prune(now time.Time) {
+	if now.Before(b.nextPrune) {
+		return
+	}
+	for k, w := range b.windows {
+		if now.After(w.resetAt) {
+			delete(b.windows, k)
+		}
+	}
+	for k, bk := range b.buckets {
+		if now.After(bk.full) {
+			delete(b.buckets, k)
+		}
+	}
+	b.nextPrune = now.Add(b.interval)
+}
+
+// Take implements Backend
+func (b *MemoryBackend) Take(_ context.Context, key string, perMinute, burst int) (bool, int, time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.prune(now)
+
+	rate := float64(perMinute) / float64(time.Minute) // tokens per nanosecond
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: float64(burst), last: now}
+		b.buckets[key] = bk
+	}
+	bk.tokens = min(float64(burst), bk.tokens+float64(now.Sub(bk.last))*rate)
+	bk.last = now
+
+	allowed := bk.tokens >= 1
+	if allowed {
+		bk.tokens--
+	}
+	bk.full = now.Add(time.Duration((float64(burst) - bk.tokens) / rate))
+	return allowed, int(bk.tokens), tokenWait(bk.tokens, rate), nil
+}
+
+// tokenWait is how long a bucket holding tokens waits for a whole one at
+// rate tokens per nanosecond
+func tokenWait(tokens, rate float64) time.Duration {
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - tokens) / rate))
+}
+
+// ResetAt implements Backend
+func (b *MemoryBackend) ResetAt(_ context.Context, key string) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w, ok := b.windows[key]
+	if !ok || time.Now().After(w.resetAt) {
+		return time.Time{}, false
+	}
+	return w.resetAt, true
+}
+
+// RedisBackend keeps counters in Redis as expiring integer keys
+type RedisBackend struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisBackend creates a backend storing counters under "ratelimit:"
+func NewRedisBackend(client redis.UniversalClient) *RedisBackend {
+	return &RedisBackend{client: client, prefix: "ratelimit:"}
+}
+
+// Hit implements Backend
+func (b *RedisBackend) Hit(ctx context.Context, key string, size time.Duration) (int, time.Time, error) {
+	key = b.prefix + key
+	pipe := b.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	ttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	remaining := ttl.Val()
+	if remaining <= 0 {
+		// First hit of a window (or a key that lost its expiry)
+		if err := b.client.PExpire(ctx, key, size).Err(); err != nil {
+			return 0, time.Time{}, err
+		}
+		remaining = size
+	}
+	return int(incr.Val()), time.Now().Add(remaining), nil
+}
+
+// takeScript refills and takes from a token bucket kept as a hash of
+// tokens and the time in milliseconds they were counted at. The caller's
+// clock is used; a clock behind the stored time refills nothing.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens') or ARGV[2])
+local last = tonumber(redis.call('HGET', KEYS[1], 'last') or ARGV[3])
+if now > last then
+  tokens = math.min(burst, tokens + (now - last) * rate)
+  last = now
+end
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(last))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// Take implements Backend. The bucket is updated in a Lua script, so
+// instances taking from the same bucket don't race.
+func (b *RedisBackend) Take(ctx context.Context, key string, perMinute, burst int) (bool, int, time.Duration, error) {
+	rate := float64(perMinute) / float64(time.Minute.Milliseconds()) // tokens per millisecond
+	res, err := takeScript.Run(ctx, b.client, []string{b.prefix + "bucket:" + key},
+		rate, burst, time.Now().UnixMilli()).Slice()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	if len(res) != 2 {
+		return false, 0, 0, fmt.Errorf("unexpected script result %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	str, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("bucket tokens %q: %w", str, err)
+	}
+	return allowed == 1, int(tokens), tokenWait(tokens, rate) * time.Millisecond, nil
+}
+
+// ResetAt implements Backend
+func (b *RedisBackend) ResetAt(ctx context.Context, key string) (time.Time, bool) {
+	ttl, err := b.client.PTTL(ctx, b.prefix+key).Result()
+	if err != nil || ttl <= 0 {
+		return time.Time{}, false
+	}
+	return time.Now().Add(ttl), true
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Exemptions lists requests that limiters do not count, such as health
+// checks and internal probes. A request is exempt when its path is listed
+// and its method is one of Methods (any method when Methods is empty),
+// when the connecting address is in one of CIDRs, or when its User-Agent
+// starts with one of UserAgents.
+//
+// CIDRs match the address of the TCP peer, never X-Forwarded-For, so a
+// client cannot claim an exempt address.
+type Exemptions struct {
+	Paths      []string
+	Methods    []string
+	CIDRs      []netip.Prefix
+	UserAgents []string
+}
+
+// DefaultExemptions exempts GET /health, /healthz, /readyz and /metrics
+func DefaultExemptions() Exemptions {
+	return Exemptions{
+		Paths:   []string{"/health", "/healthz", "/readyz", "/metrics"},
+		Methods: []string{http.MethodGet},
+	}
+}
+
+// Exempt reports whether r is exempt
+func (e Exemptions) Exempt(r *http.Request) bool {
+	if slices.Contains(e.Paths, r.URL.Path) && (len(e.Methods) == 0 || slices.Contains(e.Methods, r.Method)) {
+		return true
+	}
+	if len(e.CIDRs) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if addr, err := netip.ParseAddr(host); err == nil {
+			addr = addr.Unmap()
+			for _, p := range e.CIDRs {
+				if p.Contains(addr) {
+					return true
+				}
+			}
+		}
+	}
+	if ua := r.UserAgent(); ua != "" {
+		for _, prefix := range e.UserAgents {
+			if strings.HasPrefix(ua, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String describes the exemptions for logs and `agentveil config show`
+func (e Exemptions) String() string {
+	var parts []string
+	if len(e.Paths) > 0 {
+		methods := "any method"
+		if len(e.Methods) > 0 {
+			methods = strings.Join(e.Methods, ",")
+		}
+		parts = append(parts, methods+" "+strings.Join(e.Paths, ","))
+	}
+	if len(e.CIDRs) > 0 {
+		cidrs := make([]string, len(e.CIDRs))
+		for i, p := range e.CIDRs {
+			cidrs[i] = p.String()
+		}
+		parts = append(parts, "from "+strings.Join(cidrs, ","))
+	}
+	if len(e.UserAgents) > 0 {
+		parts = append(parts, "user agents "+strings.Join(e.UserAgents, ","))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, "; ")
+}
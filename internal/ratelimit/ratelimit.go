@@ -1,137 +1,357 @@
+// Package ratelimit provides the rate limiters used across the proxy: the
+// global per-IP middleware, the guardrail's per-session limit, the per-key
+// limit of authenticated Veil keys, and per-key or per-route limits on
+// individual endpoints. Limiters count in fixed windows or, in bucket mode,
+// take from token buckets. They are named and share counter backends
+// (memory or Redis), and every limiter answers a throttled request the same
+// way, whichever layer it sits in.
 package ratelimit
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/vurakit/agentveil/internal/auth"
 )
 
 // Config holds rate limiter settings
 type Config struct {
+	Name              string        // identifies the limiter in responses, logs and stats (default "global")
 	RequestsPerMinute int           // max requests per window per key
-	WindowSize        time.Duration // sliding window size
-	CleanupInterval   time.Duration // how often to purge expired entries
+	WindowSize        time.Duration // fixed window size
+	CleanupInterval   time.Duration // how often the memory backend purges expired entries
+	Key               KeyFunc       // request → key for Middleware (default ByIP)
+	Backend           Backend       // counter store (default in-memory)
+	Exempt            Exemptions    // requests Middleware does not count
+
+	// Bucket takes requests from a token bucket per key instead of counting
+	// them in fixed windows: Burst tokens, refilled at RequestsPerMinute
+	Bucket bool
+	Burst  int // bucket size, RequestsPerMinute when 0
+
+	// Limits overrides RequestsPerMinute and Burst per request in
+	// Middleware, e.g. with the limit of the request's API key
+	Limits func(r *http.Request) (Limit, bool)
+	// Label names the request's key in Rejections where the key itself
+	// must not appear, e.g. an API key's label
+	Label func(r *http.Request) string
+}
+
+// Limit is the rate a key is allowed. A RequestsPerMinute of 0 leaves the
+// key unlimited in Middleware.
+type Limit struct {
+	RequestsPerMinute int
+	Burst             int
 }
 
 // DefaultConfig returns sensible defaults
 func DefaultConfig() Config {
 	return Config{
+		Name:              "global",
 		RequestsPerMinute: 60,
 		WindowSize:        1 * time.Minute,
 		CleanupInterval:   5 * time.Minute,
+		Exempt:            DefaultExemptions(),
 	}
 }
 
-type window struct {
-	count   int
-	resetAt time.Time
+// KeyConfig returns the settings of the per-key limiter: a token bucket
+// per authenticated Veil key of burst tokens refilled at perMinute, or the
+// key's own limit where it has one. Requests without a Veil key are left
+// to the per-IP limit.
+func KeyConfig(perMinute, burst int) Config {
+	return Config{
+		Name:              "key",
+		RequestsPerMinute: perMinute,
+		Bucket:            true,
+		Burst:             burst,
+		Key:               ByVeilKey,
+		Limits:            VeilKeyLimit,
+		Label:             VeilKeyLabel,
+	}
 }
 
-// Limiter implements a sliding window rate limiter
+// Decision is the outcome of counting one request
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// RetryAfter returns whole seconds until the window resets, at least 1
+func (d Decision) RetryAfter() int {
+	remaining := time.Until(d.ResetAt)
+	if remaining <= 0 {
+		return 1
+	}
+	return int(remaining.Seconds()) + 1
+}
+
+// Rejection describes a throttled request, passed to OnLimit hooks
+type Rejection struct {
+	Limiter    string
+	Key        string
+	Label      string // from Config.Label, empty without one
+	Limit      int
+	RetryAfter int
+}
+
+// Stats counts a limiter's decisions
+type Stats struct {
+	Name     string `json:"name"`
+	Allowed  uint64 `json:"allowed"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// Limiter counts requests per key in fixed windows
 type Limiter struct {
 	cfg     Config
-	mu      sync.Mutex
-	windows map[string]*window
-	stop    chan struct{}
+	backend Backend
+
+	allowed  atomic.Uint64
+	rejected atomic.Uint64
+
+	mu      sync.RWMutex
+	onLimit []func(Rejection)
 }
 
-// New creates a rate Limiter and starts background cleanup
+// New creates a rate Limiter
 func New(cfg Config) *Limiter {
-	l := &Limiter{
-		cfg:     cfg,
-		windows: make(map[string]*window),
-		stop:    make(chan struct{}),
+	def := DefaultConfig()
+	if cfg.Name == "" {
+		cfg.Name = def.Name
+	}
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = def.WindowSize
+	}
+	if cfg.CleanupInterval <= 0 {
+		cfg.CleanupInterval = def.CleanupInterval
+	}
+	if cfg.Key == nil {
+		cfg.Key = ByIP
+	}
+	backend := cfg.Backend
+	if backend == nil {
+		backend = NewMemoryBackend(cfg.CleanupInterval)
 	}
-	go l.cleanup()
-	return l
+	return &Limiter{cfg: cfg, backend: backend}
 }
 
-// Allow checks if a request from the given key is allowed
-func (l *Limiter) Allow(key string) bool {
+// Name returns the limiter's name
+func (l *Limiter) Name() string {
+	return l.cfg.Name
+}
+
+// OnLimit registers fn to be called for every throttled request, e.g. to
+// emit a webhook event
+func (l *Limiter) OnLimit(fn func(Rejection)) {
 	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.onLimit = append(l.onLimit, fn)
+	l.mu.Unlock()
+}
 
-	now := time.Now()
-	w, ok := l.windows[key]
+// Check counts a request for key and reports whether it is within the
+// limit. A failing backend allows the request rather than blocking traffic.
+func (l *Limiter) Check(ctx context.Context, key string) Decision {
+	return l.check(ctx, key, "", Limit{RequestsPerMinute: l.cfg.RequestsPerMinute, Burst: l.cfg.Burst})
+}
+
+// check counts a request for key against lim, naming the key label in a
+// Rejection
+func (l *Limiter) check(ctx context.Context, key, label string, lim Limit) Decision {
+	d, err := l.count(ctx, key, lim)
+	if err != nil {
+		slog.Warn("ratelimit: backend error, allowing request", "limiter", l.cfg.Name, "error", err)
+		l.allowed.Add(1)
+		return Decision{Allowed: true, Limit: lim.RequestsPerMinute, Remaining: lim.RequestsPerMinute}
+	}
+	if d.Allowed {
+		l.allowed.Add(1)
+		return d
+	}
 
-	if !ok || now.After(w.resetAt) {
-		l.windows[key] = &window{
-			count:   1,
-			resetAt: now.Add(l.cfg.WindowSize),
+	l.rejected.Add(1)
+	rej := Rejection{Limiter: l.cfg.Name, Key: key, Label: label, Limit: d.Limit, RetryAfter: d.RetryAfter()}
+	l.mu.RLock()
+	hooks := l.onLimit
+	l.mu.RUnlock()
+	for _, fn := range hooks {
+		fn(rej)
+	}
+	return d
+}
+
+// count takes the request from key's bucket or counts it in key's window
+func (l *Limiter) count(ctx context.Context, key string, lim Limit) (Decision, error) {
+	if l.cfg.Bucket {
+		burst := lim.Burst
+		if burst <= 0 {
+			burst = lim.RequestsPerMinute
+		}
+		ok, remaining, wait, err := l.backend.Take(ctx, l.cfg.Name+":"+key, lim.RequestsPerMinute, burst)
+		if err != nil {
+			return Decision{}, err
 		}
-		return true
+		return Decision{Allowed: ok, Limit: lim.RequestsPerMinute, Remaining: remaining, ResetAt: time.Now().Add(wait)}, nil
 	}
 
-	if w.count >= l.cfg.RequestsPerMinute {
-		return false
+	count, resetAt, err := l.backend.Hit(ctx, l.cfg.Name+":"+key, l.cfg.WindowSize)
+	if err != nil {
+		return Decision{}, err
 	}
+	return Decision{
+		Allowed:   count <= lim.RequestsPerMinute,
+		Limit:     lim.RequestsPerMinute,
+		Remaining: max(lim.RequestsPerMinute-count, 0),
+		ResetAt:   resetAt,
+	}, nil
+}
 
-	w.count++
-	return true
+// Allow checks if a request from the given key is allowed
+func (l *Limiter) Allow(key string) bool {
+	return l.Check(context.Background(), key).Allowed
 }
 
 // RetryAfter returns seconds until the window resets for a key
 func (l *Limiter) RetryAfter(key string) int {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	w, ok := l.windows[key]
+	resetAt, ok := l.backend.ResetAt(context.Background(), l.cfg.Name+":"+key)
 	if !ok {
 		return 0
 	}
-
-	remaining := time.Until(w.resetAt)
+	remaining := time.Until(resetAt)
 	if remaining <= 0 {
 		return 0
 	}
 	return int(remaining.Seconds()) + 1
 }
 
-// Middleware returns an HTTP middleware that rate-limits by client IP
+// Stats returns how many requests were allowed and rejected
+func (l *Limiter) Stats() Stats {
+	return Stats{Name: l.cfg.Name, Allowed: l.allowed.Load(), Rejected: l.rejected.Load()}
+}
+
+// Reject writes the 429 response shared by every limiter: Retry-After,
+// X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Scope headers
+// and a JSON body naming the limiter
+func (l *Limiter) Reject(w http.ResponseWriter, d Decision) {
+	h := w.Header()
+	h.Set("Retry-After", strconv.Itoa(d.RetryAfter()))
+	h.Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("X-RateLimit-Remaining", "0")
+	h.Set("X-RateLimit-Scope", l.cfg.Name)
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   "rate_limited",
+		"message": "too many requests",
+		"limiter": l.cfg.Name,
+	})
+}
+
+// Middleware returns an HTTP middleware that rate-limits by the configured
+// key (client IP by default). Exempt requests, requests the key function
+// gives no key and keys with a limit of 0 pass uncounted.
 func (l *Limiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		key := extractIP(r)
-
-		if !l.Allow(key) {
-			retryAfter := l.RetryAfter(key)
-			w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
-			http.Error(w,
-				`{"error":"rate_limited","message":"too many requests"}`,
-				http.StatusTooManyRequests,
-			)
+		key := l.cfg.Key(r)
+		if l.cfg.Exempt.Exempt(r) || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		lim := Limit{RequestsPerMinute: l.cfg.RequestsPerMinute, Burst: l.cfg.Burst}
+		if l.cfg.Limits != nil {
+			if own, ok := l.cfg.Limits(r); ok {
+				lim = own
+			}
+		}
+		if lim.RequestsPerMinute <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		label := ""
+		if l.cfg.Label != nil {
+			label = l.cfg.Label(r)
+		}
+		d := l.check(r.Context(), key, label, lim)
+		if !d.Allowed {
+			l.Reject(w, d)
 			return
 		}
-
 		next.ServeHTTP(w, r)
 	})
 }
 
-// Close stops the background cleanup goroutine
-func (l *Limiter) Close() {
-	close(l.stop)
+// Close releases the limiter. Counters are pruned inline, so there is no
+// background work to stop; it remains for callers that defer it.
+func (l *Limiter) Close() {}
+
+// KeyFunc derives the key a request is counted under
+type KeyFunc func(r *http.Request) string
+
+// ByIP keys requests by client IP
+func ByIP(r *http.Request) string {
+	return extractIP(r)
 }
 
-func (l *Limiter) cleanup() {
-	ticker := time.NewTicker(l.cfg.CleanupInterval)
-	defer ticker.Stop()
+// BySession keys requests by X-Session-ID, falling back to the client
+// address for requests without one
+func BySession(r *http.Request) string {
+	if id := r.Header.Get("X-Session-ID"); id != "" {
+		return id
+	}
+	return r.RemoteAddr
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			l.mu.Lock()
-			now := time.Now()
-			for key, w := range l.windows {
-				if now.After(w.resetAt) {
-					delete(l.windows, key)
-				}
-			}
-			l.mu.Unlock()
-		case <-l.stop:
-			return
-		}
+// ByAPIKey keys requests by the authenticated Veil key ID, falling back to
+// the client IP for unauthenticated requests
+func ByAPIKey(r *http.Request) string {
+	if id := r.Header.Get("X-Veil-Key-ID"); id != "" {
+		return "key:" + id
 	}
+	return "ip:" + extractIP(r)
+}
+
+// ByVeilKey keys requests by the authenticated Veil key ID. Requests
+// without one get no key, so a limiter keyed this way leaves them to the
+// per-IP limit.
+func ByVeilKey(r *http.Request) string {
+	if id := r.Header.Get("X-Veil-Key-ID"); id != "" {
+		return "key:" + id
+	}
+	return ""
+}
+
+// VeilKeyLimit returns the limit of the request's Veil key, if the key has
+// one of its own
+func VeilKeyLimit(r *http.Request) (Limit, bool) {
+	key := auth.KeyFromContext(r.Context())
+	if key == nil || key.RateLimit <= 0 {
+		return Limit{}, false
+	}
+	return Limit{RequestsPerMinute: key.RateLimit, Burst: key.RateBurst}, true
+}
+
+// VeilKeyLabel names the request's Veil key by its label, or by its ID for
+// keys without one
+func VeilKeyLabel(r *http.Request) string {
+	if key := auth.KeyFromContext(r.Context()); key != nil && key.Label != "" {
+		return key.Label
+	}
+	return r.Header.Get("X-Veil-Key-ID")
+}
+
+// ByRoute keys requests by method and path, limiting an endpoint as a whole
+func ByRoute(r *http.Request) string {
+	return r.Method + " " + r.URL.Path
 }
 
 func extractIP(r *http.Request) string {
@@ -1,10 +1,17 @@
 package ratelimit
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/auth"
 )
 
 func TestAllow(t *testing.T) {
@@ -115,3 +122,302 @@ func TestMiddleware_RateLimited(t *testing.T) {
 		t.Error("expected Retry-After header")
 	}
 }
+
+func TestMiddleware_ExemptHealthChecks(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RequestsPerMinute = 10
+	l := New(cfg)
+	defer l.Close()
+
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.1.2.3:4444"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 10000; i++ {
+		if code := serve(http.MethodGet, "/health"); code != http.StatusOK {
+			t.Fatalf("health check %d: got %d", i+1, code)
+		}
+	}
+
+	limited := 0
+	for i := 0; i < 20; i++ {
+		if serve(http.MethodPost, "/v1/chat/completions") == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited != 10 {
+		t.Errorf("expected 10 of 20 /v1/ requests limited, got %d", limited)
+	}
+	if code := serve(http.MethodPost, "/health"); code != http.StatusTooManyRequests {
+		t.Errorf("only GET health checks are exempt, POST got %d", code)
+	}
+}
+
+func TestExemptions(t *testing.T) {
+	e := Exemptions{
+		Paths:      []string{"/status"},
+		CIDRs:      []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")},
+		UserAgents: []string{"kube-probe/"},
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		remote string
+		header map[string]string
+		want   bool
+	}{
+		{"listed path, any method", http.MethodPost, "/status", "8.8.8.8:1", nil, true},
+		{"unlisted path", http.MethodGet, "/health", "8.8.8.8:1", nil, false},
+		{"internal range", http.MethodPost, "/v1/chat/completions", "10.9.8.7:1", nil, true},
+		{"internal IPv6", http.MethodPost, "/v1/chat/completions", "[fd00::1]:1", nil, true},
+		{"forwarded for is ignored", http.MethodPost, "/v1/chat/completions", "8.8.8.8:1",
+			map[string]string{"X-Forwarded-For": "10.0.0.1"}, false},
+		{"probe user agent", http.MethodGet, "/", "8.8.8.8:1",
+			map[string]string{"User-Agent": "kube-probe/1.29"}, true},
+		{"other user agent", http.MethodGet, "/", "8.8.8.8:1",
+			map[string]string{"User-Agent": "curl/8.0"}, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.RemoteAddr = tt.remote
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		if got := e.Exempt(req); got != tt.want {
+			t.Errorf("%s: Exempt = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if got := DefaultExemptions().String(); got != "GET /health,/healthz,/readyz,/metrics" {
+		t.Errorf("String = %q", got)
+	}
+	if got := (Exemptions{}).String(); got != "none" {
+		t.Errorf("empty String = %q", got)
+	}
+}
+
+func TestReject_ConsistentResponse(t *testing.T) {
+	l := New(Config{Name: "session", RequestsPerMinute: 1, Key: BySession})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-Session-ID", "s1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	for h, want := range map[string]string{
+		"X-RateLimit-Scope":     "session",
+		"X-RateLimit-Limit":     "1",
+		"X-RateLimit-Remaining": "0",
+		"Content-Type":          "application/json",
+	} {
+		if got := rec.Header().Get(h); got != want {
+			t.Errorf("%s = %q, want %q", h, got, want)
+		}
+	}
+	var body map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if body["error"] != "rate_limited" || body["limiter"] != "session" {
+		t.Errorf("unexpected body: %s", rec.Body.String())
+	}
+
+	// Another session has its own window
+	req.Header.Set("X-Session-ID", "s2")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("other session: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/scan", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+	if got := ByAPIKey(req); got != "ip:10.0.0.1" {
+		t.Errorf("ByAPIKey without key = %q", got)
+	}
+	req.Header.Set("X-Veil-Key-ID", "abc123")
+	if got := ByAPIKey(req); got != "key:abc123" {
+		t.Errorf("ByAPIKey = %q", got)
+	}
+	if got := ByRoute(req); got != "POST /scan" {
+		t.Errorf("ByRoute = %q", got)
+	}
+	if got := BySession(req); got != "10.0.0.1:5555" {
+		t.Errorf("BySession fallback = %q", got)
+	}
+}
+
+func TestOnLimitAndStats(t *testing.T) {
+	l := New(Config{Name: "route", RequestsPerMinute: 2})
+	var hits []Rejection
+	l.OnLimit(func(r Rejection) { hits = append(hits, r) })
+
+	for i := 0; i < 4; i++ {
+		l.Allow("POST /scan")
+	}
+	if len(hits) != 2 || hits[0].Limiter != "route" || hits[0].Key != "POST /scan" || hits[0].RetryAfter <= 0 {
+		t.Errorf("unexpected rejections: %+v", hits)
+	}
+	if s := l.Stats(); s.Allowed != 2 || s.Rejected != 2 || s.Name != "route" {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestRedisBackend_SharedAcrossLimiters(t *testing.T) {
+	mr := miniredis.RunT(t)
+	backend := NewRedisBackend(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	// Two instances of the same named limiter share counts
+	a := New(Config{Name: "global", RequestsPerMinute: 2, Backend: backend})
+	b := New(Config{Name: "global", RequestsPerMinute: 2, Backend: backend})
+	other := New(Config{Name: "session", RequestsPerMinute: 2, Backend: backend})
+
+	if !a.Allow("ip") || !b.Allow("ip") {
+		t.Fatal("first two requests should be allowed")
+	}
+	if a.Allow("ip") {
+		t.Error("third request across instances should be rejected")
+	}
+	if !other.Allow("ip") {
+		t.Error("limiters with different names must not share counts")
+	}
+	if ra := b.RetryAfter("ip"); ra <= 0 || ra > 61 {
+		t.Errorf("RetryAfter = %d", ra)
+	}
+
+	mr.FastForward(61 * time.Second)
+	if !a.Allow("ip") {
+		t.Error("should be allowed after the window expires")
+	}
+}
+
+func TestBucket(t *testing.T) {
+	mr := miniredis.RunT(t)
+	for _, tt := range []struct {
+		name    string
+		backend func() Backend
+	}{
+		{"memory", func() Backend { return NewMemoryBackend(time.Minute) }},
+		{"redis", func() Backend { return NewRedisBackend(redis.NewClient(&redis.Options{Addr: mr.Addr()})) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := tt.backend()
+			// 600/min is a token every 100ms; two replicas share the bucket
+			a := New(Config{Name: "bucket-" + tt.name, RequestsPerMinute: 600, Bucket: true, Burst: 3, Backend: backend})
+			b := New(Config{Name: "bucket-" + tt.name, RequestsPerMinute: 600, Bucket: true, Burst: 3, Backend: backend})
+
+			for i, l := range []*Limiter{a, b, a} {
+				if d := l.Check(context.Background(), "k"); !d.Allowed || d.Remaining != 2-i {
+					t.Fatalf("request %d of the burst: %+v", i+1, d)
+				}
+			}
+			d := b.Check(context.Background(), "k")
+			if d.Allowed || d.RetryAfter() != 1 || time.Until(d.ResetAt) > 100*time.Millisecond {
+				t.Fatalf("request past the burst: %+v", d)
+			}
+			if !a.Allow("other") {
+				t.Error("another key has its own bucket")
+			}
+
+			time.Sleep(110 * time.Millisecond)
+			if !a.Allow("k") {
+				t.Error("a token should have been refilled")
+			}
+			if a.Allow("k") {
+				t.Error("only one token should have been refilled")
+			}
+		})
+	}
+}
+
+func TestKeyConfig_Middleware(t *testing.T) {
+	l := New(KeyConfig(2, 0))
+	var hits []Rejection
+	l.OnLimit(func(r Rejection) { hits = append(hits, r) })
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func(key *auth.APIKey) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		if key != nil {
+			req.Header.Set("X-Veil-Key-ID", key.ID)
+			req = req.WithContext(auth.WithKey(req.Context(), key))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// A key without its own limit gets the default of 2
+	key := &auth.APIKey{ID: "abc123", Label: "ci runner"}
+	for i := 0; i < 2; i++ {
+		if w := send(key); w.Code != http.StatusOK {
+			t.Fatalf("request %d: %d", i+1, w.Code)
+		}
+	}
+	w := send(key)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" ||
+		w.Header().Get("X-RateLimit-Remaining") != "0" || w.Header().Get("X-RateLimit-Scope") != "key" {
+		t.Errorf("expected 429 with rate limit headers, got %d %v", w.Code, w.Header())
+	}
+	if len(hits) != 1 || hits[0].Label != "ci runner" || hits[0].Key != "key:abc123" || hits[0].Limit != 2 {
+		t.Errorf("rejections = %+v", hits)
+	}
+
+	// A key's own limit replaces the default
+	own := &auth.APIKey{ID: "def456", RateLimit: 5, RateBurst: 4}
+	for i := 0; i < 4; i++ {
+		if w := send(own); w.Code != http.StatusOK {
+			t.Fatalf("request %d with the key's own limit: %d", i+1, w.Code)
+		}
+	}
+	if w := send(own); w.Code != http.StatusTooManyRequests || w.Header().Get("X-RateLimit-Limit") != "5" {
+		t.Errorf("expected 429 past the key's burst, got %d %v", w.Code, w.Header())
+	}
+	if hits[len(hits)-1].Label != "def456" {
+		t.Errorf("a key without a label is named by its ID, got %+v", hits[len(hits)-1])
+	}
+
+	// Requests without a Veil key are left to the per-IP limit
+	for i := 0; i < 5; i++ {
+		if w := send(nil); w.Code != http.StatusOK {
+			t.Fatalf("unauthenticated request %d: %d", i+1, w.Code)
+		}
+	}
+
+	// Without a default, only keys with their own limit are limited
+	unlimited := New(KeyConfig(0, 0)).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		req.Header.Set("X-Veil-Key-ID", "abc123")
+		w := httptest.NewRecorder()
+		unlimited.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d without a default limit: %d", i+1, w.Code)
+		}
+	}
+}
+
+func TestCheck_BackendErrorAllows(t *testing.T) {
+	mr := miniredis.RunT(t)
+	backend := NewRedisBackend(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	l := New(Config{RequestsPerMinute: 1, Backend: backend})
+	mr.Close()
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("ip") {
+			t.Fatal("an unavailable backend should not block traffic")
+		}
+	}
+}
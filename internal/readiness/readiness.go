@@ -0,0 +1,289 @@
+// Package readiness gates /readyz on the dependencies a proxy needs before
+// it takes traffic. With VEIL_STARTUP_PROBE=strict the gate probes every
+// enabled provider, and Redis when the failure mode needs the vault, after
+// the configuration is loaded, and /readyz answers 503 until a quorum is
+// reachable. A gate that times out stays failed with the reason, rather than
+// leaving the pod pending: a bad configuration stalls the rollout instead of
+// serving an error burst.
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the whole gate
+const DefaultTimeout = 30 * time.Second
+
+// DefaultInterval is the pause before probing failed checks again
+const DefaultInterval = time.Second
+
+// Config tunes a Gate
+type Config struct {
+	Timeout  time.Duration // 0 = DefaultTimeout
+	Interval time.Duration // 0 = DefaultInterval
+}
+
+// Check kinds
+const (
+	KindProvider = "provider"
+	KindRedis    = "redis"
+)
+
+// Check is one dependency the gate probes
+type Check struct {
+	Name string
+	Kind string
+	// Required checks must all pass. In a kind with no required check, any
+	// one passing is enough.
+	Required bool
+	Probe    func(ctx context.Context) error
+}
+
+// Phase is where a gate is
+type Phase string
+
+const (
+	Pending Phase = "pending"
+	Ready   Phase = "ready"
+	Failed  Phase = "failed"
+)
+
+// Result is the last outcome of one check
+type Result struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Required  bool   `json:"required"`
+	Reachable bool   `json:"reachable"`
+	Attempts  int    `json:"attempts"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Status is the state of a gate, served at /admin/readiness
+type Status struct {
+	Phase       Phase      `json:"phase"`
+	Reason      string     `json:"reason,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Checks      []Result   `json:"checks"`
+}
+
+// Gate probes its checks until they reach quorum or time out
+type Gate struct {
+	cfg    Config
+	checks []Check
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// New creates a pending Gate. A nil Gate, as when the startup probe is off,
+// is always ready.
+func New(cfg Config, checks []Check) *Gate {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	g := &Gate{cfg: cfg, checks: checks, status: Status{Phase: Pending, StartedAt: time.Now()}}
+	for _, c := range checks {
+		g.status.Checks = append(g.status.Checks, Result{Name: c.Name, Kind: c.Kind, Required: c.Required})
+	}
+	return g
+}
+
+// Run probes the checks not yet reachable, every Interval, until the quorum
+// is reached or the timeout passes, and returns the final status
+func (g *Gate) Run(ctx context.Context) Status {
+	ctx, cancel := context.WithTimeout(ctx, g.cfg.Timeout)
+	defer cancel()
+	for {
+		g.round(ctx)
+		if reason, ok := g.quorum(); ok {
+			return g.finish(Ready, "")
+		} else if ctx.Err() != nil {
+			return g.finish(Failed, fmt.Sprintf("timed out after %s: %s", g.cfg.Timeout, reason))
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(g.cfg.Interval):
+		}
+	}
+}
+
+// round probes every unreachable check concurrently
+func (g *Gate) round(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i, c := range g.checks {
+		if g.result(i).Reachable {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			start := time.Now()
+			err := c.Probe(ctx)
+			if err == nil && ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = errors.New("no answer before the startup probe timeout")
+			}
+			g.mu.Lock()
+			res := &g.status.Checks[i]
+			res.Attempts++
+			res.LatencyMS = time.Since(start).Milliseconds()
+			res.Reachable = err == nil
+			res.Error = ""
+			if err != nil {
+				res.Error = err.Error()
+			}
+			g.mu.Unlock()
+		}(i, c)
+	}
+	wg.Wait()
+}
+
+func (g *Gate) result(i int) Result {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.status.Checks[i]
+}
+
+// quorum reports whether every required check and, for each kind without
+// one, at least one check is reachable; if not, it says what is missing
+func (g *Gate) quorum() (string, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var kinds []string
+	required := map[string]bool{}
+	reachable := map[string]int{}
+	total := map[string]int{}
+	var missing []string
+	for _, res := range g.status.Checks {
+		if total[res.Kind] == 0 {
+			kinds = append(kinds, res.Kind)
+		}
+		total[res.Kind]++
+		if res.Reachable {
+			reachable[res.Kind]++
+		}
+		if res.Required {
+			required[res.Kind] = true
+			if !res.Reachable {
+				missing = append(missing, fmt.Sprintf("required %s %s unreachable", res.Kind, res.Name))
+			}
+		}
+	}
+	for _, kind := range kinds {
+		if !required[kind] && reachable[kind] == 0 {
+			missing = append(missing, fmt.Sprintf("0 of %d %s checks reachable", total[kind], kind))
+		}
+	}
+	return strings.Join(missing, "; "), len(missing) == 0
+}
+
+func (g *Gate) finish(phase Phase, reason string) Status {
+	now := time.Now()
+	g.mu.Lock()
+	g.status.Phase, g.status.Reason, g.status.CompletedAt = phase, reason, &now
+	g.mu.Unlock()
+	st := g.Status()
+	g.log(st)
+	return st
+}
+
+// log writes the gate results to the startup log
+func (g *Gate) log(st Status) {
+	for _, res := range st.Checks {
+		attrs := []any{"check", res.Name, "kind", res.Kind, "required", res.Required,
+			"reachable", res.Reachable, "attempts", res.Attempts, "latency_ms", res.LatencyMS}
+		if res.Error != "" {
+			attrs = append(attrs, "error", res.Error)
+		}
+		slog.Info("readiness: probe", attrs...)
+	}
+	if st.Phase == Ready {
+		slog.Info("readiness: ready", "checks", len(st.Checks), "took", st.CompletedAt.Sub(st.StartedAt).Round(time.Millisecond))
+	} else {
+		slog.Error("readiness: not ready", "reason", st.Reason)
+	}
+}
+
+// Status returns a copy of the gate's state
+func (g *Gate) Status() Status {
+	if g == nil {
+		return Status{Phase: Ready, Checks: []Result{}}
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	st := g.status
+	st.Checks = append([]Result{}, g.status.Checks...)
+	return st
+}
+
+// Ready reports whether the gate reached its quorum
+func (g *Gate) Ready() bool {
+	return g.Status().Phase == Ready
+}
+
+// Response is the body of GET /readyz
+type Response struct {
+	Status Phase  `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Handler serves GET /readyz: 200 once the gate is ready, 503 while it is
+// pending or after it failed. Check details are left to StatusHandler,
+// which sits behind admin auth.
+func (g *Gate) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := g.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if st.Phase != Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		resp := Response{Status: st.Phase}
+		if st.Phase == Failed {
+			resp.Reason = "startup probe failed, see /admin/readiness"
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// StatusHandler serves GET /admin/readiness with every check's result
+func (g *Gate) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(g.Status())
+	})
+}
+
+// HTTP returns a probe that reaches url with GET; any answer below 500
+// means reachable, since the probe carries no client credentials
+func HTTP(client *http.Client, url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
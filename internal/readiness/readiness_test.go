@@ -0,0 +1,131 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func up(context.Context) error   { return nil }
+func down(context.Context) error { return errors.New("connection refused") }
+
+// hang blocks until the gate gives up
+func hang(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestGate_Quorum(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		want   Phase
+		reason string
+	}{
+		{"one provider of two", []Check{
+			{Name: "openai", Kind: KindProvider, Probe: down},
+			{Name: "anthropic", Kind: KindProvider, Probe: up},
+		}, Ready, ""},
+		{"no provider", []Check{
+			{Name: "openai", Kind: KindProvider, Probe: down},
+			{Name: "anthropic", Kind: KindProvider, Probe: hang},
+		}, Failed, "0 of 2 provider checks reachable"},
+		{"required provider down", []Check{
+			{Name: "openai", Kind: KindProvider, Required: true, Probe: down},
+			{Name: "anthropic", Kind: KindProvider, Probe: up},
+		}, Failed, "required provider openai unreachable"},
+		{"required providers up", []Check{
+			{Name: "openai", Kind: KindProvider, Required: true, Probe: up},
+			{Name: "ollama", Kind: KindProvider, Probe: down},
+		}, Ready, ""},
+		{"redis down", []Check{
+			{Name: "openai", Kind: KindProvider, Probe: up},
+			{Name: "vault", Kind: KindRedis, Required: true, Probe: down},
+		}, Failed, "required redis vault unreachable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(Config{Timeout: 50 * time.Millisecond, Interval: 10 * time.Millisecond}, tt.checks)
+			st := g.Run(context.Background())
+			if st.Phase != tt.want || !strings.Contains(st.Reason, tt.reason) || st.CompletedAt == nil {
+				t.Errorf("status = %+v", st)
+			}
+			if g.Ready() != (tt.want == Ready) {
+				t.Errorf("Ready() = %v", g.Ready())
+			}
+		})
+	}
+}
+
+func TestGate_RetriesUntilReachable(t *testing.T) {
+	var calls atomic.Int32
+	flaky := func(context.Context) error {
+		if calls.Add(1) < 3 {
+			return errors.New("no route to host")
+		}
+		return nil
+	}
+	g := New(Config{Timeout: time.Second, Interval: time.Millisecond}, []Check{{Name: "openai", Kind: KindProvider, Probe: flaky}})
+	st := g.Run(context.Background())
+	if st.Phase != Ready || st.Checks[0].Attempts != 3 || st.Checks[0].Error != "" {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestGate_TimeoutDetails(t *testing.T) {
+	g := New(Config{Timeout: 20 * time.Millisecond}, []Check{{Name: "openai", Kind: KindProvider, Probe: hang}})
+	st := g.Run(context.Background())
+	if st.Phase != Failed || !strings.Contains(st.Reason, "timed out after 20ms") {
+		t.Errorf("status = %+v", st)
+	}
+	if res := st.Checks[0]; res.Reachable || !strings.Contains(res.Error, "timeout") {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	g := New(Config{Timeout: 20 * time.Millisecond}, []Check{{Name: "openai", Kind: KindProvider, Probe: down}})
+	get := func(h http.Handler) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, body := get(g.Handler()); code != http.StatusServiceUnavailable || !strings.Contains(body, `"pending"`) {
+		t.Errorf("pending: %d %s", code, body)
+	}
+	g.Run(context.Background())
+	if code, body := get(g.Handler()); code != http.StatusServiceUnavailable || !strings.Contains(body, `"failed"`) || strings.Contains(body, "refused") {
+		t.Errorf("failed: %d %s", code, body)
+	}
+	_, body := get(g.StatusHandler())
+	var st Status
+	if err := json.Unmarshal([]byte(body), &st); err != nil || len(st.Checks) != 1 || st.Checks[0].Error != "connection refused" {
+		t.Errorf("admin status = %s", body)
+	}
+
+	var off *Gate
+	if code, body := get(off.Handler()); code != http.StatusOK || !strings.Contains(body, `"ready"`) {
+		t.Errorf("no gate: %d %s", code, body)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	status := http.StatusUnauthorized
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }))
+	defer srv.Close()
+	probe := HTTP(srv.Client(), srv.URL)
+	if err := probe(context.Background()); err != nil {
+		t.Errorf("401 should count as reachable: %v", err)
+	}
+	status = http.StatusBadGateway
+	if err := probe(context.Background()); err == nil {
+		t.Error("502 counted as reachable")
+	}
+}
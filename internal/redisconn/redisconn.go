@@ -0,0 +1,244 @@
+// Package redisconn builds the shared Redis client used by the vault and
+// API key store, covering standalone, Sentinel and Cluster deployments with
+// optional TLS and ACL authentication.
+package redisconn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultSentinelMaster = "mymaster"
+
+// Config describes how to reach Redis
+type Config struct {
+	Addr     string // host:port, or a unix socket path such as /run/redis.sock
+	Username string // Redis 6+ ACL user
+	Password string
+	DB       int
+
+	// Sentinel: when SentinelAddrs is set the client follows MasterName
+	SentinelAddrs []string
+	MasterName    string
+
+	// Cluster: when ClusterAddrs is set a cluster client is created
+	ClusterAddrs []string
+
+	TLS        bool
+	TLSCA      string // PEM CA bundle; system roots when empty
+	TLSCert    string // client certificate for mutual TLS
+	TLSKey     string
+	ServerName string // overrides the SNI/verification host name
+}
+
+// FromEnv reads REDIS_* environment variables
+func FromEnv() (Config, error) {
+	cfg := Config{
+		Addr:          envOr("REDIS_ADDR", "localhost:6379"),
+		Username:      os.Getenv("REDIS_USERNAME"),
+		Password:      os.Getenv("REDIS_PASSWORD"),
+		SentinelAddrs: splitAddrs(os.Getenv("REDIS_SENTINEL")),
+		MasterName:    envOr("REDIS_SENTINEL_MASTER", defaultSentinelMaster),
+		ClusterAddrs:  splitAddrs(os.Getenv("REDIS_CLUSTER")),
+		TLSCA:         os.Getenv("REDIS_TLS_CA"),
+		TLSCert:       os.Getenv("REDIS_TLS_CERT"),
+		TLSKey:        os.Getenv("REDIS_TLS_KEY"),
+		ServerName:    os.Getenv("REDIS_TLS_SERVER_NAME"),
+	}
+
+	if v := os.Getenv("REDIS_DB"); v != "" {
+		db, err := strconv.Atoi(v)
+		if err != nil || db < 0 {
+			return cfg, fmt.Errorf("REDIS_DB must be a non-negative integer, got %q", v)
+		}
+		cfg.DB = db
+	}
+	if v := os.Getenv("REDIS_TLS"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("REDIS_TLS must be true or false, got %q", v)
+		}
+		cfg.TLS = on
+	}
+
+	return cfg, nil
+}
+
+// Mode returns "cluster", "sentinel" or "standalone"
+func (c Config) Mode() string {
+	switch {
+	case len(c.ClusterAddrs) > 0:
+		return "cluster"
+	case len(c.SentinelAddrs) > 0:
+		return "sentinel"
+	default:
+		return "standalone"
+	}
+}
+
+// Local reports whether Redis is reached over a unix socket or a loopback
+// address, so vault data never leaves the host. Sentinel is never local:
+// the master it hands out may be anywhere.
+func (c Config) Local() bool {
+	var addrs []string
+	switch c.Mode() {
+	case "cluster":
+		addrs = c.ClusterAddrs
+	case "sentinel":
+		return false
+	default:
+		addrs = []string{c.Addr}
+	}
+	for _, addr := range addrs {
+		if socketPath(addr) == "" && !isLoopback(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// socketPath returns the unix socket of addr, or "" for a TCP address
+func socketPath(addr string) string {
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		return path
+	}
+	if strings.HasPrefix(addr, "/") {
+		return addr
+	}
+	return ""
+}
+
+// isLoopback reports whether a host:port names this host. An empty host
+// is dialed as localhost.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "" || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Validate checks for conflicting settings
+func (c Config) Validate() error {
+	if len(c.ClusterAddrs) > 0 && len(c.SentinelAddrs) > 0 {
+		return fmt.Errorf("redis: REDIS_CLUSTER and REDIS_SENTINEL are mutually exclusive")
+	}
+	if len(c.ClusterAddrs) > 0 && c.DB != 0 {
+		return fmt.Errorf("redis: cluster mode only supports DB 0")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("redis: REDIS_TLS_CERT and REDIS_TLS_KEY must be set together")
+	}
+	return nil
+}
+
+// TLSConfig loads the TLS material. It returns nil when TLS is disabled.
+// Setting a CA or client certificate implies TLS.
+func (c Config) TLSConfig() (*tls.Config, error) {
+	if !c.TLS && c.TLSCA == "" && c.TLSCert == "" {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.TLSCA != "" {
+		pem, err := os.ReadFile(c.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("redis: read REDIS_TLS_CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis: REDIS_TLS_CA %s contains no PEM certificates", c.TLSCA)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if c.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("redis: load REDIS_TLS_CERT/REDIS_TLS_KEY: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// Options converts the config into go-redis universal options
+func (c Config) Options() (*redis.UniversalOptions, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	tlsCfg, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &redis.UniversalOptions{
+		Username:  c.Username,
+		Password:  c.Password,
+		DB:        c.DB,
+		TLSConfig: tlsCfg,
+	}
+
+	switch c.Mode() {
+	case "cluster":
+		opts.Addrs = c.ClusterAddrs
+		opts.IsClusterMode = true
+	case "sentinel":
+		opts.Addrs = c.SentinelAddrs
+		opts.MasterName = c.MasterName
+	default:
+		opts.Addrs = []string{c.Addr}
+		if path := socketPath(c.Addr); path != "" {
+			opts.Dialer = func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+// New creates the client for cfg, failing fast on invalid settings or
+// unreadable TLS material. It does not contact Redis.
+func New(cfg Config) (redis.UniversalClient, error) {
+	opts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewUniversalClient(opts), nil
+}
+
+func splitAddrs(s string) []string {
+	var addrs []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
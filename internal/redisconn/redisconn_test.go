@@ -0,0 +1,128 @@
+package redisconn
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("REDIS_ADDR", "redis.example.com:6380")
+	t.Setenv("REDIS_USERNAME", "veil")
+	t.Setenv("REDIS_PASSWORD", "secret")
+	t.Setenv("REDIS_DB", "3")
+	t.Setenv("REDIS_TLS", "true")
+	t.Setenv("REDIS_SENTINEL", "s1:26379, s2:26379,")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Username != "veil" || cfg.Password != "secret" || cfg.DB != 3 || !cfg.TLS {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if cfg.Mode() != "sentinel" || len(cfg.SentinelAddrs) != 2 || cfg.MasterName != "mymaster" {
+		t.Errorf("expected sentinel with 2 addrs, got %+v", cfg)
+	}
+
+	opts, err := cfg.Options()
+	if err != nil {
+		t.Fatalf("options: %v", err)
+	}
+	if opts.MasterName != "mymaster" || opts.TLSConfig == nil || opts.Username != "veil" {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+}
+
+func TestFromEnv_Invalid(t *testing.T) {
+	tests := []struct {
+		name, key, value string
+	}{
+		{"bad db", "REDIS_DB", "one"},
+		{"negative db", "REDIS_DB", "-1"},
+		{"bad tls flag", "REDIS_TLS", "maybe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := FromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestNew_Validation(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pem")
+	os.WriteFile(garbage, []byte("not a certificate"), 0600)
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"standalone", Config{Addr: "localhost:6379"}, ""},
+		{"cluster", Config{ClusterAddrs: []string{"a:6379", "b:6379"}}, ""},
+		{"cluster and sentinel", Config{ClusterAddrs: []string{"a:1"}, SentinelAddrs: []string{"b:2"}}, "mutually exclusive"},
+		{"cluster with db", Config{ClusterAddrs: []string{"a:1"}, DB: 2}, "DB 0"},
+		{"missing CA file", Config{Addr: "x:1", TLS: true, TLSCA: filepath.Join(dir, "nope.pem")}, "REDIS_TLS_CA"},
+		{"CA without certs", Config{Addr: "x:1", TLSCA: garbage}, "no PEM certificates"},
+		{"cert without key", Config{Addr: "x:1", TLSCert: garbage}, "must be set together"},
+		{"unreadable keypair", Config{Addr: "x:1", TLSCert: garbage, TLSKey: garbage}, "REDIS_TLS_CERT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(tt.cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				client.Close()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLocal(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want bool
+	}{
+		{"localhost", Config{Addr: "localhost:6379"}, true},
+		{"ipv4 loopback", Config{Addr: "127.0.0.1:6379"}, true},
+		{"ipv6 loopback", Config{Addr: "[::1]:6379"}, true},
+		{"empty host", Config{Addr: ":6379"}, true},
+		{"unix socket", Config{Addr: "/run/redis/redis.sock"}, true},
+		{"unix URL", Config{Addr: "unix:///run/redis/redis.sock"}, true},
+		{"remote host", Config{Addr: "redis:6379"}, false},
+		{"private address", Config{Addr: "10.0.0.5:6379"}, false},
+		{"local cluster", Config{ClusterAddrs: []string{"127.0.0.1:7000", "127.0.0.1:7001"}}, true},
+		{"mixed cluster", Config{ClusterAddrs: []string{"127.0.0.1:7000", "node-2:7001"}}, false},
+		{"sentinel", Config{SentinelAddrs: []string{"127.0.0.1:26379"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.Local(); got != tt.want {
+			t.Errorf("%s: Local() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOptions_UnixSocket(t *testing.T) {
+	opts, err := Config{Addr: "unix:///run/redis/redis.sock"}.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Dialer == nil {
+		t.Error("a unix socket address should dial through a unix dialer")
+	}
+	if opts, _ := (Config{Addr: "localhost:6379"}).Options(); opts.Dialer != nil {
+		t.Error("TCP addresses should use the default dialer")
+	}
+}
@@ -0,0 +1,151 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyAlpha weights the newest sample in the latency EWMA
+const latencyAlpha = 0.3
+
+// minLatencySamples is how many responses a provider needs before its
+// latency is trusted; until then least_latency sends it warm-up traffic in
+// priority order
+const minLatencySamples = 3
+
+// providerMetrics tracks live load and response latency of a provider
+type providerMetrics struct {
+	inflight atomic.Int64
+
+	mu      sync.Mutex
+	ewma    float64 // milliseconds to response headers
+	samples int
+}
+
+// observe folds one response latency into the EWMA
+func (m *providerMetrics) observe(d time.Duration) {
+	ms := float64(d.Microseconds()) / 1000
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.samples == 0 {
+		m.ewma = ms
+	} else {
+		m.ewma = latencyAlpha*ms + (1-latencyAlpha)*m.ewma
+	}
+	m.samples++
+}
+
+// latency returns the EWMA and whether enough samples back it
+func (m *providerMetrics) latency() (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ewma, m.samples >= minLatencySamples
+}
+
+// Metrics is the load-balancing view of a provider on /admin/providers
+type Metrics struct {
+	InFlight  int64   `json:"in_flight"`
+	LatencyMs float64 `json:"latency_ms"` // EWMA of time to response headers
+	Samples   int     `json:"latency_samples"`
+}
+
+// Metrics returns the provider's current load and latency
+func (p *Provider) Metrics() Metrics {
+	p.metrics.mu.Lock()
+	defer p.metrics.mu.Unlock()
+	return Metrics{
+		InFlight:  p.metrics.inflight.Load(),
+		LatencyMs: p.metrics.ewma,
+		Samples:   p.metrics.samples,
+	}
+}
+
+type startKey struct{}
+
+// forward sends req to p, counting it as in flight until the response is
+// fully written. The start time rides on the context so ModifyResponse can
+// record the latency to response headers, which streams don't distort.
+func (p *Provider) forward(w http.ResponseWriter, req *http.Request) {
+	p.metrics.inflight.Add(1)
+	defer p.metrics.inflight.Add(-1)
+	ctx := context.WithValue(req.Context(), startKey{}, time.Now())
+	p.Proxy.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// observeResponse records and returns the latency of resp if it went
+// through forward
+func (p *Provider) observeResponse(resp *http.Response) (time.Duration, bool) {
+	start, ok := resp.Request.Context().Value(startKey{}).(time.Time)
+	if !ok {
+		return 0, false
+	}
+	d := time.Since(start)
+	p.metrics.observe(d)
+	return d, true
+}
+
+// healthyByPriority lists healthy providers not cooling down after a rate
+// limit, in priority order
+func (set *providerSet) healthyByPriority() []*Provider {
+	var out []*Provider
+	for _, name := range set.rrList {
+		if p := set.providers[name]; p != nil && p.available() {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// nextLeastInflight picks the healthy provider with the fewest requests in
+// flight. Ties, including the idle case, go to the higher priority.
+func (set *providerSet) nextLeastInflight() string {
+	var best *Provider
+	for _, p := range set.healthyByPriority() {
+		if best == nil || p.metrics.inflight.Load() < best.metrics.inflight.Load() {
+			best = p
+		}
+	}
+	if best == nil {
+		return set.defaultRoute
+	}
+	return best.Config.Name
+}
+
+// nextLeastLatency picks a healthy provider at random with probability
+// inversely proportional to its latency EWMA, so slow providers still get
+// some traffic and their numbers stay current. Providers without enough
+// samples are picked first, in priority order, to warm them up.
+func (r *Router) nextLeastLatency(set *providerSet) string {
+	candidates := set.healthyByPriority()
+	if len(candidates) == 0 {
+		return set.defaultRoute
+	}
+
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, p := range candidates {
+		ms, warm := p.metrics.latency()
+		if !warm {
+			return p.Config.Name
+		}
+		if ms < 1 {
+			ms = 1
+		}
+		weights[i] = 1 / ms
+		total += weights[i]
+	}
+
+	r.mu.Lock()
+	x := r.rand.Float64() * total
+	r.mu.Unlock()
+	for i, w := range weights {
+		if x < w {
+			return candidates[i].Config.Name
+		}
+		x -= w
+	}
+	return candidates[len(candidates)-1].Config.Name
+}
@@ -2,7 +2,11 @@ package router
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,6 +16,8 @@ type ProviderConfig struct {
 	Name       string `yaml:"name"`        // e.g. "openai", "anthropic", "gemini", "ollama"
 	BaseURL    string `yaml:"base_url"`    // e.g. "https://api.openai.com"
 	APIKey     string `yaml:"api_key"`     // provider API key (or env var reference $ENV_VAR)
+	APIKeyEnv  string `yaml:"api_key_env"`  // read the key from this env var (overrides api_key)
+	APIKeyFile string `yaml:"api_key_file"` // read the key from this file, e.g. a Docker secret (overrides both)
 	AuthMethod string `yaml:"auth_method"` // "header" (Bearer), "x-api-key", or "query"
 	AuthParam  string `yaml:"auth_param"`  // query param name for auth_method=query (default "key")
 	Model      string `yaml:"model"`       // default model for this provider
@@ -20,12 +26,45 @@ type ProviderConfig struct {
 	MaxRetries int    `yaml:"max_retries"` // max retries before fallback
 	TimeoutSec int    `yaml:"timeout_sec"` // request timeout in seconds
 	Enabled    bool   `yaml:"enabled"`
+
+	// Required providers must answer the startup probe before /readyz
+	// reports ready under VEIL_STARTUP_PROBE=strict. With none required,
+	// any one provider answering is enough.
+	Required bool `yaml:"required"`
+
+	// SignRequests adds X-Veil-Signature to requests for this provider when
+	// the router has a signing key. Meant for internal gateways; public
+	// providers would ignore or reject the headers.
+	SignRequests bool `yaml:"sign_requests"`
+
+	// Local runtimes: with type ollama or lmstudio and auto_discover, the
+	// router checks reachability and the model list through the runtime's
+	// native API at startup and every discover_interval_sec
+	Type                string `yaml:"type"`
+	AutoDiscover        bool   `yaml:"auto_discover"`
+	DiscoverIntervalSec int    `yaml:"discover_interval_sec"`
+
+	// Limits, zero for none: larger bodies are refused with 413, prompts
+	// estimated above max_prompt_tokens with 400, and max_tokens asked above
+	// max_output_tokens_override is lowered to it before forwarding
+	MaxRequestBytes         int64 `yaml:"max_request_bytes"`
+	MaxPromptTokens         int   `yaml:"max_prompt_tokens"`
+	MaxOutputTokensOverride int   `yaml:"max_output_tokens_override"`
+
+	// Region is where the provider processes data, e.g. "vn", for
+	// data_localization
+	Region string `yaml:"region"`
+
+	// HealthCheck probes the provider in the background, nil to only
+	// mark it unhealthy when a request fails
+	HealthCheck *HealthCheckConfig `yaml:"health_check,omitempty"`
 }
 
 // RouteConfig maps a path prefix to a provider
 type RouteConfig struct {
-	PathPrefix string `yaml:"path_prefix"` // e.g. "/v1/openai"
-	Provider   string `yaml:"provider"`    // provider name
+	PathPrefix      string `yaml:"path_prefix"`      // e.g. "/v1/openai"
+	Provider        string `yaml:"provider"`         // provider name
+	DetectorProfile string `yaml:"detector_profile"` // detector profile of the route's requests, unless the key sets one
 }
 
 // FallbackConfig configures fallback behavior
@@ -42,6 +81,12 @@ const (
 	StrategyRoundRobin LoadBalanceStrategy = "round_robin"
 	StrategyWeighted   LoadBalanceStrategy = "weighted"
 	StrategyPriority   LoadBalanceStrategy = "priority"
+	// StrategyLeastInflight picks the healthy provider with the fewest
+	// requests in flight
+	StrategyLeastInflight LoadBalanceStrategy = "least_inflight"
+	// StrategyLeastLatency picks healthy providers with probability inversely
+	// proportional to their recent response latency
+	StrategyLeastLatency LoadBalanceStrategy = "least_latency"
 )
 
 // RouterConfig is the top-level YAML configuration
@@ -51,27 +96,120 @@ type RouterConfig struct {
 	Fallback     FallbackConfig      `yaml:"fallback"`
 	LoadBalance  LoadBalanceStrategy `yaml:"load_balance"`
 	DefaultRoute string              `yaml:"default_route"` // default provider name
+
+	DataLocalization DataLocalizationConfig `yaml:"data_localization"`
 }
 
-// LoadConfig reads router configuration from a YAML file
+// LoadConfig reads router configuration from a YAML file. Besides the
+// RouterConfig keys a file may have:
+//
+//   - include: a path or list of paths, relative to the file, of config
+//     files merged under it in order, so later files and then the file
+//     itself override earlier ones. Mappings merge key by key and
+//     providers by name.
+//   - provider_defaults: provider fields applied to every provider that
+//     does not set them.
+//   - ${VAR} and ${VAR:-default} in any value, expanded from the
+//     environment. An unset VAR without a default is an error.
+//
+// YAML anchors and merge keys work within a file. Syntax, type and
+// interpolation errors name the file and line.
 func LoadConfig(path string) (*RouterConfig, error) {
-	data, err := os.ReadFile(path)
+	root, err := loadConfigNode(path, nil)
 	if err != nil {
-		return nil, fmt.Errorf("read config: %w", err)
+		return nil, err
+	}
+	return decodeConfig(root)
+}
+
+// resolveAPIKey fills APIKey from the highest-precedence source:
+// api_key < api_key_env < api_key_file. A referenced env var or file that is
+// missing or empty is an error rather than a silently unauthenticated provider.
+func (p *ProviderConfig) resolveAPIKey() error {
+	switch {
+	case p.APIKeyFile != "":
+		data, err := os.ReadFile(p.APIKeyFile)
+		if err != nil {
+			return fmt.Errorf("provider %s: api_key_file: %w", p.Name, err)
+		}
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return fmt.Errorf("provider %s: api_key_file %s is empty", p.Name, p.APIKeyFile)
+		}
+		p.APIKey = key
+	case p.APIKeyEnv != "":
+		key := strings.TrimSpace(os.Getenv(p.APIKeyEnv))
+		if key == "" {
+			return fmt.Errorf("provider %s: api_key_env %s is not set", p.Name, p.APIKeyEnv)
+		}
+		p.APIKey = key
+	case len(p.APIKey) > 0 && p.APIKey[0] == '$':
+		// Legacy $ENV_VAR reference in api_key
+		p.APIKey = os.Getenv(p.APIKey[1:])
+	}
+	return nil
+}
+
+// setAuth adds the provider API key to req, if one is configured
+func (p ProviderConfig) setAuth(req *http.Request) {
+	if p.APIKey == "" {
+		return
+	}
+	switch p.AuthMethod {
+	case "query":
+		q := req.URL.Query()
+		q.Set(p.AuthParam, p.APIKey)
+		req.URL.RawQuery = q.Encode()
+	case "x-api-key":
+		req.Header.Set("x-api-key", p.APIKey)
+	default: // "header" — Bearer token
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+}
+
+// KeyFingerprint identifies the resolved API key without revealing it,
+// e.g. "sk-...9xQz". Keys too short to fingerprint safely show as "****".
+func (p ProviderConfig) KeyFingerprint() string {
+	return fingerprint(p.APIKey)
+}
+
+func fingerprint(key string) string {
+	switch {
+	case key == "":
+		return ""
+	case len(key) < 12:
+		return "****"
+	default:
+		return key[:3] + "..." + key[len(key)-4:]
 	}
-	return ParseConfig(string(data))
 }
 
-// ParseConfig parses router configuration from YAML string
+// ParseConfig parses router configuration from YAML string, as LoadConfig
+// does with includes relative to the working directory
 func ParseConfig(data string) (*RouterConfig, error) {
+	root, err := parseConfigNode("parse config", ".", []byte(data), nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(root)
+}
+
+// decodeConfig applies provider_defaults to the merged document, decodes
+// it and validates the result
+func decodeConfig(root *yaml.Node) (*RouterConfig, error) {
+	applyProviderDefaults(root)
 	var cfg RouterConfig
-	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+	if err := root.Decode(&cfg); err != nil {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
 
 	// Defaults
-	if cfg.LoadBalance == "" {
+	switch cfg.LoadBalance {
+	case "":
 		cfg.LoadBalance = StrategyPriority
+	case StrategyPriority, StrategyRoundRobin, StrategyWeighted, StrategyLeastInflight, StrategyLeastLatency:
+	default:
+		return nil, fmt.Errorf("load_balance: unknown strategy %q (want priority, round_robin, weighted, least_inflight or least_latency)", cfg.LoadBalance)
 	}
 	if cfg.Fallback.MaxAttempts == 0 {
 		cfg.Fallback.MaxAttempts = 3
@@ -86,9 +224,11 @@ func ParseConfig(data string) (*RouterConfig, error) {
 		if p.BaseURL == "" {
 			return nil, fmt.Errorf("provider %s: missing base_url", p.Name)
 		}
-		// Resolve $ENV_VAR references in api_key
-		if len(p.APIKey) > 0 && p.APIKey[0] == '$' {
-			p.APIKey = os.Getenv(p.APIKey[1:])
+		if u, err := url.Parse(p.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("provider %s: base_url %q is not an absolute URL", p.Name, p.BaseURL)
+		}
+		if err := p.resolveAPIKey(); err != nil {
+			return nil, err
 		}
 		if p.Weight == 0 {
 			p.Weight = 1
@@ -105,6 +245,18 @@ func ParseConfig(data string) (*RouterConfig, error) {
 		if p.AuthMethod == "query" && p.AuthParam == "" {
 			p.AuthParam = "key"
 		}
+		p.Type = strings.ToLower(p.Type)
+		if p.AutoDiscover && p.Type != TypeOllama && p.Type != TypeLMStudio {
+			return nil, fmt.Errorf("provider %s: auto_discover requires type ollama or lmstudio", p.Name)
+		}
+		if p.MaxRequestBytes < 0 || p.MaxPromptTokens < 0 || p.MaxOutputTokensOverride < 0 {
+			return nil, fmt.Errorf("provider %s: limits must not be negative", p.Name)
+		}
+		if p.HealthCheck != nil {
+			if err := p.HealthCheck.validate(p.Name); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Validate routes reference existing providers
@@ -120,6 +272,14 @@ func ParseConfig(data string) (*RouterConfig, error) {
 	if cfg.DefaultRoute != "" && !providerSet[cfg.DefaultRoute] {
 		return nil, fmt.Errorf("default_route: unknown provider %s", cfg.DefaultRoute)
 	}
+	if err := cfg.DataLocalization.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.DataLocalization.Enabled && !slices.ContainsFunc(cfg.Providers, func(p ProviderConfig) bool {
+		return p.Enabled && slices.Contains(cfg.DataLocalization.AllowedRegions, strings.ToLower(p.Region))
+	}) {
+		return nil, fmt.Errorf("data_localization: no enabled provider in allowed_regions %v", cfg.DataLocalization.AllowedRegions)
+	}
 
 	return &cfg, nil
 }
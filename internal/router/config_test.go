@@ -0,0 +1,147 @@
+package router
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// prod.yaml includes base.yaml, which includes providers.yaml, then a
+// routing override; the effective config is testdata/config/effective.yaml
+func TestLoadConfig_EffectiveGolden(t *testing.T) {
+	t.Setenv("ROUTER_TEST_OPENAI_URL", "https://eu.api.openai.com")
+	t.Setenv("ROUTER_TEST_OPENAI_KEY", "sk-test-0123456789abcdef")
+	os.Unsetenv("ROUTER_TEST_TIMEOUT")
+
+	cfg, err := LoadConfig(filepath.Join("testdata", "config", "prod.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Providers[0].APIKey = "" // resolved from the env, not part of the fixture
+	got, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "config", "effective.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("effective config differs from effective.yaml:\n%s", got)
+	}
+}
+
+func TestLoadConfig_Interpolation(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"router.yaml": "providers:\n" +
+			"  - name: openai\n" +
+			"    base_url: ${ROUTER_TEST_URL:-https://api.openai.com}/v1\n" +
+			"    model: \"$${literal}\"\n" +
+			"    timeout_sec: ${ROUTER_TEST_TIMEOUT:-12}\n",
+		"missing.yaml": "providers:\n" +
+			"  - name: openai\n" +
+			"    base_url: ${ROUTER_TEST_MISSING}\n",
+	})
+	os.Unsetenv("ROUTER_TEST_URL")
+	os.Unsetenv("ROUTER_TEST_MISSING")
+
+	cfg, err := LoadConfig(filepath.Join(dir, "router.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := cfg.Providers[0]
+	if p.BaseURL != "https://api.openai.com/v1" || p.Model != "${literal}" || p.TimeoutSec != 12 {
+		t.Errorf("defaults: %+v", p)
+	}
+
+	t.Setenv("ROUTER_TEST_URL", "https://proxy.internal")
+	t.Setenv("ROUTER_TEST_TIMEOUT", "7")
+	if cfg, err = LoadConfig(filepath.Join(dir, "router.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if p := cfg.Providers[0]; p.BaseURL != "https://proxy.internal/v1" || p.TimeoutSec != 7 {
+		t.Errorf("from env: %+v", p)
+	}
+
+	_, err = LoadConfig(filepath.Join(dir, "missing.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "missing.yaml: line 3") || !strings.Contains(err.Error(), "ROUTER_TEST_MISSING is not set") {
+		t.Errorf("missing variable: %v", err)
+	}
+}
+
+func TestLoadConfig_ErrorsNameTheFile(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"router.yaml":          "include: [ok.yaml, nested/bad-type.yaml]\n",
+		"ok.yaml":              "load_balance: priority\n",
+		"nested/bad-type.yaml": "include: ../defaults.yaml\n",
+		"defaults.yaml":        "provider_defaults:\n  timeout_sec: soon\n",
+		"syntax.yaml":          "include: broken.yaml\n",
+		"broken.yaml":          "providers: [\n",
+		"cycle-a.yaml":         "include: cycle-b.yaml\n",
+		"cycle-b.yaml":         "include: cycle-a.yaml\n",
+	})
+
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"router.yaml", []string{"defaults.yaml: line 2", "`soon`"}},
+		{"syntax.yaml", []string{"broken.yaml: yaml: line"}},
+		{"cycle-a.yaml", []string{"include cycle"}},
+		{"absent.yaml", []string{"read config"}},
+	}
+	for _, tt := range tests {
+		_, err := LoadConfig(filepath.Join(dir, tt.file))
+		if err == nil {
+			t.Errorf("%s: want an error", tt.file)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", tt.file, err, want)
+			}
+		}
+	}
+}
+
+func TestParseConfig_ProviderDefaultsOverridden(t *testing.T) {
+	cfg, err := ParseConfig(`
+provider_defaults:
+  enabled: true
+  auth_method: x-api-key
+  timeout_sec: 60
+providers:
+  - name: anthropic
+    base_url: https://api.anthropic.com
+  - name: openai
+    base_url: https://api.openai.com
+    auth_method: header
+    enabled: false
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, o := cfg.Providers[0], cfg.Providers[1]
+	if !a.Enabled || a.AuthMethod != "x-api-key" || a.TimeoutSec != 60 {
+		t.Errorf("defaults not applied: %+v", a)
+	}
+	if o.Enabled || o.AuthMethod != "header" || o.TimeoutSec != 60 {
+		t.Errorf("provider fields should override defaults: %+v", o)
+	}
+}
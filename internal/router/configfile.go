@@ -0,0 +1,333 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the document shape of one config file: the RouterConfig
+// plus the keys resolved while loading
+type configFile struct {
+	RouterConfig     `yaml:",inline"`
+	Include          yaml.Node      `yaml:"include"`
+	ProviderDefaults ProviderConfig `yaml:"provider_defaults"`
+}
+
+// loadConfigNode reads the config file at path with its includes and
+// returns the merged document. stack holds the files being loaded, to
+// catch include cycles.
+func loadConfigNode(path string, stack []string) (*yaml.Node, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	for _, p := range stack {
+		if p == abs {
+			return nil, fmt.Errorf("%s: include cycle: %s", path, strings.Join(append(stack, abs), " -> "))
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	return parseConfigNode(path, filepath.Dir(path), data, append(stack, abs))
+}
+
+// parseConfigNode parses one config file named name, interpolates it and
+// merges its includes, resolved against dir, under it
+func parseConfigNode(name, dir string, data []byte, stack []string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: line %d: config must be a mapping", name, root.Line)
+	}
+	root = expandAliases(root)
+	if err := interpolate(root); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	// Decoding each file on its own reports type errors with their file
+	var check configFile
+	if err := root.Decode(&check); err != nil {
+		var te *yaml.TypeError
+		if errors.As(err, &te) {
+			return nil, fmt.Errorf("%s: %s", name, strings.Join(te.Errors, "; "))
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	includes, err := includePaths(mappingValue(root, "include"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	deleteKey(root, "include")
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(dir, inc)
+		}
+		node, err := loadConfigNode(inc, stack)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeNodes(merged, node)
+	}
+	return mergeNodes(merged, root), nil
+}
+
+// includePaths reads the include key: one path or a list of them
+func includePaths(node *yaml.Node) ([]string, error) {
+	if node == nil {
+		return nil, nil
+	}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []string{node.Value}, nil
+	case yaml.SequenceNode:
+		paths := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: include entries must be paths", item.Line)
+			}
+			paths = append(paths, item.Value)
+		}
+		return paths, nil
+	}
+	return nil, fmt.Errorf("line %d: include must be a path or a list of paths", node.Line)
+}
+
+// applyProviderDefaults merges provider_defaults under every provider and
+// removes the key
+func applyProviderDefaults(root *yaml.Node) {
+	defaults := mappingValue(root, "provider_defaults")
+	deleteKey(root, "provider_defaults")
+	providers := mappingValue(root, "providers")
+	if defaults == nil || defaults.Kind != yaml.MappingNode || providers == nil || providers.Kind != yaml.SequenceNode {
+		return
+	}
+	for i, p := range providers.Content {
+		if p.Kind == yaml.MappingNode {
+			providers.Content[i] = mergeNodes(cloneNode(defaults), p)
+		}
+	}
+}
+
+// mergeNodes merges src over dst and returns the result, reusing dst.
+// Mappings merge key by key; lists of mappings with a name, such as
+// providers, merge entry by entry by name, keeping dst's order and
+// appending new names; anything else in src replaces dst.
+func mergeNodes(dst, src *yaml.Node) *yaml.Node {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+			if j := keyIndex(dst, key.Value); j >= 0 {
+				dst.Content[j+1] = mergeNodes(dst.Content[j+1], value)
+			} else {
+				dst.Content = append(dst.Content, key, value)
+			}
+		}
+		return dst
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode && namedItems(dst) && namedItems(src):
+		for _, item := range src.Content {
+			name := mappingValue(item, "name").Value
+			merged := false
+			for i, existing := range dst.Content {
+				if mappingValue(existing, "name").Value == name {
+					dst.Content[i] = mergeNodes(existing, item)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				dst.Content = append(dst.Content, item)
+			}
+		}
+		return dst
+	}
+	return src
+}
+
+// namedItems reports whether every entry of a list is a mapping with a name
+func namedItems(seq *yaml.Node) bool {
+	for _, item := range seq.Content {
+		if item.Kind != yaml.MappingNode {
+			return false
+		}
+		if name := mappingValue(item, "name"); name == nil || name.Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+	return true
+}
+
+// cloneNode deep-copies n
+func cloneNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = cloneNode(child)
+	}
+	return &c
+}
+
+// keyIndex returns the index of key in the mapping m, or -1
+func keyIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// mappingValue returns the value of key in the mapping m, or nil
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	if i := keyIndex(m, key); i >= 0 {
+		return m.Content[i+1]
+	}
+	return nil
+}
+
+// deleteKey removes key from the mapping m
+func deleteKey(m *yaml.Node, key string) {
+	if i := keyIndex(m, key); i >= 0 {
+		m.Content = append(m.Content[:i], m.Content[i+2:]...)
+	}
+}
+
+// expandAliases replaces aliases with copies of their anchored nodes and
+// resolves merge keys (<<: *common), so files merge and defaults apply to
+// plain mappings
+func expandAliases(n *yaml.Node) *yaml.Node {
+	if n.Kind == yaml.AliasNode {
+		return expandAliases(cloneNode(n.Alias))
+	}
+	for i, child := range n.Content {
+		n.Content[i] = expandAliases(child)
+	}
+	if n.Kind != yaml.MappingNode {
+		return n
+	}
+	i := keyIndex(n, "<<")
+	if i < 0 || n.Content[i].ShortTag() != "!!merge" {
+		return n
+	}
+	sources := []*yaml.Node{n.Content[i+1]}
+	if n.Content[i+1].Kind == yaml.SequenceNode {
+		sources = n.Content[i+1].Content
+	}
+	n.Content = append(n.Content[:i], n.Content[i+2:]...)
+	// Keys of the mapping win, then those of earlier sources
+	for _, src := range sources {
+		for j := 0; j+1 < len(src.Content); j += 2 {
+			if keyIndex(n, src.Content[j].Value) < 0 {
+				n.Content = append(n.Content, src.Content[j], src.Content[j+1])
+			}
+		}
+	}
+	return n
+}
+
+// interpolate expands ${VAR} and ${VAR:-default} in every scalar value
+// under n. An unset VAR without a default is an error; the default also
+// applies when VAR is empty. $${ writes a literal ${.
+func interpolate(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, "${") {
+			return nil
+		}
+		value, err := expandEnv(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		n.Value = value
+		if n.Style == 0 {
+			// A plain scalar is typed by its expanded value, so
+			// timeout_sec: ${TIMEOUT:-30} is an int
+			n.Tag = ""
+		}
+		return nil
+	case yaml.MappingNode:
+		// Keys are left alone
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := interpolate(n.Content[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, child := range n.Content {
+		if err := interpolate(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandEnv expands the ${...} references of s
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i])
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		b.WriteString(s[:i])
+		ref := s[i+2 : i+end]
+		name, def, hasDefault := strings.Cut(ref, ":-")
+		if !validEnvName(name) {
+			return "", fmt.Errorf("invalid variable name in ${%s}", ref)
+		}
+		switch value, set := os.LookupEnv(name); {
+		case set && value != "":
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(def)
+		case set:
+			// Set but empty, no default: empty is what was asked for
+		default:
+			return "", fmt.Errorf("environment variable %s is not set (use ${%s:-default})", name, name)
+		}
+		s = s[i+end+1:]
+	}
+}
+
+func validEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,329 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Local runtime types that support model discovery
+const (
+	TypeOllama   = "ollama"
+	TypeLMStudio = "lmstudio"
+)
+
+// DefaultDiscoverInterval is how often auto_discover providers are re-queried
+const DefaultDiscoverInterval = time.Minute
+
+// discoveryTimeout bounds a single discovery request, so a runtime that is
+// down never holds up startup for long
+const discoveryTimeout = 3 * time.Second
+
+// Discovery is the last known state of a local runtime
+type Discovery struct {
+	Reachable bool      `json:"reachable"`
+	Models    []string  `json:"models"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// discoveryState guards a provider's Discovery
+type discoveryState struct {
+	mu    sync.RWMutex
+	state *Discovery // nil until the first check completes
+}
+
+func (d *discoveryState) get() *Discovery {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.state
+}
+
+func (d *discoveryState) set(s *Discovery) {
+	d.mu.Lock()
+	d.state = s
+	d.mu.Unlock()
+}
+
+// discoverable reports whether the provider should be queried for models
+func (p *Provider) discoverable() bool {
+	return p.Config.AutoDiscover && (p.Config.Type == TypeOllama || p.Config.Type == TypeLMStudio)
+}
+
+// Discovery returns the provider's last discovery result, or nil if the
+// provider doesn't use auto_discover or hasn't been checked yet
+func (p *Provider) Discovery() *Discovery {
+	return p.discovery.get()
+}
+
+// Discover queries every auto_discover provider once. Unreachable runtimes
+// are marked unhealthy and recorded, never treated as fatal.
+func (r *Router) Discover(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range r.current().providers {
+		if !p.discoverable() {
+			continue
+		}
+		wg.Add(1)
+		go func(p *Provider) {
+			defer wg.Done()
+			r.discoverProvider(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// StartDiscovery runs Discover now and then every interval until ctx is done
+func (r *Router) StartDiscovery(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultDiscoverInterval
+	}
+	r.Discover(ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.Discover(ctx)
+			}
+		}
+	}()
+}
+
+func (r *Router) discoverProvider(ctx context.Context, p *Provider) {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	models, err := fetchModels(ctx, p)
+	state := &Discovery{CheckedAt: time.Now(), Models: models}
+	if err != nil {
+		state.Error = err.Error()
+		// Keep the last known model list so a blip doesn't reject requests
+		if prev := p.discovery.get(); prev != nil {
+			state.Models = prev.Models
+		}
+		if p.healthy.Swap(false) {
+			slog.Warn("local runtime unreachable", "provider", p.Config.Name, "error", err)
+		}
+	} else {
+		state.Reachable = true
+		if !p.healthy.Swap(true) {
+			slog.Info("local runtime reachable", "provider", p.Config.Name, "models", len(models))
+		}
+	}
+	p.discovery.set(state)
+}
+
+// fetchModels lists models through the runtime's native API
+func fetchModels(ctx context.Context, p *Provider) ([]string, error) {
+	// Native endpoints live at the server root even when base_url points
+	// at an OpenAI-compatible /v1 prefix
+	root := p.Target.Scheme + "://" + p.Target.Host
+	var url string
+	switch p.Config.Type {
+	case TypeOllama:
+		url = root + "/api/tags"
+	case TypeLMStudio:
+		url = root + "/v1/models"
+	default:
+		return nil, fmt.Errorf("discovery not supported for type %q", p.Config.Type)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+
+	var body struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"` // Ollama
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"` // LM Studio (OpenAI format)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", url, err)
+	}
+
+	models := []string{}
+	for _, m := range body.Models {
+		models = append(models, m.Name)
+	}
+	for _, m := range body.Data {
+		models = append(models, m.ID)
+	}
+	sort.Strings(models)
+	return models, nil
+}
+
+// hasModel matches a requested model against the discovered list. Ollama
+// treats "llama3" and "llama3:latest" as the same model.
+func hasModel(models []string, model string) bool {
+	for _, m := range models {
+		if m == model || m == model+":latest" || strings.TrimSuffix(m, ":latest") == model {
+			return true
+		}
+	}
+	return false
+}
+
+// checkModel rejects requests for a model the runtime doesn't have. It only
+// applies once discovery has produced a model list; an unknown state lets
+// the request through to the runtime.
+func checkModel(w http.ResponseWriter, req *http.Request, p *Provider) bool {
+	if !p.discoverable() || req.Body == nil || req.Method != http.MethodPost {
+		return true
+	}
+	state := p.discovery.get()
+	if state == nil || len(state.Models) == 0 {
+		return true
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return true
+	}
+	var fields struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(body, &fields) != nil || fields.Model == "" || hasModel(state.Models, fields.Model) {
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"type": "invalid_request_error",
+			"code": "model_not_found",
+			"message": fmt.Sprintf("model %q is not available on provider %s; available models: %s",
+				fields.Model, p.Config.Name, strings.Join(state.Models, ", ")),
+			"available_models": state.Models,
+		},
+	})
+	return false
+}
+
+// providerStatus is one entry of GET /admin/providers
+type providerStatus struct {
+	Name         string     `json:"name"`
+	Type         string     `json:"type,omitempty"`
+	BaseURL      string     `json:"base_url"`
+	Healthy      bool       `json:"healthy"`
+	Priority     int        `json:"priority"`
+	Required     bool       `json:"required"`
+	Region       string     `json:"region,omitempty"`
+	Model        string     `json:"model,omitempty"`
+	APIKey       string     `json:"api_key,omitempty"` // fingerprint only
+	AutoDiscover bool       `json:"auto_discover"`
+	Discovery    *Discovery `json:"discovery,omitempty"`
+	Metrics      Metrics    `json:"metrics"`
+
+	// RateLimitedUntil is when a provider that answered 429 or 503 is
+	// routed to again; it stays healthy meanwhile
+	RateLimitedUntil *time.Time `json:"rate_limited_until,omitempty"`
+}
+
+// ProvidersHandler serves GET /admin/providers with health and discovered models
+func (r *Router) ProvidersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		providers := r.current().providers
+		out := make([]providerStatus, 0, len(providers))
+		now := time.Now()
+		for name, p := range providers {
+			status := providerStatus{
+				Name:         name,
+				Type:         p.Config.Type,
+				BaseURL:      p.Config.BaseURL,
+				Healthy:      p.healthy.Load(),
+				Priority:     p.Config.Priority,
+				Required:     p.Config.Required,
+				Region:       p.Config.Region,
+				Model:        p.Config.Model,
+				APIKey:       p.Config.KeyFingerprint(),
+				AutoDiscover: p.discoverable(),
+				Discovery:    p.Discovery(),
+				Metrics:      p.Metrics(),
+			}
+			if wait, _ := p.coolingDown(now); wait > 0 {
+				until := now.Add(wait)
+				status.RateLimitedUntil = &until
+			}
+			out = append(out, status)
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"providers": out})
+	}
+}
+
+// modelEntry is one entry of the OpenAI-format model list
+type modelEntry struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// HasDiscovery reports whether any provider uses auto_discover
+func (r *Router) HasDiscovery() bool {
+	for _, p := range r.current().providers {
+		if p.discoverable() {
+			return true
+		}
+	}
+	return false
+}
+
+// ModelsHandler serves an aggregated OpenAI-format GET /v1/models: the
+// discovered models of local runtimes plus each other provider's configured
+// default model. owned_by names the provider that serves the model.
+func (r *Router) ModelsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		data := []modelEntry{}
+		for name, p := range r.current().providers {
+			var models []string
+			if p.discoverable() {
+				if state := p.Discovery(); state != nil {
+					models = state.Models
+				}
+			} else if p.Config.Model != "" {
+				models = []string{p.Config.Model}
+			}
+			for _, m := range models {
+				data = append(data, modelEntry{ID: m, Object: "model", OwnedBy: name})
+			}
+		}
+		sort.Slice(data, func(i, j int) bool {
+			if data[i].OwnedBy != data[j].OwnedBy {
+				return data[i].OwnedBy < data[j].OwnedBy
+			}
+			return data[i].ID < data[j].ID
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data})
+	}
+}
@@ -0,0 +1,193 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Health check defaults, for the fields of a health_check block left empty
+const (
+	DefaultHealthCheckInterval = 30 * time.Second
+	DefaultHealthCheckTimeout  = 5 * time.Second
+)
+
+// HealthCheckConfig makes the router probe a provider in the background
+// instead of waiting for a request to fail. Without it a provider is marked
+// unhealthy by a failed request and restored healthRecoveryDelay later.
+type HealthCheckConfig struct {
+	Path           string `yaml:"path"`            // requested with GET under base_url, probePath when empty
+	IntervalSec    int    `yaml:"interval_sec"`    // between probes, DefaultHealthCheckInterval when 0
+	TimeoutSec     int    `yaml:"timeout_sec"`     // per probe, DefaultHealthCheckTimeout when 0
+	ExpectedStatus int    `yaml:"expected_status"` // the status of a healthy provider, 200 when 0
+}
+
+// validate fills in the defaults and checks the fields of provider name
+func (c *HealthCheckConfig) validate(name string) error {
+	if c.Path == "" {
+		c.Path = probePath
+	}
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("provider %s: health_check.path %q must start with /", name, c.Path)
+	}
+	if c.IntervalSec == 0 {
+		c.IntervalSec = int(DefaultHealthCheckInterval / time.Second)
+	}
+	if c.TimeoutSec == 0 {
+		c.TimeoutSec = int(DefaultHealthCheckTimeout / time.Second)
+	}
+	if c.IntervalSec < 0 || c.TimeoutSec < 0 {
+		return fmt.Errorf("provider %s: health_check intervals must not be negative", name)
+	}
+	if c.TimeoutSec > c.IntervalSec {
+		return fmt.Errorf("provider %s: health_check.timeout_sec %d exceeds interval_sec %d", name, c.TimeoutSec, c.IntervalSec)
+	}
+	if c.ExpectedStatus == 0 {
+		c.ExpectedStatus = http.StatusOK
+	}
+	if c.ExpectedStatus < 100 || c.ExpectedStatus > 599 {
+		return fmt.Errorf("provider %s: health_check.expected_status %d is not an HTTP status", name, c.ExpectedStatus)
+	}
+	return nil
+}
+
+// HealthStatus is a provider's health as ProviderStatus reports it
+type HealthStatus struct {
+	Healthy bool `json:"healthy"`
+	// Active is set for providers with a health_check; the fields below
+	// stay empty for the others
+	Active              bool      `json:"active"`
+	LastCheck           time.Time `json:"last_check"` // zero before the first probe
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+// healthState is the outcome of a provider's latest probes
+type healthState struct {
+	mu        sync.Mutex
+	lastCheck time.Time
+	failures  int // consecutive
+	lastError string
+}
+
+// ProviderStatus returns the health of the named provider, false when
+// there is no such enabled provider
+func (r *Router) ProviderStatus(name string) (HealthStatus, bool) {
+	p, ok := r.current().providers[name]
+	if !ok {
+		return HealthStatus{}, false
+	}
+	status := HealthStatus{Healthy: p.healthy.Load(), Active: p.Config.HealthCheck != nil}
+	p.health.mu.Lock()
+	status.LastCheck = p.health.lastCheck
+	status.ConsecutiveFailures = p.health.failures
+	status.LastError = p.health.lastError
+	p.health.mu.Unlock()
+	return status, true
+}
+
+// startHealthChecks starts a probe goroutine per provider of set with a
+// health_check, stopped by Close, Shutdown or the Reload that replaces set
+func (r *Router) startHealthChecks(set *providerSet) {
+	for _, p := range set.providers {
+		if p.Config.HealthCheck == nil {
+			continue
+		}
+		r.checks.Add(1)
+		go func() {
+			defer r.checks.Done()
+			p.runHealthCheck(set.ctx)
+		}()
+	}
+}
+
+// runHealthCheck probes p now and then every interval until ctx is done
+func (p *Provider) runHealthCheck(ctx context.Context) {
+	hc := p.Config.HealthCheck
+	ticker := time.NewTicker(time.Duration(hc.IntervalSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		p.checkHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHealth probes p once and records the outcome
+func (p *Provider) checkHealth(stop context.Context) {
+	hc := p.Config.HealthCheck
+	ctx, cancel := context.WithTimeout(stop, time.Duration(hc.TimeoutSec)*time.Second)
+	defer cancel()
+	err := p.healthProbe(ctx, hc)
+	if stop.Err() != nil {
+		return // stopped mid-probe, which says nothing of the provider
+	}
+
+	p.health.mu.Lock()
+	p.health.lastCheck = time.Now()
+	if err != nil {
+		p.health.failures++
+		p.health.lastError = err.Error()
+	} else {
+		p.health.failures = 0
+		p.health.lastError = ""
+	}
+	failures := p.health.failures
+	p.health.mu.Unlock()
+
+	switch {
+	case err != nil && p.healthy.Swap(false):
+		slog.Warn("provider health check failed", "provider", p.Config.Name, "error", err)
+	case err != nil:
+		slog.Debug("provider still unhealthy", "provider", p.Config.Name, "failures", failures, "error", err)
+	case !p.healthy.Swap(true):
+		slog.Info("provider health restored", "provider", p.Config.Name)
+	}
+}
+
+// healthProbe requests the health_check path with the provider's API key,
+// over the provider's own upstream transport so a probe reaches it as
+// requests do. The wrappers of WrapTransport, such as the response cache,
+// are left out: a probe must see the provider, not a cached answer.
+func (p *Provider) healthProbe(ctx context.Context, hc *HealthCheckConfig) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Target.String(), nil)
+	if err != nil {
+		return err
+	}
+	path, query, _ := strings.Cut(hc.Path, "?")
+	req.URL.Path = singleJoiningSlash(p.Target.Path, path)
+	req.URL.RawQuery = query
+	p.Config.setAuth(req)
+	client := &http.Client{Transport: p.transport, Timeout: time.Duration(hc.TimeoutSec) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		// Transport errors quote the URL, which carries the key with auth_method=query
+		msg := err.Error()
+		if p.Config.APIKey != "" {
+			msg = strings.ReplaceAll(msg, p.Config.APIKey, p.Config.KeyFingerprint())
+		}
+		return errors.New(msg)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode != hc.ExpectedStatus {
+		return fmt.Errorf("%s returned %d, want %d", path, resp.StatusCode, hc.ExpectedStatus)
+	}
+	return nil
+}
+
+// Close stops the health check goroutines and waits for them. Requests are
+// still served; Shutdown also drains them.
+func (r *Router) Close() {
+	r.cancel()
+	r.checks.Wait()
+}
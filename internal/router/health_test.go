@@ -0,0 +1,142 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck_FlipsHealth(t *testing.T) {
+	var status, probes atomic.Int64
+	status.Store(http.StatusServiceUnavailable)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/healthz" {
+			probes.Add(1)
+			w.WriteHeader(int(status.Load()))
+		}
+	}))
+	defer srv.Close()
+
+	cfg, err := ParseConfig(`
+providers:
+  - name: primary
+    base_url: ` + srv.URL + `/api
+    enabled: true
+    health_check: {path: /healthz, interval_sec: 1, timeout_sec: 1}
+  - {name: passive, base_url: "https://passive.example", enabled: true}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	waitFor := func(what string, cond func(HealthStatus) bool) HealthStatus {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for {
+			st, _ := r.ProviderStatus("primary")
+			if cond(st) {
+				return st
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: status %+v", what, st)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	st := waitFor("unhealthy after a failed probe", func(st HealthStatus) bool { return !st.Healthy })
+	if !st.Active || st.ConsecutiveFailures < 1 || st.LastCheck.IsZero() || !strings.Contains(st.LastError, "503") {
+		t.Errorf("status = %+v", st)
+	}
+	status.Store(http.StatusOK)
+	st = waitFor("healthy after a good probe", func(st HealthStatus) bool { return st.Healthy })
+	if st.ConsecutiveFailures != 0 || st.LastError != "" {
+		t.Errorf("status = %+v", st)
+	}
+
+	if st, ok := r.ProviderStatus("passive"); !ok || st.Active || !st.Healthy || !st.LastCheck.IsZero() {
+		t.Errorf("passive provider status = %+v, %v", st, ok)
+	}
+	if _, ok := r.ProviderStatus("unknown"); ok {
+		t.Error("status of an unknown provider")
+	}
+
+	r.Close()
+	after := probes.Load()
+	time.Sleep(1200 * time.Millisecond)
+	if probes.Load() != after {
+		t.Error("probes continued after Close")
+	}
+}
+
+func TestHealthCheck_Config(t *testing.T) {
+	cfg, err := ParseConfig(`providers: [{name: a, base_url: "https://a.example", enabled: true, health_check: {}}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hc := cfg.Providers[0].HealthCheck; *hc != (HealthCheckConfig{Path: probePath, IntervalSec: 30, TimeoutSec: 5, ExpectedStatus: 200}) {
+		t.Errorf("defaults = %+v", *hc)
+	}
+
+	for name, hc := range map[string]string{
+		"relative path": "{path: healthz}",
+		"slow timeout":  "{interval_sec: 2, timeout_sec: 5}",
+		"negative":      "{interval_sec: -1}",
+		"not a status":  "{expected_status: 42}",
+	} {
+		yaml := `providers: [{name: a, base_url: "https://a.example", enabled: true, health_check: ` + hc + `}]`
+		if _, err := ParseConfig(yaml); err == nil || !strings.Contains(err.Error(), "health_check") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
+
+// roundTripFunc is an http.RoundTripper standing in for a provider's
+// upstream transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestHealthCheck_ProviderTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || r.Host != "provider.invalid" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg, err := ParseConfig(`providers: [{name: a, base_url: "http://provider.invalid", enabled: true}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// The provider is only reachable through its transport, as through an
+	// egress proxy; the default client can't resolve it
+	p := r.current().providers["a"]
+	base := http.DefaultTransport
+	p.transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		out := req.Clone(req.Context())
+		out.URL.Scheme, out.URL.Host = "http", strings.TrimPrefix(srv.URL, "http://")
+		out.Host = req.URL.Host
+		return base.RoundTrip(out)
+	})
+	hc := &HealthCheckConfig{Path: "/healthz"}
+	if err := hc.validate("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.healthProbe(r.ctx, hc); err != nil {
+		t.Errorf("probe should use the provider's transport: %v", err)
+	}
+}
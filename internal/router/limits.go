@@ -0,0 +1,203 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/vurakit/agentveil/internal/tokenizer"
+)
+
+// EstimateTokens estimates the tokens of text for a model of no known
+// family, see tokenizer.Estimate
+func EstimateTokens(text string) int {
+	return tokenizer.Default().Fallback().Count(text)
+}
+
+// outputTokenFields are the body fields clamped by max_output_tokens_override
+// (OpenAI chat, OpenAI reasoning and Responses API spellings)
+var outputTokenFields = []string{"max_tokens", "max_completion_tokens", "max_output_tokens"}
+
+// limitError is a request refused by a provider's limits
+type limitError struct {
+	status   int
+	code     string
+	provider string
+	message  string
+}
+
+func (e *limitError) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    e.code,
+		"message":  e.message,
+		"provider": e.provider,
+	})
+}
+
+// SetTokenEstimator replaces the tokenizers for max_prompt_tokens checks.
+// fn receives the text of the request: every JSON string value except the
+// model, or the raw body when it is not JSON.
+func (r *Router) SetTokenEstimator(fn func(text string) int) {
+	r.estimateTokens = fn
+}
+
+// SetTokenizers replaces the tokenizers max_prompt_tokens is counted with,
+// selected by the request's model; tokenizer.Default() by default
+func (r *Router) SetTokenizers(reg *tokenizer.Registry) {
+	r.tokenizers = reg
+}
+
+func (p *Provider) hasLimits() bool {
+	c := p.Config
+	return c.MaxRequestBytes > 0 || c.MaxPromptTokens > 0 || c.MaxOutputTokensOverride > 0
+}
+
+// checkLimits returns why p cannot take body, or nil
+func (r *Router) checkLimits(p *Provider, body []byte) *limitError {
+	c := p.Config
+	if c.MaxRequestBytes > 0 && int64(len(body)) > c.MaxRequestBytes {
+		return &limitError{
+			status:   http.StatusRequestEntityTooLarge,
+			code:     "request_too_large",
+			provider: c.Name,
+			message: fmt.Sprintf("request body is %d bytes; provider %s accepts at most %d (max_request_bytes)",
+				len(body), c.Name, c.MaxRequestBytes),
+		}
+	}
+	if c.MaxPromptTokens > 0 {
+		estimate := r.estimateTokens
+		if estimate == nil {
+			reg := r.tokenizers
+			if reg == nil {
+				reg = tokenizer.Default()
+			}
+			estimate = reg.For(bodyModel(body)).Count
+		}
+		if tokens := estimate(promptText(body)); tokens > c.MaxPromptTokens {
+			return &limitError{
+				status:   http.StatusBadRequest,
+				code:     "prompt_too_long",
+				provider: c.Name,
+				message: fmt.Sprintf("prompt is about %d tokens; provider %s accepts at most %d (max_prompt_tokens)",
+					tokens, c.Name, c.MaxPromptTokens),
+			}
+		}
+	}
+	return nil
+}
+
+// bodyModel returns the model field of a JSON request body, or ""
+func bodyModel(body []byte) string {
+	var fields struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(body, &fields)
+	return fields.Model
+}
+
+// promptText is the text of a request body the token estimate is made on
+func promptText(body []byte) string {
+	var doc any
+	if json.Unmarshal(body, &doc) != nil {
+		return string(body)
+	}
+	var buf bytes.Buffer
+	var walk func(key string, v any)
+	walk = func(key string, v any) {
+		switch v := v.(type) {
+		case string:
+			if key != "model" {
+				buf.WriteString(v)
+			}
+		case []any:
+			for _, e := range v {
+				walk(key, e)
+			}
+		case map[string]any:
+			for k, e := range v {
+				walk(k, e)
+			}
+		}
+	}
+	walk("", doc)
+	return buf.String()
+}
+
+// clampOutputTokens lowers the output token fields of body to max where
+// they ask for more. Bodies that are not JSON objects are returned as is.
+func clampOutputTokens(body []byte, max int) []byte {
+	if max <= 0 {
+		return body
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+	changed := false
+	for _, name := range outputTokenFields {
+		n, err := strconv.Atoi(string(fields[name]))
+		if err != nil || n <= max {
+			continue
+		}
+		fields[name] = json.RawMessage(strconv.Itoa(max))
+		changed = true
+	}
+	if !changed {
+		return body
+	}
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// readBody buffers req's body; nil when there is none
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	setBody(req, body)
+	return body, nil
+}
+
+// setBody replaces req's body, so each fallback attempt sends it in full
+func setBody(req *http.Request, body []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// applyLimits checks req against p's limits and clamps its output tokens.
+// It writes the refusal and returns false when p cannot take req.
+func (r *Router) applyLimits(w http.ResponseWriter, req *http.Request, p *Provider) bool {
+	if !p.hasLimits() {
+		return true
+	}
+	body, err := readBody(req)
+	if err != nil {
+		http.Error(w, `{"error":"bad_request","message":"cannot read request body"}`, http.StatusBadRequest)
+		return false
+	}
+	if body == nil {
+		return true
+	}
+	if lerr := r.checkLimits(p, body); lerr != nil {
+		lerr.write(w)
+		return false
+	}
+	setBody(req, clampOutputTokens(body, p.Config.MaxOutputTokensOverride))
+	return true
+}
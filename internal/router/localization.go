@@ -0,0 +1,174 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+)
+
+// DefaultLocalizedCategories are the categories data_localization enforces
+// when enforce_for_categories is empty: Vietnamese citizen identifiers and
+// contact details
+var DefaultLocalizedCategories = []string{"CCCD", "CMND", "PHONE", "ADDRESS"}
+
+// DataLocalizationConfig keeps requests carrying citizen data with
+// providers in approved regions (VN-AI-04). Requests without an enforced
+// category are routed as usual.
+type DataLocalizationConfig struct {
+	Enabled              bool     `yaml:"enabled"`
+	AllowedRegions       []string `yaml:"allowed_regions"`        // provider regions, e.g. [vn]
+	EnforceForCategories []string `yaml:"enforce_for_categories"` // PII categories, DefaultLocalizedCategories when empty
+}
+
+// validate normalizes the policy: regions lower case, categories upper case
+func (c *DataLocalizationConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.AllowedRegions) == 0 {
+		return fmt.Errorf("data_localization: allowed_regions is empty")
+	}
+	for i, region := range c.AllowedRegions {
+		c.AllowedRegions[i] = strings.ToLower(strings.TrimSpace(region))
+	}
+	if len(c.EnforceForCategories) == 0 {
+		c.EnforceForCategories = slices.Clone(DefaultLocalizedCategories)
+	}
+	for i, cat := range c.EnforceForCategories {
+		c.EnforceForCategories[i] = strings.ToUpper(strings.TrimSpace(cat))
+	}
+	return nil
+}
+
+// Summary describes the policy for compliance evidence
+func (c DataLocalizationConfig) Summary() string {
+	return fmt.Sprintf("requests with %s are only routed to providers in region %s",
+		strings.Join(c.EnforceForCategories, ", "), strings.Join(c.AllowedRegions, ", "))
+}
+
+// SetCategoryDetector sets how the router finds the PII categories of a
+// request before choosing a provider, for data_localization. fn receives
+// the text of the request as max_prompt_tokens counts it. Without one,
+// the policy is not applied.
+func (r *Router) SetCategoryDetector(fn func(text string) []string) {
+	r.detectCategories = fn
+}
+
+// SetAuditLog receives the data localization decisions, none when nil
+func (r *Router) SetAuditLog(l *accesslog.Logger) {
+	r.auditLog = l
+}
+
+// localization is the data localization decision for one request
+type localization struct {
+	categories []string        // enforced categories found
+	excluded   []string        // providers outside the allowed regions
+	allowed    map[string]bool // providers inside them
+}
+
+// permits reports whether the request may go to the named provider
+func (l *localization) permits(name string) bool {
+	return l == nil || l.allowed[name]
+}
+
+// localize applies data_localization to req. It returns nil when the
+// request carries no enforced category, and writes 400 and returns false
+// when the body can't be read.
+func (r *Router) localize(set *providerSet, w http.ResponseWriter, req *http.Request) (*localization, bool) {
+	policy := set.localization
+	if !policy.Enabled || r.detectCategories == nil {
+		return nil, true
+	}
+	body, err := readBody(req)
+	if err != nil {
+		http.Error(w, `{"error":"bad_request","message":"cannot read request body"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	if body == nil {
+		return nil, true
+	}
+	var found []string
+	for _, cat := range r.detectCategories(promptText(body)) {
+		if slices.Contains(policy.EnforceForCategories, cat) && !slices.Contains(found, cat) {
+			found = append(found, cat)
+		}
+	}
+	if len(found) == 0 {
+		return nil, true
+	}
+	slices.Sort(found)
+	l := &localization{categories: found, allowed: make(map[string]bool)}
+	for _, name := range set.rrList {
+		region := strings.ToLower(set.providers[name].Config.Region)
+		if region != "" && slices.Contains(policy.AllowedRegions, region) {
+			l.allowed[name] = true
+		} else {
+			l.excluded = append(l.excluded, name)
+		}
+	}
+	return l, true
+}
+
+// pick returns the provider of a localized request: the chosen one when
+// it is allowed, else the first available allowed provider by priority,
+// "" when there is none
+func (l *localization) pick(set *providerSet, chosen string) string {
+	if p, ok := set.providers[chosen]; ok && l.allowed[chosen] && p.available() {
+		return chosen
+	}
+	for _, name := range set.rrList {
+		if l.allowed[name] && set.providers[name].available() {
+			return name
+		}
+	}
+	return ""
+}
+
+// record logs the decision to the access log and the audit log. provider
+// is "" when the request was refused.
+func (l *localization) record(r *Router, req *http.Request, provider string) {
+	decision := accesslog.Localization{Categories: l.categories, Provider: provider, Excluded: l.excluded}
+	accesslog.SetLocalization(req.Context(), decision)
+	outcome := "routed"
+	if provider == "" {
+		outcome = "refused"
+		slog.Warn("data localization: no provider in an allowed region", "categories", l.categories, "excluded", l.excluded)
+	}
+	if r.auditLog == nil {
+		return
+	}
+	reason := "found " + strings.Join(l.categories, ", ")
+	if provider != "" {
+		reason += "; routed to " + provider
+	}
+	if len(l.excluded) > 0 {
+		reason += "; excluded " + strings.Join(l.excluded, ", ")
+	}
+	r.auditLog.Audit(accesslog.AuditEvent{
+		Event:     "data_localization",
+		KeyID:     req.Header.Get("X-Veil-Key-ID"),
+		Role:      req.Header.Get("X-User-Role"),
+		SessionID: req.Header.Get("X-Session-ID"),
+		Reason:    reason,
+		Outcome:   outcome,
+	})
+}
+
+// refuse answers a localized request no allowed provider can serve with
+// 451, rather than sending it out of the allowed regions
+func (l *localization) refuse(w http.ResponseWriter, allowedRegions []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnavailableForLegalReasons)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": "data_localization",
+		"message": fmt.Sprintf("request contains %s, which may only be sent to providers in region %s, and none is available",
+			strings.Join(l.categories, ", "), strings.Join(allowedRegions, ", ")),
+		"categories": l.categories,
+		"excluded":   l.excluded,
+	})
+}
@@ -0,0 +1,119 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+)
+
+// newLocalizedRouter routes to openai (region us, priority 1) and fpt
+// (region vn), with CCCD numbers detected by a stub
+func newLocalizedRouter(t *testing.T, fallback bool) (*Router, map[string]*atomic.Int64, *bytes.Buffer) {
+	t.Helper()
+	hits := map[string]*atomic.Int64{}
+	yaml := "data_localization:\n  enabled: true\n  allowed_regions: [VN]\nfallback:\n  enabled: " + strconv.FormatBool(fallback) + "\nproviders:\n"
+	for i, p := range []struct{ name, region string }{{"openai", "us"}, {"fpt", "vn"}} {
+		count := new(atomic.Int64)
+		hits[p.name] = count
+		name := p.name
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count.Add(1)
+			io.ReadAll(r.Body)
+			json.NewEncoder(w).Encode(map[string]string{"provider": name})
+		}))
+		t.Cleanup(srv.Close)
+		yaml += "  - {name: " + p.name + ", base_url: " + srv.URL + ", region: " + p.region + ", enabled: true, priority: " + strconv.Itoa(i+1) + "}\n"
+	}
+	cfg, err := ParseConfig(yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetCategoryDetector(func(text string) []string {
+		if strings.Contains(text, "012345678901") {
+			return []string{"EMAIL", "CCCD"}
+		}
+		return nil
+	})
+	audit := &bytes.Buffer{}
+	r.SetAuditLog(accesslog.NewWithWriter(audit, accesslog.FieldsCommon))
+	return r, hits, audit
+}
+
+func TestDataLocalization_Routes(t *testing.T) {
+	for _, fallback := range []bool{false, true} {
+		r, hits, audit := newLocalizedRouter(t, fallback)
+
+		w, resp := postChat(r, `{"messages":[{"role":"user","content":"hello"}]}`)
+		if w.Code != http.StatusOK || resp["provider"] != "openai" {
+			t.Errorf("fallback=%v: plain request went to %s (%d), want openai", fallback, resp["provider"], w.Code)
+		}
+		w, resp = postChat(r, `{"messages":[{"role":"user","content":"CCCD 012345678901"}]}`)
+		if w.Code != http.StatusOK || resp["provider"] != "fpt" {
+			t.Errorf("fallback=%v: CCCD request went to %s (%d), want fpt", fallback, resp["provider"], w.Code)
+		}
+		if !strings.Contains(audit.String(), `"event":"data_localization"`) || !strings.Contains(audit.String(), "excluded openai") {
+			t.Errorf("fallback=%v: audit log = %s", fallback, audit.String())
+		}
+
+		// No healthy provider in the region: refused, not sent to openai
+		r.SetHealthy("fpt", false)
+		w, _ = postChat(r, `{"messages":[{"role":"user","content":"CCCD 012345678901"}]}`)
+		if w.Code != http.StatusUnavailableForLegalReasons || !strings.Contains(w.Body.String(), `"error":"data_localization"`) {
+			t.Errorf("fallback=%v: got %d %s, want 451", fallback, w.Code, w.Body.String())
+		}
+		if hits["openai"].Load() != 1 || hits["fpt"].Load() != 1 {
+			t.Errorf("fallback=%v: upstream requests openai %d, fpt %d; want 1, 1", fallback, hits["openai"].Load(), hits["fpt"].Load())
+		}
+	}
+}
+
+func TestDataLocalization_AccessLog(t *testing.T) {
+	r, _, _ := newLocalizedRouter(t, false)
+	var buf bytes.Buffer
+	h := accesslog.NewWithWriter(&buf, accesslog.FieldsExtended).Middleware(r)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[{"content":"012345678901"}]}`)))
+
+	var entry accesslog.Entry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	l := entry.Localization
+	if l == nil || l.Provider != "fpt" || strings.Join(l.Categories, ",") != "CCCD" || strings.Join(l.Excluded, ",") != "openai" {
+		t.Errorf("localization = %+v", l)
+	}
+}
+
+func TestDataLocalization_Config(t *testing.T) {
+	cfg, err := ParseConfig(`
+data_localization: {enabled: true, allowed_regions: [vn]}
+providers:
+  - {name: fpt, base_url: "https://ai.example.vn", region: VN, enabled: true}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cfg.DataLocalization.EnforceForCategories, ","); got != "CCCD,CMND,PHONE,ADDRESS" {
+		t.Errorf("default categories = %s", got)
+	}
+
+	for name, yaml := range map[string]string{
+		"no regions":          "data_localization: {enabled: true}\nproviders: [{name: a, base_url: \"https://a.example\", enabled: true}]",
+		"no allowed provider": "data_localization: {enabled: true, allowed_regions: [vn]}\nproviders: [{name: a, base_url: \"https://a.example\", region: us, enabled: true}]",
+	} {
+		if _, err := ParseConfig(yaml); err == nil || !strings.Contains(err.Error(), "data_localization") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
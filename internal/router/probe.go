@@ -0,0 +1,71 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/vurakit/agentveil/internal/readiness"
+)
+
+// probePath is requested from providers without discovery. It is the model
+// list of OpenAI-compatible and Anthropic APIs; an API without it still
+// answers, with a 404, which is enough to show the provider is reachable.
+const probePath = "/v1/models"
+
+// ReadinessChecks returns a startup probe per enabled provider, by name.
+// Local runtimes with auto_discover are probed through discovery; other
+// providers with GET base_url/v1/models carrying the provider API key.
+func (r *Router) ReadinessChecks() []readiness.Check {
+	providers := r.current().providers
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]readiness.Check, 0, len(names))
+	for _, name := range names {
+		p := providers[name]
+		checks = append(checks, readiness.Check{
+			Name:     name,
+			Kind:     readiness.KindProvider,
+			Required: p.Config.Required,
+			Probe:    p.probe,
+		})
+	}
+	return checks
+}
+
+// probe reports whether the provider answers, with its key accepted
+func (p *Provider) probe(ctx context.Context) error {
+	if p.discoverable() {
+		_, err := fetchModels(ctx, p)
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Target.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.URL.Path = singleJoiningSlash(p.Target.Path, probePath)
+	p.Config.setAuth(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Transport errors quote the URL, which carries the key with auth_method=query
+		msg := err.Error()
+		if p.Config.APIKey != "" {
+			msg = strings.ReplaceAll(msg, p.Config.APIKey, p.Config.KeyFingerprint())
+		}
+		return errors.New(msg)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("API key %s rejected with %d", p.Config.KeyFingerprint(), resp.StatusCode)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("%s returned %d", probePath, resp.StatusCode)
+	}
+	return nil
+}
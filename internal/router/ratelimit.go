@@ -0,0 +1,258 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimitCooldown is how long a provider that answered 429 or 503 without
+// a retry hint is passed over
+const rateLimitCooldown = time.Second
+
+// maxRetryInfoBody bounds how much of an error body is read for a retry hint
+const maxRetryInfoBody = 64 << 10
+
+// errRateLimited tells the ErrorHandler a rate-limited response was kept
+// back for fallback, so it writes nothing and leaves the provider healthy
+var errRateLimited = errors.New("provider rate limited")
+
+// RateLimitError is the body of a provider's 429 or 503, normalized so
+// agents see one shape whichever provider answered:
+//
+//	{"error":{"type":"rate_limited","provider":"openai","retry_after_ms":1500,"message":"..."}}
+type RateLimitError struct {
+	Type         string `json:"type"` // "rate_limited" (429) or "overloaded" (503)
+	Provider     string `json:"provider"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+	Message      string `json:"message"`
+}
+
+// rateLimit is a 429 or 503 from a provider and how long to wait before
+// sending it more requests
+type rateLimit struct {
+	provider   string
+	status     int
+	retryAfter time.Duration // zero when the provider gave no hint
+}
+
+func isRateLimited(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// body returns the normalized JSON body
+func (rl rateLimit) body() []byte {
+	e := RateLimitError{
+		Type:         "rate_limited",
+		Provider:     rl.provider,
+		RetryAfterMs: rl.retryAfter.Milliseconds(),
+		Message:      fmt.Sprintf("provider %s is rate limiting requests", rl.provider),
+	}
+	if rl.status == http.StatusServiceUnavailable {
+		e.Type = "overloaded"
+		e.Message = fmt.Sprintf("provider %s is overloaded", rl.provider)
+	}
+	if rl.retryAfter > 0 {
+		e.Message += "; retry after " + rl.retryAfter.String()
+	}
+	data, _ := json.Marshal(map[string]RateLimitError{"error": e})
+	return data
+}
+
+// setHeaders sets the normalized headers: Retry-After in whole seconds,
+// rounded up so clients never retry early
+func (rl rateLimit) setHeaders(h http.Header) {
+	h.Set("Content-Type", "application/json")
+	h.Del("Content-Encoding")
+	h.Del("Retry-After-Ms")
+	h.Del("Retry-After")
+	if rl.retryAfter > 0 {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(rl.retryAfter.Seconds()))))
+	}
+}
+
+// write answers the client with the normalized response
+func (rl rateLimit) write(w http.ResponseWriter) {
+	body := rl.body()
+	rl.setHeaders(w.Header())
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(rl.status)
+	w.Write(body)
+}
+
+// rewrite replaces resp's body and headers with the normalized ones
+func (rl rateLimit) rewrite(resp *http.Response) {
+	body := rl.body()
+	rl.setHeaders(resp.Header)
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Body = io.NopCloser(strings.NewReader(string(body)))
+	resp.ContentLength = int64(len(body))
+}
+
+// cooldown is when a rate-limited provider may be sent requests again
+type cooldown struct {
+	status int
+	until  time.Time
+}
+
+// coolingDown returns how long p is still passed over after a 429 or 503,
+// and the status it answered with
+func (p *Provider) coolingDown(now time.Time) (time.Duration, int) {
+	c := p.cooldown.Load()
+	if c == nil || !now.Before(c.until) {
+		return 0, 0
+	}
+	return c.until.Sub(now), c.status
+}
+
+// available reports whether p is healthy and not cooling down
+func (p *Provider) available() bool {
+	wait, _ := p.coolingDown(time.Now())
+	return p.healthy.Load() && wait == 0
+}
+
+// rateLimitSlotKey carries a *rateLimit on requests served with fallback.
+// A rate-limited response is stored there instead of reaching the client,
+// so the next provider can be tried at once.
+type rateLimitSlotKey struct{}
+
+func withRateLimitSlot(ctx context.Context, slot *rateLimit) context.Context {
+	return context.WithValue(ctx, rateLimitSlotKey{}, slot)
+}
+
+// rateLimited handles a 429 or 503 from p: the provider stays healthy but is
+// passed over until its retry hint passes, and the response is normalized,
+// or kept back when the request can fall back to another provider
+func (r *Router) rateLimited(p *Provider, resp *http.Response) error {
+	var body []byte
+	if ce := resp.Header.Get("Content-Encoding"); ce == "" || ce == "identity" {
+		body, _ = io.ReadAll(io.LimitReader(resp.Body, maxRetryInfoBody))
+	}
+	resp.Body.Close()
+
+	now := time.Now()
+	rl := rateLimit{provider: p.Config.Name, status: resp.StatusCode, retryAfter: retryAfter(resp.Header, body, now)}
+	wait := max(rl.retryAfter, rateLimitCooldown)
+	p.cooldown.Store(&cooldown{status: rl.status, until: now.Add(wait)})
+	slog.Warn("provider rate limited", "provider", rl.provider, "status", rl.status, "retry_after", rl.retryAfter)
+
+	if slot, ok := resp.Request.Context().Value(rateLimitSlotKey{}).(*rateLimit); ok {
+		*slot = rl
+		return errRateLimited
+	}
+	rl.rewrite(resp)
+	return nil
+}
+
+// retryAfter reads the retry hint of a 429 or 503 in any provider's
+// convention: the standard headers first, then OpenAI's and Anthropic's
+// rate-limit headers, then Gemini's RetryInfo. Zero when there is none.
+func retryAfter(h http.Header, body []byte, now time.Time) time.Duration {
+	if d := retryAfterHeader(h, now); d > 0 {
+		return d
+	}
+	if d := openAIRetryAfter(h); d > 0 {
+		return d
+	}
+	if d := anthropicRetryAfter(h, now); d > 0 {
+		return d
+	}
+	return geminiRetryAfter(body)
+}
+
+// retryAfterHeader parses retry-after-ms (OpenAI, milliseconds) or
+// Retry-After (seconds or an HTTP date)
+func retryAfterHeader(h http.Header, now time.Time) time.Duration {
+	if v := h.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return max(time.Duration(secs*float64(time.Second)), 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// openAIRetryAfter returns the longest reset of OpenAI's exhausted limits:
+// x-ratelimit-reset-{requests,tokens} are durations such as "1s" or
+// "6m0s", counted once x-ratelimit-remaining-* reaches zero
+func openAIRetryAfter(h http.Header) time.Duration {
+	var wait time.Duration
+	for _, limit := range []string{"requests", "tokens"} {
+		if h.Get("X-Ratelimit-Remaining-"+limit) != "0" {
+			continue
+		}
+		if d, err := time.ParseDuration(h.Get("X-Ratelimit-Reset-" + limit)); err == nil {
+			wait = max(wait, d)
+		}
+	}
+	return wait
+}
+
+// anthropicRetryAfter returns the longest wait for Anthropic's exhausted
+// limits: anthropic-ratelimit-*-reset are RFC 3339 times, counted once the
+// matching anthropic-ratelimit-*-remaining reaches zero
+func anthropicRetryAfter(h http.Header, now time.Time) time.Duration {
+	var wait time.Duration
+	for _, limit := range []string{"requests", "tokens", "input-tokens", "output-tokens"} {
+		prefix := "Anthropic-Ratelimit-" + limit
+		if h.Get(prefix+"-Remaining") != "0" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, h.Get(prefix+"-Reset")); err == nil {
+			wait = max(wait, t.Sub(now))
+		}
+	}
+	return wait
+}
+
+// geminiError is the part of a Google API error carrying RetryInfo
+type geminiError struct {
+	Error struct {
+		Details []struct {
+			Type       string `json:"@type"`
+			RetryDelay string `json:"retryDelay"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// geminiRetryAfter reads the retryDelay of the google.rpc.RetryInfo detail
+// in a Gemini error body, e.g. "37s". Streaming endpoints wrap the error in
+// an array.
+func geminiRetryAfter(body []byte) time.Duration {
+	var errs []geminiError
+	if err := json.Unmarshal(body, &errs); err != nil {
+		var single geminiError
+		if json.Unmarshal(body, &single) != nil {
+			return 0
+		}
+		errs = []geminiError{single}
+	}
+	for _, e := range errs {
+		for _, d := range e.Error.Details {
+			if !strings.HasSuffix(d.Type, "google.rpc.RetryInfo") {
+				continue
+			}
+			if delay, err := time.ParseDuration(d.RetryDelay); err == nil && delay > 0 {
+				return delay
+			}
+		}
+	}
+	return 0
+}
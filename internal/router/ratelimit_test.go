@@ -0,0 +1,235 @@
+package router
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fixture is a provider response captured in testdata/ratelimit
+type fixture struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func loadFixture(t *testing.T, name string) fixture {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "ratelimit", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	resp, err := http.ReadResponse(bufio.NewReader(f), nil)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return fixture{status: resp.StatusCode, header: resp.Header, body: body}
+}
+
+// serve replays the fixture
+func (f fixture) serve(w http.ResponseWriter) {
+	for k, v := range f.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(f.status)
+	w.Write(f.body)
+}
+
+// anthropicNow is 20s before the exhausted input token limit of
+// anthropic_429.http resets
+var anthropicNow = time.Date(2025, 3, 14, 9, 27, 0, 0, time.UTC)
+
+func TestRetryAfter_Fixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		parse   func(fixture) time.Duration
+		want    time.Duration
+	}{
+		{"openai_429.http", func(f fixture) time.Duration { return openAIRetryAfter(f.header) }, 1421 * time.Millisecond},
+		{"openai_429.http", func(f fixture) time.Duration { return retryAfterHeader(f.header, anthropicNow) }, 0},
+		{"openai_429_retry_after.http", func(f fixture) time.Duration { return retryAfterHeader(f.header, anthropicNow) }, 20 * time.Millisecond},
+		{"openai_429_retry_after.http", func(f fixture) time.Duration { return openAIRetryAfter(f.header) }, 7*time.Minute + 12*time.Second},
+		{"anthropic_429.http", func(f fixture) time.Duration { return anthropicRetryAfter(f.header, anthropicNow) }, 20 * time.Second},
+		{"anthropic_429.http", func(f fixture) time.Duration { return retryAfterHeader(f.header, anthropicNow) }, 27 * time.Second},
+		{"gemini_429.http", func(f fixture) time.Duration { return geminiRetryAfter(f.body) }, 37 * time.Second},
+		{"gemini_503.http", func(f fixture) time.Duration { return geminiRetryAfter(f.body) }, 0},
+		{"openai_429.http", func(f fixture) time.Duration { return geminiRetryAfter(f.body) }, 0},
+
+		// The standard headers win over provider-specific ones
+		{"openai_429.http", func(f fixture) time.Duration { return retryAfter(f.header, f.body, anthropicNow) }, 1421 * time.Millisecond},
+		{"openai_429_retry_after.http", func(f fixture) time.Duration { return retryAfter(f.header, f.body, anthropicNow) }, 20 * time.Millisecond},
+		{"anthropic_429.http", func(f fixture) time.Duration { return retryAfter(f.header, f.body, anthropicNow) }, 27 * time.Second},
+		{"gemini_429.http", func(f fixture) time.Duration { return retryAfter(f.header, f.body, anthropicNow) }, 37 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.parse(loadFixture(t, tt.fixture)); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.fixture, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAfterHeader_HTTPDate(t *testing.T) {
+	h := http.Header{"Retry-After": {anthropicNow.Add(90 * time.Second).Format(http.TimeFormat)}}
+	if got := retryAfterHeader(h, anthropicNow); got != 90*time.Second {
+		t.Errorf("got %v, want 1m30s", got)
+	}
+}
+
+// newRateLimitRouter routes to one upstream per fixture, "" for a 200 that
+// echoes the provider name, and counts the requests each upstream gets
+func newRateLimitRouter(t *testing.T, fallback FallbackConfig, fixtures ...string) (*Router, []*atomic.Int64) {
+	t.Helper()
+	cfg := &RouterConfig{Fallback: fallback, LoadBalance: StrategyPriority}
+	hits := make([]*atomic.Int64, len(fixtures))
+	for i, name := range fixtures {
+		provider := []string{"openai", "anthropic", "gemini"}[i]
+		var f fixture
+		if name != "" {
+			f = loadFixture(t, name)
+		}
+		hits[i] = new(atomic.Int64)
+		count := hits[i]
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count.Add(1)
+			io.ReadAll(r.Body)
+			if name == "" {
+				json.NewEncoder(w).Encode(map[string]string{"provider": provider})
+				return
+			}
+			f.serve(w)
+		}))
+		t.Cleanup(upstream.Close)
+		cfg.Providers = append(cfg.Providers, ProviderConfig{
+			Name: provider, BaseURL: upstream.URL, Priority: i + 1, Enabled: true, TimeoutSec: 5,
+		})
+	}
+	cfg.DefaultRoute = cfg.Providers[0].Name
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, hits
+}
+
+func decodeRateLimit(t *testing.T, w *httptest.ResponseRecorder) RateLimitError {
+	t.Helper()
+	var body struct {
+		Error RateLimitError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not the normalized error: %v: %s", err, w.Body.String())
+	}
+	return body.Error
+}
+
+func TestRateLimit_Normalized(t *testing.T) {
+	r, hits := newRateLimitRouter(t, FallbackConfig{}, "gemini_429.http")
+
+	w, _ := postChat(r, `{"model":"gpt-4o"}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "37" {
+		t.Errorf("Retry-After = %q, want 37", got)
+	}
+	e := decodeRateLimit(t, w)
+	if e.Type != "rate_limited" || e.Provider != "openai" || e.RetryAfterMs != 37000 {
+		t.Errorf("normalized error = %+v", e)
+	}
+
+	// Rate limited is not down, but the provider is not asked again until
+	// its retry-after passes
+	if !r.IsHealthy("openai") {
+		t.Error("a rate-limited provider must stay healthy")
+	}
+	w, _ = postChat(r, `{"model":"gpt-4o"}`)
+	if w.Code != http.StatusTooManyRequests || hits[0].Load() != 1 {
+		t.Errorf("second request: status %d after %d upstream requests, want 429 answered locally", w.Code, hits[0].Load())
+	}
+	if e := decodeRateLimit(t, w); e.RetryAfterMs <= 0 || e.RetryAfterMs > 37000 {
+		t.Errorf("local answer should carry the remaining wait, got %d ms", e.RetryAfterMs)
+	}
+}
+
+func TestRateLimit_Overloaded(t *testing.T) {
+	r, _ := newRateLimitRouter(t, FallbackConfig{}, "gemini_503.http")
+
+	w, _ := postChat(r, `{}`)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if e := decodeRateLimit(t, w); e.Type != "overloaded" || e.RetryAfterMs != 0 {
+		t.Errorf("normalized error = %+v", e)
+	}
+	if w.Header().Get("Retry-After") != "" {
+		t.Errorf("no hint, so no Retry-After; got %q", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimit_FallbackFailsOverImmediately(t *testing.T) {
+	r, hits := newRateLimitRouter(t, FallbackConfig{Enabled: true, MaxAttempts: 3, RetryDelaySec: 5},
+		"anthropic_429.http", "")
+
+	start := time.Now()
+	w, resp := postChat(r, `{"model":"gpt-4o","messages":[]}`)
+	if w.Code != http.StatusOK || resp["provider"] != "anthropic" {
+		t.Fatalf("got %d %s, want 200 from the second provider", w.Code, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("failover took %v; a rate limit should not wait retry_delay_sec", elapsed)
+	}
+	if !r.IsHealthy("openai") {
+		t.Error("a rate-limited provider must stay healthy")
+	}
+
+	// The next request skips the provider until its retry-after passes
+	postChat(r, `{}`)
+	if hits[0].Load() != 1 || hits[1].Load() != 2 {
+		t.Errorf("upstream requests = %d, %d; want 1, 2", hits[0].Load(), hits[1].Load())
+	}
+}
+
+func TestRateLimit_FallbackAllLimited(t *testing.T) {
+	r, _ := newRateLimitRouter(t, FallbackConfig{Enabled: true, MaxAttempts: 3},
+		"gemini_429.http", "openai_429.http")
+
+	w, _ := postChat(r, `{}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+	// The shortest wait answers
+	if e := decodeRateLimit(t, w); e.Provider != "anthropic" || e.RetryAfterMs != 1421 {
+		t.Errorf("normalized error = %+v, want anthropic's 1421 ms", e)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2 (rounded up)", got)
+	}
+	if strings.Contains(w.Body.String(), "all_providers_failed") {
+		t.Error("rate limits should be reported as such")
+	}
+}
+
+func TestProvidersHandler_RateLimitedUntil(t *testing.T) {
+	r, _ := newRateLimitRouter(t, FallbackConfig{}, "gemini_429.http")
+	postChat(r, `{}`)
+
+	w := httptest.NewRecorder()
+	r.ProvidersHandler()(w, httptest.NewRequest(http.MethodGet, "/admin/providers", nil))
+	var out struct {
+		Providers []providerStatus `json:"providers"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	if len(out.Providers) != 1 || !out.Providers[0].Healthy || out.Providers[0].RateLimitedUntil == nil {
+		t.Errorf("providers = %s", w.Body.String())
+	}
+}
@@ -0,0 +1,152 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Reload replaces the providers, routes and load balancing of the router
+// with those of cfg, which LoadConfig has validated. Requests in flight
+// finish on the providers they started with; requests arriving after
+// Reload returns are routed by cfg. Providers that keep their name and
+// base_url keep their health, rate limit cooldown, discovered models and
+// latency. On error the router is left as it was.
+//
+// Reload returns what changed, one line per provider or setting, for the
+// log. The request and response modifiers, signing key, tokenizers and
+// transport wrappers set on the router apply to the new providers too.
+func (r *Router) Reload(cfg *RouterConfig) ([]string, error) {
+	if r.ctx.Err() != nil {
+		return nil, errors.New("router is closed")
+	}
+
+	r.setMu.Lock()
+	prev := r.set
+	set, err := r.newProviderSet(cfg, prev)
+	if err != nil {
+		r.setMu.Unlock()
+		return nil, err
+	}
+	r.set = set
+	r.setMu.Unlock()
+
+	// Requests still on prev don't need its health checks
+	prev.cancel()
+	r.startHealthChecks(set)
+	return prev.changes(set), nil
+}
+
+// inherit carries over the runtime state of old, the provider p replaces
+// on Reload. Requests in flight on old keep counting there.
+func (p *Provider) inherit(old *Provider) {
+	p.healthy.Store(old.healthy.Load())
+	p.failedAt.Store(old.failedAt.Load())
+	p.cooldown.Store(old.cooldown.Load())
+	p.discovery.set(old.discovery.get())
+
+	old.health.mu.Lock()
+	p.health.lastCheck = old.health.lastCheck
+	p.health.failures = old.health.failures
+	p.health.lastError = old.health.lastError
+	old.health.mu.Unlock()
+
+	old.metrics.mu.Lock()
+	p.metrics.ewma = old.metrics.ewma
+	p.metrics.samples = old.metrics.samples
+	old.metrics.mu.Unlock()
+}
+
+// changes describes how next differs from set: providers added, removed
+// or changed, then the routing settings. API keys appear as fingerprints.
+func (set *providerSet) changes(next *providerSet) []string {
+	var out []string
+	for _, name := range providerNames(set, next) {
+		old, had := set.providers[name]
+		p, has := next.providers[name]
+		switch {
+		case !had:
+			out = append(out, fmt.Sprintf("provider %s added, %s", name, p.Config.BaseURL))
+		case !has:
+			out = append(out, fmt.Sprintf("provider %s removed", name))
+		default:
+			if diff := configChanges(old.Config, p.Config); len(diff) > 0 {
+				out = append(out, fmt.Sprintf("provider %s: %s", name, strings.Join(diff, ", ")))
+			}
+		}
+	}
+
+	if set.strategy != next.strategy {
+		out = append(out, fmt.Sprintf("load_balance %s -> %s", set.strategy, next.strategy))
+	}
+	if set.defaultRoute != next.defaultRoute {
+		out = append(out, fmt.Sprintf("default_route %s -> %s", set.defaultRoute, next.defaultRoute))
+	}
+	if !reflect.DeepEqual(set.routes, next.routes) || !reflect.DeepEqual(set.profiles, next.profiles) {
+		out = append(out, fmt.Sprintf("routes changed, %d routes", len(next.routes)))
+	}
+	if set.fallback != next.fallback {
+		out = append(out, "fallback changed")
+	}
+	if !reflect.DeepEqual(set.localization, next.localization) {
+		out = append(out, "data_localization changed")
+	}
+	return out
+}
+
+// configChanges lists the fields of a provider that differ between old
+// and cfg
+func configChanges(old, cfg ProviderConfig) []string {
+	var out []string
+	if old.BaseURL != cfg.BaseURL {
+		out = append(out, fmt.Sprintf("base_url %s -> %s, health reset", old.BaseURL, cfg.BaseURL))
+	}
+	if old.APIKey != cfg.APIKey {
+		out = append(out, fmt.Sprintf("api_key %s -> %s", keyOrNone(old), keyOrNone(cfg)))
+	}
+	if old.Model != cfg.Model {
+		out = append(out, fmt.Sprintf("model %s -> %s", old.Model, cfg.Model))
+	}
+	if old.Priority != cfg.Priority {
+		out = append(out, fmt.Sprintf("priority %d -> %d", old.Priority, cfg.Priority))
+	}
+	if old.Weight != cfg.Weight {
+		out = append(out, fmt.Sprintf("weight %d -> %d", old.Weight, cfg.Weight))
+	}
+
+	// Anything else, e.g. limits or the health check. Where the key is
+	// read from doesn't matter, only the key.
+	rest := old
+	rest.BaseURL, rest.APIKey, rest.Model, rest.Priority, rest.Weight = cfg.BaseURL, cfg.APIKey, cfg.Model, cfg.Priority, cfg.Weight
+	rest.APIKeyEnv, rest.APIKeyFile = cfg.APIKeyEnv, cfg.APIKeyFile
+	if !reflect.DeepEqual(rest, cfg) {
+		out = append(out, "other settings changed")
+	}
+	return out
+}
+
+// keyOrNone is the fingerprint of the provider's API key, "none" without one
+func keyOrNone(p ProviderConfig) string {
+	if p.APIKey == "" {
+		return "none"
+	}
+	return p.KeyFingerprint()
+}
+
+// providerNames returns the provider names of both sets, sorted
+func providerNames(a, b *providerSet) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, set := range []*providerSet{a, b} {
+		for name := range set.providers {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,208 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReload_MidTraffic(t *testing.T) {
+	upstream := func(name string, delay time.Duration) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + ":"))
+			w.(http.Flusher).Flush()
+			time.Sleep(delay)
+			w.Write([]byte("done"))
+		}))
+	}
+	old := upstream("old", 100*time.Millisecond)
+	defer old.Close()
+	next := upstream("next", 0)
+	defer next.Close()
+
+	r, err := New(&RouterConfig{
+		Providers:   []ProviderConfig{{Name: "old", BaseURL: old.URL, Enabled: true, TimeoutSec: 5}},
+		LoadBalance: StrategyPriority,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	front := httptest.NewServer(r)
+	defer front.Close()
+
+	var (
+		stop     atomic.Bool
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures []string
+		bodies   = map[string]int{}
+	)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				resp, err := http.Post(front.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{}`))
+				if err != nil {
+					mu.Lock()
+					failures = append(failures, err.Error())
+					mu.Unlock()
+					return
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				mu.Lock()
+				if resp.StatusCode >= 500 {
+					failures = append(failures, resp.Status+" "+string(body))
+				}
+				bodies[string(body)]++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	time.Sleep(150 * time.Millisecond) // streams to old are open now
+	changes, err := r.Reload(&RouterConfig{
+		Providers:   []ProviderConfig{{Name: "next", BaseURL: next.URL, Enabled: true, TimeoutSec: 5}},
+		LoadBalance: StrategyPriority,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	stop.Store(true)
+	wg.Wait()
+
+	if len(failures) > 0 {
+		t.Fatalf("the swap failed requests: %v", failures)
+	}
+	if bodies["old:done"] == 0 || bodies["next:done"] == 0 {
+		t.Errorf("streams to old should finish and later requests go to next: %v", bodies)
+	}
+	if len(bodies) != 2 {
+		t.Errorf("a response was cut short: %v", bodies)
+	}
+	want := []string{"provider next added, " + next.URL, "provider old removed", "default_route old -> next"}
+	if strings.Join(changes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes = %q", changes)
+	}
+}
+
+func TestReload_KeepsHealth(t *testing.T) {
+	cfg := newTestConfig()
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetHealthy("primary", false)
+	r.SetHealthy("secondary", false)
+
+	next := newTestConfig()
+	next.Providers[0].Weight = 5
+	next.Providers[0].APIKey = "sk-rotated-0000-abcd"
+	next.Providers[1].BaseURL = "https://secondary.example/v2"
+	changes, err := r.Reload(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.IsHealthy("primary") {
+		t.Error("primary kept its base_url and should stay unhealthy")
+	}
+	if !r.IsHealthy("secondary") {
+		t.Error("secondary moved to a new base_url and should start healthy")
+	}
+	joined := strings.Join(changes, "\n")
+	for _, want := range []string{"provider primary: api_key none -> sk-...abcd, weight 2 -> 5", "provider secondary: base_url http://secondary.test -> "} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("changes missing %q:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "sk-rotated") {
+		t.Errorf("changes leak the API key:\n%s", joined)
+	}
+}
+
+func TestReload_PassiveRecovery(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	cfg := func(weight int) *RouterConfig {
+		return &RouterConfig{
+			Providers:   []ProviderConfig{{Name: "down", BaseURL: down.URL, Weight: weight, Enabled: true, TimeoutSec: 5}},
+			LoadBalance: StrategyPriority,
+		}
+	}
+	r, err := New(cfg(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.recoveryDelay = delay
+
+	fail := func() {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.current().providers["down"].Proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)))
+		if w.Code != http.StatusBadGateway || r.IsHealthy("down") {
+			t.Fatalf("expected a passive failure, got %d, healthy %v", w.Code, r.IsHealthy("down"))
+		}
+	}
+
+	// Reloaded before the recovery timer fires, the provider keeps its
+	// unhealthy state and must still recover
+	fail()
+	if _, err := r.Reload(cfg(2)); err != nil {
+		t.Fatal(err)
+	}
+	if r.IsHealthy("down") {
+		t.Fatal("the reloaded provider should stay unhealthy until the delay has passed")
+	}
+	time.Sleep(delay + delay/2)
+	if !r.IsHealthy("down") {
+		t.Fatal("the reloaded provider was never restored")
+	}
+
+	// A failure after the reload is restored by its own timer, not early by
+	// the timer of the failure before it
+	fail()
+	if _, err := r.Reload(cfg(3)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(delay / 2)
+	fail()
+	time.Sleep(3 * delay / 4) // the first timer has fired
+	if r.IsHealthy("down") {
+		t.Error("an earlier failure's timer restored the provider early")
+	}
+	time.Sleep(delay)
+	if !r.IsHealthy("down") {
+		t.Error("the provider was never restored after its last failure")
+	}
+}
+
+func TestReload_InvalidKeepsProviders(t *testing.T) {
+	r, err := New(newTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := r.Reload(&RouterConfig{Providers: []ProviderConfig{{Name: "off", BaseURL: "https://off.example"}}}); err == nil {
+		t.Fatal("expected an error for a config without enabled providers")
+	}
+	if len(r.GetProviders()) != 2 {
+		t.Errorf("providers = %v, want the old ones", r.GetProviders())
+	}
+
+	r.Close()
+	if _, err := r.Reload(newTestConfig()); err == nil {
+		t.Error("expected an error reloading a closed router")
+	}
+}
@@ -1,15 +1,29 @@
 package router
 
 import (
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/vurakit/agentveil/internal/accesslog"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/failsafe"
+	"github.com/vurakit/agentveil/internal/metrics"
+	"github.com/vurakit/agentveil/internal/tokenizer"
+	"github.com/vurakit/agentveil/internal/transcript"
+	"github.com/vurakit/agentveil/internal/upstream"
+	"github.com/vurakit/agentveil/pkg/veilsig"
 )
 
 // Provider wraps config with runtime state
@@ -18,134 +32,296 @@ type Provider struct {
 	Target  *url.URL
 	Proxy   *httputil.ReverseProxy
 	healthy atomic.Bool
+	// failedAt is when a request last failed on the provider, in Unix
+	// nanoseconds; a recovery timer only restores the failure it was set for
+	failedAt atomic.Int64
+
+	// transport is the upstream transport without the WrapTransport
+	// wrappers, which health probes use
+	transport http.RoundTripper
+
+	discovery discoveryState
+	health    healthState
+	metrics   providerMetrics
+	cooldown  atomic.Pointer[cooldown] // set by a 429 or 503
 }
 
-// Router routes requests to multiple LLM providers
-type Router struct {
+// providerSet is the providers and routing of one RouterConfig. Reload
+// swaps the whole set, so a request finishes on the set it started with.
+type providerSet struct {
 	providers    map[string]*Provider
 	routes       map[string]string // path prefix → provider name
+	profiles     map[string]string // path prefix → detector profile
 	defaultRoute string
 	strategy     LoadBalanceStrategy
 	fallback     FallbackConfig
 
-	// Round-robin state
-	mu       sync.Mutex
-	rrIndex  int
-	rrList   []string // provider names for round-robin
-
+	// Provider names by priority, for round-robin
+	rrList []string
 	// Weighted state
 	weightedList []string // expanded list based on weights
 
+	// limited is set when any provider has limits, so fallback buffers bodies
+	limited bool
+
+	// data_localization policy
+	localization DataLocalizationConfig
+
+	// ctx ends the health checks of the set's providers once Reload
+	// replaces it
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Router routes requests to multiple LLM providers
+type Router struct {
+	// The current provider set; held for writing while Reload builds and
+	// swaps in the next one
+	setMu sync.RWMutex
+	set   *providerSet
+
+	// Round-robin state
+	mu      sync.Mutex
+	rrIndex int
+
+	// least_latency picks, guarded by mu
+	rand *rand.Rand
+
 	// Request modifier — applied before forwarding (e.g. PII anonymization)
 	requestModifier func(*http.Request)
 	// Response modifier — applied after receiving response (e.g. PII rehydration)
 	responseModifier func(*http.Response) error
+	// Signing key for providers with sign_requests
+	signingKey ed25519.PrivateKey
+	// Prompt token estimate for max_prompt_tokens; when nil, the tokenizer
+	// of the request's model counts them
+	estimateTokens func(string) int
+	tokenizers     *tokenizer.Registry
+	// Wrappers of every provider's upstream transport, in order, applied to
+	// the providers Reload creates too
+	transportWrappers []func(http.RoundTripper) http.RoundTripper
+
+	// The categories of a request, for data_localization, and where its
+	// decisions are audited
+	detectCategories func(string) []string
+	auditLog         *accesslog.Logger
+
+	// Provider selections, fallbacks and upstream latency
+	recorder metrics.Recorder
+
+	// How long a provider without a health check stays unhealthy after a
+	// transport error, healthRecoveryDelay
+	recoveryDelay time.Duration
+
+	// Shutdown state: requests arriving once closing is set get 503, active
+	// counts the ones still being served, and ctx ends recovery and health
+	// check goroutines, which checks counts
+	closing atomic.Bool
+	active  atomic.Int64
+	ctx     context.Context
+	cancel  context.CancelFunc
+	checks  sync.WaitGroup
 }
 
+// healthRecoveryDelay is how long a provider stays unhealthy after a
+// transport error
+const healthRecoveryDelay = 30 * time.Second
+
+// drainPollInterval is how often Shutdown checks for in-flight requests
+const drainPollInterval = 10 * time.Millisecond
+
 // New creates a Router from config
 func New(cfg *RouterConfig) (*Router, error) {
 	r := &Router{
+		rand:          rand.New(rand.NewSource(time.Now().UnixNano())),
+		recorder:      metrics.Nop{},
+		recoveryDelay: healthRecoveryDelay,
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	set, err := r.newProviderSet(cfg, nil)
+	if err != nil {
+		r.cancel()
+		return nil, err
+	}
+	r.set = set
+	r.startHealthChecks(set)
+
+	return r, nil
+}
+
+// current returns the provider set new requests are routed by
+func (r *Router) current() *providerSet {
+	r.setMu.RLock()
+	defer r.setMu.RUnlock()
+	return r.set
+}
+
+// newProviderSet builds the providers and routes of cfg. Providers of prev
+// with the same name and base_url keep their health, cooldown, discovered
+// models and latency.
+func (r *Router) newProviderSet(cfg *RouterConfig, prev *providerSet) (*providerSet, error) {
+	set := &providerSet{
 		providers:    make(map[string]*Provider),
 		routes:       make(map[string]string),
+		profiles:     make(map[string]string),
 		defaultRoute: cfg.DefaultRoute,
 		strategy:     cfg.LoadBalance,
 		fallback:     cfg.Fallback,
+		localization: cfg.DataLocalization,
 	}
 
 	for _, pc := range cfg.Providers {
 		if !pc.Enabled {
 			continue
 		}
-		target, err := url.Parse(pc.BaseURL)
+		p, err := r.newProvider(pc)
 		if err != nil {
-			return nil, fmt.Errorf("provider %s: invalid URL %s: %w", pc.Name, pc.BaseURL, err)
-		}
-
-		p := &Provider{
-			Config: pc,
-			Target: target,
+			return nil, err
 		}
-		p.healthy.Store(true)
-
-		// Create reverse proxy for this provider
-		p.Proxy = &httputil.ReverseProxy{
-			Director: func(req *http.Request) {
-				req.URL.Scheme = target.Scheme
-				req.URL.Host = target.Host
-				req.Host = target.Host
-
-				// Prepend target base path if present
-				// e.g. base_url=https://api.example.com/api → /chat becomes /api/chat
-				if target.Path != "" && target.Path != "/" {
-					req.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
-				}
-
-				// Set provider API key if configured
-				if pc.APIKey != "" {
-					switch pc.AuthMethod {
-					case "query":
-						q := req.URL.Query()
-						q.Set(pc.AuthParam, pc.APIKey)
-						req.URL.RawQuery = q.Encode()
-					case "x-api-key":
-						req.Header.Set("x-api-key", pc.APIKey)
-					default: // "header" — Bearer token
-						req.Header.Set("Authorization", "Bearer "+pc.APIKey)
-					}
-				}
-
-				// Apply custom request modifier (PII anonymization)
-				if r.requestModifier != nil {
-					slog.Debug("applying request modifier", "provider", pc.Name, "path", req.URL.Path)
-					r.requestModifier(req)
-				}
-			},
-			ModifyResponse: func(resp *http.Response) error {
-				if r.responseModifier != nil {
-					return r.responseModifier(resp)
-				}
-				return nil
-			},
-			ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
-				slog.Warn("provider error", "provider", pc.Name, "error", err)
-				p.healthy.Store(false)
-				// Schedule health recovery
-				go func() {
-					time.Sleep(30 * time.Second)
-					p.healthy.Store(true)
-					slog.Info("provider health restored", "provider", pc.Name)
-				}()
-				http.Error(w, fmt.Sprintf(`{"error":"provider_error","provider":"%s"}`, pc.Name), http.StatusBadGateway)
-			},
-			Transport: &http.Transport{
-				ResponseHeaderTimeout: time.Duration(pc.TimeoutSec) * time.Second,
-			},
+		if prev != nil {
+			if old, ok := prev.providers[pc.Name]; ok && old.Config.BaseURL == pc.BaseURL {
+				p.inherit(old)
+			}
 		}
-
-		r.providers[pc.Name] = p
+		set.providers[pc.Name] = p
+		set.limited = set.limited || p.hasLimits()
 	}
 
-	if len(r.providers) == 0 {
+	if len(set.providers) == 0 {
 		return nil, fmt.Errorf("no enabled providers")
 	}
 
 	// Build routes
 	for _, rc := range cfg.Routes {
-		r.routes[rc.PathPrefix] = rc.Provider
+		set.routes[rc.PathPrefix] = rc.Provider
+		if rc.DetectorProfile != "" {
+			set.profiles[rc.PathPrefix] = rc.DetectorProfile
+		}
 	}
 
 	// Set default if not configured
-	if r.defaultRoute == "" {
-		for name := range r.providers {
-			r.defaultRoute = name
+	if set.defaultRoute == "" {
+		for name := range set.providers {
+			set.defaultRoute = name
 			break
 		}
 	}
 
 	// Build round-robin and weighted lists
-	r.buildLoadBalanceLists()
+	set.buildLoadBalanceLists()
+	set.ctx, set.cancel = context.WithCancel(r.ctx)
 
-	return r, nil
+	return set, nil
+}
+
+// newProvider creates the runtime state and reverse proxy of pc
+func (r *Router) newProvider(pc ProviderConfig) (*Provider, error) {
+	target, err := url.Parse(pc.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: invalid URL %s: %w", pc.Name, pc.BaseURL, err)
+	}
+
+	p := &Provider{
+		Config: pc,
+		Target: target,
+		transport: upstream.NewTransport(upstream.Config{
+			ResponseHeaderTimeout: time.Duration(pc.TimeoutSec) * time.Second,
+		}),
+	}
+	p.healthy.Store(true)
+
+	// Create reverse proxy for this provider
+	p.Proxy = &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.Host = target.Host
+
+			// Prepend target base path if present
+			// e.g. base_url=https://api.example.com/api → /chat becomes /api/chat
+			if target.Path != "" && target.Path != "/" {
+				req.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
+			}
+
+			// Set provider API key if configured
+			pc.setAuth(req)
+
+			// Apply custom request modifier (PII anonymization)
+			if r.requestModifier != nil {
+				slog.Debug("applying request modifier", "provider", pc.Name, "path", req.URL.Path)
+				r.requestModifier(req)
+			}
+
+			// Sign last so the signature covers the anonymized body
+			if pc.SignRequests && r.signingKey != nil {
+				if err := veilsig.Sign(r.signingKey, req); err != nil {
+					slog.Warn("request signing failed", "provider", pc.Name, "error", err)
+				}
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if d, ok := p.observeResponse(resp); ok {
+				r.recorder.UpstreamLatency(pc.Name, d)
+			}
+			if isRateLimited(resp.StatusCode) {
+				return r.rateLimited(p, resp)
+			}
+			if r.responseModifier != nil {
+				return r.responseModifier(resp)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			if errors.Is(err, errRateLimited) {
+				return // kept back for fallback, the provider is not down
+			}
+			if errors.Is(err, failsafe.ErrUnavailable) {
+				failsafe.Deny(w) // refused before forwarding, the provider is not down
+				return
+			}
+			if upstream.ClientGone(req) {
+				// The upstream call was aborted with the client's request
+				slog.Debug("client went away, upstream request aborted", "provider", pc.Name)
+				w.WriteHeader(upstream.StatusClientClosed)
+				return
+			}
+			// Transport errors quote the URL, which carries the key with auth_method=query
+			msg := err.Error()
+			if pc.APIKey != "" {
+				msg = strings.ReplaceAll(msg, pc.APIKey, pc.KeyFingerprint())
+			}
+			slog.Warn("provider error", "provider", pc.Name, "error", msg)
+			failed := time.Now().UnixNano()
+			p.failedAt.Store(failed)
+			p.healthy.Store(false)
+			// Schedule health recovery, abandoned on shutdown; with a
+			// health check, the next successful probe restores it
+			if pc.HealthCheck == nil {
+				delay := r.recoveryDelay
+				go func() {
+					timer := time.NewTimer(delay)
+					defer timer.Stop()
+					select {
+					case <-timer.C:
+						if r.restoreHealth(p, failed) {
+							slog.Info("provider health restored", "provider", pc.Name)
+						}
+					case <-r.ctx.Done():
+					}
+				}()
+			}
+			http.Error(w, fmt.Sprintf(`{"error":"provider_error","provider":"%s"}`, pc.Name), http.StatusBadGateway)
+		},
+		Transport: p.transport,
+		// Flush every write so SSE events aren't held in the proxy's buffer
+		FlushInterval: -1,
+	}
+
+	for _, wrap := range r.transportWrappers {
+		p.Proxy.Transport = wrap(p.Proxy.Transport)
+	}
+	return p, nil
 }
 
 // SetRequestModifier sets a function that modifies requests before forwarding
@@ -153,81 +329,229 @@ func (r *Router) SetRequestModifier(fn func(*http.Request)) {
 	r.requestModifier = fn
 }
 
+// SetSigningKey signs requests to providers configured with sign_requests
+func (r *Router) SetSigningKey(key ed25519.PrivateKey) {
+	r.signingKey = key
+}
+
+// WrapTransport wraps every provider's upstream transport (e.g. response
+// caching), including those of providers a later Reload adds
+func (r *Router) WrapTransport(fn func(http.RoundTripper) http.RoundTripper) {
+	r.transportWrappers = append(r.transportWrappers, fn)
+	for _, p := range r.current().providers {
+		p.Proxy.Transport = fn(p.Proxy.Transport)
+	}
+}
+
 // SetResponseModifier sets a function that modifies responses before returning to client
 func (r *Router) SetResponseModifier(fn func(*http.Response) error) {
 	r.responseModifier = fn
 }
 
-func (r *Router) buildLoadBalanceLists() {
+// SetRecorder reports provider selections, fallback attempts and upstream
+// latency to rec
+func (r *Router) SetRecorder(rec metrics.Recorder) {
+	r.recorder = rec
+}
+
+func (set *providerSet) buildLoadBalanceLists() {
 	// Priority-sorted list
 	var names []string
-	for name := range r.providers {
+	for name := range set.providers {
 		names = append(names, name)
 	}
 
 	// Sort by priority (lower = higher priority)
 	for i := 0; i < len(names); i++ {
 		for j := i + 1; j < len(names); j++ {
-			if r.providers[names[j]].Config.Priority < r.providers[names[i]].Config.Priority {
+			if set.providers[names[j]].Config.Priority < set.providers[names[i]].Config.Priority {
 				names[i], names[j] = names[j], names[i]
 			}
 		}
 	}
-	r.rrList = names
+	set.rrList = names
 
 	// Weighted list
-	r.weightedList = nil
+	set.weightedList = nil
 	for _, name := range names {
-		p := r.providers[name]
+		p := set.providers[name]
 		for range p.Config.Weight {
-			r.weightedList = append(r.weightedList, name)
+			set.weightedList = append(set.weightedList, name)
 		}
 	}
 }
 
 // ServeHTTP routes the request to the appropriate provider
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	providerName := r.resolveProvider(req)
+	// Count the request before checking closing so Shutdown can't miss it
+	r.active.Add(1)
+	defer r.active.Add(-1)
+	if r.closing.Load() {
+		w.Header().Set("Connection", "close")
+		http.Error(w, `{"error":"shutting_down","message":"proxy is shutting down"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	// The whole request is served by the set current when it arrived
+	set := r.current()
+	req = set.withRouteProfile(req)
+	providerName := r.resolveProvider(set, req)
+	local, ok := r.localize(set, w, req)
+	if !ok {
+		return
+	}
 
-	if r.fallback.Enabled {
-		r.serveWithFallback(w, req, providerName)
+	if set.fallback.Enabled {
+		r.serveWithFallback(set, w, req, providerName, local)
 		return
 	}
 
-	p, ok := r.providers[providerName]
+	if local != nil {
+		providerName = local.pick(set, providerName)
+		local.record(r, req, providerName)
+		if providerName == "" {
+			local.refuse(w, set.localization.AllowedRegions)
+			return
+		}
+	}
+
+	p, ok := set.providers[providerName]
 	if !ok || !p.healthy.Load() {
 		http.Error(w, `{"error":"no_healthy_provider"}`, http.StatusServiceUnavailable)
 		return
 	}
+	// Answer for a provider still inside its retry-after instead of spending
+	// its quota on a request it would refuse
+	if wait, status := p.coolingDown(time.Now()); wait > 0 {
+		rateLimit{provider: providerName, status: status, retryAfter: wait}.write(w)
+		return
+	}
+
+	if !checkModel(w, req, p) || !r.applyLimits(w, req, p) {
+		return
+	}
 
 	// Strip the route prefix from the path
-	req.URL.Path = r.stripRoutePrefix(req.URL.Path)
+	req.URL.Path = set.stripRoutePrefix(req.URL.Path)
 
 	slog.Debug("routing request", "provider", providerName, "path", req.URL.Path)
-	p.Proxy.ServeHTTP(w, req)
+	accesslog.SetProvider(req.Context(), providerName)
+	transcript.SetProvider(req.Context(), providerName)
+	r.recorder.ProviderSelected(providerName)
+	p.forward(w, req)
 }
 
-func (r *Router) serveWithFallback(w http.ResponseWriter, req *http.Request, primaryName string) {
-	// Build fallback order: primary first, then others by priority
+// Shutdown stops accepting requests, answering new ones with 503, and
+// waits for in-flight provider requests, including open streams, to finish.
+// Health recovery goroutines are cancelled. If ctx ends first Shutdown
+// returns its error and the remaining requests are left to the caller.
+func (r *Router) Shutdown(ctx context.Context) error {
+	r.closing.Store(true)
+	r.cancel()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		if r.active.Load() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			slog.Warn("router shutdown: requests still in flight", "count", r.active.Load())
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Router) serveWithFallback(set *providerSet, w http.ResponseWriter, req *http.Request, primaryName string, local *localization) {
+	if p, ok := set.providers[primaryName]; ok && !checkModel(w, req, p) {
+		return
+	}
+
+	// Build fallback order: primary first, then others by priority. A
+	// localized request only goes to providers in the allowed regions.
 	order := []string{primaryName}
-	for _, name := range r.rrList {
+	for _, name := range set.rrList {
 		if name != primaryName {
 			order = append(order, name)
 		}
 	}
+	if local != nil {
+		order = slices.DeleteFunc(order, func(name string) bool { return !local.permits(name) })
+		first := local.pick(set, primaryName)
+		local.record(r, req, first)
+		if first == "" {
+			local.refuse(w, set.localization.AllowedRegions)
+			return
+		}
+	}
+
+	// The body is kept so a rate-limited attempt can be resent in full
+	body, err := readBody(req)
+	if err != nil {
+		http.Error(w, `{"error":"bad_request","message":"cannot read request body"}`, http.StatusBadRequest)
+		return
+	}
 
-	attempts := r.fallback.MaxAttempts
+	// Providers whose limits refuse the request are left out; the first
+	// refusal is the answer when none can take it
+	if set.limited && body != nil {
+		var refused *limitError
+		fits := order[:0:0]
+		for _, name := range order {
+			p, ok := set.providers[name]
+			if !ok {
+				continue
+			}
+			if lerr := r.checkLimits(p, body); lerr != nil {
+				slog.Debug("request exceeds provider limits, skipping", "provider", name, "error", lerr.code)
+				if refused == nil {
+					refused = lerr
+				}
+				continue
+			}
+			fits = append(fits, name)
+		}
+		if len(fits) == 0 && refused != nil {
+			refused.write(w)
+			return
+		}
+		order = fits
+	}
+
+	attempts := set.fallback.MaxAttempts
 	if attempts > len(order) {
 		attempts = len(order)
 	}
 
+	// The rate limit with the shortest wait answers when every provider is
+	// rate limited
+	var limited *rateLimit
+	keepLimit := func(rl rateLimit) {
+		if limited == nil || rl.retryAfter < limited.retryAfter {
+			limited = &rl
+		}
+	}
+
+	forwarded := false
 	for i := 0; i < attempts; i++ {
+		// A client that went away gets no further attempts
+		if upstream.ClientGone(req) {
+			slog.Debug("client went away, fallback abandoned", "attempt", i+1)
+			return
+		}
 		name := order[i]
-		p, ok := r.providers[name]
+		p, ok := set.providers[name]
 		if !ok || !p.healthy.Load() {
 			slog.Warn("provider unhealthy, trying next", "provider", name, "attempt", i+1)
 			continue
 		}
+		if wait, status := p.coolingDown(time.Now()); wait > 0 {
+			slog.Debug("provider rate limited, trying next", "provider", name, "attempt", i+1, "retry_after", wait)
+			keepLimit(rateLimit{provider: name, status: status, retryAfter: wait})
+			continue
+		}
 
 		// Use a response recorder to detect errors
 		rec := &fallbackRecorder{
@@ -236,101 +560,140 @@ func (r *Router) serveWithFallback(w http.ResponseWriter, req *http.Request, pri
 			headerWritten:  false,
 		}
 
+		if body != nil {
+			setBody(req, clampOutputTokens(body, p.Config.MaxOutputTokensOverride))
+		}
+
 		originalPath := req.URL.Path
-		req.URL.Path = r.stripRoutePrefix(originalPath)
+		req.URL.Path = set.stripRoutePrefix(originalPath)
 
 		slog.Debug("routing request (fallback)", "provider", name, "attempt", i+1, "path", req.URL.Path)
-		p.Proxy.ServeHTTP(rec, req)
+		accesslog.SetProvider(req.Context(), name)
+		transcript.SetProvider(req.Context(), name)
+		r.recorder.ProviderSelected(name)
+		if forwarded {
+			r.recorder.FallbackAttempt(name)
+		}
+		forwarded = true
+		var slot rateLimit
+		p.forward(rec, req.WithContext(withRateLimitSlot(req.Context(), &slot)))
+
+		// Rate limited: nothing was written, fail over without waiting
+		if slot.status != 0 {
+			keepLimit(slot)
+			req.URL.Path = originalPath
+			continue
+		}
 
 		// If successful or client error, return (don't retry on 4xx)
 		if rec.statusCode > 0 && rec.statusCode < 500 {
 			return
 		}
+		// Refused by the failure policy: another provider would be too
+		if !failsafe.Allowed(req.Context()) {
+			return
+		}
 
 		// Server error — try next provider
 		slog.Warn("provider returned error, falling back",
 			"provider", name, "status", rec.statusCode, "attempt", i+1)
 		req.URL.Path = originalPath
 
-		if i < attempts-1 && r.fallback.RetryDelaySec > 0 {
-			time.Sleep(time.Duration(r.fallback.RetryDelaySec) * time.Second)
+		if i < attempts-1 && set.fallback.RetryDelaySec > 0 {
+			delay := time.NewTimer(time.Duration(set.fallback.RetryDelaySec) * time.Second)
+			select {
+			case <-delay.C:
+			case <-req.Context().Done():
+				delay.Stop()
+			}
 		}
 	}
 
+	if upstream.ClientGone(req) {
+		return
+	}
+	if limited != nil {
+		limited.write(w)
+		return
+	}
 	http.Error(w, `{"error":"all_providers_failed"}`, http.StatusBadGateway)
 }
 
-// resolveProvider determines which provider to use for a request
-func (r *Router) resolveProvider(req *http.Request) string {
+// resolveProvider determines which provider of set to use for a request
+func (r *Router) resolveProvider(set *providerSet, req *http.Request) string {
 	// 1. Check explicit provider header
 	if provider := req.Header.Get("X-Veil-Provider"); provider != "" {
-		if _, ok := r.providers[provider]; ok {
+		if _, ok := set.providers[provider]; ok {
 			return provider
 		}
 	}
 
 	// 2. Check path-based routes
-	for prefix, provider := range r.routes {
+	for prefix, provider := range set.routes {
 		if strings.HasPrefix(req.URL.Path, prefix) {
 			return provider
 		}
 	}
 
 	// 3. Load balancing across providers
-	switch r.strategy {
+	switch set.strategy {
 	case StrategyRoundRobin:
-		return r.nextRoundRobin()
+		return r.nextRoundRobin(set)
 	case StrategyWeighted:
-		return r.nextWeighted()
+		return r.nextWeighted(set)
+	case StrategyLeastInflight:
+		return set.nextLeastInflight()
+	case StrategyLeastLatency:
+		return r.nextLeastLatency(set)
 	default: // StrategyPriority
-		return r.nextPriority()
+		return set.nextPriority()
 	}
 }
 
-func (r *Router) nextRoundRobin() string {
+func (r *Router) nextRoundRobin(set *providerSet) string {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if len(r.rrList) == 0 {
-		return r.defaultRoute
+	if len(set.rrList) == 0 {
+		return set.defaultRoute
 	}
 
 	// Find next healthy provider
-	for range r.rrList {
-		name := r.rrList[r.rrIndex%len(r.rrList)]
+	for range set.rrList {
+		name := set.rrList[r.rrIndex%len(set.rrList)]
 		r.rrIndex++
-		if p := r.providers[name]; p != nil && p.healthy.Load() {
+		if p := set.providers[name]; p != nil && p.available() {
 			return name
 		}
 	}
-	return r.defaultRoute
+	return set.defaultRoute
 }
 
-func (r *Router) nextWeighted() string {
+func (r *Router) nextWeighted(set *providerSet) string {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if len(r.weightedList) == 0 {
-		return r.defaultRoute
+	if len(set.weightedList) == 0 {
+		return set.defaultRoute
 	}
 
-	for range r.weightedList {
-		name := r.weightedList[r.rrIndex%len(r.weightedList)]
+	for range set.weightedList {
+		name := set.weightedList[r.rrIndex%len(set.weightedList)]
 		r.rrIndex++
-		if p := r.providers[name]; p != nil && p.healthy.Load() {
+		if p := set.providers[name]; p != nil && p.available() {
 			return name
 		}
 	}
-	return r.defaultRoute
+	return set.defaultRoute
 }
 
-func (r *Router) nextPriority() string {
-	for _, name := range r.rrList {
-		if p := r.providers[name]; p != nil && p.healthy.Load() {
+func (set *providerSet) nextPriority() string {
+	for _, name := range set.rrList {
+		if p := set.providers[name]; p != nil && p.available() {
 			return name
 		}
 	}
-	return r.defaultRoute
+	return set.defaultRoute
 }
 
 // singleJoiningSlash joins two URL path segments with exactly one slash.
@@ -346,9 +709,20 @@ func singleJoiningSlash(a, b string) string {
 	return a + b
 }
 
+// withRouteProfile selects the detector profile of the route req matches,
+// before the request modifier anonymizes it
+func (set *providerSet) withRouteProfile(req *http.Request) *http.Request {
+	for prefix, profile := range set.profiles {
+		if strings.HasPrefix(req.URL.Path, prefix) {
+			return req.WithContext(detector.WithProfile(req.Context(), profile))
+		}
+	}
+	return req
+}
+
 // stripRoutePrefix removes the route prefix from the path
-func (r *Router) stripRoutePrefix(path string) string {
-	for prefix := range r.routes {
+func (set *providerSet) stripRoutePrefix(path string) string {
+	for prefix := range set.routes {
 		if strings.HasPrefix(path, prefix) {
 			stripped := strings.TrimPrefix(path, prefix)
 			if stripped == "" {
@@ -363,10 +737,29 @@ func (r *Router) stripRoutePrefix(path string) string {
 	return path
 }
 
+// DiscoverInterval returns the shortest discover_interval_sec among
+// auto_discover providers, or DefaultDiscoverInterval
+func (r *Router) DiscoverInterval() time.Duration {
+	interval := time.Duration(0)
+	for _, p := range r.current().providers {
+		if !p.discoverable() || p.Config.DiscoverIntervalSec <= 0 {
+			continue
+		}
+		d := time.Duration(p.Config.DiscoverIntervalSec) * time.Second
+		if interval == 0 || d < interval {
+			interval = d
+		}
+	}
+	if interval == 0 {
+		return DefaultDiscoverInterval
+	}
+	return interval
+}
+
 // GetProviders returns the list of provider names
 func (r *Router) GetProviders() []string {
 	var names []string
-	for name := range r.providers {
+	for name := range r.current().providers {
 		names = append(names, name)
 	}
 	return names
@@ -374,15 +767,33 @@ func (r *Router) GetProviders() []string {
 
 // IsHealthy returns the health status of a provider
 func (r *Router) IsHealthy(name string) bool {
-	if p, ok := r.providers[name]; ok {
+	if p, ok := r.current().providers[name]; ok {
 		return p.healthy.Load()
 	}
 	return false
 }
 
+// restoreHealth ends the passive failure of p at failed, unless p failed
+// again since, which its own timer restores. A Reload since the failure
+// carried it over to the provider replacing p in the current set, which is
+// restored the same way; the set's lock keeps a Reload from copying the
+// state while it is restored.
+func (r *Router) restoreHealth(p *Provider, failed int64) bool {
+	r.setMu.RLock()
+	defer r.setMu.RUnlock()
+	restored := false
+	for _, q := range []*Provider{p, r.set.providers[p.Config.Name]} {
+		if q != nil && q.Config.BaseURL == p.Config.BaseURL && q.Config.HealthCheck == nil && q.failedAt.Load() == failed {
+			q.healthy.Store(true)
+			restored = true
+		}
+	}
+	return restored
+}
+
 // SetHealthy manually sets provider health (for testing)
 func (r *Router) SetHealthy(name string, healthy bool) {
-	if p, ok := r.providers[name]; ok {
+	if p, ok := r.current().providers[name]; ok {
 		p.healthy.Store(healthy)
 	}
 }
@@ -1,11 +1,29 @@
 package router
 
 import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/metrics"
+	"github.com/vurakit/agentveil/internal/readiness"
+	"github.com/vurakit/agentveil/internal/tokenizer"
+	"github.com/vurakit/agentveil/internal/upstream"
+	"github.com/vurakit/agentveil/pkg/veilsig"
 )
 
 // === Config Tests ===
@@ -113,6 +131,15 @@ providers:
 	}
 }
 
+func TestParseConfig_RelativeURL(t *testing.T) {
+	for _, u := range []string{"api.openai.com/v1", "/v1", "http://"} {
+		yaml := "providers:\n  - name: openai\n    base_url: " + u + "\n    enabled: true\n"
+		if _, err := ParseConfig(yaml); err == nil {
+			t.Errorf("expected error for base_url %q", u)
+		}
+	}
+}
+
 func TestParseConfig_InvalidRoute(t *testing.T) {
 	yaml := `
 providers:
@@ -205,13 +232,13 @@ func TestRouteByPath(t *testing.T) {
 	r, _ := New(cfg)
 
 	req := httptest.NewRequest(http.MethodPost, "/v1/primary/chat/completions", nil)
-	name := r.resolveProvider(req)
+	name := r.resolveProvider(r.current(), req)
 	if name != "primary" {
 		t.Errorf("expected primary for /v1/primary path, got %s", name)
 	}
 
 	req = httptest.NewRequest(http.MethodPost, "/v1/secondary/chat/completions", nil)
-	name = r.resolveProvider(req)
+	name = r.resolveProvider(r.current(), req)
 	if name != "secondary" {
 		t.Errorf("expected secondary for /v1/secondary path, got %s", name)
 	}
@@ -223,7 +250,7 @@ func TestRouteByHeader(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
 	req.Header.Set("X-Veil-Provider", "secondary")
-	name := r.resolveProvider(req)
+	name := r.resolveProvider(r.current(), req)
 	if name != "secondary" {
 		t.Errorf("expected secondary from header, got %s", name)
 	}
@@ -235,7 +262,7 @@ func TestRouteByHeader_Unknown(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
 	req.Header.Set("X-Veil-Provider", "nonexistent")
-	name := r.resolveProvider(req)
+	name := r.resolveProvider(r.current(), req)
 	// Should fallback to load balance / default
 	if name == "nonexistent" {
 		t.Error("should not use unknown provider")
@@ -248,14 +275,14 @@ func TestPriorityStrategy(t *testing.T) {
 	r, _ := New(cfg)
 
 	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
-	name := r.resolveProvider(req)
+	name := r.resolveProvider(r.current(), req)
 	if name != "primary" {
 		t.Errorf("expected primary (priority 1), got %s", name)
 	}
 
 	// Mark primary unhealthy
 	r.SetHealthy("primary", false)
-	name = r.resolveProvider(req)
+	name = r.resolveProvider(r.current(), req)
 	if name != "secondary" {
 		t.Errorf("expected secondary after primary unhealthy, got %s", name)
 	}
@@ -270,7 +297,7 @@ func TestRoundRobinStrategy(t *testing.T) {
 	seen := make(map[string]int)
 	for i := 0; i < 10; i++ {
 		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
-		name := r.resolveProvider(req)
+		name := r.resolveProvider(r.current(), req)
 		seen[name]++
 	}
 
@@ -288,7 +315,7 @@ func TestWeightedStrategy(t *testing.T) {
 	counts := make(map[string]int)
 	for i := 0; i < 30; i++ {
 		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
-		name := r.resolveProvider(req)
+		name := r.resolveProvider(r.current(), req)
 		counts[name]++
 	}
 
@@ -342,7 +369,7 @@ func TestStripRoutePrefix(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got := r.stripRoutePrefix(tt.input)
+		got := r.current().stripRoutePrefix(tt.input)
 		if got != tt.expected {
 			t.Errorf("stripRoutePrefix(%s) = %s, want %s", tt.input, got, tt.expected)
 		}
@@ -442,6 +469,101 @@ func TestServeHTTP_UnhealthyProvider(t *testing.T) {
 	}
 }
 
+func TestShutdown_DrainsStreamAndRejectsNew(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "data: second\n\ndata: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	rt, err := New(&RouterConfig{
+		Providers:    []ProviderConfig{{Name: "slow", BaseURL: upstream.URL, Priority: 1, Enabled: true, TimeoutSec: 5}},
+		LoadBalance:  StrategyPriority,
+		DefaultRoute: "slow",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := httptest.NewServer(rt)
+	defer front.Close()
+
+	resp, err := http.Post(front.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"stream":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	stream := bufio.NewReader(resp.Body)
+	if line, _ := stream.ReadString('\n'); line != "data: first\n" {
+		t.Fatalf("first event = %q", line)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- rt.Shutdown(ctx) }()
+	for !rt.closing.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// New requests are turned away while the stream is open
+	late, err := http.Post(front.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(late.Body)
+	late.Body.Close()
+	if late.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "shutting_down") {
+		t.Errorf("late request: %d %s", late.StatusCode, body)
+	}
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before the stream finished: %v", err)
+	default:
+	}
+
+	// The open stream runs to completion
+	close(release)
+	rest, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(rest), "data: second") || !strings.Contains(string(rest), "[DONE]") {
+		t.Errorf("stream truncated: %q", rest)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
+
+func TestShutdown_DeadlineExceeded(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	rt, _ := New(&RouterConfig{
+		Providers:    []ProviderConfig{{Name: "stuck", BaseURL: upstream.URL, Priority: 1, Enabled: true, TimeoutSec: 5}},
+		LoadBalance:  StrategyPriority,
+		DefaultRoute: "stuck",
+	})
+	go rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	for rt.active.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rt.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
 // === Adapter Tests ===
 
 func TestAdaptToOpenAI(t *testing.T) {
@@ -657,3 +779,718 @@ func TestAdaptFromOpenAI_EmptyChoices(t *testing.T) {
 		t.Errorf("expected empty content, got '%s'", result.Content)
 	}
 }
+
+func newFakeRuntime(t *testing.T, typ string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case typ == TypeOllama && r.URL.Path == "/api/tags":
+			w.Write([]byte(`{"models":[{"name":"qwen2.5:7b"},{"name":"llama3:latest"}]}`))
+		case typ == TypeLMStudio && r.URL.Path == "/v1/models":
+			w.Write([]byte(`{"object":"list","data":[{"id":"mistral-7b-instruct"}]}`))
+		default:
+			w.Write([]byte(`{"reached":"` + r.URL.Path + `"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDiscovery_ModelValidation(t *testing.T) {
+	ollama := newFakeRuntime(t, TypeOllama)
+	r, err := New(&RouterConfig{
+		Providers: []ProviderConfig{
+			{Name: "local", Type: TypeOllama, AutoDiscover: true, BaseURL: ollama.URL + "/v1", Priority: 1, Enabled: true, TimeoutSec: 5},
+		},
+		LoadBalance: StrategyPriority,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r.Discover(context.Background())
+
+	state := r.current().providers["local"].Discovery()
+	if state == nil || !state.Reachable || len(state.Models) != 2 {
+		t.Fatalf("expected 2 discovered models, got %+v", state)
+	}
+
+	tests := []struct {
+		name   string
+		model  string
+		expect int
+	}{
+		{"exact name", "qwen2.5:7b", http.StatusOK},
+		{"implicit latest tag", "llama3", http.StatusOK},
+		{"unknown model", "gpt-4o", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+tt.model+`"}`))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.expect {
+				t.Fatalf("expected %d, got %d: %s", tt.expect, w.Code, w.Body.String())
+			}
+			if tt.expect == http.StatusBadRequest && !strings.Contains(w.Body.String(), "qwen2.5:7b") {
+				t.Errorf("expected available models in error, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDiscovery_LMStudio(t *testing.T) {
+	lmstudio := newFakeRuntime(t, TypeLMStudio)
+	r, err := New(&RouterConfig{
+		Providers: []ProviderConfig{
+			{Name: "lms", Type: TypeLMStudio, AutoDiscover: true, BaseURL: lmstudio.URL, Enabled: true, TimeoutSec: 5},
+			{Name: "cloud", BaseURL: "https://api.example.com", Model: "gpt-4o", Priority: 2, Enabled: true, TimeoutSec: 5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r.Discover(context.Background())
+
+	w := httptest.NewRecorder()
+	r.ModelsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+
+	var list struct {
+		Data []modelEntry `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Data) != 2 {
+		t.Fatalf("expected 2 aggregated models, got %+v", list.Data)
+	}
+	if list.Data[0].ID != "gpt-4o" || list.Data[0].OwnedBy != "cloud" ||
+		list.Data[1].ID != "mistral-7b-instruct" || list.Data[1].OwnedBy != "lms" {
+		t.Errorf("unexpected model list: %+v", list.Data)
+	}
+}
+
+func TestDiscovery_RuntimeDown(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close() // nothing listening any more
+
+	r, err := New(&RouterConfig{
+		Providers: []ProviderConfig{
+			{Name: "local", Type: TypeOllama, AutoDiscover: true, BaseURL: down.URL, Enabled: true, TimeoutSec: 5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("router construction must not fail when a runtime is down: %v", err)
+	}
+	r.Discover(context.Background())
+
+	if r.IsHealthy("local") {
+		t.Error("expected unreachable runtime to be marked unhealthy")
+	}
+
+	w := httptest.NewRecorder()
+	r.ProvidersHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/providers", nil))
+	var resp struct {
+		Providers []providerStatus `json:"providers"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Providers) != 1 || resp.Providers[0].Discovery == nil ||
+		resp.Providers[0].Discovery.Reachable || resp.Providers[0].Discovery.Error == "" {
+		t.Errorf("expected unreachable discovery state with error, got %s", w.Body.String())
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	var gotPath, gotKey string
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotKey = r.URL.Path, r.Header.Get("Authorization")
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer openai.Close()
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer rejecting.Close()
+	ollama := newFakeRuntime(t, TypeOllama)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	r, err := New(&RouterConfig{
+		Providers: []ProviderConfig{
+			{Name: "openai", BaseURL: openai.URL + "/api", APIKey: "sk-probe-key-123456", Enabled: true, Required: true},
+			{Name: "anthropic", BaseURL: rejecting.URL, APIKey: "sk-ant-wrong-key-9876", AuthMethod: "x-api-key", Enabled: true},
+			{Name: "local", Type: TypeOllama, AutoDiscover: true, BaseURL: ollama.URL + "/v1", Enabled: true},
+			{Name: "gone", BaseURL: down.URL, Enabled: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := r.ReadinessChecks()
+	if len(checks) != 4 || checks[0].Name != "anthropic" || !checks[3].Required || checks[3].Kind != readiness.KindProvider {
+		t.Fatalf("checks = %+v", checks)
+	}
+	errs := map[string]error{}
+	for _, c := range checks {
+		errs[c.Name] = c.Probe(context.Background())
+	}
+	if errs["openai"] != nil || gotPath != "/api/v1/models" || gotKey != "Bearer sk-probe-key-123456" {
+		t.Errorf("openai probe: %v, path %s, auth %q", errs["openai"], gotPath, gotKey)
+	}
+	if err := errs["anthropic"]; err == nil || !strings.Contains(err.Error(), "401") || strings.Contains(err.Error(), "sk-ant-wrong-key-9876") {
+		t.Errorf("rejected key probe: %v", err)
+	}
+	if errs["local"] != nil || errs["gone"] == nil {
+		t.Errorf("local: %v, gone: %v", errs["local"], errs["gone"])
+	}
+}
+
+func TestParseConfig_AutoDiscoverRequiresLocalType(t *testing.T) {
+	_, err := ParseConfig(`
+providers:
+  - name: openai
+    base_url: https://api.openai.com
+    auto_discover: true
+    enabled: true
+`)
+	if err == nil {
+		t.Error("expected error for auto_discover on a non-local provider")
+	}
+}
+
+func TestSignRequests_PerProvider(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+
+	verified := map[string]error{}
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			verified[name] = veilsig.Verify(pub, r)
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	gateway := upstream("gateway")
+	defer gateway.Close()
+	public := upstream("public")
+	defer public.Close()
+
+	r, err := New(&RouterConfig{
+		Providers: []ProviderConfig{
+			{Name: "gateway", BaseURL: gateway.URL, Enabled: true, TimeoutSec: 5, SignRequests: true},
+			{Name: "public", BaseURL: public.URL, Enabled: true, TimeoutSec: 5},
+		},
+		Routes: []RouteConfig{
+			{PathPrefix: "/v1/gateway", Provider: "gateway"},
+			{PathPrefix: "/v1/public", Provider: "public"},
+		},
+		LoadBalance:  StrategyPriority,
+		DefaultRoute: "gateway",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r.SetRequestModifier(func(req *http.Request) {
+		req.Body = io.NopCloser(strings.NewReader(`{"content":"[EMAIL_1]"}`))
+		req.ContentLength = int64(len(`{"content":"[EMAIL_1]"}`))
+	})
+	r.SetSigningKey(priv)
+
+	for _, name := range []string{"gateway", "public"} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/"+name+"/chat/completions", strings.NewReader(`{"content":"a@b.com"}`))
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if err := verified["gateway"]; err != nil {
+		t.Errorf("gateway request should carry a valid signature over the modified body: %v", err)
+	}
+	if err := verified["public"]; err != veilsig.ErrMissingSignature {
+		t.Errorf("public provider should not be signed, got %v", err)
+	}
+}
+
+func TestLoadConfig_APIKeySources(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "openai")
+	os.WriteFile(secretFile, []byte("sk-from-file-0000000000001111\n"), 0o600)
+	emptyFile := filepath.Join(dir, "empty")
+	os.WriteFile(emptyFile, []byte("  \n"), 0o600)
+	t.Setenv("TEST_OPENAI_KEY", "sk-from-env-0000000000002222")
+
+	tests := []struct {
+		name    string
+		keys    string
+		want    string
+		wantErr string
+	}{
+		{"inline", "api_key: sk-inline-000000000000003333", "sk-inline-000000000000003333", ""},
+		{"legacy env reference", "api_key: $TEST_OPENAI_KEY", "sk-from-env-0000000000002222", ""},
+		{"env", "api_key_env: TEST_OPENAI_KEY", "sk-from-env-0000000000002222", ""},
+		{"file", "api_key_file: " + secretFile, "sk-from-file-0000000000001111", ""},
+		{"env overrides inline", "api_key: sk-inline\n    api_key_env: TEST_OPENAI_KEY", "sk-from-env-0000000000002222", ""},
+		{"file overrides env", "api_key_env: TEST_OPENAI_KEY\n    api_key_file: " + secretFile, "sk-from-file-0000000000001111", ""},
+		{"missing env", "api_key_env: TEST_UNSET_KEY_VAR", "", "api_key_env TEST_UNSET_KEY_VAR is not set"},
+		{"missing file", "api_key_file: " + filepath.Join(dir, "nope"), "", "api_key_file"},
+		{"empty file", "api_key_file: " + emptyFile, "", "is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "router.yaml")
+			os.WriteFile(path, []byte("providers:\n  - name: openai\n    base_url: https://api.openai.com\n    enabled: true\n    "+tt.keys+"\n"), 0o600)
+
+			cfg, err := LoadConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if got := cfg.Providers[0].APIKey; got != tt.want {
+				t.Errorf("APIKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	tests := []struct{ key, want string }{
+		{"", ""},
+		{"short", "****"},
+		{"sk-proj-abcdefghijklmnop9xQz", "sk-...9xQz"},
+	}
+	for _, tt := range tests {
+		if got := (ProviderConfig{APIKey: tt.key}).KeyFingerprint(); got != tt.want {
+			t.Errorf("KeyFingerprint(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestProvidersHandler_MasksAPIKey(t *testing.T) {
+	const key = "sk-proj-abcdefghijklmnop9xQz"
+	r, err := New(&RouterConfig{
+		Providers:   []ProviderConfig{{Name: "openai", BaseURL: "https://api.openai.com", APIKey: key, Enabled: true}},
+		LoadBalance: StrategyPriority,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ProvidersHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/providers", nil))
+	if strings.Contains(w.Body.String(), key) {
+		t.Fatalf("API key leaked: %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"api_key":"sk-...9xQz"`) {
+		t.Errorf("expected key fingerprint, got %s", w.Body.String())
+	}
+}
+
+func TestProviderError_LogMasksQueryKey(t *testing.T) {
+	const key = "AIzaSyTestKeyThatMustNotLeak1234"
+	var logs strings.Builder
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(prev)
+
+	r, err := New(&RouterConfig{
+		Providers: []ProviderConfig{{
+			Name: "gemini", BaseURL: "http://127.0.0.1:1", APIKey: key,
+			AuthMethod: "query", AuthParam: "key", Enabled: true, TimeoutSec: 1,
+		}},
+		LoadBalance: StrategyPriority,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1beta/models", nil))
+
+	if !strings.Contains(logs.String(), "provider error") {
+		t.Fatalf("expected a provider error log, got %s", logs.String())
+	}
+	if strings.Contains(logs.String(), key) {
+		t.Errorf("API key leaked into logs: %s", logs.String())
+	}
+}
+
+func TestParseConfig_UnknownStrategy(t *testing.T) {
+	_, err := ParseConfig("providers:\n  - name: openai\n    base_url: https://api.openai.com\nload_balance: fastest\n")
+	if err == nil || !strings.Contains(err.Error(), "fastest") {
+		t.Errorf("expected unknown strategy error, got %v", err)
+	}
+}
+
+func TestLeastInflightStrategy(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{}`))
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer fast.Close()
+
+	cfg := newTestConfig()
+	cfg.Providers[0].BaseURL = slow.URL
+	cfg.Providers[1].BaseURL = fast.URL
+	cfg.Routes = nil
+	cfg.LoadBalance = StrategyLeastInflight
+	r, _ := New(cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if name := r.resolveProvider(r.current(), req); name != "primary" {
+		t.Fatalf("idle providers should fall back to priority, got %s", name)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)))
+		close(done)
+	}()
+	for r.current().providers["primary"].metrics.inflight.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if name := r.resolveProvider(r.current(), req); name != "secondary" {
+		t.Errorf("busy primary should shift traffic to secondary, got %s", name)
+	}
+	w := httptest.NewRecorder()
+	r.ProvidersHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/providers", nil))
+	if !strings.Contains(w.Body.String(), `"in_flight":1`) {
+		t.Errorf("expected in-flight count on /admin/providers, got %s", w.Body.String())
+	}
+
+	r.SetHealthy("secondary", false)
+	if name := r.resolveProvider(r.current(), req); name != "primary" {
+		t.Errorf("unhealthy providers must be skipped, got %s", name)
+	}
+
+	close(release)
+	<-done
+	if n := r.current().providers["primary"].metrics.inflight.Load(); n != 0 {
+		t.Errorf("in-flight count should drop back to 0, got %d", n)
+	}
+}
+
+func TestLeastLatencyStrategy_ShiftsTraffic(t *testing.T) {
+	var slowHits, fastHits atomic.Int32
+	delayed := func(d time.Duration, hits *atomic.Int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			time.Sleep(d)
+			w.Write([]byte(`{}`))
+		}))
+	}
+	slow := delayed(40*time.Millisecond, &slowHits)
+	defer slow.Close()
+	fast := delayed(time.Millisecond, &fastHits)
+	defer fast.Close()
+
+	cfg := newTestConfig()
+	cfg.Providers[0].BaseURL = slow.URL
+	cfg.Providers[1].BaseURL = fast.URL
+	cfg.Routes = nil
+	cfg.LoadBalance = StrategyLeastLatency
+	r, _ := New(cfg)
+	r.rand = rand.New(rand.NewSource(1))
+
+	for i := 0; i < 40; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, w.Code)
+		}
+		if i == minLatencySamples-1 && slowHits.Load() != minLatencySamples {
+			t.Errorf("cold metrics should follow priority order, slow got %d of %d", slowHits.Load(), i+1)
+		}
+	}
+
+	if fastHits.Load() < 3*slowHits.Load() {
+		t.Errorf("traffic should shift to the faster provider: slow=%d fast=%d", slowHits.Load(), fastHits.Load())
+	}
+	if m := r.current().providers["primary"].Metrics(); m.LatencyMs < 20 || m.Samples != int(slowHits.Load()) {
+		t.Errorf("primary metrics = %+v", m)
+	}
+}
+
+func TestLeastLatencyStrategy_NoStarvation(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.LoadBalance = StrategyLeastLatency
+	r, _ := New(cfg)
+	r.rand = rand.New(rand.NewSource(1))
+	for range minLatencySamples {
+		r.current().providers["primary"].metrics.observe(100 * time.Millisecond)
+		r.current().providers["secondary"].metrics.observe(10 * time.Millisecond)
+	}
+
+	counts := make(map[string]int)
+	for range 1000 {
+		counts[r.nextLeastLatency(r.current())]++
+	}
+	// Expected share of primary is (1/100) / (1/100 + 1/10) ≈ 9%
+	if counts["primary"] < 30 || counts["primary"] > 200 {
+		t.Errorf("picks should be inversely proportional to latency: %v", counts)
+	}
+
+	r.SetHealthy("secondary", false)
+	if name := r.nextLeastLatency(r.current()); name != "primary" {
+		t.Errorf("unhealthy providers must be skipped, got %s", name)
+	}
+}
+
+// === Limit Tests ===
+
+func TestParseConfig_NegativeLimit(t *testing.T) {
+	_, err := ParseConfig(`
+providers:
+  - name: openai
+    base_url: https://api.openai.com
+    max_prompt_tokens: -1
+`)
+	if err == nil || !strings.Contains(err.Error(), "provider openai") {
+		t.Errorf("expected limit error naming the provider, got %v", err)
+	}
+}
+
+// newLimitRouter routes to one upstream per provider config; each upstream
+// echoes its name and the body it received
+func newLimitRouter(t *testing.T, fallback bool, providers ...ProviderConfig) *Router {
+	t.Helper()
+	cfg := &RouterConfig{
+		Fallback:    FallbackConfig{Enabled: fallback, MaxAttempts: 3},
+		LoadBalance: StrategyPriority,
+	}
+	for i, pc := range providers {
+		name := pc.Name
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			json.NewEncoder(w).Encode(map[string]string{"provider": name, "body": string(body)})
+		}))
+		t.Cleanup(upstream.Close)
+		pc.BaseURL = upstream.URL
+		pc.Priority = i + 1
+		pc.Enabled = true
+		pc.TimeoutSec = 5
+		cfg.Providers = append(cfg.Providers, pc)
+	}
+	cfg.DefaultRoute = providers[0].Name
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func postChat(r *Router, body string) (*httptest.ResponseRecorder, map[string]string) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func TestLimits_MaxRequestBytes(t *testing.T) {
+	r := newLimitRouter(t, false, ProviderConfig{Name: "small", MaxRequestBytes: 64})
+
+	w, resp := postChat(r, `{"model":"m","messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK || resp["provider"] != "small" {
+		t.Fatalf("small request: %d %s", w.Code, w.Body)
+	}
+
+	w, resp = postChat(r, `{"model":"m","messages":[{"role":"user","content":"`+strings.Repeat("x", 100)+`"}]}`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", w.Code)
+	}
+	if resp["error"] != "request_too_large" || resp["provider"] != "small" || !strings.Contains(resp["message"], "at most 64") {
+		t.Errorf("unexpected error body: %s", w.Body)
+	}
+}
+
+func TestLimits_MaxPromptTokens(t *testing.T) {
+	r := newLimitRouter(t, false, ProviderConfig{Name: "short", MaxPromptTokens: 10})
+
+	// The model name is not part of the estimate
+	w, _ := postChat(r, `{"model":"`+strings.Repeat("m", 100)+`","messages":[{"role":"user","content":"hello"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("short prompt: %d %s", w.Code, w.Body)
+	}
+
+	w, resp := postChat(r, `{"model":"m","messages":[{"role":"user","content":"`+strings.Repeat("word ", 20)+`"}]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if resp["error"] != "prompt_too_long" || resp["provider"] != "short" || !strings.Contains(resp["message"], "at most 10") {
+		t.Errorf("unexpected error body: %s", w.Body)
+	}
+
+	// A custom estimator replaces the heuristic
+	r.SetTokenEstimator(func(text string) int { return len(strings.Fields(text)) })
+	if w, _ := postChat(r, `{"model":"m","messages":[{"role":"user","content":"`+strings.Repeat("word ", 9)+`"}]}`); w.Code != http.StatusOK {
+		t.Errorf("custom estimator: expected 200, got %d", w.Code)
+	}
+}
+
+func TestLimits_TokenizerByModel(t *testing.T) {
+	r := newLimitRouter(t, false, ProviderConfig{Name: "short", MaxPromptTokens: 10})
+	r.SetTokenizers(tokenizer.NewDefaultRegistry(nil, map[string]float64{"claude": 1}))
+
+	body := `{"model":"%s","messages":[{"role":"user","content":"hello hello"}]}`
+	if w, _ := postChat(r, fmt.Sprintf(body, "gpt-4o")); w.Code != http.StatusOK {
+		t.Errorf("gpt-4o: expected 200, got %d", w.Code)
+	}
+	// A character a token: 4 + 5 + 5
+	if w, _ := postChat(r, fmt.Sprintf(body, "claude-sonnet-4")); w.Code != http.StatusBadRequest {
+		t.Errorf("claude: expected 400, got %d", w.Code)
+	}
+}
+
+func TestLimits_MaxOutputTokensOverride(t *testing.T) {
+	r := newLimitRouter(t, false, ProviderConfig{Name: "capped", MaxOutputTokensOverride: 256})
+
+	tests := []struct {
+		body string
+		want any // max_tokens seen upstream, nil when absent
+	}{
+		{`{"model":"m","max_tokens":4096}`, float64(256)},
+		{`{"model":"m","max_tokens":100}`, float64(100)},
+		{`{"model":"m"}`, nil},
+	}
+	for _, tt := range tests {
+		w, resp := postChat(r, tt.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", tt.body, w.Code)
+		}
+		var sent map[string]any
+		if err := json.Unmarshal([]byte(resp["body"]), &sent); err != nil {
+			t.Fatalf("%s: upstream body %q: %v", tt.body, resp["body"], err)
+		}
+		if sent["max_tokens"] != tt.want {
+			t.Errorf("%s: upstream max_tokens = %v, want %v", tt.body, sent["max_tokens"], tt.want)
+		}
+	}
+
+	// Other spellings are clamped too
+	_, resp := postChat(r, `{"model":"m","max_completion_tokens":1000}`)
+	if !strings.Contains(resp["body"], `"max_completion_tokens":256`) {
+		t.Errorf("max_completion_tokens not clamped: %s", resp["body"])
+	}
+}
+
+func TestLimits_FallbackToLargerProvider(t *testing.T) {
+	r := newLimitRouter(t, true,
+		ProviderConfig{Name: "small", MaxRequestBytes: 64, MaxOutputTokensOverride: 100},
+		ProviderConfig{Name: "large", MaxRequestBytes: 4096, MaxOutputTokensOverride: 1000},
+	)
+	big := `{"model":"m","max_tokens":2000,"messages":[{"role":"user","content":"` + strings.Repeat("x", 200) + `"}]}`
+
+	w, resp := postChat(r, big)
+	if w.Code != http.StatusOK || resp["provider"] != "large" {
+		t.Fatalf("expected large provider to serve, got %d %s", w.Code, w.Body)
+	}
+	if !strings.Contains(resp["body"], `"max_tokens":1000`) {
+		t.Errorf("expected large provider's override, got %s", resp["body"])
+	}
+
+	// Requests small enough still go to the primary
+	if _, resp := postChat(r, `{"model":"m"}`); resp["provider"] != "small" {
+		t.Errorf("expected small provider, got %s", resp["provider"])
+	}
+
+	// Too large for every provider: the primary's limit is reported
+	w, resp = postChat(r, `{"model":"m","prompt":"`+strings.Repeat("x", 5000)+`"}`)
+	if w.Code != http.StatusRequestEntityTooLarge || resp["provider"] != "small" {
+		t.Errorf("expected 413 from small, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestRouteDetectorProfile(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	r, err := New(&RouterConfig{
+		Providers: []ProviderConfig{{Name: "openai", BaseURL: upstream.URL, Enabled: true, TimeoutSec: 5}},
+		Routes: []RouteConfig{
+			{PathPrefix: "/support", Provider: "openai", DetectorProfile: "strict"},
+			{PathPrefix: "/code", Provider: "openai"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	r.SetRequestModifier(func(req *http.Request) {
+		got = detector.ProfileFromContext(req.Context())
+	})
+
+	for path, want := range map[string]string{"/support/v1/chat/completions": "strict", "/code/v1/chat/completions": ""} {
+		got = "unset"
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}")))
+		if got != want {
+			t.Errorf("%s: profile = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestFallback_ClientGoneStopsAttempts(t *testing.T) {
+	var hits [2]atomic.Int64
+	cfg := &RouterConfig{Fallback: FallbackConfig{Enabled: true, MaxAttempts: 2, RetryDelaySec: 5}, LoadBalance: StrategyPriority}
+	for i, name := range []string{"openai", "anthropic"} {
+		count := &hits[i]
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count.Add(1)
+			io.ReadAll(r.Body)
+			<-r.Context().Done() // never answers
+		}))
+		t.Cleanup(srv.Close)
+		cfg.Providers = append(cfg.Providers, ProviderConfig{Name: name, BaseURL: srv.URL, Priority: i + 1, Enabled: true, TimeoutSec: 30})
+	}
+	cfg.DefaultRoute = "openai"
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	start := time.Now()
+	r.ServeHTTP(w, req)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request took %v after the client went away", elapsed)
+	}
+	if hits[0].Load() != 1 || hits[1].Load() != 0 {
+		t.Errorf("upstream requests = %d, %d; want 1, 0", hits[0].Load(), hits[1].Load())
+	}
+	if !r.IsHealthy("openai") {
+		t.Error("a client going away must not mark the provider unhealthy")
+	}
+	if w.Code != upstream.StatusClientClosed {
+		t.Errorf("status = %d, want %d", w.Code, upstream.StatusClientClosed)
+	}
+}
+
+func TestRecorder_SelectionsAndFallbacks(t *testing.T) {
+	r, _ := newRateLimitRouter(t, FallbackConfig{Enabled: true, MaxAttempts: 3}, "anthropic_429.http", "")
+	reg := metrics.NewRegistry()
+	r.SetRecorder(reg)
+
+	if w, _ := postChat(r, `{"model":"gpt-4o","messages":[]}`); w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var out strings.Builder
+	reg.WriteTo(&out)
+	for _, want := range []string{
+		`veil_provider_selected_total{provider="openai"} 1`,
+		`veil_provider_selected_total{provider="anthropic"} 1`,
+		`veil_fallback_attempts_total{provider="anthropic"} 1`,
+		`veil_upstream_latency_seconds_count{provider="anthropic"} 1`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics lack %s:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), `veil_fallback_attempts_total{provider="openai"}`) {
+		t.Error("the first attempt is not a fallback")
+	}
+}
@@ -0,0 +1,182 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sync/atomic"
+)
+
+// maxUsageBody is the largest JSON response, or SSE line, read for usage
+const maxUsageBody = 1 << 20
+
+type tallyKey struct{}
+
+// tally collects what inner handlers found in one request
+type tally struct {
+	threats atomic.Int64
+}
+
+// AddThreats records n threats (prompt injection detections, guardrail
+// violations) found in the request ctx belongs to. It is a no-op outside
+// Middleware.
+func AddThreats(ctx context.Context, n int) {
+	if t, ok := ctx.Value(tallyKey{}).(*tally); ok && n > 0 {
+		t.threats.Add(int64(n))
+	}
+}
+
+// Middleware counts the requests of explicit sessions, the tokens the
+// provider reports in their responses and the threats found in them.
+// Requests of implicit sessions pass through uncounted. It must wrap every
+// component that calls AddThreats.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Session-ID")
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t := &tally{}
+		uw := &usageWriter{ResponseWriter: w}
+		next.ServeHTTP(uw, r.WithContext(context.WithValue(r.Context(), tallyKey{}, t)))
+
+		// Record after the response so the store never adds latency
+		go m.record(context.Background(), id, uw.tokens(), t.threats.Load())
+	})
+}
+
+// usageWriter passes the response through while reading the token usage
+// from JSON bodies and from the data lines of event streams
+type usageWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	json        bool
+	stream      bool
+	skip        bool   // the body or current line is over maxUsageBody
+	buf         []byte // the JSON body, or the current SSE line
+	usage       usage
+}
+
+func (uw *usageWriter) WriteHeader(code int) {
+	if !uw.wroteHeader {
+		uw.wroteHeader = true
+		mt, _, _ := mime.ParseMediaType(uw.Header().Get("Content-Type"))
+		switch {
+		case uw.Header().Get("Content-Encoding") != "":
+		case mt == "text/event-stream":
+			uw.stream = true
+		case mt == "application/json":
+			uw.json = true
+		}
+	}
+	uw.ResponseWriter.WriteHeader(code)
+}
+
+func (uw *usageWriter) Write(b []byte) (int, error) {
+	if !uw.wroteHeader {
+		uw.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case uw.stream:
+		uw.scanLines(b)
+	case uw.json && !uw.skip:
+		if len(uw.buf)+len(b) > maxUsageBody {
+			uw.skip, uw.buf = true, nil
+		} else {
+			uw.buf = append(uw.buf, b...)
+		}
+	}
+	return uw.ResponseWriter.Write(b)
+}
+
+// scanLines reads usage from each complete "data:" line in b
+func (uw *usageWriter) scanLines(b []byte) {
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			if !uw.skip {
+				uw.buf = append(uw.buf, b...)
+				if len(uw.buf) > maxUsageBody {
+					uw.skip, uw.buf = true, nil
+				}
+			}
+			return
+		}
+		if !uw.skip {
+			uw.buf = append(uw.buf, b[:i]...)
+			if data, ok := bytes.CutPrefix(bytes.TrimRight(uw.buf, "\r"), []byte("data:")); ok {
+				uw.usage.merge(bytes.TrimSpace(data))
+			}
+		}
+		uw.skip, uw.buf = false, uw.buf[:0]
+		b = b[i+1:]
+	}
+}
+
+// Flush keeps SSE streaming working through the wrapper
+func (uw *usageWriter) Flush() {
+	if f, ok := uw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (uw *usageWriter) Unwrap() http.ResponseWriter {
+	return uw.ResponseWriter
+}
+
+// tokens returns the total tokens of the response, 0 when none was reported
+func (uw *usageWriter) tokens() int64 {
+	if uw.json && !uw.skip {
+		uw.usage.merge(uw.buf)
+	}
+	if uw.usage.total > 0 {
+		return uw.usage.total
+	}
+	return uw.usage.prompt + uw.usage.completion
+}
+
+// usage keeps the largest count seen for each field, since streams report
+// usage incrementally (Anthropic) or only in the final chunk (OpenAI)
+type usage struct {
+	prompt, completion, total int64
+}
+
+// merge reads the OpenAI, Anthropic or Gemini usage object of one JSON
+// document, which may be a stream event
+func (u *usage) merge(data []byte) {
+	if !bytes.Contains(data, []byte("oken")) {
+		return
+	}
+	type counts struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+		TotalTokens      int64 `json:"total_tokens"`
+		InputTokens      int64 `json:"input_tokens"`
+		OutputTokens     int64 `json:"output_tokens"`
+		PromptTokenCount int64 `json:"promptTokenCount"`
+		CandidatesCount  int64 `json:"candidatesTokenCount"`
+		TotalTokenCount  int64 `json:"totalTokenCount"`
+	}
+	var doc struct {
+		Usage         *counts `json:"usage"`
+		UsageMetadata *counts `json:"usageMetadata"`
+		Message       struct {
+			Usage *counts `json:"usage"` // Anthropic message_start
+		} `json:"message"`
+	}
+	if json.Unmarshal(data, &doc) != nil {
+		return
+	}
+	for _, c := range []*counts{doc.Usage, doc.UsageMetadata, doc.Message.Usage} {
+		if c == nil {
+			continue
+		}
+		u.prompt = max(u.prompt, c.PromptTokens, c.InputTokens, c.PromptTokenCount)
+		u.completion = max(u.completion, c.CompletionTokens, c.OutputTokens, c.CandidatesCount)
+		u.total = max(u.total, c.TotalTokens, c.TotalTokenCount)
+	}
+}
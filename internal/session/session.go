@@ -0,0 +1,205 @@
+// Package session gives sessions an optional explicit lifecycle.
+//
+// Sessions stay implicit by default: any X-Session-ID groups vault mappings
+// until their TTL runs out. A client may instead begin one with
+// POST /v1/sessions and end it with DELETE /v1/sessions/{id}. Explicit
+// sessions are counted while they run (requests, tokens, threats) and all
+// of their per-session state is purged the moment they end. Summaries carry
+// counts only, never values.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// DefaultTTL is how long an explicit session lives without requests
+const DefaultTTL = 24 * time.Hour
+
+// ErrNotFound is returned for IDs that are not open explicit sessions,
+// including implicit sessions
+var ErrNotFound = errors.New("session: not found")
+
+// Canaries issues canary tokens that are reported when they show up in a
+// later request, e.g. a promptguard.Guard
+type Canaries interface {
+	IssueCanary(sessionID string) string
+}
+
+// Purger drops per-session state another component keeps, e.g. canary
+// tokens or accumulated threat scores
+type Purger interface {
+	PurgeSession(ctx context.Context, sessionID string) error
+}
+
+// Config controls a Manager
+type Config struct {
+	// TTL is extended by every request of the session. Zero uses DefaultTTL.
+	TTL time.Duration
+	// Canaries, when set, lets Begin issue a canary token
+	Canaries Canaries
+	// Purgers are called by End after the vault mappings are deleted
+	Purgers []Purger
+	// Webhook, when set, receives a session.ended event from End
+	Webhook *webhook.Dispatcher
+}
+
+// Session is an explicit session as returned by Begin
+type Session struct {
+	ID         string    `json:"id"`
+	Canary     string    `json:"canary,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	TTLSeconds int64     `json:"ttl_seconds"`
+}
+
+// Totals describes an explicit session by counts only
+type Totals struct {
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Requests  int64      `json:"requests"`
+	Tokens    int64      `json:"tokens"`  // as reported by the provider
+	Threats   int64      `json:"threats"` // prompt guard detections and guardrail violations
+	// Entities counts the session's vault entries by category
+	Entities map[string]int `json:"entities"`
+	// Owner is the identity that began the session
+	Owner string `json:"-"`
+}
+
+// Manager keeps explicit sessions in Redis
+type Manager struct {
+	client redis.UniversalClient
+	vault  *vault.Vault
+	cfg    Config
+	now    func() time.Time
+}
+
+// New creates a Manager that purges sessions from v when they end
+func New(client redis.UniversalClient, v *vault.Vault, cfg Config) *Manager {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	return &Manager{client: client, vault: v, cfg: cfg, now: time.Now}
+}
+
+// key is the Redis hash of an explicit session
+func key(id string) string {
+	return "session:" + id
+}
+
+// Begin opens a session owned by owner (see proxy.SessionBinding for the
+// identity format), with a canary token if asked for and Canaries is set
+func (m *Manager) Begin(ctx context.Context, owner string, canary bool) (Session, error) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	s := Session{
+		ID:         "ses_" + hex.EncodeToString(b),
+		CreatedAt:  m.now().UTC().Truncate(time.Second),
+		TTLSeconds: int64(m.cfg.TTL / time.Second),
+	}
+	if canary && m.cfg.Canaries != nil {
+		s.Canary = m.cfg.Canaries.IssueCanary(s.ID)
+	}
+
+	pipe := m.client.TxPipeline()
+	pipe.HSet(ctx, key(s.ID), "created_at", s.CreatedAt.Format(time.RFC3339), "owner", owner,
+		"requests", 0, "tokens", 0, "threats", 0)
+	pipe.Expire(ctx, key(s.ID), m.cfg.TTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Session{}, fmt.Errorf("session: begin: %w", err)
+	}
+	return s, nil
+}
+
+// Summary returns the counts of an open session
+func (m *Manager) Summary(ctx context.Context, id string) (Totals, error) {
+	fields, err := m.client.HGetAll(ctx, key(id)).Result()
+	if err != nil {
+		return Totals{}, fmt.Errorf("session: %w", err)
+	}
+	if len(fields) == 0 {
+		return Totals{}, ErrNotFound
+	}
+	s := Totals{ID: id, Owner: fields["owner"], Entities: map[string]int{}}
+	s.CreatedAt, _ = time.Parse(time.RFC3339, fields["created_at"])
+	s.Requests, _ = strconv.ParseInt(fields["requests"], 10, 64)
+	s.Tokens, _ = strconv.ParseInt(fields["tokens"], 10, 64)
+	s.Threats, _ = strconv.ParseInt(fields["threats"], 10, 64)
+
+	info, err := m.vault.SessionInfo(ctx, id)
+	switch {
+	case errors.Is(err, vault.ErrSessionNotFound):
+	case err != nil:
+		return Totals{}, fmt.Errorf("session: %w", err)
+	default:
+		s.Entities = info.Categories
+	}
+	return s, nil
+}
+
+// End purges an open session: its vault mappings, the state kept by every
+// Purger and its counters. The final summary is returned and sent as a
+// session.ended event. A failing Purger is logged; the session still ends.
+func (m *Manager) End(ctx context.Context, id string) (Totals, error) {
+	s, err := m.Summary(ctx, id)
+	if err != nil {
+		return Totals{}, err
+	}
+	if err := m.vault.Delete(ctx, id); err != nil {
+		return Totals{}, fmt.Errorf("session: purge vault: %w", err)
+	}
+	for _, p := range m.cfg.Purgers {
+		if err := p.PurgeSession(ctx, id); err != nil {
+			slog.Warn("session: purge failed", "session", id, "error", err)
+		}
+	}
+	if err := m.client.Del(ctx, key(id)).Err(); err != nil {
+		return Totals{}, fmt.Errorf("session: end: %w", err)
+	}
+
+	ended := m.now().UTC().Truncate(time.Second)
+	s.EndedAt = &ended
+	if m.cfg.Webhook != nil {
+		m.cfg.Webhook.Emit(webhook.Event{
+			Type:      webhook.EventSessionEnded,
+			SessionID: id,
+			Data: map[string]any{
+				"duration_seconds": int64(ended.Sub(s.CreatedAt) / time.Second),
+				"requests":         s.Requests,
+				"tokens":           s.Tokens,
+				"threats":          s.Threats,
+				"entities":         s.Entities,
+			},
+		})
+	}
+	return s, nil
+}
+
+// recordScript counts one request of an explicit session and extends its
+// TTL. Implicit sessions have no hash and are left alone.
+var recordScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+redis.call('HINCRBY', KEYS[1], 'requests', 1)
+redis.call('HINCRBY', KEYS[1], 'tokens', ARGV[1])
+redis.call('HINCRBY', KEYS[1], 'threats', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+func (m *Manager) record(ctx context.Context, id string, tokens, threats int64) {
+	err := recordScript.Run(ctx, m.client, []string{key(id)}, tokens, threats, m.cfg.TTL.Milliseconds()).Err()
+	if err != nil {
+		slog.Warn("session: record failed", "session", id, "error", err)
+	}
+}
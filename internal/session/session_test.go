@@ -0,0 +1,202 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+type fakePurger struct {
+	purged []string
+	err    error
+}
+
+func (p *fakePurger) PurgeSession(_ context.Context, id string) error {
+	p.purged = append(p.purged, id)
+	return p.err
+}
+
+func setup(t *testing.T, cfg Config) (*Manager, *vault.Vault, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	v := vault.NewWithClient(client)
+	return New(client, v, cfg), v, mr
+}
+
+func TestManager_Lifecycle(t *testing.T) {
+	var mu sync.Mutex
+	var events []webhook.Event
+	hooks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+	defer hooks.Close()
+	whCfg := webhook.DefaultConfig()
+	whCfg.RetryCount = 0
+	whCfg.Destinations = []webhook.Destination{{
+		Name: "ops", URL: hooks.URL, Enabled: true, Events: []webhook.EventType{webhook.EventSessionEnded},
+	}}
+
+	failing := &fakePurger{err: errors.New("down")}
+	purger := &fakePurger{}
+	m, v, mr := setup(t, Config{TTL: time.Hour, Purgers: []Purger{failing, purger}, Webhook: webhook.NewDispatcher(whCfg)})
+	ctx := context.Background()
+
+	s, err := m.Begin(ctx, "key:k1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s.ID, "ses_") || s.TTLSeconds != 3600 || s.Canary != "" {
+		t.Fatalf("session = %+v", s)
+	}
+	if ttl := mr.TTL(key(s.ID)); ttl != time.Hour {
+		t.Errorf("ttl = %v", ttl)
+	}
+
+	v.Store(ctx, s.ID, map[string]string{"[CCCD_1]": "012345678901", "[EMAIL_1]": "a@example.com"})
+	m.record(ctx, s.ID, 120, 2)
+	m.record(ctx, s.ID, 30, 0)
+
+	got, err := m.Summary(ctx, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Requests != 2 || got.Tokens != 150 || got.Threats != 2 || got.Owner != "key:k1" ||
+		got.Entities["CCCD"] != 1 || got.Entities["EMAIL"] != 1 {
+		t.Errorf("summary = %+v", got)
+	}
+
+	final, err := m.End(ctx, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.EndedAt == nil || final.Requests != 2 {
+		t.Errorf("final = %+v", final)
+	}
+	if _, err := v.SessionInfo(ctx, s.ID); !errors.Is(err, vault.ErrSessionNotFound) {
+		t.Errorf("vault not purged: %v", err)
+	}
+	if len(purger.purged) != 1 || purger.purged[0] != s.ID {
+		t.Errorf("purger after a failing one: %v", purger.purged)
+	}
+	if _, err := m.Summary(ctx, s.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ended session: %v", err)
+	}
+	if _, err := m.End(ctx, s.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second end: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(events)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0].SessionID != s.ID || events[0].Data.(map[string]any)["requests"] != float64(2) {
+		t.Fatalf("events = %+v", events)
+	}
+	if raw, _ := json.Marshal(events[0]); strings.Contains(string(raw), "012345678901") {
+		t.Error("session.ended event must not contain original values")
+	}
+}
+
+func TestManager_RecordIgnoresImplicitSessions(t *testing.T) {
+	m, _, mr := setup(t, Config{})
+	m.record(context.Background(), "implicit", 10, 1)
+	if mr.Exists(key("implicit")) {
+		t.Error("record created a hash for an implicit session")
+	}
+	if _, err := m.Summary(context.Background(), "implicit"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("implicit summary: %v", err)
+	}
+}
+
+func TestMiddleware_CountsUsageAndThreats(t *testing.T) {
+	m, _, _ := setup(t, Config{})
+	ctx := context.Background()
+	s, _ := m.Begin(ctx, "ip:127.0.0.1", false)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []string
+		tokens      int64
+	}{
+		{"openai json", "application/json",
+			[]string{`{"choices":[],"usage":{"prompt_tokens":10,`, `"completion_tokens":5,"total_tokens":15}}`}, 15},
+		{"gemini json", "application/json; charset=utf-8",
+			[]string{`{"usageMetadata":{"promptTokenCount":7,"candidatesTokenCount":3,"totalTokenCount":10}}`}, 10},
+		{"anthropic stream", "text/event-stream", []string{
+			"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":25,\"output_tokens\":1}}}\n\n",
+			"data: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hi\"}}\n\nevent: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_",
+			"tokens\":12}}\n\ndata: [DONE]\n\n",
+		}, 37},
+		{"no usage", "text/plain", []string{`{"usage":{"total_tokens":99}}`}, 0},
+	}
+	var want int64
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				AddThreats(r.Context(), 1)
+				w.Header().Set("Content-Type", tt.contentType)
+				for _, chunk := range tt.body {
+					w.Write([]byte(chunk))
+				}
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			req.Header.Set("X-Session-ID", s.ID)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Body.String() != strings.Join(tt.body, "") {
+				t.Errorf("body altered: %q", rec.Body.String())
+			}
+
+			want += tt.tokens
+			var got Totals
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) {
+				got, _ = m.Summary(ctx, s.ID)
+				if got.Tokens == want && got.Threats == got.Requests {
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			if got.Tokens != want || got.Threats != got.Requests {
+				t.Errorf("totals = %+v, want tokens %d", got, want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_PassesRequestsWithoutSession(t *testing.T) {
+	m, _, _ := setup(t, Config{})
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(*usageWriter); ok {
+			t.Error("writer wrapped without a session")
+		}
+		AddThreats(r.Context(), 1) // no-op outside a counted request
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+}
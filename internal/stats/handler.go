@@ -0,0 +1,149 @@
+package stats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultWindow is queried when from is omitted
+const defaultWindow = 7 * 24 * time.Hour
+
+// maxWindow bounds a single query so it can't scan years of buckets
+const maxWindow = 366 * 24 * time.Hour
+
+// Handler serves GET /admin/stats/pii.
+//
+// Query parameters:
+//
+//	from, to   RFC 3339 timestamps or YYYY-MM-DD dates (default: last 7 days)
+//	bucket     hour or day (default day)
+//	group_by   comma-separated: category, key (default: neither)
+//	format     json or csv (default json)
+func (c *Collector) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, format, err := c.parseQuery(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"invalid_request","message":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		rows, err := c.Query(r.Context(), q)
+		if err != nil {
+			http.Error(w, `{"error":"stats_unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			writeCSV(w, rows)
+			return
+		}
+
+		bucket := "hour"
+		if q.Daily {
+			bucket = "day"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Report{
+			From:   q.From,
+			To:     q.To,
+			Bucket: bucket,
+			Noise:  c.config.NoiseEpsilon > 0,
+			Rows:   rows,
+		})
+	}
+}
+
+// Report is the JSON body of GET /admin/stats/pii
+type Report struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Bucket string    `json:"bucket"` // hour or day
+	Noise  bool      `json:"noise"`  // counts carry differential privacy noise
+	Rows   []Row     `json:"rows"`
+}
+
+func (c *Collector) parseQuery(r *http.Request) (Query, string, error) {
+	params := r.URL.Query()
+	q := Query{To: c.now().UTC(), Daily: true}
+
+	if s := params.Get("to"); s != "" {
+		t, err := parseTime(s)
+		if err != nil {
+			return q, "", fmt.Errorf("invalid to: %w", err)
+		}
+		q.To = t
+	}
+	q.From = q.To.Add(-defaultWindow)
+	if s := params.Get("from"); s != "" {
+		t, err := parseTime(s)
+		if err != nil {
+			return q, "", fmt.Errorf("invalid from: %w", err)
+		}
+		q.From = t
+	}
+	if !q.From.Before(q.To) {
+		return q, "", fmt.Errorf("from must be before to")
+	}
+	if q.To.Sub(q.From) > maxWindow {
+		return q, "", fmt.Errorf("range exceeds %d days", int(maxWindow.Hours()/24))
+	}
+
+	switch params.Get("bucket") {
+	case "", "day":
+	case "hour":
+		q.Daily = false
+	default:
+		return q, "", fmt.Errorf("bucket must be hour or day")
+	}
+
+	for _, g := range strings.Split(params.Get("group_by"), ",") {
+		switch strings.TrimSpace(g) {
+		case "":
+		case "category":
+			q.ByCat = true
+		case "key":
+			q.ByKey = true
+		default:
+			return q, "", fmt.Errorf("unknown group_by %q (want category, key)", g)
+		}
+	}
+
+	format := params.Get("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "csv":
+	default:
+		return q, "", fmt.Errorf("format must be json or csv")
+	}
+	return q, format, nil
+}
+
+// parseTime accepts RFC 3339 or a plain UTC date
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+func writeCSV(w http.ResponseWriter, rows []Row) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"bucket", "key", "category", "metric", "count"})
+	for _, row := range rows {
+		cw.Write([]string{
+			row.Bucket.Format(time.RFC3339),
+			row.Key,
+			row.Category,
+			row.Metric,
+			strconv.FormatInt(row.Count, 10),
+		})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,264 @@
+// Package stats keeps aggregate PII counters for governance dashboards.
+//
+// Only counts are stored: detections per category, sessions in which a
+// secret was seen, blocked requests and total requests, per hour bucket and
+// API key. No detected values are recorded, and session IDs are only held
+// (hashed) until their hour bucket ends, to count each session once.
+package stats
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// Metric names stored per bucket
+const (
+	MetricRequests       = "requests"
+	MetricDetections     = "detections"
+	MetricSecretSessions = "secret_sessions"
+	MetricBlocks         = "blocks"
+)
+
+// anonymousKey groups requests made without a Veil API key
+const anonymousKey = "anonymous"
+
+// Config controls retention and output noise
+type Config struct {
+	Retention time.Duration // how long hourly buckets are kept
+	// NoiseEpsilon adds Laplace noise with scale 1/epsilon to returned counts
+	// below NoiseThreshold, so small groups can't be singled out. Zero disables.
+	NoiseEpsilon   float64
+	NoiseThreshold int64
+}
+
+// DefaultConfig keeps 90 days without noise
+func DefaultConfig() Config {
+	return Config{
+		Retention:      90 * 24 * time.Hour,
+		NoiseThreshold: 20,
+	}
+}
+
+// Collector records and queries aggregate counters
+type Collector struct {
+	store  Store
+	config Config
+	now    func() time.Time
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// New creates a Collector backed by store
+func New(store Store, cfg Config) *Collector {
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultConfig().Retention
+	}
+	return &Collector{
+		store:  store,
+		config: cfg,
+		now:    time.Now,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// bucketOf truncates t to its hour bucket in UTC
+func bucketOf(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+// field encodes one counter within a bucket
+func field(metric, key, category string) string {
+	return metric + "|" + key + "|" + category
+}
+
+// Tally accumulates what happened to one request. Middleware puts it in
+// the request context; the anonymizer adds detections to it.
+type Tally struct {
+	mu         sync.Mutex
+	forwarded  bool
+	sessionID  string
+	categories map[pii.Category]int
+}
+
+type tallyKey struct{}
+
+// Forwarded marks the request as having passed Veil's checks, so an
+// upstream 403 isn't counted as a block
+func Forwarded(ctx context.Context) {
+	if t, ok := ctx.Value(tallyKey{}).(*Tally); ok {
+		t.mu.Lock()
+		t.forwarded = true
+		t.mu.Unlock()
+	}
+}
+
+// AddDetections records the categories detected in a request. It is a no-op
+// when the request isn't tracked.
+func AddDetections(ctx context.Context, sessionID string, categories []pii.Category) {
+	t, ok := ctx.Value(tallyKey{}).(*Tally)
+	if !ok || len(categories) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessionID = sessionID
+	for _, c := range categories {
+		t.categories[c]++
+	}
+}
+
+// Middleware counts each request, its detections and whether Veil blocked
+// it. A 403 written before the request was Forwarded counts as a block.
+func (c *Collector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := &Tally{categories: make(map[pii.Category]int)}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), tallyKey{}, t)))
+
+		key := r.Header.Get("X-Veil-Key-ID")
+		if key == "" {
+			key = anonymousKey
+		}
+		t.mu.Lock()
+		blocked := rec.status == http.StatusForbidden && !t.forwarded
+		categories := t.categories
+		sessionID := t.sessionID
+		t.mu.Unlock()
+
+		// Record after the response so the store never adds latency
+		go c.record(context.Background(), key, sessionID, categories, blocked)
+	})
+}
+
+func (c *Collector) record(ctx context.Context, key, sessionID string, categories map[pii.Category]int, blocked bool) {
+	bucket := bucketOf(c.now())
+	counts := map[string]int64{field(MetricRequests, key, ""): 1}
+	secret := false
+	for cat, n := range categories {
+		counts[field(MetricDetections, key, string(cat))] += int64(n)
+		if pii.IsSecretCategory(cat) {
+			secret = true
+		}
+	}
+	if blocked {
+		counts[field(MetricBlocks, key, "")] = 1
+	}
+	if err := c.store.Add(ctx, bucket, counts, c.config.Retention); err != nil {
+		slog.Warn("stats: record failed", "error", err)
+		return
+	}
+
+	if secret && sessionID != "" {
+		sum := sha256.Sum256([]byte(sessionID))
+		member := hex.EncodeToString(sum[:16])
+		if err := c.store.AddDistinct(ctx, bucket, field(MetricSecretSessions, key, ""), member, c.config.Retention); err != nil {
+			slog.Warn("stats: record session failed", "error", err)
+		}
+	}
+}
+
+// Row is one aggregated counter in a query result
+type Row struct {
+	Bucket   time.Time `json:"bucket"`
+	Key      string    `json:"key,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Metric   string    `json:"metric"`
+	Count    int64     `json:"count"`
+}
+
+// Query describes a stats request
+type Query struct {
+	From, To time.Time
+	Daily    bool // day buckets instead of hour buckets
+	ByKey    bool
+	ByCat    bool
+}
+
+// Query sums hourly buckets in [From, To) into the requested granularity and
+// grouping, then applies noise if configured
+func (c *Collector) Query(ctx context.Context, q Query) ([]Row, error) {
+	agg := make(map[Row]int64)
+	for b := bucketOf(q.From); b.Before(q.To); b = b.Add(time.Hour) {
+		counts, err := c.store.Load(ctx, b)
+		if err != nil {
+			return nil, err
+		}
+		out := b
+		if q.Daily {
+			out = b.Truncate(24 * time.Hour)
+		}
+		for f, n := range counts {
+			metric, key, category := splitField(f)
+			row := Row{Bucket: out, Metric: metric}
+			if q.ByKey {
+				row.Key = key
+			}
+			if q.ByCat {
+				row.Category = category
+			}
+			agg[row] += n
+		}
+	}
+
+	rows := make([]Row, 0, len(agg))
+	for row, n := range agg {
+		row.Count = c.noisy(n)
+		rows = append(rows, row)
+	}
+	sortRows(rows)
+	return rows, nil
+}
+
+// noisy applies Laplace noise to small counts
+func (c *Collector) noisy(n int64) int64 {
+	eps := c.config.NoiseEpsilon
+	if eps <= 0 || (c.config.NoiseThreshold > 0 && n >= c.config.NoiseThreshold) {
+		return n
+	}
+	c.mu.Lock()
+	u := c.rand.Float64() - 0.5
+	c.mu.Unlock()
+	noise := -(1 / eps) * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+	v := int64(math.Round(float64(n) + noise))
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// statusRecorder captures the response status
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working through the recorder
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
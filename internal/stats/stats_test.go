@@ -0,0 +1,256 @@
+package stats
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+var testNow = time.Date(2030, 3, 10, 14, 30, 0, 0, time.UTC)
+
+func newTestCollector(t *testing.T, store Store, cfg Config) *Collector {
+	t.Helper()
+	c := New(store, cfg)
+	c.now = func() time.Time { return testNow }
+	c.rand = rand.New(rand.NewSource(1))
+	return c
+}
+
+func stores(t *testing.T) map[string]Store {
+	mr := miniredis.RunT(t)
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"redis":  NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+}
+
+func find(rows []Row, metric, key, category string) int64 {
+	for _, r := range rows {
+		if r.Metric == metric && r.Key == key && r.Category == category {
+			return r.Count
+		}
+	}
+	return -1
+}
+
+func TestCollector_RecordAndQuery(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			c := newTestCollector(t, store, DefaultConfig())
+
+			c.record(ctx, "key-a", "s1", map[pii.Category]int{pii.CatEmail: 2, pii.CatAPIKeyOpenAI: 1}, false)
+			c.record(ctx, "key-a", "s1", map[pii.Category]int{pii.CatAPIKeyOpenAI: 1}, false)
+			c.record(ctx, "key-b", "s2", map[pii.Category]int{pii.CatEmail: 1}, false)
+			c.record(ctx, "key-b", "", nil, true)
+
+			q := Query{From: testNow.Add(-time.Hour), To: testNow.Add(time.Hour), Daily: true, ByKey: true, ByCat: true}
+			rows, err := c.Query(ctx, q)
+			if err != nil {
+				t.Fatalf("query: %v", err)
+			}
+
+			tests := []struct {
+				metric, key, cat string
+				want             int64
+			}{
+				{MetricDetections, "key-a", string(pii.CatEmail), 2},
+				{MetricDetections, "key-a", string(pii.CatAPIKeyOpenAI), 2},
+				{MetricDetections, "key-b", string(pii.CatEmail), 1},
+				{MetricRequests, "key-a", "", 2},
+				{MetricRequests, "key-b", "", 2},
+				// Same session twice in one hour counts once
+				{MetricSecretSessions, "key-a", "", 1},
+				{MetricSecretSessions, "key-b", "", -1},
+				{MetricBlocks, "key-b", "", 1},
+			}
+			for _, tt := range tests {
+				if got := find(rows, tt.metric, tt.key, tt.cat); got != tt.want {
+					t.Errorf("%s/%s/%s = %d, want %d", tt.metric, tt.key, tt.cat, got, tt.want)
+				}
+			}
+			for _, r := range rows {
+				if !r.Bucket.Equal(time.Date(2030, 3, 10, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("expected day bucket, got %v", r.Bucket)
+				}
+			}
+
+			// Without grouping, categories and keys collapse
+			rows, _ = c.Query(ctx, Query{From: q.From, To: q.To})
+			if got := find(rows, MetricDetections, "", ""); got != 5 {
+				t.Errorf("total detections = %d, want 5", got)
+			}
+			if got := find(rows, MetricRequests, "", ""); got != 4 {
+				t.Errorf("total requests = %d, want 4", got)
+			}
+		})
+	}
+}
+
+func TestRedisStore_Expiry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	c := newTestCollector(t, store, Config{Retention: 48 * time.Hour})
+	mr.SetTime(testNow)
+
+	c.record(context.Background(), "k", "secret-session", map[pii.Category]int{pii.CatJWT: 1}, false)
+
+	bucket := bucketKey(bucketOf(testNow))
+	if ttl := mr.TTL(bucket); ttl <= 0 || ttl > 48*time.Hour {
+		t.Errorf("bucket TTL = %v, want within retention", ttl)
+	}
+	for _, key := range mr.Keys() {
+		if strings.Contains(key, "secret-session") {
+			t.Errorf("raw session ID stored in key %s", key)
+		}
+		if strings.HasPrefix(key, redisSessionPrefix) {
+			// Session set lives only until the end of the hour
+			if ttl := mr.TTL(key); ttl <= 0 || ttl > 30*time.Minute {
+				t.Errorf("session set TTL = %v, want until end of hour", ttl)
+			}
+			for _, m := range must(mr.Members(key)) {
+				if m == "secret-session" {
+					t.Error("raw session ID stored as set member")
+				}
+			}
+		}
+	}
+}
+
+func must(v []string, err error) []string {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestCollector_Noise(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCollector(t, NewMemoryStore(), Config{NoiseEpsilon: 0.5, NoiseThreshold: 10})
+	c.record(ctx, "k", "", map[pii.Category]int{pii.CatEmail: 3, pii.CatPhone: 500}, false)
+
+	q := Query{From: testNow.Add(-time.Hour), To: testNow.Add(time.Hour), ByCat: true}
+	changed := false
+	for i := 0; i < 20; i++ {
+		rows, _ := c.Query(ctx, q)
+		if got := find(rows, MetricDetections, "", string(pii.CatPhone)); got != 500 {
+			t.Fatalf("count above threshold changed: %d", got)
+		}
+		got := find(rows, MetricDetections, "", string(pii.CatEmail))
+		if got < 0 {
+			t.Fatalf("noisy count must not be negative: %d", got)
+		}
+		if got != 3 {
+			changed = true
+		}
+	}
+	if !changed {
+		t.Error("expected noise on small counts")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := newTestCollector(t, NewMemoryStore(), DefaultConfig())
+	c.record(context.Background(), "k1", "", map[pii.Category]int{pii.CatEmail: 2}, false)
+
+	tests := []struct {
+		name, query string
+		wantStatus  int
+	}{
+		{"default", "", http.StatusOK},
+		{"grouped", "?from=2030-03-10&to=2030-03-11&group_by=category,key&bucket=hour", http.StatusOK},
+		{"bad bucket", "?bucket=week", http.StatusBadRequest},
+		{"bad group", "?group_by=session", http.StatusBadRequest},
+		{"inverted range", "?from=2030-03-11&to=2030-03-10", http.StatusBadRequest},
+		{"bad time", "?from=yesterday", http.StatusBadRequest},
+		{"bad format", "?format=xml", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/stats/pii"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	c.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/stats/pii?from=2030-03-10&to=2030-03-11&group_by=category", nil))
+	var resp struct {
+		Bucket string `json:"bucket"`
+		Rows   []Row  `json:"rows"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Bucket != "day" || find(resp.Rows, MetricDetections, "", string(pii.CatEmail)) != 2 {
+		t.Errorf("unexpected response: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	c.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/stats/pii?from=2030-03-10&to=2030-03-11&group_by=key&format=csv", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if len(records) != 3 || strings.Join(records[0], ",") != "bucket,key,category,metric,count" {
+		t.Fatalf("unexpected csv: %v", records)
+	}
+	if got := strings.Join(records[1], ","); got != "2030-03-10T00:00:00Z,k1,,detections,2" {
+		t.Errorf("row = %s", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	c := newTestCollector(t, NewMemoryStore(), DefaultConfig())
+
+	forwarded := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Forwarded(r.Context())
+		AddDetections(r.Context(), "sess", []pii.Category{pii.CatEmail, pii.CatEmail})
+		w.WriteHeader(http.StatusForbidden) // upstream 403 is not a block
+	}))
+	blocked := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "blocked", http.StatusForbidden)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("X-Veil-Key-ID", "key-1")
+	forwarded.ServeHTTP(httptest.NewRecorder(), req)
+	blocked.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+
+	q := Query{From: testNow.Add(-time.Hour), To: testNow.Add(time.Hour), ByKey: true, ByCat: true}
+	deadline := time.Now().Add(2 * time.Second)
+	var rows []Row
+	for time.Now().Before(deadline) {
+		rows, _ = c.Query(context.Background(), q)
+		if find(rows, MetricRequests, anonymousKey, "") == 1 && find(rows, MetricRequests, "key-1", "") == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := find(rows, MetricDetections, "key-1", string(pii.CatEmail)); got != 2 {
+		t.Errorf("detections = %d, want 2", got)
+	}
+	if got := find(rows, MetricBlocks, "key-1", ""); got != -1 {
+		t.Errorf("forwarded request counted as block")
+	}
+	if got := find(rows, MetricBlocks, anonymousKey, ""); got != 1 {
+		t.Errorf("blocks = %d, want 1", got)
+	}
+}
@@ -0,0 +1,206 @@
+package stats
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store persists hourly counter buckets
+type Store interface {
+	// Add increments counters in bucket; the bucket expires after retention
+	Add(ctx context.Context, bucket time.Time, counts map[string]int64, retention time.Duration) error
+	// AddDistinct increments field the first time member is seen in bucket.
+	// Members are forgotten when the bucket's hour ends.
+	AddDistinct(ctx context.Context, bucket time.Time, field, member string, retention time.Duration) error
+	// Load returns all counters of bucket
+	Load(ctx context.Context, bucket time.Time) (map[string]int64, error)
+}
+
+// MemoryStore keeps buckets in process, for single-instance deployments
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[time.Time]map[string]int64
+	members  map[time.Time]map[string]bool
+	now      func() time.Time
+	lastTrim time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[time.Time]map[string]int64),
+		members: make(map[time.Time]map[string]bool),
+		now:     time.Now,
+	}
+}
+
+// Add increments counters and drops buckets older than retention
+func (m *MemoryStore) Add(_ context.Context, bucket time.Time, counts map[string]int64, retention time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.trim(retention)
+	b, ok := m.buckets[bucket]
+	if !ok {
+		b = make(map[string]int64)
+		m.buckets[bucket] = b
+	}
+	for f, n := range counts {
+		b[f] += n
+	}
+	return nil
+}
+
+// AddDistinct increments field once per member within the bucket's hour
+func (m *MemoryStore) AddDistinct(_ context.Context, bucket time.Time, field, member string, retention time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.trim(retention)
+	seen, ok := m.members[bucket]
+	if !ok {
+		seen = make(map[string]bool)
+		m.members[bucket] = seen
+	}
+	if seen[field+"|"+member] {
+		return nil
+	}
+	seen[field+"|"+member] = true
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		b = make(map[string]int64)
+		m.buckets[bucket] = b
+	}
+	b[field]++
+	return nil
+}
+
+// Load returns a copy of the bucket's counters
+func (m *MemoryStore) Load(_ context.Context, bucket time.Time) (map[string]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[string]int64, len(m.buckets[bucket]))
+	for f, n := range m.buckets[bucket] {
+		out[f] = n
+	}
+	return out, nil
+}
+
+// trim expires old buckets and finished session sets at most once a minute
+func (m *MemoryStore) trim(retention time.Duration) {
+	now := m.now()
+	if now.Sub(m.lastTrim) < time.Minute {
+		return
+	}
+	m.lastTrim = now
+	for b := range m.buckets {
+		if now.Sub(b) > retention {
+			delete(m.buckets, b)
+		}
+	}
+	for b := range m.members {
+		if !now.Before(b.Add(time.Hour)) {
+			delete(m.members, b)
+		}
+	}
+}
+
+// RedisStore keeps buckets in Redis so replicas aggregate into one view.
+// Each hour is a hash stats:pii:<YYYYMMDDHH> with one field per counter.
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+const (
+	redisKeyPrefix     = "stats:pii:"
+	redisSessionPrefix = "stats:pii:sessions:"
+	bucketKeyLayout    = "2006010215"
+)
+
+// NewRedisStore creates a Redis-backed store
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func bucketKey(bucket time.Time) string {
+	return redisKeyPrefix + bucket.UTC().Format(bucketKeyLayout)
+}
+
+// Add increments counters with HINCRBY and refreshes the bucket's expiry
+func (s *RedisStore) Add(ctx context.Context, bucket time.Time, counts map[string]int64, retention time.Duration) error {
+	key := bucketKey(bucket)
+	pipe := s.client.Pipeline()
+	for f, n := range counts {
+		pipe.HIncrBy(ctx, key, f, n)
+	}
+	pipe.ExpireAt(ctx, key, bucket.Add(retention))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// AddDistinct tracks members in a set that expires when the hour ends, and
+// increments field only when SADD reports a new member
+func (s *RedisStore) AddDistinct(ctx context.Context, bucket time.Time, field, member string, retention time.Duration) error {
+	setKey := redisSessionPrefix + bucket.UTC().Format(bucketKeyLayout) + ":" + field
+	pipe := s.client.Pipeline()
+	added := pipe.SAdd(ctx, setKey, member)
+	pipe.ExpireAt(ctx, setKey, bucket.Add(time.Hour))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if added.Val() == 0 {
+		return nil
+	}
+	return s.Add(ctx, bucket, map[string]int64{field: 1}, retention)
+}
+
+// Load reads all counters of bucket
+func (s *RedisStore) Load(ctx context.Context, bucket time.Time) (map[string]int64, error) {
+	vals, err := s.client.HGetAll(ctx, bucketKey(bucket)).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(vals))
+	for f, v := range vals {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		out[f] = n
+	}
+	return out, nil
+}
+
+// splitField decodes a counter field into metric, key and category
+func splitField(f string) (metric, key, category string) {
+	parts := strings.SplitN(f, "|", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// sortRows orders rows by bucket, metric, key and category
+func sortRows(rows []Row) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if !a.Bucket.Equal(b.Bucket) {
+			return a.Bucket.Before(b.Bucket)
+		}
+		if a.Metric != b.Metric {
+			return a.Metric < b.Metric
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Category < b.Category
+	})
+}
@@ -0,0 +1,548 @@
+// Package streamscan inspects Server-Sent Events responses while they
+// stream, so output checks that used to need the whole body can run on
+// OpenAI, Anthropic and Gemini streaming responses. Gemini streams sent as
+// a JSON array of chunks rather than SSE are scanned element by element.
+//
+// Events are held back until the text they carry has passed a check. Checks
+// run on sentence boundaries, whenever Interval bytes of unchecked text have
+// accumulated, and before any event that carries no text (finish chunks,
+// [DONE], heartbeats). A client therefore never receives text that a later
+// check in the same window would have blocked.
+//
+// A check sees a sliding window rather than the whole response: the last
+// Window bytes of text already checked, followed by the new text. Memory
+// stays bounded by the window plus the held events however long the
+// response runs, and a match of up to Window bytes that spans two checks
+// is still seen whole. Every check scans the whole window, so its size
+// trades the longest match caught across checks against check time.
+package streamscan
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultInterval is how much unchecked text may accumulate before a check
+// runs without waiting for a sentence boundary
+const DefaultInterval = 256
+
+// DefaultWindow is how much checked text each check sees again ahead of
+// the new text
+const DefaultWindow = 1 << 10
+
+// ErrStopped is returned by Write once the stream was blocked or cut. A
+// ReverseProxy treats it as a copy failure and closes the upstream body.
+var ErrStopped = errors.New("streamscan: stream stopped")
+
+// Config controls a Writer
+type Config struct {
+	// Interval is the unchecked text, in bytes, that triggers a check
+	// without a sentence boundary. Zero uses DefaultInterval.
+	Interval int
+
+	// Window is the checked text, in bytes, kept ahead of new text so
+	// matches spanning two checks are found. Zero uses DefaultWindow.
+	Window int
+
+	// Check inspects the window: the tail of the text already checked and
+	// everything after it. A non-nil result blocks the stream and is sent
+	// as the "error" object of the terminal event.
+	Check func(text string) any
+
+	// MaxText cuts the stream once this many bytes of text were sent and
+	// ends it with Marker as the final delta. Zero disables the limit.
+	MaxText int
+	Marker  string
+
+	// Limit, when set, replaces MaxText with a limit in other units, such
+	// as tokens. It is fed every delta and belongs to one Writer.
+	Limit Limiter
+
+	// JSONArray scans a successful application/json response as a JSON
+	// array of chunks, the way Gemini's streamGenerateContent streams
+	// without alt=sse; each element is handled like an event. Otherwise
+	// such responses pass through.
+	JSONArray bool
+}
+
+// Limiter cuts a stream at a limit
+type Limiter interface {
+	// Add returns the part of delta within the limit and whether the
+	// limit cut it
+	Add(delta string) (keep string, cut bool)
+}
+
+// format is the provider event shape, needed to synthesize a final delta
+type format int
+
+const (
+	formatUnknown format = iota
+	formatOpenAI
+	formatAnthropic
+	formatGemini
+)
+
+// Writer is an http.ResponseWriter that scans an SSE body before
+// forwarding it. Responses that are not text/event-stream, or a JSON array
+// under Config.JSONArray, pass through untouched. Call Finish after the
+// handler returns to release held events.
+type Writer struct {
+	w   http.ResponseWriter
+	cfg Config
+
+	passthrough bool
+	wroteHeader bool
+	array       bool     // body is a JSON array of chunks
+	elem        elemScan // array element boundary state
+	opened      bool     // array bytes were forwarded, "[" included
+
+	partial   []byte   // bytes of an event not yet terminated
+	pending   [][]byte // complete events waiting for a check
+	window    []byte   // checked tail plus unchecked text
+	unchecked int
+	streamed  int // text bytes streamed, held ones included
+	format    format
+	block     int // Anthropic content block index of the last text delta
+
+	stopped   bool
+	blocked   any
+	truncated bool
+}
+
+// NewWriter wraps w
+func NewWriter(w http.ResponseWriter, cfg Config) *Writer {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	return &Writer{w: w, cfg: cfg}
+}
+
+// Header returns the underlying header map
+func (sw *Writer) Header() http.Header {
+	return sw.w.Header()
+}
+
+// WriteHeader forwards the status and switches to passthrough when the
+// response is not an event stream (e.g. an upstream JSON error)
+func (sw *Writer) WriteHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+	contentType := sw.w.Header().Get("Content-Type")
+	switch {
+	case strings.Contains(contentType, "text/event-stream"):
+		// The body is rewritten when cut or blocked
+		sw.w.Header().Del("Content-Length")
+	case sw.cfg.JSONArray && strings.Contains(contentType, "application/json") && code < 300:
+		sw.array = true
+		sw.w.Header().Del("Content-Length")
+	default:
+		sw.passthrough = true
+	}
+	sw.w.WriteHeader(code)
+}
+
+// Write buffers complete events and forwards those whose text passed
+func (sw *Writer) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if sw.passthrough {
+		return sw.w.Write(b)
+	}
+	if sw.stopped {
+		return 0, ErrStopped
+	}
+
+	sw.partial = append(sw.partial, b...)
+	for !sw.stopped {
+		end, sepLen := sw.eventEnd()
+		if end < 0 {
+			break
+		}
+		event := bytes.Clone(sw.partial[:end+sepLen])
+		sw.partial = sw.partial[end+sepLen:]
+		sw.handle(event)
+	}
+	if sw.stopped {
+		return len(b), ErrStopped
+	}
+	return len(b), nil
+}
+
+// Flush flushes released events. Held events stay buffered.
+func (sw *Writer) Flush() {
+	if f, ok := sw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Finish checks and releases whatever is still held, including a trailing
+// event without its blank line
+func (sw *Writer) Finish() {
+	if sw.passthrough || sw.stopped {
+		return
+	}
+	if len(sw.partial) > 0 {
+		sw.handle(sw.partial)
+		sw.partial = nil
+	}
+	if !sw.stopped {
+		sw.release()
+	}
+}
+
+// Stopped reports whether the stream was blocked or cut
+func (sw *Writer) Stopped() bool { return sw.stopped }
+
+// Blocked returns the Check result that blocked the stream, or nil
+func (sw *Writer) Blocked() any { return sw.blocked }
+
+// Truncated reports whether the stream was cut at MaxText or Limit
+func (sw *Writer) Truncated() bool { return sw.truncated }
+
+// Text returns the text in the window, without the marker. For responses
+// shorter than Window this is all text forwarded (or held) so far.
+func (sw *Writer) Text() string { return string(sw.window) }
+
+// Streamed returns how many bytes of text were forwarded (or held), without
+// the marker
+func (sw *Writer) Streamed() int { return sw.streamed }
+
+func (sw *Writer) handle(event []byte) {
+	delta, f, index := eventText(event, sw.array)
+	if f != formatUnknown {
+		sw.format = f
+	}
+	if delta != "" {
+		sw.block = index
+	}
+
+	if delta == "" {
+		// Finish chunks, [DONE] and pings must not overtake held text
+		sw.pending = append(sw.pending, event)
+		sw.release()
+		return
+	}
+
+	if keep, cut := sw.limit(delta); cut {
+		sw.add(keep)
+		if !sw.check() {
+			return
+		}
+		sw.truncate(keep)
+		return
+	}
+
+	sw.add(delta)
+	sw.pending = append(sw.pending, event)
+	if sw.unchecked >= sw.cfg.Interval || strings.ContainsAny(delta, ".!?\n。") {
+		sw.release()
+	}
+}
+
+// add appends delta to the window as unchecked text
+func (sw *Writer) add(delta string) {
+	sw.window = append(sw.window, delta...)
+	sw.unchecked += len(delta)
+	sw.streamed += len(delta)
+}
+
+// slide drops checked text beyond Window bytes from the front of the
+// window, reusing its buffer
+func (sw *Writer) slide() {
+	drop := len(sw.window) - sw.cfg.Window
+	if drop <= 0 {
+		return
+	}
+	for drop < len(sw.window) && !utf8.RuneStart(sw.window[drop]) {
+		drop++
+	}
+	sw.window = sw.window[:copy(sw.window, sw.window[drop:])]
+}
+
+// limit returns the part of delta within the text limit, and whether the
+// limit cut it
+func (sw *Writer) limit(delta string) (string, bool) {
+	if sw.cfg.Limit != nil {
+		return sw.cfg.Limit.Add(delta)
+	}
+	if sw.cfg.MaxText > 0 && sw.streamed+len(delta) > sw.cfg.MaxText {
+		return cutUTF8(delta, sw.cfg.MaxText-sw.streamed), true
+	}
+	return delta, false
+}
+
+// release checks unchecked text and forwards held events if it passed
+func (sw *Writer) release() {
+	if !sw.check() {
+		return
+	}
+	for _, e := range sw.pending {
+		sw.write(e)
+	}
+	sw.pending = sw.pending[:0]
+	sw.Flush()
+}
+
+// write forwards held bytes
+func (sw *Writer) write(b []byte) {
+	if len(b) > 0 {
+		sw.opened = true
+	}
+	sw.w.Write(b)
+}
+
+// check runs Check over the window, then slides it. On a block the held
+// events are dropped and the terminal error event is sent.
+func (sw *Writer) check() bool {
+	if sw.unchecked == 0 || sw.cfg.Check == nil {
+		sw.unchecked = 0
+		sw.slide()
+		return true
+	}
+	sw.unchecked = 0
+	verdict := sw.cfg.Check(string(sw.window))
+	if verdict == nil {
+		sw.slide()
+		return true
+	}
+	sw.blocked = verdict
+	sw.pending = nil
+	sw.stopped = true
+	if sw.array {
+		data, _ := json.Marshal(map[string]any{"error": verdict})
+		sw.w.Write(sw.closeArray(data))
+	} else {
+		data, _ := json.Marshal(map[string]any{"type": "error", "error": verdict})
+		sw.w.Write([]byte("event: error\ndata: " + string(data) + "\n\n"))
+	}
+	sw.Flush()
+	return false
+}
+
+// closeArray returns the bytes that end an array stream with element
+func (sw *Writer) closeArray(element []byte) []byte {
+	if sw.opened {
+		return append(append([]byte(",\r\n"), element...), "\n]"...)
+	}
+	return append(append([]byte("["), element...), "\n]"...)
+}
+
+// truncate forwards held events, then the kept part of the crossing delta
+// with the marker, then the provider's end-of-stream event
+func (sw *Writer) truncate(keep string) {
+	for _, e := range sw.pending {
+		sw.write(e)
+	}
+	sw.pending = nil
+	sw.w.Write(sw.finalEvents(keep + sw.cfg.Marker))
+	sw.Flush()
+	sw.stopped = true
+	sw.truncated = true
+}
+
+func (sw *Writer) finalEvents(text string) []byte {
+	var out bytes.Buffer
+	switch {
+	case sw.format == formatGemini || sw.array:
+		chunk, _ := json.Marshal(map[string]any{
+			"candidates": []any{map[string]any{
+				"content":      map[string]any{"role": "model", "parts": []any{map[string]any{"text": text}}},
+				"finishReason": "MAX_TOKENS",
+				"index":        0,
+			}},
+		})
+		if sw.array {
+			return sw.closeArray(chunk)
+		}
+		out.WriteString("data: " + string(chunk) + "\n\n")
+	case sw.format == formatAnthropic:
+		delta, _ := json.Marshal(map[string]any{
+			"type":  "content_block_delta",
+			"index": sw.block,
+			"delta": map[string]any{"type": "text_delta", "text": text},
+		})
+		stop, _ := json.Marshal(map[string]any{"type": "content_block_stop", "index": sw.block})
+		out.WriteString("event: content_block_delta\ndata: " + string(delta) + "\n\n")
+		out.WriteString("event: content_block_stop\ndata: " + string(stop) + "\n\n")
+		out.WriteString("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	default:
+		chunk, _ := json.Marshal(map[string]any{
+			"object": "chat.completion.chunk",
+			"choices": []any{map[string]any{
+				"index":         0,
+				"delta":         map[string]any{"content": text},
+				"finish_reason": "length",
+			}},
+		})
+		out.WriteString("data: " + string(chunk) + "\n\n")
+		out.WriteString("data: [DONE]\n\n")
+	}
+	return out.Bytes()
+}
+
+// eventEnd returns the end of the first event in the partial bytes and the
+// length of its separator, or -1
+func (sw *Writer) eventEnd() (int, int) {
+	if sw.array {
+		return sw.elem.end(sw.partial), 0
+	}
+	return eventEnd(sw.partial)
+}
+
+// elemScan finds the elements of a JSON array across writes. An event is
+// everything up to the end of an element, the "[" or "," before it
+// included, so forwarding events in order rebuilds the array; the closing
+// "]" is left for Finish.
+type elemScan struct {
+	pos      int // bytes of the partial event already scanned
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+// end returns the index after the first complete element in b, or -1
+func (e *elemScan) end(b []byte) int {
+	for ; e.pos < len(b); e.pos++ {
+		c := b[e.pos]
+		switch {
+		case e.escaped:
+			e.escaped = false
+		case e.inString:
+			switch c {
+			case '\\':
+				e.escaped = true
+			case '"':
+				e.inString = false
+			}
+		case c == '"':
+			e.inString = true
+		case c == '{' || c == '[':
+			e.depth++
+		case c == '}' || c == ']':
+			e.depth--
+			if e.depth == 1 {
+				end := e.pos + 1
+				e.pos = 0
+				return end
+			}
+		}
+	}
+	return -1
+}
+
+// eventEnd returns the index of the blank line terminating the first event
+// in b and the separator length, or -1
+func eventEnd(b []byte) (int, int) {
+	lf := bytes.Index(b, []byte("\n\n"))
+	crlf := bytes.Index(b, []byte("\r\n\r\n"))
+	switch {
+	case crlf >= 0 && (lf < 0 || crlf < lf):
+		return crlf, 4
+	case lf >= 0:
+		return lf, 2
+	}
+	return -1, 0
+}
+
+// eventText returns the assistant text carried by one SSE event or JSON
+// array element, its format and, for Anthropic, the content block index
+func eventText(event []byte, array bool) (string, format, int) {
+	var data bytes.Buffer
+	if array {
+		if i := bytes.IndexByte(event, '{'); i >= 0 {
+			data.Write(event[i:])
+		}
+	}
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		if array {
+			break
+		}
+		line = bytes.TrimRight(line, "\r")
+		if d, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.Write(bytes.TrimPrefix(d, []byte(" ")))
+		}
+	}
+	if data.Len() == 0 || data.String() == "[DONE]" {
+		return "", formatUnknown, 0
+	}
+
+	var chunk struct {
+		Type    string `json:"type"`
+		Index   int    `json:"index"`
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+			Text string `json:"text"`
+		} `json:"choices"`
+		Delta struct {
+			Text string `json:"text"`
+		} `json:"delta"`
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					Text         string `json:"text"`
+					FunctionCall *struct {
+						Name string          `json:"name"`
+						Args json.RawMessage `json:"args"`
+					} `json:"functionCall"`
+				} `json:"parts"`
+			} `json:"content"`
+		} `json:"candidates"`
+	}
+	if json.Unmarshal(data.Bytes(), &chunk) != nil {
+		return "", formatUnknown, 0
+	}
+	if chunk.Type != "" {
+		return chunk.Delta.Text, formatAnthropic, chunk.Index
+	}
+	if chunk.Choices != nil {
+		var sb strings.Builder
+		for _, c := range chunk.Choices {
+			sb.WriteString(c.Delta.Content)
+			sb.WriteString(c.Text)
+		}
+		return sb.String(), formatOpenAI, 0
+	}
+	if chunk.Candidates != nil {
+		var sb strings.Builder
+		for _, c := range chunk.Candidates {
+			for _, p := range c.Content.Parts {
+				sb.WriteString(p.Text)
+				if p.FunctionCall != nil {
+					// Function call arguments are model output too
+					sb.WriteString(p.FunctionCall.Name + " " + string(p.FunctionCall.Args))
+				}
+			}
+		}
+		return sb.String(), formatGemini, 0
+	}
+	return "", formatUnknown, 0
+}
+
+// cutUTF8 returns at most n bytes of s without splitting a rune
+func cutUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
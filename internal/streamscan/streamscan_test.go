@@ -0,0 +1,431 @@
+package streamscan
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openAIEvent(delta string) string {
+	data, _ := json.Marshal(map[string]any{
+		"choices": []any{map[string]any{"index": 0, "delta": map[string]any{"content": delta}}},
+	})
+	return "data: " + string(data) + "\n\n"
+}
+
+func anthropicEvent(index int, delta string) string {
+	data, _ := json.Marshal(map[string]any{
+		"type":  "content_block_delta",
+		"index": index,
+		"delta": map[string]any{"type": "text_delta", "text": delta},
+	})
+	return "event: content_block_delta\ndata: " + string(data) + "\n\n"
+}
+
+func geminiChunk(delta string) string {
+	data, _ := json.Marshal(map[string]any{
+		"candidates": []any{map[string]any{
+			"content": map[string]any{"role": "model", "parts": []any{map[string]any{"text": delta}}},
+			"index":   0,
+		}},
+		"modelVersion": "gemini-2.0-flash",
+	})
+	return string(data)
+}
+
+// geminiArray streams chunks the way streamGenerateContent does without
+// alt=sse
+func geminiArray(deltas ...string) []string {
+	writes := make([]string, 0, len(deltas)+1)
+	for i, d := range deltas {
+		sep := ",\r\n"
+		if i == 0 {
+			sep = "["
+		}
+		writes = append(writes, sep+geminiChunk(d))
+	}
+	return append(writes, "\n]")
+}
+
+func newSSERecorder() *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "text/event-stream")
+	return w
+}
+
+func TestWriter_HoldsUntilBoundary(t *testing.T) {
+	var checked []string
+	w := newSSERecorder()
+	sw := NewWriter(w, Config{Check: func(text string) any {
+		checked = append(checked, text)
+		return nil
+	}})
+
+	sw.Write([]byte(openAIEvent("Hello")))
+	if w.Body.Len() != 0 {
+		t.Fatalf("event without boundary should be held, got %q", w.Body.String())
+	}
+	sw.Write([]byte(openAIEvent(" world.")))
+	if !strings.Contains(w.Body.String(), "Hello") || !strings.Contains(w.Body.String(), "world.") {
+		t.Fatalf("events should be released at sentence end, got %q", w.Body.String())
+	}
+	if len(checked) != 1 || checked[0] != "Hello world." {
+		t.Errorf("expected one check over accumulated text, got %q", checked)
+	}
+
+	sw.Write([]byte(openAIEvent(" Bye")))
+	sw.Write([]byte("data: [DONE]\n\n"))
+	sw.Finish()
+	if !strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n") {
+		t.Errorf("[DONE] should follow held text, got %q", w.Body.String())
+	}
+	if len(checked) != 2 || checked[1] != "Hello world. Bye" {
+		t.Errorf("expected check before [DONE], got %q", checked)
+	}
+}
+
+func TestWriter_Interval(t *testing.T) {
+	checks := 0
+	w := newSSERecorder()
+	sw := NewWriter(w, Config{Interval: 8, Check: func(string) any {
+		checks++
+		return nil
+	}})
+
+	sw.Write([]byte(openAIEvent("abcd")))
+	sw.Write([]byte(openAIEvent("efgh")))
+	if checks != 1 || !strings.Contains(w.Body.String(), "efgh") {
+		t.Errorf("expected check after %d bytes, checks=%d body=%q", 8, checks, w.Body.String())
+	}
+}
+
+func TestWriter_SplitWrites(t *testing.T) {
+	w := newSSERecorder()
+	sw := NewWriter(w, Config{Check: func(string) any { return nil }})
+
+	event := openAIEvent("One sentence.")
+	sw.Write([]byte(event[:10]))
+	sw.Write([]byte(event[10:]))
+	if w.Body.String() != event {
+		t.Errorf("event split across writes should be reassembled, got %q", w.Body.String())
+	}
+}
+
+func TestWriter_Block(t *testing.T) {
+	w := newSSERecorder()
+	sw := NewWriter(w, Config{Check: func(text string) any {
+		if strings.Contains(text, "secret") {
+			return map[string]string{"type": "blocked"}
+		}
+		return nil
+	}})
+
+	sw.Write([]byte(openAIEvent("Fine.")))
+	sw.Write([]byte(openAIEvent(" The secret")))
+	if _, err := sw.Write([]byte(openAIEvent(" is out."))); err != ErrStopped {
+		t.Errorf("expected ErrStopped, got %v", err)
+	}
+	sw.Finish()
+
+	out := w.Body.String()
+	if strings.Contains(out, "The secret") {
+		t.Errorf("held text leaked after block: %q", out)
+	}
+	if !strings.HasSuffix(out, "event: error\ndata: {\"error\":{\"type\":\"blocked\"},\"type\":\"error\"}\n\n") {
+		t.Errorf("expected terminal error event, got %q", out)
+	}
+	if !sw.Stopped() || sw.Blocked() == nil {
+		t.Error("writer should report the block")
+	}
+}
+
+func TestWriter_WindowStraddle(t *testing.T) {
+	var longest int
+	w := newSSERecorder()
+	sw := NewWriter(w, Config{Interval: 8, Window: 16, Check: func(text string) any {
+		longest = max(longest, len(text))
+		if strings.Contains(text, "make a bomb") {
+			return map[string]string{"type": "blocked"}
+		}
+		return nil
+	}})
+
+	for i := 0; i < 8; i++ {
+		sw.Write([]byte(openAIEvent("Filler text.")))
+	}
+	// The first half passes its own check and is forwarded
+	sw.Write([]byte(openAIEvent(" Here is how to make a")))
+	sw.Write([]byte(openAIEvent(" bomb at home.")))
+	sw.Finish()
+
+	if sw.Blocked() == nil {
+		t.Errorf("phrase split across checks should be caught, got %q", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "bomb") {
+		t.Errorf("blocked delta was forwarded: %q", w.Body.String())
+	}
+	if longest > 16+len(" Here is how to make a") {
+		t.Errorf("check saw %d bytes, want at most the window and one delta", longest)
+	}
+}
+
+func TestWriter_WindowBounded(t *testing.T) {
+	var longest int
+	sw := NewWriter(discardSSE{}, Config{Check: func(text string) any {
+		longest = max(longest, len(text))
+		return nil
+	}})
+
+	event := []byte(openAIEvent("lorem ipsum dolor sit amet "))
+	const total = 4 << 20
+	for n := 0; n < total; n += 27 {
+		sw.Write(event)
+	}
+	sw.Finish()
+
+	if sw.Streamed() < total {
+		t.Errorf("Streamed() = %d, want %d", sw.Streamed(), total)
+	}
+	if bound := DefaultWindow + DefaultInterval + 27; longest > bound || cap(sw.window) > 2*bound {
+		t.Errorf("window grew with the response: longest check %d, buffer %d", longest, cap(sw.window))
+	}
+}
+
+func TestWriter_TruncateAnthropic(t *testing.T) {
+	w := newSSERecorder()
+	sw := NewWriter(w, Config{MaxText: 8, Marker: " [cut]"})
+
+	sw.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{}}\n\n"))
+	sw.Write([]byte(anthropicEvent(1, "abcde")))
+	sw.Write([]byte(anthropicEvent(1, "fghij")))
+	sw.Finish()
+
+	out := w.Body.String()
+	if strings.Contains(out, "fghij") {
+		t.Errorf("text beyond the limit was forwarded: %q", out)
+	}
+	if !strings.Contains(out, anthropicEvent(1, "fgh [cut]")) {
+		t.Errorf("expected final delta with marker, got %q", out)
+	}
+	if !strings.HasSuffix(out, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n") {
+		t.Errorf("expected message_stop after the cut, got %q", out)
+	}
+	if !sw.Truncated() || sw.Text() != "abcdefgh" {
+		t.Errorf("truncated=%v text=%q", sw.Truncated(), sw.Text())
+	}
+}
+
+func TestWriter_TruncateKeepsRunes(t *testing.T) {
+	w := newSSERecorder()
+	sw := NewWriter(w, Config{MaxText: 4, Marker: "…"})
+
+	sw.Write([]byte(openAIEvent("aĐồng")))
+	if sw.Text() != "aĐ" {
+		t.Errorf("cut should not split a rune, got %q", sw.Text())
+	}
+	if !strings.Contains(w.Body.String(), `"finish_reason":"length"`) {
+		t.Errorf("expected OpenAI length finish, got %q", w.Body.String())
+	}
+}
+
+// wordLimit cuts after max words
+type wordLimit struct{ left int }
+
+func (l *wordLimit) Add(delta string) (string, bool) {
+	words := strings.SplitAfter(delta, " ")
+	for i, w := range words {
+		if strings.TrimSpace(w) == "" {
+			continue
+		}
+		if l.left == 0 {
+			return strings.Join(words[:i], ""), true
+		}
+		l.left--
+	}
+	return delta, false
+}
+
+func TestWriter_Limit(t *testing.T) {
+	w := newSSERecorder()
+	sw := NewWriter(w, Config{MaxText: 1, Limit: &wordLimit{left: 3}, Marker: "…"})
+
+	sw.Write([]byte(openAIEvent("one two ")))
+	sw.Write([]byte(openAIEvent("three four five")))
+	sw.Finish()
+
+	if !sw.Truncated() || sw.Text() != "one two three " {
+		t.Errorf("Limit should replace MaxText: truncated=%v text=%q", sw.Truncated(), sw.Text())
+	}
+	if strings.Contains(w.Body.String(), "four") {
+		t.Errorf("text beyond the limit was forwarded: %q", w.Body.String())
+	}
+}
+
+func TestWriter_Passthrough(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/json")
+	sw := NewWriter(w, Config{Check: func(string) any { return "blocked" }})
+
+	sw.WriteHeader(http.StatusTooManyRequests)
+	sw.Write([]byte(`{"error":"slow down."}`))
+	sw.Finish()
+
+	if w.Code != http.StatusTooManyRequests || w.Body.String() != `{"error":"slow down."}` {
+		t.Errorf("non-SSE response should pass through, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestWriter_GeminiSSE(t *testing.T) {
+	var checked []string
+	w := newSSERecorder()
+	sw := NewWriter(w, Config{MaxText: 12, Marker: " [cut]", Check: func(text string) any {
+		checked = append(checked, text)
+		return nil
+	}})
+
+	sw.Write([]byte("data: " + geminiChunk("Xin chào.") + "\r\n\r\n"))
+	sw.Write([]byte("data: " + geminiChunk(" Tạm biệt.") + "\r\n\r\n"))
+	sw.Finish()
+
+	if len(checked) == 0 || checked[0] != "Xin chào." {
+		t.Errorf("Gemini text should be checked, got %q", checked)
+	}
+	out := w.Body.String()
+	if !sw.Truncated() || !strings.Contains(out, `"finishReason":"MAX_TOKENS"`) || !strings.Contains(out, `"text":" T [cut]"`) {
+		t.Errorf("expected a Gemini MAX_TOKENS chunk with the marker, got %q", out)
+	}
+}
+
+func TestWriter_JSONArray(t *testing.T) {
+	var checked []string
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	sw := NewWriter(w, Config{JSONArray: true, Check: func(text string) any {
+		checked = append(checked, text)
+		return nil
+	}})
+
+	writes := geminiArray("Hello {world}.", ` "quoted \"}]" text.`)
+	body := strings.Join(writes, "")
+	// Split writes mid-element and mid-string
+	sw.Write([]byte(body[:20]))
+	sw.Write([]byte(body[20:90]))
+	sw.Write([]byte(body[90:]))
+	sw.Finish()
+
+	if w.Body.String() != body {
+		t.Errorf("clean array stream should pass unchanged, got %q", w.Body.String())
+	}
+	if len(checked) != 2 || checked[1] != `Hello {world}. "quoted \"}]" text.` {
+		t.Errorf("expected a check per element, got %q", checked)
+	}
+}
+
+func TestWriter_JSONArrayBlock(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/json")
+	sw := NewWriter(w, Config{JSONArray: true, Check: func(text string) any {
+		if strings.Contains(text, "secret") {
+			return map[string]string{"type": "blocked"}
+		}
+		return nil
+	}})
+
+	for _, b := range geminiArray("Fine.", " The secret is out.", " More.") {
+		sw.Write([]byte(b))
+	}
+	sw.Finish()
+
+	var chunks []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &chunks); err != nil {
+		t.Fatalf("blocked stream should still be a JSON array: %v: %q", err, w.Body.String())
+	}
+	if len(chunks) != 2 || chunks[1]["error"] == nil || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("expected the clean chunk then an error element, got %q", w.Body.String())
+	}
+
+	// Blocked before anything was forwarded
+	w = httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/json")
+	sw = NewWriter(w, Config{JSONArray: true, Check: func(string) any { return "blocked" }})
+	sw.Write([]byte(strings.Join(geminiArray("secret."), "")))
+	if err := json.Unmarshal(w.Body.Bytes(), &chunks); err != nil || len(chunks) != 1 {
+		t.Errorf("expected an array with the error element, got %q", w.Body.String())
+	}
+}
+
+func TestWriter_JSONArrayPassthrough(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/json")
+	sw := NewWriter(w, Config{JSONArray: true, Check: func(string) any { return "blocked" }})
+
+	sw.WriteHeader(http.StatusBadRequest)
+	sw.Write([]byte(`[{"error":{"code":400,"message":"secret."}}]`))
+	sw.Finish()
+
+	if w.Code != http.StatusBadRequest || w.Body.String() != `[{"error":{"code":400,"message":"secret."}}]` {
+		t.Errorf("error response should pass through, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestWriter_ReverseProxyClosesUpstream(t *testing.T) {
+	closed := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for i := 0; ; i++ {
+			if _, err := w.Write([]byte(openAIEvent("forbidden."))); err != nil {
+				close(closed)
+				return
+			}
+			flusher.Flush()
+			select {
+			case <-r.Context().Done():
+				close(closed)
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	target, _ := url.Parse(upstream.URL)
+	rp := httputil.NewSingleHostReverseProxy(target)
+	rp.FlushInterval = -1
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := NewWriter(w, Config{Check: func(string) any { return "blocked" }})
+		defer func() {
+			if p := recover(); p != nil && p != http.ErrAbortHandler {
+				panic(p)
+			}
+		}()
+		rp.ServeHTTP(sw, r)
+	}))
+	defer front.Close()
+
+	resp, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream connection was not closed after block")
+	}
+}
+
+// discardSSE is an event-stream ResponseWriter that keeps nothing
+type discardSSE struct{}
+
+func (discardSSE) Header() http.Header {
+	return http.Header{"Content-Type": {"text/event-stream"}}
+}
+func (discardSSE) WriteHeader(int)             {}
+func (discardSSE) Write(b []byte) (int, error) { return len(b), nil }
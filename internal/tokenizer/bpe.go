@@ -0,0 +1,283 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CL100KBase is the name of the encoding of GPT-4 and GPT-3.5 models
+const CL100KBase = "cl100k_base"
+
+// Cache bounds: pieces are the words and punctuation runs of text, so a
+// few thousand cover most of a language
+const (
+	maxCachedPieces   = 1 << 16
+	maxCachedPieceLen = 64
+)
+
+// maxPieceLen is where pieces are split before merging. Byte-pair merging
+// is quadratic in the piece, and a piece is only this long in base64
+// blobs, minified code and the like, where the count stays close.
+const maxPieceLen = 512
+
+// BPE is a byte-pair encoding in the format of tiktoken's rank files, with
+// cl100k_base's rules for splitting text into pieces. Counting needs only
+// the ranks, not the token ids of special tokens, which are counted as
+// text.
+type BPE struct {
+	name  string
+	ranks map[string]int
+
+	counts sync.Map // piece -> tokens
+	cached atomic.Int32
+}
+
+// NewBPE returns the encoding of ranks, keyed by token bytes
+func NewBPE(name string, ranks map[string]int) *BPE {
+	return &BPE{name: name, ranks: ranks}
+}
+
+// LoadCL100K reads cl100k_base from a tiktoken rank file
+// (cl100k_base.tiktoken): one base64 token and its rank per line
+func LoadCL100K(r io.Reader) (*BPE, error) {
+	ranks := make(map[string]int, 100256)
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want <base64 token> <rank>", line)
+		}
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: rank %q: %w", line, rank, err)
+		}
+		ranks[string(b)] = n
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for c := 0; c < 256; c++ {
+		if _, ok := ranks[string([]byte{byte(c)})]; !ok {
+			return nil, fmt.Errorf("not a byte-level rank file: byte %#02x has no rank", c)
+		}
+	}
+	return NewBPE(CL100KBase, ranks), nil
+}
+
+// LoadCL100KFile reads cl100k_base from the rank file at path
+func LoadCL100KFile(path string) (*BPE, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadCL100K(f)
+}
+
+// Name implements Tokenizer
+func (b *BPE) Name() string { return b.name }
+
+// Count implements Tokenizer
+func (b *BPE) Count(text string) int {
+	n := 0
+	for i := 0; i < len(text); {
+		end := nextPiece(text, i)
+		n += b.countPiece(text[i:end])
+		i = end
+	}
+	return n
+}
+
+// Truncate implements Tokenizer
+func (b *BPE) Truncate(text string, max int) (string, bool) {
+	n := 0
+	for i := 0; i < len(text); {
+		end := nextPiece(text, i)
+		c := b.countPiece(text[i:end])
+		if n+c <= max {
+			n += c
+			i = end
+			continue
+		}
+		// Cut inside the piece after the tokens that fit, backing off to
+		// the start of a rune the last token ended inside of
+		cut := i
+		if keep := max - n; keep > 0 {
+			cut = i + b.tokenEnds(text[i:end])[keep-1]
+		}
+		for cut > i && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		return text[:cut], true
+	}
+	return text, false
+}
+
+func (b *BPE) countPiece(piece string) int {
+	if _, ok := b.ranks[piece]; ok {
+		return 1
+	}
+	if len(piece) > maxCachedPieceLen {
+		return len(b.tokenEnds(piece))
+	}
+	if n, ok := b.counts.Load(piece); ok {
+		return n.(int)
+	}
+	n := len(b.tokenEnds(piece))
+	if b.cached.Load() < maxCachedPieces {
+		if _, loaded := b.counts.LoadOrStore(piece, n); !loaded {
+			b.cached.Add(1)
+		}
+	}
+	return n
+}
+
+// tokenEnds returns the end offset of each token of piece
+func (b *BPE) tokenEnds(piece string) []int {
+	var ends []int
+	for len(piece) > maxPieceLen {
+		cut := maxPieceLen
+		for cut > 0 && !utf8.RuneStart(piece[cut]) {
+			cut--
+		}
+		off := 0
+		if len(ends) > 0 {
+			off = ends[len(ends)-1]
+		}
+		for _, e := range b.merge(piece[:cut]) {
+			ends = append(ends, off+e)
+		}
+		piece = piece[cut:]
+	}
+	off := 0
+	if len(ends) > 0 {
+		off = ends[len(ends)-1]
+	}
+	for _, e := range b.merge(piece) {
+		ends = append(ends, off+e)
+	}
+	return ends
+}
+
+// merge applies the lowest-ranked merge of adjacent parts of piece until
+// none applies, and returns the end offset of each resulting token
+func (b *BPE) merge(piece string) []int {
+	// bounds[i] is where the i-th part starts; the last is len(piece)
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, at := math.MaxInt, -1
+		for i := 0; i+2 < len(bounds); i++ {
+			if r, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && r < best {
+				best, at = r, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		bounds = append(bounds[:at+1], bounds[at+2:]...)
+	}
+	return bounds[1:]
+}
+
+// nextPiece returns the end of the piece of text starting at i, following
+// cl100k_base's split pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}|
+//	 ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func nextPiece(text string, i int) int {
+	r, size := utf8.DecodeRuneInString(text[i:])
+
+	// Contractions
+	if r == '\'' && i+1 < len(text) {
+		rest := text[i+1:]
+		for _, c := range []string{"s", "t", "re", "ve", "m", "ll", "d"} {
+			if len(rest) >= len(c) && strings.EqualFold(rest[:len(c)], c) {
+				return i + 1 + len(c)
+			}
+		}
+	}
+
+	// Letters, with one leading character that is not a newline, letter
+	// or number
+	j := i
+	if !unicode.IsLetter(r) && !isNewline(r) && !unicode.IsNumber(r) {
+		j = i + size
+	}
+	if end := skip(text, j, unicode.IsLetter, -1); end > j {
+		return end
+	}
+
+	// Up to three numbers
+	if unicode.IsNumber(r) {
+		return skip(text, i, unicode.IsNumber, 3)
+	}
+
+	// Punctuation, with one leading space and trailing newlines
+	j = i
+	if r == ' ' {
+		j++
+	}
+	if end := skip(text, j, isPunct, -1); end > j {
+		return skip(text, end, isNewline, -1)
+	}
+
+	// Whitespace
+	end := skip(text, i, unicode.IsSpace, -1)
+	if end == i {
+		return i + size // unreachable: every rune is matched above
+	}
+	// ending in newlines
+	if nl := strings.LastIndexAny(text[i:end], "\r\n"); nl >= 0 {
+		return i + nl + 1
+	}
+	// not followed by non-space, leaving one space to the next piece
+	if end < len(text) {
+		_, last := utf8.DecodeLastRuneInString(text[i:end])
+		if end-last > i {
+			return end - last
+		}
+	}
+	return end
+}
+
+// skip returns the end of the run of runes matching fn at i, at most max
+// runes long unless max is negative
+func skip(text string, i int, fn func(rune) bool, max int) int {
+	for n := 0; i < len(text) && n != max; n++ {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !fn(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+func isNewline(r rune) bool { return r == '\r' || r == '\n' }
+
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
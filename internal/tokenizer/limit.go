@@ -0,0 +1,69 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// settleAt is how long the uncounted tail of a stream may grow before
+// its settled part is counted for good
+const settleAt = 1 << 10
+
+// Limit counts streamed text against a token limit without recounting
+// the whole stream on every delta. Text before a space that starts a word
+// is counted once and kept as a number: BPE pieces never span that
+// boundary, so the count is exact there, while the estimate may count a
+// token more per settled kilobyte. A Limit belongs to one stream.
+type Limit struct {
+	tk      Tokenizer
+	max     int
+	settled int    // tokens of the text before tail
+	tail    string // text not yet settled
+}
+
+// NewLimit returns a limit of max tokens of tk
+func NewLimit(tk Tokenizer, max int) *Limit {
+	return &Limit{tk: tk, max: max}
+}
+
+// Add appends delta and returns the part of it within the limit, and
+// whether the limit cut it. Once cut, the stream is over.
+func (l *Limit) Add(delta string) (string, bool) {
+	prev := len(l.tail)
+	l.tail += delta
+	if l.settled+l.tk.Count(l.tail) <= l.max {
+		if len(l.tail) > settleAt {
+			if b := lastWordStart(l.tail); b > 0 {
+				l.settled += l.tk.Count(l.tail[:b])
+				l.tail = l.tail[b:]
+			}
+		}
+		return delta, false
+	}
+	kept, _ := l.tk.Truncate(l.tail, l.max-l.settled)
+	if len(kept) <= prev {
+		return "", true
+	}
+	return kept[prev:], true
+}
+
+// Count returns the tokens added so far
+func (l *Limit) Count() int {
+	return l.settled + l.tk.Count(l.tail)
+}
+
+// lastWordStart returns the offset of the last space that follows a
+// non-space and precedes a letter, or 0
+func lastWordStart(s string) int {
+	for i := len(s) - 2; i > 0; i-- {
+		if s[i] != ' ' {
+			continue
+		}
+		next, _ := utf8.DecodeRuneInString(s[i+1:])
+		prev, _ := utf8.DecodeLastRuneInString(s[:i])
+		if unicode.IsLetter(next) && !unicode.IsSpace(prev) {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,272 @@
+// Package tokenizer counts and truncates text in model tokens. OpenAI-family
+// models use a byte-pair encoding compatible with tiktoken's cl100k_base
+// when its rank file is loaded; other families, and OpenAI without the
+// file, use a per-family estimate.
+//
+// The old rule of four characters a token let Vietnamese output run to about
+// three times its limit, since most vocabularies spend roughly a token per
+// syllable, and cut English code short.
+package tokenizer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts text in the tokens of one model family. Implementations
+// are safe for concurrent use.
+type Tokenizer interface {
+	// Name identifies the tokenizer in logs, e.g. "cl100k_base"
+	Name() string
+	// Count returns the number of tokens in text
+	Count(text string) int
+	// Truncate returns the longest prefix of text of at most max tokens,
+	// cut on a token boundary and never inside a rune, and whether text
+	// was cut
+	Truncate(text string, max int) (string, bool)
+}
+
+// DefaultCharsPerToken is the estimate's ratio for unknown model families
+const DefaultCharsPerToken = 4.0
+
+// Estimate approximates tokens without a vocabulary. Each word costs its
+// length in runes divided by CharsPerToken, and at least one token, so
+// short words and the syllables of Vietnamese, which BPE vocabularies
+// rarely merge, are not undercounted.
+type Estimate struct {
+	CharsPerToken float64
+}
+
+// Name implements Tokenizer
+func (e Estimate) Name() string {
+	return "estimate:" + strconv.FormatFloat(e.ratio(), 'f', -1, 64)
+}
+
+func (e Estimate) ratio() float64 {
+	if e.CharsPerToken <= 0 {
+		return DefaultCharsPerToken
+	}
+	return e.CharsPerToken
+}
+
+// wordCost is the tokens of a word of n runes
+func (e Estimate) wordCost(n int) float64 {
+	return math.Max(1, float64(n)/e.ratio())
+}
+
+// Count implements Tokenizer
+func (e Estimate) Count(text string) int {
+	total := 0.0
+	eachWord(text, func(_, _, n int) bool {
+		total += e.wordCost(n)
+		return true
+	})
+	return int(math.Ceil(total))
+}
+
+// Truncate implements Tokenizer. Text is cut before the first word that
+// does not fit, or inside it when it is the first word.
+func (e Estimate) Truncate(text string, max int) (string, bool) {
+	if e.Count(text) <= max {
+		return text, false
+	}
+	cut := 0
+	total := 0.0
+	first := true
+	eachWord(text, func(start, end, n int) bool {
+		total += e.wordCost(n)
+		if math.Ceil(total) <= float64(max) {
+			first = false
+			return true
+		}
+		cut = start
+		if first && max > 0 {
+			// A single word over the limit: keep what fits of it
+			for k := int(float64(max) * e.ratio()); k > 0 && cut < end; k-- {
+				_, size := utf8.DecodeRuneInString(text[cut:])
+				cut += size
+			}
+		}
+		return false
+	})
+	return text[:cut], true
+}
+
+// eachWord calls fn with the byte span and rune count of each
+// whitespace-separated word of text until fn returns false
+func eachWord(text string, fn func(start, end, runes int) bool) {
+	start, n := 0, 0
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if n > 0 && !fn(start, i, n) {
+				return
+			}
+			n = 0
+			continue
+		}
+		if n == 0 {
+			start = i
+		}
+		n++
+	}
+	if n > 0 {
+		fn(start, len(text), n)
+	}
+}
+
+// Family maps model names to a tokenizer
+type Family struct {
+	Name string
+	// Prefixes of the model names of the family, matched case-insensitively
+	Prefixes  []string
+	Tokenizer Tokenizer
+}
+
+// OpenAIPrefixes are the model name prefixes of the OpenAI family
+var OpenAIPrefixes = []string{"gpt-", "chatgpt", "o1", "o3", "o4", "text-embedding", "ft:gpt"}
+
+// DefaultFamilies are the families of the default registry: OpenAI with
+// bpe, or an estimate when bpe is nil, then Anthropic and Google
+func DefaultFamilies(bpe *BPE) []Family {
+	var openai Tokenizer = Estimate{CharsPerToken: 4}
+	if bpe != nil {
+		openai = bpe
+	}
+	return []Family{
+		{Name: "openai", Prefixes: OpenAIPrefixes, Tokenizer: openai},
+		{Name: "claude", Prefixes: []string{"claude", "anthropic."}, Tokenizer: Estimate{CharsPerToken: 3.5}},
+		{Name: "gemini", Prefixes: []string{"gemini", "gemma"}, Tokenizer: Estimate{CharsPerToken: 4}},
+	}
+}
+
+// Registry selects the tokenizer of a model. Lookups are cached per model
+// name; it is safe for concurrent use.
+type Registry struct {
+	families []Family
+	fallback Tokenizer
+	byModel  sync.Map // model name -> Tokenizer
+	cached   atomic.Int32
+}
+
+// NewRegistry returns a registry over families, trying them in order.
+// Models of no family use fallback, an Estimate when nil.
+func NewRegistry(families []Family, fallback Tokenizer) *Registry {
+	if fallback == nil {
+		fallback = Estimate{CharsPerToken: DefaultCharsPerToken}
+	}
+	return &Registry{families: families, fallback: fallback}
+}
+
+var defaultRegistry = NewRegistry(DefaultFamilies(nil), nil)
+
+// Default returns the registry of DefaultFamilies without a BPE rank file
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// maxCachedModels bounds the per-model cache; model names come from
+// request bodies
+const maxCachedModels = 1024
+
+// For returns the tokenizer of model; "" selects the fallback
+func (r *Registry) For(model string) Tokenizer {
+	if t, ok := r.byModel.Load(model); ok {
+		return t.(Tokenizer)
+	}
+	t := r.lookup(model)
+	if r.cached.Load() < maxCachedModels {
+		if _, loaded := r.byModel.LoadOrStore(model, t); !loaded {
+			r.cached.Add(1)
+		}
+	}
+	return t
+}
+
+func (r *Registry) lookup(model string) Tokenizer {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if model != "" {
+		// Provider-qualified names, e.g. "openai/gpt-4o"
+		if _, name, ok := strings.Cut(model, "/"); ok {
+			model = name
+		}
+		for _, f := range r.families {
+			for _, p := range f.Prefixes {
+				if strings.HasPrefix(model, p) {
+					return f.Tokenizer
+				}
+			}
+		}
+	}
+	return r.fallback
+}
+
+// Fallback returns the tokenizer of models of no family
+func (r *Registry) Fallback() Tokenizer {
+	return r.fallback
+}
+
+// String describes the registry for logs and `agentveil config show`,
+// e.g. "openai=cl100k_base, claude=estimate:3.5, default=estimate:4"
+func (r *Registry) String() string {
+	parts := make([]string, 0, len(r.families)+1)
+	for _, f := range r.families {
+		parts = append(parts, f.Name+"="+f.Tokenizer.Name())
+	}
+	return strings.Join(append(parts, "default="+r.fallback.Name()), ", ")
+}
+
+// ParseRatios parses per-family estimate ratios in characters per token,
+// e.g. "claude=3.2,default=4". Family names are those of DefaultFamilies
+// plus "default" for models of no family.
+func ParseRatios(raw string) (map[string]float64, error) {
+	ratios := make(map[string]float64)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: want family=chars_per_token", item)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		known := name == "default"
+		for _, f := range DefaultFamilies(nil) {
+			known = known || f.Name == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown model family %q", name)
+		}
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || ratio <= 0 {
+			return nil, fmt.Errorf("%s: characters per token must be a positive number, got %q", name, value)
+		}
+		ratios[name] = ratio
+	}
+	return ratios, nil
+}
+
+// NewDefaultRegistry returns the registry of DefaultFamilies with ratios
+// overriding the estimates by family name. bpe may be nil; the OpenAI
+// family then uses ratios["openai"] too.
+func NewDefaultRegistry(bpe *BPE, ratios map[string]float64) *Registry {
+	families := DefaultFamilies(bpe)
+	for i, f := range families {
+		if ratio, ok := ratios[f.Name]; ok {
+			if _, isEstimate := f.Tokenizer.(Estimate); isEstimate {
+				families[i].Tokenizer = Estimate{CharsPerToken: ratio}
+			}
+		}
+	}
+	var fallback Tokenizer
+	if ratio, ok := ratios["default"]; ok {
+		fallback = Estimate{CharsPerToken: ratio}
+	}
+	return NewRegistry(families, fallback)
+}
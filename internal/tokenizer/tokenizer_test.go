@@ -0,0 +1,218 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// toyBPE is a byte-level vocabulary with a few merges, in rank file form
+func toyBPE(t testing.TB) *BPE {
+	t.Helper()
+	var sb strings.Builder
+	rank := 0
+	add := func(token string) {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+		rank++
+	}
+	for c := 0; c < 256; c++ {
+		add(string([]byte{byte(c)}))
+	}
+	for _, m := range []string{"he", "ll", "hell", "hello", " w", "or", " wor", "ld", " world", "ng", "ư"} {
+		add(m)
+	}
+	bpe, err := LoadCL100K(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bpe
+}
+
+func TestNextPiece(t *testing.T) {
+	text := "Hello world's 12345 !!\n\n  x\tTHE'LL"
+	var pieces []string
+	for i := 0; i < len(text); {
+		end := nextPiece(text, i)
+		pieces = append(pieces, text[i:end])
+		i = end
+	}
+	want := []string{"Hello", " world", "'s", " ", "123", "45", " !!\n\n", " ", " x", "\tTHE", "'LL"}
+	if strings.Join(pieces, "|") != strings.Join(want, "|") {
+		t.Errorf("pieces = %q, want %q", pieces, want)
+	}
+}
+
+func TestBPE_Count(t *testing.T) {
+	bpe := toyBPE(t)
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 1},
+		{"hel", 2},         // he, l
+		{"hello world", 2}, // hello, " world"
+		{" hello", 2},      // " ", hello, merged inside the piece
+		{"người", 6},       // ng, ư, the three bytes of ờ, i
+		{"x", 1},
+	}
+	for _, tt := range tests {
+		if got := bpe.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBPE_TruncateKeepsRunes(t *testing.T) {
+	bpe := toyBPE(t)
+	text := "người hello"
+	for max := 0; max <= bpe.Count(text); max++ {
+		got, cut := bpe.Truncate(text, max)
+		if !utf8.ValidString(got) || !strings.HasPrefix(text, got) {
+			t.Fatalf("Truncate(%d) = %q: not a rune-aligned prefix", max, got)
+		}
+		if n := bpe.Count(got); n > max {
+			t.Errorf("Truncate(%d) = %q has %d tokens", max, got, n)
+		}
+		if cut != (max < bpe.Count(text)) {
+			t.Errorf("Truncate(%d): cut = %v", max, cut)
+		}
+	}
+	// The bytes of "ờ" are three tokens, kept only together
+	for _, max := range []int{2, 3, 4} {
+		if got, _ := bpe.Truncate("người", max); got != "ngư" {
+			t.Errorf("Truncate(%d) = %q, want ngư", max, got)
+		}
+	}
+}
+
+func TestLoadCL100K_Invalid(t *testing.T) {
+	for _, data := range []string{"aGVsbG8=\n", "not-base64 1\n", "aGVsbG8= x\n"} {
+		if _, err := LoadCL100K(strings.NewReader(data)); err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	e := Estimate{CharsPerToken: 4}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"xin chào các bạn", 4}, // a token per syllable
+		{"internationalization", 5},
+		{"a b c", 3},
+	}
+	for _, tt := range tests {
+		if got := e.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+
+	if got, cut := e.Truncate("xin chào các bạn", 2); got != "xin chào " || !cut {
+		t.Errorf("Truncate = %q, %v", got, cut)
+	}
+	if got, _ := e.Truncate("người_người_người", 1); got != "ngườ" {
+		t.Errorf("a single long word should be cut on a rune, got %q", got)
+	}
+	if got, cut := e.Truncate("ok", 5); got != "ok" || cut {
+		t.Errorf("Truncate under the limit = %q, %v", got, cut)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	bpe := toyBPE(t)
+	r := NewDefaultRegistry(bpe, map[string]float64{"claude": 3, "default": 2})
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-4o-mini", "cl100k_base"},
+		{"openai/GPT-4o", "cl100k_base"},
+		{"o3-mini", "cl100k_base"},
+		{"claude-sonnet-4", "estimate:3"},
+		{"gemini-2.0-flash", "estimate:4"},
+		{"llama3.1:8b", "estimate:2"},
+		{"", "estimate:2"},
+	}
+	for _, tt := range tests {
+		if got := r.For(tt.model).Name(); got != tt.want {
+			t.Errorf("For(%q) = %s, want %s", tt.model, got, tt.want)
+		}
+	}
+	if got := r.String(); got != "openai=cl100k_base, claude=estimate:3, gemini=estimate:4, default=estimate:2" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := Default().For("gpt-4o").Name(); got != "estimate:4" {
+		t.Errorf("without a rank file OpenAI models use the estimate, got %s", got)
+	}
+}
+
+func TestParseRatios(t *testing.T) {
+	ratios, err := ParseRatios("claude=3.2, default=4")
+	if err != nil || ratios["claude"] != 3.2 || ratios["default"] != 4 {
+		t.Errorf("got %v, %v", ratios, err)
+	}
+	for _, raw := range []string{"mistral=4", "claude", "claude=0", "claude=x"} {
+		if _, err := ParseRatios(raw); err == nil {
+			t.Errorf("%q: expected an error", raw)
+		}
+	}
+}
+
+func TestLimit_MatchesTruncate(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; sb.Len() < 5000; i++ {
+		fmt.Fprintf(&sb, "hello world người %d. ", i)
+	}
+	text := sb.String()
+
+	for _, tk := range []Tokenizer{toyBPE(t), Estimate{CharsPerToken: 4}} {
+		max := tk.Count(text) * 3 / 4
+		l := NewLimit(tk, max)
+		var out strings.Builder
+		cut := false
+		for i := 0; i < len(text) && !cut; {
+			end := min(i+7, len(text))
+			for end < len(text) && !utf8.RuneStart(text[end]) {
+				end++
+			}
+			var kept string
+			kept, cut = l.Add(text[i:end])
+			out.WriteString(kept)
+			i = end
+		}
+		if !cut {
+			t.Fatalf("%s: the stream should be cut", tk.Name())
+		}
+		want, _ := tk.Truncate(text, max)
+		if _, exact := tk.(*BPE); exact && out.String() != want {
+			t.Errorf("%s: streamed %d bytes, Truncate keeps %d", tk.Name(), out.Len(), len(want))
+		}
+		if !strings.HasPrefix(text, out.String()) || len(want)-out.Len() > 64 {
+			t.Errorf("%s: streamed %d bytes, Truncate keeps %d", tk.Name(), out.Len(), len(want))
+		}
+	}
+}
+
+func BenchmarkBPE_Count(b *testing.B) {
+	bpe := toyBPE(b)
+	text := strings.Repeat("The hello world of người Việt, 12345 lines of code. ", 80)
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+		bpe.Count(text)
+	}
+}
+
+func BenchmarkEstimate_Count(b *testing.B) {
+	e := Estimate{CharsPerToken: 4}
+	text := strings.Repeat("The hello world of người Việt, 12345 lines of code. ", 80)
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+		e.Count(text)
+	}
+}
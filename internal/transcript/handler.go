@@ -0,0 +1,78 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SessionHandler serves GET /admin/transcripts/{session}
+func (r *Recorder) SessionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		session := req.PathValue("session")
+		recs, err := r.Session(req.Context(), session)
+		if err != nil {
+			http.Error(w, `{"error":"transcripts_unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		if len(recs) == 0 {
+			http.Error(w, `{"error":"not_found","message":"no transcript for session"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SessionTranscript{SessionID: session, Records: recs})
+	}
+}
+
+// SessionTranscript is the JSON body of GET /admin/transcripts/{session}
+type SessionTranscript struct {
+	SessionID string   `json:"session_id"`
+	Records   []Record `json:"records"`
+}
+
+// ExportHandler serves GET /admin/transcripts as JSONL, one record per line.
+//
+// Query parameters:
+//
+//	since   RFC 3339 timestamp, YYYY-MM-DD date, or a duration such as 24h
+//	        meaning that long ago (default: everything retained)
+func (r *Recorder) ExportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var since time.Time
+		if s := req.URL.Query().Get("since"); s != "" {
+			t, err := ParseSince(s, r.now())
+			if err != nil {
+				http.Error(w, fmt.Sprintf(`{"error":"invalid_request","message":%q}`, err.Error()), http.StatusBadRequest)
+				return
+			}
+			since = t
+		}
+
+		recs, err := r.Since(req.Context(), since)
+		if err != nil {
+			http.Error(w, `{"error":"transcripts_unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, rec := range recs {
+			enc.Encode(rec)
+		}
+	}
+}
+
+// ParseSince accepts an RFC 3339 timestamp, a YYYY-MM-DD date, or a
+// duration relative to now
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q: want RFC 3339, YYYY-MM-DD or a duration", s)
+}
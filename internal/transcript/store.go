@@ -0,0 +1,278 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store persists transcript records
+type Store interface {
+	Append(ctx context.Context, rec Record) error
+	Session(ctx context.Context, sessionID string) ([]Record, error)
+	Since(ctx context.Context, t time.Time) ([]Record, error)
+	// Sweep removes records completed before t and reports how many
+	Sweep(ctx context.Context, before time.Time) (int, error)
+}
+
+// FileStore keeps one JSONL file per session in a directory
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileStore creates the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("transcript dir: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// path maps a session ID to a file name that is safe for any ID
+func (s *FileStore) path(sessionID string) string {
+	return filepath.Join(s.dir, base64.RawURLEncoding.EncodeToString([]byte(sessionID))+".jsonl")
+}
+
+func (s *FileStore) Append(_ context.Context, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path(rec.SessionID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FileStore) Session(_ context.Context, sessionID string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recs, err := readFile(s.path(sessionID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return recs, err
+}
+
+func (s *FileStore) Since(_ context.Context, t time.Time) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	for _, f := range files {
+		recs, err := readFile(f)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range recs {
+			if !rec.CompletedAt.Before(t) {
+				out = append(out, rec)
+			}
+		}
+	}
+	sortRecords(out)
+	return out, nil
+}
+
+func (s *FileStore) Sweep(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.jsonl"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, f := range files {
+		recs, err := readFile(f)
+		if err != nil {
+			return removed, err
+		}
+		var keep bytes.Buffer
+		kept := 0
+		for _, rec := range recs {
+			if rec.CompletedAt.Before(before) {
+				removed++
+				continue
+			}
+			data, _ := json.Marshal(rec)
+			keep.Write(append(data, '\n'))
+			kept++
+		}
+		switch {
+		case kept == len(recs):
+		case kept == 0:
+			if err := os.Remove(f); err != nil {
+				return removed, err
+			}
+		default:
+			if err := os.WriteFile(f, keep.Bytes(), 0o640); err != nil {
+				return removed, err
+			}
+		}
+	}
+	return removed, nil
+}
+
+func readFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recs []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 2*maxCapture)
+	for sc.Scan() {
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			continue // skip a torn line rather than losing the file
+		}
+		recs = append(recs, rec)
+	}
+	return recs, sc.Err()
+}
+
+// RedisStore keeps one stream per session (transcripts:<session>) and an
+// index of sessions scored by their last record time
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+const (
+	redisStreamPrefix = "transcripts:"
+	redisIndexKey     = "transcripts:index"
+)
+
+// NewRedisStore creates a Redis-backed store
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Append(ctx context.Context, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	pipe := s.client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: redisStreamPrefix + rec.SessionID,
+		Values: map[string]any{"record": data},
+	})
+	pipe.ZAdd(ctx, redisIndexKey, redis.Z{Score: float64(rec.CompletedAt.UnixMilli()), Member: rec.SessionID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) Session(ctx context.Context, sessionID string) ([]Record, error) {
+	msgs, err := s.client.XRange(ctx, redisStreamPrefix+sessionID, "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	var recs []Record
+	for _, m := range msgs {
+		if rec, ok := decodeMessage(m); ok {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, nil
+}
+
+func (s *RedisStore) Since(ctx context.Context, t time.Time) ([]Record, error) {
+	// Only sessions whose last record is recent enough can match
+	sessions, err := s.client.ZRangeByScore(ctx, redisIndexKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(t.UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	for _, sess := range sessions {
+		recs, err := s.Session(ctx, sess)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range recs {
+			if !rec.CompletedAt.Before(t) {
+				out = append(out, rec)
+			}
+		}
+	}
+	sortRecords(out)
+	return out, nil
+}
+
+func (s *RedisStore) Sweep(ctx context.Context, before time.Time) (int, error) {
+	// A recent session can still hold old records, so check every one
+	sessions, err := s.client.ZRange(ctx, redisIndexKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, sess := range sessions {
+		key := redisStreamPrefix + sess
+		msgs, err := s.client.XRange(ctx, key, "-", "+").Result()
+		if err != nil {
+			return removed, err
+		}
+		var old []string
+		for _, m := range msgs {
+			if rec, ok := decodeMessage(m); !ok || rec.CompletedAt.Before(before) {
+				old = append(old, m.ID)
+			}
+		}
+		if len(old) == 0 {
+			continue
+		}
+		if len(old) == len(msgs) {
+			if err := s.client.Del(ctx, key).Err(); err != nil {
+				return removed, err
+			}
+			s.client.ZRem(ctx, redisIndexKey, sess)
+		} else if err := s.client.XDel(ctx, key, old...).Err(); err != nil {
+			return removed, err
+		}
+		removed += len(old)
+	}
+	return removed, nil
+}
+
+func decodeMessage(m redis.XMessage) (Record, bool) {
+	raw, _ := m.Values["record"].(string)
+	var rec Record
+	if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+		return rec, false
+	}
+	return rec, true
+}
+
+func sortRecords(recs []Record) {
+	sort.SliceStable(recs, func(i, j int) bool {
+		if !recs[i].CompletedAt.Equal(recs[j].CompletedAt) {
+			return recs[i].CompletedAt.Before(recs[j].CompletedAt)
+		}
+		return strings.Compare(recs[i].SessionID, recs[j].SessionID) < 0
+	})
+}
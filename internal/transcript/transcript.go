@@ -0,0 +1,381 @@
+// Package transcript records anonymized request/response pairs for sessions
+// that opt in, to build eval and fine-tuning datasets from real traffic.
+//
+// Only what crosses the wire to the provider is kept: the anonymized request
+// and the tokenized response before rehydration. Vault originals are never
+// read or written here.
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderRecord opts a request into recording. Only admin Veil keys may set it.
+const HeaderRecord = "X-Veil-Record-Transcript"
+
+// maxCapture bounds the response bytes kept per request
+const maxCapture = 10 << 20
+
+// Config selects where transcripts are kept and for how long
+type Config struct {
+	// Output is a directory for JSONL files, or "redis" for one Redis
+	// stream per session
+	Output string
+	// MaxAge is the retention; older records are swept (0 keeps forever)
+	MaxAge time.Duration
+}
+
+// DefaultConfig keeps transcripts for 30 days
+func DefaultConfig() Config {
+	return Config{MaxAge: 30 * 24 * time.Hour}
+}
+
+// Usage is the token usage reported by the provider
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Record is one request/response exchange
+type Record struct {
+	SessionID   string          `json:"session_id"`
+	KeyID       string          `json:"key_id,omitempty"`
+	Provider    string          `json:"provider,omitempty"`
+	Model       string          `json:"model,omitempty"`
+	Path        string          `json:"path"`
+	Status      int             `json:"status"`
+	StartedAt   time.Time       `json:"started_at"`
+	CompletedAt time.Time       `json:"completed_at"`
+	Request     json.RawMessage `json:"request"`  // anonymized messages as sent upstream
+	Response    string          `json:"response"` // tokenized content, before rehydration
+	Usage       *Usage          `json:"usage,omitempty"`
+}
+
+// Recorder captures flagged exchanges into a Store
+type Recorder struct {
+	store  Store
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// New creates a Recorder. Records older than maxAge are removed by Sweep
+// (0 keeps them forever).
+func New(store Store, maxAge time.Duration) *Recorder {
+	return &Recorder{store: store, maxAge: maxAge, now: time.Now}
+}
+
+// pending collects what the proxy learned about a flagged request
+type pending struct {
+	mu          sync.Mutex
+	sessionID   string
+	provider    string
+	request     []byte
+	status      int
+	contentType string
+	response    bytes.Buffer
+}
+
+type pendingKey struct{}
+
+func from(ctx context.Context) *pending {
+	p, _ := ctx.Value(pendingKey{}).(*pending)
+	return p
+}
+
+// SetRequest records the anonymized request body as forwarded upstream
+func SetRequest(ctx context.Context, sessionID string, anonymized string) {
+	if p := from(ctx); p != nil {
+		p.mu.Lock()
+		p.sessionID = sessionID
+		p.request = []byte(anonymized)
+		p.mu.Unlock()
+	}
+}
+
+// SetProvider records the upstream provider
+func SetProvider(ctx context.Context, name string) {
+	if p := from(ctx); p != nil {
+		p.mu.Lock()
+		p.provider = name
+		p.mu.Unlock()
+	}
+}
+
+// CaptureResponse tees the upstream response body as it is read. Call it
+// before rehydration so only tokens are captured. A later response (e.g. a
+// fallback provider) replaces an earlier one.
+func CaptureResponse(resp *http.Response) {
+	if resp == nil || resp.Request == nil {
+		return
+	}
+	p := from(resp.Request.Context())
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.status = resp.StatusCode
+	p.contentType = resp.Header.Get("Content-Type")
+	p.response.Reset()
+	p.mu.Unlock()
+	resp.Body = &teeBody{ReadCloser: resp.Body, p: p}
+}
+
+type teeBody struct {
+	io.ReadCloser
+	p *pending
+}
+
+func (t *teeBody) Read(b []byte) (int, error) {
+	n, err := t.ReadCloser.Read(b)
+	if n > 0 {
+		t.p.mu.Lock()
+		if room := maxCapture - t.p.response.Len(); room > 0 {
+			t.p.response.Write(b[:min(n, room)])
+		}
+		t.p.mu.Unlock()
+	}
+	return n, err
+}
+
+// Middleware records requests carrying X-Veil-Record-Transcript: true. It
+// must run after auth: only requests authenticated with an admin Veil key
+// may be recorded, others setting the header are rejected.
+func (r *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		flag := req.Header.Get(HeaderRecord)
+		req.Header.Del(HeaderRecord)
+		if !strings.EqualFold(flag, "true") {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if req.Header.Get("X-Veil-Key-ID") == "" || req.Header.Get("X-User-Role") != "admin" {
+			http.Error(w, `{"error":"forbidden","message":"transcript recording requires an admin Veil key"}`, http.StatusForbidden)
+			return
+		}
+
+		p := &pending{}
+		started := r.now()
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), pendingKey{}, p)))
+		r.finish(req, p, started)
+	})
+}
+
+func (r *Recorder) finish(req *http.Request, p *pending, started time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.request == nil {
+		return // never forwarded upstream
+	}
+
+	rec := Record{
+		SessionID:   p.sessionID,
+		KeyID:       req.Header.Get("X-Veil-Key-ID"),
+		Provider:    p.provider,
+		Path:        req.URL.Path,
+		Status:      p.status,
+		StartedAt:   started.UTC(),
+		CompletedAt: r.now().UTC(),
+	}
+	rec.Model, rec.Request = parseRequest(p.request)
+	content, model, usage := parseResponse(p.contentType, p.response.Bytes())
+	rec.Response = content
+	rec.Usage = usage
+	if rec.Model == "" {
+		rec.Model = model
+	}
+
+	// Not the request context: the client may already have gone away
+	if err := r.store.Append(context.Background(), rec); err != nil {
+		slog.Error("transcript append failed", "session", rec.SessionID, "error", err)
+	}
+}
+
+// Session returns the records of one session, oldest first
+func (r *Recorder) Session(ctx context.Context, sessionID string) ([]Record, error) {
+	return r.store.Session(ctx, sessionID)
+}
+
+// Since returns every record completed at or after t
+func (r *Recorder) Since(ctx context.Context, t time.Time) ([]Record, error) {
+	return r.store.Since(ctx, t)
+}
+
+// Sweep deletes records older than the configured max age
+func (r *Recorder) Sweep(ctx context.Context) (int, error) {
+	if r.maxAge <= 0 {
+		return 0, nil
+	}
+	return r.store.Sweep(ctx, r.now().Add(-r.maxAge))
+}
+
+// StartSweeper runs Sweep every interval until ctx is cancelled
+func (r *Recorder) StartSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := r.Sweep(ctx); err != nil {
+					slog.Warn("transcript sweep failed", "error", err)
+				} else if n > 0 {
+					slog.Info("transcript sweep", "removed", n)
+				}
+			}
+		}
+	}()
+}
+
+// parseRequest extracts the model and the message list from an anonymized
+// body. Non-JSON bodies are kept as a JSON string.
+func parseRequest(body []byte) (string, json.RawMessage) {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		raw, _ := json.Marshal(string(body))
+		return "", raw
+	}
+	var model string
+	json.Unmarshal(req["model"], &model)
+	// OpenAI/Anthropic messages, Gemini contents, Responses API input
+	for _, k := range []string{"messages", "contents", "input", "prompt"} {
+		if v, ok := req[k]; ok {
+			return model, v
+		}
+	}
+	return model, json.RawMessage(body)
+}
+
+// parseResponse pulls the generated text, model and usage out of an OpenAI,
+// Anthropic or Gemini response, plain JSON or SSE
+func parseResponse(contentType string, body []byte) (string, string, *Usage) {
+	var (
+		text  strings.Builder
+		model string
+		usage Usage
+	)
+	handle := func(data []byte) {
+		var chunk map[string]any
+		if json.Unmarshal(data, &chunk) != nil {
+			return
+		}
+		if m := extractChunk(chunk, &text, &usage); m != "" && model == "" {
+			model = m
+		}
+	}
+
+	if strings.Contains(contentType, "text/event-stream") {
+		for _, line := range strings.Split(string(body), "\n") {
+			line = strings.TrimSpace(line)
+			if data, ok := strings.CutPrefix(line, "data:"); ok {
+				handle([]byte(strings.TrimSpace(data)))
+			}
+		}
+	} else {
+		handle(body)
+		if text.Len() == 0 && model == "" && !json.Valid(body) {
+			text.Write(body)
+		}
+	}
+
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if usage.TotalTokens == 0 {
+		return text.String(), model, nil
+	}
+	return text.String(), model, &usage
+}
+
+func extractChunk(m map[string]any, text *strings.Builder, usage *Usage) string {
+	model, _ := m["model"].(string)
+
+	// OpenAI: choices[].message.content / choices[].delta.content / choices[].text
+	for _, c := range list(m["choices"]) {
+		choice, _ := c.(map[string]any)
+		for _, k := range []string{"message", "delta"} {
+			if msg, ok := choice[k].(map[string]any); ok {
+				if s, ok := msg["content"].(string); ok {
+					text.WriteString(s)
+				}
+			}
+		}
+		if s, ok := choice["text"].(string); ok {
+			text.WriteString(s)
+		}
+	}
+
+	// Anthropic: content[].text, content_block_delta, message_start
+	for _, c := range list(m["content"]) {
+		if block, ok := c.(map[string]any); ok {
+			if s, ok := block["text"].(string); ok {
+				text.WriteString(s)
+			}
+		}
+	}
+	if delta, ok := m["delta"].(map[string]any); ok {
+		if s, ok := delta["text"].(string); ok {
+			text.WriteString(s)
+		}
+	}
+	if msg, ok := m["message"].(map[string]any); ok {
+		if s, ok := msg["model"].(string); ok && model == "" {
+			model = s
+		}
+		mergeUsage(usage, msg["usage"])
+	}
+
+	// Gemini: candidates[].content.parts[].text
+	for _, c := range list(m["candidates"]) {
+		cand, _ := c.(map[string]any)
+		content, _ := cand["content"].(map[string]any)
+		for _, p := range list(content["parts"]) {
+			if part, ok := p.(map[string]any); ok {
+				if s, ok := part["text"].(string); ok {
+					text.WriteString(s)
+				}
+			}
+		}
+	}
+	if s, ok := m["modelVersion"].(string); ok && model == "" {
+		model = s
+	}
+
+	mergeUsage(usage, m["usage"])
+	mergeUsage(usage, m["usageMetadata"])
+	return model
+}
+
+// mergeUsage keeps the largest count seen for each field, since streams
+// report usage incrementally or only in the final chunk
+func mergeUsage(u *Usage, v any) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	set := func(dst *int, keys ...string) {
+		for _, k := range keys {
+			if f, ok := m[k].(float64); ok && int(f) > *dst {
+				*dst = int(f)
+			}
+		}
+	}
+	set(&u.PromptTokens, "prompt_tokens", "input_tokens", "promptTokenCount")
+	set(&u.CompletionTokens, "completion_tokens", "output_tokens", "candidatesTokenCount")
+	set(&u.TotalTokens, "total_tokens", "totalTokenCount")
+}
+
+func list(v any) []any {
+	l, _ := v.([]any)
+	return l
+}
@@ -0,0 +1,245 @@
+package transcript
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newStores(t *testing.T) map[string]Store {
+	t.Helper()
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := miniredis.RunT(t)
+	return map[string]Store{
+		"file":  fs,
+		"redis": NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+}
+
+func TestStore_AppendSinceSweep(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	for name, store := range newStores(t) {
+		recs := []Record{
+			{SessionID: "a", CompletedAt: base.Add(-48 * time.Hour), Response: "old"},
+			{SessionID: "a", CompletedAt: base, Response: "new"},
+			{SessionID: "b/../x", CompletedAt: base.Add(time.Minute), Response: "other"},
+		}
+		for _, rec := range recs {
+			if err := store.Append(ctx, rec); err != nil {
+				t.Fatalf("%s: append: %v", name, err)
+			}
+		}
+
+		got, err := store.Session(ctx, "a")
+		if err != nil || len(got) != 2 || got[0].Response != "old" {
+			t.Errorf("%s: Session = %+v, %v", name, got, err)
+		}
+		if got, _ := store.Session(ctx, "missing"); len(got) != 0 {
+			t.Errorf("%s: missing session = %+v", name, got)
+		}
+
+		since, err := store.Since(ctx, base.Add(-time.Hour))
+		if err != nil || len(since) != 2 || since[0].Response != "new" || since[1].SessionID != "b/../x" {
+			t.Errorf("%s: Since = %+v, %v", name, since, err)
+		}
+
+		n, err := store.Sweep(ctx, base.Add(-24*time.Hour))
+		if err != nil || n != 1 {
+			t.Errorf("%s: Sweep = %d, %v", name, n, err)
+		}
+		if got, _ := store.Session(ctx, "a"); len(got) != 1 || got[0].Response != "new" {
+			t.Errorf("%s: after sweep = %+v", name, got)
+		}
+
+		n, _ = store.Sweep(ctx, base.Add(time.Hour))
+		if all, _ := store.Since(ctx, time.Time{}); n != 2 || len(all) != 0 {
+			t.Errorf("%s: full sweep removed %d, left %+v", name, n, all)
+		}
+	}
+}
+
+func TestRecorder_SweepHonorsMaxAge(t *testing.T) {
+	fs, _ := NewFileStore(t.TempDir())
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	fs.Append(ctx, Record{SessionID: "s", CompletedAt: now.Add(-31 * 24 * time.Hour)})
+	fs.Append(ctx, Record{SessionID: "s", CompletedAt: now.Add(-29 * 24 * time.Hour)})
+
+	keep := New(fs, 0)
+	if n, _ := keep.Sweep(ctx); n != 0 {
+		t.Errorf("max age 0 should keep everything, removed %d", n)
+	}
+
+	r := New(fs, DefaultConfig().MaxAge)
+	r.now = func() time.Time { return now }
+	if n, err := r.Sweep(ctx); err != nil || n != 1 {
+		t.Errorf("Sweep = %d, %v", n, err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	fs, _ := NewFileStore(t.TempDir())
+	r := New(fs, 0)
+
+	var sawHeader bool
+	h := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sawHeader = req.Header.Get(HeaderRecord) != ""
+		SetProvider(req.Context(), "openai")
+		SetRequest(req.Context(), "sess", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi [EMAIL_1]"}]}`)
+
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"choices":[{"message":{"content":"hello [EMAIL_1]"}}]}`)),
+			Request:    req,
+		}
+		CaptureResponse(resp)
+		io.Copy(w, resp.Body)
+	}))
+
+	tests := []struct {
+		name, flag, keyID, role string
+		want                    int
+		recorded                bool
+	}{
+		{"not flagged", "", "k1", "admin", http.StatusOK, false},
+		{"flagged without key", "true", "", "admin", http.StatusForbidden, false},
+		{"flagged by viewer", "true", "k1", "viewer", http.StatusForbidden, false},
+		{"flagged by admin", "true", "k1", "admin", http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if tt.flag != "" {
+			req.Header.Set(HeaderRecord, tt.flag)
+		}
+		if tt.keyID != "" {
+			req.Header.Set("X-Veil-Key-ID", tt.keyID)
+		}
+		req.Header.Set("X-User-Role", tt.role)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if sawHeader {
+			t.Errorf("%s: header should be stripped before forwarding", tt.name)
+		}
+		recs, _ := fs.Session(context.Background(), "sess")
+		if got := len(recs) == 1; got != tt.recorded {
+			t.Errorf("%s: recorded = %v, want %v", tt.name, got, tt.recorded)
+		}
+	}
+
+	recs, _ := fs.Session(context.Background(), "sess")
+	rec := recs[0]
+	if rec.KeyID != "k1" || rec.Provider != "openai" || rec.Model != "gpt-4o" || rec.Status != http.StatusOK {
+		t.Errorf("record metadata = %+v", rec)
+	}
+	if rec.Response != "hello [EMAIL_1]" || !strings.Contains(string(rec.Request), `"role":"user"`) {
+		t.Errorf("record content = %+v", rec)
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name, contentType, body string
+		text, model             string
+		total                   int
+	}{
+		{
+			"openai json", "application/json",
+			`{"model":"gpt-4o","choices":[{"message":{"content":"hi [PHONE_1]"}}],"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`,
+			"hi [PHONE_1]", "gpt-4o", 8,
+		},
+		{
+			"openai sse", "text/event-stream",
+			"data: {\"model\":\"gpt-4o\",\"choices\":[{\"delta\":{\"content\":\"hi \"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"[EMAIL_1]\"}}],\"usage\":{\"prompt_tokens\":4,\"completion_tokens\":2}}\n\ndata: [DONE]\n\n",
+			"hi [EMAIL_1]", "gpt-4o", 6,
+		},
+		{
+			"anthropic json", "application/json",
+			`{"model":"claude-sonnet-4","content":[{"type":"text","text":"ok [CCCD_1]"}],"usage":{"input_tokens":10,"output_tokens":4}}`,
+			"ok [CCCD_1]", "claude-sonnet-4", 14,
+		},
+		{
+			"anthropic sse", "text/event-stream",
+			"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"model\":\"claude-sonnet-4\",\"usage\":{\"input_tokens\":9}}}\n\nevent: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"xin chào\"}}\n\nevent: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":3}}\n\n",
+			"xin chào", "claude-sonnet-4", 12,
+		},
+		{
+			"gemini json", "application/json",
+			`{"candidates":[{"content":{"parts":[{"text":"a"},{"text":"b"}]}}],"usageMetadata":{"promptTokenCount":2,"candidatesTokenCount":1,"totalTokenCount":3},"modelVersion":"gemini-2.0-flash"}`,
+			"ab", "gemini-2.0-flash", 3,
+		},
+		{"plain text", "text/plain", "not json", "not json", "", 0},
+	}
+	for _, tt := range tests {
+		text, model, usage := parseResponse(tt.contentType, []byte(tt.body))
+		if text != tt.text || model != tt.model {
+			t.Errorf("%s: got %q / %q", tt.name, text, model)
+		}
+		total := 0
+		if usage != nil {
+			total = usage.TotalTokens
+		}
+		if total != tt.total {
+			t.Errorf("%s: total tokens = %d, want %d", tt.name, total, tt.total)
+		}
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	fs, _ := NewFileStore(t.TempDir())
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := New(fs, 0)
+	r.now = func() time.Time { return now }
+	fs.Append(context.Background(), Record{SessionID: "s1", CompletedAt: now.Add(-2 * time.Hour)})
+	fs.Append(context.Background(), Record{SessionID: "s2", CompletedAt: now.Add(-30 * time.Minute)})
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/transcripts", r.ExportHandler())
+	mux.Handle("GET /admin/transcripts/{session}", r.SessionHandler())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/admin/transcripts/s1")
+	var body struct {
+		SessionID string   `json:"session_id"`
+		Records   []Record `json:"records"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusOK || body.SessionID != "s1" || len(body.Records) != 1 {
+		t.Errorf("session: %d %s", w.Code, w.Body.String())
+	}
+	if w := get("/admin/transcripts/nope"); w.Code != http.StatusNotFound {
+		t.Errorf("missing session: status = %d", w.Code)
+	}
+
+	for query, want := range map[string]int{"": 2, "?since=1h": 1, "?since=2026-03-01": 2, "?since=2026-03-01T11:45:00Z": 1} {
+		w := get("/admin/transcripts" + query)
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		if w.Code != http.StatusOK || len(lines) != want || w.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("export %q: %d, %d lines", query, w.Code, len(lines))
+		}
+	}
+	if w := get("/admin/transcripts?since=yesterday"); w.Code != http.StatusBadRequest {
+		t.Errorf("bad since: status = %d", w.Code)
+	}
+}
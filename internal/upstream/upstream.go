@@ -0,0 +1,241 @@
+// Package upstream builds the HTTP transports used to reach LLM providers:
+// a pooled http.Transport with header and overall timeouts, and an opt-in
+// single retry for requests that failed before any response arrived.
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Defaults for Config fields left at zero
+const (
+	DefaultResponseHeaderTimeout = 2 * time.Minute
+	DefaultMaxIdleConnsPerHost   = 32
+	DefaultRetryMaxBody          = 1 << 20 // 1MB
+)
+
+// Config controls an upstream transport
+type Config struct {
+	// Timeout bounds the whole exchange including the response body, so it
+	// also ends long streams. Zero means no limit.
+	Timeout time.Duration
+	// ResponseHeaderTimeout is how long to wait for response headers after
+	// the request was written. Non-streaming completions only send headers
+	// once generation is done, so keep it above the slowest expected reply.
+	ResponseHeaderTimeout time.Duration
+	// MaxIdleConnsPerHost is the keep-alive pool size per provider host
+	MaxIdleConnsPerHost int
+	// Retry resends a request once when the connection was reset or closed
+	// before a response arrived. Only idempotent requests and requests whose
+	// body is at most RetryMaxBody bytes are retried.
+	Retry        bool
+	RetryMaxBody int64
+	// UserAgent is appended to the client's User-Agent, e.g.
+	// "openai-python/1.30.0 AgentVeil/1.4.0", so providers can tell
+	// proxied traffic apart. Empty leaves the header as the client sent it.
+	UserAgent string
+}
+
+// DefaultConfig returns the defaults: 2m header timeout, 32 idle connections
+// per host, no overall timeout and no retry
+func DefaultConfig() Config {
+	return Config{
+		ResponseHeaderTimeout: DefaultResponseHeaderTimeout,
+		MaxIdleConnsPerHost:   DefaultMaxIdleConnsPerHost,
+		RetryMaxBody:          DefaultRetryMaxBody,
+	}
+}
+
+// withDefaults fills zero fields from DefaultConfig
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+	if c.ResponseHeaderTimeout == 0 {
+		c.ResponseHeaderTimeout = d.ResponseHeaderTimeout
+	}
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = d.MaxIdleConnsPerHost
+	}
+	if c.RetryMaxBody == 0 {
+		c.RetryMaxBody = d.RetryMaxBody
+	}
+	return c
+}
+
+// String summarizes the effective settings for the startup log
+func (c Config) String() string {
+	c = c.withDefaults()
+	timeout := "none"
+	if c.Timeout > 0 {
+		timeout = c.Timeout.String()
+	}
+	s := fmt.Sprintf("timeout %s, header timeout %s, %d idle conns/host, retry %t",
+		timeout, c.ResponseHeaderTimeout, c.MaxIdleConnsPerHost, c.Retry)
+	if c.UserAgent != "" {
+		s += ", user agent " + c.UserAgent
+	}
+	return s
+}
+
+// NewTransport returns a dedicated transport for one upstream
+func NewTransport(cfg Config) http.RoundTripper {
+	cfg = cfg.withDefaults()
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	base.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	if base.MaxIdleConns < cfg.MaxIdleConnsPerHost {
+		base.MaxIdleConns = cfg.MaxIdleConnsPerHost
+	}
+
+	var rt http.RoundTripper = base
+	if cfg.UserAgent != "" {
+		rt = WithUserAgent(rt, cfg.UserAgent)
+	}
+	if cfg.Retry {
+		rt = &retryTransport{next: rt, maxBody: cfg.RetryMaxBody}
+	}
+	if cfg.Timeout > 0 {
+		rt = &timeoutTransport{next: rt, timeout: cfg.Timeout}
+	}
+	return rt
+}
+
+// IsTimeout reports whether err is an upstream timeout (header timeout,
+// overall deadline or dial timeout) rather than a connection failure
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// StatusClientClosed is the status recorded for a request whose client went
+// away before the response, as nginx logs it
+const StatusClientClosed = 499
+
+// ClientGone reports whether the client of req disconnected or gave up, so
+// a failed upstream call is no fault of the provider's
+func ClientGone(req *http.Request) bool {
+	return req.Context().Err() != nil
+}
+
+// timeoutTransport applies the overall deadline and releases it when the
+// response body is closed
+type timeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// WithUserAgent wraps next to append product to the User-Agent of every
+// request, for transports not built by NewTransport
+func WithUserAgent(next http.RoundTripper, product string) http.RoundTripper {
+	return &userAgentTransport{next: next, product: product}
+}
+
+// userAgentTransport appends product to the User-Agent header
+type userAgentTransport struct {
+	next    http.RoundTripper
+	product string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ua := t.product
+	if client := req.Header.Get("User-Agent"); client != "" {
+		ua = client + " " + t.product
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", ua)
+	return t.next.RoundTrip(req)
+}
+
+// retryTransport resends a request once after a connection reset or EOF
+type retryTransport struct {
+	next    http.RoundTripper
+	maxBody int64
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.replayable(req) {
+		return t.next.RoundTrip(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil || !retryable(err) || req.Context().Err() != nil {
+		return resp, err
+	}
+	if req.GetBody != nil {
+		body, gerr := req.GetBody()
+		if gerr != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	return t.next.RoundTrip(req)
+}
+
+// replayable reports whether req may be sent twice: an idempotent method, an
+// Idempotency-Key, or a body of known size small enough to buffer
+func (t *retryTransport) replayable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if req.Header.Get("Idempotency-Key") != "" {
+		return true
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	return req.ContentLength >= 0 && req.ContentLength <= t.maxBody
+}
+
+// retryable matches failures where the upstream never produced a response
+func retryable(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,203 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dropFirst closes the first connection without a response, as a provider
+// load balancer does when it recycles an idle keep-alive connection
+func dropFirst(t *testing.T, calls *int32, bodies chan<- string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(calls, 1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		if bodies != nil {
+			bodies <- string(body)
+		}
+		w.Write([]byte("ok"))
+	}))
+}
+
+func TestRetry_ReplaysBufferedBody(t *testing.T) {
+	var calls int32
+	bodies := make(chan string, 1)
+	srv := dropFirst(t, &calls, bodies)
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(Config{Retry: true})}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"model":"x"}`))
+	req.GetBody = nil // force the transport to buffer
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	resp.Body.Close()
+
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+	if got := <-bodies; got != `{"model":"x"}` {
+		t.Errorf("retried body = %q", got)
+	}
+}
+
+func TestRetry_Disabled(t *testing.T) {
+	var calls int32
+	srv := dropFirst(t, &calls, nil)
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(Config{})}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("x"))
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("expected error without retry")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", calls)
+	}
+}
+
+func TestRetry_BodyOverCap(t *testing.T) {
+	var calls int32
+	srv := dropFirst(t, &calls, nil)
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(Config{Retry: true, RetryMaxBody: 4})}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("too large"))
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("expected error for body above the retry cap")
+	}
+	if calls != 1 {
+		t.Errorf("body above the cap should not be retried, got %d attempts", calls)
+	}
+}
+
+func TestReplayable(t *testing.T) {
+	rt := &retryTransport{maxBody: 8}
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		key    string
+		length int64
+		want   bool
+	}{
+		{"get", http.MethodGet, "", "", 0, true},
+		{"small post", http.MethodPost, "abc", "", 3, true},
+		{"large post", http.MethodPost, "0123456789", "", 10, false},
+		{"unknown length", http.MethodPost, "abc", "", -1, false},
+		{"idempotency key", http.MethodPost, "0123456789", "k1", -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req := httptest.NewRequest(tt.method, "/", body)
+			req.ContentLength = tt.length
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+			if got := rt.replayable(req); got != tt.want {
+				t.Errorf("replayable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	stall := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stall:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(stall)
+
+	for name, cfg := range map[string]Config{
+		"header":  {ResponseHeaderTimeout: 50 * time.Millisecond},
+		"overall": {Timeout: 50 * time.Millisecond},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &http.Client{Transport: NewTransport(cfg)}
+			start := time.Now()
+			_, err := client.Get(srv.URL)
+			if err == nil {
+				t.Fatal("expected timeout")
+			}
+			if !IsTimeout(err) {
+				t.Errorf("IsTimeout(%v) = false", err)
+			}
+			if time.Since(start) > 2*time.Second {
+				t.Errorf("timeout took %v", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	if !IsTimeout(context.DeadlineExceeded) {
+		t.Error("DeadlineExceeded should be a timeout")
+	}
+	if IsTimeout(errors.New("connection refused")) {
+		t.Error("plain error should not be a timeout")
+	}
+}
+
+func TestConfigString(t *testing.T) {
+	got := Config{Retry: true}.String()
+	want := "timeout none, header timeout 2m0s, 32 idle conns/host, retry true"
+	if got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	agents := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.Header.Get("User-Agent")
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name, product, client, want string
+	}{
+		{"appended", "AgentVeil/1.4.0", "openai-python/1.30.0", "openai-python/1.30.0 AgentVeil/1.4.0"},
+		{"no client agent", "AgentVeil/1.4.0", "", "AgentVeil/1.4.0"},
+		{"off", "", "openai-python/1.30.0", "openai-python/1.30.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: NewTransport(Config{UserAgent: tt.product})}
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			req.Header.Set("User-Agent", tt.client)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got := <-agents; got != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got, tt.want)
+			}
+			if req.Header.Get("User-Agent") != tt.client {
+				t.Error("the caller's request was modified")
+			}
+		})
+	}
+}
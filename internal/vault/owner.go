@@ -0,0 +1,38 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ownerKey holds the identity a session is bound to, beside the session
+// hash like deepKey
+func ownerKey(sessionID string) string {
+	return fmt.Sprintf("pii:owner:%s", sessionID)
+}
+
+type ownerCtxKey struct{}
+
+// WithOwner returns a context under which Store binds new sessions to
+// owner, e.g. "key:<veil key id>"
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerCtxKey{}, owner)
+}
+
+func ownerFrom(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerCtxKey{}).(string)
+	return owner
+}
+
+// Owner returns the identity a session is bound to, "" for a session
+// stored without one or that does not exist
+func (v *Vault) Owner(ctx context.Context, sessionID string) (string, error) {
+	owner, err := v.client.Get(ctx, ownerKey(sessionID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return owner, err
+}
@@ -0,0 +1,114 @@
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyCheckKey holds a known value written with the vault's encryption key,
+// so a proxy started with another key finds out before serving traffic
+const keyCheckKey = "pii:keycheck"
+
+const (
+	keyCheckValue  = "agentveil-vault-keycheck"
+	plaintextCheck = "plaintext"
+)
+
+// ErrKeyMismatch is returned by SelfTest when the vault was written with a
+// different encryption key, or encrypted and now opened without one
+var ErrKeyMismatch = errors.New("vault: encryption key does not match the data in Redis")
+
+// EncryptionStatus is the vault's encryption posture as reported by /health
+type EncryptionStatus struct {
+	Encrypted bool `json:"encrypted"`
+	// PlaintextOverride is set when encryption was explicitly waived for a
+	// Redis on another host (VEIL_ALLOW_PLAINTEXT_VAULT)
+	PlaintextOverride bool `json:"plaintext_override,omitempty"`
+}
+
+// SetPlaintextOverride records that the vault runs unencrypted on a remote
+// Redis by explicit choice
+func (v *Vault) SetPlaintextOverride(on bool) {
+	v.plaintextOverride = on
+}
+
+// EncryptionStatus returns the vault's encryption posture
+func (v *Vault) EncryptionStatus() EncryptionStatus {
+	return EncryptionStatus{Encrypted: v.encryptor != nil, PlaintextOverride: v.plaintextOverride}
+}
+
+// SelfTest checks the vault before traffic arrives: the encryption key must
+// open the key check entry left by earlier runs, and a canary session must
+// survive a store, lookup and delete. After an intentional key rotation,
+// delete the pii:keycheck key; sessions written with the old key become
+// unreadable.
+func (v *Vault) SelfTest(ctx context.Context) error {
+	if err := v.checkKey(ctx); err != nil {
+		return err
+	}
+
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	sessionID := "selftest-" + hex.EncodeToString(nonce)
+	want := "canary-" + hex.EncodeToString(nonce)
+	if err := v.Store(ctx, sessionID, map[string]string{"[SELFTEST_1]": want}); err != nil {
+		return fmt.Errorf("vault self-test: store: %w", err)
+	}
+	got, err := v.LookupAll(ctx, sessionID)
+	delErr := v.Delete(ctx, sessionID)
+	switch {
+	case err != nil:
+		return fmt.Errorf("vault self-test: lookup: %w", err)
+	case got["[SELFTEST_1]"] != want:
+		return fmt.Errorf("vault self-test: canary read back as %q", got["[SELFTEST_1]"])
+	case delErr != nil:
+		return fmt.Errorf("vault self-test: delete: %w", delErr)
+	}
+	return nil
+}
+
+// checkKey compares the key check entry with the current key, writing it
+// on first use. Moving from plaintext to an encryption key is an upgrade
+// and replaces the entry.
+func (v *Vault) checkKey(ctx context.Context) error {
+	stored, err := v.client.Get(ctx, keyCheckKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return v.writeKeyCheck(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("vault self-test: %w", err)
+	}
+
+	switch {
+	case stored == plaintextCheck && v.encryptor == nil:
+		return nil
+	case stored == plaintextCheck:
+		return v.writeKeyCheck(ctx)
+	case v.encryptor == nil:
+		return fmt.Errorf("%w: it was written encrypted but VEIL_ENCRYPTION_KEY is not set", ErrKeyMismatch)
+	}
+	if plain, err := v.encryptor.Decrypt(stored); err != nil || plain != keyCheckValue {
+		return fmt.Errorf("%w: VEIL_ENCRYPTION_KEY differs from the key it was written with "+
+			"(after an intentional rotation, delete the %s key)", ErrKeyMismatch, keyCheckKey)
+	}
+	return nil
+}
+
+func (v *Vault) writeKeyCheck(ctx context.Context) error {
+	val := plaintextCheck
+	if v.encryptor != nil {
+		var err error
+		if val, err = v.encryptor.Encrypt(keyCheckValue); err != nil {
+			return fmt.Errorf("vault self-test: %w", err)
+		}
+	}
+	if err := v.client.Set(ctx, keyCheckKey, val, 0).Err(); err != nil {
+		return fmt.Errorf("vault self-test: %w", err)
+	}
+	return nil
+}
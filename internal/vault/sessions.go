@@ -0,0 +1,168 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// ErrSessionNotFound is returned by SessionInfo for a session with no
+// mappings, including expired ones
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrInvalidCursor is returned by ListSessions for a cursor it did not issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// maxListLimit caps a page of ListSessions
+const maxListLimit = 1000
+
+// SessionSummary describes a session without its values
+type SessionSummary struct {
+	ID      string
+	Entries int64
+	TTL     time.Duration // negative when the session has no expiry
+}
+
+// SessionDetail is a SessionSummary with token counts per category
+type SessionDetail struct {
+	SessionSummary
+	Categories map[string]int
+	Deep       bool // promoted to deep scanning, see PromoteDeep
+}
+
+// ListSessions returns a page of up to about limit sessions starting at
+// cursor ("" for the first page), and the cursor of the next page, "" after
+// the last. It walks the keyspace with SCAN, so a session that exists for
+// the whole listing is returned at least once however the vault changes in
+// between; one created or deleted meanwhile may or may not be. A page can
+// run a little over limit since SCAN batches are returned whole.
+func (v *Vault) ListSessions(ctx context.Context, cursor string, limit int) ([]SessionSummary, string, error) {
+	var pos uint64
+	if cursor != "" {
+		var err error
+		if pos, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+	if limit <= 0 || limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	for {
+		batch, next, err := v.client.Scan(ctx, pos, sessionKey("*"), int64(limit)).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		for _, key := range batch {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		pos = next
+		if pos == 0 || len(keys) >= limit {
+			break
+		}
+	}
+
+	sessions, err := v.summarize(ctx, keys)
+	if err != nil {
+		return nil, "", err
+	}
+	if pos == 0 {
+		return sessions, "", nil
+	}
+	return sessions, strconv.FormatUint(pos, 10), nil
+}
+
+// summarize counts the entries of each session key and reads its TTL,
+// leaving out sessions that expired since the scan
+func (v *Vault) summarize(ctx context.Context, keys []string) ([]SessionSummary, error) {
+	pipe := v.client.Pipeline()
+	lens := make([]*redis.IntCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		lens[i] = pipe.HLen(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	sessions := make([]SessionSummary, 0, len(keys))
+	for i, key := range keys {
+		if lens[i].Val() == 0 {
+			continue
+		}
+		sessions = append(sessions, SessionSummary{
+			ID:      strings.TrimPrefix(key, sessionKey("")),
+			Entries: lens[i].Val(),
+			TTL:     ttls[i].Val(),
+		})
+	}
+	return sessions, nil
+}
+
+// SessionInfo describes one session by its tokens alone; values are never
+// read, so it is the same with or without encryption
+func (v *Vault) SessionInfo(ctx context.Context, sessionID string) (SessionDetail, error) {
+	key := sessionKey(sessionID)
+	pipe := v.client.Pipeline()
+	tokens := pipe.HKeys(ctx, key)
+	ttl := pipe.PTTL(ctx, key)
+	deep := pipe.Exists(ctx, deepKey(sessionID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return SessionDetail{}, err
+	}
+	if len(tokens.Val()) == 0 {
+		return SessionDetail{}, ErrSessionNotFound
+	}
+
+	categories := make(map[string]int)
+	for _, token := range tokens.Val() {
+		categories[tokenCategory(token)]++
+	}
+	return SessionDetail{
+		SessionSummary: SessionSummary{ID: sessionID, Entries: int64(len(tokens.Val())), TTL: ttl.Val()},
+		Categories:     categories,
+		Deep:           deep.Val() > 0,
+	}, nil
+}
+
+// prefixCategory maps token prefixes back to their category
+var prefixCategory = func() map[string]string {
+	m := make(map[string]string, len(pii.TokenPrefix))
+	for cat, prefix := range pii.TokenPrefix {
+		m[prefix] = string(cat)
+	}
+	return m
+}()
+
+// tokenCategory derives the category of a "[PREFIX_N]" token from its
+// prefix. Prefixes of bundle and custom rules are returned as they are;
+// partially masked values, which are not numbered tokens, count as
+// "masked".
+func tokenCategory(token string) string {
+	inner, ok := strings.CutPrefix(token, "[")
+	if ok {
+		inner, ok = strings.CutSuffix(inner, "]")
+	}
+	i := strings.LastIndexByte(inner, '_')
+	if !ok || i <= 0 {
+		return "masked"
+	}
+	if _, err := strconv.Atoi(inner[i+1:]); err != nil {
+		return "masked"
+	}
+	if cat, known := prefixCategory[inner[:i]]; known {
+		return cat
+	}
+	return inner[:i]
+}
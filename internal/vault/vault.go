@@ -8,13 +8,17 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-const defaultTTL = 30 * time.Minute
+// DefaultTTL is how long a session's mappings live after its last store
+// or lookup, unless SetTTL says otherwise
+const DefaultTTL = 30 * time.Minute
 
 // Vault manages temporary PII token-to-original mappings in Redis
 type Vault struct {
-	client    *redis.Client
+	client    redis.UniversalClient
 	ttl       time.Duration
 	encryptor *Encryptor // nil = no encryption
+	// plaintextOverride: unencrypted on a remote Redis by explicit choice
+	plaintextOverride bool
 }
 
 // New creates a Vault connected to the given Redis instance
@@ -26,15 +30,15 @@ func New(addr, password string, db int) *Vault {
 	})
 	return &Vault{
 		client: client,
-		ttl:    defaultTTL,
+		ttl:    DefaultTTL,
 	}
 }
 
 // NewWithClient creates a Vault from an existing Redis client (useful for testing)
-func NewWithClient(client *redis.Client) *Vault {
+func NewWithClient(client redis.UniversalClient) *Vault {
 	return &Vault{
 		client: client,
-		ttl:    defaultTTL,
+		ttl:    DefaultTTL,
 	}
 }
 
@@ -48,7 +52,9 @@ func sessionKey(sessionID string) string {
 	return fmt.Sprintf("pii:session:%s", sessionID)
 }
 
-// Store saves a batch of token->original mappings for a session
+// Store saves a batch of token->original mappings for a session. A new
+// session is bound to the owner carried by ctx (see WithOwner); later
+// stores keep the first owner.
 func (v *Vault) Store(ctx context.Context, sessionID string, mappings map[string]string) error {
 	if len(mappings) == 0 {
 		return nil
@@ -64,24 +70,45 @@ func (v *Vault) Store(ctx context.Context, sessionID string, mappings map[string
 		}
 		pipe.HSet(ctx, key, token, val)
 	}
-	pipe.Expire(ctx, key, v.ttl)
+	if owner := ownerFrom(ctx); owner != "" {
+		pipe.SetNX(ctx, ownerKey(sessionID), owner, v.ttl)
+	}
+	v.touch(ctx, pipe, sessionID)
 
 	_, err := pipe.Exec(ctx)
 	return err
 }
 
-// Lookup retrieves the original value for a single token in a session
+// touch queues a TTL refresh of the session's keys on pipe. Keys that
+// don't exist are left alone, so a lookup never creates a session.
+func (v *Vault) touch(ctx context.Context, pipe redis.Pipeliner, sessionID string) {
+	for _, key := range []string{sessionKey(sessionID), deepKey(sessionID), ownerKey(sessionID)} {
+		pipe.Expire(ctx, key, v.ttl)
+	}
+}
+
+// Lookup retrieves the original value for a single token in a session and
+// extends the session's TTL
 func (v *Vault) Lookup(ctx context.Context, sessionID, token string) (string, error) {
-	val, err := v.client.HGet(ctx, sessionKey(sessionID), token).Result()
+	pipe := v.client.Pipeline()
+	get := pipe.HGet(ctx, sessionKey(sessionID), token)
+	v.touch(ctx, pipe, sessionID)
+	pipe.Exec(ctx) // the errors that matter are get's
+	val, err := get.Result()
 	if err != nil {
 		return "", err
 	}
 	return v.decrypt(val)
 }
 
-// LookupAll retrieves all token->original mappings for a session
+// LookupAll retrieves all token->original mappings for a session and
+// extends the session's TTL
 func (v *Vault) LookupAll(ctx context.Context, sessionID string) (map[string]string, error) {
-	raw, err := v.client.HGetAll(ctx, sessionKey(sessionID)).Result()
+	pipe := v.client.Pipeline()
+	getAll := pipe.HGetAll(ctx, sessionKey(sessionID))
+	v.touch(ctx, pipe, sessionID)
+	pipe.Exec(ctx)
+	raw, err := getAll.Result()
 	if err != nil {
 		return nil, err
 	}
@@ -98,10 +125,43 @@ func (v *Vault) LookupAll(ctx context.Context, sessionID string) (map[string]str
 
 // Delete removes all mappings for a session
 func (v *Vault) Delete(ctx context.Context, sessionID string) error {
-	return v.client.Del(ctx, sessionKey(sessionID)).Err()
+	_, err := v.Erase(ctx, sessionID)
+	return err
+}
+
+// Erase removes all mappings for a session like Delete and returns how
+// many tokens it held, 0 for an unknown session
+func (v *Vault) Erase(ctx context.Context, sessionID string) (int64, error) {
+	pipe := v.client.Pipeline()
+	count := pipe.HLen(ctx, sessionKey(sessionID))
+	pipe.Del(ctx, sessionKey(sessionID), deepKey(sessionID), ownerKey(sessionID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// deepKey marks a session promoted to deep scanning. It lives beside the
+// session hash so the mapping holds tokens only.
+func deepKey(sessionID string) string {
+	return fmt.Sprintf("pii:deep:%s", sessionID)
+}
+
+// PromoteDeep marks a session for deep scanning on every request until it
+// expires along with its mappings. It reports whether the session was newly
+// promoted.
+func (v *Vault) PromoteDeep(ctx context.Context, sessionID string) (bool, error) {
+	return v.client.SetNX(ctx, deepKey(sessionID), 1, v.ttl).Result()
+}
+
+// IsDeep reports whether a session was promoted to deep scanning
+func (v *Vault) IsDeep(ctx context.Context, sessionID string) (bool, error) {
+	n, err := v.client.Exists(ctx, deepKey(sessionID)).Result()
+	return n > 0, err
 }
 
-// SetTTL configures the TTL for session mappings
+// SetTTL sets how long a session's mappings live after its last store or
+// lookup, DefaultTTL by default
 func (v *Vault) SetTTL(ttl time.Duration) {
 	v.ttl = ttl
 }
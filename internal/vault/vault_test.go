@@ -2,11 +2,26 @@ package vault
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/redisconn"
 )
 
 func setupTestVault(t *testing.T) (*Vault, *miniredis.Miniredis) {
@@ -95,6 +110,14 @@ func TestDelete(t *testing.T) {
 	if len(got) != 0 {
 		t.Errorf("expected empty after delete, got %v", got)
 	}
+
+	v.Store(ctx, "session-erase", map[string]string{"[X]": "data", "[Y]": "more"})
+	if n, err := v.Erase(ctx, "session-erase"); err != nil || n != 2 {
+		t.Errorf("Erase = %d, %v; want 2 tokens", n, err)
+	}
+	if n, err := v.Erase(ctx, "session-erase"); err != nil || n != 0 {
+		t.Errorf("second Erase = %d, %v; want 0", n, err)
+	}
 }
 
 func TestTTLExpiry(t *testing.T) {
@@ -113,6 +136,37 @@ func TestTTLExpiry(t *testing.T) {
 	}
 }
 
+func TestTTLRefreshedOnLookup(t *testing.T) {
+	v, mr := setupTestVault(t)
+	ctx := context.Background()
+
+	v.SetTTL(time.Hour)
+	v.Store(WithOwner(ctx, "key:a"), "active", map[string]string{"[A]": "value"})
+	v.Store(ctx, "idle", map[string]string{"[B]": "value"})
+
+	// Each lookup of the active session restarts its hour
+	for i := 0; i < 3; i++ {
+		mr.FastForward(40 * time.Minute)
+		if got, err := v.Lookup(ctx, "active", "[A]"); err != nil || got != "value" {
+			t.Fatalf("lookup %d: %q, %v", i, got, err)
+		}
+	}
+	if owner, _ := v.Owner(ctx, "active"); owner != "key:a" {
+		t.Errorf("owner expired while the session was in use: %q", owner)
+	}
+	if got, _ := v.LookupAll(ctx, "idle"); len(got) != 0 {
+		t.Errorf("idle session outlived its TTL: %v", got)
+	}
+
+	mr.FastForward(time.Hour + time.Second)
+	if _, err := v.Lookup(ctx, "active", "[A]"); err != redis.Nil {
+		t.Errorf("lookup after the TTL: err = %v, want redis.Nil", err)
+	}
+	if mr.Exists(sessionKey("active")) {
+		t.Error("a lookup of an expired session recreated it")
+	}
+}
+
 func TestSessionIsolation(t *testing.T) {
 	v, _ := setupTestVault(t)
 	ctx := context.Background()
@@ -130,3 +184,293 @@ func TestSessionIsolation(t *testing.T) {
 		t.Errorf("session B leaked: got %s", gotB["[TOKEN]"])
 	}
 }
+
+// selfSignedCert writes a self-signed CA/server cert for 127.0.0.1 and
+// returns the TLS server config and the CA file path
+func selfSignedCert(t *testing.T) (*tls.Config, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "veil-test-redis"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(caPath, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}, caPath
+}
+
+func TestStoreAndLookup_TLS(t *testing.T) {
+	serverTLS, caPath := selfSignedCert(t)
+
+	mr := miniredis.NewMiniRedis()
+	if err := mr.StartTLS(serverTLS); err != nil {
+		t.Fatalf("start TLS redis: %v", err)
+	}
+	defer mr.Close()
+
+	client, err := redisconn.New(redisconn.Config{
+		Addr:  mr.Addr(),
+		TLS:   true,
+		TLSCA: caPath,
+	})
+	if err != nil {
+		t.Fatalf("redis client: %v", err)
+	}
+	defer client.Close()
+
+	v := NewWithClient(client)
+	ctx := context.Background()
+
+	if err := v.Store(ctx, "tls-session", map[string]string{"[EMAIL_1]": "tls@example.com"}); err != nil {
+		t.Fatalf("store over TLS failed: %v", err)
+	}
+	got, err := v.Lookup(ctx, "tls-session", "[EMAIL_1]")
+	if err != nil {
+		t.Fatalf("lookup over TLS failed: %v", err)
+	}
+	if got != "tls@example.com" {
+		t.Errorf("expected tls@example.com, got %s", got)
+	}
+
+	// A client that does not trust the CA must fail the handshake
+	untrusted, err := redisconn.New(redisconn.Config{Addr: mr.Addr(), TLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer untrusted.Close()
+	if err := NewWithClient(untrusted).Ping(ctx); err == nil {
+		t.Error("expected TLS verification error for untrusted CA")
+	}
+}
+
+func TestListSessions_PagesUnderWrites(t *testing.T) {
+	v, _ := setupTestVault(t)
+	ctx := context.Background()
+
+	want := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("sess-%02d", i)
+		want[id] = true
+		v.Store(ctx, id, map[string]string{"[EMAIL_1]": "a@example.com", "[PHONE_1]": "0912345678"})
+	}
+
+	// miniredis ignores the SCAN count and answers in one batch; against
+	// Redis the same loop walks several pages
+	got := make(map[string]bool)
+	cursor, pages := "", 0
+	for {
+		page, next, err := v.ListSessions(ctx, cursor, 7)
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		for _, s := range page {
+			got[s.ID] = true
+			if s.Entries != 2 && strings.HasPrefix(s.ID, "sess-") {
+				t.Errorf("%s: entries = %d, want 2", s.ID, s.Entries)
+			}
+			if s.TTL <= 0 || s.TTL > DefaultTTL {
+				t.Errorf("%s: ttl = %s", s.ID, s.TTL)
+			}
+		}
+		// Sessions written during the listing must not disturb the pages
+		v.Store(ctx, fmt.Sprintf("new-%d", pages), map[string]string{"[CCCD_1]": "012345678901"})
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	for id := range want {
+		if !got[id] {
+			t.Errorf("session %s missing from the listing", id)
+		}
+	}
+
+	if _, _, err := v.ListSessions(ctx, "not-a-cursor", 10); !errors.Is(err, ErrInvalidCursor) {
+		t.Error("expected an error for a malformed cursor")
+	}
+}
+
+func TestSessionInfo(t *testing.T) {
+	v, _ := setupTestVault(t)
+	ctx := context.Background()
+	enc, _ := NewEncryptor(make([]byte, 32))
+	v.SetEncryptor(enc)
+	v.Store(ctx, "s1", map[string]string{
+		"[EMAIL_1]":   "a@example.com",
+		"[EMAIL_2]":   "b@example.com",
+		"[CCCD_1]":    "012345678901",
+		"[ACME_ID_1]": "ACME-1",
+		"sk-a***xyz":  "sk-abc123xyz",
+	})
+
+	info, err := v.SessionInfo(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Entries != 5 {
+		t.Errorf("entries = %d, want 5", info.Entries)
+	}
+	wantCats := map[string]int{"EMAIL": 2, "CCCD": 1, "ACME_ID": 1, "masked": 1}
+	for cat, n := range wantCats {
+		if info.Categories[cat] != n {
+			t.Errorf("category %s = %d, want %d (got %v)", cat, info.Categories[cat], n, info.Categories)
+		}
+	}
+
+	if _, err := v.SessionInfo(ctx, "missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestPromoteDeep(t *testing.T) {
+	v, mr := setupTestVault(t)
+	ctx := context.Background()
+	v.Store(ctx, "s1", map[string]string{"[EMAIL_1]": "a@example.com"})
+
+	if deep, _ := v.IsDeep(ctx, "s1"); deep {
+		t.Fatal("new session is deep")
+	}
+	if promoted, err := v.PromoteDeep(ctx, "s1"); err != nil || !promoted {
+		t.Fatalf("PromoteDeep = %v, %v", promoted, err)
+	}
+	if promoted, _ := v.PromoteDeep(ctx, "s1"); promoted {
+		t.Error("second promotion reported as new")
+	}
+	if deep, _ := v.IsDeep(ctx, "s1"); !deep {
+		t.Error("promoted session is not deep")
+	}
+	if info, _ := v.SessionInfo(ctx, "s1"); !info.Deep || info.Entries != 1 {
+		t.Errorf("info = %+v, want deep with 1 entry", info)
+	}
+	if sessions, _, _ := v.ListSessions(ctx, "", 10); len(sessions) != 1 {
+		t.Errorf("promotion shows up as a session: %+v", sessions)
+	}
+
+	// Promotion lasts as long as the session
+	mr.FastForward(DefaultTTL + time.Second)
+	if deep, _ := v.IsDeep(ctx, "s1"); deep {
+		t.Error("promotion outlived the session")
+	}
+
+	v.Store(ctx, "s2", map[string]string{"[EMAIL_1]": "b@example.com"})
+	v.PromoteDeep(ctx, "s2")
+	v.Delete(ctx, "s2")
+	if deep, _ := v.IsDeep(ctx, "s2"); deep {
+		t.Error("promotion survived Delete")
+	}
+}
+
+func TestOwner(t *testing.T) {
+	v, mr := setupTestVault(t)
+	ctx := context.Background()
+
+	v.Store(WithOwner(ctx, "key:a"), "s1", map[string]string{"[EMAIL_1]": "a@example.com"})
+	v.Store(WithOwner(ctx, "key:b"), "s1", map[string]string{"[EMAIL_2]": "b@example.com"})
+	if owner, err := v.Owner(ctx, "s1"); err != nil || owner != "key:a" {
+		t.Fatalf("Owner = %q, %v; want the first writer", owner, err)
+	}
+
+	v.Store(ctx, "legacy", map[string]string{"[X]": "data"})
+	if owner, err := v.Owner(ctx, "legacy"); err != nil || owner != "" {
+		t.Errorf("session stored without owner: Owner = %q, %v", owner, err)
+	}
+	if sessions, _, _ := v.ListSessions(ctx, "", 10); len(sessions) != 2 {
+		t.Errorf("owner shows up as a session: %+v", sessions)
+	}
+
+	// The binding lasts as long as the session
+	mr.FastForward(DefaultTTL + time.Second)
+	if owner, _ := v.Owner(ctx, "s1"); owner != "" {
+		t.Errorf("binding outlived the session: %q", owner)
+	}
+
+	v.Store(WithOwner(ctx, "key:a"), "s2", map[string]string{"[X]": "data"})
+	v.Delete(ctx, "s2")
+	if owner, _ := v.Owner(ctx, "s2"); owner != "" {
+		t.Errorf("binding survived Delete: %q", owner)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	ctx := context.Background()
+	v, mr := setupTestVault(t)
+	keyA, _ := NewEncryptor([]byte("0123456789abcdef0123456789abcdef"))
+	keyB, _ := NewEncryptor([]byte("fedcba9876543210fedcba9876543210"))
+
+	// Plaintext first run, then an upgrade to encryption
+	if err := v.SelfTest(ctx); err != nil {
+		t.Fatalf("plaintext self-test: %v", err)
+	}
+	v.SetEncryptor(keyA)
+	if err := v.SelfTest(ctx); err != nil {
+		t.Fatalf("self-test after enabling encryption: %v", err)
+	}
+	if err := v.SelfTest(ctx); err != nil {
+		t.Fatalf("self-test with the same key: %v", err)
+	}
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, "pii:session:") {
+			t.Errorf("canary %s left behind", key)
+		}
+	}
+
+	// Wrong key after rotation, or no key at all
+	v.SetEncryptor(keyB)
+	if err := v.SelfTest(ctx); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("rotated key: err = %v, want ErrKeyMismatch", err)
+	}
+	v.SetEncryptor(nil)
+	if err := v.SelfTest(ctx); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("missing key: err = %v, want ErrKeyMismatch", err)
+	}
+
+	// Deleting the key check accepts the new key
+	mr.Del(keyCheckKey)
+	v.SetEncryptor(keyB)
+	if err := v.SelfTest(ctx); err != nil {
+		t.Errorf("self-test after resetting the key check: %v", err)
+	}
+
+	mr.Close()
+	if err := v.SelfTest(ctx); err == nil {
+		t.Error("self-test against a stopped Redis should fail")
+	}
+}
+
+func TestEncryptionStatus(t *testing.T) {
+	v, _ := setupTestVault(t)
+	if h := v.EncryptionStatus(); h.Encrypted || h.PlaintextOverride {
+		t.Errorf("status = %+v", h)
+	}
+	v.SetPlaintextOverride(true)
+	if h := v.EncryptionStatus(); !h.PlaintextOverride {
+		t.Errorf("status = %+v", h)
+	}
+	enc, _ := NewEncryptor([]byte("0123456789abcdef0123456789abcdef"))
+	v.SetEncryptor(enc)
+	if h := v.EncryptionStatus(); !h.Encrypted {
+		t.Errorf("status = %+v", h)
+	}
+}
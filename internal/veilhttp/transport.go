@@ -0,0 +1,229 @@
+// Package veilhttp runs Veil in-process as an http.RoundTripper, for Go
+// services that call an LLM provider directly and want their *http.Client
+// protected without deploying the proxy:
+//
+//	client := &http.Client{Transport: veilhttp.NewTransport(det, v)}
+//
+// Requests are anonymized and responses rehydrated the way the proxy does
+// it, so the provider only ever sees tokens.
+package veilhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/guardrail"
+	"github.com/vurakit/agentveil/internal/promptguard"
+	"github.com/vurakit/agentveil/internal/proxy"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/internal/webhook"
+)
+
+// DefaultRole is the role responses are rehydrated for unless WithRole or
+// X-User-Role says otherwise. The service holds the original values
+// already, so it gets them back in full.
+const DefaultRole = "admin"
+
+// Option configures a Transport
+type Option func(*Transport)
+
+// WithBase sets the transport requests are sent with, http.DefaultTransport
+// by default
+func WithBase(rt http.RoundTripper) Option {
+	return func(t *Transport) { t.base = rt }
+}
+
+// WithSession derives the session of requests without X-Session-ID. Without
+// it the session is X-Request-ID, then "default", as in the proxy.
+func WithSession(fn func(*http.Request) string) Option {
+	return func(t *Transport) { t.session = fn }
+}
+
+// WithRole sets the role of requests without X-User-Role
+func WithRole(role string) Option {
+	return func(t *Transport) { t.role = role }
+}
+
+// WithSSEHeartbeat sets the SSE heartbeat interval, see proxy.Config
+func WithSSEHeartbeat(d time.Duration) Option {
+	return func(t *Transport) { t.heartbeat = d }
+}
+
+// WithPromptGuard refuses requests the guard blocks with a 403
+// prompt_injection response; the provider is not called
+func WithPromptGuard(g *promptguard.Guard) Option {
+	return func(t *Transport) { t.promptGuard = g }
+}
+
+// WithGuardrail checks the provider's output against g, as the provider
+// wrote it, before it is rehydrated
+func WithGuardrail(g *guardrail.Guardrail) Option {
+	return func(t *Transport) { t.guardrail = g }
+}
+
+// WithWebhook emits PII detection events to d
+func WithWebhook(d *webhook.Dispatcher) Option {
+	return func(t *Transport) { t.webhook = d }
+}
+
+// Transport anonymizes request bodies and rehydrates responses around a
+// base transport. It is safe for concurrent use.
+type Transport struct {
+	base        http.RoundTripper
+	session     func(*http.Request) string
+	role        string
+	heartbeat   time.Duration
+	promptGuard *promptguard.Guard
+	guardrail   *guardrail.Guardrail
+	webhook     *webhook.Dispatcher
+
+	anonymize func(*http.Request)
+	rehydrate func(*http.Response) error
+	handler   http.Handler
+}
+
+// NewTransport returns a transport that protects requests with det and v
+func NewTransport(det *detector.Detector, v *vault.Vault, opts ...Option) http.RoundTripper {
+	t := &Transport{base: http.DefaultTransport, role: DefaultRole}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	t.anonymize = proxy.AnonymizeRequest(det, v, proxy.CountTokensAnonymize, proxy.FieldPolicy{}, t.webhook)
+	// Every session of the vault belongs to this process
+	t.rehydrate = proxy.RehydrateResponse(v, t.role, t.heartbeat, proxy.SessionBinding{Disabled: true})
+
+	// The guards are the proxy's middlewares, run over an in-memory pipe
+	var h http.Handler = http.HandlerFunc(t.forward)
+	if det.BlocksSecrets() {
+		h = proxy.BlockSecrets(det, t.webhook, 0, "veilhttp")(h)
+	}
+	if t.guardrail != nil {
+		h = guardrail.ResponseMiddleware(t.guardrail)(h)
+	}
+	if t.promptGuard != nil {
+		h = promptguard.Middleware(t.promptGuard)(h)
+	}
+	t.handler = h
+	return t
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	out := req.Clone(ctx)
+	if t.session != nil && out.Header.Get("X-Session-ID") == "" {
+		if id := t.session(req); id != "" {
+			out.Header.Set("X-Session-ID", id)
+		}
+	}
+
+	pr, pw := io.Pipe()
+	w := &pipeWriter{header: make(http.Header), pw: pw, ready: make(chan struct{})}
+	go w.serve(t.handler, out.WithContext(context.WithValue(ctx, pipeKey{}, w)))
+
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		pr.CloseWithError(ctx.Err())
+		return nil, ctx.Err()
+	}
+	if w.err != nil {
+		pr.Close()
+		return nil, w.err
+	}
+
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.sent,
+		Body:          pr,
+		ContentLength: -1,
+		Request:       out,
+	}
+	if err := t.rehydrate(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+// forward anonymizes r, sends it upstream and copies the response to w
+func (t *Transport) forward(w http.ResponseWriter, r *http.Request) {
+	pw := r.Context().Value(pipeKey{}).(*pipeWriter)
+	t.anonymize(r)
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		pw.fail(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		pw.fail(err)
+	}
+}
+
+type pipeKey struct{}
+
+// pipeWriter is the http.ResponseWriter of one round trip. The body goes
+// through a pipe, so the caller reads it while the handler still writes.
+type pipeWriter struct {
+	header http.Header
+	pw     *io.PipeWriter
+	ready  chan struct{} // closed once the header is sent
+
+	// Set before ready is closed
+	status int
+	sent   http.Header
+	err    error
+}
+
+func (w *pipeWriter) Header() http.Header { return w.header }
+
+func (w *pipeWriter) WriteHeader(code int) {
+	if w.sent != nil {
+		return
+	}
+	w.status = code
+	w.sent = w.header.Clone()
+	// The body may be rewritten; the length is set again by rehydration
+	w.sent.Del("Content-Length")
+	close(w.ready)
+}
+
+func (w *pipeWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.pw.Write(b)
+}
+
+// Flush is a no-op; writes reach the reader as they are made
+func (w *pipeWriter) Flush() {}
+
+// fail ends the round trip with err, or the body if it has started
+func (w *pipeWriter) fail(err error) {
+	if w.sent != nil {
+		w.pw.CloseWithError(err)
+		return
+	}
+	w.err = err
+}
+
+func (w *pipeWriter) serve(h http.Handler, r *http.Request) {
+	h.ServeHTTP(w, r)
+	w.WriteHeader(http.StatusOK) // a handler that wrote nothing
+	w.pw.Close()
+}
@@ -0,0 +1,109 @@
+// Package version holds the build information of the agentveil binaries.
+// Release builds set it with -ldflags:
+//
+//	go build -ldflags "-X github.com/vurakit/agentveil/internal/version.Version=1.4.0 \
+//	  -X github.com/vurakit/agentveil/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/vurakit/agentveil/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them, the module version and VCS stamp that go build records are
+// used, so go install and plain builds from a checkout still identify
+// themselves.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set with -ldflags -X at build time
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = "" // RFC 3339
+)
+
+// BuildInfo describes the running build
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"` // GOOS/GOARCH
+}
+
+var readBuildInfo = sync.OnceValue(func() *debug.BuildInfo {
+	bi, _ := debug.ReadBuildInfo()
+	return bi
+})
+
+// Get returns the build information, falling back to what go build
+// recorded for the values not set with -ldflags
+func Get() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	bi := readBuildInfo()
+	if bi == nil {
+		return info
+	}
+	if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	var modified bool
+	var revision, vcsTime string
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.time":
+			vcsTime = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if info.Commit == "" && revision != "" {
+		info.Commit = revision
+		if modified {
+			info.Commit += "-dirty"
+		}
+	}
+	if info.Date == "" {
+		info.Date = vcsTime
+	}
+	return info
+}
+
+// String formats the build as "1.4.0 (commit 1a2b3c4d, built 2026-05-01T10:00:00Z)"
+func (i BuildInfo) String() string {
+	s := i.Version
+	var details []string
+	if i.Commit != "" {
+		commit := i.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		details = append(details, "commit "+commit)
+	}
+	if i.Date != "" {
+		details = append(details, "built "+i.Date)
+	}
+	switch len(details) {
+	case 1:
+		s += fmt.Sprintf(" (%s)", details[0])
+	case 2:
+		s += fmt.Sprintf(" (%s, %s)", details[0], details[1])
+	}
+	return s
+}
+
+// UserAgent is the product token the proxy adds to upstream requests,
+// e.g. "AgentVeil/1.4.0"
+func UserAgent() string {
+	return "AgentVeil/" + Get().Version
+}
@@ -0,0 +1,45 @@
+package version
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func setBuild(t *testing.T, v, commit, date string) {
+	t.Helper()
+	old := [3]string{Version, Commit, Date}
+	t.Cleanup(func() { Version, Commit, Date = old[0], old[1], old[2] })
+	Version, Commit, Date = v, commit, date
+}
+
+func TestGet_Injected(t *testing.T) {
+	setBuild(t, "1.4.0", "1a2b3c4d5e6f7a8b9c0d", "2026-05-01T10:00:00Z")
+
+	info := Get()
+	if info.Version != "1.4.0" || info.Commit != "1a2b3c4d5e6f7a8b9c0d" || info.Date != "2026-05-01T10:00:00Z" {
+		t.Errorf("Get() = %+v", info)
+	}
+	if info.GoVersion != runtime.Version() || info.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Errorf("runtime fields = %+v", info)
+	}
+	if got, want := info.String(), "1.4.0 (commit 1a2b3c4d5e6f, built 2026-05-01T10:00:00Z)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := UserAgent(); got != "AgentVeil/1.4.0" {
+		t.Errorf("UserAgent() = %q", got)
+	}
+}
+
+func TestGet_Defaults(t *testing.T) {
+	setBuild(t, "dev", "", "")
+
+	// Test binaries carry no module version, so the default stays
+	info := Get()
+	if info.Version == "" || strings.Contains(info.String(), "()") {
+		t.Errorf("Get() = %+v, String() = %q", info, info.String())
+	}
+	if got := (BuildInfo{Version: "dev"}).String(); got != "dev" {
+		t.Errorf("String() without details = %q", got)
+	}
+}
@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// EventDigest is the summary of events an AlertPolicy held back. It is only
+// sent to the destination that held them.
+const EventDigest EventType = "alert.digest"
+
+// AlertRule is the minimum an event must reach to alert. It reads "count"
+// and "categories" from the event data; an event without a count counts
+// as one entity per category, or one.
+type AlertRule struct {
+	// MinCount is the fewest entities that alert; events carrying a
+	// secret category always alert
+	MinCount int `json:"min_count,omitempty"`
+	// SecretsOnly alerts only on events carrying a secret category
+	SecretsOnly bool `json:"secrets_only,omitempty"`
+}
+
+// AlertPolicy reduces the events sent to a destination, typically a chat
+// channel, while destinations without one keep receiving every event
+type AlertPolicy struct {
+	// Rules set a minimum per event type; types without a rule always alert
+	Rules map[EventType]AlertRule `json:"rules,omitempty"`
+	// CooldownSec allows at most one alert per session and event type in
+	// this many seconds
+	CooldownSec int `json:"cooldown_sec,omitempty"`
+	// DigestSec, when set, summarizes held-back events in one EventDigest
+	// every this many seconds instead of dropping them
+	DigestSec int `json:"digest_sec,omitempty"`
+}
+
+// Digest is the data of an EventDigest event
+type Digest struct {
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Events     map[EventType]int `json:"events"`
+	Categories map[string]int    `json:"categories,omitempty"`
+	Sessions   int               `json:"sessions"`
+}
+
+// cooldownSweepSize is how many cooldown entries accumulate before expired
+// ones are swept
+const cooldownSweepSize = 1024
+
+// alertState is the per-destination state of an AlertPolicy. It is only
+// touched under the mutex of the destination's queue.
+type alertState struct {
+	policy    AlertPolicy
+	lastAlert map[string]time.Time // event type + session → last alert
+	digest    *Digest
+	sessions  map[string]bool
+	nextFlush time.Time
+}
+
+func newAlertState(p AlertPolicy) *alertState {
+	return &alertState{policy: p, lastAlert: make(map[string]time.Time)}
+}
+
+// admit decides whether event alerts now. Held-back events go into the
+// digest when one is configured.
+func (a *alertState) admit(event Event, now time.Time) bool {
+	count, categories := eventEntities(event)
+	if rule, ok := a.policy.Rules[event.Type]; ok && !rule.met(count, categories) {
+		a.hold(event, categories, now)
+		return false
+	}
+
+	if a.policy.CooldownSec > 0 {
+		cooldown := time.Duration(a.policy.CooldownSec) * time.Second
+		key := string(event.Type) + "\x00" + event.SessionID
+		if last, ok := a.lastAlert[key]; ok && now.Sub(last) < cooldown {
+			a.hold(event, categories, now)
+			return false
+		}
+		if len(a.lastAlert) >= cooldownSweepSize {
+			for k, t := range a.lastAlert {
+				if now.Sub(t) >= cooldown {
+					delete(a.lastAlert, k)
+				}
+			}
+		}
+		a.lastAlert[key] = now
+	}
+	return true
+}
+
+func (r AlertRule) met(count int, categories []string) bool {
+	for _, c := range categories {
+		if pii.IsSecretCategory(pii.Category(c)) {
+			return true
+		}
+	}
+	return !r.SecretsOnly && count >= r.MinCount
+}
+
+func (a *alertState) hold(event Event, categories []string, now time.Time) {
+	if a.policy.DigestSec <= 0 {
+		slog.Debug("webhook: event below alert threshold", "event", event.Type, "session", event.SessionID)
+		return
+	}
+	if a.digest == nil {
+		a.digest = &Digest{From: now, Events: make(map[EventType]int), Categories: make(map[string]int)}
+		a.sessions = make(map[string]bool)
+		a.nextFlush = now.Add(time.Duration(a.policy.DigestSec) * time.Second)
+	}
+	a.digest.Events[event.Type]++
+	for _, c := range categories {
+		a.digest.Categories[c]++
+	}
+	if event.SessionID != "" {
+		a.sessions[event.SessionID] = true
+	}
+}
+
+// flush returns the digest event when one is due, or any pending digest
+// when force is set
+func (a *alertState) flush(now time.Time, force bool) (Event, bool) {
+	if a.digest == nil || (!force && now.Before(a.nextFlush)) {
+		return Event{}, false
+	}
+	d := a.digest
+	d.To = now
+	d.Sessions = len(a.sessions)
+	if len(d.Categories) == 0 {
+		d.Categories = nil
+	}
+	a.digest, a.sessions = nil, nil
+
+	event := Event{Type: EventDigest, Timestamp: now, Data: *d}
+	fillDefaults(&event)
+	return event, true
+}
+
+// eventEntities reads the entity count and categories from event data
+func eventEntities(event Event) (int, []string) {
+	data, ok := event.Data.(map[string]any)
+	if !ok {
+		return 1, nil
+	}
+	var categories []string
+	switch cs := data["categories"].(type) {
+	case []pii.Category:
+		for _, c := range cs {
+			categories = append(categories, string(c))
+		}
+	case []string:
+		categories = cs
+	case []any:
+		for _, c := range cs {
+			if s, ok := c.(string); ok {
+				categories = append(categories, s)
+			}
+		}
+	}
+	count := 1
+	if len(categories) > 0 {
+		count = len(categories)
+	}
+	switch n := data["count"].(type) {
+	case int:
+		count = n
+	case float64:
+		count = int(n)
+	}
+	return count, categories
+}
+
+// formatDigest renders a digest as chat text, largest counts first
+func formatDigest(d Digest) string {
+	var b strings.Builder
+	total := 0
+	for _, n := range d.Events {
+		total += n
+	}
+	fmt.Fprintf(&b, "%d events below alert threshold from %d sessions (%s – %s)",
+		total, d.Sessions, d.From.Format("15:04"), d.To.Format("15:04"))
+	for _, line := range []struct {
+		label  string
+		counts map[string]int
+	}{
+		{"Events", eventCounts(d.Events)},
+		{"Categories", d.Categories},
+	} {
+		if len(line.counts) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(line.counts))
+		for k := range line.counts {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if line.counts[keys[i]] != line.counts[keys[j]] {
+				return line.counts[keys[i]] > line.counts[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = fmt.Sprintf("%s: %d", k, line.counts[k])
+		}
+		fmt.Fprintf(&b, "\n%s: %s", line.label, strings.Join(parts, ", "))
+	}
+	return b.String()
+}
+
+func eventCounts(m map[EventType]int) map[string]int {
+	out := make(map[string]int, len(m))
+	for k, v := range m {
+		out[string(k)] = v
+	}
+	return out
+}
+
+// validate checks a policy; a nil policy is valid
+func (p *AlertPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.CooldownSec < 0 || p.DigestSec < 0 {
+		return fmt.Errorf("alerting: cooldown and digest intervals must not be negative")
+	}
+	for t, r := range p.Rules {
+		if !ValidEventType(t) {
+			return fmt.Errorf("alerting: unknown event type %q", t)
+		}
+		if r.MinCount < 0 {
+			return fmt.Errorf("alerting: %s: min_count must not be negative", t)
+		}
+	}
+	return nil
+}
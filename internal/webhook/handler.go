@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TestRequest is the body of POST /admin/webhooks/test
+type TestRequest struct {
+	Type        EventType `json:"type"`        // defaults to pii.detected
+	Destination string    `json:"destination"` // empty = all enabled destinations
+}
+
+// TestResponse reports one result per destination
+type TestResponse struct {
+	EventID       string           `json:"event_id"`
+	SchemaVersion string           `json:"schema_version"`
+	Results       []DeliveryResult `json:"results"`
+}
+
+// syntheticEvent builds a test event that carries no real PII
+func syntheticEvent(t EventType) Event {
+	return Event{
+		ID:        fmt.Sprintf("evt_test_%d", time.Now().UnixNano()),
+		Type:      t,
+		SessionID: "webhook-test",
+		Data: map[string]any{
+			"synthetic": true,
+			"message":   "Agent Veil webhook test — no action required",
+		},
+	}
+}
+
+// TestHandler serves POST /admin/webhooks/test: it sends a synthetic event
+// to one or all destinations synchronously and returns each delivery result
+func (d *Dispatcher) TestHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req TestRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, `{"error":"invalid JSON body"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Type == "" {
+			req.Type = EventPIIDetected
+		}
+		if !ValidEventType(req.Type) {
+			http.Error(w, fmt.Sprintf(`{"error":"unknown event type %q"}`, req.Type), http.StatusBadRequest)
+			return
+		}
+
+		var targets []Destination
+		for _, dest := range d.destinations {
+			if (req.Destination == "" && dest.Enabled) || dest.Name == req.Destination {
+				targets = append(targets, dest)
+			}
+		}
+		if len(targets) == 0 {
+			http.Error(w, `{"error":"no matching destination"}`, http.StatusNotFound)
+			return
+		}
+
+		event := syntheticEvent(req.Type)
+		resp := TestResponse{
+			EventID:       event.ID,
+			SchemaVersion: SchemaVersion,
+			Results:       make([]DeliveryResult, 0, len(targets)),
+		}
+		for _, dest := range targets {
+			resp.Results = append(resp.Results, d.SendNow(dest, event))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
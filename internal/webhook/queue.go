@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// delivery is an event on its way to one destination
+type delivery struct {
+	event    Event
+	attempts int // failed attempts so far
+}
+
+// DestinationStats counts the deliveries to one destination
+type DestinationStats struct {
+	Name      string `json:"name"`
+	Queued    int64  `json:"queued"`    // waiting, in progress or waiting to retry
+	Delivered uint64 `json:"delivered"` // accepted by the destination
+	Retried   uint64 `json:"retried"`   // failed attempts that were retried
+	Failed    uint64 `json:"failed"`    // given up on after the last attempt
+	Dropped   uint64 `json:"dropped"`   // refused by a full queue or at shutdown
+}
+
+// destQueue is the bounded queue and the counters of one destination.
+// size counts every accepted delivery until it is done, so ready, which
+// has room for them all, never blocks.
+type destQueue struct {
+	dest        Destination
+	concurrency int
+	limit       int64
+	ready       chan delivery
+	size        atomic.Int64
+
+	// mu serializes admission, including the alert policy state
+	mu    sync.Mutex
+	alert *alertState
+
+	delivered, retried, failed, dropped atomic.Uint64
+}
+
+func newDestQueue(dest Destination, cfg Config) *destQueue {
+	q := &destQueue{
+		dest:        dest,
+		concurrency: dest.Concurrency,
+		limit:       int64(max(cfg.BufferSize, 1)),
+	}
+	if q.concurrency <= 0 && (q.chat() || dest.Alerting != nil) {
+		// One at a time, so alerts and their digests arrive in order
+		q.concurrency = 1
+	}
+	if q.concurrency <= 0 {
+		q.concurrency = cfg.Concurrency
+	}
+	if q.concurrency <= 0 {
+		q.concurrency = DefaultConcurrency
+	}
+	q.ready = make(chan delivery, q.limit)
+	if dest.Alerting != nil {
+		q.alert = newAlertState(*dest.Alerting)
+	}
+	return q
+}
+
+// chat reports whether q is the Slack or Discord destination
+func (q *destQueue) chat() bool {
+	return q.dest.Name == "slack" || q.dest.Name == "discord"
+}
+
+// offer queues event unless the alert policy holds it back or the queue
+// is full
+func (q *destQueue) offer(d *Dispatcher, event Event, now time.Time) {
+	q.mu.Lock()
+	if q.alert != nil && !q.alert.admit(event, now) {
+		q.mu.Unlock()
+		return
+	}
+	q.push(d, event)
+	q.mu.Unlock()
+}
+
+// flushDigest queues q's digest when it is due, or when force is set
+func (q *destQueue) flushDigest(d *Dispatcher, now time.Time, force bool) {
+	if q.alert == nil {
+		return
+	}
+	q.mu.Lock()
+	if event, ok := q.alert.flush(now, force); ok {
+		q.push(d, event)
+	}
+	q.mu.Unlock()
+}
+
+// push adds a new delivery of event; the caller holds q.mu
+func (q *destQueue) push(d *Dispatcher, event Event) {
+	if q.size.Load() >= q.limit {
+		q.dropped.Add(1)
+		slog.Warn("webhook: destination queue full, dropping event", "dest", q.dest.Name, "type", event.Type)
+		return
+	}
+	q.size.Add(1)
+	d.pending.Add(1)
+	q.ready <- delivery{event: event}
+}
+
+// done retires a delivery, counting its outcome in counter
+func (q *destQueue) done(d *Dispatcher, counter *atomic.Uint64) {
+	counter.Add(1)
+	q.size.Add(-1)
+	d.pending.Done()
+}
+
+func (q *destQueue) stats() DestinationStats {
+	return DestinationStats{
+		Name:      q.dest.Name,
+		Queued:    q.size.Load(),
+		Delivered: q.delivered.Load(),
+		Retried:   q.retried.Load(),
+		Failed:    q.failed.Load(),
+		Dropped:   q.dropped.Load(),
+	}
+}
+
+// statusError is a non-2xx answer. after is the delay a 429 or 503 asked
+// for with Retry-After, 0 without one.
+type statusError struct {
+	status int
+	after  time.Duration
+}
+
+func (e statusError) Error() string { return fmt.Sprintf("non-2xx response: %d", e.status) }
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	raw := h.Get("Retry-After")
+	if raw == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(raw); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -2,60 +2,175 @@ package webhook
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
+
+	"github.com/vurakit/agentveil/internal/version"
 )
 
 // EventType represents the type of webhook event
 type EventType string
 
 const (
-	EventPIIDetected       EventType = "pii.detected"
-	EventPIIHighRisk       EventType = "pii.high_risk"
-	EventPromptInjection   EventType = "prompt_injection.detected"
-	EventGuardrailViolation EventType = "guardrail.violation"
-	EventAuditComplete     EventType = "audit.complete"
-	EventAuditHighRisk     EventType = "audit.high_risk"
-	EventRateLimitHit      EventType = "rate_limit.hit"
-	EventProviderFailover  EventType = "provider.failover"
+	EventPIIDetected         EventType = "pii.detected"
+	EventPIIHighRisk         EventType = "pii.high_risk"
+	EventPromptInjection     EventType = "prompt_injection.detected"
+	EventGuardrailViolation  EventType = "guardrail.violation"
+	EventAuditComplete       EventType = "audit.complete"
+	EventAuditHighRisk       EventType = "audit.high_risk"
+	EventRateLimitHit        EventType = "rate_limit.hit"
+	EventProviderFailover    EventType = "provider.failover"
+	EventCoverageGap         EventType = "detector.coverage_gap"
+	EventBreakGlassActivated EventType = "break_glass.activated"
+	EventBreakGlassExpired   EventType = "break_glass.expired"
+	EventSessionReplayDenied EventType = "session.replay_denied"
+	EventTokenInjection      EventType = "session.token_injection"
+	EventSessionEnded        EventType = "session.ended"
+	EventProtectionFailure   EventType = "protection.failure"
+	EventDataErased          EventType = "session.erased"
 )
 
+// knownEventTypes lists the event types a destination can receive
+var knownEventTypes = map[EventType]bool{
+	EventPIIDetected:         true,
+	EventPIIHighRisk:         true,
+	EventPromptInjection:     true,
+	EventGuardrailViolation:  true,
+	EventAuditComplete:       true,
+	EventAuditHighRisk:       true,
+	EventRateLimitHit:        true,
+	EventProviderFailover:    true,
+	EventCoverageGap:         true,
+	EventBreakGlassActivated: true,
+	EventBreakGlassExpired:   true,
+	EventSessionReplayDenied: true,
+	EventTokenInjection:      true,
+	EventSessionEnded:        true,
+	EventProtectionFailure:   true,
+	EventDataErased:          true,
+}
+
+// ValidEventType reports whether t is a known event type
+func ValidEventType(t EventType) bool {
+	return knownEventTypes[t]
+}
+
+// SchemaVersion is the version of the JSON body sent to custom webhook
+// destinations. The body is produced by buildPayload from a versioned struct
+// (payloadV2); any change to that shape — a new, renamed or removed field,
+// or a field whose meaning changes — must add a new payloadVN struct and
+// bump this constant so consumers can branch on schema_version.
+const SchemaVersion = "2"
+
 // Event is a webhook event payload
 type Event struct {
-	ID        string    `json:"id"`
-	Type      EventType `json:"type"`
-	Timestamp time.Time `json:"timestamp"`
-	SessionID string    `json:"session_id,omitempty"`
-	Data      any       `json:"data"`
+	SchemaVersion string    `json:"schema_version"`
+	ID            string    `json:"id"`
+	Type          EventType `json:"type"`
+	Timestamp     time.Time `json:"timestamp"`
+	SessionID     string    `json:"session_id,omitempty"`
+	Data          any       `json:"data"`
 }
 
+// payloadV2 is the wire format for SchemaVersion "2": version "1" plus
+// veil_version, the version of the proxy that sent the event. Do not
+// change it; add payloadV3 instead.
+type payloadV2 struct {
+	SchemaVersion string    `json:"schema_version"`
+	VeilVersion   string    `json:"veil_version"`
+	ID            string    `json:"id"`
+	Type          EventType `json:"type"`
+	Timestamp     time.Time `json:"timestamp"`
+	SessionID     string    `json:"session_id,omitempty"`
+	Data          any       `json:"data"`
+}
+
+// buildPayload encodes event in the current schema version
+func buildPayload(event Event) ([]byte, error) {
+	return json.Marshal(payloadV2{
+		SchemaVersion: SchemaVersion,
+		VeilVersion:   version.Get().Version,
+		ID:            event.ID,
+		Type:          event.Type,
+		Timestamp:     event.Timestamp,
+		SessionID:     event.SessionID,
+		Data:          event.Data,
+	})
+}
+
+// DeliveryResult is the outcome of a single synchronous delivery
+type DeliveryResult struct {
+	Destination string  `json:"destination"`
+	OK          bool    `json:"ok"`
+	StatusCode  int     `json:"status_code,omitempty"`
+	LatencyMs   float64 `json:"latency_ms"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// Destination types, selecting the wire format of a destination
+const (
+	DestinationGeneric     = "generic"     // Agent Veil JSON payload, signed with Secret
+	DestinationPagerDuty   = "pagerduty"   // PagerDuty Events API v2
+	DestinationCloudEvents = "cloudevents" // CloudEvents 1.0 HTTP binary mode
+)
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 endpoint, used when a
+// pagerduty destination has no URL
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
 // Destination defines where to send webhook events
 type Destination struct {
-	Name    string      `json:"name"`
-	URL     string      `json:"url"`
-	Secret  string      `json:"secret,omitempty"` // HMAC signing secret
-	Events  []EventType `json:"events"`           // empty = all events
-	Enabled bool        `json:"enabled"`
+	Name    string            `json:"name"`
+	Type    string            `json:"type,omitempty"` // empty = generic
+	URL     string            `json:"url"`
+	Secret  string            `json:"secret,omitempty"` // HMAC signing secret
+	Events  []EventType       `json:"events"`           // empty = all events
+	Enabled bool              `json:"enabled"`
 	Headers map[string]string `json:"headers,omitempty"`
+	// RoutingKey is the integration key of a pagerduty destination
+	RoutingKey string `json:"routing_key,omitempty"`
+	// Source is the ce-source of a cloudevents destination, "/agentveil"
+	// when empty
+	Source string `json:"source,omitempty"`
+	// Alerting, when set, sends only events that pass its thresholds
+	Alerting *AlertPolicy `json:"alerting,omitempty"`
+	// Concurrency is the number of deliveries in flight at once. When 0 it
+	// is Config.Concurrency, or 1 for Slack, Discord and destinations with
+	// Alerting, which then receive events in order.
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// endpoint returns the URL events are posted to
+func (d Destination) endpoint() string {
+	if d.URL == "" && d.Type == DestinationPagerDuty {
+		return PagerDutyEventsURL
+	}
+	return d.URL
 }
 
 // SlackConfig configures Slack webhook integration
 type SlackConfig struct {
-	WebhookURL string `json:"webhook_url"`
-	Channel    string `json:"channel,omitempty"`
-	Username   string `json:"username,omitempty"`
+	WebhookURL string       `json:"webhook_url"`
+	Channel    string       `json:"channel,omitempty"`
+	Username   string       `json:"username,omitempty"`
+	Alerting   *AlertPolicy `json:"alerting,omitempty"`
 }
 
 // DiscordConfig configures Discord webhook integration
 type DiscordConfig struct {
-	WebhookURL string `json:"webhook_url"`
+	WebhookURL string       `json:"webhook_url"`
+	Alerting   *AlertPolicy `json:"alerting,omitempty"`
 }
 
 // Config holds webhook dispatcher configuration
@@ -65,28 +180,122 @@ type Config struct {
 	Discord      *DiscordConfig `json:"discord,omitempty"`
 	RetryCount   int            `json:"retry_count"`
 	TimeoutSec   int            `json:"timeout_sec"`
-	BufferSize   int            `json:"buffer_size"`
+	BufferSize   int            `json:"buffer_size"` // queued events per destination
+	Concurrency  int            `json:"concurrency"` // workers per destination, 0 = DefaultConcurrency
 }
 
 // DefaultConfig returns sensible defaults
 func DefaultConfig() Config {
 	return Config{
-		RetryCount: 3,
-		TimeoutSec: 10,
-		BufferSize: 1000,
+		RetryCount:  3,
+		TimeoutSec:  10,
+		BufferSize:  1000,
+		Concurrency: DefaultConcurrency,
 	}
 }
 
-// Dispatcher sends webhook events to configured destinations
+// Validate checks that every destination has an absolute http(s) URL and
+// subscribes only to known event types
+func (c Config) Validate() error {
+	for _, d := range c.Destinations {
+		switch d.Type {
+		case "", DestinationGeneric, DestinationCloudEvents:
+		case DestinationPagerDuty:
+			if d.RoutingKey == "" {
+				return fmt.Errorf("destination %s: pagerduty requires a routing_key", d.Name)
+			}
+		default:
+			return fmt.Errorf("destination %s: unknown type %q (want generic, pagerduty or cloudevents)", d.Name, d.Type)
+		}
+		if err := validateURL(d.endpoint()); err != nil {
+			return fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+		for _, t := range d.Events {
+			if !ValidEventType(t) {
+				return fmt.Errorf("destination %s: unknown event type %q", d.Name, t)
+			}
+		}
+		if err := d.Alerting.validate(); err != nil {
+			return fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+		if d.Concurrency < 0 {
+			return fmt.Errorf("destination %s: concurrency must not be negative", d.Name)
+		}
+	}
+	if c.Slack != nil && c.Slack.WebhookURL != "" {
+		if err := validateURL(c.Slack.WebhookURL); err != nil {
+			return fmt.Errorf("slack: %w", err)
+		}
+		if err := c.Slack.Alerting.validate(); err != nil {
+			return fmt.Errorf("slack: %w", err)
+		}
+	}
+	if c.Discord != nil && c.Discord.WebhookURL != "" {
+		if err := validateURL(c.Discord.WebhookURL); err != nil {
+			return fmt.Errorf("discord: %w", err)
+		}
+		if err := c.Discord.Alerting.validate(); err != nil {
+			return fmt.Errorf("discord: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q: want an absolute http or https URL", raw)
+	}
+	return nil
+}
+
+// Dispatcher sends webhook events to configured destinations. Each enabled
+// destination has its own bounded queue and workers, so a slow or
+// rate-limited destination delays only its own events.
 type Dispatcher struct {
 	config       Config
 	destinations []Destination
 	client       *http.Client
-	eventChan    chan Event
-	wg           sync.WaitGroup
-	closed       chan struct{}
+	queues       []*destQueue
+
+	// digestTick is how often pending digests are checked
+	digestTick time.Duration
+	// retryBase is the first retry delay, doubled on each further attempt
+	retryBase time.Duration
+
+	// mu guards shut: Emit holds it for reading so no event is added to
+	// pending once Shutdown waits on it
+	mu      sync.RWMutex
+	shut    bool
+	pending sync.WaitGroup // accepted deliveries not yet done
+	workers sync.WaitGroup
+	closed  chan struct{} // closed when Shutdown starts
+	stop    chan struct{} // closed when the workers should exit
+	once    sync.Once
+
+	// ctx is cancelled when a shutdown deadline passes, aborting
+	// deliveries and retry waits still in progress
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
+// DefaultCloseTimeout bounds how long Close waits for pending events
+const DefaultCloseTimeout = 5 * time.Second
+
+// DefaultConcurrency is the number of workers per destination
+const DefaultConcurrency = 2
+
+// Retry delays: exponential from retryBase up to maxBackoff, and at most
+// maxRetryAfter when a destination asks for more with Retry-After
+const (
+	defaultRetryBase = time.Second
+	maxBackoff       = time.Minute
+	maxRetryAfter    = 5 * time.Minute
+)
+
 // NewDispatcher creates a webhook dispatcher
 func NewDispatcher(cfg Config) *Dispatcher {
 	d := &Dispatcher{
@@ -95,96 +304,188 @@ func NewDispatcher(cfg Config) *Dispatcher {
 		client: &http.Client{
 			Timeout: time.Duration(cfg.TimeoutSec) * time.Second,
 		},
-		eventChan: make(chan Event, cfg.BufferSize),
+		retryBase: defaultRetryBase,
 		closed:    make(chan struct{}),
+		stop:      make(chan struct{}),
 	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
 
 	// Add Slack as a destination if configured
 	if cfg.Slack != nil && cfg.Slack.WebhookURL != "" {
 		d.destinations = append(d.destinations, Destination{
-			Name:    "slack",
-			URL:     cfg.Slack.WebhookURL,
-			Events:  nil, // all events
-			Enabled: true,
+			Name:     "slack",
+			URL:      cfg.Slack.WebhookURL,
+			Events:   nil, // all events
+			Enabled:  true,
+			Alerting: cfg.Slack.Alerting,
 		})
 	}
 
 	// Add Discord as a destination if configured
 	if cfg.Discord != nil && cfg.Discord.WebhookURL != "" {
 		d.destinations = append(d.destinations, Destination{
-			Name:    "discord",
-			URL:     cfg.Discord.WebhookURL,
-			Events:  nil, // all events
-			Enabled: true,
+			Name:     "discord",
+			URL:      cfg.Discord.WebhookURL,
+			Events:   nil, // all events
+			Enabled:  true,
+			Alerting: cfg.Discord.Alerting,
 		})
 	}
 
-	// Start worker
-	d.wg.Add(1)
-	go d.worker()
+	for _, dest := range d.destinations {
+		if !dest.Enabled {
+			continue
+		}
+		q := newDestQueue(dest, cfg)
+		d.queues = append(d.queues, q)
+		if dest.Alerting != nil {
+			if sec := dest.Alerting.DigestSec; sec > 0 && (d.digestTick == 0 || time.Duration(sec)*time.Second < d.digestTick) {
+				d.digestTick = time.Duration(sec) * time.Second
+			}
+		}
+		for range q.concurrency {
+			d.workers.Add(1)
+			go d.work(q)
+		}
+	}
+	if d.digestTick > 0 {
+		d.workers.Add(1)
+		go d.digests()
+	}
 
 	return d
 }
 
-// Emit sends an event to all matching destinations
-func (d *Dispatcher) Emit(event Event) {
+// Destinations returns the configured destinations, including Slack and Discord
+func (d *Dispatcher) Destinations() []Destination {
+	return append([]Destination(nil), d.destinations...)
+}
+
+// Stats returns the delivery counters of each enabled destination
+func (d *Dispatcher) Stats() []DestinationStats {
+	stats := make([]DestinationStats, 0, len(d.queues))
+	for _, q := range d.queues {
+		stats = append(stats, q.stats())
+	}
+	return stats
+}
+
+// fillDefaults stamps ID, timestamp and schema version on an outgoing event
+func fillDefaults(event *Event) {
 	if event.Timestamp.IsZero() {
 		event.Timestamp = time.Now()
 	}
 	if event.ID == "" {
 		event.ID = fmt.Sprintf("evt_%d", time.Now().UnixNano())
 	}
+	event.SchemaVersion = SchemaVersion
+}
 
-	select {
-	case d.eventChan <- event:
-	default:
-		slog.Warn("webhook: event buffer full, dropping event", "type", event.Type)
+// Emit queues an event for every matching destination. A destination whose
+// queue is full drops it and counts the drop; events emitted after
+// Shutdown are dropped.
+func (d *Dispatcher) Emit(event Event) {
+	fillDefaults(&event)
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.shut {
+		slog.Debug("webhook: dispatcher closed, dropping event", "type", event.Type)
+		return
+	}
+	now := time.Now()
+	for _, q := range d.queues {
+		if matchesEvent(q.dest.Events, event.Type) {
+			q.offer(d, event, now)
+		}
 	}
 }
 
-// Close stops the dispatcher and waits for pending events
+// Close stops the dispatcher and waits up to DefaultCloseTimeout for
+// pending events
 func (d *Dispatcher) Close() {
-	close(d.closed)
-	d.wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultCloseTimeout)
+	defer cancel()
+	d.Shutdown(ctx)
+}
+
+// Shutdown stops accepting events, sends pending digests and delivers what
+// is queued, retries included, until ctx ends. Past that, in-progress
+// deliveries and retry waits are aborted, the rest of the queues is
+// dropped and ctx's error is returned.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.shut {
+		d.shut = true
+		close(d.closed)
+		// Pending digests go out on the way out, whatever their schedule
+		d.flushDigests(true)
+	}
+	d.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		queued := 0
+		for _, q := range d.queues {
+			queued += int(q.size.Load())
+		}
+		slog.Warn("webhook: shutdown deadline passed, dropping events", "count", queued)
+		d.cancel()
+		<-drained
+		err = ctx.Err()
+	}
+	d.cancel()
+	d.once.Do(func() { close(d.stop) })
+	d.workers.Wait()
+	return err
 }
 
-func (d *Dispatcher) worker() {
-	defer d.wg.Done()
+// work delivers the events of q until the dispatcher stops
+func (d *Dispatcher) work(q *destQueue) {
+	defer d.workers.Done()
 	for {
 		select {
-		case event := <-d.eventChan:
-			d.dispatch(event)
-		case <-d.closed:
-			// Drain remaining events
-			for {
-				select {
-				case event := <-d.eventChan:
-					d.dispatch(event)
-				default:
-					return
-				}
-			}
+		case dl := <-q.ready:
+			d.attempt(q, dl)
+		case <-d.stop:
+			return
 		}
 	}
 }
 
-func (d *Dispatcher) dispatch(event Event) {
-	for _, dest := range d.destinations {
-		if !dest.Enabled {
-			continue
-		}
-		if !matchesEvent(dest.Events, event.Type) {
-			continue
+// digests sends the digests that are due every digestTick
+func (d *Dispatcher) digests() {
+	defer d.workers.Done()
+	ticker := time.NewTicker(d.digestTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.mu.RLock()
+			if !d.shut {
+				d.flushDigests(false)
+			}
+			d.mu.RUnlock()
+		case <-d.closed:
+			return
 		}
+	}
+}
 
-		switch dest.Name {
-		case "slack":
-			d.sendSlack(dest, event)
-		case "discord":
-			d.sendDiscord(dest, event)
-		default:
-			d.sendWebhook(dest, event)
-		}
+// flushDigests queues the digests that are due, or every pending one when
+// force is set. The caller holds d.mu.
+func (d *Dispatcher) flushDigests(force bool) {
+	now := time.Now()
+	for _, q := range d.queues {
+		q.flushDigest(d, now, force)
 	}
 }
 
@@ -200,103 +501,182 @@ func matchesEvent(filter []EventType, eventType EventType) bool {
 	return false
 }
 
-func (d *Dispatcher) sendWebhook(dest Destination, event Event) {
-	payload, err := json.Marshal(event)
-	if err != nil {
-		slog.Error("webhook: marshal error", "error", err)
+// attempt makes one delivery attempt. A failed attempt that may be retried
+// waits for its delay off the queue and is then queued again, so the
+// workers carry on with the next events meanwhile.
+func (d *Dispatcher) attempt(q *destQueue, dl delivery) {
+	if d.ctx.Err() != nil {
+		q.done(d, &q.dropped)
 		return
 	}
-
-	for attempt := 0; attempt <= d.config.RetryCount; attempt++ {
-		req, err := http.NewRequest(http.MethodPost, dest.URL, bytes.NewReader(payload))
-		if err != nil {
-			slog.Error("webhook: request error", "dest", dest.Name, "error", err)
-			return
+	status, err := d.deliver(q.dest, dl.event)
+	if err == nil {
+		slog.Debug("webhook: delivered", "dest", q.dest.Name, "event", dl.event.Type)
+		q.done(d, &q.delivered)
+		return
+	}
+	if isBuildError(err) {
+		slog.Error("webhook: request error", "dest", q.dest.Name, "error", err)
+		q.done(d, &q.failed)
+		return
+	}
+	dl.attempts++
+	slog.Warn("webhook: delivery failed", "dest", q.dest.Name, "status", status, "attempt", dl.attempts, "error", err)
+	delay, ok := d.retryDelay(q, dl.attempts, err)
+	if !ok || d.ctx.Err() != nil {
+		q.done(d, &q.failed)
+		return
+	}
+	q.retried.Add(1)
+	go func() {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			q.ready <- dl
+		case <-d.ctx.Done():
+			timer.Stop()
+			q.done(d, &q.dropped)
 		}
+	}()
+}
 
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("User-Agent", "AgentVeil-Webhook/1.0")
-		req.Header.Set("X-Veil-Event", string(event.Type))
-		req.Header.Set("X-Veil-Delivery", event.ID)
-
-		// HMAC signature
-		if dest.Secret != "" {
-			sig := signPayload(payload, dest.Secret)
-			req.Header.Set("X-Veil-Signature", "sha256="+sig)
-		}
+// retryDelay returns how long to wait before retrying a delivery that
+// failed attempts times with err, and false when it is not retried.
+// Slack and Discord are only retried on 429, since any other failure
+// might still have posted the message.
+func (d *Dispatcher) retryDelay(q *destQueue, attempts int, err error) (time.Duration, bool) {
+	if attempts > d.config.RetryCount {
+		return 0, false
+	}
+	var se statusError
+	isStatus := errors.As(err, &se)
+	if q.chat() && (!isStatus || se.status != http.StatusTooManyRequests) {
+		return 0, false
+	}
+	if isStatus && se.after > 0 {
+		return min(se.after, maxRetryAfter), true
+	}
+	backoff := min(d.retryBase<<(attempts-1), maxBackoff)
+	// Jitter keeps destinations that failed together from retrying together
+	return backoff/2 + time.Duration(rand.Int64N(int64(backoff/2)+1)), true
+}
 
-		// Custom headers
-		for k, v := range dest.Headers {
-			req.Header.Set(k, v)
-		}
+// SendNow delivers event to dest synchronously with a single attempt,
+// bypassing the async queue and the destination's event filter. It is
+// meant for operator checks such as POST /admin/webhooks/test.
+func (d *Dispatcher) SendNow(dest Destination, event Event) DeliveryResult {
+	fillDefaults(&event)
+
+	start := time.Now()
+	status, err := d.deliver(dest, event)
+	result := DeliveryResult{
+		Destination: dest.Name,
+		OK:          err == nil,
+		StatusCode:  status,
+		LatencyMs:   float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
 
-		resp, err := d.client.Do(req)
-		if err != nil {
-			slog.Warn("webhook: delivery failed", "dest", dest.Name, "attempt", attempt+1, "error", err)
-			if attempt < d.config.RetryCount {
-				time.Sleep(time.Duration(attempt+1) * time.Second)
-			}
-			continue
-		}
-		resp.Body.Close()
+// buildError marks failures that happen before anything is sent
+type buildError struct{ err error }
 
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			slog.Debug("webhook: delivered", "dest", dest.Name, "event", event.Type)
-			return
-		}
+func (e buildError) Error() string { return e.err.Error() }
 
-		slog.Warn("webhook: non-2xx response", "dest", dest.Name, "status", resp.StatusCode, "attempt", attempt+1)
-		if attempt < d.config.RetryCount {
-			time.Sleep(time.Duration(attempt+1) * time.Second)
-		}
-	}
+func isBuildError(err error) bool {
+	_, ok := err.(buildError)
+	return ok
 }
 
-func (d *Dispatcher) sendSlack(dest Destination, event Event) {
-	text := formatSlackMessage(event)
-	payload, _ := json.Marshal(map[string]string{
-		"text": text,
-	})
-
-	if d.config.Slack != nil && d.config.Slack.Channel != "" {
-		var m map[string]string
-		json.Unmarshal(payload, &m)
-		m["channel"] = d.config.Slack.Channel
-		if d.config.Slack.Username != "" {
-			m["username"] = d.config.Slack.Username
-		}
-		payload, _ = json.Marshal(m)
+// deliver makes one delivery attempt and returns the response status
+func (d *Dispatcher) deliver(dest Destination, event Event) (int, error) {
+	req, err := d.newRequest(dest, event)
+	if err != nil {
+		return 0, buildError{err}
 	}
 
-	resp, err := d.client.Post(dest.URL, "application/json", bytes.NewReader(payload))
+	resp, err := d.client.Do(req.WithContext(d.ctx))
 	if err != nil {
-		slog.Warn("webhook: slack delivery failed", "error", err)
-		return
+		return 0, err
 	}
 	resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		slog.Warn("webhook: slack non-200", "status", resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := statusError{status: resp.StatusCode}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			err.after = retryAfter(resp.Header, time.Now())
+		}
+		return resp.StatusCode, err
 	}
+	return resp.StatusCode, nil
 }
 
-func (d *Dispatcher) sendDiscord(dest Destination, event Event) {
-	payload, err := json.Marshal(formatDiscordMessage(event))
+// newRequest builds the HTTP request for dest in its native format
+func (d *Dispatcher) newRequest(dest Destination, event Event) (*http.Request, error) {
+	var payload []byte
+	var err error
+	switch {
+	case dest.Name == "slack":
+		payload, err = d.slackPayload(event)
+	case dest.Name == "discord":
+		payload, err = json.Marshal(formatDiscordMessage(event))
+	case dest.Type == DestinationPagerDuty:
+		payload, err = json.Marshal(formatPagerDutyEvent(event, dest.RoutingKey))
+	default:
+		payload, err = buildPayload(event)
+	}
 	if err != nil {
-		slog.Error("webhook: discord marshal error", "error", err)
-		return
+		return nil, fmt.Errorf("marshal: %w", err)
 	}
 
-	resp, err := d.client.Post(dest.URL, "application/json", bytes.NewReader(payload))
+	req, err := http.NewRequest(http.MethodPost, dest.endpoint(), bytes.NewReader(payload))
 	if err != nil {
-		slog.Warn("webhook: discord delivery failed", "error", err)
-		return
+		return nil, err
 	}
-	resp.Body.Close()
+	req.Header.Set("Content-Type", "application/json")
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		slog.Warn("webhook: discord non-2xx", "status", resp.StatusCode)
+	if dest.Name == "slack" || dest.Name == "discord" {
+		return req, nil
+	}
+
+	req.Header.Set("User-Agent", "AgentVeil-Webhook/1.0")
+	switch dest.Type {
+	case DestinationPagerDuty:
+		return req, nil
+	case DestinationCloudEvents:
+		setCloudEventHeaders(req.Header, event, dest.Source)
+	}
+	req.Header.Set("X-Veil-Event", string(event.Type))
+	req.Header.Set("X-Veil-Delivery", event.ID)
+	req.Header.Set("X-Veil-Schema-Version", SchemaVersion)
+
+	// HMAC signature
+	if dest.Secret != "" {
+		sig := signPayload(payload, dest.Secret)
+		req.Header.Set("X-Veil-Signature", "sha256="+sig)
+	}
+
+	// Custom headers
+	for k, v := range dest.Headers {
+		req.Header.Set(k, v)
 	}
+	return req, nil
+}
+
+func (d *Dispatcher) slackPayload(event Event) ([]byte, error) {
+	m := map[string]string{
+		"text": formatSlackMessage(event),
+	}
+	if d.config.Slack != nil && d.config.Slack.Channel != "" {
+		m["channel"] = d.config.Slack.Channel
+		if d.config.Slack.Username != "" {
+			m["username"] = d.config.Slack.Username
+		}
+	}
+	return json.Marshal(m)
 }
 
 // discordPayload is the Discord webhook JSON structure
@@ -306,10 +686,11 @@ type discordPayload struct {
 }
 
 type discordEmbed struct {
-	Title  string         `json:"title"`
-	Color  int            `json:"color"`
-	Fields []discordField `json:"fields"`
-	Footer *discordFooter `json:"footer,omitempty"`
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+	Footer      *discordFooter `json:"footer,omitempty"`
 }
 
 type discordField struct {
@@ -328,14 +709,23 @@ func formatDiscordMessage(event Event) discordPayload {
 	// Red for high risk, yellow for PII detected, blue for others
 	color := 3447003 // blue
 	switch event.Type {
-	case EventPIIHighRisk, EventAuditHighRisk, EventGuardrailViolation:
+	case EventPIIHighRisk, EventAuditHighRisk, EventGuardrailViolation, EventBreakGlassActivated, EventSessionReplayDenied, EventTokenInjection:
 		color = 15158332 // red
 	case EventPIIDetected, EventPromptInjection, EventRateLimitHit:
 		color = 15844367 // yellow
-	case EventProviderFailover:
+	case EventProviderFailover, EventBreakGlassExpired:
 		color = 3066993 // green
 	}
 
+	footer := &discordFooter{
+		Text: fmt.Sprintf("Agent Veil • %s", event.Timestamp.Format("2006-01-02 15:04:05 UTC")),
+	}
+	if digest, ok := event.Data.(Digest); ok {
+		return discordPayload{
+			Embeds: []discordEmbed{{Title: title, Description: formatDigest(digest), Color: color, Fields: []discordField{}, Footer: footer}},
+		}
+	}
+
 	data, _ := json.Marshal(event.Data)
 
 	fields := []discordField{
@@ -350,9 +740,7 @@ func formatDiscordMessage(event Event) discordPayload {
 				Title:  title,
 				Color:  color,
 				Fields: fields,
-				Footer: &discordFooter{
-					Text: fmt.Sprintf("Agent Veil • %s", event.Timestamp.Format("2006-01-02 15:04:05 UTC")),
-				},
+				Footer: footer,
 			},
 		},
 	}
@@ -371,6 +759,16 @@ func formatSlackMessage(event Event) string {
 		emoji = "❌"
 	case EventProviderFailover:
 		emoji = "🔄"
+	case EventBreakGlassActivated:
+		emoji = "🔓"
+	case EventBreakGlassExpired:
+		emoji = "🔒"
+	case EventSessionReplayDenied, EventTokenInjection:
+		emoji = "🕵️"
+	}
+
+	if digest, ok := event.Data.(Digest); ok {
+		return fmt.Sprintf("📋 *[Agent Veil]* `%s`\n%s", event.Type, formatDigest(digest))
 	}
 
 	data, _ := json.MarshalIndent(event.Data, "", "  ")
@@ -378,6 +776,75 @@ func formatSlackMessage(event Event) string {
 		emoji, event.Type, event.SessionID, event.Timestamp.Format("15:04:05"), string(data))
 }
 
+// pagerDutyEvent is a PagerDuty Events API v2 trigger
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string `json:"summary"`
+	Source        string `json:"source"`
+	Severity      string `json:"severity"`
+	Timestamp     string `json:"timestamp"`
+	Component     string `json:"component"`
+	Class         string `json:"class"`
+	CustomDetails any    `json:"custom_details,omitempty"`
+}
+
+// pagerDutySeverity pages for high-risk findings; everything else is a
+// warning
+func pagerDutySeverity(t EventType) string {
+	switch t {
+	case EventPIIHighRisk, EventAuditHighRisk:
+		return "critical"
+	}
+	return "warning"
+}
+
+// formatPagerDutyEvent builds a trigger whose dedup_key is the session and
+// event type, so repeats update the open incident instead of paging again
+func formatPagerDutyEvent(event Event, routingKey string) pagerDutyEvent {
+	dedup := "agentveil:" + string(event.Type)
+	summary := fmt.Sprintf("[Agent Veil] %s", event.Type)
+	if event.SessionID != "" {
+		dedup += ":" + event.SessionID
+		summary += " in session " + event.SessionID
+	}
+	return pagerDutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "trigger",
+		DedupKey:    dedup,
+		Payload: pagerDutyPayload{
+			Summary:       summary,
+			Source:        "agentveil",
+			Severity:      pagerDutySeverity(event.Type),
+			Timestamp:     event.Timestamp.UTC().Format(time.RFC3339),
+			Component:     "agentveil",
+			Class:         string(event.Type),
+			CustomDetails: event.Data,
+		},
+	}
+}
+
+// setCloudEventHeaders adds the CloudEvents 1.0 binary-mode attributes of
+// event; the body is the event itself
+func setCloudEventHeaders(h http.Header, event Event, source string) {
+	if source == "" {
+		source = "/agentveil"
+	}
+	h.Set("ce-specversion", "1.0")
+	h.Set("ce-id", event.ID)
+	h.Set("ce-type", string(event.Type))
+	h.Set("ce-source", source)
+	h.Set("ce-time", event.Timestamp.UTC().Format(time.RFC3339Nano))
+	if event.SessionID != "" {
+		h.Set("ce-subject", event.SessionID)
+	}
+}
+
 // signPayload creates an HMAC-SHA256 signature
 func signPayload(payload []byte, secret string) string {
 	mac := hmac.New(sha256.New, []byte(secret))
@@ -1,12 +1,21 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/vurakit/agentveil/internal/version"
+	"github.com/vurakit/agentveil/pkg/pii"
 )
 
 func TestDispatcher_EmitAndDeliver(t *testing.T) {
@@ -174,6 +183,208 @@ func TestDispatcher_CustomHeaders(t *testing.T) {
 	}
 }
 
+func TestDispatcher_ShutdownDrainsQueue(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.Destinations = []Destination{{Name: "test", URL: server.URL, Enabled: true}}
+	d := NewDispatcher(cfg)
+	for range 3 {
+		d.Emit(Event{Type: EventPIIDetected})
+	}
+
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if received.Load() != 3 {
+		t.Errorf("expected 3 deliveries, got %d", received.Load())
+	}
+	d.Close() // safe after Shutdown
+}
+
+func TestDispatcher_ShutdownDeadline(t *testing.T) {
+	var received atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := DefaultConfig()
+	cfg.Destinations = []Destination{{Name: "stuck", URL: server.URL, Enabled: true}}
+	cfg.TimeoutSec = 30
+	cfg.RetryCount = 3
+	cfg.Concurrency = 1
+	d := NewDispatcher(cfg)
+	for range 3 {
+		d.Emit(Event{Type: EventPIIDetected})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := d.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %v, want it bounded by the deadline", elapsed)
+	}
+	// The stuck delivery is aborted; neither its retries nor the queued
+	// events are attempted
+	if n := received.Load(); n != 1 {
+		t.Errorf("expected 1 delivery attempt, got %d", n)
+	}
+}
+
+func TestDispatcher_StalledDestinationIsolated(t *testing.T) {
+	release := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer stalled.Close()
+	var received atomic.Int32
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer fast.Close()
+
+	cfg := DefaultConfig()
+	cfg.TimeoutSec = 30
+	cfg.Destinations = []Destination{
+		{Name: "stalled", URL: stalled.URL, Enabled: true},
+		{Name: "fast", URL: fast.URL, Enabled: true},
+	}
+	d := NewDispatcher(cfg)
+	for range 100 {
+		d.Emit(Event{Type: EventPIIDetected})
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for received.Load() < 100 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := received.Load(); n != 100 {
+		t.Fatalf("fast destination received %d of 100 events while the other stalled", n)
+	}
+	for _, st := range d.Stats() {
+		if st.Name == "stalled" && st.Queued != 100 {
+			t.Errorf("stalled destination stats = %+v", st)
+		}
+	}
+	close(release)
+	d.Close()
+}
+
+func TestDispatcher_DropsWhenQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.BufferSize = 2
+	cfg.Destinations = []Destination{{Name: "slow", URL: server.URL, Enabled: true}}
+	d := NewDispatcher(cfg)
+	for range 5 {
+		d.Emit(Event{Type: EventPIIDetected})
+	}
+	close(release)
+	d.Close()
+
+	st := d.Stats()
+	if len(st) != 1 || st[0].Dropped != 3 || st[0].Delivered != 2 || st[0].Queued != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestDispatcher_RetryAfter(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		n := len(attempts)
+		mu.Unlock()
+		if n < 3 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.Discord = &DiscordConfig{WebhookURL: server.URL}
+	d := NewDispatcher(cfg)
+	d.Emit(Event{Type: EventPIIDetected})
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(attempts))
+	}
+	for i := 1; i < len(attempts); i++ {
+		if gap := attempts[i].Sub(attempts[i-1]); gap < time.Second {
+			t.Errorf("attempt %d came %v after the 429, before its Retry-After", i+1, gap)
+		}
+	}
+	if st := d.Stats()[0]; st.Delivered != 1 || st.Retried != 2 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestDispatcher_RetryDelay(t *testing.T) {
+	cfg := DefaultConfig()
+	d := &Dispatcher{config: cfg, retryBase: time.Second}
+	custom := newDestQueue(Destination{Name: "siem"}, cfg)
+	slack := newDestQueue(Destination{Name: "slack"}, cfg)
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second} {
+		delay, ok := d.retryDelay(custom, attempts, statusError{status: http.StatusBadGateway})
+		if !ok || delay < want/2 || delay > want {
+			t.Errorf("attempt %d: delay %v, want jittered within [%v, %v]", attempts, delay, want/2, want)
+		}
+	}
+	if _, ok := d.retryDelay(custom, 4, statusError{status: http.StatusBadGateway}); ok {
+		t.Error("retried past RetryCount")
+	}
+	if delay, ok := d.retryDelay(custom, 1, statusError{status: http.StatusTooManyRequests, after: time.Hour}); !ok || delay != maxRetryAfter {
+		t.Errorf("Retry-After delay = %v, %v", delay, ok)
+	}
+	if _, ok := d.retryDelay(slack, 1, statusError{status: http.StatusInternalServerError}); ok {
+		t.Error("slack retried on a 500")
+	}
+	if _, ok := d.retryDelay(slack, 1, statusError{status: http.StatusTooManyRequests}); !ok {
+		t.Error("slack not retried on a 429")
+	}
+
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	for raw, want := range map[string]time.Duration{
+		"30": 30 * time.Second, "": 0, "soon": 0,
+		now.Add(time.Minute).Format(http.TimeFormat): time.Minute,
+	} {
+		if got := retryAfter(http.Header{"Retry-After": {raw}}, now); got != want {
+			t.Errorf("Retry-After %q = %v, want %v", raw, got, want)
+		}
+	}
+}
+
 func TestDispatcher_SlackWebhook(t *testing.T) {
 	var receivedBody map[string]string
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -367,6 +578,33 @@ func TestDefaultConfig(t *testing.T) {
 	}
 }
 
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"empty", Config{}, false},
+		{"valid destination", Config{Destinations: []Destination{{Name: "siem", URL: "https://siem.example.com/hook", Events: []EventType{EventPIIHighRisk}}}}, false},
+		{"relative URL", Config{Destinations: []Destination{{Name: "siem", URL: "/hook"}}}, true},
+		{"bad scheme", Config{Destinations: []Destination{{Name: "siem", URL: "ftp://siem.example.com"}}}, true},
+		{"unknown event", Config{Destinations: []Destination{{Name: "siem", URL: "https://siem.example.com", Events: []EventType{"pii.detcted"}}}}, true},
+		{"bad slack URL", Config{Slack: &SlackConfig{WebhookURL: "hooks.slack.com/x"}}, true},
+		{"valid discord", Config{Discord: &DiscordConfig{WebhookURL: "https://discord.com/api/webhooks/1/abc"}}, false},
+		{"pagerduty default URL", Config{Destinations: []Destination{{Name: "pd", Type: DestinationPagerDuty, RoutingKey: "R0UT1NG"}}}, false},
+		{"pagerduty without routing key", Config{Destinations: []Destination{{Name: "pd", Type: DestinationPagerDuty}}}, true},
+		{"cloudevents without URL", Config{Destinations: []Destination{{Name: "ce", Type: DestinationCloudEvents}}}, true},
+		{"unknown type", Config{Destinations: []Destination{{Name: "x", Type: "opsgenie", URL: "https://x.example.com"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func containsAll(s string, substrs ...string) bool {
 	for _, sub := range substrs {
 		if !contains(s, sub) {
@@ -388,3 +626,398 @@ func searchString(s, substr string) bool {
 	}
 	return false
 }
+
+func TestBuildPayload_SchemaV2(t *testing.T) {
+	defer func(v string) { version.Version = v }(version.Version)
+	version.Version = "1.4.0"
+
+	payload, err := buildPayload(Event{
+		ID:        "evt_1",
+		Type:      EventPIIDetected,
+		Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		SessionID: "s1",
+		Data:      map[string]int{"count": 1},
+	})
+	if err != nil {
+		t.Fatalf("buildPayload: %v", err)
+	}
+
+	var fields map[string]json.RawMessage
+	json.Unmarshal(payload, &fields)
+	var keys []string
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Changing this list means a new schema version (see SchemaVersion)
+	want := "data,id,schema_version,session_id,timestamp,type,veil_version"
+	if got := strings.Join(keys, ","); got != want {
+		t.Errorf("v2 payload fields = %s, want %s", got, want)
+	}
+	if string(fields["schema_version"]) != `"2"` {
+		t.Errorf("expected schema_version \"2\", got %s", fields["schema_version"])
+	}
+	if string(fields["veil_version"]) != `"1.4.0"` {
+		t.Errorf("veil_version = %s, want the injected build version", fields["veil_version"])
+	}
+}
+
+func TestSendNow(t *testing.T) {
+	var gotHeader http.Header
+	var gotBody []byte
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	cfg := DefaultConfig()
+	d := NewDispatcher(cfg)
+	defer d.Close()
+
+	res := d.SendNow(Destination{Name: "ok", URL: ok.URL, Secret: "s3cret", Enabled: true}, Event{Type: EventAuditHighRisk})
+	if !res.OK || res.StatusCode != http.StatusOK || res.Error != "" {
+		t.Errorf("expected successful delivery, got %+v", res)
+	}
+	if gotHeader.Get("X-Veil-Schema-Version") != SchemaVersion {
+		t.Errorf("expected schema version header, got %q", gotHeader.Get("X-Veil-Schema-Version"))
+	}
+	if !VerifySignature(gotBody, gotHeader.Get("X-Veil-Signature"), "s3cret") {
+		t.Error("expected valid HMAC signature on synchronous delivery")
+	}
+
+	res = d.SendNow(Destination{Name: "failing", URL: failing.URL, Enabled: true}, Event{Type: EventAuditHighRisk})
+	if res.OK || res.StatusCode != http.StatusInternalServerError || res.Error == "" {
+		t.Errorf("expected 500 failure, got %+v", res)
+	}
+
+	res = d.SendNow(Destination{Name: "unreachable", URL: "http://127.0.0.1:1", Enabled: true}, Event{Type: EventAuditHighRisk})
+	if res.OK || res.StatusCode != 0 || res.Error == "" {
+		t.Errorf("expected connection error, got %+v", res)
+	}
+}
+
+func TestTestHandler(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		var event Event
+		json.NewDecoder(r.Body).Decode(&event)
+		if event.Type != EventPromptInjection || event.SchemaVersion != SchemaVersion {
+			t.Errorf("unexpected synthetic event: %+v", event)
+		}
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.Destinations = []Destination{
+		{Name: "a", URL: server.URL, Enabled: true, Events: []EventType{EventAuditComplete}},
+		{Name: "b", URL: "http://127.0.0.1:1", Enabled: true},
+	}
+	d := NewDispatcher(cfg)
+	defer d.Close()
+	handler := d.TestHandler()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantOK     []bool
+	}{
+		{"all destinations", `{"type":"prompt_injection.detected"}`, http.StatusOK, []bool{true, false}},
+		{"single destination", `{"type":"prompt_injection.detected","destination":"a"}`, http.StatusOK, []bool{true}},
+		{"unknown destination", `{"type":"prompt_injection.detected","destination":"zzz"}`, http.StatusNotFound, nil},
+		{"unknown type", `{"type":"nope"}`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/webhooks/test", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantOK == nil {
+				return
+			}
+			var resp TestResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if len(resp.Results) != len(tt.wantOK) {
+				t.Fatalf("expected %d results, got %+v", len(tt.wantOK), resp.Results)
+			}
+			for i, want := range tt.wantOK {
+				if resp.Results[i].OK != want {
+					t.Errorf("result %d: ok=%v, want %v (%+v)", i, resp.Results[i].OK, want, resp.Results[i])
+				}
+			}
+		})
+	}
+
+	if hits.Load() != 2 {
+		t.Errorf("expected event filter to be bypassed for test sends, got %d hits", hits.Load())
+	}
+}
+
+// recordingServer collects the events delivered to it
+func recordingServer(t *testing.T) (*httptest.Server, func() []Event) {
+	t.Helper()
+	var mu sync.Mutex
+	var events []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Event(nil), events...)
+	}
+}
+
+func piiEvent(session string, count int, categories ...pii.Category) Event {
+	return Event{
+		Type:      EventPIIDetected,
+		SessionID: session,
+		Data:      map[string]any{"count": count, "categories": categories, "source": "proxy"},
+	}
+}
+
+func TestAlerting_ThresholdPerDestination(t *testing.T) {
+	siem, siemEvents := recordingServer(t)
+	chat, chatEvents := recordingServer(t)
+
+	cfg := DefaultConfig()
+	cfg.Destinations = []Destination{
+		{Name: "siem", URL: siem.URL, Enabled: true},
+		{Name: "chat", URL: chat.URL, Enabled: true, Alerting: &AlertPolicy{
+			Rules: map[EventType]AlertRule{EventPIIDetected: {MinCount: 3}},
+		}},
+	}
+	d := NewDispatcher(cfg)
+	d.Emit(piiEvent("s1", 1, pii.CatEmail))
+	d.Emit(piiEvent("s2", 4, pii.CatEmail, pii.CatPhone, pii.CatPhone, pii.CatCCCD))
+	d.Emit(piiEvent("s3", 1, pii.Category("SECRET_OPENAI_KEY")))
+	d.Emit(Event{Type: EventPromptInjection, SessionID: "s1"}) // no rule for this type
+	d.Close()
+
+	if n := len(siemEvents()); n != 4 {
+		t.Errorf("siem should receive every event, got %d", n)
+	}
+	got := chatEvents()
+	if len(got) != 3 {
+		t.Fatalf("chat should receive 3 events, got %d: %+v", len(got), got)
+	}
+	for _, e := range got {
+		if e.SessionID == "s1" && e.Type == EventPIIDetected {
+			t.Error("a single email is below the threshold")
+		}
+	}
+}
+
+func TestAlerting_Cooldown(t *testing.T) {
+	chat, chatEvents := recordingServer(t)
+	cfg := DefaultConfig()
+	cfg.Destinations = []Destination{
+		{Name: "chat", URL: chat.URL, Enabled: true, Alerting: &AlertPolicy{CooldownSec: 600}},
+	}
+	d := NewDispatcher(cfg)
+	for range 3 {
+		d.Emit(piiEvent("a", 1, pii.CatEmail))
+	}
+	d.Emit(piiEvent("b", 1, pii.CatEmail))
+	d.Emit(Event{Type: EventPromptInjection, SessionID: "a"})
+	d.Close()
+
+	counts := make(map[string]int)
+	for _, e := range chatEvents() {
+		counts[string(e.Type)+"/"+e.SessionID]++
+	}
+	want := map[string]int{"pii.detected/a": 1, "pii.detected/b": 1, "prompt_injection.detected/a": 1}
+	if len(counts) != len(want) {
+		t.Fatalf("deliveries = %v, want %v", counts, want)
+	}
+	for k, n := range want {
+		if counts[k] != n {
+			t.Errorf("%s: %d deliveries, want %d", k, counts[k], n)
+		}
+	}
+}
+
+func TestAlerting_DigestFlushedOnClose(t *testing.T) {
+	siem, siemEvents := recordingServer(t)
+	chat, chatEvents := recordingServer(t)
+	cfg := DefaultConfig()
+	cfg.Destinations = []Destination{
+		{Name: "siem", URL: siem.URL, Enabled: true},
+		{Name: "chat", URL: chat.URL, Enabled: true, Alerting: &AlertPolicy{
+			Rules:       map[EventType]AlertRule{EventPIIDetected: {SecretsOnly: true}},
+			CooldownSec: 600,
+			DigestSec:   3600,
+		}},
+	}
+	d := NewDispatcher(cfg)
+	d.Emit(piiEvent("a", 2, pii.CatEmail, pii.CatEmail))
+	d.Emit(piiEvent("b", 1, pii.CatPhone))
+	d.Emit(piiEvent("b", 1, pii.Category("SECRET_GITHUB_TOKEN")))
+	d.Emit(piiEvent("b", 1, pii.Category("SECRET_GITHUB_TOKEN"))) // cooled down
+	d.Close()
+
+	if n := len(siemEvents()); n != 4 {
+		t.Errorf("siem should receive every raw event, got %d", n)
+	}
+	got := chatEvents()
+	if len(got) != 2 || got[0].Type != EventPIIDetected || got[1].Type != EventDigest {
+		t.Fatalf("chat should get the secret alert then a digest, got %+v", got)
+	}
+	data, _ := json.Marshal(got[1].Data)
+	var digest Digest
+	json.Unmarshal(data, &digest)
+	if digest.Events[EventPIIDetected] != 3 || digest.Sessions != 2 ||
+		digest.Categories["EMAIL"] != 2 || digest.Categories["PHONE"] != 1 || digest.Categories["SECRET_GITHUB_TOKEN"] != 1 {
+		t.Errorf("digest = %+v", digest)
+	}
+}
+
+func TestAlertState_DigestSchedule(t *testing.T) {
+	a := newAlertState(AlertPolicy{Rules: map[EventType]AlertRule{EventPIIDetected: {MinCount: 5}}, DigestSec: 60})
+	t0 := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	if a.admit(piiEvent("a", 1, pii.CatEmail), t0) {
+		t.Fatal("event below MinCount admitted")
+	}
+	if _, ok := a.flush(t0.Add(30*time.Second), false); ok {
+		t.Error("digest flushed before its interval")
+	}
+	event, ok := a.flush(t0.Add(time.Minute), false)
+	if !ok || event.Type != EventDigest {
+		t.Fatalf("expected a digest once due, got %+v", event)
+	}
+	if _, ok := a.flush(t0.Add(2*time.Minute), true); ok {
+		t.Error("an empty digest must not be sent")
+	}
+
+	msg := formatSlackMessage(event)
+	if !strings.Contains(msg, "1 events below alert threshold from 1 sessions") || !strings.Contains(msg, "Categories: EMAIL: 1") {
+		t.Errorf("slack digest = %q", msg)
+	}
+}
+
+func TestConfig_ValidateAlerting(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Slack = &SlackConfig{WebhookURL: "https://hooks.slack.com/x", Alerting: &AlertPolicy{
+		Rules: map[EventType]AlertRule{"pii.leaked": {MinCount: 2}},
+	}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "unknown event type") {
+		t.Errorf("expected unknown event type error, got %v", err)
+	}
+	cfg.Slack.Alerting = &AlertPolicy{DigestSec: -1}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a negative digest interval")
+	}
+}
+
+// fixture records the last request it received
+func fixture(t *testing.T) (*httptest.Server, func() (http.Header, []byte)) {
+	t.Helper()
+	var mu sync.Mutex
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() (http.Header, []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		return header, body
+	}
+}
+
+func TestPagerDutyWireFormat(t *testing.T) {
+	srv, last := fixture(t)
+	d := NewDispatcher(DefaultConfig())
+	defer d.Close()
+	dest := Destination{Name: "pd", Type: DestinationPagerDuty, URL: srv.URL, RoutingKey: "R0UT1NG", Enabled: true}
+	ts := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	res := d.SendNow(dest, Event{ID: "evt_1", Type: EventPIIHighRisk, Timestamp: ts, SessionID: "sess-1", Data: map[string]int{"count": 2}})
+	if !res.OK {
+		t.Fatalf("delivery failed: %+v", res)
+	}
+	header, body := last()
+	want := `{"routing_key":"R0UT1NG","event_action":"trigger","dedup_key":"agentveil:pii.high_risk:sess-1",` +
+		`"payload":{"summary":"[Agent Veil] pii.high_risk in session sess-1","source":"agentveil","severity":"critical",` +
+		`"timestamp":"2026-03-04T05:06:07Z","component":"agentveil","class":"pii.high_risk","custom_details":{"count":2}}}`
+	if string(body) != want {
+		t.Errorf("body =\n%s\nwant\n%s", body, want)
+	}
+	if header.Get("Content-Type") != "application/json" || header.Get("X-Veil-Signature") != "" {
+		t.Errorf("headers = %v", header)
+	}
+
+	// Others are warnings; a repeat of the same session and type dedups
+	d.SendNow(dest, Event{ID: "evt_2", Type: EventPromptInjection, Timestamp: ts, SessionID: "sess-1"})
+	_, body = last()
+	var ev pagerDutyEvent
+	json.Unmarshal(body, &ev)
+	if ev.Payload.Severity != "warning" || ev.DedupKey != "agentveil:prompt_injection.detected:sess-1" {
+		t.Errorf("event = %+v", ev)
+	}
+	if ev := formatPagerDutyEvent(Event{Type: EventAuditHighRisk}, "k"); ev.Payload.Severity != "critical" || ev.DedupKey != "agentveil:audit.high_risk" {
+		t.Errorf("audit.high_risk without session = %+v", ev)
+	}
+}
+
+func TestCloudEventsWireFormat(t *testing.T) {
+	srv, last := fixture(t)
+	d := NewDispatcher(DefaultConfig())
+	defer d.Close()
+	dest := Destination{Name: "ce", Type: DestinationCloudEvents, URL: srv.URL, Source: "/agentveil/prod", Enabled: true}
+	event := Event{ID: "evt_1", Type: EventPIIDetected, Timestamp: time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC), SessionID: "sess-1", Data: map[string]int{"count": 1}}
+
+	if res := d.SendNow(dest, event); !res.OK {
+		t.Fatalf("delivery failed: %+v", res)
+	}
+	header, body := last()
+	for k, v := range map[string]string{
+		"Ce-Specversion": "1.0",
+		"Ce-Id":          "evt_1",
+		"Ce-Type":        "pii.detected",
+		"Ce-Source":      "/agentveil/prod",
+		"Ce-Time":        "2026-03-04T05:06:07Z",
+		"Ce-Subject":     "sess-1",
+		"Content-Type":   "application/json",
+	} {
+		if got := header.Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+	want := `{"schema_version":"2","veil_version":"`+version.Get().Version+`","id":"evt_1","type":"pii.detected","timestamp":"2026-03-04T05:06:07Z","session_id":"sess-1","data":{"count":1}}`
+	if string(body) != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+
+	// Without a session or source
+	dest.Source = ""
+	event.SessionID = ""
+	d.SendNow(dest, event)
+	header, _ = last()
+	if header.Get("Ce-Source") != "/agentveil" || header.Get("Ce-Subject") != "" {
+		t.Errorf("headers = %v", header)
+	}
+}
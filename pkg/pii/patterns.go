@@ -421,3 +421,30 @@ func PartialMask(s string) string {
 	}
 	return s[:visible] + strings.Repeat("*", n-visible)
 }
+
+// MaskValue hides ~70% of a value, keeping its length and a few characters
+// at each end: "012345678901" becomes "0xxxxxxxxx01"
+func MaskValue(val string) string {
+	runes := []rune(val)
+	n := len(runes)
+	if n <= 3 {
+		return val
+	}
+
+	visible := n * 30 / 100 // show ~30%
+	if visible < 2 {
+		visible = 2
+	}
+	front := visible / 2
+	back := visible - front
+
+	masked := make([]rune, n)
+	for i := range masked {
+		if i < front || i >= n-back {
+			masked[i] = runes[i]
+		} else {
+			masked[i] = 'x'
+		}
+	}
+	return string(masked)
+}
@@ -1,6 +1,9 @@
 package pii
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestSecretPatterns_Compile(t *testing.T) {
 	patterns := SecretPatterns()
@@ -149,3 +152,25 @@ func TestInternationalPatterns_Compile(t *testing.T) {
 		}
 	}
 }
+
+func TestMaskValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{"012345678901", "xx"},
+		{"abc", "abc"},         // too short to mask
+		{"test@example.com", "xx"},
+	}
+
+	for _, tt := range tests {
+		result := MaskValue(tt.input)
+		if !strings.Contains(result, tt.contains) {
+			t.Errorf("MaskValue(%q) = %q, expected to contain %q", tt.input, result, tt.contains)
+		}
+		// Masked value should be same length as original
+		if len([]rune(result)) != len([]rune(tt.input)) {
+			t.Errorf("MaskValue(%q) changed length: %d -> %d", tt.input, len([]rune(tt.input)), len([]rune(result)))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package pii
+
+import "time"
+
+// cccdProvinces maps the first three digits of a CCCD to the province or
+// centrally-run city of registration (Circular 07/2016/TT-BCA)
+var cccdProvinces = map[string]string{
+	"001": "Hà Nội", "002": "Hà Giang", "004": "Cao Bằng", "006": "Bắc Kạn",
+	"008": "Tuyên Quang", "010": "Lào Cai", "011": "Điện Biên", "012": "Lai Châu",
+	"014": "Sơn La", "015": "Yên Bái", "017": "Hòa Bình", "019": "Thái Nguyên",
+	"020": "Lạng Sơn", "022": "Quảng Ninh", "024": "Bắc Giang", "025": "Phú Thọ",
+	"026": "Vĩnh Phúc", "027": "Bắc Ninh", "030": "Hải Dương", "031": "Hải Phòng",
+	"033": "Hưng Yên", "034": "Thái Bình", "035": "Hà Nam", "036": "Nam Định",
+	"037": "Ninh Bình", "038": "Thanh Hóa", "040": "Nghệ An", "042": "Hà Tĩnh",
+	"044": "Quảng Bình", "045": "Quảng Trị", "046": "Thừa Thiên Huế", "048": "Đà Nẵng",
+	"049": "Quảng Nam", "051": "Quảng Ngãi", "052": "Bình Định", "054": "Phú Yên",
+	"056": "Khánh Hòa", "058": "Ninh Thuận", "060": "Bình Thuận", "062": "Kon Tum",
+	"064": "Gia Lai", "066": "Đắk Lắk", "067": "Đắk Nông", "068": "Lâm Đồng",
+	"070": "Bình Phước", "072": "Tây Ninh", "074": "Bình Dương", "075": "Đồng Nai",
+	"077": "Bà Rịa - Vũng Tàu", "079": "Hồ Chí Minh", "080": "Long An", "082": "Tiền Giang",
+	"083": "Bến Tre", "084": "Trà Vinh", "086": "Vĩnh Long", "087": "Đồng Tháp",
+	"089": "An Giang", "091": "Kiên Giang", "092": "Cần Thơ", "093": "Hậu Giang",
+	"094": "Sóc Trăng", "095": "Bạc Liêu", "096": "Cà Mau",
+}
+
+// Reasons returned by ValidateCCCD
+const (
+	CCCDBadFormat     = "not 12 digits"
+	CCCDUnknownRegion = "unknown province code"
+	CCCDBadCentury    = "invalid century/gender digit"
+	CCCDFutureBirth   = "birth year in the future"
+)
+
+// ValidateCCCD checks the structure of a 12-digit citizen ID: a known
+// province code, then a century/gender digit (0-1 for the 1900s, 2-3 for
+// the 2000s) and a two-digit birth year that together are not in the
+// future. The last six digits are random. It returns false with one of the
+// CCCD* reasons for an invalid number.
+func ValidateCCCD(s string) (bool, string) {
+	if len(s) != 12 || !allDigits(s) {
+		return false, CCCDBadFormat
+	}
+	if _, ok := cccdProvinces[s[:3]]; !ok {
+		return false, CCCDUnknownRegion
+	}
+
+	var century int
+	switch s[3] {
+	case '0', '1':
+		century = 1900
+	case '2', '3':
+		century = 2000
+	default:
+		// Codes 4-9 cover the 2100s onwards
+		return false, CCCDBadCentury
+	}
+	year := century + int(s[4]-'0')*10 + int(s[5]-'0')
+	if year > time.Now().Year() {
+		return false, CCCDFutureBirth
+	}
+	return true, ""
+}
+
+// CCCDProvince returns the province a CCCD was registered in, if its code
+// is known
+func CCCDProvince(s string) (string, bool) {
+	if len(s) < 3 {
+		return "", false
+	}
+	p, ok := cccdProvinces[s[:3]]
+	return p, ok
+}
+
+// tinWeights are the check-digit weights of a 10-digit tax code
+// (Decision 75/1998/QĐ-TCT)
+var tinWeights = [9]int{31, 29, 23, 19, 17, 13, 7, 5, 3}
+
+// ValidateTIN checks a Vietnamese tax code (mã số thuế). The 10-digit form
+// ends in a check digit: 10 - (Σ weight×digit mod 11), where a result of 10
+// is never issued. The 13-digit form is a 10-digit parent code followed by
+// a branch number from 001 to 999; a dash between the two is accepted.
+func ValidateTIN(s string) bool {
+	if len(s) == 14 && s[10] == '-' {
+		s = s[:10] + s[11:]
+	}
+	if (len(s) != 10 && len(s) != 13) || !allDigits(s) {
+		return false
+	}
+	if len(s) == 13 && s[10:] == "000" {
+		return false
+	}
+
+	sum := 0
+	for i, w := range tinWeights {
+		sum += w * int(s[i]-'0')
+	}
+	check := 10 - sum%11
+	return check < 10 && int(s[9]-'0') == check
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
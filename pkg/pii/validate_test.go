@@ -0,0 +1,66 @@
+package pii
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidateCCCD(t *testing.T) {
+	nextYear := fmt.Sprintf("%02d", (time.Now().Year()+1)%100)
+	tests := []struct {
+		id     string
+		valid  bool
+		reason string
+	}{
+		{"001089012345", true, ""},                 // Hà Nội, male, 1989
+		{"079203001234", true, ""},                 // Hồ Chí Minh, male, 2003
+		{"048195000789", true, ""},                 // Đà Nẵng, female, 1995
+		{"096300123456", true, ""},                 // Cà Mau, female, 2000
+		{"003089012345", false, CCCDUnknownRegion}, // 003 was never assigned
+		{"098765432101", false, CCCDUnknownRegion},
+		{"000089012345", false, CCCDUnknownRegion},
+		{"001489012345", false, CCCDBadCentury},
+		{"0012" + nextYear + "012345", false, CCCDFutureBirth},
+		{"01234567890", false, CCCDBadFormat},
+		{"0012890123a5", false, CCCDBadFormat},
+	}
+	for _, tt := range tests {
+		valid, reason := ValidateCCCD(tt.id)
+		if valid != tt.valid || reason != tt.reason {
+			t.Errorf("ValidateCCCD(%s) = %v, %q; want %v, %q", tt.id, valid, reason, tt.valid, tt.reason)
+		}
+	}
+
+	if p, ok := CCCDProvince("079203001234"); !ok || p != "Hồ Chí Minh" {
+		t.Errorf("CCCDProvince = %q, %v", p, ok)
+	}
+	if len(cccdProvinces) != 63 {
+		t.Errorf("expected 63 province codes, got %d", len(cccdProvinces))
+	}
+}
+
+func TestValidateTIN(t *testing.T) {
+	tests := []struct {
+		tin   string
+		valid bool
+	}{
+		{"0100109106", true}, // Viettel
+		{"0100686174", true}, // PetroVietnam
+		{"1234567893", true},
+		{"0100109106001", true},  // branch of a valid parent
+		{"0100109106-001", true}, // dashed branch form
+		{"0100109105", false},    // checksum
+		{"1234567890", false},    // checksum
+		{"0100109106000", false}, // branch 000 is the parent itself
+		{"0100109107001", false}, // invalid parent
+		{"0000000000", false},    // check digit would be 10
+		{"010010910", false},
+		{"01001091O6", false},
+	}
+	for _, tt := range tests {
+		if got := ValidateTIN(tt.tin); got != tt.valid {
+			t.Errorf("ValidateTIN(%s) = %v, want %v", tt.tin, got, tt.valid)
+		}
+	}
+}
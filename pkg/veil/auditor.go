@@ -0,0 +1,136 @@
+package veil
+
+import (
+	"context"
+
+	"github.com/vurakit/agentveil/internal/auditor"
+)
+
+// Report is the result of auditing a skill or agent instruction file
+type Report = auditor.Report
+
+// Finding is a single security issue in an audited file
+type Finding = auditor.Finding
+
+// ChainFinding is a dangerous sequence of actions, e.g. read secrets then send
+type ChainFinding = auditor.ChainFinding
+
+// ProjectReport is the result of auditing the files of a project together
+type ProjectReport = auditor.ProjectReport
+
+// CrossFileChain is a dangerous behavior chain spanning several files
+type CrossFileChain = auditor.CrossFileChain
+
+// ProjectOptions control which files a behavior chain may span
+type ProjectOptions = auditor.ProjectOptions
+
+// DiffReport is the risk delta between two versions of a skill
+type DiffReport = auditor.DiffReport
+
+// AuditRule describes one pattern rule of an Auditor
+type AuditRule = auditor.Rule
+
+// AuditLimits bound the work done on pathological input
+type AuditLimits = auditor.Limits
+
+// DefaultAuditLimits returns the limits an Auditor uses by default
+func DefaultAuditLimits() AuditLimits { return auditor.DefaultLimits() }
+
+// ErrAuditContentTooLarge is returned by AnalyzeContext for content over
+// AuditLimits.MaxContentSize
+var ErrAuditContentTooLarge = auditor.ErrContentTooLarge
+
+// Risk levels reported in Report.RiskLevel
+const (
+	RiskMinimal      = auditor.RiskMinimal
+	RiskLimited      = auditor.RiskLimited
+	RiskHigh         = auditor.RiskHigh
+	RiskUnacceptable = auditor.RiskUnacceptable
+)
+
+// AuditorOption configures an Auditor
+type AuditorOption func(*auditorConfig)
+
+type auditorConfig struct {
+	customRules string
+	limits      *AuditLimits
+	project     *ProjectOptions
+}
+
+// WithCustomRules adds rules in the YAML format accepted by
+// `vura audit --rules` on top of the built-in ones
+func WithCustomRules(yaml string) AuditorOption {
+	return func(c *auditorConfig) { c.customRules = yaml }
+}
+
+// WithAuditLimits replaces DefaultAuditLimits; zero fields disable a limit
+func WithAuditLimits(l AuditLimits) AuditorOption {
+	return func(c *auditorConfig) { c.limits = &l }
+}
+
+// WithProjectOptions replaces the defaults of AnalyzeProject, which only
+// chains files that reference each other
+func WithProjectOptions(o ProjectOptions) AuditorOption {
+	return func(c *auditorConfig) { c.project = &o }
+}
+
+// Auditor checks skill.md and similar agent instruction files for
+// dangerous capabilities. It is safe for concurrent use.
+type Auditor struct {
+	a *auditor.Auditor
+}
+
+// NewAuditor creates an Auditor. It only fails when custom rules don't parse.
+func NewAuditor(opts ...AuditorOption) (*Auditor, error) {
+	var cfg auditorConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	a := auditor.New()
+	if cfg.customRules != "" {
+		var err error
+		if a, err = auditor.NewWithCustomRules(cfg.customRules); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.limits != nil {
+		a.SetLimits(*cfg.limits)
+	}
+	if cfg.project != nil {
+		a.SetProjectOptions(*cfg.project)
+	}
+	return &Auditor{a: a}, nil
+}
+
+// Analyze audits content and returns the report
+func (a *Auditor) Analyze(content string) Report {
+	return a.a.Analyze(content)
+}
+
+// AnalyzeContext audits untrusted content: content over the size limit is
+// rejected with ErrAuditContentTooLarge, and the audit stops when ctx ends
+func (a *Auditor) AnalyzeContext(ctx context.Context, content string) (Report, error) {
+	return a.a.AnalyzeContext(ctx, content)
+}
+
+// AnalyzeProject audits files, keyed by path, one by one and together, so
+// behavior chains may span files
+func (a *Auditor) AnalyzeProject(files map[string]string) ProjectReport {
+	return a.a.AnalyzeProject(files)
+}
+
+// AnalyzeProjectContext is AnalyzeProject for untrusted input, with the
+// size limit applied to the files in total
+func (a *Auditor) AnalyzeProjectContext(ctx context.Context, files map[string]string) (ProjectReport, error) {
+	return a.a.AnalyzeProjectContext(ctx, files)
+}
+
+// Diff audits two versions of a file and returns what was added and resolved
+func (a *Auditor) Diff(oldContent, newContent string) DiffReport {
+	return auditor.Diff(a.a.Analyze(oldContent), a.a.Analyze(newContent))
+}
+
+// Rules lists the built-in and custom rules, with their regexes
+func (a *Auditor) Rules() []AuditRule {
+	return a.a.Rules()
+}
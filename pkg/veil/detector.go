@@ -0,0 +1,139 @@
+package veil
+
+import (
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/pkg/pii"
+)
+
+// Match is a single PII or secret detection
+type Match = detector.Match
+
+// Category identifies the kind of PII, e.g. pii.CatEmail
+type Category = pii.Category
+
+// Sensitivity controls detection aggressiveness
+type Sensitivity = detector.Sensitivity
+
+const (
+	SensitivityLow    = detector.SensitivityLow    // only high-confidence matches
+	SensitivityMedium = detector.SensitivityMedium // balanced (default)
+	SensitivityHigh   = detector.SensitivityHigh   // aggressive, more false positives
+)
+
+// Action controls how a detected category is transformed by Anonymize
+type Action = detector.Action
+
+const (
+	ActionTokenize = detector.ActionTokenize // [PREFIX_N] token, original kept in the mapping
+	ActionRedact   = detector.ActionRedact   // [REDACTED_CATEGORY], nothing stored
+	ActionMask     = detector.ActionMask     // partial mask inline
+	ActionAllow    = detector.ActionAllow    // left untouched
+	ActionStrip    = detector.ActionStrip    // [SECRET REMOVED], nothing stored
+	ActionBlock    = detector.ActionBlock    // the proxy rejects the request; stripped by Anonymize
+)
+
+// SecretActions chooses mask, strip or block per secret category or
+// "SECRET_*"-style group, see WithSecretActions
+type SecretActions = detector.SecretActions
+
+// DetectorOption configures a Detector
+type DetectorOption func(*detector.Config)
+
+// WithSensitivity sets the detection sensitivity (default SensitivityMedium)
+func WithSensitivity(s Sensitivity) DetectorOption {
+	return func(c *detector.Config) { c.Sensitivity = s }
+}
+
+// WithVietnamPatterns enables or disables Vietnam-specific patterns (default on)
+func WithVietnamPatterns(enabled bool) DetectorOption {
+	return func(c *detector.Config) { c.EnableVietnam = enabled }
+}
+
+// WithInternationalPatterns enables or disables international patterns (default on)
+func WithInternationalPatterns(enabled bool) DetectorOption {
+	return func(c *detector.Config) { c.EnableIntl = enabled }
+}
+
+// WithSecretPatterns enables or disables API key and credential patterns (default on)
+func WithSecretPatterns(enabled bool) DetectorOption {
+	return func(c *detector.Config) { c.EnableSecrets = enabled }
+}
+
+// WithAllowList sets values that are never flagged
+func WithAllowList(values ...string) DetectorOption {
+	return func(c *detector.Config) { c.AllowList = toSet(values) }
+}
+
+// WithBlockList sets values that are always flagged regardless of confidence
+func WithBlockList(values ...string) DetectorOption {
+	return func(c *detector.Config) { c.BlockList = toSet(values) }
+}
+
+// WithPolicy overrides the anonymization action for the given categories.
+// Secrets default to ActionMask, everything else to ActionTokenize.
+func WithPolicy(policy map[Category]Action) DetectorOption {
+	return func(c *detector.Config) {
+		c.Policy = make(map[pii.Category]detector.Action, len(policy))
+		for cat, a := range policy {
+			c.Policy[cat] = a
+		}
+	}
+}
+
+// WithSecretActions sets the action for detected secrets (default
+// ActionMask for every secret). Keys are secret categories, groups ending
+// in "*" such as "SECRET_AWS_*", or "*" for every secret.
+func WithSecretActions(actions SecretActions) DetectorOption {
+	return func(c *detector.Config) { c.Secrets = actions }
+}
+
+// Detector finds PII and secrets in text and replaces them with tokens.
+// It is safe for concurrent use.
+type Detector struct {
+	d *detector.Detector
+}
+
+// NewDetector creates a Detector with all pattern sets enabled unless
+// options say otherwise
+func NewDetector(opts ...DetectorOption) *Detector {
+	cfg := detector.DefaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Detector{d: detector.NewWithConfig(cfg)}
+}
+
+// Scan returns the detections in text, sorted by position. Overlapping
+// candidates are resolved to the most specific one.
+func (d *Detector) Scan(text string) []Match {
+	return d.d.Scan(text)
+}
+
+// Anonymize replaces detections in text and returns the result together
+// with the token -> original mapping needed to restore it. Redacted values
+// are not included in the mapping.
+func (d *Detector) Anonymize(text string) (string, map[string]string) {
+	return d.d.Anonymize(text)
+}
+
+// AnonymizeWith is like Anonymize but continues an earlier mapping: values
+// already in existing (token -> original) keep their token and new values
+// are numbered after it. Use it to anonymize several messages of one
+// conversation without tokens changing meaning.
+func (d *Detector) AnonymizeWith(text string, existing map[string]string) (string, map[string]string) {
+	result, applied := d.d.AnonymizeWith(text, existing)
+	return result, d.d.Mapping(applied)
+}
+
+// ResetCounters is a no-op kept for compatibility.
+//
+// Deprecated: token numbering restarts on every Anonymize call.
+func (d *Detector) ResetCounters() {}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,61 @@
+package veil
+
+import "github.com/vurakit/agentveil/internal/promptguard"
+
+// ScanResult is the outcome of a prompt-injection scan
+type ScanResult = promptguard.ScanResult
+
+// Detection is a single prompt-injection signal within a ScanResult
+type Detection = promptguard.Detection
+
+// ThreatLevel is the severity of a prompt-injection attempt
+type ThreatLevel = promptguard.ThreatLevel
+
+const (
+	ThreatNone     = promptguard.ThreatNone
+	ThreatLow      = promptguard.ThreatLow
+	ThreatMedium   = promptguard.ThreatMedium
+	ThreatHigh     = promptguard.ThreatHigh
+	ThreatCritical = promptguard.ThreatCritical
+)
+
+// PromptGuardOption configures a PromptGuard
+type PromptGuardOption func(*[]promptguard.Option)
+
+// WithBlockThreshold sets the threat level at which ShouldBlock reports
+// true (default ThreatHigh)
+func WithBlockThreshold(level ThreatLevel) PromptGuardOption {
+	return func(opts *[]promptguard.Option) {
+		*opts = append(*opts, promptguard.WithBlockThreshold(level))
+	}
+}
+
+// PromptGuard detects prompt injection in model input and leaked
+// instructions in model output. It is safe for concurrent use.
+type PromptGuard struct {
+	g *promptguard.Guard
+}
+
+// NewPromptGuard creates a PromptGuard with the built-in patterns
+func NewPromptGuard(opts ...PromptGuardOption) *PromptGuard {
+	var inner []promptguard.Option
+	for _, opt := range opts {
+		opt(&inner)
+	}
+	return &PromptGuard{g: promptguard.New(inner...)}
+}
+
+// ScanInput checks text sent to a model
+func (p *PromptGuard) ScanInput(text string) ScanResult {
+	return p.g.ScanInput(text)
+}
+
+// ScanOutput checks text returned by a model
+func (p *PromptGuard) ScanOutput(text string) ScanResult {
+	return p.g.ScanOutput(text)
+}
+
+// ShouldBlock reports whether result reaches the configured block threshold
+func (p *PromptGuard) ShouldBlock(result ScanResult) bool {
+	return p.g.ShouldBlock(result)
+}
@@ -0,0 +1,22 @@
+// Package veil is the embeddable public API of agentveil: PII detection and
+// anonymization, skill auditing and prompt-injection scanning, without the
+// proxy.
+//
+// The implementation lives in agentveil's internal packages; veil exposes a
+// deliberately small surface over them so the internals stay free to change.
+//
+// # Compatibility
+//
+// veil follows semantic versioning together with the agentveil module.
+// Within a major version:
+//
+//   - exported identifiers in this package are not removed or renamed, and
+//     function signatures do not change;
+//   - new functions, options, methods and struct fields may be added;
+//   - re-exported result types (Match, Report, ScanResult, ...) may gain
+//     fields, so construct them with field names if at all;
+//   - detection patterns and scores are tuned between releases, so the exact
+//     matches for a given input are not part of the contract.
+//
+// Anything outside this package (internal/..., cmd/...) carries no guarantee.
+package veil
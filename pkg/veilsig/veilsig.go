@@ -0,0 +1,219 @@
+// Package veilsig signs requests leaving Agent Veil and lets an upstream
+// gateway verify them, proving a request passed through the PII shield.
+//
+// The proxy signs with an Ed25519 private key and sets two headers:
+//
+//	X-Veil-Timestamp: <unix seconds>
+//	X-Veil-Signature: <base64 Ed25519 signature>
+//
+// The signature covers the method, request URI (path and query), the
+// SHA-256 of the body as sent upstream, and the timestamp:
+//
+//	METHOD \n REQUEST_URI \n hex(sha256(body)) \n TIMESTAMP
+//
+// A gateway verifies with the matching public key:
+//
+//	if err := veilsig.Verify(pub, r); err != nil {
+//		http.Error(w, "unsigned request", http.StatusForbidden)
+//		return
+//	}
+//
+// Verify only accepts timestamps within DefaultMaxSkew of the local clock,
+// which bounds how long a captured request can be replayed. Use a Verifier
+// to also reject a signature seen before within that window.
+package veilsig
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Header names set on signed requests
+const (
+	HeaderSignature = "X-Veil-Signature"
+	HeaderTimestamp = "X-Veil-Timestamp"
+)
+
+// DefaultMaxSkew is the accepted difference between the signing timestamp
+// and the verifier's clock, in either direction
+const DefaultMaxSkew = 5 * time.Minute
+
+// Verification errors
+var (
+	ErrMissingSignature = errors.New("veilsig: missing signature headers")
+	ErrInvalidSignature = errors.New("veilsig: invalid signature")
+	ErrStaleTimestamp   = errors.New("veilsig: timestamp outside allowed skew")
+	ErrReplayed         = errors.New("veilsig: signature already used")
+)
+
+// payload builds the signed message
+func payload(method, requestURI string, body []byte, ts string) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(method + "\n" + requestURI + "\n" + hex.EncodeToString(sum[:]) + "\n" + ts)
+}
+
+// readBody returns the body and puts an unread copy back on r
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("veilsig: read body: %w", err)
+	}
+	return body, nil
+}
+
+// Sign sets X-Veil-Timestamp and X-Veil-Signature on r. It must be called
+// after the final body and URL are in place.
+func Sign(key ed25519.PrivateKey, r *http.Request) error {
+	return signAt(key, r, time.Now())
+}
+
+func signAt(key ed25519.PrivateKey, r *http.Request, now time.Time) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := ed25519.Sign(key, payload(r.Method, r.URL.RequestURI(), body, ts))
+	r.Header.Set(HeaderTimestamp, ts)
+	r.Header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+// Verify checks r's signature against pub and that its timestamp is within
+// DefaultMaxSkew. The body is left readable for the caller.
+func Verify(pub ed25519.PublicKey, r *http.Request) error {
+	_, err := verify(pub, r, time.Now(), DefaultMaxSkew)
+	return err
+}
+
+func verify(pub ed25519.PublicKey, r *http.Request, now time.Time, maxSkew time.Duration) (string, error) {
+	ts := r.Header.Get(HeaderTimestamp)
+	encoded := r.Header.Get(HeaderSignature)
+	if ts == "" || encoded == "" {
+		return "", ErrMissingSignature
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > maxSkew || skew < -maxSkew {
+		return "", ErrStaleTimestamp
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return "", err
+	}
+	if !ed25519.Verify(pub, payload(r.Method, r.URL.RequestURI(), body, ts), sig) {
+		return "", ErrInvalidSignature
+	}
+	return encoded, nil
+}
+
+// Verifier checks signatures and additionally rejects a signature that was
+// already accepted within the skew window. Safe for concurrent use.
+type Verifier struct {
+	PublicKey ed25519.PublicKey
+	MaxSkew   time.Duration // zero uses DefaultMaxSkew
+
+	mu   sync.Mutex
+	seen map[string]time.Time // signature -> when it stops being acceptable
+	now  func() time.Time
+}
+
+// NewVerifier creates a Verifier for pub with DefaultMaxSkew
+func NewVerifier(pub ed25519.PublicKey) *Verifier {
+	return &Verifier{PublicKey: pub}
+}
+
+// Verify checks r like the package-level Verify and rejects replays
+func (v *Verifier) Verify(r *http.Request) error {
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	skew := v.MaxSkew
+	if skew <= 0 {
+		skew = DefaultMaxSkew
+	}
+
+	sig, err := verify(v.PublicKey, r, now, skew)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen == nil {
+		v.seen = make(map[string]time.Time)
+	}
+	for s, exp := range v.seen {
+		if now.After(exp) {
+			delete(v.seen, s)
+		}
+	}
+	if _, ok := v.seen[sig]; ok {
+		return ErrReplayed
+	}
+	// Past this point the timestamp check alone rejects the signature
+	unix, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	v.seen[sig] = time.Unix(unix, 0).Add(skew)
+	return nil
+}
+
+// ParsePrivateKey decodes a PEM "PRIVATE KEY" (PKCS #8) Ed25519 key, as
+// produced by `openssl genpkey -algorithm ed25519`
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("veilsig: no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("veilsig: parse private key: %w", err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("veilsig: private key is %T, want Ed25519", key)
+	}
+	return priv, nil
+}
+
+// ParsePublicKey decodes a PEM "PUBLIC KEY" (PKIX) Ed25519 key, as produced
+// by `openssl pkey -pubout`
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("veilsig: no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("veilsig: parse public key: %w", err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("veilsig: public key is %T, want Ed25519", key)
+	}
+	return pub, nil
+}
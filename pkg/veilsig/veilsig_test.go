@@ -0,0 +1,139 @@
+package veilsig
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, priv
+}
+
+func signedRequest(t *testing.T, priv ed25519.PrivateKey, at time.Time) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions?stream=true", strings.NewReader(`{"content":"[EMAIL_1]"}`))
+	if err := signAt(priv, r, at); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSignVerify(t *testing.T) {
+	pub, priv := newKey(t)
+	otherPub, _ := newKey(t)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		modify  func(r *http.Request)
+		pub     ed25519.PublicKey
+		wantErr error
+	}{
+		{"valid", func(r *http.Request) {}, pub, nil},
+		{"wrong key", func(r *http.Request) {}, otherPub, ErrInvalidSignature},
+		{"tampered body", func(r *http.Request) {
+			r.Body = io.NopCloser(strings.NewReader(`{"content":"alice@example.com"}`))
+		}, pub, ErrInvalidSignature},
+		{"tampered path", func(r *http.Request) { r.URL.Path = "/v1/embeddings" }, pub, ErrInvalidSignature},
+		{"tampered query", func(r *http.Request) { r.URL.RawQuery = "stream=false" }, pub, ErrInvalidSignature},
+		{"tampered method", func(r *http.Request) { r.Method = http.MethodPut }, pub, ErrInvalidSignature},
+		{"tampered timestamp", func(r *http.Request) {
+			r.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix()+1, 10))
+		}, pub, ErrInvalidSignature},
+		{"missing signature", func(r *http.Request) { r.Header.Del(HeaderSignature) }, pub, ErrMissingSignature},
+		{"garbage signature", func(r *http.Request) { r.Header.Set(HeaderSignature, "%%%") }, pub, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := signedRequest(t, priv, now)
+			tt.modify(r)
+			if err := Verify(tt.pub, r); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerify_BodyStillReadable(t *testing.T) {
+	pub, priv := newKey(t)
+	r := signedRequest(t, priv, time.Now())
+	if err := Verify(pub, r); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(r.Body)
+	if string(body) != `{"content":"[EMAIL_1]"}` {
+		t.Errorf("body not restored: %q", body)
+	}
+}
+
+func TestVerify_ClockSkew(t *testing.T) {
+	pub, priv := newKey(t)
+	for _, offset := range []time.Duration{-DefaultMaxSkew - time.Minute, DefaultMaxSkew + time.Minute} {
+		r := signedRequest(t, priv, time.Now().Add(offset))
+		if err := Verify(pub, r); !errors.Is(err, ErrStaleTimestamp) {
+			t.Errorf("offset %v: Verify() = %v, want ErrStaleTimestamp", offset, err)
+		}
+	}
+	r := signedRequest(t, priv, time.Now().Add(-DefaultMaxSkew/2))
+	if err := Verify(pub, r); err != nil {
+		t.Errorf("within skew: %v", err)
+	}
+}
+
+func TestVerifier_RejectsReplay(t *testing.T) {
+	pub, priv := newKey(t)
+	now := time.Now()
+	v := NewVerifier(pub)
+	v.now = func() time.Time { return now }
+
+	r := signedRequest(t, priv, now)
+	sig, ts := r.Header.Get(HeaderSignature), r.Header.Get(HeaderTimestamp)
+	if err := v.Verify(r); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+
+	replay := httptest.NewRequest(http.MethodPost, "/v1/chat/completions?stream=true", strings.NewReader(`{"content":"[EMAIL_1]"}`))
+	replay.Header.Set(HeaderSignature, sig)
+	replay.Header.Set(HeaderTimestamp, ts)
+	if err := v.Verify(replay); !errors.Is(err, ErrReplayed) {
+		t.Errorf("replay: Verify() = %v, want ErrReplayed", err)
+	}
+
+	// Once the window has passed the timestamp check rejects it instead
+	v.now = func() time.Time { return now.Add(DefaultMaxSkew + time.Second) }
+	if err := v.Verify(replay); !errors.Is(err, ErrStaleTimestamp) {
+		t.Errorf("after window: Verify() = %v, want ErrStaleTimestamp", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	pub, priv := newKey(t)
+	privDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+
+	gotPriv, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}))
+	if err != nil || !gotPriv.Equal(priv) {
+		t.Fatalf("ParsePrivateKey: %v", err)
+	}
+	gotPub, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	if err != nil || !gotPub.Equal(pub) {
+		t.Fatalf("ParsePublicKey: %v", err)
+	}
+	if _, err := ParsePrivateKey([]byte("not pem")); err == nil {
+		t.Error("expected error for non-PEM input")
+	}
+}
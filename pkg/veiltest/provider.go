@@ -0,0 +1,138 @@
+package veiltest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Reply is one scripted answer of a FakeProvider. Set Content for a chat
+// completion, Stream for an SSE chat completion stream, or Body for any
+// other response.
+type Reply struct {
+	Status int // default 200
+
+	// Content is the assistant message of a chat completion
+	Content string
+	// Stream is sent as one SSE chunk per element, each a delta of the
+	// assistant message, followed by data: [DONE]
+	Stream []string
+
+	// Body and ContentType are sent as is when Body is set
+	Body        string
+	ContentType string
+}
+
+// Request is a request as the provider received it, after Veil
+type Request struct {
+	Method string
+	Path   string // including the query
+	Header http.Header
+	Body   string
+}
+
+// FakeProvider is a recording stand-in for an LLM provider. It answers with
+// the scripted replies in order, then echoes each request body back as the
+// assistant message, so any token the proxy sent is visible in the response.
+type FakeProvider struct {
+	URL string
+
+	mu       sync.Mutex
+	script   []Reply
+	requests []Request
+}
+
+// NewFakeProvider starts a FakeProvider, closed when the test ends
+func NewFakeProvider(t testing.TB) *FakeProvider {
+	t.Helper()
+	f := &FakeProvider{}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	f.URL = srv.URL
+	return f
+}
+
+// Script queues replies for the next requests
+func (f *FakeProvider) Script(replies ...Reply) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.script = append(f.script, replies...)
+}
+
+// Requests returns every request received so far
+func (f *FakeProvider) Requests() []Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Request(nil), f.requests...)
+}
+
+// LastRequest returns the most recent request, zero when there was none
+func (f *FakeProvider) LastRequest() Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		return Request{}
+	}
+	return f.requests[len(f.requests)-1]
+}
+
+func (f *FakeProvider) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	f.requests = append(f.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.RequestURI(),
+		Header: r.Header.Clone(),
+		Body:   string(body),
+	})
+	reply := Reply{Content: string(body)}
+	if len(f.script) > 0 {
+		reply, f.script = f.script[0], f.script[1:]
+	}
+	f.mu.Unlock()
+
+	status := reply.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	switch {
+	case reply.Body != "":
+		if reply.ContentType != "" {
+			w.Header().Set("Content-Type", reply.ContentType)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, reply.Body)
+	case reply.Stream != nil:
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(status)
+		flusher, _ := w.(http.Flusher)
+		for _, delta := range reply.Stream {
+			chunk, _ := json.Marshal(map[string]any{
+				"id":      "chatcmpl-veiltest",
+				"object":  "chat.completion.chunk",
+				"choices": []any{map[string]any{"index": 0, "delta": map[string]string{"content": delta}}},
+			})
+			io.WriteString(w, "data: "+string(chunk)+"\n\n")
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	default:
+		completion, _ := json.Marshal(map[string]any{
+			"id":     "chatcmpl-veiltest",
+			"object": "chat.completion",
+			"choices": []any{map[string]any{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": reply.Content},
+				"finish_reason": "stop",
+			}},
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(completion)
+	}
+}
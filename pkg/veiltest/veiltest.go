@@ -0,0 +1,329 @@
+// Package veiltest runs agentveil in-process for integration tests, so a
+// team can assert that their agent is protected: "when my agent sends this
+// prompt through Veil, the provider never sees the raw CCCD and the answer
+// comes back rehydrated".
+//
+// NewTestProxy starts a proxy backed by an in-memory Redis in front of a
+// FakeProvider. Point the agent's LLM base URL at Proxy.URL, run it, then
+// check what crossed the proxy:
+//
+//	p := veiltest.NewTestProxy(t, veiltest.Options{})
+//	p.Chat(t, "CCCD của tôi là 012345678901")
+//	p.UpstreamNeverSaw(t, "012345678901")
+//	p.ResponseContains(t, "012345678901")
+//
+// veiltest follows the compatibility rules of pkg/veil.
+package veiltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vurakit/agentveil/internal/detector"
+	"github.com/vurakit/agentveil/internal/promptguard"
+	"github.com/vurakit/agentveil/internal/proxy"
+	"github.com/vurakit/agentveil/internal/vault"
+	"github.com/vurakit/agentveil/pkg/veil"
+)
+
+// DefaultSessionID is the X-Session-ID Chat sends unless WithSession is given
+const DefaultSessionID = "veiltest"
+
+// Options configures NewTestProxy. The zero value is a proxy with the
+// default detector in front of an echoing FakeProvider.
+type Options struct {
+	// Provider answers the proxy's upstream requests; nil starts a
+	// FakeProvider with no script
+	Provider *FakeProvider
+	// Detector configures PII detection like veil.NewDetector
+	Detector []veil.DetectorOption
+	// PromptGuard blocks prompt injection with the default guard settings
+	PromptGuard bool
+	// DefaultRole is the role of requests without X-User-Role. It defaults
+	// to admin so responses are fully rehydrated; a production proxy
+	// defaults to viewer, which masks them.
+	DefaultRole string
+}
+
+// Response is a response as the client received it from the proxy
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// Proxy is a running agentveil proxy for one test
+type Proxy struct {
+	// URL is the proxy's base URL; clients use URL + "/v1" as their
+	// OpenAI-compatible base URL
+	URL string
+	// Provider is the fake upstream behind the proxy
+	Provider *FakeProvider
+
+	mu        sync.Mutex
+	idle      *sync.Cond // signalled when inflight drops to zero
+	inflight  int
+	responses []Response
+}
+
+// NewTestProxy starts a proxy, closed when the test ends
+func NewTestProxy(t testing.TB, opts Options) *Proxy {
+	t.Helper()
+	p := &Proxy{Provider: opts.Provider}
+	p.idle = sync.NewCond(&p.mu)
+	if p.Provider == nil {
+		p.Provider = NewFakeProvider(t)
+	}
+
+	cfg := detector.DefaultConfig()
+	for _, opt := range opts.Detector {
+		opt(&cfg)
+	}
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	role := opts.DefaultRole
+	if role == "" {
+		role = "admin"
+	}
+	var proxyOpts []proxy.Option
+	if opts.PromptGuard {
+		proxyOpts = append(proxyOpts, proxy.WithPromptGuard(promptguard.New()))
+	}
+	srv, err := proxy.New(proxy.Config{TargetURL: p.Provider.URL, DefaultRole: role},
+		detector.NewWithConfig(cfg), vault.NewWithClient(client), proxyOpts...)
+	if err != nil {
+		t.Fatalf("veiltest: start proxy: %v", err)
+	}
+
+	ts := httptest.NewServer(p.record(srv.Handler()))
+	t.Cleanup(ts.Close)
+	p.URL = ts.URL
+	return p
+}
+
+// RequestOption adjusts a request sent by Chat or Do
+type RequestOption func(*http.Request)
+
+// WithSession sets X-Session-ID
+func WithSession(id string) RequestOption {
+	return func(r *http.Request) { r.Header.Set("X-Session-ID", id) }
+}
+
+// WithRole sets X-User-Role
+func WithRole(role string) RequestOption {
+	return func(r *http.Request) { r.Header.Set("X-User-Role", role) }
+}
+
+// WithHeader sets a request header
+func WithHeader(key, value string) RequestOption {
+	return func(r *http.Request) { r.Header.Set(key, value) }
+}
+
+// Chat sends prompt as the user message of an OpenAI chat completion
+// request in session DefaultSessionID
+func (p *Proxy) Chat(t testing.TB, prompt string, opts ...RequestOption) Response {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{
+		"model":    "gpt-4o-mini",
+		"messages": []map[string]string{{"role": "user", "content": prompt}},
+	})
+	return p.Do(t, http.MethodPost, "/v1/chat/completions", string(body),
+		append([]RequestOption{WithSession(DefaultSessionID)}, opts...)...)
+}
+
+// Do sends a request to the proxy. JSON bodies get a JSON Content-Type.
+func (p *Proxy) Do(t testing.TB, method, path, body string, opts ...RequestOption) Response {
+	t.Helper()
+	req, err := http.NewRequest(method, p.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("veiltest: %v", err)
+	}
+	if json.Valid([]byte(body)) {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("veiltest: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: string(data)}
+}
+
+// Responses returns every response the proxy sent, from any client. It
+// waits for requests in flight.
+func (p *Proxy) Responses() []Response {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitIdle()
+	return append([]Response(nil), p.responses...)
+}
+
+// LastResponse returns the most recent response the proxy sent. It waits
+// for requests in flight.
+func (p *Proxy) LastResponse() Response {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitIdle()
+	if len(p.responses) == 0 {
+		return Response{}
+	}
+	return p.responses[len(p.responses)-1]
+}
+
+// UpstreamNeverSaw fails the test if value reached the provider in any
+// request path, header or body
+func (p *Proxy) UpstreamNeverSaw(t testing.TB, value string) {
+	t.Helper()
+	for i, r := range p.Provider.Requests() {
+		if where := find(r, value); where != "" {
+			t.Errorf("veiltest: upstream request %d (%s %s) contains %q in its %s", i+1, r.Method, r.Path, value, where)
+		}
+	}
+}
+
+// UpstreamSaw fails the test unless value reached the provider in the
+// latest request, e.g. the token a value was replaced with
+func (p *Proxy) UpstreamSaw(t testing.TB, value string) {
+	t.Helper()
+	r := p.Provider.LastRequest()
+	if find(r, value) == "" {
+		t.Errorf("veiltest: upstream request %s %s does not contain %q: %s", r.Method, r.Path, value, r.Body)
+	}
+}
+
+// ResponseContains fails the test unless the latest response contains value
+func (p *Proxy) ResponseContains(t testing.TB, value string) {
+	t.Helper()
+	if resp := p.LastResponse(); !strings.Contains(resp.Body, value) {
+		t.Errorf("veiltest: response does not contain %q: %s", value, resp.Body)
+	}
+}
+
+// ResponseNotContains fails the test if the latest response contains value
+func (p *Proxy) ResponseNotContains(t testing.TB, value string) {
+	t.Helper()
+	if resp := p.LastResponse(); strings.Contains(resp.Body, value) {
+		t.Errorf("veiltest: response contains %q: %s", value, resp.Body)
+	}
+}
+
+// WasBlockedWithType fails the test unless the proxy refused the latest
+// request with an error of the given type, such as "prompt_injection"
+// or "forbidden"
+func (p *Proxy) WasBlockedWithType(t testing.TB, errType string) {
+	t.Helper()
+	resp := p.LastResponse()
+	if resp.StatusCode < 400 {
+		t.Errorf("veiltest: request was not blocked, status %d: %s", resp.StatusCode, resp.Body)
+		return
+	}
+	if got := errorType(resp.Body); got != errType {
+		t.Errorf("veiltest: request blocked with type %q, want %q: %s", got, errType, resp.Body)
+	}
+}
+
+// errorType reads {"error":"type"} and {"error":{"type":"type"}} bodies
+func errorType(body string) string {
+	var resp struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal([]byte(body), &resp) != nil {
+		return ""
+	}
+	var code string
+	if json.Unmarshal(resp.Error, &code) == nil {
+		return code
+	}
+	var obj struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(resp.Error, &obj)
+	return obj.Type
+}
+
+// find returns the part of r that contains value, or ""
+func find(r Request, value string) string {
+	switch {
+	case strings.Contains(r.Body, value):
+		return "body"
+	case strings.Contains(r.Path, value):
+		return "path"
+	}
+	for name, values := range r.Header {
+		for _, v := range values {
+			if strings.Contains(v, value) {
+				return "header " + name
+			}
+		}
+	}
+	return ""
+}
+
+// waitIdle waits, with p.mu held, until no request is being served. A
+// client can read a whole response before its handler returns.
+func (p *Proxy) waitIdle() {
+	for p.inflight > 0 {
+		p.idle.Wait()
+	}
+}
+
+// record keeps a copy of every response next sends
+func (p *Proxy) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.inflight++
+		p.mu.Unlock()
+
+		rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		// Deferred, since the reverse proxy aborts failed copies with a panic
+		defer func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.responses = append(p.responses, Response{StatusCode: rw.status, Header: w.Header().Clone(), Body: rw.body.String()})
+			if p.inflight--; p.inflight == 0 {
+				p.idle.Broadcast()
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,55 @@
+package veiltest
+
+import (
+	"fmt"
+	"testing"
+)
+
+// recordingT captures failures instead of failing the test
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertionsReportFailures(t *testing.T) {
+	p := NewTestProxy(t, Options{})
+	p.Provider.Script(Reply{Content: "ok"})
+	// Values that are not PII pass through, so these assertions must fail
+	p.Chat(t, "hello", WithHeader("X-Trace", "trace-0042"))
+
+	rt := &recordingT{TB: t}
+	p.UpstreamNeverSaw(rt, "trace-0042")
+	p.UpstreamNeverSaw(rt, "hello")
+	p.ResponseContains(rt, "goodbye")
+	p.WasBlockedWithType(rt, "prompt_injection")
+	if len(rt.errors) != 4 {
+		t.Errorf("got %d failures, want 4: %q", len(rt.errors), rt.errors)
+	}
+
+	rt = &recordingT{TB: t}
+	p.UpstreamNeverSaw(rt, "012345678901")
+	p.UpstreamSaw(rt, "hello")
+	p.ResponseContains(rt, "ok")
+	p.ResponseNotContains(rt, "goodbye")
+	if len(rt.errors) != 0 {
+		t.Errorf("unexpected failures: %q", rt.errors)
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"error":"forbidden","message":"unknown role"}`:         "forbidden",
+		`{"error":{"type":"prompt_injection","message":"nope"}}`: "prompt_injection",
+		`not json`: "",
+	} {
+		if got := errorType(body); got != want {
+			t.Errorf("errorType(%s) = %q, want %q", body, got, want)
+		}
+	}
+}
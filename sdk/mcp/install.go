@@ -0,0 +1,193 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ServerName is the key Agent Veil registers itself under in a client's
+// mcpServers map
+const ServerName = "agentveil"
+
+// Client is an MCP client whose config file can be edited
+type Client string
+
+// Supported clients. Both keep servers in a top-level "mcpServers" object;
+// Claude Code entries also carry the transport type, Cursor entries don't.
+const (
+	ClientClaude Client = "claude" // Claude Code, ~/.claude.json
+	ClientCursor Client = "cursor" // Cursor, ~/.cursor/mcp.json
+)
+
+// ParseClient maps a CLI argument to a Client
+func ParseClient(name string) (Client, error) {
+	switch name {
+	case "claude", "claude-code":
+		return ClientClaude, nil
+	case "cursor":
+		return ClientCursor, nil
+	}
+	return "", fmt.Errorf("unknown MCP client %q (want claude or cursor)", name)
+}
+
+// ConfigPath returns the user-level config file of c under home
+func (c Client) ConfigPath(home string) string {
+	if c == ClientCursor {
+		return filepath.Join(home, ".cursor", "mcp.json")
+	}
+	return filepath.Join(home, ".claude.json")
+}
+
+// Registration is the command a client runs to start the server
+type Registration struct {
+	Command string
+	Args    []string
+	Env     map[string]string
+}
+
+// entry renders r in c's config format
+func (c Client) entry(r Registration) map[string]any {
+	e := map[string]any{"command": r.Command, "args": r.Args}
+	if len(r.Env) > 0 {
+		e["env"] = r.Env
+	}
+	if c == ClientClaude {
+		e["type"] = "stdio"
+	}
+	return e
+}
+
+// Install registers r under ServerName in the config file at path, creating
+// the file if needed. Other servers and unrelated settings are kept. The
+// previous file is copied to path + ".bak" before it is rewritten; when the
+// registration is already current nothing is written and changed is false.
+func Install(c Client, path string, r Registration) (changed bool, err error) {
+	doc, servers, err := readConfig(path)
+	if err != nil {
+		return false, err
+	}
+
+	want, err := json.Marshal(c.entry(r))
+	if err != nil {
+		return false, err
+	}
+	if have, ok := servers[ServerName]; ok && sameJSON(have, want) {
+		return false, nil
+	}
+
+	servers[ServerName] = want
+	if err := writeConfig(path, doc, servers); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Uninstall removes the ServerName registration from the config file at
+// path, backing the file up first. removed is false when there was none.
+func Uninstall(path string) (removed bool, err error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+	doc, servers, err := readConfig(path)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := servers[ServerName]; !ok {
+		return false, nil
+	}
+
+	delete(servers, ServerName)
+	if err := writeConfig(path, doc, servers); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readConfig loads the top-level object and its mcpServers map, keeping
+// every value as raw JSON so unknown settings survive a rewrite untouched
+func readConfig(path string) (map[string]json.RawMessage, map[string]json.RawMessage, error) {
+	doc := map[string]json.RawMessage{}
+	servers := map[string]json.RawMessage{}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return doc, servers, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return doc, servers, nil
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if raw, ok := doc["mcpServers"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &servers); err != nil {
+			return nil, nil, fmt.Errorf("%s: mcpServers: %w", path, err)
+		}
+	}
+	return doc, servers, nil
+}
+
+// writeConfig backs up the current file and atomically replaces it,
+// keeping its permissions (0600 for a new file, which may hold API keys)
+func writeConfig(path string, doc, servers map[string]json.RawMessage) error {
+	raw, err := json.Marshal(servers)
+	if err != nil {
+		return err
+	}
+	doc["mcpServers"] = raw
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		old, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path+".bak", old, mode); err != nil {
+			return fmt.Errorf("backup %s: %w", path, err)
+		}
+	} else if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// sameJSON reports whether a and b encode the same value, ignoring key
+// order and whitespace
+func sameJSON(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
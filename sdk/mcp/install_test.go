@@ -0,0 +1,208 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testReg = Registration{
+	Command: "/usr/local/bin/agentveil",
+	Args:    []string{"mcp", "serve", "--stdio"},
+	Env:     map[string]string{"VEIL_PROXY_URL": "http://localhost:8080"},
+}
+
+// Claude Code keeps MCP servers next to many unrelated settings
+const claudeFixture = `{
+  "numStartups": 12,
+  "projects": {"/home/dev/app": {"allowedTools": ["Bash"]}},
+  "mcpServers": {
+    "github": {"type": "stdio", "command": "gh-mcp", "args": []}
+  }
+}`
+
+const cursorFixture = `{
+  "mcpServers": {
+    "postgres": {"command": "npx", "args": ["-y", "@modelcontextprotocol/server-postgres"]}
+  }
+}`
+
+func writeFixture(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readJSON(t *testing.T, path string) map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("%s is not valid JSON: %v", path, err)
+	}
+	return doc
+}
+
+func TestInstall_ClaudeMerges(t *testing.T) {
+	path := writeFixture(t, ".claude.json", claudeFixture)
+
+	changed, err := Install(ClientClaude, path, testReg)
+	if err != nil || !changed {
+		t.Fatalf("Install = %v, %v", changed, err)
+	}
+
+	doc := readJSON(t, path)
+	if doc["numStartups"] != float64(12) || doc["projects"] == nil {
+		t.Error("unrelated settings were not preserved")
+	}
+	servers := doc["mcpServers"].(map[string]any)
+	if servers["github"] == nil {
+		t.Error("existing server was clobbered")
+	}
+	entry := servers[ServerName].(map[string]any)
+	if entry["type"] != "stdio" || entry["command"] != testReg.Command {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+	if args := entry["args"].([]any); len(args) != 3 || args[2] != "--stdio" {
+		t.Errorf("args = %v", args)
+	}
+
+	backup, err := os.ReadFile(path + ".bak")
+	if err != nil || string(backup) != claudeFixture {
+		t.Errorf("backup should hold the original file: %v", err)
+	}
+}
+
+func TestInstall_CursorFormat(t *testing.T) {
+	path := writeFixture(t, "mcp.json", cursorFixture)
+
+	if _, err := Install(ClientCursor, path, testReg); err != nil {
+		t.Fatal(err)
+	}
+	servers := readJSON(t, path)["mcpServers"].(map[string]any)
+	if servers["postgres"] == nil {
+		t.Error("existing server was clobbered")
+	}
+	entry := servers[ServerName].(map[string]any)
+	if _, ok := entry["type"]; ok {
+		t.Error("cursor entries carry no type")
+	}
+	if env := entry["env"].(map[string]any); env["VEIL_PROXY_URL"] != "http://localhost:8080" {
+		t.Errorf("env = %v", env)
+	}
+}
+
+func TestInstall_Idempotent(t *testing.T) {
+	path := writeFixture(t, ".claude.json", claudeFixture)
+
+	if _, err := Install(ClientClaude, path, testReg); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := os.ReadFile(path)
+	os.Remove(path + ".bak")
+
+	changed, err := Install(ClientClaude, path, testReg)
+	if err != nil || changed {
+		t.Fatalf("second Install = %v, %v; want no change", changed, err)
+	}
+	second, _ := os.ReadFile(path)
+	if string(first) != string(second) {
+		t.Error("file changed on a repeated install")
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Error("no backup should be written when nothing changes")
+	}
+
+	// A changed registration is updated in place
+	reg := testReg
+	reg.Env = map[string]string{"VEIL_PROXY_URL": "http://veil:8080"}
+	if changed, _ := Install(ClientClaude, path, reg); !changed {
+		t.Error("a different registration should update the entry")
+	}
+}
+
+func TestInstall_CreatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".cursor", "mcp.json")
+
+	if _, err := Install(ClientCursor, path, testReg); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Error("no backup for a file that didn't exist")
+	}
+	servers := readJSON(t, path)["mcpServers"].(map[string]any)
+	if len(servers) != 1 || servers[ServerName] == nil {
+		t.Errorf("servers = %v", servers)
+	}
+}
+
+func TestInstall_InvalidJSONUntouched(t *testing.T) {
+	path := writeFixture(t, ".claude.json", `{"mcpServers": `)
+
+	if _, err := Install(ClientClaude, path, testReg); err == nil {
+		t.Fatal("expected an error for a malformed config")
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != `{"mcpServers": ` {
+		t.Error("malformed config must be left as is")
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	path := writeFixture(t, ".claude.json", claudeFixture)
+	if _, err := Install(ClientClaude, path, testReg); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := Uninstall(path)
+	if err != nil || !removed {
+		t.Fatalf("Uninstall = %v, %v", removed, err)
+	}
+	doc := readJSON(t, path)
+	servers := doc["mcpServers"].(map[string]any)
+	if servers[ServerName] != nil || servers["github"] == nil {
+		t.Errorf("servers = %v", servers)
+	}
+	if doc["numStartups"] != float64(12) {
+		t.Error("unrelated settings were not preserved")
+	}
+
+	// Nothing left to remove
+	if removed, err := Uninstall(path); err != nil || removed {
+		t.Errorf("second Uninstall = %v, %v", removed, err)
+	}
+	if removed, err := Uninstall(filepath.Join(t.TempDir(), "missing.json")); err != nil || removed {
+		t.Errorf("Uninstall of a missing file = %v, %v", removed, err)
+	}
+}
+
+func TestParseClient(t *testing.T) {
+	for name, want := range map[string]Client{"claude": ClientClaude, "claude-code": ClientClaude, "cursor": ClientCursor} {
+		if got, err := ParseClient(name); err != nil || got != want {
+			t.Errorf("ParseClient(%q) = %q, %v", name, got, err)
+		}
+	}
+	if _, err := ParseClient("vim"); err == nil {
+		t.Error("expected an error for an unknown client")
+	}
+	if got := ClientCursor.ConfigPath("/home/dev"); got != "/home/dev/.cursor/mcp.json" {
+		t.Errorf("cursor path = %s", got)
+	}
+	if got := ClientClaude.ConfigPath("/home/dev"); got != "/home/dev/.claude.json" {
+		t.Errorf("claude path = %s", got)
+	}
+}
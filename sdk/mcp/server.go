@@ -11,10 +11,14 @@ package mcp
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/vurakit/agentveil/internal/auditor"
+	"github.com/vurakit/agentveil/internal/version"
 )
 
 // ToolName constants
@@ -28,6 +32,10 @@ const (
 // Config for the MCP server
 type Config struct {
 	ProxyURL string // Agent Veil proxy URL
+	// SigningKey, when set, signs the audit results of skills at or below
+	// MaxRisk (auditor.RiskLimited when 0)
+	SigningKey ed25519.PrivateKey
+	MaxRisk    int
 }
 
 // Server implements MCP protocol endpoints
@@ -76,35 +84,35 @@ func (s *Server) Handler() http.Handler {
 	return mux
 }
 
-func (s *Server) handleListTools(w http.ResponseWriter, r *http.Request) {
-	tools := ListToolsResponse{
-		Tools: []Tool{
-			{
-				Name:        ToolScanPII,
-				Description: "Scan text for PII (Personally Identifiable Information). Detects Vietnamese CCCD, phone, address, and international PII like credit cards, SSN.",
-				InputSchema: json.RawMessage(`{
+// Tools returns the tools the server exposes
+func (s *Server) Tools() []Tool {
+	return []Tool{
+		{
+			Name:        ToolScanPII,
+			Description: "Scan text for PII (Personally Identifiable Information). Detects Vietnamese CCCD, phone, address, and international PII like credit cards, SSN.",
+			InputSchema: json.RawMessage(`{
 					"type": "object",
 					"properties": {
 						"text": {"type": "string", "description": "Text to scan for PII"}
 					},
 					"required": ["text"]
 				}`),
-			},
-			{
-				Name:        ToolAuditSkill,
-				Description: "Audit an AI agent skill.md file for security compliance against Vietnam AI Law 2026 and international standards.",
-				InputSchema: json.RawMessage(`{
+		},
+		{
+			Name:        ToolAuditSkill,
+			Description: "Audit an AI agent skill.md file for security compliance against Vietnam AI Law 2026 and international standards.",
+			InputSchema: json.RawMessage(`{
 					"type": "object",
 					"properties": {
 						"content": {"type": "string", "description": "Skill.md content to audit"}
 					},
 					"required": ["content"]
 				}`),
-			},
-			{
-				Name:        ToolCheckCompliance,
-				Description: "Check system compliance status against Vietnam AI Law 2026, EU AI Act, and GDPR frameworks.",
-				InputSchema: json.RawMessage(`{
+		},
+		{
+			Name:        ToolCheckCompliance,
+			Description: "Check system compliance status against Vietnam AI Law 2026, EU AI Act, and GDPR frameworks.",
+			InputSchema: json.RawMessage(`{
 					"type": "object",
 					"properties": {
 						"framework": {
@@ -115,20 +123,36 @@ func (s *Server) handleListTools(w http.ResponseWriter, r *http.Request) {
 					},
 					"required": ["framework"]
 				}`),
-			},
-			{
-				Name:        ToolHealthCheck,
-				Description: "Check the health status of the Agent Veil privacy proxy.",
-				InputSchema: json.RawMessage(`{
+		},
+		{
+			Name:        ToolHealthCheck,
+			Description: "Check the health status and version of the Agent Veil privacy proxy.",
+			InputSchema: json.RawMessage(`{
 					"type": "object",
 					"properties": {}
 				}`),
-			},
 		},
 	}
+}
+
+// CallTool runs the named tool; ok is false for an unknown tool
+func (s *Server) CallTool(name string, args json.RawMessage) (result ToolResult, ok bool) {
+	switch name {
+	case ToolScanPII:
+		return s.callScanPII(args), true
+	case ToolAuditSkill:
+		return s.callAuditSkill(args), true
+	case ToolCheckCompliance:
+		return s.callCheckCompliance(args), true
+	case ToolHealthCheck:
+		return s.callHealthCheck(), true
+	}
+	return ToolResult{}, false
+}
 
+func (s *Server) handleListTools(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tools)
+	json.NewEncoder(w).Encode(ListToolsResponse{Tools: s.Tools()})
 }
 
 func (s *Server) handleCallTool(w http.ResponseWriter, r *http.Request) {
@@ -146,18 +170,8 @@ func (s *Server) handleCallTool(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var result ToolResult
-
-	switch req.Name {
-	case ToolScanPII:
-		result = s.callScanPII(req.Params)
-	case ToolAuditSkill:
-		result = s.callAuditSkill(req.Params)
-	case ToolCheckCompliance:
-		result = s.callCheckCompliance(req.Params)
-	case ToolHealthCheck:
-		result = s.callHealthCheck()
-	default:
+	result, ok := s.CallTool(req.Name, req.Params)
+	if !ok {
 		writeToolError(w, fmt.Sprintf("unknown tool: %s", req.Name))
 		return
 	}
@@ -183,6 +197,18 @@ func (s *Server) callScanPII(params json.RawMessage) ToolResult {
 
 	var result map[string]any
 	json.NewDecoder(resp.Body).Decode(&result)
+	if result == nil {
+		result = map[string]any{}
+	}
+	// Build details of the proxy; older proxies have no /version
+	if resp, err := http.Get(s.config.ProxyURL + "/version"); err == nil {
+		var build map[string]any
+		if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&build) == nil {
+			result["build"] = build
+		}
+		resp.Body.Close()
+	}
+	result["mcp_server_version"] = version.Get().Version
 
 	text, _ := json.MarshalIndent(result, "", "  ")
 	return ToolResult{
@@ -205,8 +231,25 @@ func (s *Server) callAuditSkill(params json.RawMessage) ToolResult {
 	}
 	defer resp.Body.Close()
 
+	raw, _ := io.ReadAll(resp.Body)
 	var result map[string]any
-	json.NewDecoder(resp.Body).Decode(&result)
+	json.Unmarshal(raw, &result)
+	if result == nil {
+		result = map[string]any{}
+	}
+	// The proxy answers 403 to a high-risk report
+	if s.config.SigningKey != nil && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusForbidden) {
+		s.signAudit(result, input.Content, raw)
+	}
+	// Build details of the proxy; older proxies have no /version
+	if resp, err := http.Get(s.config.ProxyURL + "/version"); err == nil {
+		var build map[string]any
+		if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&build) == nil {
+			result["build"] = build
+		}
+		resp.Body.Close()
+	}
+	result["mcp_server_version"] = version.Get().Version
 
 	text, _ := json.MarshalIndent(result, "", "  ")
 	return ToolResult{
@@ -214,6 +257,22 @@ func (s *Server) callAuditSkill(params json.RawMessage) ToolResult {
 	}
 }
 
+// signAudit adds the signature of the audited content to result, or why
+// it wasn't signed
+func (s *Server) signAudit(result map[string]any, content string, raw []byte) {
+	var report auditor.Report
+	if err := json.Unmarshal(raw, &report); err != nil {
+		result["signature_error"] = "unreadable audit report: " + err.Error()
+		return
+	}
+	sig, err := auditor.SignReport(s.config.SigningKey, content, report, auditor.SignOptions{MaxRisk: s.config.MaxRisk})
+	if err != nil {
+		result["signature_error"] = err.Error()
+		return
+	}
+	result["signature"] = sig
+}
+
 func (s *Server) callCheckCompliance(params json.RawMessage) ToolResult {
 	var input struct {
 		Framework string `json:"framework"`
@@ -230,6 +289,18 @@ func (s *Server) callCheckCompliance(params json.RawMessage) ToolResult {
 
 	var result map[string]any
 	json.NewDecoder(resp.Body).Decode(&result)
+	if result == nil {
+		result = map[string]any{}
+	}
+	// Build details of the proxy; older proxies have no /version
+	if resp, err := http.Get(s.config.ProxyURL + "/version"); err == nil {
+		var build map[string]any
+		if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&build) == nil {
+			result["build"] = build
+		}
+		resp.Body.Close()
+	}
+	result["mcp_server_version"] = version.Get().Version
 
 	text, _ := json.MarshalIndent(result, "", "  ")
 	return ToolResult{
@@ -246,6 +317,18 @@ func (s *Server) callHealthCheck() ToolResult {
 
 	var result map[string]any
 	json.NewDecoder(resp.Body).Decode(&result)
+	if result == nil {
+		result = map[string]any{}
+	}
+	// Build details of the proxy; older proxies have no /version
+	if resp, err := http.Get(s.config.ProxyURL + "/version"); err == nil {
+		var build map[string]any
+		if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&build) == nil {
+			result["build"] = build
+		}
+		resp.Body.Close()
+	}
+	result["mcp_server_version"] = version.Get().Version
 
 	text, _ := json.MarshalIndent(result, "", "  ")
 	return ToolResult{
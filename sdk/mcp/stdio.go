@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/vurakit/agentveil/internal/version"
+)
+
+// ProtocolVersion is the MCP revision the server speaks
+const ProtocolVersion = "2024-11-05"
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// ServeStdio speaks MCP over newline-delimited JSON-RPC on in and out, the
+// transport Claude Code and Cursor use for servers they launch themselves.
+// It returns when in is closed.
+func (s *Server) ServeStdio(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 10<<20)
+	enc := json.NewEncoder(out)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			resp := rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+				Error: &rpcError{Code: codeParseError, Message: "parse error"}}
+			if err := enc.Encode(resp); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Notifications (no id) never get a response
+		if len(req.ID) == 0 {
+			continue
+		}
+
+		resp := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+		resp.Result, resp.Error = s.dispatch(req.Method, req.Params)
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *Server) dispatch(method string, params json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]string{"name": "agentveil", "version": version.Get().Version},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return ListToolsResponse{Tools: s.Tools()}, nil
+	case "tools/call":
+		var call struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &call); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "invalid params"}
+		}
+		if len(call.Arguments) == 0 {
+			call.Arguments = json.RawMessage("{}")
+		}
+		result, ok := s.CallTool(call.Name, call.Arguments)
+		if !ok {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool: %s", call.Name)}
+		}
+		return result, nil
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
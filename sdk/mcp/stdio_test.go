@@ -0,0 +1,78 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeStdio(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer proxy.Close()
+
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"veil_health"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"nope"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"resources/list"}`,
+		`not json`,
+	}, "\n")
+
+	var out bytes.Buffer
+	s := NewServer(Config{ProxyURL: proxy.URL})
+	if err := s.ServeStdio(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 responses (the notification gets none), got %d:\n%s", len(lines), out.String())
+	}
+
+	type response struct {
+		ID     json.RawMessage `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	var resps []response
+	for _, l := range lines {
+		var r response
+		if err := json.Unmarshal([]byte(l), &r); err != nil {
+			t.Fatalf("invalid response line %q: %v", l, err)
+		}
+		resps = append(resps, r)
+	}
+
+	if !strings.Contains(string(resps[0].Result), ProtocolVersion) {
+		t.Errorf("initialize result = %s", resps[0].Result)
+	}
+
+	var list ListToolsResponse
+	json.Unmarshal(resps[1].Result, &list)
+	if len(list.Tools) != 4 {
+		t.Errorf("expected 4 tools, got %d", len(list.Tools))
+	}
+
+	var result ToolResult
+	json.Unmarshal(resps[2].Result, &result)
+	if result.IsError || len(result.Content) == 0 || !strings.Contains(result.Content[0].Text, "ok") {
+		t.Errorf("tools/call result = %s", resps[2].Result)
+	}
+
+	if resps[3].Error == nil || resps[3].Error.Code != codeInvalidParams {
+		t.Errorf("unknown tool: %+v", resps[3].Error)
+	}
+	if resps[4].Error == nil || resps[4].Error.Code != codeMethodNotFound {
+		t.Errorf("unknown method: %+v", resps[4].Error)
+	}
+	if resps[5].Error == nil || resps[5].Error.Code != codeParseError || string(resps[5].ID) != "null" {
+		t.Errorf("parse error: %s %+v", resps[5].ID, resps[5].Error)
+	}
+}
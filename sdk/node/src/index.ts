@@ -84,6 +84,8 @@ export interface AuditReport {
   risk_level_label: string;
   compliance_score: number;
   summary: string;
+  unique_issues: number;
+  total_occurrences: number;
 }
 
 export interface AuditFinding {
@@ -92,6 +94,8 @@ export interface AuditFinding {
   category: string;
   description: string;
   snippet: string;
+  occurrences: number;
+  lines?: number[];
 }
 
 export class AgentVeilClient {